@@ -0,0 +1,279 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package acme
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/types"
+)
+
+// ChallengeStore stores the tokens used to answer the HTTP-01 challenges.
+// Tokens need to be shared by all the controller instances, because any of
+// them might receive the request from the acme server.
+type ChallengeStore interface {
+	GetToken(domain, uri string) string
+	SetToken(domain, uri, token string) error
+}
+
+const (
+	challengeKeyPrefix = "haproxy-ingress/acme/"
+	challengeTTL       = time.Hour
+	challengeTimeout   = 5 * time.Second
+)
+
+// NewChallengeStore creates a challenge store backed by an external key/value
+// server. storeURL is either `redis://[:password@]host:port[/db]` or
+// `memcached://host:port`.
+func NewChallengeStore(logger types.Logger, storeURL string) (ChallengeStore, error) {
+	u, err := url.Parse(storeURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("missing host in challenge store: %s", storeURL)
+	}
+	switch u.Scheme {
+	case "redis":
+		store := &redisStore{logger: logger, address: u.Host}
+		if u.User != nil {
+			store.password, _ = u.User.Password()
+		}
+		if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+			if _, err := strconv.Atoi(db); err != nil {
+				return nil, fmt.Errorf("invalid redis database: %s", db)
+			}
+			store.db = db
+		}
+		return store, nil
+	case "memcached":
+		return &memcachedStore{logger: logger, address: u.Host}, nil
+	}
+	return nil, fmt.Errorf("unsupported challenge store: %s", u.Scheme)
+}
+
+// challengeValue builds the stored value of a token, using the same
+// `<uri>=<token>` format of the tokens stored in a ConfigMap.
+func challengeValue(uri, token string) string {
+	return uri + "=" + token
+}
+
+// challengeToken returns the token of uri, or an empty string if the stored
+// value belongs to another uri.
+func challengeToken(value, uri string) string {
+	prefix := uri + "="
+	if !strings.HasPrefix(value, prefix) {
+		return ""
+	}
+	return strings.TrimPrefix(value, prefix)
+}
+
+type redisStore struct {
+	logger   types.Logger
+	address  string
+	password string
+	db       string
+}
+
+func (s *redisStore) GetToken(domain, uri string) string {
+	reply, err := s.command("GET", challengeKeyPrefix+domain)
+	if err != nil {
+		s.logger.Warn("acme: error reading token from redis: domain=%s error=%v", domain, err)
+		return ""
+	}
+	value, _ := reply.(string)
+	return challengeToken(value, uri)
+}
+
+func (s *redisStore) SetToken(domain, uri, token string) error {
+	key := challengeKeyPrefix + domain
+	if token == "" {
+		_, err := s.command("DEL", key)
+		return err
+	}
+	_, err := s.command("SET", key, challengeValue(uri, token), "EX", strconv.Itoa(int(challengeTTL.Seconds())))
+	return err
+}
+
+// command opens a new connection for every command, tokens are only read
+// and written a few times per certificate order.
+func (s *redisStore) command(args ...string) (interface{}, error) {
+	conn, err := net.DialTimeout("tcp", s.address, challengeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(challengeTimeout))
+	r := bufio.NewReader(conn)
+	if s.password != "" {
+		if _, err := redisCommand(conn, r, "AUTH", s.password); err != nil {
+			return nil, err
+		}
+	}
+	if s.db != "" {
+		if _, err := redisCommand(conn, r, "SELECT", s.db); err != nil {
+			return nil, err
+		}
+	}
+	return redisCommand(conn, r, args...)
+}
+
+// redisCommand sends a command using the RESP protocol and reads its reply,
+// either a string, an integer, or nil if the key does not exist.
+func redisCommand(w io.Writer, r *bufio.Reader, args ...string) (interface{}, error) {
+	cmd := fmt.Sprintf("*%d\r\n", len(args))
+	for _, arg := range args {
+		cmd += fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(w, cmd); err != nil {
+		return nil, err
+	}
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if line == "" {
+		return nil, fmt.Errorf("empty redis reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, fmt.Errorf("redis: %s", line[1:])
+	case ':':
+		return strconv.Atoi(line[1:])
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:size]), nil
+	}
+	return nil, fmt.Errorf("unsupported redis reply: %s", line)
+}
+
+type memcachedStore struct {
+	logger  types.Logger
+	address string
+}
+
+func (s *memcachedStore) GetToken(domain, uri string) string {
+	value, err := s.get(challengeKeyPrefix + domain)
+	if err != nil {
+		s.logger.Warn("acme: error reading token from memcached: domain=%s error=%v", domain, err)
+		return ""
+	}
+	return challengeToken(value, uri)
+}
+
+func (s *memcachedStore) SetToken(domain, uri, token string) error {
+	key := challengeKeyPrefix + domain
+	if token == "" {
+		reply, err := s.command(fmt.Sprintf("delete %s\r\n", key))
+		if err != nil {
+			return err
+		}
+		if reply != "DELETED" && reply != "NOT_FOUND" {
+			return fmt.Errorf("memcached: %s", reply)
+		}
+		return nil
+	}
+	value := challengeValue(uri, token)
+	reply, err := s.command(fmt.Sprintf("set %s 0 %d %d\r\n%s\r\n", key, int(challengeTTL.Seconds()), len(value), value))
+	if err != nil {
+		return err
+	}
+	if reply != "STORED" {
+		return fmt.Errorf("memcached: %s", reply)
+	}
+	return nil
+}
+
+func (s *memcachedStore) get(key string) (string, error) {
+	conn, r, err := s.dial()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if _, err := fmt.Fprintf(conn, "get %s\r\n", key); err != nil {
+		return "", err
+	}
+	line, err := readLine(r)
+	if err != nil {
+		return "", err
+	}
+	if line == "END" {
+		return "", nil
+	}
+	// VALUE <key> <flags> <bytes>
+	fields := strings.Fields(line)
+	if len(fields) != 4 || fields[0] != "VALUE" {
+		return "", fmt.Errorf("memcached: %s", line)
+	}
+	size, err := strconv.Atoi(fields[3])
+	if err != nil {
+		return "", err
+	}
+	data := make([]byte, size+2)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return "", err
+	}
+	return string(data[:size]), nil
+}
+
+func (s *memcachedStore) command(cmd string) (string, error) {
+	conn, r, err := s.dial()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if _, err := io.WriteString(conn, cmd); err != nil {
+		return "", err
+	}
+	return readLine(r)
+}
+
+func (s *memcachedStore) dial() (net.Conn, *bufio.Reader, error) {
+	conn, err := net.DialTimeout("tcp", s.address, challengeTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	_ = conn.SetDeadline(time.Now().Add(challengeTimeout))
+	return conn, bufio.NewReader(conn), nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,240 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package acme
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestNewChallengeStore(t *testing.T) {
+	testCases := []struct {
+		url      string
+		expected ChallengeStore
+		expErr   string
+	}{
+		// 0
+		{
+			url:      "redis://127.0.0.1:6379",
+			expected: &redisStore{address: "127.0.0.1:6379"},
+		},
+		// 1
+		{
+			url:      "redis://:secret@redis.local:6379/2",
+			expected: &redisStore{address: "redis.local:6379", password: "secret", db: "2"},
+		},
+		// 2
+		{
+			url:    "redis://redis.local:6379/db",
+			expErr: "invalid redis database: db",
+		},
+		// 3
+		{
+			url:      "memcached://memcached.local:11211",
+			expected: &memcachedStore{address: "memcached.local:11211"},
+		},
+		// 4
+		{
+			url:    "etcd://etcd.local:2379",
+			expErr: "unsupported challenge store: etcd",
+		},
+		// 5
+		{
+			url:    "redis.local:6379",
+			expErr: "missing host in challenge store: redis.local:6379",
+		},
+	}
+	for i, test := range testCases {
+		store, err := NewChallengeStore(nil, test.url)
+		if err != nil {
+			if err.Error() != test.expErr {
+				t.Errorf("%d: expected error '%s' but was '%v'", i, test.expErr, err)
+			}
+			continue
+		}
+		if test.expErr != "" {
+			t.Errorf("%d: expected error '%s' but was nil", i, test.expErr)
+		}
+		if !reflect.DeepEqual(store, test.expected) {
+			t.Errorf("%d: expected store %+v but was %+v", i, test.expected, store)
+		}
+	}
+}
+
+func TestChallengeStore(t *testing.T) {
+	testCases := []struct {
+		url   string
+		serve func(r *bufio.Reader, w io.Writer, data map[string]string)
+	}{
+		// 0
+		{
+			url:   "redis://:secret@%s/1",
+			serve: serveRedis,
+		},
+		// 1
+		{
+			url:   "memcached://%s",
+			serve: serveMemcached,
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		address, stored, stop := startStoreServer(t, test.serve)
+		store, err := NewChallengeStore(c.logger, fmt.Sprintf(test.url, address))
+		if err != nil {
+			t.Fatalf("%d: error creating store: %v", i, err)
+		}
+		if err := store.SetToken("d1.local", "/uri1", "token1"); err != nil {
+			t.Errorf("%d: error setting token: %v", i, err)
+		}
+		if err := store.SetToken("d2.local", "/uri2", "token2"); err != nil {
+			t.Errorf("%d: error setting token: %v", i, err)
+		}
+		if err := store.SetToken("d2.local", "/uri2", ""); err != nil {
+			t.Errorf("%d: error removing token: %v", i, err)
+		}
+		if token := store.GetToken("d1.local", "/uri1"); token != "token1" {
+			t.Errorf("%d: expected token 'token1' but was '%s'", i, token)
+		}
+		if token := store.GetToken("d1.local", "/other"); token != "" {
+			t.Errorf("%d: expected empty token of another uri but was '%s'", i, token)
+		}
+		if token := store.GetToken("d2.local", "/uri2"); token != "" {
+			t.Errorf("%d: expected removed token but was '%s'", i, token)
+		}
+		expected := map[string]string{"haproxy-ingress/acme/d1.local": "/uri1=token1"}
+		if data := stored(); !reflect.DeepEqual(data, expected) {
+			t.Errorf("%d: expected stored data %v but was %v", i, expected, data)
+		}
+		stop()
+		if token := store.GetToken("d1.local", "/uri1"); token != "" {
+			t.Errorf("%d: expected empty token from a stopped server but was '%s'", i, token)
+		}
+		if log := c.logger.Logging; len(log) != 1 || !strings.HasPrefix(log[0], "WARN acme: error reading token from ") {
+			t.Errorf("%d: expected a warning reading from a stopped server, but was %v", i, log)
+		}
+		c.logger.Logging = []string{}
+		c.teardown()
+	}
+}
+
+func startStoreServer(t *testing.T, serve func(r *bufio.Reader, w io.Writer, data map[string]string)) (address string, stored func() map[string]string, stop func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	data := map[string]string{}
+	var mutex sync.Mutex
+	stored = func() map[string]string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		out := make(map[string]string, len(data))
+		for k, v := range data {
+			out[k] = v
+		}
+		return out
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(conn)
+			mutex.Lock()
+			serve(r, conn, data)
+			mutex.Unlock()
+			conn.Close()
+		}
+	}()
+	return l.Addr().String(), stored, func() { l.Close() }
+}
+
+// serveRedis answers the commands of one connection, expecting that the
+// client authenticates and selects the database 1 before anything else.
+func serveRedis(r *bufio.Reader, w io.Writer, data map[string]string) {
+	authenticated := false
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return
+		}
+		count, _ := strconv.Atoi(strings.TrimPrefix(line, "*"))
+		args := make([]string, count)
+		for i := range args {
+			_, _ = readLine(r)
+			args[i], _ = readLine(r)
+		}
+		switch {
+		case args[0] == "AUTH":
+			authenticated = args[1] == "secret"
+			fmt.Fprint(w, "+OK\r\n")
+		case !authenticated:
+			fmt.Fprint(w, "-NOAUTH Authentication required.\r\n")
+		case args[0] == "SELECT" && args[1] == "1":
+			fmt.Fprint(w, "+OK\r\n")
+		case args[0] == "SET" && len(args) == 5 && args[3] == "EX" && args[4] == "3600":
+			data[args[1]] = args[2]
+			fmt.Fprint(w, "+OK\r\n")
+		case args[0] == "GET":
+			if value, found := data[args[1]]; found {
+				fmt.Fprintf(w, "$%d\r\n%s\r\n", len(value), value)
+			} else {
+				fmt.Fprint(w, "$-1\r\n")
+			}
+		case args[0] == "DEL":
+			delete(data, args[1])
+			fmt.Fprint(w, ":1\r\n")
+		default:
+			fmt.Fprintf(w, "-ERR unexpected command %v\r\n", args)
+		}
+	}
+}
+
+// serveMemcached answers the commands of one connection.
+func serveMemcached(r *bufio.Reader, w io.Writer, data map[string]string) {
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		switch {
+		case fields[0] == "set" && len(fields) == 5 && fields[3] == "3600":
+			value, _ := readLine(r)
+			data[fields[1]] = value
+			fmt.Fprint(w, "STORED\r\n")
+		case fields[0] == "get":
+			if value, found := data[fields[1]]; found {
+				fmt.Fprintf(w, "VALUE %s 0 %d\r\n%s\r\n", fields[1], len(value), value)
+			}
+			fmt.Fprint(w, "END\r\n")
+		case fields[0] == "delete":
+			delete(data, fields[1])
+			fmt.Fprint(w, "DELETED\r\n")
+		default:
+			fmt.Fprint(w, "ERROR\r\n")
+		}
+	}
+}
@@ -19,6 +19,8 @@ package acme
 import (
 	"context"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -86,7 +88,17 @@ type ClientResolver interface {
 
 // Client ...
 type Client interface {
-	Sign(dnsnames []string) (crt, key []byte, err error)
+	Sign(dnsnames []string, options SignOptions) (crt, key []byte, err error)
+}
+
+// SignOptions ...
+type SignOptions struct {
+	// KeyType is the algorithm and size of the private key, one of rsa2048,
+	// rsa4096, ecdsa256 or ecdsa384. Defaults to rsa2048.
+	KeyType string
+	// PreferredChain is the common name of the issuer of the topmost
+	// certificate of the chain, used if the CA offers alternate chains.
+	PreferredChain string
 }
 
 type client struct {
@@ -128,7 +140,7 @@ func (c *client) ensureAccount() error {
 	return nil
 }
 
-func (c *client) Sign(dnsnames []string) (crt, key []byte, err error) {
+func (c *client) Sign(dnsnames []string, options SignOptions) (crt, key []byte, err error) {
 	if len(dnsnames) == 0 {
 		return crt, key, fmt.Errorf("dnsnames is empty")
 	}
@@ -142,7 +154,7 @@ func (c *client) Sign(dnsnames []string) (crt, key []byte, err error) {
 	csrTemplate := &x509.CertificateRequest{}
 	csrTemplate.Subject.CommonName = dnsnames[0]
 	csrTemplate.DNSNames = dnsnames
-	return c.signRequest(order, csrTemplate)
+	return c.signRequest(order, csrTemplate, options)
 }
 
 func (c *client) authorize(dnsnames []string, order *acme.Order) error {
@@ -180,8 +192,8 @@ func (c *client) authorize(dnsnames []string, order *acme.Order) error {
 	return nil
 }
 
-func (c *client) signRequest(order *acme.Order, csrTemplate *x509.CertificateRequest) (crt, key []byte, err error) {
-	keys, err := rsa.GenerateKey(rand.Reader, 2048)
+func (c *client) signRequest(order *acme.Order, csrTemplate *x509.CertificateRequest, options SignOptions) (crt, key []byte, err error) {
+	keys, err := generateKey(options.KeyType)
 	if err != nil {
 		return crt, key, err
 	}
@@ -189,14 +201,35 @@ func (c *client) signRequest(order *acme.Order, csrTemplate *x509.CertificateReq
 	if err != nil {
 		return crt, key, err
 	}
-	rawCerts, err := c.client.FinalizeOrder(c.ctx, order.FinalizeURL, csr)
+	var rawCerts [][]byte
+	if options.PreferredChain == "" {
+		rawCerts, err = c.client.FinalizeOrder(c.ctx, order.FinalizeURL, csr)
+	} else {
+		var chains [][][]byte
+		chains, err = c.client.FinalizeOrderChains(c.ctx, order.FinalizeURL, csr)
+		if err == nil {
+			rawCerts = c.preferredChain(chains, options.PreferredChain)
+		}
+	}
 	if err != nil {
 		return crt, key, err
 	}
-	key = pem.EncodeToMemory(&pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(keys),
-	})
+	switch k := keys.(type) {
+	case *rsa.PrivateKey:
+		key = pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(k),
+		})
+	case *ecdsa.PrivateKey:
+		der, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return crt, key, err
+		}
+		key = pem.EncodeToMemory(&pem.Block{
+			Type:  "EC PRIVATE KEY",
+			Bytes: der,
+		})
+	}
 	for _, rawCert := range rawCerts {
 		crt = append(crt, pem.EncodeToMemory(&pem.Block{
 			Type:  "CERTIFICATE",
@@ -205,3 +238,54 @@ func (c *client) signRequest(order *acme.Order, csrTemplate *x509.CertificateReq
 	}
 	return crt, key, nil
 }
+
+// preferredChain returns the first chain whose topmost certificate was issued
+// by preferred, or the default chain if no one matches.
+func (c *client) preferredChain(chains [][][]byte, preferred string) [][]byte {
+	for _, chain := range chains {
+		if len(chain) == 0 {
+			continue
+		}
+		top, err := x509.ParseCertificate(chain[len(chain)-1])
+		if err != nil {
+			c.logger.Warn("acme: error parsing certificate chain: %v", err)
+			continue
+		}
+		if top.Issuer.CommonName == preferred {
+			return chain
+		}
+	}
+	c.logger.InfoV(2, "acme: preferred chain '%s' not found, using the default chain", preferred)
+	return chains[0]
+}
+
+func generateKey(keyType string) (crypto.Signer, error) {
+	switch keyType {
+	case "", "rsa2048":
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case "rsa4096":
+		return rsa.GenerateKey(rand.Reader, 4096)
+	case "ecdsa256":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "ecdsa384":
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	}
+	return nil, fmt.Errorf("unsupported key type: %s", keyType)
+}
+
+// matchKeyType returns true if the public key of crt is of the keyType
+// algorithm and size. Any key matches if keyType isn't declared.
+func matchKeyType(keyType string, crt *x509.Certificate) bool {
+	if keyType == "" {
+		return true
+	}
+	switch pub := crt.PublicKey.(type) {
+	case *rsa.PublicKey:
+		size := pub.N.BitLen()
+		return (keyType == "rsa2048" && size == 2048) || (keyType == "rsa4096" && size == 4096)
+	case *ecdsa.PublicKey:
+		size := pub.Curve.Params().BitSize
+		return (keyType == "ecdsa256" && size == 256) || (keyType == "ecdsa384" && size == 384)
+	}
+	return false
+}
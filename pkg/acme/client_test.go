@@ -18,10 +18,16 @@ package acme
 
 import (
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/base64"
 	"fmt"
 	"io/ioutil"
+	"math/big"
+	"reflect"
 	"testing"
 	"time"
 
@@ -58,7 +64,7 @@ func TestSign(t *testing.T) {
 	}
 	// TODO test resulting crt
 	// TODO debug/fine logging in the Sign() steps
-	_, _, err = client.Sign([]string{domain})
+	_, _, err = client.Sign([]string{domain}, SignOptions{})
 	if err != nil {
 		t.Errorf("error signing certificate: %v", err)
 	}
@@ -67,6 +73,59 @@ func TestSign(t *testing.T) {
 	c.logger.CompareLogging("INFO acme: client account successfully retrieved")
 }
 
+func TestPreferredChain(t *testing.T) {
+	newCert := func(issuer string) []byte {
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: issuer},
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		crt, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		if err != nil {
+			t.Fatalf("error creating certificate: %v", err)
+		}
+		return crt
+	}
+	leaf := newCert("leaf")
+	rootX1 := newCert("ISRG Root X1")
+	rootX2 := newCert("ISRG Root X2")
+	chains := [][][]byte{{leaf, rootX1}, {leaf, rootX2}}
+	testCases := []struct {
+		preferred string
+		expected  [][]byte
+		logging   string
+	}{
+		// 0
+		{
+			preferred: "ISRG Root X1",
+			expected:  chains[0],
+		},
+		// 1
+		{
+			preferred: "ISRG Root X2",
+			expected:  chains[1],
+		},
+		// 2
+		{
+			preferred: "DST Root CA X3",
+			expected:  chains[0],
+			logging:   `INFO-V(2) acme: preferred chain 'DST Root CA X3' not found, using the default chain`,
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		client := &client{logger: c.logger}
+		chain := client.preferredChain(chains, test.preferred)
+		if !reflect.DeepEqual(chain, test.expected) {
+			t.Errorf("chain differs on %d", i)
+		}
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
 type clientResolver struct {
 	logger *types_helper.LoggerMock
 }
@@ -0,0 +1,328 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package acme
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/acme/x/acme"
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/types"
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/utils"
+)
+
+// QueueResolver ...
+type QueueResolver interface {
+	GetOrderState(secretName string) string
+	SetOrderState(secretName, state string) error
+}
+
+// QueueOptions ...
+type QueueOptions struct {
+	FailInitialWait time.Duration
+	FailMaxWait     time.Duration
+	MaxConcurrent   int
+}
+
+// NewQueue creates the work queue of the acme orders. Failing orders are
+// retried using an exponential backoff, or after the time asked by the acme
+// server on rate limit errors, whatever is longer. The backoff state of the
+// failing orders is persisted, so a restart or a new leader doesn't reset it.
+// At most MaxConcurrent orders are processed at the same time.
+func NewQueue(logger types.Logger, resolver QueueResolver, metrics types.Metrics, options QueueOptions, sync func(item interface{}) error) utils.Queue {
+	if options.MaxConcurrent < 1 {
+		options.MaxConcurrent = 1
+	}
+	return &queue{
+		logger:   logger,
+		resolver: resolver,
+		metrics:  metrics,
+		options:  options,
+		sync:     sync,
+		orders:   map[string]*order{},
+		wakeup:   make(chan struct{}, 1),
+		shutdown: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+type queue struct {
+	logger   types.Logger
+	resolver QueueResolver
+	metrics  types.Metrics
+	options  QueueOptions
+	sync     func(item interface{}) error
+	mutex    sync.Mutex
+	orders   map[string]*order
+	running  int
+	started  bool
+	stopping bool
+	wakeup   chan struct{}
+	shutdown chan struct{}
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+type order struct {
+	item    string
+	secret  string
+	state   orderState
+	running bool
+	removed bool
+}
+
+// orderState is the persisted state of a failing order
+type orderState struct {
+	Failures int       `json:"failures"`
+	RetryAt  time.Time `json:"retryAt"`
+	Error    string    `json:"error"`
+}
+
+func (q *queue) Add(item interface{}) {
+	storage := item.(string)
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if o, found := q.orders[storage]; found {
+		// already waiting or running, an order is never processed twice
+		o.removed = false
+		return
+	}
+	o := &order{
+		item:   storage,
+		secret: storage[:strings.IndexAny(storage+",", ",;")],
+	}
+	// restores the backoff of an order that failed before a restart or
+	// before the leader has changed
+	if state := q.resolver.GetOrderState(o.secret); state != "" {
+		if err := json.Unmarshal([]byte(state), &o.state); err != nil {
+			q.logger.Warn("acme: ignoring invalid order state of secret=%s: %v", o.secret, err)
+			o.state = orderState{}
+		}
+	}
+	q.orders[storage] = o
+	q.updateMetrics()
+	q.notify()
+}
+
+func (q *queue) Remove(item interface{}) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.remove(item.(string))
+	q.updateMetrics()
+}
+
+func (q *queue) remove(storage string) {
+	if o, found := q.orders[storage]; found {
+		if o.running {
+			// removed when the order finishes
+			o.removed = true
+		} else {
+			delete(q.orders, storage)
+		}
+	}
+}
+
+func (q *queue) Clear() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for storage := range q.orders {
+		q.remove(storage)
+	}
+	q.updateMetrics()
+}
+
+func (q *queue) Notify() {
+	q.notify()
+}
+
+func (q *queue) notify() {
+	select {
+	case q.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (q *queue) Run() {
+	q.mutex.Lock()
+	if q.started || q.stopping {
+		q.mutex.Unlock()
+		return
+	}
+	q.started = true
+	q.mutex.Unlock()
+	defer close(q.done)
+	for {
+		next := q.dispatch()
+		var retry <-chan time.Time
+		var timer *time.Timer
+		if !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			retry = timer.C
+		}
+		select {
+		case <-q.wakeup:
+		case <-retry:
+		case <-q.shutdown:
+			if timer != nil {
+				timer.Stop()
+			}
+			q.wg.Wait()
+			return
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// dispatch starts the orders that are ready to run, limited by the max
+// number of concurrent orders, and returns when the next waiting order
+// should be started, or zero if there isn't waiting orders.
+func (q *queue) dispatch() (next time.Time) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	storages := make([]string, 0, len(q.orders))
+	for storage := range q.orders {
+		storages = append(storages, storage)
+	}
+	sort.Strings(storages)
+	now := time.Now()
+	for _, storage := range storages {
+		o := q.orders[storage]
+		if o.running {
+			continue
+		}
+		if o.state.RetryAt.After(now) {
+			if next.IsZero() || o.state.RetryAt.Before(next) {
+				next = o.state.RetryAt
+			}
+			continue
+		}
+		if q.running >= q.options.MaxConcurrent {
+			// a running order calls notify() when it finishes
+			continue
+		}
+		o.running = true
+		q.running++
+		q.wg.Add(1)
+		go q.process(o)
+	}
+	return next
+}
+
+func (q *queue) process(o *order) {
+	defer q.wg.Done()
+	err := q.sync(o.item)
+	q.mutex.Lock()
+	o.running = false
+	q.running--
+	// only failing orders have their state persisted
+	persist := err != nil || o.state.Failures > 0
+	var state string
+	if err == nil {
+		// succeeded, the order is only processed again if added again
+		delete(q.orders, o.item)
+	} else {
+		reason := "error"
+		delay := q.backoff(o.state.Failures)
+		if retryAt, limited := rateLimit(err); limited {
+			reason = "rate_limited"
+			if wait := time.Until(retryAt); wait > delay {
+				delay = wait
+			}
+		}
+		o.state.Failures++
+		o.state.RetryAt = time.Now().Add(delay).Truncate(time.Second)
+		o.state.Error = err.Error()
+		out, _ := json.Marshal(o.state)
+		state = string(out)
+		q.metrics.IncAcmeOrderFailure(reason)
+		q.logger.InfoV(2, "acme: order of secret=%s failed %d time(s), retrying in %s",
+			o.secret, o.state.Failures, delay.Round(time.Second))
+		if o.removed {
+			delete(q.orders, o.item)
+		}
+	}
+	q.updateMetrics()
+	q.mutex.Unlock()
+	q.notify()
+
+	// the API is called without the lock, an empty state removes it
+	if persist {
+		if errState := q.resolver.SetOrderState(o.secret, state); errState != nil {
+			q.logger.Warn("acme: error storing order state of secret=%s: %v", o.secret, errState)
+		}
+	}
+}
+
+// backoff returns the time to wait before retrying an order that had
+// already failed the number of times in failures.
+func (q *queue) backoff(failures int) time.Duration {
+	delay := q.options.FailInitialWait
+	for i := 0; i < failures && delay < q.options.FailMaxWait; i++ {
+		delay *= 2
+	}
+	if delay > q.options.FailMaxWait {
+		delay = q.options.FailMaxWait
+	}
+	return delay
+}
+
+func rateLimit(err error) (retryAt time.Time, limited bool) {
+	var acmeErr *acme.Error
+	if errors.As(err, &acmeErr) {
+		return acme.RateLimit(acmeErr)
+	}
+	return retryAt, false
+}
+
+func (q *queue) updateMetrics() {
+	var pending, failing int
+	for _, o := range q.orders {
+		if o.state.Failures > 0 {
+			failing++
+		} else {
+			pending++
+		}
+	}
+	q.metrics.SetAcmeOrders(pending, failing)
+}
+
+func (q *queue) ShuttingDown() bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.stopping
+}
+
+func (q *queue) ShutDown() {
+	q.mutex.Lock()
+	if q.stopping {
+		q.mutex.Unlock()
+		return
+	}
+	q.stopping = true
+	started := q.started
+	q.mutex.Unlock()
+	close(q.shutdown)
+	if started {
+		<-q.done
+	}
+}
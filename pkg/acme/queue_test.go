@@ -0,0 +1,211 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package acme
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/acme/x/acme"
+)
+
+func TestQueueBackoff(t *testing.T) {
+	q := &queue{options: QueueOptions{FailInitialWait: time.Minute, FailMaxWait: 8 * time.Minute}}
+	testCases := []struct {
+		failures int
+		expected time.Duration
+	}{
+		// 0
+		{failures: 0, expected: time.Minute},
+		// 1
+		{failures: 1, expected: 2 * time.Minute},
+		// 2
+		{failures: 3, expected: 8 * time.Minute},
+		// 3
+		{failures: 50, expected: 8 * time.Minute},
+	}
+	for i, test := range testCases {
+		if delay := q.backoff(test.failures); delay != test.expected {
+			t.Errorf("backoff differs on %d: expected %s but was %s", i, test.expected, delay)
+		}
+	}
+}
+
+func TestQueueOrderFailure(t *testing.T) {
+	rateLimited := &acme.Error{
+		Type:   "urn:ietf:params:acme:error:rateLimited",
+		Header: http.Header{"Retry-After": []string{"3600"}},
+	}
+	testCases := []struct {
+		failures    int
+		err         error
+		expFailures int
+		expRetryIn  time.Duration
+		expStored   bool
+		logging     string
+	}{
+		// 0
+		{
+			err:         fmt.Errorf("connection refused"),
+			expFailures: 1,
+			expRetryIn:  time.Minute,
+			expStored:   true,
+			logging:     `INFO-V(2) acme: order of secret=default/s1 failed 1 time(s), retrying in 1m0s`,
+		},
+		// 1
+		{
+			failures:    2,
+			err:         fmt.Errorf("connection refused"),
+			expFailures: 3,
+			expRetryIn:  4 * time.Minute,
+			expStored:   true,
+			logging:     `INFO-V(2) acme: order of secret=default/s1 failed 3 time(s), retrying in 4m0s`,
+		},
+		// 2
+		{
+			err:         fmt.Errorf("acme: error signing: %w", rateLimited),
+			expFailures: 1,
+			expRetryIn:  time.Hour,
+			expStored:   true,
+			logging:     `INFO-V(2) acme: order of secret=default/s1 failed 1 time(s), retrying in 1h0m0s`,
+		},
+		// 3
+		{
+			failures:  2,
+			expStored: true,
+		},
+		// 4
+		{
+			expStored: false,
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		resolver := &queueResolver{states: map[string]string{}}
+		if test.failures > 0 {
+			state, _ := json.Marshal(orderState{Failures: test.failures})
+			resolver.states["default/s1"] = string(state)
+		}
+		q := NewQueue(c.logger, resolver, c.metrics, QueueOptions{
+			FailInitialWait: time.Minute,
+			FailMaxWait:     time.Hour,
+		}, func(item interface{}) error {
+			return test.err
+		}).(*queue)
+		q.Add("default/s1,d1.local")
+		o := q.orders["default/s1,d1.local"]
+		o.running = true
+		q.running++
+		q.wg.Add(1)
+		q.process(o)
+		if stored := resolver.stored > 0; stored != test.expStored {
+			t.Errorf("%d: expected stored state %v but was %v", i, test.expStored, stored)
+		}
+		state := resolver.states["default/s1"]
+		if test.err == nil {
+			if _, found := q.orders["default/s1,d1.local"]; found || state != "" {
+				t.Errorf("%d: expected order and its state removed, but was found '%s'", i, state)
+			}
+		} else {
+			var stored orderState
+			_ = json.Unmarshal([]byte(state), &stored)
+			retryAt := time.Now().Add(test.expRetryIn)
+			if stored.Failures != test.expFailures || stored.RetryAt.Before(retryAt.Add(-2*time.Second)) || stored.RetryAt.After(retryAt) {
+				t.Errorf("%d: expected %d failures, retrying at %v, but was %+v", i, test.expFailures, retryAt, stored)
+			}
+			if o.state.Failures != stored.Failures || !o.state.RetryAt.Equal(stored.RetryAt) || o.state.Error != stored.Error {
+				t.Errorf("%d: expected order state %+v but was %+v", i, stored, o.state)
+			}
+		}
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestQueueRun(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+	var mutex sync.Mutex
+	var running, maxRunning int
+	attempts := map[string]int{}
+	q := NewQueue(c.logger, &queueResolver{states: map[string]string{}}, c.metrics, QueueOptions{
+		FailInitialWait: 50 * time.Millisecond,
+		FailMaxWait:     time.Second,
+		MaxConcurrent:   2,
+	}, func(item interface{}) error {
+		mutex.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		attempts[item.(string)]++
+		failed := item.(string) == "s1,d1.local" && attempts[item.(string)] == 1
+		mutex.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+		if failed {
+			return fmt.Errorf("connection refused")
+		}
+		return nil
+	})
+	go q.Run()
+	for _, item := range []string{"s1,d1.local", "s2,d2.local", "s3,d3.local", "s4,d4.local"} {
+		q.Add(item)
+	}
+	time.Sleep(300 * time.Millisecond)
+	q.ShutDown()
+	expected := map[string]int{"s1,d1.local": 2, "s2,d2.local": 1, "s3,d3.local": 1, "s4,d4.local": 1}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if fmt.Sprint(attempts) != fmt.Sprint(expected) {
+		t.Errorf("expected attempts %v but was %v", expected, attempts)
+	}
+	if maxRunning != 2 {
+		t.Errorf("expected 2 concurrent orders but was %d", maxRunning)
+	}
+	c.logger.CompareLogging(`INFO-V(2) acme: order of secret=s1 failed 1 time(s), retrying in 0s`)
+}
+
+type queueResolver struct {
+	mutex  sync.Mutex
+	states map[string]string
+	stored int
+}
+
+func (r *queueResolver) GetOrderState(secretName string) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.states[secretName]
+}
+
+func (r *queueResolver) SetOrderState(secretName, state string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.stored++
+	if state == "" {
+		delete(r.states, secretName)
+	} else {
+		r.states[secretName] = state
+	}
+	return nil
+}
@@ -19,22 +19,31 @@ package acme
 import (
 	"crypto/x509"
 	"fmt"
+	"net"
 	"reflect"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/types"
 )
 
 // NewSigner ...
-func NewSigner(logger types.Logger, cache Cache, metrics types.Metrics) Signer {
+func NewSigner(logger types.Logger, cache Cache, metrics types.Metrics, options SignerOptions) Signer {
 	return &signer{
-		logger:  logger,
-		cache:   cache,
-		metrics: metrics,
+		logger:     logger,
+		cache:      cache,
+		metrics:    metrics,
+		options:    options,
+		lookupHost: net.LookupHost,
 	}
 }
 
+// SignerOptions ...
+type SignerOptions struct {
+	DNSPrecheck bool
+}
+
 // Signer ...
 type Signer interface {
 	AcmeAccount(endpoint, emails string, termsAgreed bool)
@@ -54,6 +63,8 @@ type Cache interface {
 type SignerResolver interface {
 	GetTLSSecretContent(secretName string) (*TLSSecret, error)
 	SetTLSSecretContent(secretName string, pemCrt, pemKey []byte) error
+	GetPublishedAddresses() ([]string, error)
+	RecordSignerWarning(reason, message string)
 }
 
 // TLSSecret ...
@@ -65,10 +76,12 @@ type signer struct {
 	logger      types.Logger
 	cache       Cache
 	metrics     types.Metrics
+	options     SignerOptions
+	lookupHost  func(host string) ([]string, error)
 	account     Account
 	client      Client
 	expiring    time.Duration
-	verifyCount int
+	verifyCount int32
 }
 
 func (s *signer) AcmeAccount(endpoint, emails string, termsAgreed bool) {
@@ -112,18 +125,31 @@ func (s *signer) Notify(item interface{}) error {
 	if !s.HasAccount() {
 		return fmt.Errorf("acme: account was not properly initialized")
 	}
-	cert := strings.Split(item.(string), ",")
+	// item is `<secret>,<domain>[,<domain>...][;<option>=<value>...]`
+	options := strings.Split(item.(string), ";")
+	cert := strings.Split(options[0], ",")
 	secretName := cert[0]
 	domains := cert[1:]
-	err := s.verify(secretName, domains)
+	var signOptions SignOptions
+	for _, opt := range options[1:] {
+		if i := strings.Index(opt, "="); i >= 0 {
+			switch opt[:i] {
+			case "key-type":
+				signOptions.KeyType = opt[i+1:]
+			case "preferred-chain":
+				signOptions.PreferredChain = opt[i+1:]
+			}
+		}
+	}
+	err := s.verify(secretName, domains, signOptions)
 	return err
 }
 
-func (s *signer) verify(secretName string, domains []string) (verifyErr error) {
+func (s *signer) verify(secretName string, domains []string, options SignOptions) (verifyErr error) {
 	duedate := time.Now().Add(s.expiring)
 	tls, errSecret := s.cache.GetTLSSecretContent(secretName)
 	strdomains := strings.Join(domains, ",")
-	if errSecret != nil || tls.Crt.NotAfter.Before(duedate) || !match(domains, tls.Crt) {
+	if errSecret != nil || tls.Crt.NotAfter.Before(duedate) || !match(domains, tls.Crt) || !matchKeyType(options.KeyType, tls.Crt) {
 		var collector func(domains string, success bool)
 		var reason string
 		if errSecret != nil {
@@ -132,26 +158,38 @@ func (s *signer) verify(secretName string, domains []string) (verifyErr error) {
 		} else if tls.Crt.NotAfter.Before(duedate) {
 			collector = s.metrics.IncCertSigningExpiring
 			reason = fmt.Sprintf("certificate expires in %s", tls.Crt.NotAfter.String())
-		} else {
+		} else if !match(domains, tls.Crt) {
 			collector = s.metrics.IncCertSigningOutdated
 			reason = "added one or more domains to an existing certificate"
+		} else {
+			collector = s.metrics.IncCertSigningOutdated
+			reason = fmt.Sprintf("certificate key type differs from %s", options.KeyType)
+		}
+		if s.options.DNSPrecheck {
+			if errDNS := s.checkDNS(domains); errDNS != nil {
+				msg := fmt.Sprintf("skipping order of secret=%s domain(s)=%s: %v", secretName, strdomains, errDNS)
+				s.logger.Warn("acme: %s", msg)
+				s.cache.RecordSignerWarning("AcmeOrderSkipped", msg)
+				return fmt.Errorf("acme: %s", msg)
+			}
 		}
-		s.verifyCount++
+		// orders can run concurrently, see QueueOptions.MaxConcurrent
+		id := atomic.AddInt32(&s.verifyCount, 1)
 		s.logger.Info("acme: authorizing: id=%d secret=%s domain(s)=%s endpoint=%s reason='%s'",
-			s.verifyCount, secretName, strdomains, s.account.Endpoint, reason)
-		crt, key, err := s.client.Sign(domains)
+			id, secretName, strdomains, s.account.Endpoint, reason)
+		crt, key, err := s.client.Sign(domains, options)
 		if err == nil {
 			if errTLS := s.cache.SetTLSSecretContent(secretName, crt, key); errTLS == nil {
 				s.logger.Info("acme: new certificate issued: id=%d secret=%s domain(s)=%s",
-					s.verifyCount, secretName, strdomains)
+					id, secretName, strdomains)
 			} else {
 				s.logger.Warn("acme: error storing new certificate: id=%d secret=%s domain(s)=%s error=%v",
-					s.verifyCount, secretName, strdomains, errTLS)
+					id, secretName, strdomains, errTLS)
 				verifyErr = errTLS
 			}
 		} else {
 			s.logger.Warn("acme: error signing new certificate: id=%d secret=%s domain(s)=%s error=%v",
-				s.verifyCount, secretName, strdomains, err)
+				id, secretName, strdomains, err)
 			verifyErr = err
 		}
 		collector(strdomains, verifyErr == nil)
@@ -161,6 +199,57 @@ func (s *signer) verify(secretName string, domains []string) (verifyErr error) {
 	return verifyErr
 }
 
+// checkDNS returns an error if any of the domains doesn't resolve to one of
+// the addresses published by the controller, so the HTTP-01 challenge would
+// fail. Published hostnames, eg of a cloud load balancer, are also resolved.
+func (s *signer) checkDNS(domains []string) error {
+	published, err := s.cache.GetPublishedAddresses()
+	if err != nil {
+		return fmt.Errorf("error reading published addresses: %w", err)
+	}
+	if len(published) == 0 {
+		// nothing to compare with, eg ingress status update is disabled
+		return nil
+	}
+	publishedIPs := map[string]bool{}
+	for _, addr := range published {
+		if ip := net.ParseIP(addr); ip != nil {
+			publishedIPs[ip.String()] = true
+			continue
+		}
+		ips, err := s.lookupHost(addr)
+		if err != nil {
+			s.logger.Warn("acme: error resolving published address %s: %v", addr, err)
+			continue
+		}
+		for _, ip := range ips {
+			publishedIPs[ip] = true
+		}
+	}
+	for _, domain := range domains {
+		if strings.HasPrefix(domain, "*.") {
+			// wildcard domains cannot be resolved, they don't use HTTP-01 as well
+			continue
+		}
+		ips, err := s.lookupHost(domain)
+		if err != nil {
+			return fmt.Errorf("error resolving domain %s: %w", domain, err)
+		}
+		found := false
+		for _, ip := range ips {
+			if publishedIPs[ip] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("domain %s resolves to %s, which isn't any of the published addresses %s",
+				domain, strings.Join(ips, ","), strings.Join(published, ","))
+		}
+	}
+	return nil
+}
+
 // match return true if all hosts in hostnames (desired configuration)
 // are already in dnsnames (current certificate).
 func match(domains []string, crt *x509.Certificate) bool {
@@ -21,6 +21,7 @@ import (
 	"crypto/x509"
 	"encoding/base64"
 	"fmt"
+	"reflect"
 	"testing"
 	"time"
 
@@ -71,6 +72,23 @@ INFO acme: new certificate issued: id=1 secret=s1 domain(s)=d3.local`,
 			logging: `
 INFO acme: authorizing: id=1 secret=s2 domain(s)=d1.local endpoint=https://acme-v2.local reason='certificate does not exist (secret not found: s2)'
 INFO acme: new certificate issued: id=1 secret=s2 domain(s)=d1.local`,
+		},
+		// 4
+		{
+			input:     "s1,d1.local;key-type=rsa2048;preferred-chain=ISRG Root X1",
+			expiresIn: 10 * 24 * time.Hour,
+			cert:      dumbcrt,
+			logging: `
+INFO-V(2) acme: skipping sign, certificate is updated: secret=s1 domain(s)=d1.local`,
+		},
+		// 5
+		{
+			input:     "s1,d1.local;key-type=ecdsa256",
+			expiresIn: 10 * 24 * time.Hour,
+			cert:      dumbcrt,
+			logging: `
+INFO acme: authorizing: id=1 secret=s1 domain(s)=d1.local endpoint=https://acme-v2.local reason='certificate key type differs from ecdsa256'
+INFO acme: new certificate issued: id=1 secret=s1 domain(s)=d1.local`,
 		},
 		{
 			input:     "s1,s3.dev.local",
@@ -102,6 +120,88 @@ INFO acme: new certificate issued: id=1 secret=s1 domain(s)=other.s3.dev.local`,
 	}
 }
 
+func TestNotifyDNSPrecheck(t *testing.T) {
+	testCases := []struct {
+		input     string
+		published []string
+		expErr    bool
+		warnings  []string
+		logging   string
+	}{
+		// 0
+		{
+			input:     "s2,d1.local",
+			published: []string{"10.0.0.1"},
+			logging: `
+INFO acme: authorizing: id=1 secret=s2 domain(s)=d1.local endpoint=https://acme-v2.local reason='certificate does not exist (secret not found: s2)'
+INFO acme: new certificate issued: id=1 secret=s2 domain(s)=d1.local`,
+		},
+		// 1
+		{
+			input:     "s2,d1.local,*.d1.local",
+			published: []string{"10.0.0.2", "lb.cloud.local"},
+			logging: `
+INFO acme: authorizing: id=1 secret=s2 domain(s)=d1.local,*.d1.local endpoint=https://acme-v2.local reason='certificate does not exist (secret not found: s2)'
+INFO acme: new certificate issued: id=1 secret=s2 domain(s)=d1.local,*.d1.local`,
+		},
+		// 2
+		{
+			input:     "s2,d1.local",
+			published: nil,
+			logging: `
+INFO acme: authorizing: id=1 secret=s2 domain(s)=d1.local endpoint=https://acme-v2.local reason='certificate does not exist (secret not found: s2)'
+INFO acme: new certificate issued: id=1 secret=s2 domain(s)=d1.local`,
+		},
+		// 3
+		{
+			input:     "s2,d1.local,d2.local",
+			published: []string{"10.0.0.1"},
+			expErr:    true,
+			warnings:  []string{"AcmeOrderSkipped: skipping order of secret=s2 domain(s)=d1.local,d2.local: domain d2.local resolves to 10.0.0.3, which isn't any of the published addresses 10.0.0.1"},
+			logging: `
+WARN acme: skipping order of secret=s2 domain(s)=d1.local,d2.local: domain d2.local resolves to 10.0.0.3, which isn't any of the published addresses 10.0.0.1`,
+		},
+		// 4
+		{
+			input:     "s2,d3.local",
+			published: []string{"10.0.0.1", "missing.local"},
+			expErr:    true,
+			warnings:  []string{"AcmeOrderSkipped: skipping order of secret=s2 domain(s)=d3.local: error resolving domain d3.local: no such host"},
+			logging: `
+WARN acme: error resolving published address missing.local: no such host
+WARN acme: skipping order of secret=s2 domain(s)=d3.local: error resolving domain d3.local: no such host`,
+		},
+	}
+	hosts := map[string][]string{
+		"d1.local":       {"10.0.0.1", "10.0.0.2"},
+		"d2.local":       {"10.0.0.3"},
+		"lb.cloud.local": {"10.0.0.1"},
+	}
+	c := setup(t)
+	defer c.teardown()
+	for i, test := range testCases {
+		c.cache.published = test.published
+		c.cache.warnings = nil
+		signer := c.newSigner()
+		signer.options.DNSPrecheck = true
+		signer.lookupHost = func(host string) ([]string, error) {
+			if ips, found := hosts[host]; found {
+				return ips, nil
+			}
+			return nil, fmt.Errorf("no such host")
+		}
+		signer.account.Endpoint = "https://acme-v2.local"
+		err := signer.Notify(test.input)
+		if (err != nil) != test.expErr {
+			t.Errorf("%d: expected error %v but was %v", i, test.expErr, err)
+		}
+		if !reflect.DeepEqual(c.cache.warnings, test.warnings) {
+			t.Errorf("%d: expected warnings %v but was %v", i, test.warnings, c.cache.warnings)
+		}
+		c.logger.CompareLogging(test.logging)
+	}
+}
+
 func setup(t *testing.T) *config {
 	return &config{
 		t: t,
@@ -125,19 +225,21 @@ func (c *config) teardown() {
 }
 
 func (c *config) newSigner() *signer {
-	signer := NewSigner(c.logger, c.cache, c.metrics).(*signer)
+	signer := NewSigner(c.logger, c.cache, c.metrics, SignerOptions{}).(*signer)
 	signer.client = &clientMock{}
 	return signer
 }
 
 type clientMock struct{}
 
-func (c *clientMock) Sign(domains []string) (crt, key []byte, err error) {
+func (c *clientMock) Sign(domains []string, options SignOptions) (crt, key []byte, err error) {
 	return nil, nil, nil
 }
 
 type cache struct {
 	tlsSecret map[string]*TLSSecret
+	published []string
+	warnings  []string
 }
 
 func (c *cache) GetKey() (crypto.Signer, error) {
@@ -163,3 +265,11 @@ func (c *cache) GetTLSSecretContent(secretName string) (*TLSSecret, error) {
 func (c *cache) SetTLSSecretContent(secretName string, pemCrt, pemKey []byte) error {
 	return nil
 }
+
+func (c *cache) GetPublishedAddresses() ([]string, error) {
+	return c.published, nil
+}
+
+func (c *cache) RecordSignerWarning(reason, message string) {
+	c.warnings = append(c.warnings, reason+": "+message)
+}
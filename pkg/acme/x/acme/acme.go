@@ -32,6 +32,7 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -213,6 +214,39 @@ func (c *Client) CreateOrder(ctx context.Context, order *Order) (*Order, error)
 // Callers are encouraged to parse the returned certificate chain to ensure it
 // is valid and has the expected attributes.
 func (c *Client) FinalizeOrder(ctx context.Context, finalizeURL string, csr []byte) (der [][]byte, err error) {
+	o, err := c.finalizeOrder(ctx, finalizeURL, csr)
+	if err != nil {
+		return nil, err
+	}
+	der, _, err = c.getCert(ctx, o.CertificateURL)
+	return der, err
+}
+
+// FinalizeOrderChains finalizes an order like FinalizeOrder, but returns all
+// the certificate chains offered by the CA: the default one first, followed
+// by the alternate chains found in the Link headers of the certificate
+// response, see RFC 8555 section 7.4.2.
+func (c *Client) FinalizeOrderChains(ctx context.Context, finalizeURL string, csr []byte) (chains [][][]byte, err error) {
+	o, err := c.finalizeOrder(ctx, finalizeURL, csr)
+	if err != nil {
+		return nil, err
+	}
+	der, alternates, err := c.getCert(ctx, o.CertificateURL)
+	if err != nil {
+		return nil, err
+	}
+	chains = append(chains, der)
+	for _, alternate := range alternates {
+		der, _, err := c.getCert(ctx, alternate)
+		if err != nil {
+			return nil, err
+		}
+		chains = append(chains, der)
+	}
+	return chains, nil
+}
+
+func (c *Client) finalizeOrder(ctx context.Context, finalizeURL string, csr []byte) (*Order, error) {
 	if _, err := c.Discover(ctx); err != nil {
 		return nil, err
 	}
@@ -249,8 +283,7 @@ func (c *Client) FinalizeOrder(ctx context.Context, finalizeURL string, csr []by
 	if o.Status != StatusValid {
 		return nil, fmt.Errorf("acme: unexpected order status %q", o.Status)
 	}
-
-	return c.getCert(ctx, o.CertificateURL)
+	return o, nil
 }
 
 // GetOrder retrieves an order identified by url.
@@ -821,38 +854,76 @@ func nonceFromHeader(h http.Header) string {
 	return h.Get("Replay-Nonce")
 }
 
-func (c *Client) getCert(ctx context.Context, url string) ([][]byte, error) {
+// getCert fetches the certificate chain from url, and also returns the urls
+// of the alternate chains offered by the CA.
+func (c *Client) getCert(ctx context.Context, url string) (chain [][]byte, alternates []string, err error) {
 	res, err := c.postWithJWSAccount(ctx, url, nil)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer res.Body.Close()
 	data, err := ioutil.ReadAll(io.LimitReader(res.Body, maxChainSize+1))
 	if err != nil {
-		return nil, fmt.Errorf("acme: error getting certificate: %v", err)
+		return nil, nil, fmt.Errorf("acme: error getting certificate: %v", err)
 	}
 	if len(data) > maxChainSize {
-		return nil, errors.New("acme: certificate chain is too big")
+		return nil, nil, errors.New("acme: certificate chain is too big")
 	}
-	var chain [][]byte
 	for {
 		var p *pem.Block
 		p, data = pem.Decode(data)
 		if p == nil {
 			if len(chain) == 0 {
-				return nil, errors.New("acme: invalid PEM certificate chain")
+				return nil, nil, errors.New("acme: invalid PEM certificate chain")
 			}
 			break
 		}
 		if len(chain) == maxChainLen {
-			return nil, errors.New("acme: certificate chain is too long")
+			return nil, nil, errors.New("acme: certificate chain is too long")
 		}
 		if p.Type != "CERTIFICATE" {
-			return nil, fmt.Errorf("acme: invalid PEM block type %q", p.Type)
+			return nil, nil, fmt.Errorf("acme: invalid PEM block type %q", p.Type)
 		}
 		chain = append(chain, p.Bytes)
 	}
-	return chain, nil
+	for _, link := range linkHeader(res.Header, "alternate") {
+		alternate, err := resolveLink(url, link)
+		if err != nil {
+			return nil, nil, err
+		}
+		alternates = append(alternates, alternate)
+	}
+	return chain, alternates, nil
+}
+
+// linkHeader returns the target of the links of h with the relation type rel,
+// eg `<https://example.com/acme/cert/1/1>;rel="alternate"`.
+func linkHeader(h http.Header, rel string) []string {
+	var links []string
+	for _, v := range h["Link"] {
+		for _, link := range strings.Split(v, ",") {
+			parts := strings.Split(link, ";")
+			for _, p := range parts[1:] {
+				p = strings.TrimSpace(p)
+				if strings.HasPrefix(p, "rel=") && strings.Trim(p[4:], `"`) == rel {
+					links = append(links, strings.Trim(strings.TrimSpace(parts[0]), "<>"))
+				}
+			}
+		}
+	}
+	return links
+}
+
+func resolveLink(base, link string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	l, err := u.Parse(link)
+	if err != nil {
+		return "", err
+	}
+	return l.String(), nil
 }
 
 // responseError creates an error of Error type from resp.
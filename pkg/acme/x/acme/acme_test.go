@@ -798,6 +798,51 @@ func TestFinalizeOrder(t *testing.T) {
 	}
 }
 
+func TestFinalizeOrderChains(t *testing.T) {
+	newCert := func(org string) []byte {
+		template := x509.Certificate{
+			SerialNumber: big.NewInt(int64(1)),
+			Subject:      pkix.Name{Organization: []string{org}},
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().AddDate(0, 2, 0),
+		}
+		cert, err := x509.CreateCertificate(rand.Reader, &template, &template, &testKeyEC.PublicKey, testKeyEC)
+		if err != nil {
+			t.Fatalf("Error creating certificate: %v", err)
+		}
+		return cert
+	}
+	defaultCert := newCert("default")
+	alternateCert := newCert("alternate")
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "HEAD":
+			w.Header().Set("Replay-Nonce", "test-nonce")
+		case r.URL.Path == "/cert":
+			w.Header().Add("Link", `<https://example.com/acme/directory>;rel="index"`)
+			w.Header().Add("Link", `</cert/1>;rel="alternate"`)
+			pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: defaultCert})
+		case r.URL.Path == "/cert/1":
+			pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: alternateCert})
+		default:
+			w.Header().Set("Location", "/order")
+			fmt.Fprintf(w, `{"status":"valid","certificate":%q}`, ts.URL+"/cert")
+		}
+	}))
+	defer ts.Close()
+
+	c := newTestClient(testKeyEC, ts)
+	chains, err := c.FinalizeOrderChains(context.Background(), ts.URL, []byte("csr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][][]byte{{defaultCert}, {alternateCert}}
+	if !reflect.DeepEqual(chains, want) {
+		t.Errorf("got %d chains, want default and alternate chains", len(chains))
+	}
+}
+
 func TestWaitOrderInvalid(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == "HEAD" {
@@ -19,6 +19,7 @@ package controller
 import (
 	"crypto/x509"
 	"fmt"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
@@ -39,6 +40,7 @@ import (
 // deprecated controller to call functionality moved to the new controller.
 type NewCtrlIntf interface {
 	GetIngressList() ([]*networking.Ingress, error)
+	GetNode(name string) (*apiv1.Node, error)
 	GetSecret(name string) (*apiv1.Secret, error)
 	IsValidClass(ing *networking.Ingress) bool
 }
@@ -50,6 +52,7 @@ type GenericController struct {
 	syncStatus     StatusSync
 	sslCertTracker *sslCertTracker
 	stopLock       *sync.Mutex
+	stopStatus     *sync.Once
 	stopCh         chan struct{}
 }
 
@@ -58,9 +61,34 @@ type Configuration struct {
 	Client       clientset.Interface
 	MasterSocket string
 
-	RateLimitUpdate  float32
-	ResyncPeriod     time.Duration
-	WaitBeforeUpdate time.Duration
+	ApplyMode           string
+	DataplaneEndpoints  []string
+	DataplaneStorageDir string
+
+	DistributionAddress  string
+	DistributionTLSCert  string
+	DistributionTLSKey   string
+	DistributionClientCA string
+
+	DryRunAddress  string
+	DryRunTLSCert  string
+	DryRunTLSKey   string
+	DryRunClientCA string
+
+	RuntimeAPIAddress  string
+	RuntimeAPITLSCert  string
+	RuntimeAPITLSKey   string
+	RuntimeAPIClientCA string
+
+	ControllerRole string
+
+	RateLimitUpdate          float32
+	ResyncPeriod             time.Duration
+	ResyncPeriods            map[string]time.Duration
+	ResyncJitter             float64
+	WaitBeforeUpdate         time.Duration
+	WaitBeforeUpdateEndpoint time.Duration
+	WaitBeforeUpdateSecret   time.Duration
 
 	DefaultService           string
 	IngressClass             string
@@ -68,31 +96,67 @@ type Configuration struct {
 	WatchIngressWithoutClass bool
 	WatchNamespace           string
 	ConfigMapName            string
-
-	ForceNamespaceIsolation bool
-	WaitBeforeShutdown      int
-	AllowCrossNamespace     bool
-	DisableNodeList         bool
-	DisablePodList          bool
-	AnnPrefix               string
+	NamespaceConfigMapName   string
+
+	ForceNamespaceIsolation  bool
+	WaitBeforeShutdown       int
+	ShutdownTimeout          time.Duration
+	AllowCrossNamespace      bool
+	DisableNodeList          bool
+	DisablePodList           bool
+	DisableInformerTransform bool
+	SecretLabelSelector      string
+	WatchTLSSecretsOnly      bool
+	LazyWatch                bool
+	AnnPrefix                string
+	TranslateNginxAnn        bool
 
 	AcmeServer              bool
 	AcmeCheckPeriod         time.Duration
+	AcmeChallengeStore      string
+	AcmeCleanupPeriod       time.Duration
+	AcmeDNSPrecheck         bool
 	AcmeFailInitialDuration time.Duration
 	AcmeFailMaxDuration     time.Duration
+	AcmeMaxConcurrentOrders int
+	AcmeOrdersConfigmapName string
 	AcmeElectionID          string
 	AcmeSecretKeyName       string
 	AcmeTokenConfigmapName  string
 	AcmeTrackTLSAnn         bool
 
+	VaultAddress   string
+	VaultTokenFile string
+
 	BucketsResponseTime []float64
 
 	TCPConfigMapName       string
+	TemplateConfigMapName  string
+	DefaultPagesConfigMap  string
+	DefaultPagesAddress    string
 	DefaultSSLCertificate  string
+	DefaultSSLCertSelector string
+	LogFormat              string
+	SyslogListener         string
+	SyslogExclude          *regexp.Regexp
+	SyslogSampleRatio      float64
+	ExtAuthzListener       string
+	ExtAuthzTarget         string
+	ExtAuthzTimeout        time.Duration
+	ExtAuthzCA             string
+	ExtAuthzTLSCert        string
+	ExtAuthzTLSKey         string
 	VerifyHostname         bool
 	DefaultHealthzURL      string
+	HealthzReloadFailures  int
+	WithdrawUnhealthy      time.Duration
+	DriftCheckInterval     time.Duration
+	DriftReconcile         bool
 	StatsCollectProcPeriod time.Duration
+	ExportHAProxyStats     bool
+	EnableProfiling        bool
 	PublishService         string
+	PublishAddress         []string
 	Backend                ingress.Controller
 
 	UpdateStatus           bool
@@ -100,8 +164,16 @@ type Configuration struct {
 	ElectionID             string
 	UpdateStatusOnShutdown bool
 
-	BackendShards   int
-	SortEndpointsBy string
+	BackendShards    int
+	RenderWorkers    int
+	RollbackFailures int
+	StateSnapshotDir string
+	SortEndpointsBy  string
+
+	AuditLog                string
+	AuditLogSize            int
+	RecordUpdateEvents      bool
+	ReportIngressConditions bool
 }
 
 // newIngressController creates an Ingress controller
@@ -116,6 +188,7 @@ func newIngressController(config *Configuration) *GenericController {
 	ic := GenericController{
 		cfg:            config,
 		stopLock:       &sync.Mutex{},
+		stopStatus:     &sync.Once{},
 		stopCh:         make(chan struct{}),
 		sslCertTracker: newSSLCertTracker(),
 	}
@@ -207,13 +280,40 @@ func (ic GenericController) Stop() error {
 	if ic.stopCh != nil {
 		glog.Infof("shutting down controller queues")
 		close(ic.stopCh)
+		ic.StopStatusSync()
+		return nil
+	}
+
+	return fmt.Errorf("shutdown already in progress")
+}
+
+// StopStatusSync stops the ingress status sync, removing the controller
+// address from the ingress status if this is the last running instance.
+func (ic GenericController) StopStatusSync() {
+	ic.stopStatus.Do(func() {
 		if ic.syncStatus != nil {
 			ic.syncStatus.Shutdown()
 		}
-		return nil
+	})
+}
+
+// PublishedAddresses returns the IPs and hostnames the controller
+// publishes in the ingress status, or an empty list if the ingress status
+// update is disabled.
+func (ic GenericController) PublishedAddresses() ([]string, error) {
+	if ic.syncStatus == nil {
+		return nil, nil
 	}
+	return ic.syncStatus.RunningAddresses()
+}
 
-	return fmt.Errorf("shutdown already in progress")
+// IsStatusLeader returns true if this instance is the leader of the ingress
+// status update, or false if the ingress status update is disabled.
+func (ic GenericController) IsStatusLeader() bool {
+	if ic.syncStatus == nil {
+		return false
+	}
+	return ic.syncStatus.IsLeader()
 }
 
 // StartAsync starts the Ingress controller.
@@ -51,14 +51,17 @@ const (
 // StatusSync ...
 type StatusSync interface {
 	Run(stopCh <-chan struct{})
+	RunningAddresses() ([]string, error)
+	IsLeader() bool
 	Shutdown()
 }
 
 // statusSync keeps the status IP in each Ingress rule updated executing a periodic check
 // in all the defined rules. To simplify the process leader election is used so the update
 // is executed only in one node (Ingress controllers can be scaled to more than one)
-// If the controller is running with the flag --publish-service (with a valid service)
-// the IP address behind the service is used, if not the source is the IP/s of the node/s
+// If the controller is running with the flag --publish-address the static list is used,
+// if running with --publish-service (with a valid service) the IP address behind the
+// service is used, if not the source is the IP/s of the node/s
 type statusSync struct {
 	ctx context.Context
 	ic  *GenericController
@@ -212,9 +215,48 @@ func NewStatusSyncer(ic *GenericController) StatusSync {
 	return st
 }
 
+// RunningAddresses ...
+func (s statusSync) RunningAddresses() ([]string, error) {
+	return s.runningAddresses()
+}
+
+// IsLeader returns true if this instance is the one updating the status
+// of the ingress resources.
+func (s statusSync) IsLeader() bool {
+	return s.elector.IsLeader()
+}
+
 // runningAddresses returns a list of IP addresses and/or FQDN where the
-// ingress controller is currently running
+// ingress controller is currently running. The source is, in this order:
+// the static --publish-address list, the addresses of the --publish-service
+// service, or the addresses of the nodes running the controller pods.
 func (s *statusSync) runningAddresses() ([]string, error) {
+	if s.ic.cfg.WithdrawUnhealthy > 0 && (len(s.ic.cfg.PublishAddress) > 0 || s.ic.cfg.PublishService != "") {
+		// static and service addresses are shared by all the
+		// instances, withdraw only if none of them is ready
+		pods, err := s.listPods()
+		if err != nil {
+			return nil, err
+		}
+		ready := false
+		for i := range pods {
+			if isPodReady(&pods[i]) {
+				ready = true
+				break
+			}
+		}
+		if !ready {
+			glog.Warningf("withdrawing addresses from ingress status, no ready controller pod")
+			return []string{}, nil
+		}
+	}
+
+	if len(s.ic.cfg.PublishAddress) > 0 {
+		addrs := make([]string, len(s.ic.cfg.PublishAddress))
+		copy(addrs, s.ic.cfg.PublishAddress)
+		return addrs, nil
+	}
+
 	if s.ic.cfg.PublishService != "" {
 		ns, name, _ := k8s.ParseNameNS(s.ic.cfg.PublishService)
 		svc, err := s.ic.cfg.Client.CoreV1().Services(ns).Get(s.ctx, name, metav1.GetOptions{})
@@ -234,25 +276,71 @@ func (s *statusSync) runningAddresses() ([]string, error) {
 			addrs = append(addrs, ip)
 		}
 
-		return addrs, nil
+		if len(addrs) > 0 || svc.Spec.Type != apiv1.ServiceTypeNodePort {
+			return addrs, nil
+		}
+		// a NodePort service without external addresses is
+		// reached via the nodes running the controller pods
 	}
 
-	// get information about all the pods running the ingress controller
+	return s.nodeAddresses()
+}
+
+// nodeAddresses returns the addresses of the nodes running the ingress
+// controller pods, read from the node lister of the new controller.
+func (s *statusSync) nodeAddresses() ([]string, error) {
+	pods, err := s.listPods()
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := []string{}
+	for _, pod := range pods {
+		if pod.Spec.NodeName == "" {
+			// not scheduled yet
+			continue
+		}
+		if s.ic.cfg.WithdrawUnhealthy > 0 && !isPodReady(&pod) {
+			// readiness fails on unhealthy instances, see --withdraw-unhealthy
+			continue
+		}
+		node, err := s.ic.newctrl.GetNode(pod.Spec.NodeName)
+		if err != nil {
+			glog.Warningf("error reading node %s: %v", pod.Spec.NodeName, err)
+			continue
+		}
+		if k8s.IsNodeExcluded(node) {
+			glog.V(2).Infof("skipping addresses of excluded node %s", node.Name)
+			continue
+		}
+		// dual-stack nodes publish an address of each family
+		for _, name := range k8s.ReadNodeIPs(node, s.ic.cfg.UseNodeInternalIP) {
+			if !stringInSlice(name, addrs) {
+				addrs = append(addrs, name)
+			}
+		}
+	}
+	return addrs, nil
+}
+
+// listPods returns all the pods running the ingress controller
+func (s *statusSync) listPods() ([]apiv1.Pod, error) {
 	pods, err := s.ic.cfg.Client.CoreV1().Pods(s.pod.Namespace).List(s.ctx, metav1.ListOptions{
 		LabelSelector: labels.SelectorFromSet(s.pod.Labels).String(),
 	})
 	if err != nil {
 		return nil, err
 	}
+	return pods.Items, nil
+}
 
-	addrs := []string{}
-	for _, pod := range pods.Items {
-		name := k8s.GetNodeIP(s.ic.cfg.Client, pod.Spec.NodeName, s.ic.cfg.UseNodeInternalIP)
-		if !stringInSlice(name, addrs) {
-			addrs = append(addrs, name)
+func isPodReady(pod *apiv1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == apiv1.PodReady {
+			return cond.Status == apiv1.ConditionTrue
 		}
 	}
-	return addrs, nil
+	return false
 }
 
 func (s *statusSync) isRunningMultiplePods() bool {
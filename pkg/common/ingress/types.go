@@ -18,6 +18,7 @@ package ingress
 
 import (
 	"fmt"
+	"net/http"
 
 	"github.com/spf13/pflag"
 	apiv1 "k8s.io/api/core/v1"
@@ -41,10 +42,24 @@ type Controller interface {
 	// HealthChecker returns is a named healthz check that returns the ingress
 	// controller status
 	healthz.HealthChecker
+	// CheckReady returns the readiness of the ingress controller, which
+	// includes the cache sync and the first successful haproxy reload
+	CheckReady(r *http.Request) error
 	// Info returns information about the ingress controller
 	Info() *BackendInfo
 	// AcmeCheck starts a certificate missing/expiring/outdated check
 	AcmeCheck() (int, error)
+	// DebugCache returns the internal state of the controller cache,
+	// used for troubleshooting and exposed in JSON format
+	DebugCache() interface{}
+	// AuditLog returns the last entries of the audit log, used to list the
+	// changes applied by the haproxy updates, exposed in JSON format
+	AuditLog() interface{}
+	// ServersState returns the backend servers, their pods and their current
+	// state in haproxy, exposed in JSON format
+	ServersState() (interface{}, error)
+	// HAProxyConfig returns the content of the current haproxy.cfg file
+	HAProxyConfig() ([]byte, error)
 	// ConfigureFlags allow to configure more flags before the parsing of
 	// command line arguments
 	ConfigureFlags(*pflag.FlagSet)
@@ -19,6 +19,7 @@ package k8s
 import (
 	"context"
 	"fmt"
+	"net"
 	"os"
 	"strings"
 
@@ -65,6 +66,64 @@ func GetNodeIP(kubeClient clientset.Interface, name string, useInternalIP bool)
 	return ""
 }
 
+// GetNodeIPs returns the IP addresses of a node in the cluster, up to one
+// address of each IP family, so both addresses of a dual-stack node are used
+func GetNodeIPs(kubeClient clientset.Interface, name string, useInternalIP bool) []string {
+	ctx := context.Background()
+	node, err := kubeClient.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil
+	}
+	return ReadNodeIPs(node, useInternalIP)
+}
+
+// ReadNodeIPs returns the IP addresses of a node, up to one address of each
+// IP family. Used when the node is already read, e.g. from a node lister
+func ReadNodeIPs(node *apiv1.Node, useInternalIP bool) []string {
+	addrType := apiv1.NodeExternalIP
+	if useInternalIP {
+		addrType = apiv1.NodeInternalIP
+	}
+	var addrs []string
+	families := map[bool]bool{}
+	for _, address := range node.Status.Addresses {
+		if address.Type != addrType || address.Address == "" {
+			continue
+		}
+		ip := net.ParseIP(address.Address)
+		ipv4 := ip == nil || ip.To4() != nil
+		if !families[ipv4] {
+			families[ipv4] = true
+			addrs = append(addrs, address.Address)
+		}
+	}
+
+	return addrs
+}
+
+const (
+	// labelNodeExcludeBalancers is added to the nodes that shouldn't be
+	// used by external load balancers
+	labelNodeExcludeBalancers = "node.kubernetes.io/exclude-from-external-load-balancers"
+	// taintNodeToBeDeleted is added by the cluster autoscaler to the nodes
+	// being removed from the cluster
+	taintNodeToBeDeleted = "ToBeDeletedByClusterAutoscaler"
+)
+
+// IsNodeExcluded returns true if the addresses of a node shouldn't be used
+// to reach the workloads running on it, e.g. when publishing the ingress status
+func IsNodeExcluded(node *apiv1.Node) bool {
+	if _, found := node.Labels[labelNodeExcludeBalancers]; found {
+		return true
+	}
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == taintNodeToBeDeleted {
+			return true
+		}
+	}
+	return false
+}
+
 // PodInfo contains runtime information about the pod running the Ingres controller
 type PodInfo struct {
 	Name      string
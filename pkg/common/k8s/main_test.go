@@ -18,6 +18,7 @@ package k8s
 
 import (
 	"os"
+	"reflect"
 	"testing"
 
 	apiv1 "k8s.io/api/core/v1"
@@ -171,6 +172,101 @@ func TestGetNodeIP(t *testing.T) {
 	}
 }
 
+func TestGetNodeIPs(t *testing.T) {
+	node := func(addrs ...apiv1.NodeAddress) *testclient.Clientset {
+		return testclient.NewSimpleClientset(&apiv1.NodeList{Items: []apiv1.Node{{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "demo",
+			},
+			Status: apiv1.NodeStatus{
+				Addresses: addrs,
+			},
+		}}})
+	}
+	internal := func(addr string) apiv1.NodeAddress {
+		return apiv1.NodeAddress{Type: apiv1.NodeInternalIP, Address: addr}
+	}
+	external := func(addr string) apiv1.NodeAddress {
+		return apiv1.NodeAddress{Type: apiv1.NodeExternalIP, Address: addr}
+	}
+	testCases := []struct {
+		cs       *testclient.Clientset
+		internal bool
+		expected []string
+	}{
+		// 0
+		{
+			cs:       testclient.NewSimpleClientset(),
+			internal: true,
+		},
+		// 1
+		{
+			cs:       node(internal("10.0.0.1"), external("192.168.0.1")),
+			internal: true,
+			expected: []string{"10.0.0.1"},
+		},
+		// 2
+		{
+			cs:       node(internal("10.0.0.1"), internal("fd00::1"), external("192.168.0.1")),
+			internal: true,
+			expected: []string{"10.0.0.1", "fd00::1"},
+		},
+		// 3
+		{
+			cs:       node(internal("fd00::1"), internal("10.0.0.1"), internal("10.0.0.2"), internal("fd00::2")),
+			internal: true,
+			expected: []string{"fd00::1", "10.0.0.1"},
+		},
+		// 4
+		{
+			cs:       node(internal("10.0.0.1"), external(""), external("2001:db8::1"), external("192.168.0.1")),
+			internal: false,
+			expected: []string{"2001:db8::1", "192.168.0.1"},
+		},
+	}
+	for i, test := range testCases {
+		addrs := GetNodeIPs(test.cs, "demo", test.internal)
+		if !reflect.DeepEqual(addrs, test.expected) {
+			t.Errorf("addresses differ on %d, expected %v but was %v", i, test.expected, addrs)
+		}
+	}
+}
+
+func TestIsNodeExcluded(t *testing.T) {
+	testCases := []struct {
+		labels   map[string]string
+		taints   []apiv1.Taint
+		expected bool
+	}{
+		// 0
+		{},
+		// 1
+		{
+			labels: map[string]string{"node-role.kubernetes.io/worker": ""},
+			taints: []apiv1.Taint{{Key: "node.kubernetes.io/unschedulable", Effect: apiv1.TaintEffectNoSchedule}},
+		},
+		// 2
+		{
+			labels:   map[string]string{"node.kubernetes.io/exclude-from-external-load-balancers": ""},
+			expected: true,
+		},
+		// 3
+		{
+			taints:   []apiv1.Taint{{Key: "ToBeDeletedByClusterAutoscaler", Value: "1620000000", Effect: apiv1.TaintEffectNoSchedule}},
+			expected: true,
+		},
+	}
+	for i, test := range testCases {
+		node := &apiv1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "demo", Labels: test.labels},
+			Spec:       apiv1.NodeSpec{Taints: test.taints},
+		}
+		if excluded := IsNodeExcluded(node); excluded != test.expected {
+			t.Errorf("excluded differs on %d, expected %v but was %v", i, test.expected, excluded)
+		}
+	}
+}
+
 func TestGetPodDetails(t *testing.T) {
 	// POD_NAME & POD_NAMESPACE not exist
 	os.Setenv("POD_NAME", "")
@@ -0,0 +1,120 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// auditEntry is the changed objects applied by an haproxy update, and how
+// they were applied.
+type auditEntry struct {
+	Timestamp time.Time `json:"timestamp"`
+	ID        int       `json:"id"`
+	Objects   []string  `json:"objects"`
+	Update    string    `json:"update"`
+	Failure   string    `json:"failure,omitempty"`
+}
+
+// auditLog keeps the last entries of the audit log in memory. Entries are
+// also written, one JSON per line, either to out, or to file - the latter
+// has only the same last entries kept in memory.
+type auditLog struct {
+	mutex   sync.Mutex
+	out     io.Writer
+	file    string
+	size    int
+	entries []auditEntry
+}
+
+func createAuditLog(target string, size int) (*auditLog, error) {
+	a := &auditLog{size: size}
+	if target == "stdout" {
+		a.out = os.Stdout
+		return a, nil
+	}
+	a.file = target
+	// entries of the previous run, if any
+	f, err := os.Open(target)
+	if os.IsNotExist(err) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// ignoring a broken line, eg a partially written file
+			continue
+		}
+		a.append(entry)
+	}
+	return a, scanner.Err()
+}
+
+func (a *auditLog) append(entry auditEntry) {
+	a.entries = append(a.entries, entry)
+	if len(a.entries) > a.size {
+		a.entries = a.entries[len(a.entries)-a.size:]
+	}
+}
+
+func (a *auditLog) record(entry auditEntry) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.append(entry)
+	if a.out != nil {
+		b, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		_, err = a.out.Write(append(b, '\n'))
+		return err
+	}
+	out := &bytes.Buffer{}
+	encoder := json.NewEncoder(out)
+	for _, e := range a.entries {
+		if err := encoder.Encode(e); err != nil {
+			return err
+		}
+	}
+	// rename is atomic, the file is never partially written
+	tmp := a.file + ".tmp"
+	if err := ioutil.WriteFile(tmp, out.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, a.file)
+}
+
+// list returns a copy of the entries kept in memory, the most recent last.
+func (a *auditLog) list() []auditEntry {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	entries := make([]auditEntry, len(a.entries))
+	copy(entries, a.entries)
+	return entries
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditLog(t *testing.T) {
+	timestamp := time.Date(2021, 6, 1, 14, 32, 0, 0, time.UTC)
+	entry := func(id int, update, failure string) auditEntry {
+		return auditEntry{
+			Timestamp: timestamp,
+			ID:        id,
+			Objects:   []string{"update/ingress:default/app"},
+			Update:    update,
+			Failure:   failure,
+		}
+	}
+	testCases := []struct {
+		size       int
+		previous   string
+		entries    []auditEntry
+		expEntries []int
+	}{
+		// 0
+		{
+			size:       2,
+			entries:    []auditEntry{entry(1, "full", "")},
+			expEntries: []int{1},
+		},
+		// 1
+		{
+			size:       2,
+			entries:    []auditEntry{entry(1, "full", ""), entry(2, "dynamic", ""), entry(3, "full", "reload")},
+			expEntries: []int{2, 3},
+		},
+		// 2
+		{
+			size: 3,
+			previous: `{"timestamp":"2021-06-01T14:30:00Z","id":1,"objects":null,"update":"full"}
+broken
+{"timestamp":"2021-06-01T14:31:00Z","id":2,"objects":null,"update":"noop"}
+`,
+			entries:    []auditEntry{entry(3, "dynamic", "")},
+			expEntries: []int{1, 2, 3},
+		},
+	}
+	tempdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempdir)
+	for i, test := range testCases {
+		file := filepath.Join(tempdir, "audit.log")
+		_ = os.Remove(file)
+		if test.previous != "" {
+			if err := ioutil.WriteFile(file, []byte(test.previous), 0644); err != nil {
+				t.Fatalf("error writing audit log: %v", err)
+			}
+		}
+		audit, err := createAuditLog(file, test.size)
+		if err != nil {
+			t.Errorf("%d: error creating audit log: %v", i, err)
+			continue
+		}
+		for _, e := range test.entries {
+			if err := audit.record(e); err != nil {
+				t.Errorf("%d: error recording entry: %v", i, err)
+			}
+		}
+		var ids []int
+		for _, e := range audit.list() {
+			ids = append(ids, e.ID)
+		}
+		if !reflect.DeepEqual(ids, test.expEntries) {
+			t.Errorf("%d: expected entries %v but was %v", i, test.expEntries, ids)
+		}
+		// the file should have the same entries kept in memory
+		reload, err := createAuditLog(file, test.size)
+		if err != nil {
+			t.Errorf("%d: error reading audit log: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(reload.list(), audit.list()) {
+			t.Errorf("%d: expected file entries %+v but was %+v", i, audit.list(), reload.list())
+		}
+	}
+
+	// stdout
+	out := &bytes.Buffer{}
+	audit := &auditLog{out: out, size: 1}
+	_ = audit.record(entry(1, "dynamic", "validate"))
+	_ = audit.record(entry(2, "noop", ""))
+	expOutput := `
+{"timestamp":"2021-06-01T14:32:00Z","id":1,"objects":["update/ingress:default/app"],"update":"dynamic","failure":"validate"}
+{"timestamp":"2021-06-01T14:32:00Z","id":2,"objects":["update/ingress:default/app"],"update":"noop"}`
+	if strings.TrimSpace(out.String()) != strings.TrimSpace(expOutput) {
+		t.Errorf("expected output '%s' but was '%s'", expOutput, out.String())
+	}
+	if entries := audit.list(); len(entries) != 1 || entries[0].ID != 2 {
+		t.Errorf("expected only the last entry in memory, but was %+v", entries)
+	}
+}
@@ -24,16 +24,17 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"reflect"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	api "k8s.io/api/core/v1"
 	networking "k8s.io/api/networking/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	k8s "k8s.io/client-go/kubernetes"
@@ -41,11 +42,14 @@ import (
 	typedv1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
 
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/acme"
 	cfile "github.com/jcmoraisjr/haproxy-ingress/pkg/common/file"
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/common/ingress/controller"
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/common/net/ssl"
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/annotations"
+	ingtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/types"
 	convtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/types"
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/types"
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/utils"
@@ -53,27 +57,62 @@ import (
 
 const dhparamFilename = "dhparam.pem"
 
+// changeClass groups the changed objects that share the same amount of time
+// to wait before being applied.
+type changeClass int
+
+const (
+	// changeConfig has changes that usually need to reload haproxy, eg
+	// ingress, service and configmap resources.
+	changeConfig changeClass = iota
+	// changeEndpoints has changes in endpoints and pods, usually applied
+	// via the runtime api without reloading haproxy.
+	changeEndpoints
+	// changeSecrets has changes in certificates and other secrets.
+	changeSecrets
+	changeClassCount
+)
+
 type k8scache struct {
-	ctx                    context.Context
-	client                 k8s.Interface
-	logger                 types.Logger
-	listers                *listers
-	controller             *controller.GenericController
-	cfg                    *controller.Configuration
-	tracker                convtypes.Tracker
-	crossNS                bool
-	podNamespace           string
-	globalConfigMapKey     string
-	tcpConfigMapKey        string
-	acmeSecretKeyName      string
-	acmeTokenConfigmapName string
+	ctx                     context.Context
+	client                  k8s.Interface
+	logger                  types.Logger
+	listers                 *listers
+	consul                  *consulWatcher
+	vault                   *vaultPKI
+	files                   *fileWatcher
+	recorder                record.EventRecorder
+	controller              *controller.GenericController
+	cfg                     *controller.Configuration
+	tracker                 convtypes.Tracker
+	crossNS                 bool
+	podNamespace            string
+	controllerID            string
+	globalConfigMapKeys     []string
+	tcpConfigMapKey         string
+	templateConfigMapKey    string
+	pagesConfigMapKey       string
+	acmeSecretKeyName       string
+	acmeTokenConfigmapName  string
+	acmeChallengeStore      acme.ChallengeStore
+	acmeOrdersConfigmapName string
+	defaultCrtPool          labels.Selector
 	//
 	updateQueue      utils.Queue
 	stateMutex       sync.RWMutex
-	waitBeforeUpdate time.Duration
+	waitBeforeUpdate [changeClassCount]time.Duration
 	clear            bool
+	notifyAt         time.Time
 	needFullSync     bool
+	changedAt        time.Time
+	classChangedAt   [changeClassCount]time.Time
+	swappedAt        time.Time
+	swapped          []string
+	controllerNode   string
 	//
+	globalConfigMaps       map[string]map[string]string
+	snippetsConfigMapKeys  []string
+	caConfigMapKeys        map[string]bool
 	globalConfigMapData    map[string]string
 	tcpConfigMapData       map[string]string
 	globalConfigMapDataNew map[string]string
@@ -96,6 +135,8 @@ type k8scache struct {
 	configMapsUpd     []*api.ConfigMap
 	configMapsAdd     []*api.ConfigMap
 	podsNew           []*api.Pod
+	// secrets managed outside of the cluster, eg certificates issued by Vault
+	externalSecretsUpd []string
 	//
 }
 
@@ -108,8 +149,6 @@ func createCache(
 	watchNamespace string,
 	isolateNamespace bool,
 	disablePodList bool,
-	resync time.Duration,
-	waitBeforeUpdate time.Duration,
 ) *k8scache {
 	podNamespace := os.Getenv("POD_NAMESPACE")
 	if podNamespace == "" {
@@ -130,8 +169,32 @@ func createCache(
 	if !strings.Contains(acmeTokenConfigmapName, "/") {
 		acmeTokenConfigmapName = podNamespace + "/" + acmeTokenConfigmapName
 	}
-	globalConfigMapName := cfg.ConfigMapName
+	var acmeChallengeStore acme.ChallengeStore
+	if cfg.AcmeChallengeStore != "" {
+		// already validated on startup
+		acmeChallengeStore, _ = acme.NewChallengeStore(logger, cfg.AcmeChallengeStore)
+	}
+	acmeOrdersConfigmapName := cfg.AcmeOrdersConfigmapName
+	if !strings.Contains(acmeOrdersConfigmapName, "/") {
+		acmeOrdersConfigmapName = podNamespace + "/" + acmeOrdersConfigmapName
+	}
+	var defaultCrtPool labels.Selector
+	if cfg.DefaultSSLCertSelector != "" {
+		// already validated on startup
+		defaultCrtPool, _ = labels.Parse(cfg.DefaultSSLCertSelector)
+	}
+	var globalConfigMapNames []string
+	for _, cmName := range strings.Split(cfg.ConfigMapName, ",") {
+		if cmName = strings.TrimSpace(cmName); cmName != "" {
+			globalConfigMapNames = append(globalConfigMapNames, cmName)
+		}
+	}
 	tcpConfigMapName := cfg.TCPConfigMapName
+	waitBeforeUpdate := [changeClassCount]time.Duration{
+		changeConfig:    cfg.WaitBeforeUpdate,
+		changeEndpoints: cfg.WaitBeforeUpdateEndpoint,
+		changeSecrets:   cfg.WaitBeforeUpdateSecret,
+	}
 	eventBroadcaster := record.NewBroadcaster()
 	eventBroadcaster.StartLogging(logger.Info)
 	eventBroadcaster.StartRecordingToSink(&typedv1.EventSinkImpl{
@@ -141,43 +204,130 @@ func createCache(
 		Component: "ingress-controller",
 	})
 	cache := &k8scache{
-		ctx:                    context.Background(),
-		client:                 client,
-		logger:                 logger,
-		controller:             controller,
-		cfg:                    cfg,
-		tracker:                tracker,
-		crossNS:                cfg.AllowCrossNamespace,
-		podNamespace:           podNamespace,
-		globalConfigMapKey:     globalConfigMapName,
-		tcpConfigMapKey:        tcpConfigMapName,
-		acmeSecretKeyName:      acmeSecretKeyName,
-		acmeTokenConfigmapName: acmeTokenConfigmapName,
-		stateMutex:             sync.RWMutex{},
-		updateQueue:            updateQueue,
-		waitBeforeUpdate:       waitBeforeUpdate,
-		clear:                  true,
-		needFullSync:           false,
+		ctx:                     context.Background(),
+		client:                  client,
+		logger:                  logger,
+		recorder:                recorder,
+		controller:              controller,
+		cfg:                     cfg,
+		tracker:                 tracker,
+		crossNS:                 cfg.AllowCrossNamespace,
+		podNamespace:            podNamespace,
+		controllerID:            buildControllerID(cfg.AcmeElectionID, cfg.IngressClass),
+		globalConfigMapKeys:     globalConfigMapNames,
+		globalConfigMaps:        map[string]map[string]string{},
+		tcpConfigMapKey:         tcpConfigMapName,
+		templateConfigMapKey:    cfg.TemplateConfigMapName,
+		pagesConfigMapKey:       cfg.DefaultPagesConfigMap,
+		acmeSecretKeyName:       acmeSecretKeyName,
+		acmeTokenConfigmapName:  acmeTokenConfigmapName,
+		acmeChallengeStore:      acmeChallengeStore,
+		acmeOrdersConfigmapName: acmeOrdersConfigmapName,
+		defaultCrtPool:          defaultCrtPool,
+		stateMutex:              sync.RWMutex{},
+		updateQueue:             updateQueue,
+		waitBeforeUpdate:        waitBeforeUpdate,
+		clear:                   true,
+		needFullSync:            false,
+	}
+	cache.consul = newConsulWatcher(logger, cache.notifyConsulChange)
+	cache.files = newFileWatcher(logger, cache.notifyFileChange)
+	if cfg.VaultAddress != "" {
+		cache.vault = newVaultPKI(logger, cfg.VaultAddress, cfg.VaultTokenFile, cache.notifyExternalSecret)
 	}
 	// TODO I'm a circular reference, can you fix me?
-	cache.listers = createListers(cache, logger, recorder, client, watchNamespace, isolateNamespace, !disablePodList, resync)
+	cache.listers = createListers(cache, logger, recorder, client, watchNamespace, isolateNamespace, !disablePodList, !cfg.DisableInformerTransform,
+		secretSelector{
+			LabelSelector: cfg.SecretLabelSelector,
+			TLSOnly:       cfg.WatchTLSSecretsOnly,
+		}, cfg.LazyWatch, resyncConfig{
+			period:    cfg.ResyncPeriod,
+			resources: cfg.ResyncPeriods,
+			jitter:    cfg.ResyncJitter,
+		})
+	if cfg.LazyWatch {
+		// configmaps read from event notifications need to be watched from the start
+		for _, cmName := range append(globalConfigMapNames, tcpConfigMapName, cfg.TemplateConfigMapName, cfg.DefaultPagesConfigMap) {
+			if cmName != "" {
+				cache.listers.configMapWatcher.Watch(cmName)
+			}
+		}
+	}
 	return cache
 }
 
+// recordIngressWarning records a Warning event on an ingress resource.
+// Ingress resources not found in the cache are ignored.
+func (c *k8scache) recordIngressWarning(namespace, name, message string) {
+	c.recordIngressEvent(namespace, name, api.EventTypeWarning, "InvalidConfiguration", message)
+}
+
+// recordIngressEvent records an event on an ingress resource. Ingress
+// resources not found in the cache are ignored.
+func (c *k8scache) recordIngressEvent(namespace, name, eventtype, reason, message string) {
+	ing, err := c.listers.ingressLister.Ingresses(namespace).Get(name)
+	if err != nil {
+		return
+	}
+	c.recorder.Event(ing, eventtype, reason, message)
+}
+
+// recordControllerWarning records a Warning event on the controller's pod.
+// The event is ignored if the pod cannot be found.
+func (c *k8scache) recordControllerWarning(reason, message string) {
+	c.recordControllerEvent(api.EventTypeWarning, reason, message)
+}
+
+// recordControllerEvent records an event on the controller's pod. The event
+// is ignored if the pod cannot be found.
+func (c *k8scache) recordControllerEvent(eventtype, reason, message string) {
+	namespace := os.Getenv("POD_NAMESPACE")
+	podname := os.Getenv("POD_NAME")
+	if namespace == "" || podname == "" {
+		return
+	}
+	pod, err := c.client.CoreV1().Pods(namespace).Get(c.ctx, podname, metav1.GetOptions{})
+	if err != nil {
+		return
+	}
+	c.recorder.Event(pod, eventtype, reason, message)
+}
+
 func (c *k8scache) RunAsync(stopCh <-chan struct{}) {
 	c.listers.RunAsync(stopCh)
+	c.consul.Run(stopCh)
+	c.files.Run(stopCh)
+	if c.vault != nil {
+		c.vault.Run(stopCh)
+	}
+}
+
+// HasSynced returns true if the informers finished the initial sync.
+func (c *k8scache) HasSynced() bool {
+	return c.listers.running
 }
 
 func (c *k8scache) GetIngressPodName() (namespace, podname string, err error) {
-	namespace = os.Getenv("POD_NAMESPACE")
-	podname = os.Getenv("POD_NAME")
+	pod, err := c.getIngressPod()
+	if err != nil {
+		return "", "", err
+	}
+	return pod.Namespace, pod.Name, nil
+}
+
+// getIngressPod reads the controller pod straight from the API, the pod
+// lister only has the pods of the watched namespaces.
+func (c *k8scache) getIngressPod() (*api.Pod, error) {
+	namespace := os.Getenv("POD_NAMESPACE")
+	podname := os.Getenv("POD_NAME")
 	if namespace == "" || podname == "" {
-		return "", "", fmt.Errorf("missing POD_NAMESPACE or POD_NAME envvar")
+		return nil, fmt.Errorf("missing POD_NAMESPACE or POD_NAME envvar")
 	}
-	if pod, _ := c.client.CoreV1().Pods(namespace).Get(c.ctx, podname, metav1.GetOptions{}); pod == nil {
-		return "", "", fmt.Errorf("ingress controller pod was not found: %s/%s", namespace, podname)
+	pod, _ := c.client.CoreV1().Pods(namespace).Get(c.ctx, podname, metav1.GetOptions{})
+	if pod == nil {
+		return nil, fmt.Errorf("ingress controller pod was not found: %s/%s", namespace, podname)
 	}
-	return namespace, podname, nil
+	return pod, nil
 }
 
 func (c *k8scache) GetIngress(ingressName string) (*networking.Ingress, error) {
@@ -226,23 +376,106 @@ func (c *k8scache) GetSecret(secretName string) (*api.Secret, error) {
 		return nil, err
 	}
 	if c.listers.running {
-		return c.listers.secretLister.Secrets(namespace).Get(name)
+		return c.getSecret(namespace, name)
 	}
 	return c.client.CoreV1().Secrets(namespace).Get(c.ctx, name, metav1.GetOptions{})
 }
 
+// getSecret reads a secret from the secret lister. Secrets not found in the
+// lister are read from the apiserver if the secret informer is restricted
+// by --secret-label-selector or --watch-tls-secrets-only. On --lazy-watch,
+// secrets are watched after read for the first time.
+func (c *k8scache) getSecret(namespace, name string) (*api.Secret, error) {
+	if c.listers.secretWatcher != nil {
+		obj, err := c.listers.secretWatcher.Get(namespace, name)
+		if err != nil {
+			return nil, err
+		}
+		return obj.(*api.Secret), nil
+	}
+	secret, err := c.listers.secretLister.Secrets(namespace).Get(name)
+	if err != nil && c.listers.unmatchedSecretWatcher != nil && k8serrors.IsNotFound(err) {
+		obj, err := c.listers.unmatchedSecretWatcher.Get(namespace, name)
+		if err != nil {
+			return nil, err
+		}
+		return obj.(*api.Secret), nil
+	}
+	return secret, err
+}
+
 func (c *k8scache) GetConfigMap(configMapName string) (*api.ConfigMap, error) {
 	namespace, name, err := cache.SplitMetaNamespaceKey(configMapName)
 	if err != nil {
 		return nil, err
 	}
+	return c.getConfigMap(namespace, name)
+}
+
+func (c *k8scache) getConfigMap(namespace, name string) (*api.ConfigMap, error) {
+	if c.listers.configMapWatcher != nil {
+		obj, err := c.listers.configMapWatcher.Get(namespace, name)
+		if err != nil {
+			return nil, err
+		}
+		return obj.(*api.ConfigMap), nil
+	}
 	return c.listers.configMapLister.ConfigMaps(namespace).Get(name)
 }
 
+// collectLazyWatches stops the watch of secrets, configmaps, files and
+// consul services, and the renewal of vault certificates, that are neither
+// read since the last collect nor tracked by an ingress resource. Should be
+// called in the sync goroutine, tracker isn't thread safe.
+func (c *k8scache) collectLazyWatches() {
+	c.consul.Collect(func(service string) bool {
+		return c.tracker.IsTracked(convtypes.ServiceType, service)
+	})
+	c.files.Collect(func(name string) bool {
+		return c.tracker.IsTracked(convtypes.SecretType, name)
+	})
+	if c.vault != nil {
+		c.vault.Collect(func(name string) bool {
+			return c.tracker.IsTracked(convtypes.SecretType, name)
+		})
+	}
+	if c.listers.unmatchedSecretWatcher != nil {
+		c.listers.unmatchedSecretWatcher.Collect(func(key string) bool {
+			return c.tracker.IsTracked(convtypes.SecretType, key)
+		})
+	}
+	if c.listers.secretWatcher == nil {
+		return
+	}
+	c.listers.secretWatcher.Collect(func(key string) bool {
+		return c.tracker.IsTracked(convtypes.SecretType, key)
+	})
+	// reading snippets outside Collect(), Notify() watches them with stateMutex locked
+	c.stateMutex.RLock()
+	snippets := c.snippetsConfigMapKeys
+	c.stateMutex.RUnlock()
+	c.listers.configMapWatcher.Collect(func(key string) bool {
+		return c.isGlobalConfigMap(key) || key == c.tcpConfigMapKey || key == c.templateConfigMapKey || key == c.pagesConfigMapKey ||
+			containsKey(snippets, key) || c.tracker.IsTracked(convtypes.ConfigMapType, key)
+	})
+}
+
 func (c *k8scache) GetEndpoints(service *api.Service) (*api.Endpoints, error) {
 	return c.listers.endpointLister.Endpoints(service.Namespace).Get(service.Name)
 }
 
+// GetConsulEndpoints returns the healthy endpoints of a Consul service. Changes
+// in the Consul service are notified as endpoint changes of the kubernetes
+// service, so the same pipeline of the kubernetes endpoints is used.
+func (c *k8scache) GetConsulEndpoints(address, consulService string, service *api.Service) ([]convtypes.ExternalEndpoint, error) {
+	return c.consul.Get(address, consulService, service.Namespace+"/"+service.Name)
+}
+
+func (c *k8scache) notifyConsulChange(service string) {
+	namespace, name, _ := cache.SplitMetaNamespaceKey(service)
+	c.Notify(nil, &api.Endpoints{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}})
+}
+
 // GetTerminatingPods returns the pods that are terminating and belong
 // (based on the Spec.Selector) to the supplied service.
 func (c *k8scache) GetTerminatingPods(service *api.Service, track convtypes.TrackingTarget) (pl []*api.Pod, err error) {
@@ -302,10 +535,59 @@ func (c *k8scache) GetPod(podName string) (*api.Pod, error) {
 	return c.client.CoreV1().Pods(namespace).Get(c.ctx, name, metav1.GetOptions{})
 }
 
+// GetNode returns a node of the cluster, read from the node lister if
+// watching the whole cluster.
+func (c *k8scache) GetNode(nodeName string) (*api.Node, error) {
+	if c.listers.hasNodeLister {
+		return c.listers.nodeLister.Get(nodeName)
+	}
+	// the node lister is only started on cluster wide watch
+	return c.client.CoreV1().Nodes().Get(c.ctx, nodeName, metav1.GetOptions{})
+}
+
+// GetNodeList returns all the nodes of the cluster, read from the node
+// lister if watching the whole cluster.
+func (c *k8scache) GetNodeList() ([]*api.Node, error) {
+	if c.listers.hasNodeLister {
+		return c.listers.nodeLister.List(labels.Everything())
+	}
+	nodes, err := c.client.CoreV1().Nodes().List(c.ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	nodeList := make([]*api.Node, len(nodes.Items))
+	for i := range nodes.Items {
+		nodeList[i] = &nodes.Items[i]
+	}
+	return nodeList, nil
+}
+
 func (c *k8scache) GetPodNamespace() string {
 	return c.podNamespace
 }
 
+// GetControllerNodeName returns the name of the node running the
+// controller pod. The node of a pod never changes, so it is read only once.
+func (c *k8scache) GetControllerNodeName() (string, error) {
+	c.stateMutex.RLock()
+	nodeName := c.controllerNode
+	c.stateMutex.RUnlock()
+	if nodeName != "" {
+		return nodeName, nil
+	}
+	pod, err := c.getIngressPod()
+	if err != nil {
+		return "", err
+	}
+	if pod.Spec.NodeName == "" {
+		return "", fmt.Errorf("controller pod is not scheduled yet: %s/%s", pod.Namespace, pod.Name)
+	}
+	c.stateMutex.Lock()
+	c.controllerNode = pod.Spec.NodeName
+	c.stateMutex.Unlock()
+	return pod.Spec.NodeName, nil
+}
+
 var contentProtocolRegex = regexp.MustCompile(`^([a-z]+)://(.*)$`)
 
 func getContentProtocol(input string) (proto, content string) {
@@ -339,12 +621,14 @@ func (c *k8scache) buildSecretName(defaultNamespace, secretName string) (string,
 func (c *k8scache) GetTLSSecretPath(defaultNamespace, secretName string, track convtypes.TrackingTarget) (file convtypes.CrtFile, err error) {
 	proto, content := getContentProtocol(secretName)
 	if proto == "file" {
-		if _, err := os.Stat(content); err != nil {
+		_, hash, err := c.files.Read(content, track == convtypes.TrackingTarget{})
+		if err != nil {
 			return file, err
 		}
+		c.tracker.Track(false, track, convtypes.SecretType, fileWatchName(content))
 		return convtypes.CrtFile{
 			Filename: content,
-			SHA1Hash: "-",
+			SHA1Hash: hash,
 		}, nil
 	} else if proto != "secret" {
 		return file, fmt.Errorf("unsupported protocol: %s", proto)
@@ -366,12 +650,58 @@ func (c *k8scache) GetTLSSecretPath(defaultNamespace, secretName string, track c
 		Filename:   sslCert.PemFileName,
 		SHA1Hash:   sslCert.PemSHA,
 		CommonName: sslCert.Certificate.Subject.CommonName,
+		DNSNames:   sslCert.CN,
 		NotAfter:   sslCert.Certificate.NotAfter,
 	}
 	c.tracker.Track(false, track, convtypes.SecretType, namespace+"/"+name)
 	return file, nil
 }
 
+// GetVaultCertPath returns the certificate of a hostname issued by the PKI
+// secrets engine of Vault. Renewals are notified as changes of a secret,
+// so the same pipeline of the secrets is used.
+func (c *k8scache) GetVaultCertPath(mount, role, hostname string, track convtypes.TrackingTarget) (file convtypes.CrtFile, err error) {
+	name := vaultCertName(mount, role, hostname)
+	if c.vault == nil {
+		c.tracker.Track(true, track, convtypes.SecretType, name)
+		return file, fmt.Errorf("vault is not configured, use --vault-address and --vault-token-file")
+	}
+	file, err = c.vault.Get(mount, role, hostname)
+	c.tracker.Track(err != nil, track, convtypes.SecretType, name)
+	return file, err
+}
+
+// implements converters.types.Cache
+func (c *k8scache) GetTLSSecretPool() ([]convtypes.CrtFile, error) {
+	if c.defaultCrtPool == nil {
+		return nil, nil
+	}
+	secrets, err := c.listers.secretLister.List(c.defaultCrtPool)
+	if err != nil {
+		return nil, err
+	}
+	var files []convtypes.CrtFile
+	for _, secret := range secrets {
+		sslCert, err := c.controller.GetCertificate(secret.Namespace, secret.Name)
+		if err != nil || sslCert.PemFileName == "" {
+			c.logger.Warn("skipping secret '%s/%s' of the default certificate pool: missing or invalid certificate", secret.Namespace, secret.Name)
+			continue
+		}
+		files = append(files, convtypes.CrtFile{
+			Filename:   sslCert.PemFileName,
+			SHA1Hash:   sslCert.PemSHA,
+			CommonName: sslCert.Certificate.Subject.CommonName,
+			DNSNames:   sslCert.CN,
+			NotAfter:   sslCert.Certificate.NotAfter,
+		})
+	}
+	return files, nil
+}
+
+func (c *k8scache) isDefaultCrtPoolSecret(secret *api.Secret) bool {
+	return c.defaultCrtPool != nil && c.defaultCrtPool.Matches(labels.Set(secret.Labels))
+}
+
 func (c *k8scache) GetCASecretPath(defaultNamespace, secretName string, track convtypes.TrackingTarget) (ca, crl convtypes.File, err error) {
 	proto, content := getContentProtocol(secretName)
 	if proto == "file" {
@@ -382,23 +712,30 @@ func (c *k8scache) GetCASecretPath(defaultNamespace, secretName string, track co
 		if len(files) > 2 {
 			return ca, crl, fmt.Errorf("only one or two filenames should be used")
 		}
-		if _, err := os.Stat(files[0]); err != nil {
+		global := track == convtypes.TrackingTarget{}
+		_, hash, err := c.files.Read(files[0], global)
+		if err != nil {
 			return ca, crl, err
 		}
+		c.tracker.Track(false, track, convtypes.SecretType, fileWatchName(files[0]))
 		ca = convtypes.File{
 			Filename: files[0],
-			SHA1Hash: "-",
+			SHA1Hash: hash,
 		}
 		if len(files) == 2 {
-			if _, err := os.Stat(files[1]); err != nil {
+			_, hash, err := c.files.Read(files[1], global)
+			if err != nil {
 				return ca, crl, err
 			}
+			c.tracker.Track(false, track, convtypes.SecretType, fileWatchName(files[1]))
 			crl = convtypes.File{
 				Filename: files[1],
-				SHA1Hash: "-",
+				SHA1Hash: hash,
 			}
 		}
 		return ca, crl, nil
+	} else if proto == "configmap" {
+		return c.getCAConfigMapPath(defaultNamespace, content, track)
 	} else if proto != "secret" {
 		return ca, crl, fmt.Errorf("unsupported protocol: %s", proto)
 	}
@@ -430,15 +767,61 @@ func (c *k8scache) GetCASecretPath(defaultNamespace, secretName string, track co
 	return ca, crl, nil
 }
 
+// getCAConfigMapPath reads the CA bundle, and an optional CRL, from the
+// `ca.crt` and `ca.crl` keys of a ConfigMap, eg a trust store distributed
+// to all the namespaces of the cluster.
+func (c *k8scache) getCAConfigMapPath(defaultNamespace, configMapName string, track convtypes.TrackingTarget) (ca, crl convtypes.File, err error) {
+	namespace, name, err := c.buildSecretName(defaultNamespace, configMapName)
+	if err != nil {
+		return ca, crl, err
+	}
+	key := namespace + "/" + name
+	c.stateMutex.Lock()
+	if c.caConfigMapKeys == nil {
+		c.caConfigMapKeys = map[string]bool{}
+	}
+	// CA ConfigMaps can be declared in any namespace, IsValidConfigMap() need to know them
+	c.caConfigMapKeys[key] = true
+	c.stateMutex.Unlock()
+	configMap, err := c.getConfigMap(namespace, name)
+	if err != nil {
+		c.tracker.Track(true, track, convtypes.ConfigMapType, key)
+		return ca, crl, err
+	}
+	caData, found := configMap.Data["ca.crt"]
+	if !found {
+		c.tracker.Track(true, track, convtypes.ConfigMapType, key)
+		return ca, crl, fmt.Errorf("configmap '%s' does not have key 'ca.crt'", key)
+	}
+	sslCert, err := ssl.AddCertAuth(fmt.Sprintf("configmap_%s_%s", namespace, name), []byte(caData), []byte(configMap.Data["ca.crl"]))
+	if err != nil {
+		c.tracker.Track(true, track, convtypes.ConfigMapType, key)
+		return ca, crl, fmt.Errorf("error reading configmap '%s': %v", key, err)
+	}
+	ca = convtypes.File{
+		Filename: sslCert.CAFileName,
+		SHA1Hash: sslCert.PemSHA,
+	}
+	if sslCert.CRLFileName != "" {
+		crl = convtypes.File{
+			Filename: sslCert.CRLFileName,
+			SHA1Hash: sslCert.PemSHA,
+		}
+	}
+	c.tracker.Track(false, track, convtypes.ConfigMapType, key)
+	return ca, crl, nil
+}
+
 func (c *k8scache) GetDHSecretPath(defaultNamespace, secretName string) (file convtypes.File, err error) {
 	proto, content := getContentProtocol(secretName)
 	if proto == "file" {
-		if _, err := os.Stat(content); err != nil {
+		_, hash, err := c.files.Read(content, true)
+		if err != nil {
 			return file, err
 		}
 		return convtypes.File{
 			Filename: content,
-			SHA1Hash: "-",
+			SHA1Hash: hash,
 		}, nil
 	} else if proto != "secret" {
 		return file, fmt.Errorf("unsupported protocol: %s", proto)
@@ -447,7 +830,7 @@ func (c *k8scache) GetDHSecretPath(defaultNamespace, secretName string) (file co
 	if err != nil {
 		return file, err
 	}
-	secret, err := c.listers.secretLister.Secrets(namespace).Get(name)
+	secret, err := c.getSecret(namespace, name)
 	if err != nil {
 		return file, err
 	}
@@ -470,7 +853,12 @@ func (c *k8scache) GetDHSecretPath(defaultNamespace, secretName string) (file co
 func (c *k8scache) GetSecretContent(defaultNamespace, secretName, keyName string, track convtypes.TrackingTarget) ([]byte, error) {
 	proto, content := getContentProtocol(secretName)
 	if proto == "file" {
-		return ioutil.ReadFile(content)
+		data, _, err := c.files.Read(content, track == convtypes.TrackingTarget{})
+		if err != nil {
+			return nil, err
+		}
+		c.tracker.Track(false, track, convtypes.SecretType, fileWatchName(content))
+		return data, nil
 	} else if proto != "secret" {
 		return nil, fmt.Errorf("unsupported protocol: %s", proto)
 	}
@@ -478,7 +866,7 @@ func (c *k8scache) GetSecretContent(defaultNamespace, secretName, keyName string
 	if err != nil {
 		return nil, err
 	}
-	secret, err := c.listers.secretLister.Secrets(namespace).Get(name)
+	secret, err := c.getSecret(namespace, name)
 	if err != nil {
 		c.tracker.Track(true, track, convtypes.SecretType, namespace+"/"+name)
 		return nil, err
@@ -526,6 +914,7 @@ func (c *k8scache) GetKey() (crypto.Signer, error) {
 		newSecret := &api.Secret{}
 		newSecret.Namespace = namespace
 		newSecret.Name = name
+		newSecret.Labels = managedLabels(c.controllerID, acmeAccountComponent)
 		newSecret.Data = map[string][]byte{api.TLSPrivateKeyKey: pemEncode}
 		if err := c.CreateOrUpdateSecret(newSecret); err != nil {
 			return nil, err
@@ -566,6 +955,7 @@ func (c *k8scache) SetTLSSecretContent(secretName string, pemCrt, pemKey []byte)
 	secret := &api.Secret{}
 	secret.Namespace = namespace
 	secret.Name = name
+	secret.Labels = managedLabels(c.controllerID, acmeCertificateComponent)
 	secret.Type = api.SecretTypeTLS
 	secret.Data = map[string][]byte{
 		api.TLSCertKey:       pemCrt,
@@ -574,8 +964,21 @@ func (c *k8scache) SetTLSSecretContent(secretName string, pemCrt, pemKey []byte)
 	return c.CreateOrUpdateSecret(secret)
 }
 
+// Implements acme.SignerResolver
+func (c *k8scache) GetPublishedAddresses() ([]string, error) {
+	return c.controller.PublishedAddresses()
+}
+
+// Implements acme.SignerResolver
+func (c *k8scache) RecordSignerWarning(reason, message string) {
+	c.recordControllerWarning(reason, message)
+}
+
 // Implements acme.ServerResolver
 func (c *k8scache) GetToken(domain, uri string) string {
+	if c.acmeChallengeStore != nil {
+		return c.acmeChallengeStore.GetToken(domain, uri)
+	}
 	config, err := c.GetConfigMap(c.acmeTokenConfigmapName)
 	if err != nil {
 		return ""
@@ -593,45 +996,149 @@ func (c *k8scache) GetToken(domain, uri string) string {
 
 // Implements acme.ClientResolver
 func (c *k8scache) SetToken(domain string, uri, token string) error {
+	if c.acmeChallengeStore != nil {
+		return c.acmeChallengeStore.SetToken(domain, uri, token)
+	}
 	namespace, name, err := cache.SplitMetaNamespaceKey(c.acmeTokenConfigmapName)
 	if err != nil {
 		return err
 	}
-	config, err := c.listers.configMapLister.ConfigMaps(namespace).Get(name)
+	return c.updateConfigMap(namespace, name, func(config *api.ConfigMap) {
+		if config.Labels == nil {
+			config.Labels = make(map[string]string, 2)
+		}
+		for label, value := range managedLabels(c.controllerID, acmeTokensComponent) {
+			config.Labels[label] = value
+		}
+		if config.Data == nil {
+			config.Data = make(map[string]string, 1)
+		}
+		if token != "" {
+			config.Data[domain] = uri + "=" + token
+		} else {
+			delete(config.Data, domain)
+		}
+	})
+}
+
+// Implements acme.QueueResolver
+func (c *k8scache) GetOrderState(secretName string) string {
+	config, err := c.GetConfigMap(c.acmeOrdersConfigmapName)
 	if err != nil {
-		config = &api.ConfigMap{}
-		config.Namespace = namespace
-		config.Name = name
-	}
-	if config.Data == nil {
-		config.Data = make(map[string]string, 1)
+		return ""
 	}
-	if token != "" {
-		config.Data[domain] = uri + "=" + token
-	} else {
-		delete(config.Data, domain)
+	return config.Data[orderStateKey(secretName)]
+}
+
+// Implements acme.QueueResolver
+func (c *k8scache) SetOrderState(secretName, state string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(c.acmeOrdersConfigmapName)
+	if err != nil {
+		return err
 	}
-	return c.CreateOrUpdateConfigMap(config)
+	return c.updateConfigMap(namespace, name, func(config *api.ConfigMap) {
+		if config.Labels == nil {
+			config.Labels = make(map[string]string, 2)
+		}
+		for label, value := range managedLabels(c.controllerID, acmeOrdersComponent) {
+			config.Labels[label] = value
+		}
+		if config.Data == nil {
+			config.Data = make(map[string]string, 1)
+		}
+		if state != "" {
+			config.Data[orderStateKey(secretName)] = state
+		} else {
+			delete(config.Data, orderStateKey(secretName))
+		}
+	})
 }
 
-func (c *k8scache) CreateOrUpdateSecret(secret *api.Secret) (err error) {
-	cli := c.client.CoreV1().Secrets(secret.Namespace)
-	if _, err := c.listers.secretLister.Secrets(secret.Namespace).Get(secret.Name); err != nil {
-		_, err = cli.Create(c.ctx, secret, metav1.CreateOptions{})
-	} else {
+// orderStateKey converts the namespace/name of a secret to a valid configmap
+// key. Namespaces don't have dots, so the first dot splits namespace and name.
+func orderStateKey(secretName string) string {
+	return strings.Replace(secretName, "/", ".", 1)
+}
+
+// CreateOrUpdateSecret creates secret, or replaces its metadata, type and data
+// if it already exists.
+func (c *k8scache) CreateOrUpdateSecret(secret *api.Secret) error {
+	return c.updateSecret(secret.Namespace, secret.Name, func(cur *api.Secret) {
+		cur.Labels = secret.Labels
+		cur.Annotations = secret.Annotations
+		cur.Type = secret.Type
+		cur.Data = secret.Data
+		cur.StringData = secret.StringData
+	})
+}
+
+// CreateOrUpdateConfigMap creates cm, or replaces its metadata and data
+// if it already exists.
+func (c *k8scache) CreateOrUpdateConfigMap(cm *api.ConfigMap) error {
+	return c.updateConfigMap(cm.Namespace, cm.Name, func(cur *api.ConfigMap) {
+		cur.Labels = cm.Labels
+		cur.Annotations = cm.Annotations
+		cur.Data = cm.Data
+		cur.BinaryData = cm.BinaryData
+	})
+}
+
+// updateSecret changes a secret via update, creating it if it doesn't
+// exist. The secret is read from the API server instead of the cache, and
+// update is called again on a fresh copy if the secret was changed or created
+// in the mean time, eg by another controller replica.
+func (c *k8scache) updateSecret(namespace, name string, update func(secret *api.Secret)) error {
+	cli := c.client.CoreV1().Secrets(namespace)
+	return retryOnWriteConflict(func() error {
+		secret, err := cli.Get(c.ctx, name, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			secret = &api.Secret{}
+			secret.Namespace = namespace
+			secret.Name = name
+			update(secret)
+			_, err = cli.Create(c.ctx, secret, metav1.CreateOptions{})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		update(secret)
 		_, err = cli.Update(c.ctx, secret, metav1.UpdateOptions{})
-	}
-	return err
+		return err
+	})
 }
 
-func (c *k8scache) CreateOrUpdateConfigMap(cm *api.ConfigMap) (err error) {
-	cli := c.client.CoreV1().ConfigMaps(cm.Namespace)
-	if _, err := c.listers.configMapLister.ConfigMaps(cm.Namespace).Get(cm.Name); err != nil {
-		_, err = cli.Create(c.ctx, cm, metav1.CreateOptions{})
-	} else {
+// updateConfigMap changes a configmap via update, creating it if it doesn't
+// exist. The configmap is read from the API server instead of the cache, and
+// update is called again on a fresh copy if the configmap was changed or
+// created in the mean time, eg by another controller replica.
+func (c *k8scache) updateConfigMap(namespace, name string, update func(cm *api.ConfigMap)) error {
+	cli := c.client.CoreV1().ConfigMaps(namespace)
+	return retryOnWriteConflict(func() error {
+		cm, err := cli.Get(c.ctx, name, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			cm = &api.ConfigMap{}
+			cm.Namespace = namespace
+			cm.Name = name
+			update(cm)
+			_, err = cli.Create(c.ctx, cm, metav1.CreateOptions{})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		update(cm)
 		_, err = cli.Update(c.ctx, cm, metav1.UpdateOptions{})
-	}
-	return err
+		return err
+	})
+}
+
+// retryOnWriteConflict retries a write operation that failed because the
+// object was changed or created after it was read.
+func retryOnWriteConflict(fn func() error) error {
+	return retry.OnError(retry.DefaultRetry, func(err error) bool {
+		return k8serrors.IsConflict(err) || k8serrors.IsAlreadyExists(err)
+	}, fn)
 }
 
 // implements ListerEvents
@@ -683,8 +1190,57 @@ func (c *k8scache) IsValidConfigMap(cm *api.ConfigMap) bool {
 	if cm.Namespace == c.podNamespace {
 		return true
 	}
+	if c.cfg.NamespaceConfigMapName != "" && cm.Name == c.cfg.NamespaceConfigMapName {
+		return true
+	}
 	key := fmt.Sprintf("%s/%s", cm.Namespace, cm.Name)
-	return key == c.globalConfigMapKey || key == c.tcpConfigMapKey
+	if c.isGlobalConfigMap(key) || key == c.tcpConfigMapKey || key == c.templateConfigMapKey || key == c.pagesConfigMapKey {
+		return true
+	}
+	c.stateMutex.RLock()
+	defer c.stateMutex.RUnlock()
+	return containsKey(c.snippetsConfigMapKeys, key) || c.caConfigMapKeys[key]
+}
+
+func (c *k8scache) isGlobalConfigMap(key string) bool {
+	return containsKey(c.globalConfigMapKeys, key)
+}
+
+func containsKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// updateGlobalConfigMap updates the data of one of the global configmaps,
+// a nil data means that the configmap was removed. All the global configmaps
+// are merged in the same order they were declared, so keys declared in a
+// configmap override the same keys of the configmaps declared before it.
+// Should be called with stateMutex locked.
+func (c *k8scache) updateGlobalConfigMap(key string, data map[string]string) {
+	if data != nil {
+		c.globalConfigMaps[key] = data
+	} else {
+		delete(c.globalConfigMaps, key)
+	}
+	merged := map[string]string{}
+	for _, cmKey := range c.globalConfigMapKeys {
+		for k, v := range c.globalConfigMaps[cmKey] {
+			merged[k] = v
+		}
+	}
+	c.globalConfigMapDataNew = merged
+	// config-snippets ConfigMaps can be declared in any namespace and aren't
+	// tracked, they need to be valid and watched while declared
+	c.snippetsConfigMapKeys = annotations.SnippetsConfigMapNames(merged[ingtypes.GlobalConfigSnippets], c.podNamespace)
+	if c.listers != nil && c.listers.configMapWatcher != nil {
+		for _, cmName := range c.snippetsConfigMapKeys {
+			c.listers.configMapWatcher.Watch(cmName)
+		}
+	}
 }
 
 // implements ListerEvents
@@ -716,9 +1272,22 @@ func (c *k8scache) Notify(old, cur interface{}) {
 				c.secretsDel = append(c.secretsDel, secret)
 				c.controller.DeleteSecret(fmt.Sprintf("%s/%s", secret.Namespace, secret.Name))
 			}
+			if c.isDefaultCrtPoolSecret(old.(*api.Secret)) {
+				// the pool is not tracked by hostname, changes in its
+				// secrets can move a hostname to another certificate
+				c.needFullSync = true
+			}
 		case *api.ConfigMap:
 			if cur == nil {
-				c.configMapsDel = append(c.configMapsDel, old.(*api.ConfigMap))
+				cm := old.(*api.ConfigMap)
+				c.configMapsDel = append(c.configMapsDel, cm)
+				key := cm.Namespace + "/" + cm.Name
+				if c.isGlobalConfigMap(key) {
+					c.updateGlobalConfigMap(key, nil)
+				}
+				if key == c.templateConfigMapKey {
+					c.needFullSync = true
+				}
 			}
 		}
 	}
@@ -755,6 +1324,9 @@ func (c *k8scache) Notify(old, cur interface{}) {
 				c.secretsUpd = append(c.secretsUpd, secret)
 			}
 			c.controller.UpdateSecret(fmt.Sprintf("%s/%s", secret.Namespace, secret.Name))
+			if c.isDefaultCrtPoolSecret(secret) {
+				c.needFullSync = true
+			}
 		case *api.ConfigMap:
 			cm := cur.(*api.ConfigMap)
 			if old == nil {
@@ -763,12 +1335,16 @@ func (c *k8scache) Notify(old, cur interface{}) {
 				c.configMapsUpd = append(c.configMapsUpd, cm)
 			}
 			key := fmt.Sprintf("%s/%s", cm.Namespace, cm.Name)
-			switch key {
-			case c.globalConfigMapKey:
-				c.globalConfigMapDataNew = cm.Data
-			case c.tcpConfigMapKey:
+			if c.isGlobalConfigMap(key) {
+				c.updateGlobalConfigMap(key, cm.Data)
+			}
+			if key == c.tcpConfigMapKey {
 				c.tcpConfigMapDataNew = cm.Data
 			}
+			if key == c.templateConfigMapKey {
+				// maps are only rendered again if their hosts and backends are changed
+				c.needFullSync = true
+			}
 		case *api.Pod:
 			c.podsNew = append(c.podsNew, cur.(*api.Pod))
 		}
@@ -776,19 +1352,150 @@ func (c *k8scache) Notify(old, cur interface{}) {
 	if old == nil && cur == nil {
 		c.needFullSync = true
 	}
-	if c.clear {
+	class := changeClassOf(old, cur)
+	if c.needFullSync {
+		// a full sync is only started when the config changes are applied
+		class = changeConfig
+	}
+	c.notifyUpdate(class)
+}
+
+// changeClassOf returns the class of a changed object, old and cur
+// follow the same rules of Notify.
+func changeClassOf(old, cur interface{}) changeClass {
+	obj := cur
+	if obj == nil {
+		obj = old
+	}
+	switch obj.(type) {
+	case *api.Endpoints, *api.Pod:
+		return changeEndpoints
+	case *api.Secret:
+		return changeSecrets
+	}
+	return changeConfig
+}
+
+// notifyExternalSecret notifies a change in a secret managed outside of
+// the cluster, name is the same one used to track the secret.
+func (c *k8scache) notifyExternalSecret(name string) {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+	c.externalSecretsUpd = append(c.externalSecretsUpd, name)
+	c.notifyUpdate(changeSecrets)
+}
+
+// notifyFileChange notifies a change in a file read via the file://
+// protocol. Files without a tracking target, eg the default certificate,
+// need a full sync.
+func (c *k8scache) notifyFileChange(name string, global bool) {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+	if global {
+		c.needFullSync = true
+		c.notifyUpdate(changeConfig)
+	} else {
+		c.externalSecretsUpd = append(c.externalSecretsUpd, name)
+		c.notifyUpdate(changeSecrets)
+	}
+}
+
+// notifyUpdate enqueues a new sync if the last changes were already
+// processed, or if the changes of class should be applied before the
+// sync already enqueued. Should be called with stateMutex locked.
+func (c *k8scache) notifyUpdate(class changeClass) {
+	now := time.Now()
+	if c.changedAt.IsZero() {
+		c.changedAt = now
+	}
+	if c.classChangedAt[class].IsZero() {
+		c.classChangedAt[class] = now
+	}
+	c.scheduleUpdate()
+}
+
+// scheduleUpdate enqueues a new sync when the wait time of the oldest
+// pending change expires, unless a sync is already enqueued to happen
+// before that. Should be called with stateMutex locked.
+func (c *k8scache) scheduleUpdate() {
+	var notifyAt time.Time
+	for class, changedAt := range c.classChangedAt {
+		if !changedAt.IsZero() {
+			at := changedAt.Add(c.waitBeforeUpdate[class])
+			if notifyAt.IsZero() || at.Before(notifyAt) {
+				notifyAt = at
+			}
+		}
+	}
+	if notifyAt.IsZero() {
+		return
+	}
+	if c.clear || notifyAt.Before(c.notifyAt) {
 		// Wait before notify, giving the time to receive
 		// all/most of the changes of a batch update
-		time.AfterFunc(c.waitBeforeUpdate, func() { c.updateQueue.Notify() })
+		time.AfterFunc(time.Until(notifyAt), func() { c.updateQueue.Notify() })
+		c.notifyAt = notifyAt
 	}
 	c.clear = false
 }
 
-// implements converters.types.Cache
-func (c *k8scache) SwapChangedObjects() *convtypes.ChangedObjects {
+// isDeferred returns true if the changes of class should wait a bit more
+// before being applied.
+func (c *k8scache) isDeferred(class changeClass, now time.Time) bool {
+	changedAt := c.classChangedAt[class]
+	return !changedAt.IsZero() && now.Before(changedAt.Add(c.waitBeforeUpdate[class]))
+}
+
+// pendingSince returns the time of the oldest change that wasn't applied
+// yet, either because it wasn't processed by the converter, or because the
+// update that processed it failed. Returns zero if all the changes were
+// applied.
+func (c *k8scache) pendingSince() time.Time {
+	c.stateMutex.RLock()
+	defer c.stateMutex.RUnlock()
+	if c.swappedAt.IsZero() {
+		return c.changedAt
+	}
+	return c.swappedAt
+}
+
+// changesApplied notifies that the changes processed by the last call
+// to SwapChangedObjects were successfully applied.
+func (c *k8scache) changesApplied() {
 	c.stateMutex.Lock()
 	defer c.stateMutex.Unlock()
-	//
+	c.swappedAt = time.Time{}
+}
+
+// swappedObjects returns the names of the changed objects returned by the
+// last call to SwapChangedObjects.
+func (c *k8scache) swappedObjects() []string {
+	c.stateMutex.RLock()
+	defer c.stateMutex.RUnlock()
+	return c.swapped
+}
+
+// currentGlobalConfig returns the most recent global config, including
+// changes that weren't processed by the converter yet. Used by the dry-run
+// api, which converts proposed resources outside of the sync goroutine.
+func (c *k8scache) currentGlobalConfig() map[string]string {
+	c.stateMutex.RLock()
+	defer c.stateMutex.RUnlock()
+	if c.globalConfigMapDataNew != nil {
+		return c.globalConfigMapDataNew
+	}
+	return c.globalConfigMapData
+}
+
+// PendingChanges lists the changed objects that weren't processed
+// by the converter yet.
+func (c *k8scache) PendingChanges() []string {
+	c.stateMutex.RLock()
+	defer c.stateMutex.RUnlock()
+	return c.buildChangedObjectNames()
+}
+
+func (c *k8scache) buildChangedObjectNames() []string {
 	var obj []string
 	if c.globalConfigMapDataNew != nil && !reflect.DeepEqual(c.globalConfigMapData, c.globalConfigMapDataNew) {
 		obj = append(obj, "update/global")
@@ -835,6 +1542,9 @@ func (c *k8scache) SwapChangedObjects() *convtypes.ChangedObjects {
 	for _, secret := range c.secretsAdd {
 		obj = append(obj, "add/secret:"+secret.Namespace+"/"+secret.Name)
 	}
+	for _, name := range c.externalSecretsUpd {
+		obj = append(obj, "update/secret:"+name)
+	}
 	for _, cm := range c.configMapsDel {
 		obj = append(obj, "del/configmap:"+cm.Namespace+"/"+cm.Name)
 	}
@@ -847,30 +1557,75 @@ func (c *k8scache) SwapChangedObjects() *convtypes.ChangedObjects {
 	for _, pod := range c.podsNew {
 		obj = append(obj, "update/pod:"+pod.Namespace+"/"+pod.Name)
 	}
+	return obj
+}
+
+// buildGlobalChangedKeys returns the sorted list of global config keys that
+// were added, removed or updated since the last sync. Defaults are applied
+// by the converter, which filters out keys whose effective value is the same.
+func (c *k8scache) buildGlobalChangedKeys() []string {
+	cur, new := c.globalConfigMapData, c.globalConfigMapDataNew
+	if new == nil {
+		return nil
+	}
+	var keys []string
+	for key, value := range new {
+		if curValue, found := cur[key]; !found || curValue != value {
+			keys = append(keys, key)
+		}
+	}
+	for key := range cur {
+		if _, found := new[key]; !found {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// implements converters.types.Cache
+func (c *k8scache) SwapChangedObjects() *convtypes.ChangedObjects {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+	//
+	// Config changes usually reload haproxy, so all the other pending
+	// changes are applied as well. Endpoints and secrets are applied
+	// without waiting the config changes, whose batch can be larger.
+	now := time.Now()
+	var deferred [changeClassCount]bool
+	deferred[changeConfig] = c.isDeferred(changeConfig, now)
+	deferred[changeEndpoints] = deferred[changeConfig] && c.isDeferred(changeEndpoints, now)
+	deferred[changeSecrets] = deferred[changeConfig] && c.isDeferred(changeSecrets, now)
+	restore := c.holdChanges(deferred)
+	defer restore()
+	//
+	obj := c.buildChangedObjectNames()
 	//
 	changed := &convtypes.ChangedObjects{
-		GlobalCur:         c.globalConfigMapData,
-		GlobalNew:         c.globalConfigMapDataNew,
-		TCPConfigMapCur:   c.tcpConfigMapData,
-		TCPConfigMapNew:   c.tcpConfigMapDataNew,
-		IngressesDel:      c.ingressesDel,
-		IngressesUpd:      c.ingressesUpd,
-		IngressesAdd:      c.ingressesAdd,
-		IngressClassesDel: c.ingressClassesDel,
-		IngressClassesUpd: c.ingressClassesUpd,
-		IngressClassesAdd: c.ingressClassesAdd,
-		Endpoints:         c.endpointsNew,
-		ServicesDel:       c.servicesDel,
-		ServicesUpd:       c.servicesUpd,
-		ServicesAdd:       c.servicesAdd,
-		SecretsDel:        c.secretsDel,
-		SecretsUpd:        c.secretsUpd,
-		SecretsAdd:        c.secretsAdd,
-		ConfigMapsDel:     c.configMapsDel,
-		ConfigMapsUpd:     c.configMapsUpd,
-		ConfigMapsAdd:     c.configMapsAdd,
-		Pods:              c.podsNew,
-		Objects:           obj,
+		GlobalCur:          c.globalConfigMapData,
+		GlobalNew:          c.globalConfigMapDataNew,
+		GlobalChangedKeys:  c.buildGlobalChangedKeys(),
+		TCPConfigMapCur:    c.tcpConfigMapData,
+		TCPConfigMapNew:    c.tcpConfigMapDataNew,
+		IngressesDel:       c.ingressesDel,
+		IngressesUpd:       c.ingressesUpd,
+		IngressesAdd:       c.ingressesAdd,
+		IngressClassesDel:  c.ingressClassesDel,
+		IngressClassesUpd:  c.ingressClassesUpd,
+		IngressClassesAdd:  c.ingressClassesAdd,
+		Endpoints:          c.endpointsNew,
+		ServicesDel:        c.servicesDel,
+		ServicesUpd:        c.servicesUpd,
+		ServicesAdd:        c.servicesAdd,
+		SecretsDel:         c.secretsDel,
+		SecretsUpd:         c.secretsUpd,
+		SecretsAdd:         c.secretsAdd,
+		ExternalSecretsUpd: c.externalSecretsUpd,
+		ConfigMapsDel:      c.configMapsDel,
+		ConfigMapsUpd:      c.configMapsUpd,
+		ConfigMapsAdd:      c.configMapsAdd,
+		Pods:               c.podsNew,
+		Objects:            obj,
 	}
 	//
 	c.podsNew = nil
@@ -881,6 +1636,7 @@ func (c *k8scache) SwapChangedObjects() *convtypes.ChangedObjects {
 	c.secretsDel = nil
 	c.secretsUpd = nil
 	c.secretsAdd = nil
+	c.externalSecretsUpd = nil
 	//
 	// Services
 	//
@@ -914,11 +1670,91 @@ func (c *k8scache) SwapChangedObjects() *convtypes.ChangedObjects {
 	c.configMapsUpd = nil
 	c.configMapsAdd = nil
 	//
+	var swappedAt, changedAt time.Time
+	for class, classChangedAt := range c.classChangedAt {
+		if deferred[class] {
+			changedAt = oldest(changedAt, classChangedAt)
+		} else {
+			swappedAt = oldest(swappedAt, classChangedAt)
+			c.classChangedAt[class] = time.Time{}
+		}
+	}
+	if changedAt.IsZero() {
+		// nothing deferred, all the changes were swapped
+		swappedAt = c.changedAt
+	}
+	if c.swappedAt.IsZero() {
+		c.swappedAt = swappedAt
+	}
+	c.changedAt = changedAt
+	c.swapped = obj
 	c.clear = true
-	c.needFullSync = false
+	c.notifyAt = time.Time{}
+	if !deferred[changeConfig] {
+		c.needFullSync = false
+	}
+	c.scheduleUpdate()
 	return changed
 }
 
+// holdChanges removes the changes of the deferred classes, so they aren't
+// swapped. The returned func adds them back. Should be called with
+// stateMutex locked.
+func (c *k8scache) holdChanges(deferred [changeClassCount]bool) (restore func()) {
+	var restoreFuncs []func()
+	if deferred[changeConfig] {
+		globalNew, tcpNew := c.globalConfigMapDataNew, c.tcpConfigMapDataNew
+		ingDel, ingUpd, ingAdd := c.ingressesDel, c.ingressesUpd, c.ingressesAdd
+		clsDel, clsUpd, clsAdd := c.ingressClassesDel, c.ingressClassesUpd, c.ingressClassesAdd
+		svcDel, svcUpd, svcAdd := c.servicesDel, c.servicesUpd, c.servicesAdd
+		cmDel, cmUpd, cmAdd := c.configMapsDel, c.configMapsUpd, c.configMapsAdd
+		c.globalConfigMapDataNew, c.tcpConfigMapDataNew = nil, nil
+		c.ingressesDel, c.ingressesUpd, c.ingressesAdd = nil, nil, nil
+		c.ingressClassesDel, c.ingressClassesUpd, c.ingressClassesAdd = nil, nil, nil
+		c.servicesDel, c.servicesUpd, c.servicesAdd = nil, nil, nil
+		c.configMapsDel, c.configMapsUpd, c.configMapsAdd = nil, nil, nil
+		restoreFuncs = append(restoreFuncs, func() {
+			c.globalConfigMapDataNew, c.tcpConfigMapDataNew = globalNew, tcpNew
+			c.ingressesDel, c.ingressesUpd, c.ingressesAdd = ingDel, ingUpd, ingAdd
+			c.ingressClassesDel, c.ingressClassesUpd, c.ingressClassesAdd = clsDel, clsUpd, clsAdd
+			c.servicesDel, c.servicesUpd, c.servicesAdd = svcDel, svcUpd, svcAdd
+			c.configMapsDel, c.configMapsUpd, c.configMapsAdd = cmDel, cmUpd, cmAdd
+		})
+	}
+	if deferred[changeEndpoints] {
+		epNew, podsNew := c.endpointsNew, c.podsNew
+		c.endpointsNew, c.podsNew = nil, nil
+		restoreFuncs = append(restoreFuncs, func() {
+			c.endpointsNew, c.podsNew = epNew, podsNew
+		})
+	}
+	if deferred[changeSecrets] {
+		secretsDel, secretsUpd, secretsAdd, externalUpd := c.secretsDel, c.secretsUpd, c.secretsAdd, c.externalSecretsUpd
+		c.secretsDel, c.secretsUpd, c.secretsAdd, c.externalSecretsUpd = nil, nil, nil, nil
+		restoreFuncs = append(restoreFuncs, func() {
+			c.secretsDel, c.secretsUpd, c.secretsAdd, c.externalSecretsUpd = secretsDel, secretsUpd, secretsAdd, externalUpd
+		})
+	}
+	return func() {
+		for _, f := range restoreFuncs {
+			f()
+		}
+	}
+}
+
+// oldest returns the oldest non zero time.
+func oldest(t1, t2 time.Time) time.Time {
+	if t1.IsZero() || (!t2.IsZero() && t2.Before(t1)) {
+		return t2
+	}
+	return t1
+}
+
+// implements converters.types.Cache
+func (c *k8scache) ScheduleSync(at time.Time) {
+	time.AfterFunc(time.Until(at), func() { c.updateQueue.Notify() })
+}
+
 // implements converters.types.Cache
 func (c *k8scache) NeedFullSync() bool {
 	c.stateMutex.RLock()
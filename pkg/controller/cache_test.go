@@ -17,7 +17,25 @@ limitations under the License.
 package controller
 
 import (
+	"context"
+	"fmt"
+	"reflect"
 	"testing"
+	"time"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	listerscore "k8s.io/client-go/listers/core/v1"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/tracker"
+	types_helper "github.com/jcmoraisjr/haproxy-ingress/pkg/types/helper_test"
 )
 
 func TestGetContentProtocol(t *testing.T) {
@@ -79,3 +97,410 @@ func TestGetContentProtocol(t *testing.T) {
 		}
 	}
 }
+
+func TestPendingChanges(t *testing.T) {
+	c := &k8scache{
+		globalConfigMapDataNew: map[string]string{"syslog-endpoint": "127.0.0.1:514"},
+		ingressesAdd: []*networking.Ingress{
+			{ObjectMeta: meta.ObjectMeta{Namespace: "default", Name: "ing1"}},
+		},
+		servicesDel: []*api.Service{
+			{ObjectMeta: meta.ObjectMeta{Namespace: "default", Name: "svc1"}},
+		},
+	}
+	expected := []string{"update/global", "add/ingress:default/ing1", "del/service:default/svc1"}
+	if pending := c.PendingChanges(); !reflect.DeepEqual(pending, expected) {
+		t.Errorf("pending changes differs, expected %v but was %v", expected, pending)
+	}
+	if changed := c.SwapChangedObjects(); !reflect.DeepEqual(changed.Objects, expected) {
+		t.Errorf("changed objects differs, expected %v but was %v", expected, changed.Objects)
+	}
+	if pending := c.PendingChanges(); pending != nil {
+		t.Errorf("expected empty pending changes after swap, but was %v", pending)
+	}
+}
+
+func TestPendingSince(t *testing.T) {
+	c := &k8scache{}
+	notify := func() time.Time {
+		// clear == false, so a sync isn't enqueued
+		c.clear = false
+		c.notifyExternalSecret("vault/app")
+		return c.changedAt
+	}
+	if since := c.pendingSince(); !since.IsZero() {
+		t.Errorf("expected no pending changes, but was %v", since)
+	}
+	changed1 := notify()
+	if since := c.pendingSince(); since != changed1 {
+		t.Errorf("expected pending since %v, but was %v", changed1, since)
+	}
+	c.SwapChangedObjects()
+	changed2 := notify()
+	if since := c.pendingSince(); since != changed1 {
+		t.Errorf("expected pending since %v while the first change isn't applied, but was %v", changed1, since)
+	}
+	c.changesApplied()
+	if since := c.pendingSince(); since != changed2 {
+		t.Errorf("expected pending since %v after applying the first change, but was %v", changed2, since)
+	}
+	c.SwapChangedObjects()
+	c.changesApplied()
+	if since := c.pendingSince(); !since.IsZero() {
+		t.Errorf("expected no pending changes after applying all of them, but was %v", since)
+	}
+}
+
+func TestSwapChangedObjectsByClass(t *testing.T) {
+	c := &k8scache{
+		waitBeforeUpdate: [changeClassCount]time.Duration{
+			changeConfig:  time.Hour,
+			changeSecrets: time.Hour,
+		},
+	}
+	// clear == false, so a sync isn't enqueued
+	c.Notify(nil, &networking.Ingress{ObjectMeta: meta.ObjectMeta{Namespace: "default", Name: "ing1"}})
+	c.Notify(nil, &api.Endpoints{ObjectMeta: meta.ObjectMeta{Namespace: "default", Name: "svc1"}})
+	c.notifyExternalSecret("vault/app")
+	c.needFullSync = true
+	changedAt := c.changedAt
+	swappedAt := c.classChangedAt[changeEndpoints]
+	testCases := []struct {
+		wait         [changeClassCount]time.Duration
+		expChanged   []string
+		expPending   []string
+		expFullSync  bool
+		expChangedAt bool
+	}{
+		// 0
+		{
+			wait:         [changeClassCount]time.Duration{time.Hour, 0, time.Hour},
+			expChanged:   []string{"update/endpoint:default/svc1"},
+			expPending:   []string{"add/ingress:default/ing1", "update/secret:vault/app"},
+			expFullSync:  true,
+			expChangedAt: true,
+		},
+		// 1
+		{
+			wait:         [changeClassCount]time.Duration{time.Hour, 0, 0},
+			expChanged:   []string{"update/secret:vault/app"},
+			expPending:   []string{"add/ingress:default/ing1"},
+			expFullSync:  true,
+			expChangedAt: true,
+		},
+		// 2
+		{
+			wait:       [changeClassCount]time.Duration{0, time.Hour, time.Hour},
+			expChanged: []string{"add/ingress:default/ing1"},
+		},
+	}
+	for i, test := range testCases {
+		c.waitBeforeUpdate = test.wait
+		changed := c.SwapChangedObjects()
+		if !reflect.DeepEqual(changed.Objects, test.expChanged) {
+			t.Errorf("changed objects differs on %d, expected %v but was %v", i, test.expChanged, changed.Objects)
+		}
+		if pending := c.PendingChanges(); !reflect.DeepEqual(pending, test.expPending) {
+			t.Errorf("pending changes differs on %d, expected %v but was %v", i, test.expPending, pending)
+		}
+		if fullSync := c.NeedFullSync(); fullSync != test.expFullSync {
+			t.Errorf("need full sync differs on %d, expected %v but was %v", i, test.expFullSync, fullSync)
+		}
+		if hasChangedAt := c.changedAt == changedAt; hasChangedAt != test.expChangedAt {
+			t.Errorf("changed at differs on %d, expected %v but was %v", i, test.expChangedAt, hasChangedAt)
+		}
+		if c.swappedAt != swappedAt {
+			t.Errorf("swapped at differs on %d, expected %v but was %v", i, swappedAt, c.swappedAt)
+		}
+	}
+}
+
+func TestSwapChangedObjectsGlobalKeys(t *testing.T) {
+	testCases := []struct {
+		cur     map[string]string
+		new     map[string]string
+		expKeys []string
+	}{
+		// 0
+		{
+			cur: map[string]string{"timeout-client": "1s"},
+			new: nil,
+		},
+		// 1
+		{
+			cur: map[string]string{"timeout-client": "1s"},
+			new: map[string]string{"timeout-client": "1s"},
+		},
+		// 2
+		{
+			cur:     nil,
+			new:     map[string]string{"timeout-client": "1s", "max-connections": "1000"},
+			expKeys: []string{"max-connections", "timeout-client"},
+		},
+		// 3
+		{
+			cur:     map[string]string{"timeout-client": "1s", "max-connections": "1000", "ssl-engine": "rdrand"},
+			new:     map[string]string{"timeout-client": "2s", "max-connections": "1000", "nbthread": "4"},
+			expKeys: []string{"nbthread", "ssl-engine", "timeout-client"},
+		},
+	}
+	for i, test := range testCases {
+		c := &k8scache{
+			globalConfigMapData:    test.cur,
+			globalConfigMapDataNew: test.new,
+		}
+		changed := c.SwapChangedObjects()
+		if !reflect.DeepEqual(changed.GlobalChangedKeys, test.expKeys) {
+			t.Errorf("global changed keys differs on %d, expected %v but was %v", i, test.expKeys, changed.GlobalChangedKeys)
+		}
+	}
+}
+
+func TestNotifyFullSync(t *testing.T) {
+	c := &k8scache{}
+	// clear == false, so a sync isn't enqueued
+	c.Notify(nil, nil)
+	if !c.NeedFullSync() {
+		t.Errorf("expected a full sync after notifying nil objects")
+	}
+	if c.changedAt.IsZero() {
+		t.Errorf("expected a pending change after notifying nil objects")
+	}
+	c.SwapChangedObjects()
+	if c.NeedFullSync() {
+		t.Errorf("expected the full sync to be cleared after swapping the changed objects")
+	}
+}
+
+func TestGlobalConfigMaps(t *testing.T) {
+	cm := func(name string, data map[string]string) *api.ConfigMap {
+		return &api.ConfigMap{ObjectMeta: meta.ObjectMeta{Namespace: "ingress", Name: name}, Data: data}
+	}
+	testCases := []struct {
+		old, cur *api.ConfigMap
+		expected map[string]string
+	}{
+		// 0
+		{
+			cur:      cm("base", map[string]string{"timeout-client": "1m", "ssl-redirect": "false"}),
+			expected: map[string]string{"timeout-client": "1m", "ssl-redirect": "false"},
+		},
+		// 1
+		{
+			cur:      cm("haproxy", map[string]string{"timeout-client": "2m"}),
+			expected: map[string]string{"timeout-client": "2m", "ssl-redirect": "false"},
+		},
+		// 2
+		{
+			old:      cm("base", nil),
+			cur:      cm("base", map[string]string{"timeout-client": "3m"}),
+			expected: map[string]string{"timeout-client": "2m"},
+		},
+		// 3
+		{
+			cur:      cm("other", map[string]string{"timeout-client": "4m"}),
+			expected: map[string]string{"timeout-client": "2m"},
+		},
+		// 4
+		{
+			old:      cm("haproxy", nil),
+			expected: map[string]string{"timeout-client": "3m"},
+		},
+	}
+	c := &k8scache{
+		globalConfigMapKeys: []string{"ingress/base", "ingress/haproxy"},
+		globalConfigMaps:    map[string]map[string]string{},
+	}
+	for i, test := range testCases {
+		if test.old == nil {
+			c.Notify(nil, test.cur)
+		} else if test.cur == nil {
+			c.Notify(test.old, nil)
+		} else {
+			c.Notify(test.old, test.cur)
+		}
+		changed := c.SwapChangedObjects()
+		c.clear = false
+		global := changed.GlobalCur
+		if changed.GlobalNew != nil {
+			global = changed.GlobalNew
+		}
+		if !reflect.DeepEqual(global, test.expected) {
+			t.Errorf("global config differs on %d, expected %v but was %v", i, test.expected, global)
+		}
+	}
+}
+
+func TestGetSecretFiltered(t *testing.T) {
+	secret := &api.Secret{ObjectMeta: meta.ObjectMeta{Namespace: "default", Name: "auth"}}
+	testCases := []struct {
+		filtered bool
+		found    bool
+	}{
+		// 0
+		{
+			filtered: false,
+			found:    false,
+		},
+		// 1
+		{
+			filtered: true,
+			found:    true,
+		},
+	}
+	for i, test := range testCases {
+		client := fake.NewSimpleClientset(secret)
+		logger := types_helper.NewLoggerMock(t)
+		tracker := tracker.NewTracker()
+		c := &k8scache{
+			ctx:     context.Background(),
+			client:  client,
+			tracker: tracker,
+			consul:  newConsulWatcher(logger, nil),
+			files:   newFileWatcher(logger, nil),
+			listers: &listers{
+				secretLister:   listerscore.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})),
+				secretFiltered: test.filtered,
+				running:        true,
+			},
+		}
+		if test.filtered {
+			c.listers.unmatchedSecretWatcher = newLazyWatcher(logger, nil, "secrets", &api.Secret{}, 0, nil,
+				func(namespace, name string) (runtime.Object, error) {
+					return client.CoreV1().Secrets(namespace).Get(context.Background(), name, meta.GetOptions{})
+				}, cache.ResourceEventHandlerFuncs{})
+		}
+		_, err := c.GetSecret("default/auth")
+		if found := err == nil; found != test.found {
+			t.Errorf("secret found differs on %d, expected %v but was %v: %v", i, test.found, found, err)
+		}
+		if !test.filtered {
+			continue
+		}
+		watcher := c.listers.unmatchedSecretWatcher
+		if _, watched := watcher.watches["default/auth"]; !watched {
+			t.Errorf("expected secret watched on %d", i)
+		}
+		// read since the last collect
+		c.collectLazyWatches()
+		if _, watched := watcher.watches["default/auth"]; !watched {
+			t.Errorf("expected secret still watched after the first collect on %d", i)
+		}
+		// neither read nor tracked
+		c.collectLazyWatches()
+		if _, watched := watcher.watches["default/auth"]; watched {
+			t.Errorf("expected secret not watched after the second collect on %d", i)
+		}
+	}
+}
+
+func TestCreateOrUpdateSecret(t *testing.T) {
+	secret := func(data string) *api.Secret {
+		return &api.Secret{
+			ObjectMeta: meta.ObjectMeta{Namespace: "default", Name: "acme"},
+			Data:       map[string][]byte{"tls.key": []byte(data)},
+		}
+	}
+	testCases := []struct {
+		existing  string
+		createErr bool
+		updateErr bool
+		expData   string
+	}{
+		// 0
+		{
+			expData: "key2",
+		},
+		// 1
+		{
+			existing: "key1",
+			expData:  "key2",
+		},
+		// 2 - created by another replica after the missing secret was read
+		{
+			createErr: true,
+			expData:   "key2",
+		},
+		// 3 - changed by another replica after the secret was read
+		{
+			existing:  "key1",
+			updateErr: true,
+			expData:   "key2",
+		},
+	}
+	for i, test := range testCases {
+		client := fake.NewSimpleClientset()
+		if test.existing != "" {
+			_ = client.Tracker().Add(secret(test.existing))
+		}
+		resource := schema.GroupResource{Resource: "secrets"}
+		client.PrependReactor("create", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if !test.createErr {
+				return false, nil, nil
+			}
+			test.createErr = false
+			_ = client.Tracker().Add(secret("key1"))
+			return true, nil, k8serrors.NewAlreadyExists(resource, "acme")
+		})
+		client.PrependReactor("update", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if !test.updateErr {
+				return false, nil, nil
+			}
+			test.updateErr = false
+			return true, nil, k8serrors.NewConflict(resource, "acme", fmt.Errorf("object was modified"))
+		})
+		c := &k8scache{ctx: context.Background(), client: client}
+		if err := c.CreateOrUpdateSecret(secret(test.expData)); err != nil {
+			t.Errorf("%d: error writing secret: %v", i, err)
+			continue
+		}
+		cur, err := client.CoreV1().Secrets("default").Get(c.ctx, "acme", meta.GetOptions{})
+		if err != nil {
+			t.Errorf("%d: error reading secret: %v", i, err)
+			continue
+		}
+		if data := string(cur.Data["tls.key"]); data != test.expData {
+			t.Errorf("%d: expected data '%s' but was '%s'", i, test.expData, data)
+		}
+	}
+}
+
+func TestSetToken(t *testing.T) {
+	client := fake.NewSimpleClientset(&api.ConfigMap{
+		ObjectMeta: meta.ObjectMeta{Namespace: "ingress", Name: "acme-token"},
+		Data:       map[string]string{"d1.local": "/uri1=token1"},
+	})
+	// another replica adds its token after the configmap was read
+	conflict := true
+	client.PrependReactor("update", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if !conflict {
+			return false, nil, nil
+		}
+		conflict = false
+		gvr := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+		obj, _ := client.Tracker().Get(gvr, "ingress", "acme-token")
+		cm := obj.(*api.ConfigMap)
+		cm.Data["d2.local"] = "/uri2=token2"
+		_ = client.Tracker().Update(gvr, cm, "ingress")
+		return true, nil, k8serrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, "acme-token", fmt.Errorf("object was modified"))
+	})
+	c := &k8scache{
+		ctx:                    context.Background(),
+		client:                 client,
+		acmeTokenConfigmapName: "ingress/acme-token",
+	}
+	if err := c.SetToken("d3.local", "/uri3", "token3"); err != nil {
+		t.Fatalf("error setting token: %v", err)
+	}
+	if err := c.SetToken("d1.local", "/uri1", ""); err != nil {
+		t.Fatalf("error removing token: %v", err)
+	}
+	cm, err := client.CoreV1().ConfigMaps("ingress").Get(c.ctx, "acme-token", meta.GetOptions{})
+	if err != nil {
+		t.Fatalf("error reading configmap: %v", err)
+	}
+	expected := map[string]string{"d2.local": "/uri2=token2", "d3.local": "/uri3=token3"}
+	if !reflect.DeepEqual(cm.Data, expected) {
+		t.Errorf("expected tokens %v but was %v", expected, cm.Data)
+	}
+}
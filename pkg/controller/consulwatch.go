@@ -0,0 +1,261 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	convtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/types"
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/types"
+)
+
+// consulWatcher reads the healthy endpoints of Consul services, starting
+// a blocking query for each service after it's read for the first time.
+// Kubernetes services that read a Consul service are notified when its
+// endpoints change.
+type consulWatcher struct {
+	logger  types.Logger
+	client  *http.Client
+	wait    time.Duration
+	retry   time.Duration
+	notify  func(service string)
+	mutex   sync.Mutex
+	stopCh  <-chan struct{}
+	watches map[string]*consulWatch
+}
+
+type consulWatch struct {
+	address   string
+	service   string
+	index     string
+	endpoints []convtypes.ExternalEndpoint
+	// kubernetes services, namespace/name, and if it was read since the last collect
+	services map[string]bool
+	cancel   context.CancelFunc
+}
+
+type consulServiceEntry struct {
+	Node struct {
+		Address string
+	}
+	Service struct {
+		ID      string
+		Address string
+		Port    int
+	}
+}
+
+func newConsulWatcher(logger types.Logger, notify func(service string)) *consulWatcher {
+	wait := 5 * time.Minute
+	return &consulWatcher{
+		logger: logger,
+		// consul adds a random jitter of up to wait/16 to the blocking query
+		client:  &http.Client{Timeout: wait + wait/16 + 10*time.Second},
+		wait:    wait,
+		retry:   5 * time.Second,
+		notify:  notify,
+		watches: map[string]*consulWatch{},
+	}
+}
+
+// Run starts the watches registered before the watcher was running, and
+// stops all the watches when stopCh is closed.
+func (w *consulWatcher) Run(stopCh <-chan struct{}) {
+	w.mutex.Lock()
+	w.stopCh = stopCh
+	for _, watch := range w.watches {
+		w.startWatch(watch)
+	}
+	w.mutex.Unlock()
+	go func() {
+		<-stopCh
+		w.mutex.Lock()
+		defer w.mutex.Unlock()
+		for _, watch := range w.watches {
+			w.stopWatch(watch)
+		}
+	}()
+}
+
+// Get returns the healthy endpoints of a Consul service, reading it from
+// the Consul agent and starting its watch if the service is not being
+// watched yet. service is the kubernetes service, namespace/name, that
+// should be notified on changes.
+func (w *consulWatcher) Get(address, consulService, service string) ([]convtypes.ExternalEndpoint, error) {
+	key := address + "|" + consulService
+	w.mutex.Lock()
+	if watch, found := w.watches[key]; found {
+		watch.services[service] = true
+		endpoints := watch.endpoints
+		w.mutex.Unlock()
+		return endpoints, nil
+	}
+	w.mutex.Unlock()
+	endpoints, index, err := w.fetch(context.Background(), address, consulService, "")
+	if err != nil {
+		return nil, err
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	watch, found := w.watches[key]
+	if !found {
+		watch = &consulWatch{
+			address:   address,
+			service:   consulService,
+			index:     index,
+			endpoints: endpoints,
+			services:  map[string]bool{},
+		}
+		w.watches[key] = watch
+		if w.stopCh != nil {
+			w.startWatch(watch)
+		}
+	}
+	watch.services[service] = true
+	return watch.endpoints, nil
+}
+
+// Collect removes the kubernetes services that didn't read a Consul
+// service since the last call, and whose keep func returns false. Consul
+// services without any kubernetes service are not watched anymore.
+func (w *consulWatcher) Collect(keep func(service string) bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for key, watch := range w.watches {
+		for service, read := range watch.services {
+			if !read && !keep(service) {
+				delete(watch.services, service)
+			} else {
+				watch.services[service] = false
+			}
+		}
+		if len(watch.services) == 0 {
+			w.logger.InfoV(2, "stopping watch of consul service %s", watch.service)
+			w.stopWatch(watch)
+			delete(w.watches, key)
+		}
+	}
+}
+
+func (w *consulWatcher) startWatch(watch *consulWatch) {
+	w.logger.InfoV(2, "starting watch of consul service %s", watch.service)
+	ctx, cancel := context.WithCancel(context.Background())
+	watch.cancel = cancel
+	go w.watchLoop(ctx, watch)
+}
+
+func (w *consulWatcher) stopWatch(watch *consulWatch) {
+	if watch.cancel != nil {
+		watch.cancel()
+		watch.cancel = nil
+	}
+}
+
+func (w *consulWatcher) watchLoop(ctx context.Context, watch *consulWatch) {
+	w.mutex.Lock()
+	index := watch.index
+	w.mutex.Unlock()
+	for {
+		endpoints, newIndex, err := w.fetch(ctx, watch.address, watch.service, index)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			w.logger.Warn("error watching consul service %s: %v", watch.service, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(w.retry):
+			}
+			continue
+		}
+		if newIndex == index {
+			// wait timeout, nothing changed
+			continue
+		}
+		index = newIndex
+		w.mutex.Lock()
+		changed := !reflect.DeepEqual(watch.endpoints, endpoints)
+		watch.index = index
+		watch.endpoints = endpoints
+		services := make([]string, 0, len(watch.services))
+		for service := range watch.services {
+			services = append(services, service)
+		}
+		w.mutex.Unlock()
+		if changed {
+			w.logger.InfoV(2, "consul service %s changed, %d healthy endpoint(s)", watch.service, len(endpoints))
+			for _, service := range services {
+				w.notify(service)
+			}
+		}
+	}
+}
+
+// fetch reads the healthy endpoints of a Consul service. A non empty index
+// blocks the request until the service changes or the wait time expires.
+func (w *consulWatcher) fetch(ctx context.Context, address, consulService, index string) ([]convtypes.ExternalEndpoint, string, error) {
+	query := url.Values{"passing": {"true"}}
+	if index != "" {
+		query.Set("index", index)
+		query.Set("wait", w.wait.String())
+	}
+	u := strings.TrimSuffix(address, "/") + "/v1/health/service/" + url.PathEscape(consulService) + "?" + query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	res, err := w.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("consul returned %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var entries []consulServiceEntry
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, "", fmt.Errorf("cannot parse consul response: %w", err)
+	}
+	endpoints := make([]convtypes.ExternalEndpoint, 0, len(entries))
+	for _, entry := range entries {
+		ip := entry.Service.Address
+		if ip == "" {
+			ip = entry.Node.Address
+		}
+		endpoints = append(endpoints, convtypes.ExternalEndpoint{
+			IP:   ip,
+			Port: entry.Service.Port,
+			ID:   entry.Service.ID,
+		})
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].ID < endpoints[j].ID
+	})
+	return endpoints, res.Header.Get("X-Consul-Index"), nil
+}
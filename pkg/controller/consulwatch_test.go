@@ -0,0 +1,133 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	convtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/types"
+	types_helper "github.com/jcmoraisjr/haproxy-ingress/pkg/types/helper_test"
+)
+
+func TestConsulWatcher(t *testing.T) {
+	var mutex sync.Mutex
+	index := 10
+	entries := `[{"Node":{"Address":"10.0.0.1"},"Service":{"ID":"echo-1","Address":"","Port":8080}}]`
+	changed := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/health/service/echo" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		mutex.Lock()
+		current := r.URL.Query().Get("index") == strconv.Itoa(index)
+		ch := changed
+		mutex.Unlock()
+		if current {
+			select {
+			case <-ch:
+			case <-time.After(200 * time.Millisecond):
+			}
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		w.Header().Set("X-Consul-Index", strconv.Itoa(index))
+		fmt.Fprint(w, entries)
+	}))
+	defer server.Close()
+	setEntries := func(newEntries string) {
+		mutex.Lock()
+		index++
+		entries = newEntries
+		close(changed)
+		changed = make(chan struct{})
+		mutex.Unlock()
+	}
+
+	logger := types_helper.NewLoggerMock(t)
+	var notifyMutex sync.Mutex
+	var notified []string
+	w := newConsulWatcher(logger, func(service string) {
+		notifyMutex.Lock()
+		defer notifyMutex.Unlock()
+		notified = append(notified, service)
+	})
+	w.wait = 200 * time.Millisecond
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	w.Run(stopCh)
+
+	endpoints, err := w.Get(server.URL, "echo", "default/echo1")
+	if err != nil {
+		t.Errorf("unexpected error reading consul service: %v", err)
+	}
+	expected := []convtypes.ExternalEndpoint{{IP: "10.0.0.1", Port: 8080, ID: "echo-1"}}
+	if !reflect.DeepEqual(endpoints, expected) {
+		t.Errorf("endpoints differ, expected %v but was %v", expected, endpoints)
+	}
+	_, _ = w.Get(server.URL, "echo", "default/echo2")
+	if _, err := w.Get(server.URL, "missing", "default/echo3"); err == nil {
+		t.Errorf("expected error reading a missing consul service")
+	}
+
+	// consul service changed, both kubernetes services should be notified
+	setEntries(`[{"Node":{"Address":"10.0.0.1"},"Service":{"ID":"echo-2","Address":"10.0.1.2","Port":8080}}]`)
+	time.Sleep(100 * time.Millisecond)
+	notifyMutex.Lock()
+	if len(notified) != 2 {
+		t.Errorf("expected 2 notifications but was %v", notified)
+	}
+	notified = nil
+	notifyMutex.Unlock()
+
+	// echo2 isn't read and tracked anymore
+	w.Collect(func(service string) bool { return false })
+	endpoints, _ = w.Get(server.URL, "echo", "default/echo1")
+	expected = []convtypes.ExternalEndpoint{{IP: "10.0.1.2", Port: 8080, ID: "echo-2"}}
+	if !reflect.DeepEqual(endpoints, expected) {
+		t.Errorf("endpoints differ, expected %v but was %v", expected, endpoints)
+	}
+	w.Collect(func(service string) bool { return false })
+	setEntries(`[]`)
+	time.Sleep(100 * time.Millisecond)
+	notifyMutex.Lock()
+	if expected := []string{"default/echo1"}; !reflect.DeepEqual(notified, expected) {
+		t.Errorf("notifications differ, expected %v but was %v", expected, notified)
+	}
+	notifyMutex.Unlock()
+
+	// echo1 isn't read and tracked anymore
+	w.Collect(func(service string) bool { return false })
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if len(w.watches) != 0 {
+		t.Errorf("expected all watches to be stopped")
+	}
+
+	logger.CompareLogging(`
+INFO-V(2) starting watch of consul service echo
+INFO-V(2) consul service echo changed, 1 healthy endpoint(s)
+INFO-V(2) consul service echo changed, 0 healthy endpoint(s)
+INFO-V(2) stopping watch of consul service echo`)
+}
@@ -18,14 +18,22 @@ package controller
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/pflag"
 	api "k8s.io/api/core/v1"
 	networking "k8s.io/api/networking/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/util/wait"
 
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/acme"
@@ -37,7 +45,11 @@ import (
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/tracker"
 	ingtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/types"
 	convtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/types"
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/extauthz"
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy"
+	hatypes "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/types"
+	hautils "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/utils"
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/syslog"
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/types"
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/utils"
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/version"
@@ -49,11 +61,21 @@ type HAProxyController struct {
 	logger            *logger
 	cache             *k8scache
 	metrics           *metrics
+	statsExporter     *statsExporter
+	debugMutex        sync.Mutex
+	debugTracker      map[string]map[string][]string
+	audit             *auditLog
+	servers           serverPods
+	janitor           *acmeJanitor
+	conditions        *conditionsReporter
+	drift             driftCheck
+	defaultPages      *defaultPages
 	tracker           convtypes.Tracker
 	stopCh            chan struct{}
 	ingressQueue      utils.Queue
 	acmeQueue         utils.Queue
 	leaderelector     types.LeaderElector
+	work              types.WorkDistribution
 	updateCount       int
 	controller        *controller.GenericController
 	cfg               *controller.Configuration
@@ -98,37 +120,86 @@ func (hc *HAProxyController) configController() {
 	hc.cfg = hc.controller.GetConfig()
 	hc.stopCh = hc.controller.GetStopCh()
 	hc.controller.SetNewCtrl(hc)
-	hc.logger = &logger{depth: 1}
+	hc.logger = &logger{depth: 1, json: hc.cfg.LogFormat == "json"}
+	hc.work = controllerRole(hc.cfg.ControllerRole)
 	hc.metrics = createMetrics(hc.cfg.BucketsResponseTime)
+	if hc.cfg.ExportHAProxyStats {
+		hc.statsExporter = createStatsExporter()
+		prometheus.MustRegister(hc.statsExporter)
+	}
 	hc.ingressQueue = utils.NewRateLimitingQueue(hc.cfg.RateLimitUpdate, hc.syncIngress)
 	hc.tracker = tracker.NewTracker()
 	hc.cache = createCache(
 		hc.logger, hc.cfg.Client, hc.controller, hc.tracker, hc.ingressQueue,
 		hc.cfg.WatchNamespace, hc.cfg.ForceNamespaceIsolation,
 		hc.cfg.DisablePodList,
-		hc.cfg.ResyncPeriod,
-		hc.cfg.WaitBeforeUpdate,
 	)
+	hc.metrics.setPendingSince(hc.cache.pendingSince)
+	if hc.cfg.AuditLog != "" {
+		audit, err := createAuditLog(hc.cfg.AuditLog, hc.cfg.AuditLogSize)
+		if err != nil {
+			glog.Fatalf("error reading audit log: %v", err)
+		}
+		hc.audit = audit
+	}
+	var defaultPagesAddress string
+	if hc.cfg.DefaultPagesConfigMap != "" && hc.cfg.DefaultService == "" {
+		hc.defaultPages = &defaultPages{}
+		defaultPagesAddress = hc.cfg.DefaultPagesAddress
+	}
 	var acmeSigner acme.Signer
-	if hc.cfg.AcmeServer {
+	if hc.cfg.AcmeServer && hc.work.LeaderWork() {
 		electorID := fmt.Sprintf("%s-%s", hc.cfg.AcmeElectionID, hc.cfg.IngressClass)
 		hc.leaderelector = NewLeaderElector(electorID, hc.logger, hc.cache, hc)
-		acmeSigner = acme.NewSigner(hc.logger, hc.cache, hc.metrics)
-		hc.acmeQueue = utils.NewFailureRateLimitingQueue(
-			hc.cfg.AcmeFailInitialDuration,
-			hc.cfg.AcmeFailMaxDuration,
-			acmeSigner.Notify,
-		)
+		acmeSigner = acme.NewSigner(hc.logger, hc.cache, hc.metrics, acme.SignerOptions{
+			DNSPrecheck: hc.cfg.AcmeDNSPrecheck,
+		})
+		hc.acmeQueue = acme.NewQueue(hc.logger, hc.cache, hc.metrics, acme.QueueOptions{
+			FailInitialWait: hc.cfg.AcmeFailInitialDuration,
+			FailMaxWait:     hc.cfg.AcmeFailMaxDuration,
+			MaxConcurrent:   hc.cfg.AcmeMaxConcurrentOrders,
+		}, acmeSigner.Notify)
+		if hc.cfg.AcmeCleanupPeriod > 0 {
+			hc.janitor = &acmeJanitor{
+				logger:       hc.logger,
+				client:       hc.cfg.Client,
+				namespace:    hc.cfg.WatchNamespace,
+				controllerID: hc.cache.controllerID,
+				ingresses:    hc.cache.GetIngressList,
+			}
+		}
+	}
+	haproxyFileDirs := []string{
+		"/etc/haproxy",
+		ingress.DefaultCrtDirectory,
+		ingress.DefaultDHParamDirectory,
+		ingress.DefaultCACertsDirectory,
+		ingress.DefaultCrlDirectory,
 	}
 	instanceOptions := haproxy.InstanceOptions{
+		ApplyMode:         hc.cfg.ApplyMode,
+		DataplaneURLs:     hc.cfg.DataplaneEndpoints,
+		DataplaneStorage:  hc.cfg.DataplaneStorageDir,
+		Distribute:        hc.cfg.DistributionAddress != "",
 		HAProxyCfgDir:     "/etc/haproxy",
+		HAProxyFileDirs:   haproxyFileDirs,
 		HAProxyMapsDir:    ingress.DefaultMapsDirectory,
+		HealthzReloadFail: hc.cfg.HealthzReloadFailures,
+		UnhealthyWithdraw: hc.cfg.WithdrawUnhealthy,
 		BackendShards:     hc.cfg.BackendShards,
+		ControlOnly:       !hc.work.ProxyWork(),
 		AcmeSigner:        acmeSigner,
 		AcmeQueue:         hc.acmeQueue,
 		LeaderElector:     hc.leaderelector,
 		Metrics:           hc.metrics,
 		ReloadStrategy:    *hc.reloadStrategy,
+		RenderWorkers:     hc.cfg.RenderWorkers,
+		RollbackDir:       "/var/lib/haproxy/rollback",
+		RollbackFailures:  hc.cfg.RollbackFailures,
+		RollbackNotify: func(message string) {
+			hc.cache.recordControllerWarning("ConfigurationRollback", message)
+		},
+		SnapshotDir:       hc.cfg.StateSnapshotDir,
 		MaxOldConfigFiles: *hc.maxOldConfigFiles,
 		SortEndpointsBy:   hc.cfg.SortEndpointsBy,
 		StopCh:            hc.stopCh,
@@ -138,46 +209,259 @@ func (hc *HAProxyController) configController() {
 	if err := hc.instance.ParseTemplates(); err != nil {
 		glog.Fatalf("error creating HAProxy instance: %v", err)
 	}
+	// an external or remote haproxy, or the replicas, read the restored files by their own
+	embedded := hc.cfg.MasterSocket == "" && len(hc.cfg.DataplaneEndpoints) == 0 && hc.cfg.DistributionAddress == "" && hc.work.ProxyWork()
+	if err := hc.instance.RestoreSnapshot(embedded); err != nil {
+		hc.logger.Warn("cannot restore the configuration snapshot: %v", err)
+	}
+	// capabilities of an external or remote haproxy are unknown, converters assume all the features as available
+	var capabilities *hatypes.Capabilities
+	if embedded {
+		var err error
+		if capabilities, err = hautils.HAProxyCapabilities(); err != nil {
+			hc.logger.Warn("cannot read haproxy capabilities, assuming all the features as available: %v", err)
+		} else {
+			hc.logger.Info("haproxy capabilities: %s", capabilities)
+			if !capabilities.Lua {
+				hc.logger.Error("haproxy was built without Lua support, which is required by the configuration template")
+			}
+		}
+	}
+	if hc.cfg.ReportIngressConditions {
+		hc.conditions = &conditionsReporter{
+			isLeader: hc.controller.IsStatusLeader,
+			record:   hc.cache.recordIngressEvent,
+		}
+	}
 	hc.converterOptions = &ingtypes.ConverterOptions{
-		Logger:           hc.logger,
+		Logger: &eventLogger{
+			logger:        &logger{depth: 2, json: hc.logger.json},
+			recordWarning: hc.cache.recordIngressWarning,
+		},
 		Cache:            hc.cache,
 		Tracker:          hc.tracker,
+		Metrics:          hc.metrics,
 		MasterSocket:     hc.cfg.MasterSocket,
-		AnnotationPrefix: hc.cfg.AnnPrefix,
+		RemoteHAProxy:    len(hc.cfg.DataplaneEndpoints) > 0 || hc.cfg.DistributionAddress != "",
+		Capabilities:     capabilities,
+		SyslogListener:   hc.cfg.SyslogListener,
+		AnnotationPrefix: utils.Split(hc.cfg.AnnPrefix, ","),
 		DefaultBackend:   hc.cfg.DefaultService,
+		DefaultPages:     defaultPagesAddress,
 		DefaultCrtSecret: hc.cfg.DefaultSSLCertificate,
 		FakeCrtFile:      hc.createFakeCrtFile(),
 		FakeCAFile:       hc.createFakeCAFile(),
 		AcmeTrackTLSAnn:  hc.cfg.AcmeTrackTLSAnn,
+		NamespaceConfig:  hc.cfg.NamespaceConfigMapName,
+		TranslateNginx:   hc.cfg.TranslateNginxAnn,
 	}
 }
 
 func (hc *HAProxyController) startServices() {
 	hc.cache.RunAsync(hc.stopCh)
 	go hc.ingressQueue.Run()
-	if hc.cfg.StatsCollectProcPeriod.Milliseconds() > 0 {
+	if hc.cfg.StatsCollectProcPeriod.Milliseconds() > 0 && hc.work.ProxyWork() {
 		go wait.Until(func() {
 			hc.instance.CalcIdleMetric()
+			hc.instance.CalcServersDownMetric()
+			if hc.statsExporter != nil {
+				hc.updateStatsExporter()
+			}
 		}, hc.cfg.StatsCollectProcPeriod, hc.stopCh)
 	}
+	if hc.cfg.DriftCheckInterval > 0 && hc.work.ProxyWork() {
+		go wait.Until(hc.checkDrift, hc.cfg.DriftCheckInterval, hc.stopCh)
+	}
 	if hc.leaderelector != nil {
 		go hc.leaderelector.Run(hc.stopCh)
 	}
-	if hc.cfg.AcmeServer {
+	if hc.cfg.SyslogListener != "" {
+		listener := syslog.NewListener(hc.logger, syslog.Options{
+			Address:     hc.cfg.SyslogListener,
+			Exclude:     hc.cfg.SyslogExclude,
+			SampleRatio: hc.cfg.SyslogSampleRatio,
+		})
+		if err := listener.Listen(hc.stopCh); err != nil {
+			hc.logger.Fatal("error creating the syslog listener: %v", err)
+		}
+	}
+	if hc.cfg.ExtAuthzListener != "" {
+		agent := extauthz.NewAgent(hc.logger, extauthz.Options{
+			Address: hc.cfg.ExtAuthzListener,
+			Target:  hc.cfg.ExtAuthzTarget,
+			Timeout: hc.cfg.ExtAuthzTimeout,
+			CA:      hc.cfg.ExtAuthzCA,
+			TLSCert: hc.cfg.ExtAuthzTLSCert,
+			TLSKey:  hc.cfg.ExtAuthzTLSKey,
+		})
+		if err := agent.Listen(hc.stopCh); err != nil {
+			hc.logger.Fatal("error creating the ext-authz agent: %v", err)
+		}
+	}
+	if hc.cfg.AcmeServer && hc.work.ProxyWork() {
 		// TODO deduplicate acme socket
 		server := acme.NewServer(hc.logger, "/var/run/haproxy/acme.sock", hc.cache)
 		// TODO move goroutine from the server to the controller
 		if err := server.Listen(hc.stopCh); err != nil {
 			hc.logger.Fatal("error creating the acme server listener: %v", err)
 		}
+	}
+	if hc.acmeQueue != nil {
+		// challenges are answered by the proxy instances, certificates
+		// are issued by the control instances
 		go hc.acmeQueue.Run()
 		go wait.JitterUntil(func() {
 			_, _ = hc.instance.AcmeCheck("periodic check")
 		}, hc.cfg.AcmeCheckPeriod, 0, false, hc.stopCh)
+		if hc.janitor != nil {
+			go wait.Until(func() {
+				if hc.leaderelector.IsLeader() {
+					hc.janitor.cleanup(context.Background())
+				}
+			}, hc.cfg.AcmeCleanupPeriod, hc.stopCh)
+		}
+	}
+	if hc.cfg.DistributionAddress != "" {
+		if err := hc.startDistribution(); err != nil {
+			hc.logger.Fatal("error starting the distribution api: %v", err)
+		}
+	}
+	if hc.cfg.DryRunAddress != "" {
+		if err := hc.startDryRun(); err != nil {
+			hc.logger.Fatal("error starting the dry-run api: %v", err)
+		}
+	}
+	if hc.cfg.RuntimeAPIAddress != "" {
+		if err := hc.startRuntimeAPI(); err != nil {
+			hc.logger.Fatal("error starting the runtime api: %v", err)
+		}
+	}
+	if hc.defaultPages != nil {
+		if err := hc.startDefaultPages(); err != nil {
+			hc.logger.Fatal("error starting the default backend pages: %v", err)
+		}
 	}
 	hc.controller.StartAsync()
 }
 
+// startDistribution starts the api used by the haproxy replicas to read
+// the configuration files. Replicas must present a client certificate
+// signed by the configured CA, because private keys are also distributed.
+func (hc *HAProxyController) startDistribution() error {
+	return hc.startTLSServer("distribution api", hc.cfg.DistributionAddress,
+		hc.cfg.DistributionTLSCert, hc.cfg.DistributionTLSKey, hc.cfg.DistributionClientCA,
+		hc.instance.DistributionHandler())
+}
+
+// startDryRun starts the dry-run api, which converts proposed ingress
+// resources against the current state of the cluster.
+func (hc *HAProxyController) startDryRun() error {
+	handler := &dryRun{
+		options:      hc.converterOptions,
+		metrics:      noopMetrics{},
+		globalConfig: hc.cache.currentGlobalConfig,
+		templatesCM:  hc.cfg.TemplateConfigMapName,
+	}
+	return hc.startTLSServer("dry-run api", hc.cfg.DryRunAddress,
+		hc.cfg.DryRunTLSCert, hc.cfg.DryRunTLSKey, hc.cfg.DryRunClientCA,
+		handler)
+}
+
+// startRuntimeAPI starts the api that exposes a restricted subset of the
+// haproxy runtime API commands.
+func (hc *HAProxyController) startRuntimeAPI() error {
+	handler := &runtimeAPI{
+		logger:      hc.logger,
+		setPodState: hc.setPodState,
+		resync:      hc.Resync,
+		command: func(cmd string) (string, error) {
+			out, err := hautils.HAProxyCommand(hc.instance.Config().Global().AdminSocket, nil, cmd)
+			if err != nil {
+				return "", err
+			}
+			return out[0], nil
+		},
+	}
+	return hc.startTLSServer("runtime api", hc.cfg.RuntimeAPIAddress,
+		hc.cfg.RuntimeAPITLSCert, hc.cfg.RuntimeAPITLSKey, hc.cfg.RuntimeAPIClientCA,
+		handler)
+}
+
+// startDefaultPages starts the server of the pages used as the default
+// backend. haproxy is the only client, so it doesn't use TLS.
+func (hc *HAProxyController) startDefaultPages() error {
+	server := &http.Server{
+		Addr:    hc.cfg.DefaultPagesAddress,
+		Handler: hc.defaultPages,
+	}
+	l, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return err
+	}
+	hc.logger.Info("default backend pages listening on %s", server.Addr)
+	go func() {
+		if err := server.Serve(l); err != nil && err != http.ErrServerClosed {
+			hc.logger.Error("error serving the default backend pages: %v", err)
+		}
+	}()
+	go func() {
+		<-hc.stopCh
+		_ = server.Close()
+	}()
+	return nil
+}
+
+// startTLSServer serves handler on address, requiring a client certificate
+// signed by one of the CAs of the clientCA file.
+func (hc *HAProxyController) startTLSServer(name, address, tlsCert, tlsKey, clientCA string, handler http.Handler) error {
+	crt, err := tls.LoadX509KeyPair(tlsCert, tlsKey)
+	if err != nil {
+		return err
+	}
+	ca, err := ioutil.ReadFile(clientCA)
+	if err != nil {
+		return err
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(ca) {
+		return fmt.Errorf("no valid certificate found in %s", clientCA)
+	}
+	server := &http.Server{
+		Addr:    address,
+		Handler: handler,
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{crt},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    clientCAs,
+			MinVersion:   tls.VersionTLS12,
+		},
+	}
+	l, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return err
+	}
+	hc.logger.Info("%s listening on %s", name, server.Addr)
+	go func() {
+		if err := server.ServeTLS(l, "", ""); err != nil && err != http.ErrServerClosed {
+			hc.logger.Error("error serving the %s: %v", name, err)
+		}
+	}()
+	go func() {
+		<-hc.stopCh
+		_ = server.Close()
+	}()
+	return nil
+}
+
+func (hc *HAProxyController) updateStatsExporter() {
+	stats, err := hc.instance.ReadStats()
+	if err != nil {
+		hc.logger.Error("error reading haproxy stats: %v", err)
+		return
+	}
+	hc.statsExporter.UpdateStats(stats)
+}
+
 func (hc *HAProxyController) stopServices() {
 	hc.ingressQueue.ShutDown()
 	if hc.acmeQueue != nil {
@@ -213,6 +497,73 @@ func (hc *HAProxyController) AcmeCheck() (int, error) {
 	return hc.instance.AcmeCheck("external call")
 }
 
+// DebugCache ...
+// implements ingress.Controller
+func (hc *HAProxyController) DebugCache() interface{} {
+	hc.debugMutex.Lock()
+	defer hc.debugMutex.Unlock()
+	return struct {
+		NeedFullSync   bool                           `json:"needFullSync"`
+		PendingChanges []string                       `json:"pendingChanges"`
+		Tracker        map[string]map[string][]string `json:"tracker"`
+	}{
+		NeedFullSync:   hc.cache.NeedFullSync(),
+		PendingChanges: hc.cache.PendingChanges(),
+		Tracker:        hc.debugTracker,
+	}
+}
+
+// AuditLog ...
+// implements ingress.Controller
+func (hc *HAProxyController) AuditLog() interface{} {
+	if hc.audit == nil {
+		return nil
+	}
+	return hc.audit.list()
+}
+
+// ServersState ...
+// implements ingress.Controller
+func (hc *HAProxyController) ServersState() (interface{}, error) {
+	states, err := hautils.HAProxyServersState(hc.instance.Config().Global().AdminSocket, "")
+	if err != nil {
+		return nil, err
+	}
+	return hc.servers.buildServersState(states), nil
+}
+
+// setPodState changes the state of all the backend servers of a pod in the
+// running haproxy, used by the runtime api.
+func (hc *HAProxyController) setPodState(pod, state string) ([]string, error) {
+	socket := hc.instance.Config().Global().AdminSocket
+	servers, err := hc.servers.setPodState(pod, state, func(cmd ...string) ([]string, error) {
+		return hautils.HAProxyCommand(socket, nil, cmd...)
+	})
+	if len(servers) > 0 {
+		hc.logger.Info("changed state of pod %s to %s: %s", pod, state, strings.Join(servers, ","))
+	}
+	return servers, err
+}
+
+// Resync starts a full synchronization of the haproxy configuration, used
+// by the runtime api and on SIGUSR1.
+func (hc *HAProxyController) Resync() {
+	if hc.cache == nil {
+		// requested before the controller was started, the first
+		// sync is always a full one
+		return
+	}
+	hc.logger.Info("starting a full resync on request")
+	// nil objects force a full sync
+	hc.cache.Notify(nil, nil)
+}
+
+// HAProxyConfig ...
+// implements ingress.Controller
+func (hc *HAProxyController) HAProxyConfig() ([]byte, error) {
+	return hc.instance.ReadConfig()
+}
+
 // OnStartedLeading ...
 // implements LeaderSubscriber
 func (hc *HAProxyController) OnStartedLeading(ctx context.Context) {
@@ -233,11 +584,20 @@ func (hc *HAProxyController) OnNewLeader(identity string) {
 
 // Stop shutdown the controller process
 func (hc *HAProxyController) Stop() error {
+	// configuration changes aren't applied anymore, and the controller
+	// address is removed from the ingress status as soon as possible
+	hc.ingressQueue.ShutDown()
+	hc.controller.StopStatusSync()
 	if hc.cfg.WaitBeforeShutdown > 0 {
 		waitBeforeShutdown := time.Duration(hc.cfg.WaitBeforeShutdown) * time.Second
 		glog.Infof("Waiting %v before stopping components", waitBeforeShutdown)
 		time.Sleep(waitBeforeShutdown)
 	}
+	if hc.cfg.ShutdownTimeout > 0 && hc.work.ProxyWork() {
+		if err := hc.instance.Drain(hc.cfg.ShutdownTimeout); err != nil {
+			hc.logger.Warn("error draining haproxy: %v", err)
+		}
+	}
 	err := hc.controller.Stop()
 	return err
 }
@@ -248,6 +608,12 @@ func (hc *HAProxyController) GetIngressList() ([]*networking.Ingress, error) {
 	return hc.cache.GetIngressList()
 }
 
+// GetNode ...
+// implements oldcontroller.NewCtrlIntf
+func (hc *HAProxyController) GetNode(name string) (*api.Node, error) {
+	return hc.cache.GetNode(name)
+}
+
 // GetSecret ...
 // implements oldcontroller.NewCtrlIntf
 func (hc *HAProxyController) GetSecret(name string) (*api.Secret, error) {
@@ -272,7 +638,18 @@ func (hc *HAProxyController) DefaultIngressClass() string {
 
 // Check health check implementation
 func (hc *HAProxyController) Check(_ *http.Request) error {
-	return nil
+	if hc.instance == nil {
+		return nil
+	}
+	return hc.instance.CheckHealth()
+}
+
+// CheckReady readiness check implementation
+func (hc *HAProxyController) CheckReady(_ *http.Request) error {
+	if hc.instance == nil || !hc.cache.HasSynced() {
+		return fmt.Errorf("cache wasn't synced yet")
+	}
+	return hc.instance.CheckReady()
 }
 
 // UpdateIngressStatus custom callback used to update the status in an Ingress rule
@@ -320,13 +697,25 @@ func (hc *HAProxyController) syncIngress(item interface{}) {
 	//
 	hc.updateCount++
 	hc.logger.Info("starting haproxy update id=%d", hc.updateCount)
+	start := time.Now()
 	timer := utils.NewTimer(hc.metrics.ControllerProcTime)
 	ingConverter := ingressconverter.NewIngressConverter(
 		hc.converterOptions,
 		hc.instance.Config(),
 	)
+	timer.Tick("swap_changes")
 	ingConverter.Sync()
 	timer.Tick("parse_ingress")
+	for rtype, count := range hc.tracker.GetTrackedCount() {
+		hc.metrics.SetTrackedObjects(rtype.String(), count)
+	}
+	if hc.cfg.EnableProfiling {
+		// tracker isn't thread safe, a copy is taken in the sync goroutine
+		trackerDump := hc.tracker.Dump()
+		hc.debugMutex.Lock()
+		hc.debugTracker = trackerDump
+		hc.debugMutex.Unlock()
+	}
 
 	//
 	// configmap converters
@@ -347,9 +736,68 @@ func (hc *HAProxyController) syncIngress(item interface{}) {
 		}
 	}
 
+	if hc.cfg.TemplateConfigMapName != "" {
+		templateConfigmap, err := hc.cache.GetConfigMap(hc.cfg.TemplateConfigMapName)
+		if err == nil || k8serrors.IsNotFound(err) {
+			// a missing configmap restores the built-in templates
+			var templates map[string]string
+			if templateConfigmap != nil {
+				templates = templateConfigmap.Data
+			}
+			if err := hc.instance.OverrideTemplates(templates); err != nil {
+				hc.logger.Error("%v", err)
+			}
+			timer.Tick("parse_templates")
+		} else {
+			hc.logger.Error("error reading template overrides: %v", err)
+		}
+	}
+
+	if hc.defaultPages != nil {
+		pagesConfigmap, err := hc.cache.GetConfigMap(hc.cfg.DefaultPagesConfigMap)
+		if err == nil || k8serrors.IsNotFound(err) {
+			// a missing configmap serves the built-in 404 page
+			hc.defaultPages.update(pagesConfigmap)
+			timer.Tick("parse_default_pages")
+		} else {
+			hc.logger.Error("error reading default backend pages: %v", err)
+		}
+	}
+
+	hc.cache.collectLazyWatches()
+
 	//
 	// update proxy
 	//
-	hc.instance.Update(timer)
+	status := hc.instance.Update(timer)
+	if hc.metrics.appliedSince(start) {
+		hc.cache.changesApplied()
+	}
+	if hc.audit != nil {
+		err := hc.audit.record(auditEntry{
+			Timestamp: time.Now(),
+			ID:        hc.updateCount,
+			Objects:   hc.cache.swappedObjects(),
+			Update:    status.Update,
+			Failure:   status.Failure,
+		})
+		if err != nil {
+			hc.logger.Warn("error writing audit log: %v", err)
+		}
+	}
+	if hc.cfg.RecordUpdateEvents && (status.Update == "dynamic" || status.Update == "full" || status.Failure != "") {
+		eventtype, reason, message := updateEvent(hc.cache.swappedObjects(), status, time.Since(start))
+		hc.cache.recordControllerEvent(eventtype, reason, message)
+	}
+	if hc.statsExporter != nil {
+		hc.statsExporter.UpdateLabels(hc.instance.Config().Backends(), hc.tracker)
+	}
+	hc.servers.update(hc.instance.Config().Backends())
+	if hc.janitor != nil {
+		hc.janitor.update(hc.instance.Config().AcmeData().Storages())
+	}
+	if hc.conditions != nil {
+		hc.conditions.update(hc.converterOptions.Conditions, status.Failure)
+	}
 	hc.logger.Info("finish haproxy update id=%d: %s", hc.updateCount, timer.AsString("total"))
 }
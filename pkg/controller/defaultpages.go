@@ -0,0 +1,93 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	api "k8s.io/api/core/v1"
+)
+
+const defaultPageNotFound = "404.html"
+
+// defaultPages serves the keys of a ConfigMap as static files, used as
+// the default backend when a default backend service isn't configured.
+// Requests to unknown files are answered with the 404.html key, so
+// branded error pages can reference their own stylesheets and images.
+type defaultPages struct {
+	mutex sync.RWMutex
+	files map[string][]byte
+}
+
+// update replaces the served files with the content of cm, a missing
+// configmap removes all of them.
+func (p *defaultPages) update(cm *api.ConfigMap) {
+	files := map[string][]byte{}
+	if cm != nil {
+		for name, content := range cm.Data {
+			files[name] = []byte(content)
+		}
+		for name, content := range cm.BinaryData {
+			files[name] = content
+		}
+	}
+	p.mutex.Lock()
+	p.files = files
+	p.mutex.Unlock()
+}
+
+func (p *defaultPages) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		p.serveNotFound(w, r)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	content, found := p.files[name]
+	if !found || name == defaultPageNotFound {
+		p.serveNotFound(w, r)
+		return
+	}
+	p.serve(w, r, http.StatusOK, name, content)
+}
+
+func (p *defaultPages) serveNotFound(w http.ResponseWriter, r *http.Request) {
+	content, found := p.files[defaultPageNotFound]
+	if !found {
+		p.serve(w, r, http.StatusNotFound, "", []byte("404 page not found\n"))
+		return
+	}
+	p.serve(w, r, http.StatusNotFound, defaultPageNotFound, content)
+}
+
+func (p *defaultPages) serve(w http.ResponseWriter, r *http.Request, code int, name string, content []byte) {
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		contentType = http.DetectContentType(content)
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(code)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(content)
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	api "k8s.io/api/core/v1"
+)
+
+func TestDefaultPages(t *testing.T) {
+	branded := &api.ConfigMap{
+		Data: map[string]string{
+			"404.html":  "<html>not here</html>",
+			"style.css": "body {}",
+		},
+		BinaryData: map[string][]byte{
+			"logo.png": {0x89, 'P', 'N', 'G'},
+		},
+	}
+	testCases := []struct {
+		cm         *api.ConfigMap
+		method     string
+		path       string
+		expCode    int
+		expType    string
+		expContent string
+	}{
+		// 0
+		{
+			path:       "/",
+			expCode:    404,
+			expType:    "text/plain; charset=utf-8",
+			expContent: "404 page not found\n",
+		},
+		// 1
+		{
+			cm:         branded,
+			path:       "/app/",
+			expCode:    404,
+			expType:    "text/html; charset=utf-8",
+			expContent: "<html>not here</html>",
+		},
+		// 2
+		{
+			cm:         branded,
+			path:       "/404.html",
+			expCode:    404,
+			expType:    "text/html; charset=utf-8",
+			expContent: "<html>not here</html>",
+		},
+		// 3
+		{
+			cm:         branded,
+			path:       "/style.css",
+			expCode:    200,
+			expType:    "text/css; charset=utf-8",
+			expContent: "body {}",
+		},
+		// 4
+		{
+			cm:         branded,
+			path:       "/logo.png",
+			expCode:    200,
+			expType:    "image/png",
+			expContent: "\x89PNG",
+		},
+		// 5
+		{
+			cm:      branded,
+			method:  http.MethodHead,
+			path:    "/style.css",
+			expCode: 200,
+			expType: "text/css; charset=utf-8",
+		},
+		// 6
+		{
+			cm:         branded,
+			method:     http.MethodPost,
+			path:       "/style.css",
+			expCode:    404,
+			expType:    "text/html; charset=utf-8",
+			expContent: "<html>not here</html>",
+		},
+	}
+	for i, test := range testCases {
+		pages := &defaultPages{}
+		pages.update(test.cm)
+		method := test.method
+		if method == "" {
+			method = http.MethodGet
+		}
+		w := httptest.NewRecorder()
+		pages.ServeHTTP(w, httptest.NewRequest(method, test.path, nil))
+		if w.Code != test.expCode {
+			t.Errorf("%d: expected code %d but was %d", i, test.expCode, w.Code)
+		}
+		if contentType := w.Header().Get("Content-Type"); contentType != test.expType {
+			t.Errorf("%d: expected content type '%s' but was '%s'", i, test.expType, contentType)
+		}
+		if content := w.Body.String(); content != test.expContent {
+			t.Errorf("%d: expected content '%s' but was '%s'", i, test.expContent, content)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	api "k8s.io/api/core/v1"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy"
+)
+
+// driftCheck keeps the drift found in the last check. A drift is only
+// reported if found in two consecutive checks, so changes being applied
+// while haproxy is read aren't reported.
+type driftCheck struct {
+	last map[haproxy.Drift]bool
+}
+
+// confirm returns the drift that was also found in the last check.
+func (d *driftCheck) confirm(drifts []haproxy.Drift) []haproxy.Drift {
+	var confirmed []haproxy.Drift
+	last := make(map[haproxy.Drift]bool, len(drifts))
+	for _, drift := range drifts {
+		if d.last[drift] {
+			confirmed = append(confirmed, drift)
+		}
+		last[drift] = true
+	}
+	d.last = last
+	return confirmed
+}
+
+// driftEvent builds the event of a confirmed drift.
+func driftEvent(drifts []haproxy.Drift, reconcile bool) (eventtype, reason, message string) {
+	var servers, certs int
+	for _, drift := range drifts {
+		if drift.Kind == "cert" {
+			certs++
+		} else {
+			servers++
+		}
+	}
+	action := "not reconciled"
+	if reconcile {
+		action = "reloading haproxy"
+	}
+	return api.EventTypeWarning, "ConfigurationDrift",
+		fmt.Sprintf("running haproxy differs from the last update on %d server(s) and %d certificate(s), %s", servers, certs, action)
+}
+
+func (hc *HAProxyController) checkDrift() {
+	drifts, err := hc.instance.CheckDrift()
+	if err != nil {
+		hc.logger.Warn("error checking configuration drift: %v", err)
+		return
+	}
+	drifts = hc.drift.confirm(drifts)
+	counts := map[string]int{"server": 0, "cert": 0}
+	for _, drift := range drifts {
+		counts[drift.Kind]++
+		hc.logger.Warn("configuration drift on %s '%s': %s", drift.Kind, drift.Name, drift.Reason)
+	}
+	for kind, count := range counts {
+		hc.metrics.setDrift(kind, count)
+	}
+	if len(drifts) == 0 {
+		return
+	}
+	hc.cache.recordControllerEvent(driftEvent(drifts, hc.cfg.DriftReconcile))
+	if hc.cfg.DriftReconcile {
+		hc.logger.Info("reloading haproxy to reconcile the configuration drift")
+		hc.instance.RequestReload()
+		hc.ingressQueue.Notify()
+		// a new check is needed to confirm the drift again
+		hc.drift.last = nil
+	}
+}
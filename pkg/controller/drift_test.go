@@ -0,0 +1,73 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy"
+)
+
+func TestDriftCheck(t *testing.T) {
+	srv1 := haproxy.Drift{Kind: "server", Name: "default_app_8080/srv001", Reason: "server not found"}
+	srv2 := haproxy.Drift{Kind: "server", Name: "default_app_8080/srv002", Reason: "server not found"}
+	crt1 := haproxy.Drift{Kind: "cert", Name: "/var/haproxy/ssl/certs/d1.pem", Reason: "certificate not loaded"}
+	testCases := []struct {
+		drifts       []haproxy.Drift
+		reconcile    bool
+		expConfirmed []haproxy.Drift
+		expMessage   string
+	}{
+		// 0
+		{
+			drifts: []haproxy.Drift{srv1, crt1},
+		},
+		// 1
+		{
+			drifts:       []haproxy.Drift{srv1, srv2, crt1},
+			expConfirmed: []haproxy.Drift{srv1, crt1},
+			expMessage:   "running haproxy differs from the last update on 1 server(s) and 1 certificate(s), not reconciled",
+		},
+		// 2
+		{
+			drifts:       []haproxy.Drift{srv2},
+			reconcile:    true,
+			expConfirmed: []haproxy.Drift{srv2},
+			expMessage:   "running haproxy differs from the last update on 1 server(s) and 0 certificate(s), reloading haproxy",
+		},
+		// 3
+		{},
+		// 4
+		{
+			drifts: []haproxy.Drift{srv2},
+		},
+	}
+	d := &driftCheck{}
+	for i, test := range testCases {
+		confirmed := d.confirm(test.drifts)
+		if !reflect.DeepEqual(confirmed, test.expConfirmed) {
+			t.Errorf("confirmed drift differs on %d - expected: %+v - actual: %+v", i, test.expConfirmed, confirmed)
+		}
+		if len(confirmed) > 0 {
+			_, reason, message := driftEvent(confirmed, test.reconcile)
+			if reason != "ConfigurationDrift" || message != test.expMessage {
+				t.Errorf("event differs on %d - expected: %s - actual: %s: %s", i, test.expMessage, reason, message)
+			}
+		}
+	}
+}
@@ -0,0 +1,271 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	ingressconverter "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress"
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/tracker"
+	ingtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/types"
+	convtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/types"
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy"
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/types"
+)
+
+// dryRun implements the dry-run api: converts a proposed ingress resource
+// against the current state of the cluster, and responds the resulting
+// backends, map entries and warnings. Nothing is applied, and the state
+// of the controller isn't changed.
+type dryRun struct {
+	options      *ingtypes.ConverterOptions
+	metrics      types.Metrics
+	globalConfig func() map[string]string
+	templatesDir string
+	templatesCM  string
+}
+
+type dryRunResponse struct {
+	Backends map[string]string `json:"backends"`
+	Maps     map[string]string `json:"maps"`
+	Warnings []string          `json:"warnings"`
+}
+
+func (d *dryRun) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/ingress" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error reading ingress: %v", err), http.StatusBadRequest)
+		return
+	}
+	obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(body, nil, nil)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error decoding ingress: %v", err), http.StatusBadRequest)
+		return
+	}
+	ing, ok := obj.(*networking.Ingress)
+	if !ok {
+		http.Error(w, "expected a networking.k8s.io/v1 Ingress resource", http.StatusBadRequest)
+		return
+	}
+	if ing.Namespace == "" {
+		ing.Namespace = api.NamespaceDefault
+	}
+	res, err := d.convert(ing)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func (d *dryRun) convert(ing *networking.Ingress) (*dryRunResponse, error) {
+	tempdir, err := ioutil.TempDir("", "haproxy-ingress-dryrun")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempdir)
+	mapsDir := filepath.Join(tempdir, "maps")
+	if err := os.MkdirAll(mapsDir, 0755); err != nil {
+		return nil, err
+	}
+	out := &bytes.Buffer{}
+	logger := &renderLogger{out: out}
+	instance := haproxy.CreateInstance(logger, haproxy.InstanceOptions{
+		HAProxyCfgDir:  tempdir,
+		HAProxyMapsDir: mapsDir,
+		Metrics:        d.metrics,
+		TemplatesDir:   d.templatesDir,
+	})
+	if err := instance.ParseTemplates(); err != nil {
+		return nil, err
+	}
+	if d.templatesCM != "" {
+		if cm, err := d.options.Cache.GetConfigMap(d.templatesCM); err == nil {
+			if err := instance.OverrideTemplates(cm.Data); err != nil {
+				return nil, err
+			}
+		} else if !k8serrors.IsNotFound(err) {
+			return nil, fmt.Errorf("error reading template overrides: %w", err)
+		}
+	}
+	ingressconverter.NewIngressConverter(d.converterOptions(logger, ing), instance.Config()).Sync()
+	if err := instance.Render(); err != nil {
+		return nil, err
+	}
+	res := &dryRunResponse{
+		Backends: map[string]string{},
+		Maps:     map[string]string{},
+		Warnings: []string{},
+	}
+	if warnings := strings.TrimSpace(out.String()); warnings != "" {
+		res.Warnings = strings.Split(warnings, "\n")
+	}
+	backends := map[string]bool{}
+	for _, backend := range instance.Config().Backends().Items() {
+		backends[backend.ID] = true
+	}
+	config, err := ioutil.ReadFile(filepath.Join(tempdir, "haproxy.cfg"))
+	if err != nil {
+		return nil, err
+	}
+	// backend sections start with `backend <name>`, followed by indented keywords
+	var current string
+	for _, line := range strings.Split(string(config), "\n") {
+		if current != "" && strings.HasPrefix(line, "    ") {
+			res.Backends[current] += line + "\n"
+			continue
+		}
+		current = ""
+		if name := strings.TrimPrefix(line, "backend "); name != line && backends[name] {
+			current = name
+			res.Backends[current] = line + "\n"
+		}
+	}
+	files, err := ioutil.ReadDir(mapsDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		content, err := ioutil.ReadFile(filepath.Join(mapsDir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var entries []string
+		for _, line := range strings.Split(string(content), "\n") {
+			if line != "" && !strings.HasPrefix(line, "#") {
+				entries = append(entries, line)
+			}
+		}
+		if len(entries) > 0 {
+			res.Maps[file.Name()] = strings.Join(entries, "\n") + "\n"
+		}
+	}
+	return res, nil
+}
+
+// converterOptions copies the static options of the controller. The state
+// kept by the controller between syncs, like the service ports in the grace
+// period and the draining hosts, is written by the converter, so it is not
+// shared with the dry-run, which runs concurrently with the sync loop.
+func (d *dryRun) converterOptions(logger types.Logger, ing *networking.Ingress) *ingtypes.ConverterOptions {
+	return &ingtypes.ConverterOptions{
+		Logger: logger,
+		Cache: &dryRunCache{
+			Cache:        d.options.Cache,
+			ingress:      ing,
+			globalConfig: d.globalConfig(),
+		},
+		Tracker:          tracker.NewTracker(),
+		Metrics:          d.metrics,
+		MasterSocket:     d.options.MasterSocket,
+		RemoteHAProxy:    d.options.RemoteHAProxy,
+		Capabilities:     d.options.Capabilities,
+		SyslogListener:   d.options.SyslogListener,
+		DefaultBackend:   d.options.DefaultBackend,
+		DefaultPages:     d.options.DefaultPages,
+		DefaultCrtSecret: d.options.DefaultCrtSecret,
+		FakeCrtFile:      d.options.FakeCrtFile,
+		FakeCAFile:       d.options.FakeCAFile,
+		AnnotationPrefix: d.options.AnnotationPrefix,
+		AcmeTrackTLSAnn:  d.options.AcmeTrackTLSAnn,
+		NamespaceConfig:  d.options.NamespaceConfig,
+		TranslateNginx:   d.options.TranslateNginx,
+		ServicePorts:     map[string]*ingtypes.ServicePort{},
+		DrainingHosts:    map[string]*ingtypes.DrainingHost{},
+		Conditions:       map[string]*ingtypes.IngressConditions{},
+	}
+}
+
+// dryRunCache reads the resources from the cache of the controller, except
+// ingress resources: the proposed one is the only ingress found. Resources
+// are read without tracking, and Vault and Consul, which would start to issue
+// certificates or watch services, are not supported.
+type dryRunCache struct {
+	convtypes.Cache
+	ingress      *networking.Ingress
+	globalConfig map[string]string
+}
+
+func (c *dryRunCache) GetIngress(ingressName string) (*networking.Ingress, error) {
+	if ingressName == c.ingress.Namespace+"/"+c.ingress.Name {
+		return c.ingress, nil
+	}
+	return nil, k8serrors.NewNotFound(schema.GroupResource{Resource: "ingresses"}, ingressName)
+}
+
+func (c *dryRunCache) GetIngressList() ([]*networking.Ingress, error) {
+	return []*networking.Ingress{c.ingress}, nil
+}
+
+func (c *dryRunCache) GetConsulEndpoints(address, consulService string, service *api.Service) ([]convtypes.ExternalEndpoint, error) {
+	return nil, fmt.Errorf("consul services are not supported by the dry-run api")
+}
+
+func (c *dryRunCache) GetTerminatingPods(service *api.Service, track convtypes.TrackingTarget) ([]*api.Pod, error) {
+	return c.Cache.GetTerminatingPods(service, convtypes.TrackingTarget{})
+}
+
+func (c *dryRunCache) GetTLSSecretPath(defaultNamespace, secretName string, track convtypes.TrackingTarget) (convtypes.CrtFile, error) {
+	return c.Cache.GetTLSSecretPath(defaultNamespace, secretName, convtypes.TrackingTarget{})
+}
+
+func (c *dryRunCache) GetVaultCertPath(mount, role, hostname string, track convtypes.TrackingTarget) (file convtypes.CrtFile, err error) {
+	return file, fmt.Errorf("vault certificates are not supported by the dry-run api")
+}
+
+func (c *dryRunCache) GetCASecretPath(defaultNamespace, secretName string, track convtypes.TrackingTarget) (ca, crl convtypes.File, err error) {
+	return c.Cache.GetCASecretPath(defaultNamespace, secretName, convtypes.TrackingTarget{})
+}
+
+func (c *dryRunCache) GetSecretContent(defaultNamespace, secretName, keyName string, track convtypes.TrackingTarget) ([]byte, error) {
+	return c.Cache.GetSecretContent(defaultNamespace, secretName, keyName, convtypes.TrackingTarget{})
+}
+
+func (c *dryRunCache) SwapChangedObjects() *convtypes.ChangedObjects {
+	return &convtypes.ChangedObjects{
+		GlobalNew: c.globalConfig,
+	}
+}
+
+func (c *dryRunCache) NeedFullSync() bool {
+	return true
+}
+
+func (c *dryRunCache) ScheduleSync(at time.Time) {}
@@ -0,0 +1,226 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/tracker"
+	ingtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/types"
+	types_helper "github.com/jcmoraisjr/haproxy-ingress/pkg/types/helper_test"
+)
+
+func TestDryRun(t *testing.T) {
+	const cluster = `
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: current
+spec:
+  rules:
+  - host: current.local
+    http:
+      paths:
+      - path: /
+        pathType: Prefix
+        backend:
+          service:
+            name: current
+            port:
+              number: 8080
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+spec:
+  ports:
+  - port: 8080
+---
+apiVersion: v1
+kind: Endpoints
+metadata:
+  name: app
+subsets:
+- addresses:
+  - ip: 10.0.0.1
+  ports:
+  - port: 8080
+`
+	testCases := []struct {
+		method      string
+		path        string
+		body        string
+		expCode     int
+		expResponse dryRunResponse
+	}{
+		// 0
+		{
+			method:  http.MethodGet,
+			path:    "/v1/ingress",
+			expCode: http.StatusMethodNotAllowed,
+		},
+		// 1
+		{
+			method:  http.MethodPost,
+			path:    "/v1/other",
+			expCode: http.StatusNotFound,
+		},
+		// 2
+		{
+			method:  http.MethodPost,
+			path:    "/v1/ingress",
+			body:    "apiVersion: v1\nkind: Service\nmetadata:\n  name: app\n",
+			expCode: http.StatusBadRequest,
+		},
+		// 3
+		{
+			method: http.MethodPost,
+			path:   "/v1/ingress",
+			body: `
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: app
+  annotations:
+    ingress.kubernetes.io/timeout-server: 10s
+spec:
+  rules:
+  - host: app.local
+    http:
+      paths:
+      - path: /
+        pathType: Prefix
+        backend:
+          service:
+            name: app
+            port:
+              number: 8080
+`,
+			expCode: http.StatusOK,
+			expResponse: dryRunResponse{
+				Backends: map[string]string{
+					"default_app_8080": `backend default_app_8080
+    mode http
+    balance roundrobin
+    timeout server 10s
+    acl https-request ssl_fc
+    http-request redirect scheme https if !https-request
+    http-request set-header X-Original-Forwarded-For %[hdr(x-forwarded-for)] if { hdr(x-forwarded-for) -m found }
+    http-request del-header x-forwarded-for
+    option forwardfor
+    http-response set-header Strict-Transport-Security "max-age=15768000"
+    server srv001 10.0.0.1:8080 weight 1 check inter 2s
+`,
+				},
+				Maps: map[string]string{
+					"_front_bind_crt.list":          " !*\n",
+					"_front_http_host__prefix.map":  "app.local#/ default_app_8080\n",
+					"_front_https_host__prefix.map": "app.local#/ default_app_8080\n",
+				},
+				Warnings: []string{},
+			},
+		},
+		// 4
+		{
+			method: http.MethodPost,
+			path:   "/v1/ingress",
+			body: `
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: app
+  namespace: app
+spec:
+  defaultBackend:
+    service:
+      name: app
+      port:
+        number: 8080
+`,
+			expCode: http.StatusOK,
+			expResponse: dryRunResponse{
+				Backends: map[string]string{},
+				Maps: map[string]string{
+					"_front_bind_crt.list": " !*\n",
+				},
+				Warnings: []string{
+					`warning: skipping default backend of ingress 'app/app': services "app/app" not found`,
+				},
+			},
+		},
+	}
+	tempdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempdir)
+	resources := filepath.Join(tempdir, "cluster.yaml")
+	if err := ioutil.WriteFile(resources, []byte(cluster), 0644); err != nil {
+		t.Fatalf("error writing resources: %v", err)
+	}
+	objects, err := (&renderOptions{filenames: []string{resources}}).loadCache()
+	if err != nil {
+		t.Fatalf("error loading resources: %v", err)
+	}
+	metrics := types_helper.NewMetricsMock()
+	handler := &dryRun{
+		options: &ingtypes.ConverterOptions{
+			Cache:            objects,
+			Tracker:          tracker.NewTracker(),
+			Metrics:          metrics,
+			AnnotationPrefix: []string{"ingress.kubernetes.io"},
+			ServicePorts:     map[string]*ingtypes.ServicePort{},
+			DrainingHosts:    map[string]*ingtypes.DrainingHost{},
+		},
+		metrics:      noopMetrics{},
+		globalConfig: func() map[string]string { return nil },
+		templatesDir: "../../rootfs/etc/templates",
+	}
+	for i, test := range testCases {
+		req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != test.expCode {
+			t.Errorf("%d: expected status %d but was %d: %s", i, test.expCode, rec.Code, rec.Body.String())
+			continue
+		}
+		if rec.Code != http.StatusOK {
+			continue
+		}
+		var res dryRunResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Errorf("%d: error decoding response: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(res, test.expResponse) {
+			t.Errorf("%d: expected response %+v but was %+v", i, test.expResponse, res)
+		}
+	}
+	// the state of the controller should not be changed
+	if len(handler.options.ServicePorts) > 0 || len(handler.options.DrainingHosts) > 0 {
+		t.Errorf("expected empty controller state, but was %v and %v", handler.options.ServicePorts, handler.options.DrainingHosts)
+	}
+}
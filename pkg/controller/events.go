@@ -0,0 +1,169 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	api "k8s.io/api/core/v1"
+
+	ingtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/types"
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy"
+)
+
+// updateEvent builds the event of an haproxy update, summarizing the number
+// of changed objects per type, how they were applied and the time spent.
+func updateEvent(objects []string, status haproxy.UpdateStatus, duration time.Duration) (eventtype, reason, message string) {
+	counts := map[string]int{}
+	for _, obj := range objects {
+		// <op>/<type>:<name>, or <op>/<type> for the global and tcp-services configmaps
+		rtype := obj[strings.Index(obj, "/")+1:]
+		if i := strings.Index(rtype, ":"); i >= 0 {
+			rtype = rtype[:i]
+		}
+		counts[rtype]++
+	}
+	rtypes := make([]string, 0, len(counts))
+	for rtype := range counts {
+		rtypes = append(rtypes, rtype)
+	}
+	sort.Strings(rtypes)
+	changes := make([]string, len(rtypes))
+	for i, rtype := range rtypes {
+		changes[i] = fmt.Sprintf("%d %s", counts[rtype], rtype)
+	}
+	summary := "full sync"
+	if len(changes) > 0 {
+		summary = strings.Join(changes, ", ")
+	}
+	action := "update"
+	switch status.Update {
+	case "dynamic":
+		action = "dynamic update"
+	case "full":
+		action = "reload"
+	}
+	duration = duration.Round(time.Millisecond)
+	if status.Failure != "" {
+		return api.EventTypeWarning, "ConfigurationUpdateFailed",
+			fmt.Sprintf("haproxy %s failed on %s after %s, changed objects: %s", action, status.Failure, duration, summary)
+	}
+	return api.EventTypeNormal, "ConfigurationUpdated",
+		fmt.Sprintf("haproxy %s succeeded in %s, changed objects: %s", action, duration, summary)
+}
+
+// conditionsReporter reports the Accepted, Programmed and CertificateResolved
+// conditions of the ingress resources as events. networking/v1 ingress status
+// has no conditions, so events are the only way to report them. An event is
+// only recorded when a condition changes, and only by the leader of the
+// ingress status update. Changes are tracked by all the instances, so a new
+// leader doesn't report the conditions again.
+type conditionsReporter struct {
+	isLeader func() bool
+	record   func(namespace, name, eventtype, reason, message string)
+	last     map[string]map[string]conditionEvent
+}
+
+type conditionEvent struct {
+	eventtype string
+	reason    string
+	message   string
+}
+
+// update compares the conditions of the last parse of the ingress resources,
+// and the failure of the last haproxy update, with the conditions already
+// reported, and records the ones that changed.
+func (r *conditionsReporter) update(conditions map[string]*ingtypes.IngressConditions, failure string) {
+	if r.last == nil {
+		r.last = map[string]map[string]conditionEvent{}
+	}
+	for name := range r.last {
+		if _, found := conditions[name]; !found {
+			delete(r.last, name)
+		}
+	}
+	leader := r.isLeader()
+	names := make([]string, 0, len(conditions))
+	for name := range conditions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		events := buildConditionEvents(conditions[name], failure)
+		last := r.last[name]
+		r.last[name] = events
+		if !leader {
+			continue
+		}
+		for _, condition := range []string{"Accepted", "Programmed", "CertificateResolved"} {
+			event, found := events[condition]
+			if !found || event == last[condition] {
+				continue
+			}
+			if i := strings.Index(name, "/"); i >= 0 {
+				r.record(name[:i], name[i+1:], event.eventtype, event.reason, event.message)
+			}
+		}
+	}
+}
+
+// buildConditionEvents returns the events of the conditions of an ingress
+// resource. Programmed and CertificateResolved are only reported if the
+// ingress was accepted, CertificateResolved only if it declares TLS hosts.
+func buildConditionEvents(cond *ingtypes.IngressConditions, failure string) map[string]conditionEvent {
+	if cond.Rejected != "" {
+		return map[string]conditionEvent{
+			"Accepted": {api.EventTypeWarning, "Rejected", "ingress rejected: " + cond.Rejected},
+		}
+	}
+	events := map[string]conditionEvent{}
+	if len(cond.SkippedHosts) > 0 {
+		events["Accepted"] = conditionEvent{api.EventTypeWarning, "HostsSkipped",
+			"ingress accepted, skipped hosts: " + joinHostReasons(cond.SkippedHosts)}
+	} else {
+		events["Accepted"] = conditionEvent{api.EventTypeNormal, "Accepted", "ingress accepted"}
+	}
+	if failure != "" {
+		events["Programmed"] = conditionEvent{api.EventTypeWarning, "ProgrammingFailed",
+			"haproxy update failed on " + failure}
+	} else {
+		events["Programmed"] = conditionEvent{api.EventTypeNormal, "Programmed", "configuration applied to haproxy"}
+	}
+	if len(cond.CertErrors) > 0 {
+		events["CertificateResolved"] = conditionEvent{api.EventTypeWarning, "CertificateNotResolved",
+			"using the default certificate on hosts: " + joinHostReasons(cond.CertErrors)}
+	} else if cond.HasTLS {
+		events["CertificateResolved"] = conditionEvent{api.EventTypeNormal, "CertificateResolved",
+			"certificates of all the TLS hosts resolved"}
+	}
+	return events
+}
+
+func joinHostReasons(hosts map[string]string) string {
+	hostnames := make([]string, 0, len(hosts))
+	for hostname := range hosts {
+		hostnames = append(hostnames, hostname)
+	}
+	sort.Strings(hostnames)
+	for i, hostname := range hostnames {
+		hostnames[i] = fmt.Sprintf("%s (%s)", hostname, hosts[hostname])
+	}
+	return strings.Join(hostnames, ", ")
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	ingtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/types"
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy"
+)
+
+func TestUpdateEvent(t *testing.T) {
+	testCases := []struct {
+		objects    []string
+		status     haproxy.UpdateStatus
+		duration   time.Duration
+		expType    string
+		expReason  string
+		expMessage string
+	}{
+		// 0
+		{
+			status:     haproxy.UpdateStatus{Update: "full"},
+			duration:   1500 * time.Millisecond,
+			expType:    "Normal",
+			expReason:  "ConfigurationUpdated",
+			expMessage: "haproxy reload succeeded in 1.5s, changed objects: full sync",
+		},
+		// 1
+		{
+			objects: []string{
+				"update/global",
+				"add/ingress:default/app1",
+				"update/ingress:default/app2",
+				"update/secret:default/tls",
+				"update/endpoint:default/app",
+			},
+			status:     haproxy.UpdateStatus{Update: "dynamic"},
+			duration:   12345 * time.Microsecond,
+			expType:    "Normal",
+			expReason:  "ConfigurationUpdated",
+			expMessage: "haproxy dynamic update succeeded in 12ms, changed objects: 1 endpoint, 1 global, 2 ingress, 1 secret",
+		},
+		// 2
+		{
+			objects:    []string{"update/ingress:default/app"},
+			status:     haproxy.UpdateStatus{Update: "full", Failure: "reload"},
+			duration:   2 * time.Second,
+			expType:    "Warning",
+			expReason:  "ConfigurationUpdateFailed",
+			expMessage: "haproxy reload failed on reload after 2s, changed objects: 1 ingress",
+		},
+		// 3
+		{
+			objects:    []string{"update/configmap:ingress/errorpages"},
+			status:     haproxy.UpdateStatus{Update: "noop", Failure: "error_pages"},
+			duration:   time.Millisecond,
+			expType:    "Warning",
+			expReason:  "ConfigurationUpdateFailed",
+			expMessage: "haproxy update failed on error_pages after 1ms, changed objects: 1 configmap",
+		},
+	}
+	for i, test := range testCases {
+		eventtype, reason, message := updateEvent(test.objects, test.status, test.duration)
+		if eventtype != test.expType || reason != test.expReason || message != test.expMessage {
+			t.Errorf("%d: expected event %s/%s '%s' but was %s/%s '%s'", i,
+				test.expType, test.expReason, test.expMessage, eventtype, reason, message)
+		}
+	}
+}
+
+func TestConditionsReporter(t *testing.T) {
+	type update struct {
+		conditions map[string]*ingtypes.IngressConditions
+		failure    string
+		leader     bool
+	}
+	accepted := &ingtypes.IngressConditions{}
+	testCases := []struct {
+		updates  []update
+		expected []string
+	}{
+		// 0
+		{
+			updates: []update{
+				{conditions: map[string]*ingtypes.IngressConditions{"default/app": accepted}, leader: true},
+				{conditions: map[string]*ingtypes.IngressConditions{"default/app": accepted}, leader: true},
+			},
+			expected: []string{
+				"default/app Normal Accepted: ingress accepted",
+				"default/app Normal Programmed: configuration applied to haproxy",
+			},
+		},
+		// 1
+		{
+			updates: []update{
+				{conditions: map[string]*ingtypes.IngressConditions{"default/app": accepted}},
+				{conditions: map[string]*ingtypes.IngressConditions{"default/app": accepted}, leader: true},
+				{conditions: map[string]*ingtypes.IngressConditions{"default/app": accepted}, failure: "reload", leader: true},
+			},
+			expected: []string{
+				"default/app Warning ProgrammingFailed: haproxy update failed on reload",
+			},
+		},
+		// 2
+		{
+			updates: []update{
+				{
+					conditions: map[string]*ingtypes.IngressConditions{
+						"default/app": {Rejected: "namespace 'default' exceeds its quota of 2 hosts"},
+					},
+					leader: true,
+				},
+			},
+			expected: []string{
+				"default/app Warning Rejected: ingress rejected: namespace 'default' exceeds its quota of 2 hosts",
+			},
+		},
+		// 3
+		{
+			updates: []update{
+				{
+					conditions: map[string]*ingtypes.IngressConditions{
+						"other/app": {
+							SkippedHosts: map[string]string{"d2.local": "hostname belongs to namespace 'default'"},
+							HasTLS:       true,
+							CertErrors:   map[string]string{"d1.local": "secret not found: 'other/tls'"},
+						},
+					},
+					leader: true,
+				},
+			},
+			expected: []string{
+				"other/app Warning HostsSkipped: ingress accepted, skipped hosts: d2.local (hostname belongs to namespace 'default')",
+				"other/app Normal Programmed: configuration applied to haproxy",
+				"other/app Warning CertificateNotResolved: using the default certificate on hosts: d1.local (secret not found: 'other/tls')",
+			},
+		},
+		// 4
+		{
+			updates: []update{
+				{conditions: map[string]*ingtypes.IngressConditions{"default/app": {HasTLS: true}}, leader: true},
+				{conditions: map[string]*ingtypes.IngressConditions{}, leader: true},
+				{conditions: map[string]*ingtypes.IngressConditions{"default/app": {HasTLS: true}}, leader: true},
+			},
+			expected: []string{
+				"default/app Normal Accepted: ingress accepted",
+				"default/app Normal Programmed: configuration applied to haproxy",
+				"default/app Normal CertificateResolved: certificates of all the TLS hosts resolved",
+				"default/app Normal Accepted: ingress accepted",
+				"default/app Normal Programmed: configuration applied to haproxy",
+				"default/app Normal CertificateResolved: certificates of all the TLS hosts resolved",
+			},
+		},
+	}
+	for i, test := range testCases {
+		var events []string
+		var leader bool
+		r := &conditionsReporter{
+			isLeader: func() bool { return leader },
+			record: func(namespace, name, eventtype, reason, message string) {
+				events = append(events, namespace+"/"+name+" "+eventtype+" "+reason+": "+message)
+			},
+		}
+		for _, u := range test.updates {
+			leader = u.leader
+			r.update(u.conditions, u.failure)
+		}
+		if !reflect.DeepEqual(events, test.expected) {
+			t.Errorf("events differ on %d - expected: %v - actual: %v", i, test.expected, events)
+		}
+	}
+}
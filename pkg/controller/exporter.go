@@ -0,0 +1,298 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	convtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/types"
+	hatypes "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/types"
+)
+
+// proxy and server types of the `show stat` output
+const (
+	statTypeFrontend = "0"
+	statTypeBackend  = "1"
+	statTypeServer   = "2"
+)
+
+// statField is a numeric field of the `show stat` output. Fields that can
+// be summed up are also aggregated per ingress and per namespace.
+type statField struct {
+	field     string
+	name      string
+	help      string
+	valueType prometheus.ValueType
+	aggregate bool
+}
+
+var statFields = []statField{
+	{"scur", "current_sessions", "Current number of active sessions.", prometheus.GaugeValue, true},
+	{"stot", "sessions_total", "Cumulative number of sessions.", prometheus.CounterValue, true},
+	{"bin", "bytes_in_total", "Cumulative number of request bytes.", prometheus.CounterValue, true},
+	{"bout", "bytes_out_total", "Cumulative number of response bytes.", prometheus.CounterValue, true},
+	{"qcur", "current_queue", "Current number of queued requests.", prometheus.GaugeValue, true},
+	{"qmax", "max_queue", "Highest number of queued requests.", prometheus.GaugeValue, false},
+	{"qlimit", "queue_limit", "Configured maximum number of queued requests, see maxqueue-server.", prometheus.GaugeValue, false},
+	{"ereq", "request_errors_total", "Cumulative number of request errors.", prometheus.CounterValue, true},
+	{"econ", "connection_errors_total", "Cumulative number of connection errors.", prometheus.CounterValue, true},
+	{"eresp", "response_errors_total", "Cumulative number of response errors.", prometheus.CounterValue, true},
+	{"req_tot", "http_requests_total", "Cumulative number of HTTP requests.", prometheus.CounterValue, true},
+}
+
+var statHTTPResponseFields = map[string]string{
+	"hrsp_1xx":   "1xx",
+	"hrsp_2xx":   "2xx",
+	"hrsp_3xx":   "3xx",
+	"hrsp_4xx":   "4xx",
+	"hrsp_5xx":   "5xx",
+	"hrsp_other": "other",
+}
+
+type statBackendLabels struct {
+	namespace string
+	ingress   string
+	ingresses []string
+	service   string
+	port      string
+}
+
+type statDescs struct {
+	fields        map[string]*prometheus.Desc
+	httpResponses *prometheus.Desc
+	up            *prometheus.Desc
+}
+
+// statAggregate has the sum of the stats of the backends of an ingress
+// or a namespace, indexed by the field name.
+type statAggregate struct {
+	labels []string
+	values map[string]float64
+}
+
+// statsExporter exposes HAProxy's `show stat` output as Prometheus metrics.
+// Backends and servers are labeled after the Kubernetes resources that
+// created them instead of the HAProxy's proxy names. Stats and labels are
+// updated asynchronously, Collect() only reads the last snapshot.
+//
+// Stats of the backends are also aggregated per ingress and per namespace,
+// so a backend referenced by two ingress resources is added to both.
+type statsExporter struct {
+	mutex    sync.Mutex
+	backends map[string]statBackendLabels
+	stats    []map[string]string
+	descs    map[string]*statDescs
+	ingDescs *statDescs
+	nsDescs  *statDescs
+}
+
+func createStatsExporter() *statsExporter {
+	namespace := "haproxyingress"
+	frontendLabels := []string{"frontend"}
+	backendLabels := []string{"namespace", "ingress", "service", "port"}
+	serverLabels := append(backendLabels, "server")
+	buildDescs := func(subsystem string, labels []string) *statDescs {
+		aggregated := subsystem == "ingress" || subsystem == "namespace"
+		descs := &statDescs{
+			fields: make(map[string]*prometheus.Desc, len(statFields)),
+			httpResponses: prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, subsystem, "http_responses_total"),
+				"Cumulative number of HTTP responses, per status code class.",
+				append(labels[:len(labels):len(labels)], "code"), nil,
+			),
+		}
+		for _, field := range statFields {
+			if aggregated && !field.aggregate {
+				continue
+			}
+			descs.fields[field.field] = prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, subsystem, field.name),
+				field.help, labels, nil,
+			)
+		}
+		if subsystem != "haproxy_frontend" && !aggregated {
+			descs.up = prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, subsystem, "up"),
+				"Whether the proxy or server is currently up.",
+				labels, nil,
+			)
+		}
+		return descs
+	}
+	return &statsExporter{
+		descs: map[string]*statDescs{
+			statTypeFrontend: buildDescs("haproxy_frontend", frontendLabels),
+			statTypeBackend:  buildDescs("haproxy_backend", backendLabels),
+			statTypeServer:   buildDescs("haproxy_server", serverLabels),
+		},
+		ingDescs: buildDescs("ingress", []string{"namespace", "ingress"}),
+		nsDescs:  buildDescs("namespace", []string{"namespace"}),
+	}
+}
+
+// UpdateLabels rebuilds the Kubernetes labels of the HAProxy backends.
+// Should be called from the same goroutine that updates the model.
+func (e *statsExporter) UpdateLabels(backends *hatypes.Backends, tracker convtypes.Tracker) {
+	labels := make(map[string]statBackendLabels, len(backends.Items()))
+	for _, backend := range backends.Items() {
+		ingresses := tracker.GetIngressesByBackend(backend.BackendID())
+		labels[backend.ID] = statBackendLabels{
+			namespace: backend.Namespace,
+			ingress:   strings.Join(ingresses, ","),
+			ingresses: ingresses,
+			service:   backend.Name,
+			port:      backend.Port,
+		}
+	}
+	e.mutex.Lock()
+	e.backends = labels
+	e.mutex.Unlock()
+}
+
+// UpdateStats stores the last `show stat` output.
+func (e *statsExporter) UpdateStats(stats []map[string]string) {
+	e.mutex.Lock()
+	e.stats = stats
+	e.mutex.Unlock()
+}
+
+// Describe implements prometheus.Collector
+func (e *statsExporter) Describe(ch chan<- *prometheus.Desc) {
+	for _, descs := range []*statDescs{e.ingDescs, e.nsDescs} {
+		for _, desc := range descs.fields {
+			ch <- desc
+		}
+		ch <- descs.httpResponses
+	}
+	for _, descs := range e.descs {
+		for _, desc := range descs.fields {
+			ch <- desc
+		}
+		ch <- descs.httpResponses
+		if descs.up != nil {
+			ch <- descs.up
+		}
+	}
+}
+
+// Collect implements prometheus.Collector
+func (e *statsExporter) Collect(ch chan<- prometheus.Metric) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	ingAggregates := map[string]*statAggregate{}
+	nsAggregates := map[string]*statAggregate{}
+	for _, stat := range e.stats {
+		descs, found := e.descs[stat["type"]]
+		if !found {
+			continue
+		}
+		var labels []string
+		if stat["type"] == statTypeFrontend {
+			labels = []string{stat["pxname"]}
+		} else {
+			backend, found := e.backends[stat["pxname"]]
+			if !found {
+				// internal proxy, not created from a Kubernetes resource
+				continue
+			}
+			labels = []string{backend.namespace, backend.ingress, backend.service, backend.port}
+			if stat["type"] == statTypeServer {
+				labels = append(labels, stat["svname"])
+			} else {
+				aggregateStat(nsAggregates, stat, backend.namespace)
+				for _, ing := range backend.ingresses {
+					if ns, name := splitName(ing); ns != "" {
+						aggregateStat(ingAggregates, stat, ns, name)
+					}
+				}
+			}
+		}
+		for _, field := range statFields {
+			if value, err := strconv.ParseFloat(stat[field.field], 64); err == nil {
+				ch <- prometheus.MustNewConstMetric(descs.fields[field.field], field.valueType, value, labels...)
+			}
+		}
+		for field, code := range statHTTPResponseFields {
+			if value, err := strconv.ParseFloat(stat[field], 64); err == nil {
+				ch <- prometheus.MustNewConstMetric(descs.httpResponses, prometheus.CounterValue, value, append(labels, code)...)
+			}
+		}
+		if descs.up != nil {
+			if status := stat["status"]; status != "" {
+				up := 0.0
+				if strings.HasPrefix(status, "UP") {
+					up = 1
+				}
+				ch <- prometheus.MustNewConstMetric(descs.up, prometheus.GaugeValue, up, labels...)
+			}
+		}
+	}
+	collectAggregates(ch, e.ingDescs, ingAggregates)
+	collectAggregates(ch, e.nsDescs, nsAggregates)
+}
+
+// aggregateStat adds the aggregatable fields of a backend stat to the
+// aggregate identified by labels.
+func aggregateStat(aggregates map[string]*statAggregate, stat map[string]string, labels ...string) {
+	key := strings.Join(labels, "/")
+	aggregate, found := aggregates[key]
+	if !found {
+		aggregate = &statAggregate{labels: labels, values: map[string]float64{}}
+		aggregates[key] = aggregate
+	}
+	for _, field := range statFields {
+		if !field.aggregate {
+			continue
+		}
+		if value, err := strconv.ParseFloat(stat[field.field], 64); err == nil {
+			aggregate.values[field.field] += value
+		}
+	}
+	for field := range statHTTPResponseFields {
+		if value, err := strconv.ParseFloat(stat[field], 64); err == nil {
+			aggregate.values[field] += value
+		}
+	}
+}
+
+func collectAggregates(ch chan<- prometheus.Metric, descs *statDescs, aggregates map[string]*statAggregate) {
+	for _, aggregate := range aggregates {
+		for _, field := range statFields {
+			if value, found := aggregate.values[field.field]; found && field.aggregate {
+				ch <- prometheus.MustNewConstMetric(descs.fields[field.field], field.valueType, value, aggregate.labels...)
+			}
+		}
+		for field, code := range statHTTPResponseFields {
+			if value, found := aggregate.values[field]; found {
+				ch <- prometheus.MustNewConstMetric(descs.httpResponses, prometheus.CounterValue, value, append(aggregate.labels, code)...)
+			}
+		}
+	}
+}
+
+// splitName splits a namespace/name string, namespace is empty if
+// fullName doesn't have a namespace.
+func splitName(fullName string) (namespace, name string) {
+	if i := strings.Index(fullName, "/"); i >= 0 {
+		return fullName[:i], fullName[i+1:]
+	}
+	return "", fullName
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/tracker"
+	convtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/types"
+	hatypes "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/types"
+)
+
+func TestStatsExporter(t *testing.T) {
+	backends := hatypes.CreateBackends(0)
+	b := backends.AcquireBackend("default", "app", "8080")
+	tr := tracker.NewTracker()
+	tr.TrackBackend(convtypes.IngressType, "default/ing2", b.BackendID())
+	tr.TrackBackend(convtypes.IngressType, "default/ing1", b.BackendID())
+
+	e := createStatsExporter()
+	e.UpdateLabels(backends, tr)
+	e.UpdateStats([]map[string]string{
+		{"pxname": "_front_http", "svname": "FRONTEND", "type": "0", "scur": "3", "hrsp_2xx": "10", "status": "OPEN"},
+		{"pxname": "default_app_8080", "svname": "BACKEND", "type": "1", "scur": "2", "qcur": "1", "qmax": "5", "hrsp_2xx": "8", "status": "UP"},
+		{"pxname": "default_app_8080", "svname": "srv001", "type": "2", "scur": "2", "qcur": "", "qlimit": "10", "status": "DOWN 1/2"},
+		{"pxname": "_error404", "svname": "BACKEND", "type": "1", "scur": "1", "status": "UP"},
+	})
+
+	expected := `
+# HELP haproxyingress_haproxy_frontend_current_sessions Current number of active sessions.
+# TYPE haproxyingress_haproxy_frontend_current_sessions gauge
+haproxyingress_haproxy_frontend_current_sessions{frontend="_front_http"} 3
+# HELP haproxyingress_haproxy_frontend_http_responses_total Cumulative number of HTTP responses, per status code class.
+# TYPE haproxyingress_haproxy_frontend_http_responses_total counter
+haproxyingress_haproxy_frontend_http_responses_total{code="2xx",frontend="_front_http"} 10
+# HELP haproxyingress_haproxy_backend_current_queue Current number of queued requests.
+# TYPE haproxyingress_haproxy_backend_current_queue gauge
+haproxyingress_haproxy_backend_current_queue{ingress="default/ing1,default/ing2",namespace="default",port="8080",service="app"} 1
+# HELP haproxyingress_haproxy_backend_max_queue Highest number of queued requests.
+# TYPE haproxyingress_haproxy_backend_max_queue gauge
+haproxyingress_haproxy_backend_max_queue{ingress="default/ing1,default/ing2",namespace="default",port="8080",service="app"} 5
+# HELP haproxyingress_haproxy_backend_current_sessions Current number of active sessions.
+# TYPE haproxyingress_haproxy_backend_current_sessions gauge
+haproxyingress_haproxy_backend_current_sessions{ingress="default/ing1,default/ing2",namespace="default",port="8080",service="app"} 2
+# HELP haproxyingress_haproxy_backend_up Whether the proxy or server is currently up.
+# TYPE haproxyingress_haproxy_backend_up gauge
+haproxyingress_haproxy_backend_up{ingress="default/ing1,default/ing2",namespace="default",port="8080",service="app"} 1
+# HELP haproxyingress_haproxy_server_current_sessions Current number of active sessions.
+# TYPE haproxyingress_haproxy_server_current_sessions gauge
+haproxyingress_haproxy_server_current_sessions{ingress="default/ing1,default/ing2",namespace="default",port="8080",server="srv001",service="app"} 2
+# HELP haproxyingress_haproxy_server_queue_limit Configured maximum number of queued requests, see maxqueue-server.
+# TYPE haproxyingress_haproxy_server_queue_limit gauge
+haproxyingress_haproxy_server_queue_limit{ingress="default/ing1,default/ing2",namespace="default",port="8080",server="srv001",service="app"} 10
+# HELP haproxyingress_haproxy_server_up Whether the proxy or server is currently up.
+# TYPE haproxyingress_haproxy_server_up gauge
+haproxyingress_haproxy_server_up{ingress="default/ing1,default/ing2",namespace="default",port="8080",server="srv001",service="app"} 0
+`
+	err := testutil.CollectAndCompare(e, strings.NewReader(expected),
+		"haproxyingress_haproxy_frontend_current_sessions",
+		"haproxyingress_haproxy_frontend_http_responses_total",
+		"haproxyingress_haproxy_backend_current_queue",
+		"haproxyingress_haproxy_backend_current_sessions",
+		"haproxyingress_haproxy_backend_max_queue",
+		"haproxyingress_haproxy_backend_up",
+		"haproxyingress_haproxy_server_current_queue",
+		"haproxyingress_haproxy_server_current_sessions",
+		"haproxyingress_haproxy_server_queue_limit",
+		"haproxyingress_haproxy_server_up",
+	)
+	if err != nil {
+		t.Errorf("unexpected metrics: %v", err)
+	}
+}
+
+func TestStatsExporterAggregates(t *testing.T) {
+	backends := hatypes.CreateBackends(0)
+	b1 := backends.AcquireBackend("default", "app1", "8080")
+	b2 := backends.AcquireBackend("default", "app2", "8080")
+	b3 := backends.AcquireBackend("team1", "app", "8080")
+	tr := tracker.NewTracker()
+	tr.TrackBackend(convtypes.IngressType, "default/ing1", b1.BackendID())
+	tr.TrackBackend(convtypes.IngressType, "default/ing1", b2.BackendID())
+	tr.TrackBackend(convtypes.IngressType, "default/ing2", b2.BackendID())
+	tr.TrackBackend(convtypes.IngressType, "team1/ing1", b3.BackendID())
+
+	e := createStatsExporter()
+	e.UpdateLabels(backends, tr)
+	e.UpdateStats([]map[string]string{
+		{"pxname": "default_app1_8080", "svname": "BACKEND", "type": "1", "scur": "2", "qmax": "5", "req_tot": "10", "hrsp_5xx": "1", "status": "UP"},
+		{"pxname": "default_app1_8080", "svname": "srv001", "type": "2", "scur": "2", "req_tot": "10", "status": "UP"},
+		{"pxname": "default_app2_8080", "svname": "BACKEND", "type": "1", "scur": "3", "qmax": "1", "req_tot": "20", "hrsp_5xx": "2", "status": "UP"},
+		{"pxname": "team1_app_8080", "svname": "BACKEND", "type": "1", "scur": "1", "req_tot": "5", "status": "UP"},
+		{"pxname": "_error404", "svname": "BACKEND", "type": "1", "scur": "1", "req_tot": "7", "status": "UP"},
+	})
+
+	expected := `
+# HELP haproxyingress_ingress_current_sessions Current number of active sessions.
+# TYPE haproxyingress_ingress_current_sessions gauge
+haproxyingress_ingress_current_sessions{ingress="ing1",namespace="default"} 5
+haproxyingress_ingress_current_sessions{ingress="ing2",namespace="default"} 3
+haproxyingress_ingress_current_sessions{ingress="ing1",namespace="team1"} 1
+# HELP haproxyingress_ingress_http_requests_total Cumulative number of HTTP requests.
+# TYPE haproxyingress_ingress_http_requests_total counter
+haproxyingress_ingress_http_requests_total{ingress="ing1",namespace="default"} 30
+haproxyingress_ingress_http_requests_total{ingress="ing2",namespace="default"} 20
+haproxyingress_ingress_http_requests_total{ingress="ing1",namespace="team1"} 5
+# HELP haproxyingress_ingress_http_responses_total Cumulative number of HTTP responses, per status code class.
+# TYPE haproxyingress_ingress_http_responses_total counter
+haproxyingress_ingress_http_responses_total{code="5xx",ingress="ing1",namespace="default"} 3
+haproxyingress_ingress_http_responses_total{code="5xx",ingress="ing2",namespace="default"} 2
+# HELP haproxyingress_namespace_current_sessions Current number of active sessions.
+# TYPE haproxyingress_namespace_current_sessions gauge
+haproxyingress_namespace_current_sessions{namespace="default"} 5
+haproxyingress_namespace_current_sessions{namespace="team1"} 1
+# HELP haproxyingress_namespace_http_requests_total Cumulative number of HTTP requests.
+# TYPE haproxyingress_namespace_http_requests_total counter
+haproxyingress_namespace_http_requests_total{namespace="default"} 30
+haproxyingress_namespace_http_requests_total{namespace="team1"} 5
+`
+	err := testutil.CollectAndCompare(e, strings.NewReader(expected),
+		"haproxyingress_ingress_current_sessions",
+		"haproxyingress_ingress_http_requests_total",
+		"haproxyingress_ingress_http_responses_total",
+		"haproxyingress_ingress_max_queue",
+		"haproxyingress_namespace_current_sessions",
+		"haproxyingress_namespace_http_requests_total",
+	)
+	if err != nil {
+		t.Errorf("unexpected metrics: %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/types"
+)
+
+// fileWatcher watches the files read via the file:// protocol, eg secrets
+// mounted by the Secrets Store CSI driver. The content of the files is
+// hashed on every interval, because mounted volumes are rotated via symlink
+// swaps which aren't notified as a change of the file itself.
+type fileWatcher struct {
+	logger   types.Logger
+	interval time.Duration
+	notify   func(name string, global bool)
+	mutex    sync.Mutex
+	files    map[string]*watchedFile
+}
+
+type watchedFile struct {
+	path string
+	hash string
+	// global files are read without a tracking target, and are never collected
+	global bool
+	// if it was read since the last collect
+	read bool
+}
+
+func newFileWatcher(logger types.Logger, notify func(name string, global bool)) *fileWatcher {
+	return &fileWatcher{
+		logger:   logger,
+		interval: 10 * time.Second,
+		notify:   notify,
+		files:    map[string]*watchedFile{},
+	}
+}
+
+// fileWatchName is the name used to track a file. The tracker expects the
+// namespace/name format of secrets, so the slashes of the directory are
+// changed, and a prefix that cannot be found in a namespace name is used.
+func fileWatchName(path string) string {
+	path = filepath.Clean(path)
+	return "file:" + strings.ReplaceAll(filepath.Dir(path), "/", ":") + "/" + filepath.Base(path)
+}
+
+// Run checks the watched files on every interval until stopCh is closed.
+func (w *fileWatcher) Run(stopCh <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				w.check()
+			}
+		}
+	}()
+}
+
+// Read returns the content and the hash of a file, starting its watch if
+// the file is not being watched yet.
+func (w *fileWatcher) Read(path string, global bool) (content []byte, hash string, err error) {
+	content, err = ioutil.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	hash = sha1Hash(content)
+	name := fileWatchName(path)
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	file, found := w.files[name]
+	if !found {
+		w.logger.InfoV(2, "starting watch of file %s", path)
+		file = &watchedFile{path: path}
+		w.files[name] = file
+	}
+	file.hash = hash
+	file.global = file.global || global
+	file.read = true
+	return content, hash, nil
+}
+
+// Collect removes the files that weren't read since the last call, and
+// whose keep func returns false.
+func (w *fileWatcher) Collect(keep func(name string) bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for name, file := range w.files {
+		if !file.read && !file.global && !keep(name) {
+			w.logger.InfoV(2, "stopping watch of file %s", file.path)
+			delete(w.files, name)
+		} else {
+			file.read = false
+		}
+	}
+}
+
+func (w *fileWatcher) check() {
+	w.mutex.Lock()
+	names := make([]string, 0, len(w.files))
+	paths := make(map[string]string, len(w.files))
+	for name, file := range w.files {
+		names = append(names, name)
+		paths[name] = file.path
+	}
+	w.mutex.Unlock()
+	sort.Strings(names)
+	for _, name := range names {
+		path := paths[name]
+		var hash string
+		if content, err := ioutil.ReadFile(path); err == nil {
+			hash = sha1Hash(content)
+		}
+		w.mutex.Lock()
+		file, found := w.files[name]
+		// a missing file has an empty hash, and is notified as well
+		changed := found && file.hash != hash
+		var global bool
+		if changed {
+			file.hash = hash
+			global = file.global
+		}
+		w.mutex.Unlock()
+		if changed {
+			w.logger.InfoV(2, "file %s changed", path)
+			w.notify(name, global)
+		}
+	}
+}
+
+func sha1Hash(content []byte) string {
+	hash := sha1.Sum(content)
+	return hex.EncodeToString(hash[:])
+}
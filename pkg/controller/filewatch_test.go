@@ -0,0 +1,127 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	types_helper "github.com/jcmoraisjr/haproxy-ingress/pkg/types/helper_test"
+)
+
+func TestFileWatchName(t *testing.T) {
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		// 0
+		{
+			path:     "/mnt/secrets/tls.pem",
+			expected: "file::mnt:secrets/tls.pem",
+		},
+		// 1
+		{
+			path:     "/mnt//secrets/../tls.pem",
+			expected: "file::mnt/tls.pem",
+		},
+		// 2
+		{
+			path:     "/tls.pem",
+			expected: "file::/tls.pem",
+		},
+	}
+	for i, test := range testCases {
+		if actual := fileWatchName(test.path); actual != test.expected {
+			t.Errorf("%d: expected '%s' but was '%s'", i, test.expected, actual)
+		}
+	}
+}
+
+func TestFileWatcher(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempdir)
+	writeFile := func(name, content string) string {
+		path := filepath.Join(tempdir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("error writing %s: %v", path, err)
+		}
+		return path
+	}
+	crt := writeFile("tls.pem", "crt1")
+	users := writeFile("users", "user1")
+	dh := writeFile("dhparam.pem", "dh1")
+
+	var notified []string
+	logger := types_helper.NewLoggerMock(t)
+	w := newFileWatcher(logger, func(name string, global bool) {
+		notified = append(notified, fmt.Sprintf("%s:%t", name, global))
+	})
+	check := func(step string, expNotified ...string) {
+		notified = nil
+		w.check()
+		if fmt.Sprint(notified) != fmt.Sprint(expNotified) {
+			t.Errorf("%s: expected notified %v but was %v", step, expNotified, notified)
+		}
+	}
+
+	content, hash, err := w.Read(crt, false)
+	if err != nil || string(content) != "crt1" || hash != sha1Hash([]byte("crt1")) {
+		t.Errorf("unexpected read of %s: %s %s %v", crt, content, hash, err)
+	}
+	_, _, _ = w.Read(users, false)
+	_, _, _ = w.Read(dh, true)
+	if _, _, err := w.Read(filepath.Join(tempdir, "missing"), false); err == nil {
+		t.Errorf("expected error reading a missing file")
+	}
+	check("unchanged")
+
+	writeFile("tls.pem", "crt2")
+	check("changed", fileWatchName(crt)+":false")
+	check("notified")
+
+	writeFile("dhparam.pem", "dh2")
+	_ = os.Remove(users)
+	check("removed", fileWatchName(dh)+":true", fileWatchName(users)+":false")
+	check("notified removed")
+
+	// crt is tracked, users isn't, dh is global
+	keep := func(name string) bool { return name == fileWatchName(crt) }
+	w.Collect(keep)
+	w.Collect(keep)
+	var watching []string
+	for name := range w.files {
+		watching = append(watching, name)
+	}
+	if len(watching) != 2 || w.files[fileWatchName(crt)] == nil || w.files[fileWatchName(dh)] == nil {
+		t.Errorf("expected watching tls.pem and dhparam.pem but was %v", watching)
+	}
+
+	logger.CompareLogging(fmt.Sprintf(`
+INFO-V(2) starting watch of file %[1]s/tls.pem
+INFO-V(2) starting watch of file %[1]s/users
+INFO-V(2) starting watch of file %[1]s/dhparam.pem
+INFO-V(2) file %[1]s/tls.pem changed
+INFO-V(2) file %[1]s/dhparam.pem changed
+INFO-V(2) file %[1]s/users changed
+INFO-V(2) stopping watch of file %[1]s/users`, tempdir))
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"sync"
+
+	networking "k8s.io/api/networking/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	k8s "k8s.io/client-go/kubernetes"
+
+	hatypes "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/types"
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/types"
+)
+
+// Labels added to the objects created by the controller.
+const (
+	managedByLabel           = "app.kubernetes.io/managed-by"
+	managedByValue           = "haproxy-ingress"
+	componentLabel           = "app.kubernetes.io/component"
+	controllerLabel          = "haproxy-ingress.github.io/controller"
+	acmeAccountComponent     = "acme-account"
+	acmeTokensComponent      = "acme-tokens"
+	acmeOrdersComponent      = "acme-orders"
+	acmeCertificateComponent = "acme-certificate"
+)
+
+func managedLabels(controllerID, component string) map[string]string {
+	return map[string]string{
+		managedByLabel:  managedByValue,
+		componentLabel:  component,
+		controllerLabel: controllerID,
+	}
+}
+
+// buildControllerID returns the identity of a group of controller replicas,
+// used to distinguish the objects of distinct controllers in the same
+// cluster. The acme election ID is used, it is already distinct per class.
+// Long IDs are hashed to fit in a label value.
+func buildControllerID(electionID, ingressClass string) string {
+	id := fmt.Sprintf("%s-%s", electionID, ingressClass)
+	if len(validation.IsValidLabelValue(id)) == 0 {
+		return id
+	}
+	return fmt.Sprintf("%x", sha1.Sum([]byte(id)))
+}
+
+// acmeJanitor removes the certificates issued by the acme signer of this
+// controller which are not in use anymore. A certificate is in use if it is
+// an acme storage of the last haproxy update, added either by an ingress
+// resource or by the tcp-services ConfigMap, or if an ingress resource
+// references it. A certificate is only removed if it is found orphaned in
+// two consecutive cleanups, so an ingress which was just created has the
+// time to be read by the cache.
+type acmeJanitor struct {
+	logger       types.Logger
+	client       k8s.Interface
+	namespace    string
+	controllerID string
+	ingresses    func() ([]*networking.Ingress, error)
+	orphans      map[string]bool
+	mutex        sync.Mutex
+	storages     map[string]bool
+}
+
+// update copies the acme storages from the model, the model itself isn't
+// thread safe and cannot be read by the cleanup. Should be called from the
+// same goroutine that updates the model.
+func (j *acmeJanitor) update(storages *hatypes.AcmeStorages) {
+	names := storages.Names()
+	inUse := make(map[string]bool, len(names))
+	for _, name := range names {
+		inUse[name] = true
+	}
+	j.mutex.Lock()
+	j.storages = inUse
+	j.mutex.Unlock()
+}
+
+func (j *acmeJanitor) cleanup(ctx context.Context) {
+	j.mutex.Lock()
+	storages := j.storages
+	j.mutex.Unlock()
+	if storages == nil {
+		// no update applied yet
+		return
+	}
+	ingresses, err := j.ingresses()
+	if err != nil {
+		j.logger.Warn("error listing ingress resources, skipping certificate cleanup: %v", err)
+		return
+	}
+	inUse := make(map[string]bool, len(storages))
+	for name := range storages {
+		inUse[name] = true
+	}
+	for _, ing := range ingresses {
+		for _, tls := range ing.Spec.TLS {
+			if tls.SecretName != "" {
+				inUse[ing.Namespace+"/"+tls.SecretName] = true
+			}
+		}
+	}
+	selector := labels.SelectorFromSet(managedLabels(j.controllerID, acmeCertificateComponent)).String()
+	secrets, err := j.client.CoreV1().Secrets(j.namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		j.logger.Warn("error listing acme certificates: %v", err)
+		return
+	}
+	orphans := map[string]bool{}
+	for _, secret := range secrets.Items {
+		name := secret.Namespace + "/" + secret.Name
+		if inUse[name] {
+			continue
+		}
+		if !j.orphans[name] {
+			orphans[name] = true
+			continue
+		}
+		err := j.client.CoreV1().Secrets(secret.Namespace).Delete(ctx, secret.Name, metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{ResourceVersion: &secret.ResourceVersion},
+		})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			j.logger.Warn("error removing orphaned acme certificate '%s': %v", name, err)
+			orphans[name] = true
+			continue
+		}
+		j.logger.Info("removed orphaned acme certificate '%s'", name)
+	}
+	j.orphans = orphans
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	hatypes "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/types"
+	types_helper "github.com/jcmoraisjr/haproxy-ingress/pkg/types/helper_test"
+)
+
+func TestAcmeJanitor(t *testing.T) {
+	secret := func(name, controllerID, component string) *api.Secret {
+		s := &api.Secret{ObjectMeta: meta.ObjectMeta{Namespace: "default", Name: name}}
+		if component != "" {
+			s.Labels = managedLabels(controllerID, component)
+		}
+		return s
+	}
+	ingress := func(secretName string) *networking.Ingress {
+		return &networking.Ingress{
+			ObjectMeta: meta.ObjectMeta{Namespace: "default", Name: "app-" + secretName},
+			Spec: networking.IngressSpec{
+				TLS: []networking.IngressTLS{{SecretName: secretName}},
+			},
+		}
+	}
+	client := fake.NewSimpleClientset(
+		secret("crt1", "ctrl1", acmeCertificateComponent),
+		secret("crt2", "ctrl1", acmeCertificateComponent),
+		secret("crt3", "ctrl1", acmeCertificateComponent),
+		secret("crt4", "ctrl1", acmeCertificateComponent),
+		secret("other", "ctrl2", acmeCertificateComponent),
+		secret("acme-private-key", "ctrl1", acmeAccountComponent),
+		secret("user", "", ""),
+	)
+	var ingresses []*networking.Ingress
+	janitor := &acmeJanitor{
+		logger:       types_helper.NewLoggerMock(t),
+		client:       client,
+		controllerID: "ctrl1",
+		ingresses:    func() ([]*networking.Ingress, error) { return ingresses, nil },
+	}
+	secrets := func() []string {
+		list, _ := client.CoreV1().Secrets("default").List(context.Background(), meta.ListOptions{})
+		var names []string
+		for _, s := range list.Items {
+			names = append(names, s.Name)
+		}
+		sort.Strings(names)
+		return names
+	}
+	testCases := []struct {
+		ingresses  []*networking.Ingress
+		storages   []string
+		expSecrets []string
+	}{
+		// 0 - no update applied yet, nothing is removed
+		{
+			expSecrets: []string{"acme-private-key", "crt1", "crt2", "crt3", "crt4", "other", "user"},
+		},
+		// 1 - orphans are only removed in the second cleanup
+		{
+			ingresses:  []*networking.Ingress{ingress("crt1")},
+			storages:   []string{"default/crt1", "default/crt4"},
+			expSecrets: []string{"acme-private-key", "crt1", "crt2", "crt3", "crt4", "other", "user"},
+		},
+		// 2 - crt3 is referenced again before being removed
+		{
+			ingresses:  []*networking.Ingress{ingress("crt1"), ingress("crt3")},
+			storages:   []string{"default/crt1", "default/crt4"},
+			expSecrets: []string{"acme-private-key", "crt1", "crt3", "crt4", "other", "user"},
+		},
+		// 3 - crt4 is an acme storage of a TCP service, no ingress references it
+		{
+			storages:   []string{"default/crt4"},
+			expSecrets: []string{"acme-private-key", "crt1", "crt3", "crt4", "other", "user"},
+		},
+		// 4
+		{
+			storages:   []string{},
+			expSecrets: []string{"acme-private-key", "crt4", "other", "user"},
+		},
+	}
+	for i, test := range testCases {
+		ingresses = test.ingresses
+		if test.storages != nil {
+			acme := &hatypes.AcmeData{}
+			for _, storage := range test.storages {
+				acme.Storages().Acquire(storage)
+			}
+			janitor.update(acme.Storages())
+		}
+		janitor.cleanup(context.Background())
+		if names := secrets(); !reflect.DeepEqual(names, test.expSecrets) {
+			t.Errorf("%d: expected secrets %v but was %v", i, test.expSecrets, names)
+		}
+	}
+}
+
+func TestBuildControllerID(t *testing.T) {
+	testCases := []struct {
+		electionID string
+		class      string
+		expected   string
+	}{
+		// 0
+		{
+			electionID: "acme-leader",
+			class:      "haproxy",
+			expected:   "acme-leader-haproxy",
+		},
+		// 1
+		{
+			electionID: "acme-leader",
+			class:      "haproxy.example.com/internal-ingress-class-with-a-long-name",
+			expected:   "187a0a5769dcfc4fb6fdee8d27c09803531158c3",
+		},
+	}
+	for i, test := range testCases {
+		if id := buildControllerID(test.electionID, test.class); id != test.expected {
+			t.Errorf("%d: expected controller id %s but was %s", i, test.expected, id)
+		}
+	}
+}
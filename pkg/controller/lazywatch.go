@@ -0,0 +1,217 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sync"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/types"
+)
+
+// lazyWatcher watches objects of a single resource type, starting a
+// distinct watch for each object only after it's read for the first
+// time. Objects are stored in a shared indexer, used by the listers.
+type lazyWatcher struct {
+	logger    types.Logger
+	resource  string
+	objType   runtime.Object
+	resync    time.Duration
+	newLW     func(namespace, name string) cache.ListerWatcher
+	getObj    func(namespace, name string) (runtime.Object, error)
+	transform TransformFunc
+	handler   cache.ResourceEventHandler
+	indexer   cache.Indexer
+	mutex     sync.Mutex
+	stopCh    <-chan struct{}
+	watches   map[string]chan struct{}
+	readNames map[string]bool
+}
+
+func newLazyWatcher(
+	logger types.Logger,
+	restClient rest.Interface,
+	resource string,
+	objType runtime.Object,
+	resync time.Duration,
+	transform TransformFunc,
+	getObj func(namespace, name string) (runtime.Object, error),
+	handler cache.ResourceEventHandler,
+) *lazyWatcher {
+	newLW := func(namespace, name string) cache.ListerWatcher {
+		var lw cache.ListerWatcher = cache.NewFilteredListWatchFromClient(restClient, resource, namespace, func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		})
+		if transform != nil {
+			lw = transformListWatch(lw, transform)
+		}
+		return lw
+	}
+	return &lazyWatcher{
+		logger:    logger,
+		resource:  resource,
+		objType:   objType,
+		resync:    resync,
+		newLW:     newLW,
+		getObj:    getObj,
+		transform: transform,
+		handler:   handler,
+		indexer:   cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}),
+		watches:   map[string]chan struct{}{},
+		readNames: map[string]bool{},
+	}
+}
+
+// Run starts the watches registered before the watcher was running, and
+// stops all the watches when stopCh is closed.
+func (w *lazyWatcher) Run(stopCh <-chan struct{}) {
+	w.mutex.Lock()
+	w.stopCh = stopCh
+	for key := range w.watches {
+		w.startWatch(key)
+	}
+	w.mutex.Unlock()
+	go func() {
+		<-stopCh
+		w.mutex.Lock()
+		defer w.mutex.Unlock()
+		for key := range w.watches {
+			w.stopWatch(key)
+		}
+	}()
+}
+
+// Get returns an object from the indexer, reading it from the apiserver
+// and starting its watch if the object is not being watched yet.
+func (w *lazyWatcher) Get(namespace, name string) (runtime.Object, error) {
+	key := namespace + "/" + name
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.readNames[key] = true
+	if _, found := w.watches[key]; found {
+		obj, exists, err := w.indexer.GetByKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, k8serrors.NewNotFound(schema.GroupResource{Resource: w.resource}, name)
+		}
+		return obj.(runtime.Object), nil
+	}
+	obj, err := w.getObj(namespace, name)
+	if err == nil {
+		if w.transform != nil {
+			w.transform(obj)
+		}
+		if err := w.indexer.Add(obj); err != nil {
+			return nil, err
+		}
+	} else if !k8serrors.IsNotFound(err) {
+		// watch only if we know if the object exists or not
+		return nil, err
+	}
+	w.watches[key] = nil
+	if w.stopCh != nil {
+		w.startWatch(key)
+	}
+	return obj, err
+}
+
+// Watch starts the watch of an object without reading it from the
+// apiserver, so its event handler is notified on the watch initialization.
+func (w *lazyWatcher) Watch(key string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if _, found := w.watches[key]; found {
+		return
+	}
+	w.watches[key] = nil
+	if w.stopCh != nil {
+		w.startWatch(key)
+	}
+}
+
+// Collect stops the watch of the objects that weren't read since the
+// last call, and whose keep func returns false.
+func (w *lazyWatcher) Collect(keep func(key string) bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for key := range w.watches {
+		if !w.readNames[key] && !keep(key) {
+			w.logger.InfoV(2, "stopping watch of %s %s", w.resource, key)
+			w.stopWatch(key)
+			delete(w.watches, key)
+			if obj, exists, _ := w.indexer.GetByKey(key); exists {
+				_ = w.indexer.Delete(obj)
+			}
+		}
+	}
+	w.readNames = map[string]bool{}
+}
+
+func (w *lazyWatcher) startWatch(key string) {
+	namespace, name, _ := cache.SplitMetaNamespaceKey(key)
+	w.logger.InfoV(2, "starting watch of %s %s", w.resource, key)
+	_, controller := cache.NewInformer(w.newLW(namespace, name), w.objType, w.resync, cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			old, exists, _ := w.indexer.Get(obj)
+			_ = w.indexer.Add(obj)
+			if !exists {
+				w.handler.OnAdd(obj)
+			} else if resourceVersion(old) != resourceVersion(obj) {
+				w.handler.OnUpdate(old, obj)
+			}
+		},
+		UpdateFunc: func(old, cur interface{}) {
+			_ = w.indexer.Update(cur)
+			w.handler.OnUpdate(old, cur)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			_ = w.indexer.Delete(obj)
+			w.handler.OnDelete(obj)
+		},
+	})
+	stop := make(chan struct{})
+	w.watches[key] = stop
+	go controller.Run(stop)
+}
+
+func (w *lazyWatcher) stopWatch(key string) {
+	if stop := w.watches[key]; stop != nil {
+		close(stop)
+		w.watches[key] = nil
+	}
+}
+
+func resourceVersion(obj interface{}) string {
+	if m, err := meta.Accessor(obj); err == nil {
+		return m.GetResourceVersion()
+	}
+	return ""
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	api "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	types_helper "github.com/jcmoraisjr/haproxy-ingress/pkg/types/helper_test"
+)
+
+func TestLazyWatcher(t *testing.T) {
+	ctx := context.Background()
+	// one secret per namespace, the fake clientset doesn't filter by name
+	client := fake.NewSimpleClientset(
+		&api.Secret{ObjectMeta: meta.ObjectMeta{Namespace: "ns1", Name: "secret1", ResourceVersion: "1"}},
+	)
+	logger := types_helper.NewLoggerMock(t)
+	var mutex sync.Mutex
+	var events, gets []string
+	addEvent := func(event string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		events = append(events, event)
+	}
+	w := newLazyWatcher(logger, nil, "secrets", &api.Secret{}, 0, nil,
+		func(namespace, name string) (runtime.Object, error) {
+			gets = append(gets, namespace+"/"+name)
+			return client.CoreV1().Secrets(namespace).Get(ctx, name, meta.GetOptions{})
+		},
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				addEvent("add/" + obj.(*api.Secret).Name)
+			},
+			UpdateFunc: func(old, cur interface{}) {
+				addEvent("update/" + cur.(*api.Secret).Name)
+			},
+		})
+	w.newLW = func(namespace, name string) cache.ListerWatcher {
+		return &cache.ListWatch{
+			ListFunc: func(options meta.ListOptions) (runtime.Object, error) {
+				return client.CoreV1().Secrets(namespace).List(ctx, options)
+			},
+			WatchFunc: func(options meta.ListOptions) (watch.Interface, error) {
+				return client.CoreV1().Secrets(namespace).Watch(ctx, options)
+			},
+		}
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	w.Run(stopCh)
+
+	// read twice, apiserver should be called only once
+	for i := 0; i < 2; i++ {
+		if _, err := w.Get("ns1", "secret1"); err != nil {
+			t.Errorf("unexpected error reading secret1: %v", err)
+		}
+	}
+	if _, err := w.Get("ns2", "secret2"); !k8serrors.IsNotFound(err) {
+		t.Errorf("expected not found reading secret2, but was: %v", err)
+	}
+	if expected := []string{"ns1/secret1", "ns2/secret2"}; !reflect.DeepEqual(gets, expected) {
+		t.Errorf("apiserver calls differ, expected %v but was %v", expected, gets)
+	}
+
+	// missing secret is created, watch should notify the event handler
+	time.Sleep(100 * time.Millisecond)
+	_, _ = client.CoreV1().Secrets("ns2").Create(ctx,
+		&api.Secret{ObjectMeta: meta.ObjectMeta{Namespace: "ns2", Name: "secret2", ResourceVersion: "1"}},
+		meta.CreateOptions{})
+	time.Sleep(100 * time.Millisecond)
+	mutex.Lock()
+	if expected := []string{"add/secret2"}; !reflect.DeepEqual(events, expected) {
+		t.Errorf("events differ, expected %v but was %v", expected, events)
+	}
+	mutex.Unlock()
+	if _, err := w.Get("ns2", "secret2"); err != nil {
+		t.Errorf("unexpected error reading secret2: %v", err)
+	}
+
+	// secret1 isn't read anymore
+	w.Collect(func(key string) bool { return false })
+	w.Collect(func(key string) bool { return key == "ns2/secret2" })
+	if _, found := w.watches["ns1/secret1"]; found {
+		t.Errorf("expected watch of secret1 to be stopped")
+	}
+	if _, found := w.watches["ns2/secret2"]; !found {
+		t.Errorf("expected watch of secret2 to be kept")
+	}
+	if _, exists, _ := w.indexer.GetByKey("ns1/secret1"); exists {
+		t.Errorf("expected secret1 to be removed from the indexer")
+	}
+
+	logger.CompareLogging(`
+INFO-V(2) starting watch of secrets ns1/secret1
+INFO-V(2) starting watch of secrets ns2/secret2
+INFO-V(2) stopping watch of secrets ns1/secret1`)
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/pflag"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy"
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/types"
+)
+
+// Lint implements the lint subcommand: reads ingress resources, and
+// optionally their dependencies, runs the converters and reports the
+// warnings and errors of the annotations, prefixed with the file name
+// and line of the resource. Services not found are created without
+// endpoints, so the annotations of their backends are parsed as well.
+func Lint(args []string, stdout, stderr io.Writer) error {
+	flags := pflag.NewFlagSet("lint", pflag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var opt renderOptions
+	opt.addFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		if err == pflag.ErrHelp {
+			return nil
+		}
+		return err
+	}
+	objects, err := opt.loadCache()
+	if err != nil {
+		return err
+	}
+	logger := &renderLogger{out: stdout, objects: objects}
+	if issues := opt.lint(logger, objects, createMetrics(nil)); issues > 0 {
+		return fmt.Errorf("found %d issue(s)", issues)
+	}
+	return nil
+}
+
+// lint runs the converters and returns the number of warnings and errors
+// reported by them.
+func (o *renderOptions) lint(logger *renderLogger, objects *renderCache, metrics types.Metrics) int {
+	objects.addMissingServices()
+	instance := haproxy.CreateInstance(logger, haproxy.InstanceOptions{Metrics: metrics})
+	o.convert(logger, objects, metrics, instance.Config())
+	return logger.issues
+}
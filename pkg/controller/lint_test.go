@@ -0,0 +1,131 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	types_helper "github.com/jcmoraisjr/haproxy-ingress/pkg/types/helper_test"
+)
+
+func TestLint(t *testing.T) {
+	testCases := []struct {
+		resources string
+		expIssues int
+		expOutput string
+	}{
+		// 0
+		{
+			resources: `
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: app
+  annotations:
+    ingress.kubernetes.io/timeout-server: 10s
+spec:
+  rules:
+  - host: app.local
+    http:
+      paths:
+      - path: /
+        pathType: Prefix
+        backend:
+          service:
+            name: app
+            port:
+              name: http
+`,
+		},
+		// 1
+		{
+			resources: `# first ingress
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: app1
+  annotations:
+    ingress.kubernetes.io/timeout-server: 10x
+spec:
+  defaultBackend:
+    service:
+      name: app
+      port:
+        number: 8080
+---
+
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: app2
+  namespace: app
+  annotations:
+    ingress.kubernetes.io/ssl-redirect: invalid
+spec:
+  rules:
+  - host: app.local
+    http:
+      paths:
+      - path: /
+        pathType: Prefix
+        backend:
+          service:
+            name: app
+            port:
+              number: 8080
+`,
+			expIssues: 2,
+			expOutput: `
+ingress.yaml:16: warning: ignoring invalid bool expression on ingress 'app/app2' key 'ssl-redirect': invalid
+ingress.yaml:2: warning: ignoring invalid time format on ingress 'default/app1': 10x`,
+		},
+	}
+	tempdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempdir)
+	for i, test := range testCases {
+		resources := filepath.Join(tempdir, "ingress.yaml")
+		if err := ioutil.WriteFile(resources, []byte(test.resources), 0644); err != nil {
+			t.Fatalf("error writing resources: %v", err)
+		}
+		opt := &renderOptions{
+			filenames: []string{resources},
+			annPrefix: "ingress.kubernetes.io",
+		}
+		objects, err := opt.loadCache()
+		if err != nil {
+			t.Errorf("%d: error loading resources: %v", i, err)
+			continue
+		}
+		out := &bytes.Buffer{}
+		issues := opt.lint(&renderLogger{out: out, objects: objects}, objects, types_helper.NewMetricsMock())
+		if issues != test.expIssues {
+			t.Errorf("%d: expected %d issue(s) but was %d", i, test.expIssues, issues)
+		}
+		output := strings.ReplaceAll(out.String(), resources, "ingress.yaml")
+		if strings.TrimSpace(output) != strings.TrimSpace(test.expOutput) {
+			t.Errorf("%d: expected output '%s' but was '%s'", i, test.expOutput, output)
+		}
+	}
+}
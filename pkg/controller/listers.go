@@ -17,13 +17,18 @@ limitations under the License.
 package controller
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"time"
 
 	api "k8s.io/api/core/v1"
 	networking "k8s.io/api/networking/v1"
-	"k8s.io/apimachinery/pkg/util/runtime"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/informers"
 	informerscore "k8s.io/client-go/informers/core/v1"
 	informersnetworking "k8s.io/client-go/informers/networking/v1"
@@ -31,6 +36,7 @@ import (
 	"k8s.io/client-go/kubernetes/fake"
 	listerscore "k8s.io/client-go/listers/core/v1"
 	listersnetworking "k8s.io/client-go/listers/networking/v1"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 
@@ -51,8 +57,14 @@ type listers struct {
 	recorder record.EventRecorder
 	running  bool
 	//
-	hasPodLister  bool
-	hasNodeLister bool
+	hasPodLister   bool
+	hasNodeLister  bool
+	secretFiltered bool
+	//
+	secretWatcher    *lazyWatcher
+	configMapWatcher *lazyWatcher
+	// secrets not matching the secret selector, read and watched on demand
+	unmatchedSecretWatcher *lazyWatcher
 	//
 	ingressLister      listersnetworking.IngressLister
 	ingressClassLister listersnetworking.IngressClassLister
@@ -81,36 +93,102 @@ func createListers(
 	watchNamespace string,
 	isolateNamespace bool,
 	podWatch bool,
-	resync time.Duration,
+	transform bool,
+	secretSelector secretSelector,
+	lazyWatch bool,
+	resyncConfig resyncConfig,
 ) *listers {
 	clusterWatch := watchNamespace == api.NamespaceAll
 	clusterOption := informers.WithTweakListOptions(nil)
 	namespaceOption := informers.WithNamespace(watchNamespace)
+	resyncPeriods := resyncConfig.periods()
+	resync := resyncPeriods[resyncDefault]
+	resyncOption := informers.WithCustomResyncConfig(map[metav1.Object]time.Duration{
+		&networking.Ingress{}:      resyncPeriods["ingresses"],
+		&networking.IngressClass{}: resyncPeriods["ingressclasses"],
+		&api.Endpoints{}:           resyncPeriods["endpoints"],
+		&api.Service{}:             resyncPeriods["services"],
+		&api.Secret{}:              resyncPeriods["secrets"],
+		&api.ConfigMap{}:           resyncPeriods["configmaps"],
+		&api.Pod{}:                 resyncPeriods["pods"],
+	})
 	var ingressInformer, resourceInformer, localInformer informers.SharedInformerFactory
+	resourceNamespace := watchNamespace
 	if clusterWatch {
-		ingressInformer = informers.NewSharedInformerFactoryWithOptions(client, resync, clusterOption)
+		ingressInformer = informers.NewSharedInformerFactoryWithOptions(client, resync, clusterOption, resyncOption)
 		resourceInformer = ingressInformer
 	} else if isolateNamespace {
-		ingressInformer = informers.NewSharedInformerFactoryWithOptions(client, resync, namespaceOption)
+		ingressInformer = informers.NewSharedInformerFactoryWithOptions(client, resync, namespaceOption, resyncOption)
 		resourceInformer = ingressInformer
 	} else {
-		ingressInformer = informers.NewSharedInformerFactoryWithOptions(client, resync, namespaceOption)
-		resourceInformer = informers.NewSharedInformerFactoryWithOptions(client, resync, clusterOption)
+		ingressInformer = informers.NewSharedInformerFactoryWithOptions(client, resync, namespaceOption, resyncOption)
+		resourceInformer = informers.NewSharedInformerFactoryWithOptions(client, resync, clusterOption, resyncOption)
+		resourceNamespace = api.NamespaceAll
+	}
+	var transformFunc TransformFunc
+	if transform {
+		transformFunc = transformObject
+	}
+	var secretTweak func(*metav1.ListOptions)
+	if secretSelector.filtered() {
+		secretTweak = func(options *metav1.ListOptions) {
+			options.LabelSelector = secretSelector.LabelSelector
+			if secretSelector.TLSOnly {
+				options.FieldSelector = fields.OneTermEqualSelector("type", string(api.SecretTypeTLS)).String()
+			}
+		}
+	}
+	if !lazyWatch && (transformFunc != nil || secretTweak != nil) {
+		registerInformer(resourceInformer, client.CoreV1().RESTClient(), "secrets", resourceNamespace, &api.Secret{}, secretTweak, transformFunc)
+	}
+	if transformFunc != nil {
+		core := client.CoreV1().RESTClient()
+		registerInformer(ingressInformer, client.NetworkingV1().RESTClient(), "ingresses", watchNamespace, &networking.Ingress{}, nil, transformFunc)
+		registerInformer(resourceInformer, core, "endpoints", resourceNamespace, &api.Endpoints{}, nil, transformFunc)
+		registerInformer(resourceInformer, core, "services", resourceNamespace, &api.Service{}, nil, transformFunc)
+		if !lazyWatch {
+			registerInformer(resourceInformer, core, "configmaps", resourceNamespace, &api.ConfigMap{}, nil, transformFunc)
+		}
+		if podWatch {
+			registerInformer(ingressInformer, core, "pods", watchNamespace, &api.Pod{}, nil, transformFunc)
+		}
 	}
 	if !podWatch || !clusterWatch {
 		localInformer = informers.NewSharedInformerFactory(fake.NewSimpleClientset(), 0)
 	}
 	l := &listers{
-		events:   events,
-		recorder: recorder,
-		logger:   logger,
+		events:         events,
+		recorder:       recorder,
+		logger:         logger,
+		secretFiltered: secretSelector.filtered(),
 	}
 	l.createIngressLister(ingressInformer.Networking().V1().Ingresses())
 	l.createIngressClassLister(ingressInformer.Networking().V1().IngressClasses())
 	l.createEndpointLister(resourceInformer.Core().V1().Endpoints())
 	l.createServiceLister(resourceInformer.Core().V1().Services())
-	l.createSecretLister(resourceInformer.Core().V1().Secrets())
-	l.createConfigMapLister(resourceInformer.Core().V1().ConfigMaps())
+	if lazyWatch {
+		core := client.CoreV1()
+		l.secretWatcher = newLazyWatcher(logger, core.RESTClient(), "secrets", &api.Secret{}, resyncPeriods["secrets"], transformFunc,
+			func(namespace, name string) (runtime.Object, error) {
+				return core.Secrets(namespace).Get(context.Background(), name, metav1.GetOptions{})
+			}, l.secretEventHandler())
+		l.secretLister = listerscore.NewSecretLister(l.secretWatcher.indexer)
+		l.configMapWatcher = newLazyWatcher(logger, core.RESTClient(), "configmaps", &api.ConfigMap{}, resyncPeriods["configmaps"], transformFunc,
+			func(namespace, name string) (runtime.Object, error) {
+				return core.ConfigMaps(namespace).Get(context.Background(), name, metav1.GetOptions{})
+			}, l.configMapEventHandler())
+		l.configMapLister = listerscore.NewConfigMapLister(l.configMapWatcher.indexer)
+	} else {
+		l.createSecretLister(resourceInformer.Core().V1().Secrets())
+		l.createConfigMapLister(resourceInformer.Core().V1().ConfigMaps())
+		if l.secretFiltered {
+			core := client.CoreV1()
+			l.unmatchedSecretWatcher = newLazyWatcher(logger, core.RESTClient(), "secrets", &api.Secret{}, resyncPeriods["secrets"], transformFunc,
+				func(namespace, name string) (runtime.Object, error) {
+					return core.Secrets(namespace).Get(context.Background(), name, metav1.GetOptions{})
+				}, l.secretEventHandler())
+		}
+	}
 	if podWatch {
 		l.createPodLister(ingressInformer.Core().V1().Pods())
 		l.hasPodLister = true
@@ -127,9 +205,81 @@ func createListers(
 	return l
 }
 
+// resyncDefault is the resource name used by resyncConfig to refer to
+// the resync period of all the resource types without their own period.
+const resyncDefault = "*"
+
+// resyncConfig has the resync period of the informers, optionally
+// overridden by resource type. Resyncs of distinct resource types, and of
+// distinct controller instances, are spread by a random jitter.
+type resyncConfig struct {
+	period    time.Duration
+	resources map[string]time.Duration
+	jitter    float64
+}
+
+// periods returns the resync period of every supported resource type,
+// and of resyncDefault, with the jitter already applied.
+func (r resyncConfig) periods() map[string]time.Duration {
+	periods := map[string]time.Duration{}
+	for _, resource := range []string{resyncDefault, "ingresses", "ingressclasses", "endpoints", "services", "secrets", "configmaps", "pods"} {
+		period, found := r.resources[resource]
+		if !found {
+			period = r.period
+		}
+		if r.jitter > 0 {
+			period = wait.Jitter(period, r.jitter)
+		}
+		periods[resource] = period
+	}
+	return periods
+}
+
+// secretSelector restricts the secrets watched and listed by the secret
+// informer. Secrets not matching the selector are read and watched on
+// demand, like the secrets of the lazy watch.
+type secretSelector struct {
+	LabelSelector string
+	TLSOnly       bool
+}
+
+func (s secretSelector) filtered() bool {
+	return s.LabelSelector != "" || s.TLSOnly
+}
+
+// registerInformer registers in the factory an informer of objType whose
+// list and watch options are changed by tweak, and whose objects are
+// changed by transform before added to the cache. Both tweak and transform
+// are optional. Should be called before the typed informer of objType is
+// requested to the factory.
+func registerInformer(
+	factory informers.SharedInformerFactory,
+	restClient rest.Interface,
+	resource, namespace string,
+	objType runtime.Object,
+	tweak func(*metav1.ListOptions),
+	transform TransformFunc,
+) {
+	factory.InformerFor(objType, func(client k8s.Interface, resync time.Duration) cache.SharedIndexInformer {
+		if tweak == nil {
+			tweak = func(*metav1.ListOptions) {}
+		}
+		var lw cache.ListerWatcher = cache.NewFilteredListWatchFromClient(restClient, resource, namespace, tweak)
+		if transform != nil {
+			lw = transformListWatch(lw, transform)
+		}
+		return cache.NewSharedIndexInformer(
+			lw,
+			objType,
+			resync,
+			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+		)
+	})
+}
+
 func (l *listers) RunAsync(stopCh <-chan struct{}) {
 	syncFailed := func() {
-		runtime.HandleError(fmt.Errorf("initial cache sync has timed out or shutdown has requested"))
+		utilruntime.HandleError(fmt.Errorf("initial cache sync has timed out or shutdown has requested"))
 	}
 	l.logger.Info("loading object cache...")
 
@@ -144,22 +294,29 @@ func (l *listers) RunAsync(stopCh <-chan struct{}) {
 	}
 
 	// initialize listers and informers
-	go l.ingressInformer.Run(stopCh)
-	go l.endpointInformer.Run(stopCh)
-	go l.serviceInformer.Run(stopCh)
-	go l.secretInformer.Run(stopCh)
-	go l.configMapInformer.Run(stopCh)
-	go l.podInformer.Run(stopCh)
-	go l.nodeInformer.Run(stopCh)
-	synced := cache.WaitForCacheSync(stopCh,
-		l.ingressInformer.HasSynced,
-		l.endpointInformer.HasSynced,
-		l.serviceInformer.HasSynced,
-		l.secretInformer.HasSynced,
-		l.configMapInformer.HasSynced,
-		l.podInformer.HasSynced,
-		l.nodeInformer.HasSynced,
-	)
+	informerList := []cache.SharedInformer{
+		l.ingressInformer,
+		l.endpointInformer,
+		l.serviceInformer,
+		l.podInformer,
+		l.nodeInformer,
+	}
+	if l.secretWatcher != nil {
+		// lazy watch, secrets and configmaps are watched only after read by the controller
+		l.secretWatcher.Run(stopCh)
+		l.configMapWatcher.Run(stopCh)
+	} else {
+		informerList = append(informerList, l.secretInformer, l.configMapInformer)
+	}
+	if l.unmatchedSecretWatcher != nil {
+		l.unmatchedSecretWatcher.Run(stopCh)
+	}
+	var hasSynced []cache.InformerSynced
+	for _, informer := range informerList {
+		go informer.Run(stopCh)
+		hasSynced = append(hasSynced, informer.HasSynced)
+	}
+	synced := cache.WaitForCacheSync(stopCh, hasSynced...)
 	if synced {
 		l.logger.Info("cache successfully synced")
 		l.running = true
@@ -315,7 +472,11 @@ func (l *listers) createServiceLister(informer informerscore.ServiceInformer) {
 func (l *listers) createSecretLister(informer informerscore.SecretInformer) {
 	l.secretLister = informer.Lister()
 	l.secretInformer = informer.Informer()
-	l.secretInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+	l.secretInformer.AddEventHandler(l.secretEventHandler())
+}
+
+func (l *listers) secretEventHandler() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			l.events.Notify(nil, obj)
 		},
@@ -339,13 +500,17 @@ func (l *listers) createSecretLister(informer informerscore.SecretInformer) {
 			}
 			l.events.Notify(sec, nil)
 		},
-	})
+	}
 }
 
 func (l *listers) createConfigMapLister(informer informerscore.ConfigMapInformer) {
 	l.configMapLister = informer.Lister()
 	l.configMapInformer = informer.Informer()
-	l.configMapInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+	l.configMapInformer.AddEventHandler(l.configMapEventHandler())
+}
+
+func (l *listers) configMapEventHandler() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			if l.events.IsValidConfigMap(obj.(*api.ConfigMap)) {
 				l.events.Notify(nil, obj)
@@ -365,7 +530,7 @@ func (l *listers) createConfigMapLister(informer informerscore.ConfigMapInformer
 				l.events.Notify(obj, nil)
 			}
 		},
-	})
+	}
 }
 
 func (l *listers) createPodLister(informer informerscore.PodInformer) {
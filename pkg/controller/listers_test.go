@@ -0,0 +1,73 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResyncConfigPeriods(t *testing.T) {
+	testCases := []struct {
+		config   resyncConfig
+		resource string
+		expMin   time.Duration
+		expMax   time.Duration
+	}{
+		// 0
+		{
+			config:   resyncConfig{period: 10 * time.Minute},
+			resource: "ingresses",
+			expMin:   10 * time.Minute,
+			expMax:   10 * time.Minute,
+		},
+		// 1
+		{
+			config:   resyncConfig{period: 10 * time.Minute, resources: map[string]time.Duration{"endpoints": time.Hour}},
+			resource: "endpoints",
+			expMin:   time.Hour,
+			expMax:   time.Hour,
+		},
+		// 2
+		{
+			config:   resyncConfig{period: 10 * time.Minute, resources: map[string]time.Duration{"endpoints": time.Hour}},
+			resource: resyncDefault,
+			expMin:   10 * time.Minute,
+			expMax:   10 * time.Minute,
+		},
+		// 3
+		{
+			config:   resyncConfig{period: 10 * time.Minute, resources: map[string]time.Duration{"secrets": 0}, jitter: 0.5},
+			resource: "secrets",
+			expMin:   0,
+			expMax:   0,
+		},
+		// 4
+		{
+			config:   resyncConfig{period: 10 * time.Minute, jitter: 0.5},
+			resource: "services",
+			expMin:   10 * time.Minute,
+			expMax:   15 * time.Minute,
+		},
+	}
+	for i, test := range testCases {
+		period := test.config.periods()[test.resource]
+		if period < test.expMin || period > test.expMax {
+			t.Errorf("resync period differs on %d, expected between %v and %v but was %v", i, test.expMin, test.expMax, period)
+		}
+	}
+}
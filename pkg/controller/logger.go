@@ -17,13 +17,32 @@ limitations under the License.
 package controller
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
 
 	"github.com/golang/glog"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/annotations"
 )
 
 type logger struct {
 	depth int
+	json  bool
+	out   io.Writer
+	mutex sync.Mutex
+}
+
+type jsonLogEntry struct {
+	Timestamp string `json:"ts"`
+	Level     string `json:"level"`
+	Caller    string `json:"caller,omitempty"`
+	Message   string `json:"msg"`
 }
 
 func (l *logger) build(msg string, args []interface{}) string {
@@ -33,24 +52,98 @@ func (l *logger) build(msg string, args []interface{}) string {
 	return fmt.Sprintf(msg, args...)
 }
 
+func (l *logger) writeJSON(level, msg string) {
+	entry := jsonLogEntry{
+		Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+		Level:     level,
+		Message:   msg,
+	}
+	// depth counts the logger's func, plus one to skip writeJSON
+	if _, file, line, ok := runtime.Caller(l.depth + 1); ok {
+		entry.Caller = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	}
+	out, _ := json.Marshal(entry)
+	w := l.out
+	if w == nil {
+		w = os.Stderr
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	_, _ = w.Write(append(out, '\n'))
+}
+
 func (l *logger) InfoV(v int, msg string, args ...interface{}) {
 	if glog.V(glog.Level(v)) {
+		if l.json {
+			l.writeJSON("info", l.build(msg, args))
+			return
+		}
 		glog.InfoDepth(l.depth, l.build(msg, args))
 	}
 }
 
 func (l *logger) Info(msg string, args ...interface{}) {
+	if l.json {
+		l.writeJSON("info", l.build(msg, args))
+		return
+	}
 	glog.InfoDepth(l.depth, l.build(msg, args))
 }
 
 func (l *logger) Warn(msg string, args ...interface{}) {
+	if l.json {
+		l.writeJSON("warning", l.build(msg, args))
+		return
+	}
 	glog.WarningDepth(l.depth, l.build(msg, args))
 }
 
 func (l *logger) Error(msg string, args ...interface{}) {
+	if l.json {
+		l.writeJSON("error", l.build(msg, args))
+		return
+	}
 	glog.ErrorDepth(l.depth, l.build(msg, args))
 }
 
 func (l *logger) Fatal(msg string, args ...interface{}) {
+	if l.json {
+		l.writeJSON("fatal", l.build(msg, args))
+		os.Exit(255)
+	}
 	glog.FatalDepth(l.depth, l.build(msg, args))
 }
+
+// eventLogger logs all the messages in the wrapped logger. Warnings that
+// reference an ingress resource in its arguments are also recorded as a
+// Warning event of that ingress, so users can see configuration issues
+// with `kubectl describe`. The wrapped logger should count one more depth.
+type eventLogger struct {
+	logger        *logger
+	recordWarning func(namespace, name, message string)
+}
+
+func (l *eventLogger) InfoV(v int, msg string, args ...interface{}) {
+	l.logger.InfoV(v, msg, args...)
+}
+
+func (l *eventLogger) Info(msg string, args ...interface{}) {
+	l.logger.Info(msg, args...)
+}
+
+func (l *eventLogger) Warn(msg string, args ...interface{}) {
+	l.logger.Warn(msg, args...)
+	for _, arg := range args {
+		if source, ok := arg.(*annotations.Source); ok && source != nil && source.Type == "ingress" {
+			l.recordWarning(source.Namespace, source.Name, l.logger.build(msg, args))
+		}
+	}
+}
+
+func (l *eventLogger) Error(msg string, args ...interface{}) {
+	l.logger.Error(msg, args...)
+}
+
+func (l *eventLogger) Fatal(msg string, args ...interface{}) {
+	l.logger.Fatal(msg, args...)
+}
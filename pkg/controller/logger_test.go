@@ -0,0 +1,97 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/annotations"
+)
+
+func TestLoggerJSON(t *testing.T) {
+	out := &bytes.Buffer{}
+	l := &logger{depth: 1, json: true, out: out}
+	l.Info("starting %s", "controller")
+	l.Warn("ignoring %q", "quoted \"value\"")
+	l.Error("failed")
+
+	lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	expected := []jsonLogEntry{
+		{Level: "info", Message: "starting controller"},
+		{Level: "warning", Message: `ignoring "quoted \"value\""`},
+		{Level: "error", Message: "failed"},
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d log lines, found %d: %v", len(expected), len(lines), lines)
+	}
+	for i, line := range lines {
+		var entry jsonLogEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Errorf("error parsing log line %d: %v", i, err)
+			continue
+		}
+		if entry.Timestamp == "" {
+			t.Errorf("missing timestamp on log line %d", i)
+		}
+		if !strings.HasPrefix(entry.Caller, "logger_test.go:") {
+			t.Errorf("caller differs on %d - expected: logger_test.go:<line>, actual: %s", i, entry.Caller)
+		}
+		if entry.Level != expected[i].Level || entry.Message != expected[i].Message {
+			t.Errorf("log entry differs on %d - expected: %s/%s, actual: %s/%s", i, expected[i].Level, expected[i].Message, entry.Level, entry.Message)
+		}
+	}
+}
+
+func TestEventLogger(t *testing.T) {
+	out := &bytes.Buffer{}
+	var events []string
+	l := &eventLogger{
+		logger: &logger{depth: 2, json: true, out: out},
+		recordWarning: func(namespace, name, message string) {
+			events = append(events, fmt.Sprintf("%s/%s: %s", namespace, name, message))
+		},
+	}
+	ingSource := &annotations.Source{Namespace: "default", Name: "ing1", Type: "ingress"}
+	svcSource := &annotations.Source{Namespace: "default", Name: "svc1", Type: "service"}
+	l.Info("info on %v", ingSource)
+	l.Warn("invalid config on %v: %s", ingSource, "10e")
+	l.Warn("invalid config on %v: %s", svcSource, "10e")
+	l.Error("error on %v", ingSource)
+
+	expected := []string{`default/ing1: invalid config on ingress 'default/ing1': 10e`}
+	if fmt.Sprint(events) != fmt.Sprint(expected) {
+		t.Errorf("events differs - expected: %v, actual: %v", expected, events)
+	}
+	lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 log lines, found %d: %v", len(lines), lines)
+	}
+	for i, line := range lines {
+		var entry jsonLogEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Errorf("error parsing log line %d: %v", i, err)
+			continue
+		}
+		if !strings.HasPrefix(entry.Caller, "logger_test.go:") {
+			t.Errorf("caller differs on %d - expected: logger_test.go:<line>, actual: %s", i, entry.Caller)
+		}
+	}
+}
@@ -18,6 +18,7 @@ package controller
 
 import (
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -27,12 +28,27 @@ type metrics struct {
 	responseTime       *prometheus.HistogramVec
 	ctlProcTimeSum     *prometheus.CounterVec
 	ctlProcCount       *prometheus.CounterVec
+	ctlProcTime        *prometheus.HistogramVec
+	ingParseTime       prometheus.Histogram
+	templateProcTime   *prometheus.HistogramVec
+	trackedObjGauge    *prometheus.GaugeVec
 	procSecondsCounter *prometheus.CounterVec
+	serversDownGauge   *prometheus.GaugeVec
+	hostConflictGauge  *prometheus.GaugeVec
+	driftGauge         *prometheus.GaugeVec
 	updatesCounter     *prometheus.CounterVec
 	updateSuccessGauge *prometheus.GaugeVec
+	updateFailCounter  *prometheus.CounterVec
+	lastAppliedGauge   *prometheus.GaugeVec
+	stalenessGauge     prometheus.GaugeFunc
 	certExpireGauge    *prometheus.GaugeVec
 	certSigningCounter *prometheus.CounterVec
+	acmeOrdersGauge    *prometheus.GaugeVec
+	acmeFailCounter    *prometheus.CounterVec
 	lastTrack          time.Time
+	mutex              sync.Mutex
+	lastApplied        time.Time
+	pendingSince       func() time.Time
 }
 
 func createMetrics(bucketsResponseTime []float64) *metrics {
@@ -63,6 +79,40 @@ func createMetrics(bucketsResponseTime []float64) *metrics {
 			},
 			[]string{"task"},
 		),
+		ctlProcTime: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Name:      "controller_processing_seconds",
+				Help:      "Time in seconds spent on each haproxy-ingress task of a configuration update",
+				Buckets:   []float64{.001, .005, .01, .05, .1, .5, 1, 5, 10, 30},
+			},
+			[]string{"task"},
+		),
+		ingParseTime: prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Name:      "ingress_parse_seconds",
+				Help:      "Time in seconds spent parsing a single ingress resource",
+				Buckets:   []float64{.0001, .0005, .001, .005, .01, .05, .1, .5},
+			},
+		),
+		templateProcTime: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Name:      "template_processing_seconds",
+				Help:      "Time in seconds spent rendering templates and writing the output to disk. Step can be render, write, render_write.",
+				Buckets:   []float64{.001, .005, .01, .05, .1, .5, 1, 5},
+			},
+			[]string{"step"},
+		),
+		trackedObjGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "tracked_objects",
+				Help:      "Number of Kubernetes resources currently tracked by the converter, per resource type.",
+			},
+			[]string{"type"},
+		),
 		procSecondsCounter: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Namespace: namespace,
@@ -71,6 +121,30 @@ func createMetrics(bucketsResponseTime []float64) *metrics {
 			},
 			[]string{},
 		),
+		serversDownGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "backend_servers_down",
+				Help:      "Number of servers currently marked as down, per backend.",
+			},
+			[]string{"backend"},
+		),
+		hostConflictGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "host_conflicts",
+				Help:      "Number of ingress resources whose rules were rejected because the hostname belongs to another namespace, per hostname.",
+			},
+			[]string{"hostname"},
+		),
+		driftGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "config_drift",
+				Help:      "Number of servers or certificates of the running haproxy that differ from the last update, found in the last drift check. Kind can be server or cert.",
+			},
+			[]string{"kind"},
+		),
 		updatesCounter: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Namespace: namespace,
@@ -87,6 +161,22 @@ func createMetrics(bucketsResponseTime []float64) *metrics {
 			},
 			[]string{},
 		),
+		updateFailCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "reload_failures_total",
+				Help:      "Cumulative number of haproxy updates that failed to be applied. Reason can be maps, error_pages, config, validate, reload.",
+			},
+			[]string{"reason"},
+		),
+		lastAppliedGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "last_successful_sync_timestamp",
+				Help:      "The time of the last haproxy update whose changes were successfully applied, in unix epoch time.",
+			},
+			[]string{},
+		),
 		certExpireGauge: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Namespace: namespace,
@@ -103,15 +193,51 @@ func createMetrics(bucketsResponseTime []float64) *metrics {
 			},
 			[]string{"domains", "reason", "success"},
 		),
+		acmeOrdersGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "acme_orders",
+				Help:      "Number of acme orders in the work queue. State can be pending, or failing if the order is waiting to be retried.",
+			},
+			[]string{"state"},
+		),
+		acmeFailCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "acme_order_failures_total",
+				Help:      "Cumulative number of failed acme orders. Reason can be rate_limited or error.",
+			},
+			[]string{"reason"},
+		),
 	}
+	metrics.stalenessGauge = prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "config_staleness_seconds",
+			Help:      "Time in seconds since the oldest change observed in the cluster that wasn't applied to haproxy yet, zero if all the changes were applied.",
+		},
+		metrics.configStaleness,
+	)
 	prometheus.MustRegister(metrics.responseTime)
 	prometheus.MustRegister(metrics.ctlProcTimeSum)
 	prometheus.MustRegister(metrics.ctlProcCount)
+	prometheus.MustRegister(metrics.ctlProcTime)
+	prometheus.MustRegister(metrics.ingParseTime)
+	prometheus.MustRegister(metrics.templateProcTime)
+	prometheus.MustRegister(metrics.trackedObjGauge)
 	prometheus.MustRegister(metrics.procSecondsCounter)
+	prometheus.MustRegister(metrics.serversDownGauge)
+	prometheus.MustRegister(metrics.hostConflictGauge)
+	prometheus.MustRegister(metrics.driftGauge)
 	prometheus.MustRegister(metrics.updatesCounter)
 	prometheus.MustRegister(metrics.updateSuccessGauge)
+	prometheus.MustRegister(metrics.updateFailCounter)
+	prometheus.MustRegister(metrics.lastAppliedGauge)
+	prometheus.MustRegister(metrics.stalenessGauge)
 	prometheus.MustRegister(metrics.certExpireGauge)
 	prometheus.MustRegister(metrics.certSigningCounter)
+	prometheus.MustRegister(metrics.acmeOrdersGauge)
+	prometheus.MustRegister(metrics.acmeFailCounter)
 	return metrics
 }
 
@@ -119,6 +245,10 @@ func (m *metrics) HAProxyShowInfoResponseTime(duration time.Duration) {
 	m.responseTime.WithLabelValues("show_info").Observe(duration.Seconds())
 }
 
+func (m *metrics) HAProxyShowStatResponseTime(duration time.Duration) {
+	m.responseTime.WithLabelValues("show_stat").Observe(duration.Seconds())
+}
+
 func (m *metrics) HAProxySetServerResponseTime(duration time.Duration) {
 	m.responseTime.WithLabelValues("set_server").Observe(duration.Seconds())
 }
@@ -130,6 +260,19 @@ func (m *metrics) HAProxySetSSLCertResponseTime(duration time.Duration) {
 func (m *metrics) ControllerProcTime(task string, duration time.Duration) {
 	m.ctlProcTimeSum.WithLabelValues(task).Add(duration.Seconds())
 	m.ctlProcCount.WithLabelValues(task).Inc()
+	m.ctlProcTime.WithLabelValues(task).Observe(duration.Seconds())
+}
+
+func (m *metrics) IngressParseTime(duration time.Duration) {
+	m.ingParseTime.Observe(duration.Seconds())
+}
+
+func (m *metrics) TemplateProcTime(step string, duration time.Duration) {
+	m.templateProcTime.WithLabelValues(step).Observe(duration.Seconds())
+}
+
+func (m *metrics) SetTrackedObjects(rtype string, count int) {
+	m.trackedObjGauge.WithLabelValues(rtype).Set(float64(count))
 }
 
 func (m *metrics) AddIdleFactor(idle int) {
@@ -143,6 +286,30 @@ func (m *metrics) AddIdleFactor(idle int) {
 	m.procSecondsCounter.WithLabelValues().Add(float64(100-idle) * totalTime / 100)
 }
 
+func (m *metrics) SetServersDown(backend string, count int) {
+	m.serversDownGauge.WithLabelValues(backend).Set(float64(count))
+}
+
+func (m *metrics) ClearServersDown() {
+	m.serversDownGauge.Reset()
+}
+
+func (m *metrics) SetHostConflicts(hostname string, count int) {
+	if count == 0 {
+		m.hostConflictGauge.DeleteLabelValues(hostname)
+		return
+	}
+	m.hostConflictGauge.WithLabelValues(hostname).Set(float64(count))
+}
+
+func (m *metrics) ClearHostConflicts() {
+	m.hostConflictGauge.Reset()
+}
+
+func (m *metrics) setDrift(kind string, count int) {
+	m.driftGauge.WithLabelValues(kind).Set(float64(count))
+}
+
 func (m *metrics) IncUpdateNoop() {
 	m.updatesCounter.WithLabelValues("noop").Inc()
 }
@@ -160,6 +327,48 @@ func (m *metrics) UpdateSuccessful(success bool) {
 	m.updateSuccessGauge.WithLabelValues().Set(value[success])
 }
 
+func (m *metrics) IncUpdateFailure(reason string) {
+	m.updateFailCounter.WithLabelValues(reason).Inc()
+}
+
+func (m *metrics) UpdateApplied() {
+	now := time.Now()
+	m.mutex.Lock()
+	m.lastApplied = now
+	m.mutex.Unlock()
+	m.lastAppliedGauge.WithLabelValues().Set(float64(now.Unix()))
+}
+
+// appliedSince returns true if an update was successfully applied
+// after the timestamp.
+func (m *metrics) appliedSince(timestamp time.Time) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return !m.lastApplied.Before(timestamp)
+}
+
+// setPendingSince configures the func that returns the time of the oldest
+// change that wasn't applied yet, or zero if all the changes were applied.
+func (m *metrics) setPendingSince(pendingSince func() time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.pendingSince = pendingSince
+}
+
+func (m *metrics) configStaleness() float64 {
+	m.mutex.Lock()
+	pendingSince := m.pendingSince
+	m.mutex.Unlock()
+	if pendingSince == nil {
+		return 0
+	}
+	since := pendingSince()
+	if since.IsZero() {
+		return 0
+	}
+	return time.Since(since).Seconds()
+}
+
 func (m *metrics) SetCertExpireDate(domain, cn string, notAfter *time.Time) {
 	if notAfter == nil {
 		m.certExpireGauge.DeleteLabelValues(domain, cn)
@@ -183,3 +392,43 @@ func (m *metrics) IncCertSigningExpiring(domains string, success bool) {
 func (m *metrics) IncCertSigningOutdated(domains string, success bool) {
 	m.certSigningCounter.WithLabelValues(domains, "outdated", strconv.FormatBool(success)).Inc()
 }
+
+func (m *metrics) SetAcmeOrders(pending, failing int) {
+	m.acmeOrdersGauge.WithLabelValues("pending").Set(float64(pending))
+	m.acmeOrdersGauge.WithLabelValues("failing").Set(float64(failing))
+}
+
+func (m *metrics) IncAcmeOrderFailure(reason string) {
+	m.acmeFailCounter.WithLabelValues(reason).Inc()
+}
+
+// noopMetrics discards all the metrics, used by the conversions that
+// shouldn't change the metrics of the running controller, e.g. dry-run.
+type noopMetrics struct{}
+
+func (noopMetrics) HAProxyShowInfoResponseTime(duration time.Duration)       {}
+func (noopMetrics) HAProxyShowStatResponseTime(duration time.Duration)       {}
+func (noopMetrics) HAProxySetServerResponseTime(duration time.Duration)      {}
+func (noopMetrics) HAProxySetSSLCertResponseTime(duration time.Duration)     {}
+func (noopMetrics) ControllerProcTime(task string, duration time.Duration)   {}
+func (noopMetrics) IngressParseTime(duration time.Duration)                  {}
+func (noopMetrics) TemplateProcTime(step string, duration time.Duration)     {}
+func (noopMetrics) SetTrackedObjects(rtype string, count int)                {}
+func (noopMetrics) AddIdleFactor(idle int)                                   {}
+func (noopMetrics) SetServersDown(backend string, count int)                 {}
+func (noopMetrics) ClearServersDown()                                        {}
+func (noopMetrics) SetHostConflicts(hostname string, count int)              {}
+func (noopMetrics) ClearHostConflicts()                                      {}
+func (noopMetrics) IncUpdateNoop()                                           {}
+func (noopMetrics) IncUpdateDynamic()                                        {}
+func (noopMetrics) IncUpdateFull()                                           {}
+func (noopMetrics) UpdateSuccessful(success bool)                            {}
+func (noopMetrics) IncUpdateFailure(reason string)                           {}
+func (noopMetrics) UpdateApplied()                                           {}
+func (noopMetrics) SetCertExpireDate(domain, cn string, notAfter *time.Time) {}
+func (noopMetrics) ClearCertExpire()                                         {}
+func (noopMetrics) IncCertSigningMissing(domains string, success bool)       {}
+func (noopMetrics) IncCertSigningExpiring(domains string, success bool)      {}
+func (noopMetrics) IncCertSigningOutdated(domains string, success bool)      {}
+func (noopMetrics) SetAcmeOrders(pending, failing int)                       {}
+func (noopMetrics) IncAcmeOrderFailure(reason string)                        {}
@@ -0,0 +1,280 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/common/ingress"
+	ingressconverter "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress"
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/annotations"
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/tracker"
+	ingtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/types"
+	convtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/types"
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy"
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/types"
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/utils"
+)
+
+// renderCfgDir is the directory that the rendered files refer to when
+// printed to the stdout, the same one used by a running controller.
+const renderCfgDir = "/etc/haproxy"
+
+type renderOptions struct {
+	filenames       []string
+	kubeconfig      string
+	configMap       string
+	annPrefix       string
+	defaultBackend  string
+	defaultSSLCrt   string
+	namespaceConfig string
+	translateNginx  bool
+	templatesDir    string
+	outputDir       string
+	sortEndpointsBy string
+}
+
+// addFlags adds the options used to read and convert the resources,
+// shared by the render and the lint subcommands.
+func (o *renderOptions) addFlags(flags *pflag.FlagSet) {
+	flags.StringSliceVarP(&o.filenames, "filename", "f", nil,
+		`YAML or JSON files with the resources to be read, or directories with such files. Use '-' to
+		read from the stdin. Can be used more than once`)
+	flags.StringVar(&o.kubeconfig, "kubeconfig", "",
+		`Path to a kubeconfig file, used to list the resources of a cluster. Nothing is changed in the
+		cluster. Resources read from --filename replace the ones with the same name`)
+	flags.StringVar(&o.configMap, "configmap", "",
+		`Name of the ConfigMap, in the form namespace/name, with the global configuration. Its
+		namespace is used as the controller namespace`)
+	flags.StringVar(&o.annPrefix, "annotations-prefix", "ingress.kubernetes.io",
+		`Prefix of ingress and service annotations, see the controller's --annotations-prefix`)
+	flags.StringVar(&o.defaultBackend, "default-backend-service", "",
+		`Service used as the default backend, in the form namespace/name`)
+	flags.StringVar(&o.defaultSSLCrt, "default-ssl-certificate", "",
+		`Secret, in the form namespace/name, with the default certificate`)
+	flags.StringVar(&o.namespaceConfig, "namespace-config-configmap", "",
+		`Name of the ConfigMap of every namespace with its configuration, see the controller's
+		--namespace-config-configmap`)
+	flags.BoolVar(&o.translateNginx, "translate-nginx-annotations", false,
+		`Translates ingress-nginx annotations to their native counterpart`)
+}
+
+// addRenderFlags adds the options used to write the configuration files.
+func (o *renderOptions) addRenderFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&o.templatesDir, "templates-dir", "/etc/templates",
+		`Directory with the haproxy, map and modsecurity templates`)
+	flags.StringVar(&o.outputDir, "output-dir", "",
+		`Directory where the rendered files should be written. The files are printed to the stdout,
+		referring to `+renderCfgDir+`, if empty`)
+	flags.StringVar(&o.sortEndpointsBy, "sort-endpoints-by", "name",
+		`How to sort the endpoints of the backends, see the controller's --sort-endpoints-by`)
+}
+
+// Render implements the render subcommand: reads ingress resources and
+// their dependencies from files or a cluster, runs the converters and
+// writes or prints the haproxy configuration and the map files. Nothing
+// is applied, so it can be used to validate changes before they are
+// merged or deployed.
+func Render(args []string, stdout, stderr io.Writer) error {
+	flags := pflag.NewFlagSet("render", pflag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var opt renderOptions
+	opt.addFlags(flags)
+	opt.addRenderFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		if err == pflag.ErrHelp {
+			return nil
+		}
+		return err
+	}
+	objects, err := opt.loadCache()
+	if err != nil {
+		return err
+	}
+	outputDir := opt.outputDir
+	if outputDir == "" {
+		tempdir, err := ioutil.TempDir("", "haproxy-ingress-render")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tempdir)
+		outputDir = tempdir
+	}
+	logger := &renderLogger{out: stderr, objects: objects}
+	files, err := opt.render(logger, objects, createMetrics(nil), outputDir)
+	if err != nil || opt.outputDir != "" {
+		return err
+	}
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		name := renderCfgDir + strings.TrimPrefix(file, outputDir)
+		fmt.Fprintf(stdout, "# %s\n%s", name, strings.ReplaceAll(string(content), outputDir, renderCfgDir))
+	}
+	return nil
+}
+
+// loadCache reads the resources from the cluster and from the files, in
+// this order, and the global config.
+func (o *renderOptions) loadCache() (*renderCache, error) {
+	if len(o.filenames) == 0 && o.kubeconfig == "" {
+		return nil, fmt.Errorf("missing resources, use --filename and/or --kubeconfig")
+	}
+	c := newRenderCache()
+	if o.kubeconfig != "" {
+		config, err := clientcmd.BuildConfigFromFlags("", o.kubeconfig)
+		if err != nil {
+			return nil, fmt.Errorf("error reading kubeconfig: %w", err)
+		}
+		client, err := kubernetes.NewForConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.loadCluster(client); err != nil {
+			return nil, err
+		}
+	}
+	for _, filename := range o.filenames {
+		if err := c.loadFile(filename); err != nil {
+			return nil, err
+		}
+	}
+	if o.configMap != "" {
+		namespace, _, err := cache.SplitMetaNamespaceKey(o.configMap)
+		if err != nil {
+			return nil, err
+		}
+		cm, err := c.GetConfigMap(o.configMap)
+		if err != nil {
+			return nil, fmt.Errorf("error reading global config: %w", err)
+		}
+		c.podNamespace = namespace
+		c.globalConfig = cm.Data
+	}
+	return c, nil
+}
+
+// convert runs the converters, updating the haproxy model of config.
+func (o *renderOptions) convert(logger types.Logger, objects convtypes.Cache, metrics types.Metrics, config haproxy.Config) {
+	converterOptions := &ingtypes.ConverterOptions{
+		Logger:           logger,
+		Cache:            objects,
+		Tracker:          tracker.NewTracker(),
+		Metrics:          metrics,
+		AnnotationPrefix: utils.Split(o.annPrefix, ","),
+		DefaultBackend:   o.defaultBackend,
+		DefaultCrtSecret: o.defaultSSLCrt,
+		FakeCrtFile: convtypes.CrtFile{
+			Filename:   ingress.DefaultCrtDirectory + "/default-fake-certificate.pem",
+			CommonName: "Kubernetes Ingress Controller Fake Certificate",
+		},
+		FakeCAFile: convtypes.CrtFile{
+			Filename: ingress.DefaultCACertsDirectory + "/ca_fake-ca.pem",
+		},
+		NamespaceConfig: o.namespaceConfig,
+		TranslateNginx:  o.translateNginx,
+	}
+	ingressconverter.NewIngressConverter(converterOptions, config).Sync()
+}
+
+// render runs the converters and writes the configuration files in outputDir,
+// returning the name of the written files.
+func (o *renderOptions) render(logger types.Logger, objects convtypes.Cache, metrics types.Metrics, outputDir string) ([]string, error) {
+	mapsDir := filepath.Join(outputDir, "maps")
+	if err := os.MkdirAll(mapsDir, 0755); err != nil {
+		return nil, err
+	}
+	instance := haproxy.CreateInstance(logger, haproxy.InstanceOptions{
+		HAProxyCfgDir:   outputDir,
+		HAProxyMapsDir:  mapsDir,
+		Metrics:         metrics,
+		SortEndpointsBy: o.sortEndpointsBy,
+		TemplatesDir:    o.templatesDir,
+	})
+	if err := instance.ParseTemplates(); err != nil {
+		return nil, err
+	}
+	o.convert(logger, objects, metrics, instance.Config())
+	if err := instance.Render(); err != nil {
+		return nil, err
+	}
+	var files []string
+	err := filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files = append(files, path)
+		}
+		return err
+	})
+	return files, err
+}
+
+// renderLogger writes warnings and errors of the converters to out, in a
+// human readable format, prefixed with the file name and line of the
+// resource if it was read from a file. Informational messages are discarded.
+type renderLogger struct {
+	out     io.Writer
+	objects *renderCache
+	issues  int
+}
+
+func (l *renderLogger) write(level, msg string, args []interface{}) {
+	l.issues++
+	if len(args) > 0 {
+		msg = fmt.Sprintf(msg, args...)
+	}
+	msg = level + ": " + msg
+	if l.objects != nil {
+		for _, arg := range args {
+			if source, ok := arg.(*annotations.Source); ok && source != nil {
+				if location := l.objects.location(source.Type, source.FullName()); location != "" {
+					msg = location + ": " + msg
+					break
+				}
+			}
+		}
+	}
+	fmt.Fprintln(l.out, msg)
+}
+
+func (l *renderLogger) InfoV(v int, msg string, args ...interface{}) {}
+
+func (l *renderLogger) Info(msg string, args ...interface{}) {}
+
+func (l *renderLogger) Warn(msg string, args ...interface{}) {
+	l.write("warning", msg, args)
+}
+
+func (l *renderLogger) Error(msg string, args ...interface{}) {
+	l.write("error", msg, args)
+}
+
+func (l *renderLogger) Fatal(msg string, args ...interface{}) {
+	l.write("fatal", msg, args)
+	os.Exit(1)
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	types_helper "github.com/jcmoraisjr/haproxy-ingress/pkg/types/helper_test"
+)
+
+func TestRender(t *testing.T) {
+	const ingress = `
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: app
+  namespace: default
+spec:
+  rules:
+  - host: app.local
+    http:
+      paths:
+      - path: /
+        pathType: Prefix
+        backend:
+          service:
+            name: app
+            port:
+              number: 8080
+`
+	const service = `
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+spec:
+  ports:
+  - port: 8080
+---
+apiVersion: v1
+kind: Endpoints
+metadata:
+  name: app
+subsets:
+- addresses:
+  - ip: 10.0.0.2
+  - ip: 10.0.0.1
+  ports:
+  - port: 8080
+`
+	testCases := []struct {
+		resources  string
+		configMap  string
+		expConfig  []string
+		expMaps    map[string]string
+		expLogging string
+	}{
+		// 0
+		{
+			resources: ingress + "---" + service,
+			expConfig: []string{
+				"backend default_app_8080",
+				"    server srv001 10.0.0.2:8080 weight 1 check inter 2s",
+				"    server srv002 10.0.0.1:8080 weight 1 check inter 2s",
+			},
+			expMaps: map[string]string{
+				"_front_http_host__prefix.map": "app.local#/ default_app_8080",
+			},
+		},
+		// 1
+		{
+			resources: `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: haproxy-ingress
+  namespace: ingress-controller
+data:
+  balance-algorithm: leastconn
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+---
+# empty
+---` + ingress + "---" + service,
+			configMap: "ingress-controller/haproxy-ingress",
+			expConfig: []string{
+				"    balance leastconn",
+			},
+		},
+		// 2
+		{
+			resources:  ingress,
+			expLogging: `warning: skipping backend config of ingress 'default/app': services "default/app" not found`,
+		},
+	}
+	tempdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempdir)
+	for i, test := range testCases {
+		resources := filepath.Join(tempdir, "resources.yaml")
+		if err := ioutil.WriteFile(resources, []byte(test.resources), 0644); err != nil {
+			t.Fatalf("error writing resources: %v", err)
+		}
+		opt := &renderOptions{
+			filenames:    []string{resources},
+			configMap:    test.configMap,
+			annPrefix:    "ingress.kubernetes.io",
+			templatesDir: "../../rootfs/etc/templates",
+		}
+		objects, err := opt.loadCache()
+		if err != nil {
+			t.Errorf("%d: error loading resources: %v", i, err)
+			continue
+		}
+		outputDir := filepath.Join(tempdir, "output")
+		_ = os.RemoveAll(outputDir)
+		out := &bytes.Buffer{}
+		if _, err := opt.render(&renderLogger{out: out}, objects, types_helper.NewMetricsMock(), outputDir); err != nil {
+			t.Errorf("%d: error rendering: %v", i, err)
+			continue
+		}
+		config, _ := ioutil.ReadFile(filepath.Join(outputDir, "haproxy.cfg"))
+		for _, exp := range test.expConfig {
+			if !strings.Contains(string(config), exp+"\n") {
+				t.Errorf("%d: expected '%s' in the configuration:\n%s", i, exp, config)
+			}
+		}
+		for name, exp := range test.expMaps {
+			content, _ := ioutil.ReadFile(filepath.Join(outputDir, "maps", name))
+			if !strings.Contains(string(content), exp+"\n") {
+				t.Errorf("%d: expected '%s' in the map %s:\n%s", i, exp, name, content)
+			}
+		}
+		if logging := strings.TrimSpace(out.String()); logging != test.expLogging {
+			t.Errorf("%d: expected logging '%s' but was '%s'", i, test.expLogging, logging)
+		}
+	}
+}
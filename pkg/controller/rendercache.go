@@ -0,0 +1,591 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/common/ingress"
+	convtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/types"
+)
+
+// renderCache implements converters.types.Cache using a static set of
+// resources, read from files or listed once from the apiserver. Used by
+// the render subcommand, so certificates and keys are only parsed, the
+// file names refer to the ones that a running controller would create.
+type renderCache struct {
+	podNamespace   string
+	globalConfig   map[string]string
+	ingresses      map[string]*networking.Ingress
+	ingressClasses map[string]*networking.IngressClass
+	services       map[string]*api.Service
+	endpoints      map[string]*api.Endpoints
+	secrets        map[string]*api.Secret
+	configMaps     map[string]*api.ConfigMap
+	locations      map[string]string
+	missing        map[string]bool
+}
+
+func newRenderCache() *renderCache {
+	return &renderCache{
+		ingresses:      map[string]*networking.Ingress{},
+		ingressClasses: map[string]*networking.IngressClass{},
+		services:       map[string]*api.Service{},
+		endpoints:      map[string]*api.Endpoints{},
+		secrets:        map[string]*api.Secret{},
+		configMaps:     map[string]*api.ConfigMap{},
+		locations:      map[string]string{},
+		missing:        map[string]bool{},
+	}
+}
+
+// loadFile reads the resources of a YAML or JSON file, or of all the
+// .yaml, .yml and .json files of a directory. `-` reads from stdin.
+func (c *renderCache) loadFile(filename string) error {
+	if filename == "-" {
+		return c.load(os.Stdin, "stdin")
+	}
+	stat, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	if stat.IsDir() {
+		files, err := ioutil.ReadDir(filename)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			switch filepath.Ext(file.Name()) {
+			case ".yaml", ".yml", ".json":
+				if err := c.loadFile(filepath.Join(filename, file.Name())); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return c.load(f, filename)
+}
+
+// load reads all the documents of a YAML stream, or a JSON document.
+// Kinds that the converters don't use are ignored. The file name and the
+// starting line of every resource is stored, see location.
+func (c *renderCache) load(r io.Reader, source string) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", source, err)
+	}
+	var doc []string
+	start := 1
+	decode := func() error {
+		// starting line refers to the first line with content
+		for len(doc) > 0 {
+			if line := strings.TrimSpace(doc[0]); line != "" && !strings.HasPrefix(line, "#") {
+				break
+			}
+			doc = doc[1:]
+			start++
+		}
+		if len(doc) == 0 {
+			return nil
+		}
+		location := fmt.Sprintf("%s:%d", source, start)
+		if err := c.decode([]byte(strings.Join(doc, "")), location); err != nil {
+			return fmt.Errorf("error decoding %s: %w", location, err)
+		}
+		return nil
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	for i, line := range lines {
+		if strings.TrimRight(line, " \t\r\n") == "---" {
+			if err := decode(); err != nil {
+				return err
+			}
+			doc = nil
+			start = i + 2
+			continue
+		}
+		doc = append(doc, line)
+	}
+	return decode()
+}
+
+func (c *renderCache) decode(doc []byte, location string) error {
+	obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(doc, nil, nil)
+	if runtime.IsNotRegisteredError(err) || runtime.IsMissingKind(err) {
+		// custom resources, or a document without an object, eg only comments
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if list, ok := obj.(*api.List); ok {
+		for _, item := range list.Items {
+			if err := c.decode(item.Raw, location); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	c.add(obj, location)
+	return nil
+}
+
+// loadCluster lists the resources used by the converters from all the
+// namespaces of a cluster. Nothing is changed in the cluster.
+func (c *renderCache) loadCluster(client kubernetes.Interface) error {
+	ctx := context.Background()
+	opts := metav1.ListOptions{}
+	ingList, err := client.NetworkingV1().Ingresses(api.NamespaceAll).List(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("error listing ingress: %w", err)
+	}
+	for i := range ingList.Items {
+		c.add(&ingList.Items[i], "")
+	}
+	ingClassList, err := client.NetworkingV1().IngressClasses().List(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("error listing ingress classes: %w", err)
+	}
+	for i := range ingClassList.Items {
+		c.add(&ingClassList.Items[i], "")
+	}
+	svcList, err := client.CoreV1().Services(api.NamespaceAll).List(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("error listing services: %w", err)
+	}
+	for i := range svcList.Items {
+		c.add(&svcList.Items[i], "")
+	}
+	epList, err := client.CoreV1().Endpoints(api.NamespaceAll).List(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("error listing endpoints: %w", err)
+	}
+	for i := range epList.Items {
+		c.add(&epList.Items[i], "")
+	}
+	secretList, err := client.CoreV1().Secrets(api.NamespaceAll).List(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("error listing secrets: %w", err)
+	}
+	for i := range secretList.Items {
+		c.add(&secretList.Items[i], "")
+	}
+	cmList, err := client.CoreV1().ConfigMaps(api.NamespaceAll).List(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("error listing configmaps: %w", err)
+	}
+	for i := range cmList.Items {
+		c.add(&cmList.Items[i], "")
+	}
+	return nil
+}
+
+// add stores a resource, replacing a previous one with the same name.
+// Namespaced resources without a namespace are added to `default`. Port
+// defaults, usually applied by the apiserver, are applied as well. An
+// empty location means that the resource was read from the cluster.
+func (c *renderCache) add(obj runtime.Object, location string) {
+	key := func(meta *metav1.ObjectMeta) string {
+		if meta.Namespace == "" {
+			meta.Namespace = api.NamespaceDefault
+		}
+		return meta.Namespace + "/" + meta.Name
+	}
+	switch obj := obj.(type) {
+	case *networking.Ingress:
+		name := key(&obj.ObjectMeta)
+		c.ingresses[name] = obj
+		c.setLocation("ingress", name, location)
+	case *networking.IngressClass:
+		c.ingressClasses[obj.Name] = obj
+	case *api.Service:
+		for i := range obj.Spec.Ports {
+			port := &obj.Spec.Ports[i]
+			if port.Protocol == "" {
+				port.Protocol = api.ProtocolTCP
+			}
+			if port.TargetPort.IntVal == 0 && port.TargetPort.StrVal == "" {
+				port.TargetPort = intstr.FromInt(int(port.Port))
+			}
+		}
+		name := key(&obj.ObjectMeta)
+		c.services[name] = obj
+		c.setLocation("service", name, location)
+	case *api.Endpoints:
+		for i := range obj.Subsets {
+			for j := range obj.Subsets[i].Ports {
+				if port := &obj.Subsets[i].Ports[j]; port.Protocol == "" {
+					port.Protocol = api.ProtocolTCP
+				}
+			}
+		}
+		c.endpoints[key(&obj.ObjectMeta)] = obj
+	case *api.Secret:
+		// stringData is only merged by the apiserver
+		for k, v := range obj.StringData {
+			if obj.Data == nil {
+				obj.Data = map[string][]byte{}
+			}
+			obj.Data[k] = []byte(v)
+		}
+		c.secrets[key(&obj.ObjectMeta)] = obj
+	case *api.ConfigMap:
+		c.configMaps[key(&obj.ObjectMeta)] = obj
+	}
+}
+
+func (c *renderCache) setLocation(rtype, name, location string) {
+	if location != "" {
+		c.locations[rtype+"/"+name] = location
+	} else {
+		delete(c.locations, rtype+"/"+name)
+	}
+}
+
+// location returns the file name and line of a resource, or an empty
+// string if it was read from the cluster. rtype is the type used by the
+// converters in the source of the annotations, `ingress` or `service`.
+func (c *renderCache) location(rtype, name string) string {
+	return c.locations[rtype+"/"+name]
+}
+
+// addMissingServices adds a service without endpoints for every backend
+// of the ingress resources whose service wasn't read, so the annotations
+// of the backends are parsed anyway. Used by the lint subcommand, which
+// usually reads only ingress resources.
+func (c *renderCache) addMissingServices() {
+	for _, ing := range c.ingresses {
+		backends := []*networking.IngressBackend{ing.Spec.DefaultBackend}
+		for _, rule := range ing.Spec.Rules {
+			if rule.HTTP != nil {
+				for i := range rule.HTTP.Paths {
+					backends = append(backends, &rule.HTTP.Paths[i].Backend)
+				}
+			}
+		}
+		for _, backend := range backends {
+			if backend == nil || backend.Service == nil {
+				continue
+			}
+			name := ing.Namespace + "/" + backend.Service.Name
+			svc := c.services[name]
+			if svc != nil && !c.missing[name] {
+				continue
+			}
+			if svc == nil {
+				meta := metav1.ObjectMeta{Namespace: ing.Namespace, Name: backend.Service.Name}
+				svc = &api.Service{ObjectMeta: meta}
+				c.services[name] = svc
+				c.endpoints[name] = &api.Endpoints{ObjectMeta: meta}
+				c.missing[name] = true
+			}
+			port := api.ServicePort{Name: backend.Service.Port.Name, Port: backend.Service.Port.Number, Protocol: api.ProtocolTCP}
+			if port.Port == 0 {
+				port.Port = int32(len(svc.Spec.Ports) + 1)
+			}
+			port.TargetPort = intstr.FromInt(int(port.Port))
+			svc.Spec.Ports = append(svc.Spec.Ports, port)
+		}
+	}
+}
+
+func (c *renderCache) getSecret(defaultNamespace, secretName string) (*api.Secret, error) {
+	namespace, name, err := cache.SplitMetaNamespaceKey(secretName)
+	if err != nil {
+		return nil, err
+	}
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+	secret, found := c.secrets[namespace+"/"+name]
+	if !found {
+		return nil, k8serrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, namespace+"/"+name)
+	}
+	return secret, nil
+}
+
+func sha1Hex(data ...[]byte) string {
+	h := sha1.New()
+	for _, d := range data {
+		_, _ = h.Write(d)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// implements converters.types.Cache
+func (c *renderCache) GetIngress(ingressName string) (*networking.Ingress, error) {
+	if ing, found := c.ingresses[ingressName]; found {
+		return ing, nil
+	}
+	return nil, k8serrors.NewNotFound(schema.GroupResource{Resource: "ingresses"}, ingressName)
+}
+
+// implements converters.types.Cache
+func (c *renderCache) GetIngressList() ([]*networking.Ingress, error) {
+	names := make([]string, 0, len(c.ingresses))
+	for name := range c.ingresses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ingList := make([]*networking.Ingress, len(names))
+	for i, name := range names {
+		ingList[i] = c.ingresses[name]
+	}
+	return ingList, nil
+}
+
+// implements converters.types.Cache
+func (c *renderCache) GetIngressClass(className string) (*networking.IngressClass, error) {
+	if ingClass, found := c.ingressClasses[className]; found {
+		return ingClass, nil
+	}
+	return nil, k8serrors.NewNotFound(schema.GroupResource{Resource: "ingressclasses"}, className)
+}
+
+// implements converters.types.Cache
+func (c *renderCache) GetService(serviceName string) (*api.Service, error) {
+	if svc, found := c.services[serviceName]; found {
+		return svc, nil
+	}
+	return nil, k8serrors.NewNotFound(schema.GroupResource{Resource: "services"}, serviceName)
+}
+
+// implements converters.types.Cache
+func (c *renderCache) GetEndpoints(service *api.Service) (*api.Endpoints, error) {
+	name := service.Namespace + "/" + service.Name
+	if ep, found := c.endpoints[name]; found {
+		return ep, nil
+	}
+	return nil, k8serrors.NewNotFound(schema.GroupResource{Resource: "endpoints"}, name)
+}
+
+// implements converters.types.Cache
+func (c *renderCache) GetConsulEndpoints(address, consulService string, service *api.Service) ([]convtypes.ExternalEndpoint, error) {
+	return nil, fmt.Errorf("consul services are not supported when rendering offline")
+}
+
+// implements converters.types.Cache
+func (c *renderCache) GetConfigMap(configMapName string) (*api.ConfigMap, error) {
+	if cm, found := c.configMaps[configMapName]; found {
+		return cm, nil
+	}
+	return nil, k8serrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, configMapName)
+}
+
+// implements converters.types.Cache
+func (c *renderCache) GetTerminatingPods(service *api.Service, track convtypes.TrackingTarget) ([]*api.Pod, error) {
+	return nil, nil
+}
+
+// implements converters.types.Cache
+func (c *renderCache) GetPod(podName string) (*api.Pod, error) {
+	return nil, k8serrors.NewNotFound(schema.GroupResource{Resource: "pods"}, podName)
+}
+
+// implements converters.types.Cache
+func (c *renderCache) GetNode(nodeName string) (*api.Node, error) {
+	return nil, k8serrors.NewNotFound(schema.GroupResource{Resource: "nodes"}, nodeName)
+}
+
+// implements converters.types.Cache
+func (c *renderCache) GetNodeList() ([]*api.Node, error) {
+	return nil, nil
+}
+
+// implements converters.types.Cache
+func (c *renderCache) GetPodNamespace() string {
+	return c.podNamespace
+}
+
+// implements converters.types.Cache
+func (c *renderCache) GetControllerNodeName() (string, error) {
+	return "", fmt.Errorf("the controller pod is not available on offline render")
+}
+
+// implements converters.types.Cache
+func (c *renderCache) GetTLSSecretPath(defaultNamespace, secretName string, track convtypes.TrackingTarget) (file convtypes.CrtFile, err error) {
+	proto, content := getContentProtocol(secretName)
+	if proto == "file" {
+		return convtypes.CrtFile{Filename: content}, nil
+	} else if proto != "secret" {
+		return file, fmt.Errorf("unsupported protocol: %s", proto)
+	}
+	secret, err := c.getSecret(defaultNamespace, content)
+	if err != nil {
+		return file, err
+	}
+	crt, okcrt := secret.Data[api.TLSCertKey]
+	key, okkey := secret.Data[api.TLSPrivateKeyKey]
+	if !okcrt || !okkey {
+		return file, fmt.Errorf("secret '%s/%s' does not have keys '%s' and '%s'", secret.Namespace, secret.Name, api.TLSCertKey, api.TLSPrivateKeyKey)
+	}
+	block, _ := pem.Decode(crt)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return file, fmt.Errorf("secret '%s/%s' does not have a valid pem encoded certificate", secret.Namespace, secret.Name)
+	}
+	x509crt, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return file, err
+	}
+	if _, err := tls.X509KeyPair(crt, key); err != nil {
+		return file, err
+	}
+	cn := sets.NewString(x509crt.Subject.CommonName)
+	cn.Insert(x509crt.DNSNames...)
+	return convtypes.CrtFile{
+		Filename:   fmt.Sprintf("%s/%s_%s.pem", ingress.DefaultCrtDirectory, secret.Namespace, secret.Name),
+		SHA1Hash:   sha1Hex(crt, []byte("\n"), key),
+		CommonName: x509crt.Subject.CommonName,
+		DNSNames:   cn.List(),
+		NotAfter:   x509crt.NotAfter,
+	}, nil
+}
+
+// implements converters.types.Cache
+func (c *renderCache) GetTLSSecretPool() ([]convtypes.CrtFile, error) {
+	return nil, nil
+}
+
+// implements converters.types.Cache
+func (c *renderCache) GetVaultCertPath(mount, role, hostname string, track convtypes.TrackingTarget) (file convtypes.CrtFile, err error) {
+	return file, fmt.Errorf("vault certificates are not supported when rendering offline")
+}
+
+// implements converters.types.Cache
+func (c *renderCache) GetCASecretPath(defaultNamespace, secretName string, track convtypes.TrackingTarget) (ca, crl convtypes.File, err error) {
+	proto, content := getContentProtocol(secretName)
+	if proto == "file" {
+		files := strings.Split(content, ",")
+		if content == "" || len(files) > 2 {
+			return ca, crl, fmt.Errorf("one or two filenames should be used")
+		}
+		ca = convtypes.File{Filename: files[0]}
+		if len(files) == 2 {
+			crl = convtypes.File{Filename: files[1]}
+		}
+		return ca, crl, nil
+	} else if proto != "secret" {
+		return ca, crl, fmt.Errorf("unsupported protocol: %s", proto)
+	}
+	secret, err := c.getSecret(defaultNamespace, content)
+	if err != nil {
+		return ca, crl, err
+	}
+	caData, found := secret.Data["ca.crt"]
+	if !found {
+		return ca, crl, fmt.Errorf("secret '%s/%s' does not have key 'ca.crt'", secret.Namespace, secret.Name)
+	}
+	nsName := secret.Namespace + "_" + secret.Name
+	crlData := secret.Data["ca.crl"]
+	ca = convtypes.File{
+		Filename: fmt.Sprintf("%s/ca_%s.pem", ingress.DefaultCACertsDirectory, nsName),
+		SHA1Hash: sha1Hex(caData, crlData),
+	}
+	if len(crlData) > 0 {
+		crl = convtypes.File{
+			Filename: fmt.Sprintf("%s/ca_%s_crl.pem", ingress.DefaultCrlDirectory, nsName),
+			SHA1Hash: ca.SHA1Hash,
+		}
+	}
+	return ca, crl, nil
+}
+
+// implements converters.types.Cache
+func (c *renderCache) GetDHSecretPath(defaultNamespace, secretName string) (file convtypes.File, err error) {
+	proto, content := getContentProtocol(secretName)
+	if proto == "file" {
+		return convtypes.File{Filename: content}, nil
+	} else if proto != "secret" {
+		return file, fmt.Errorf("unsupported protocol: %s", proto)
+	}
+	secret, err := c.getSecret(defaultNamespace, content)
+	if err != nil {
+		return file, err
+	}
+	dh, found := secret.Data[dhparamFilename]
+	if !found {
+		return file, fmt.Errorf("secret '%s/%s' does not have key '%s'", secret.Namespace, secret.Name, dhparamFilename)
+	}
+	return convtypes.File{
+		Filename: fmt.Sprintf("%s/%s_%s.pem", ingress.DefaultDHParamDirectory, secret.Namespace, secret.Name),
+		SHA1Hash: sha1Hex(dh),
+	}, nil
+}
+
+// implements converters.types.Cache
+func (c *renderCache) GetSecretContent(defaultNamespace, secretName, keyName string, track convtypes.TrackingTarget) ([]byte, error) {
+	proto, content := getContentProtocol(secretName)
+	if proto == "file" {
+		return ioutil.ReadFile(content)
+	} else if proto != "secret" {
+		return nil, fmt.Errorf("unsupported protocol: %s", proto)
+	}
+	secret, err := c.getSecret(defaultNamespace, content)
+	if err != nil {
+		return nil, err
+	}
+	data, found := secret.Data[keyName]
+	if !found {
+		return nil, fmt.Errorf("secret '%s/%s' does not have key '%s'", secret.Namespace, secret.Name, keyName)
+	}
+	return data, nil
+}
+
+// implements converters.types.Cache
+func (c *renderCache) SwapChangedObjects() *convtypes.ChangedObjects {
+	return &convtypes.ChangedObjects{
+		GlobalNew: c.globalConfig,
+	}
+}
+
+// implements converters.types.Cache
+func (c *renderCache) NeedFullSync() bool {
+	return true
+}
+
+// implements converters.types.Cache
+func (c *renderCache) ScheduleSync(at time.Time) {}
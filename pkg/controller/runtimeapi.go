@@ -0,0 +1,162 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/types"
+)
+
+// runtimeAPI implements the runtime api: a restricted subset of the
+// haproxy runtime API commands, so operators can read the state of the
+// servers, and drain or disable them, without access to the admin
+// socket. Arguments are validated before building the command, the
+// runtime API accepts more than one command per line. State changes of
+// the controller, like a full resync, are served here as well because
+// they need an authenticated client.
+type runtimeAPI struct {
+	logger      types.Logger
+	command     func(cmd string) (string, error)
+	setPodState func(pod, state string) ([]string, error)
+	resync      func()
+}
+
+var runtimeAPINameRegex = regexp.MustCompile(`^[A-Za-z0-9_.:-]+$`)
+
+var runtimeAPIPodRegex = regexp.MustCompile(`^[a-z0-9.-]+/[a-z0-9.-]+$`)
+
+var runtimeAPIServerStates = map[string]bool{
+	"ready": true,
+	"drain": true,
+	"maint": true,
+}
+
+func (a *runtimeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/v1/stat":
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		a.run(w, "show stat")
+	case "/v1/servers-state":
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		cmd := "show servers state"
+		if backend := r.URL.Query().Get("backend"); backend != "" {
+			if !runtimeAPINameRegex.MatchString(backend) {
+				http.Error(w, fmt.Sprintf("invalid backend name: %s", backend), http.StatusBadRequest)
+				return
+			}
+			cmd += " " + backend
+		}
+		a.run(w, cmd)
+	case "/v1/server-state":
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, fmt.Sprintf("error parsing request: %v", err), http.StatusBadRequest)
+			return
+		}
+		backend := r.Form.Get("backend")
+		server := r.Form.Get("server")
+		state := r.Form.Get("state")
+		if !runtimeAPINameRegex.MatchString(backend) || !runtimeAPINameRegex.MatchString(server) {
+			http.Error(w, "backend and server names are required", http.StatusBadRequest)
+			return
+		}
+		if !runtimeAPIServerStates[state] {
+			http.Error(w, fmt.Sprintf("invalid server state, should be one of ready, drain or maint: %s", state), http.StatusBadRequest)
+			return
+		}
+		cmd := fmt.Sprintf("set server %s/%s state %s", backend, server, state)
+		out, err := a.command(cmd)
+		if err != nil {
+			a.logger.Error("runtime api: error running '%s': %v", cmd, err)
+			http.Error(w, fmt.Sprintf("error running command: %v", err), http.StatusInternalServerError)
+			return
+		}
+		// set server doesn't output anything on success
+		if out = strings.TrimSpace(out); out != "" {
+			http.Error(w, out, http.StatusUnprocessableEntity)
+			return
+		}
+		a.logger.Info("runtime api: %s", cmd)
+		w.WriteHeader(http.StatusOK)
+	case "/v1/pod-state":
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, fmt.Sprintf("error parsing request: %v", err), http.StatusBadRequest)
+			return
+		}
+		pod := r.Form.Get("pod")
+		state := r.Form.Get("state")
+		if !runtimeAPIPodRegex.MatchString(pod) {
+			http.Error(w, fmt.Sprintf("pod should be in the form namespace/name: %s", pod), http.StatusBadRequest)
+			return
+		}
+		if !runtimeAPIServerStates[state] {
+			http.Error(w, fmt.Sprintf("invalid server state, should be one of ready, drain or maint: %s", state), http.StatusBadRequest)
+			return
+		}
+		servers, err := a.setPodState(pod, state)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("error changing servers state: %v", err), http.StatusUnprocessableEntity)
+			return
+		}
+		if len(servers) == 0 {
+			http.Error(w, fmt.Sprintf("no backend server found for pod '%s'", pod), http.StatusNotFound)
+			return
+		}
+		b, _ := json.Marshal(servers)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(b)
+	case "/v1/resync":
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		a.resync()
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte("Full resync successfully started.\n"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (a *runtimeAPI) run(w http.ResponseWriter, cmd string) {
+	out, err := a.command(cmd)
+	if err != nil {
+		a.logger.Error("runtime api: error running '%s': %v", cmd, err)
+		http.Error(w, fmt.Sprintf("error running command: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte(out + "\n"))
+}
@@ -0,0 +1,235 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	types_helper "github.com/jcmoraisjr/haproxy-ingress/pkg/types/helper_test"
+)
+
+func TestRuntimeAPI(t *testing.T) {
+	testCases := []struct {
+		method  string
+		path    string
+		body    string
+		output  string
+		servers []string
+		err     error
+		expCode int
+		expCmds []string
+		expBody string
+		logging string
+	}{
+		// 0
+		{
+			method:  http.MethodGet,
+			path:    "/v1/stat",
+			output:  "# pxname,svname",
+			expCode: http.StatusOK,
+			expCmds: []string{"show stat"},
+			expBody: "# pxname,svname\n",
+		},
+		// 1
+		{
+			method:  http.MethodPost,
+			path:    "/v1/stat",
+			expCode: http.StatusMethodNotAllowed,
+		},
+		// 2
+		{
+			method:  http.MethodGet,
+			path:    "/v1/servers-state",
+			output:  "1\n# be_id be_name",
+			expCode: http.StatusOK,
+			expCmds: []string{"show servers state"},
+			expBody: "1\n# be_id be_name\n",
+		},
+		// 3
+		{
+			method:  http.MethodGet,
+			path:    "/v1/servers-state?backend=default_app_8080",
+			expCode: http.StatusOK,
+			expCmds: []string{"show servers state default_app_8080"},
+			expBody: "\n",
+		},
+		// 4
+		{
+			method:  http.MethodGet,
+			path:    "/v1/servers-state?backend=app%3Bshutdown+sessions",
+			expCode: http.StatusBadRequest,
+		},
+		// 5
+		{
+			method:  http.MethodPost,
+			path:    "/v1/server-state",
+			body:    "backend=default_app_8080&server=srv001&state=drain",
+			expCode: http.StatusOK,
+			expCmds: []string{"set server default_app_8080/srv001 state drain"},
+			logging: `INFO runtime api: set server default_app_8080/srv001 state drain`,
+		},
+		// 6
+		{
+			method:  http.MethodPost,
+			path:    "/v1/server-state?backend=default_app_8080&server=srv001&state=ready",
+			expCode: http.StatusOK,
+			expCmds: []string{"set server default_app_8080/srv001 state ready"},
+			logging: `INFO runtime api: set server default_app_8080/srv001 state ready`,
+		},
+		// 7
+		{
+			method:  http.MethodPost,
+			path:    "/v1/server-state",
+			body:    "backend=default_app_8080&server=srv001&state=stopped",
+			expCode: http.StatusBadRequest,
+		},
+		// 8
+		{
+			method:  http.MethodPost,
+			path:    "/v1/server-state",
+			body:    "backend=default_app_8080&state=maint",
+			expCode: http.StatusBadRequest,
+		},
+		// 9
+		{
+			method:  http.MethodPost,
+			path:    "/v1/server-state",
+			body:    "backend=default_app_8080&server=srv099&state=maint",
+			output:  "No such server.",
+			expCode: http.StatusUnprocessableEntity,
+			expCmds: []string{"set server default_app_8080/srv099 state maint"},
+			expBody: "No such server.\n",
+		},
+		// 10
+		{
+			method:  http.MethodGet,
+			path:    "/v1/server-state",
+			expCode: http.StatusMethodNotAllowed,
+		},
+		// 11
+		{
+			method:  http.MethodGet,
+			path:    "/v1/stat",
+			err:     fmt.Errorf("connection refused"),
+			expCode: http.StatusInternalServerError,
+			expCmds: []string{"show stat"},
+			expBody: "error running command: connection refused\n",
+			logging: `ERROR runtime api: error running 'show stat': connection refused`,
+		},
+		// 12
+		{
+			method:  http.MethodGet,
+			path:    "/v1/info",
+			expCode: http.StatusNotFound,
+		},
+		// 13
+		{
+			method:  http.MethodPost,
+			path:    "/v1/pod-state",
+			body:    "pod=default/app-1&state=drain",
+			servers: []string{"default_app_8080/srv001", "default_app2_8080/srv003"},
+			expCode: http.StatusOK,
+			expCmds: []string{"pod-state default/app-1 drain"},
+			expBody: `["default_app_8080/srv001","default_app2_8080/srv003"]`,
+		},
+		// 14
+		{
+			method:  http.MethodPost,
+			path:    "/v1/pod-state?pod=default/app-1&state=ready",
+			expCode: http.StatusNotFound,
+			expCmds: []string{"pod-state default/app-1 ready"},
+			expBody: "no backend server found for pod 'default/app-1'\n",
+		},
+		// 15
+		{
+			method:  http.MethodPost,
+			path:    "/v1/pod-state",
+			body:    "pod=app-1&state=drain",
+			expCode: http.StatusBadRequest,
+		},
+		// 16
+		{
+			method:  http.MethodPost,
+			path:    "/v1/pod-state",
+			body:    "pod=default/app-1&state=up",
+			expCode: http.StatusBadRequest,
+		},
+		// 17
+		{
+			method:  http.MethodPost,
+			path:    "/v1/pod-state",
+			body:    "pod=default/app-1&state=maint",
+			err:     fmt.Errorf("admin socket not found"),
+			expCode: http.StatusUnprocessableEntity,
+			expCmds: []string{"pod-state default/app-1 maint"},
+			expBody: "error changing servers state: admin socket not found\n",
+		},
+		// 18
+		{
+			method:  http.MethodPost,
+			path:    "/v1/resync",
+			expCode: http.StatusOK,
+			expCmds: []string{"resync"},
+			expBody: "Full resync successfully started.\n",
+		},
+		// 19
+		{
+			method:  http.MethodGet,
+			path:    "/v1/resync",
+			expCode: http.StatusMethodNotAllowed,
+		},
+	}
+	for i, test := range testCases {
+		logger := &types_helper.LoggerMock{T: t}
+		var cmds []string
+		handler := &runtimeAPI{
+			logger: logger,
+			command: func(cmd string) (string, error) {
+				cmds = append(cmds, cmd)
+				return test.output, test.err
+			},
+			setPodState: func(pod, state string) ([]string, error) {
+				cmds = append(cmds, "pod-state "+pod+" "+state)
+				return test.servers, test.err
+			},
+			resync: func() {
+				cmds = append(cmds, "resync")
+			},
+		}
+		req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		if test.body != "" {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != test.expCode {
+			t.Errorf("%d: expected status %d but was %d: %s", i, test.expCode, rec.Code, rec.Body.String())
+		}
+		if !reflect.DeepEqual(cmds, test.expCmds) {
+			t.Errorf("%d: expected commands %v but was %v", i, test.expCmds, cmds)
+		}
+		if test.expBody != "" && rec.Body.String() != test.expBody {
+			t.Errorf("%d: expected body %q but was %q", i, test.expBody, rec.Body.String())
+		}
+		logger.CompareLogging(test.logging)
+	}
+}
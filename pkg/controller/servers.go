@@ -0,0 +1,136 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	hatypes "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/types"
+	hautils "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/utils"
+)
+
+// serverState is a backend server and its current state in haproxy.
+type serverState struct {
+	Backend string `json:"backend"`
+	Server  string `json:"server"`
+	Address string `json:"address"`
+	Pod     string `json:"pod,omitempty"`
+	State   string `json:"state"`
+}
+
+// serverPods keeps the pod of every backend server of the haproxy model,
+// the model itself isn't thread safe and cannot be read by the admin
+// endpoints.
+type serverPods struct {
+	mutex sync.Mutex
+	// pods is a map of `<backend>/<server>` to `<namespace>/<pod>`
+	pods map[string]string
+}
+
+// update rebuilds the pods of the backend servers. Should be called from
+// the same goroutine that updates the model.
+func (s *serverPods) update(backends *hatypes.Backends) {
+	pods := map[string]string{}
+	for _, backend := range backends.Items() {
+		for _, ep := range backend.Endpoints {
+			if ep.Enabled && ep.TargetRef != "" {
+				pods[backend.ID+"/"+ep.Name] = ep.TargetRef
+			}
+		}
+	}
+	s.mutex.Lock()
+	s.pods = pods
+	s.mutex.Unlock()
+}
+
+// podOf returns the pod of a backend server, if any.
+func (s *serverPods) podOf(backend, server string) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.pods[backend+"/"+server]
+}
+
+// serversOf returns the sorted `<backend>/<server>` list of a pod.
+func (s *serverPods) serversOf(pod string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var servers []string
+	for server, p := range s.pods {
+		if p == pod {
+			servers = append(servers, server)
+		}
+	}
+	sort.Strings(servers)
+	return servers
+}
+
+// buildServersState adds the pod and a readable state to the output of
+// `show servers state`.
+func (s *serverPods) buildServersState(states []hautils.ServerState) []serverState {
+	servers := make([]serverState, 0, len(states))
+	for _, state := range states {
+		var st string
+		switch {
+		case state.Maint():
+			st = "maint"
+		case state.Drain():
+			st = "drain"
+		case state.Up():
+			st = "up"
+		default:
+			st = "down"
+		}
+		servers = append(servers, serverState{
+			Backend: state.Backend,
+			Server:  state.Server,
+			Address: fmt.Sprintf("%s:%d", state.Addr, state.Port),
+			Pod:     s.podOf(state.Backend, state.Server),
+			State:   st,
+		})
+	}
+	return servers
+}
+
+// setPodState changes the state of all the backend servers of a pod,
+// using command to send the `set server` commands to haproxy.
+func (s *serverPods) setPodState(pod, state string, command func(cmd ...string) ([]string, error)) ([]string, error) {
+	if state != "ready" && state != "drain" && state != "maint" {
+		return nil, fmt.Errorf("invalid server state, should be one of ready, drain or maint: %s", state)
+	}
+	servers := s.serversOf(pod)
+	if len(servers) == 0 {
+		return nil, nil
+	}
+	cmds := make([]string, len(servers))
+	for i, server := range servers {
+		cmds[i] = fmt.Sprintf("set server %s state %s", server, state)
+	}
+	out, err := command(cmds...)
+	if err != nil {
+		return nil, err
+	}
+	for i, msg := range out {
+		// set server doesn't output anything on success
+		if msg = strings.TrimSpace(msg); msg != "" {
+			return servers[:i], fmt.Errorf("error changing %s: %s", servers[i], msg)
+		}
+	}
+	return servers, nil
+}
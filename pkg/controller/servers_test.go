@@ -0,0 +1,137 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	hatypes "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/types"
+	hautils "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/utils"
+)
+
+func TestServerPods(t *testing.T) {
+	backends := hatypes.CreateBackends(0)
+	b1 := backends.AcquireBackend("default", "app1", "8080")
+	b1.AcquireEndpoint("10.0.0.11", 8080, "default/app1-1").Enabled = true
+	b1.AcquireEndpoint("10.0.0.12", 8080, "default/app1-2").Enabled = true
+	b1.AddEmptyEndpoint()
+	b2 := backends.AcquireBackend("default", "app2", "8080")
+	b2.AcquireEndpoint("10.0.0.11", 8081, "default/app1-1").Enabled = true
+	b2.AcquireEndpoint("192.168.0.10", 80, "").Enabled = true
+	s := &serverPods{}
+	s.update(backends)
+
+	states := []hautils.ServerState{
+		{Backend: "default_app1_8080", Server: "srv001", Addr: "10.0.0.11", Port: 8080, OpState: 2},
+		{Backend: "default_app1_8080", Server: "srv002", Addr: "10.0.0.12", Port: 8080, OpState: 2, AdminState: 8},
+		{Backend: "default_app1_8080", Server: "srv003", Addr: "127.0.0.1", Port: 1023, AdminState: 5},
+		{Backend: "default_app2_8080", Server: "srv001", Addr: "10.0.0.11", Port: 8081, OpState: 0},
+		{Backend: "default_app2_8080", Server: "srv002", Addr: "192.168.0.10", Port: 80, OpState: 2},
+	}
+	expStates := []serverState{
+		{Backend: "default_app1_8080", Server: "srv001", Address: "10.0.0.11:8080", Pod: "default/app1-1", State: "up"},
+		{Backend: "default_app1_8080", Server: "srv002", Address: "10.0.0.12:8080", Pod: "default/app1-2", State: "drain"},
+		{Backend: "default_app1_8080", Server: "srv003", Address: "127.0.0.1:1023", State: "maint"},
+		{Backend: "default_app2_8080", Server: "srv001", Address: "10.0.0.11:8081", Pod: "default/app1-1", State: "down"},
+		{Backend: "default_app2_8080", Server: "srv002", Address: "192.168.0.10:80", State: "up"},
+	}
+	if actual := s.buildServersState(states); !reflect.DeepEqual(actual, expStates) {
+		t.Errorf("servers state differs - expected: %+v - actual: %+v", expStates, actual)
+	}
+
+	testCases := []struct {
+		pod        string
+		state      string
+		output     []string
+		expCmds    []string
+		expServers []string
+		expError   string
+	}{
+		// 0
+		{
+			pod:   "default/app1-1",
+			state: "drain",
+			expCmds: []string{
+				"set server default_app1_8080/srv001 state drain",
+				"set server default_app2_8080/srv001 state drain",
+			},
+			expServers: []string{"default_app1_8080/srv001", "default_app2_8080/srv001"},
+		},
+		// 1
+		{
+			pod:        "default/app1-2",
+			state:      "ready",
+			expCmds:    []string{"set server default_app1_8080/srv002 state ready"},
+			expServers: []string{"default_app1_8080/srv002"},
+		},
+		// 2
+		{
+			pod:   "default/app2-1",
+			state: "maint",
+		},
+		// 3
+		{
+			pod:      "default/app1-2",
+			state:    "stopped",
+			expError: "invalid server state, should be one of ready, drain or maint: stopped",
+		},
+		// 4
+		{
+			pod:    "default/app1-1",
+			state:  "maint",
+			output: []string{"", "No such server."},
+			expCmds: []string{
+				"set server default_app1_8080/srv001 state maint",
+				"set server default_app2_8080/srv001 state maint",
+			},
+			expServers: []string{"default_app1_8080/srv001"},
+			expError:   "error changing default_app2_8080/srv001: No such server.",
+		},
+	}
+	for i, test := range testCases {
+		var cmds []string
+		servers, err := s.setPodState(test.pod, test.state, func(cmd ...string) ([]string, error) {
+			cmds = cmd
+			if test.output != nil {
+				return test.output, nil
+			}
+			return make([]string, len(cmd)), nil
+		})
+		var errMsg string
+		if err != nil {
+			errMsg = err.Error()
+		}
+		if errMsg != test.expError {
+			t.Errorf("error differs on %d - expected: %s - actual: %s", i, test.expError, errMsg)
+		}
+		if !reflect.DeepEqual(cmds, test.expCmds) {
+			t.Errorf("commands differ on %d - expected: %v - actual: %v", i, test.expCmds, cmds)
+		}
+		if !reflect.DeepEqual(servers, test.expServers) {
+			t.Errorf("servers differ on %d - expected: %v - actual: %v", i, test.expServers, servers)
+		}
+	}
+
+	_, err := s.setPodState("default/app1-1", "drain", func(cmd ...string) ([]string, error) {
+		return nil, fmt.Errorf("connection refused")
+	})
+	if err == nil || err.Error() != "connection refused" {
+		t.Errorf("expected connection refused error, but was %v", err)
+	}
+}
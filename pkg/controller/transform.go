@@ -0,0 +1,105 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// TransformFunc changes an object received from the apiserver before it
+// is added to the informer's cache. Used to reduce the memory footprint
+// of the cache, removing fields the controller doesn't read.
+type TransformFunc func(obj runtime.Object)
+
+// unusedSecretTypes has the secret types whose data is never read by
+// the controller. Such secrets are kept in the cache, without their data.
+var unusedSecretTypes = map[api.SecretType]bool{
+	api.SecretTypeServiceAccountToken: true,
+	api.SecretTypeDockercfg:           true,
+	api.SecretTypeDockerConfigJson:    true,
+	api.SecretTypeBootstrapToken:      true,
+	"helm.sh/release.v1":              true,
+}
+
+// transformObject is the default TransformFunc of the controller's informers.
+func transformObject(obj runtime.Object) {
+	if m, err := meta.Accessor(obj); err == nil {
+		m.SetManagedFields(nil)
+		if ann := m.GetAnnotations(); ann != nil {
+			delete(ann, api.LastAppliedConfigAnnotation)
+		}
+	}
+	switch o := obj.(type) {
+	case *api.Secret:
+		if unusedSecretTypes[o.Type] {
+			o.Data = nil
+			o.StringData = nil
+		}
+	case *api.Pod:
+		// pods are used to read IP, ports and termination state
+		o.Annotations = nil
+		o.Spec.Volumes = nil
+		o.Spec.InitContainers = nil
+		o.Spec.EphemeralContainers = nil
+		for i := range o.Spec.Containers {
+			c := &o.Spec.Containers[i]
+			c.Command = nil
+			c.Args = nil
+			c.Env = nil
+			c.EnvFrom = nil
+			c.VolumeMounts = nil
+		}
+		o.Status.InitContainerStatuses = nil
+		o.Status.ContainerStatuses = nil
+		o.Status.EphemeralContainerStatuses = nil
+	}
+}
+
+// transformListWatch wraps lw, calling transform on every object
+// received by the list and watch operations.
+func transformListWatch(lw cache.ListerWatcher, transform TransformFunc) cache.ListerWatcher {
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			list, err := lw.List(options)
+			if err != nil {
+				return nil, err
+			}
+			err = meta.EachListItem(list, func(obj runtime.Object) error {
+				transform(obj)
+				return nil
+			})
+			return list, err
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			w, err := lw.Watch(options)
+			if err != nil {
+				return nil, err
+			}
+			return watch.Filter(w, func(in watch.Event) (watch.Event, bool) {
+				if in.Type != watch.Error && in.Type != watch.Bookmark {
+					transform(in.Object)
+				}
+				return in, true
+			}), nil
+		},
+	}
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestTransformObject(t *testing.T) {
+	managedFields := []meta.ManagedFieldsEntry{{Manager: "kubectl"}}
+	testCases := []struct {
+		obj      runtime.Object
+		expected runtime.Object
+	}{
+		// 0
+		{
+			obj: &api.Service{ObjectMeta: meta.ObjectMeta{
+				Annotations: map[string]string{
+					api.LastAppliedConfigAnnotation:           "{}",
+					"ingress.kubernetes.io/balance-algorithm": "first",
+				},
+				ManagedFields: managedFields,
+			}},
+			expected: &api.Service{ObjectMeta: meta.ObjectMeta{
+				Annotations: map[string]string{
+					"ingress.kubernetes.io/balance-algorithm": "first",
+				},
+			}},
+		},
+		// 1
+		{
+			obj: &api.Secret{
+				Type: api.SecretTypeTLS,
+				Data: map[string][]byte{api.TLSCertKey: []byte("crt")},
+			},
+			expected: &api.Secret{
+				Type: api.SecretTypeTLS,
+				Data: map[string][]byte{api.TLSCertKey: []byte("crt")},
+			},
+		},
+		// 2
+		{
+			obj: &api.Secret{
+				Type: api.SecretTypeServiceAccountToken,
+				Data: map[string][]byte{"token": []byte("abc")},
+			},
+			expected: &api.Secret{
+				Type: api.SecretTypeServiceAccountToken,
+			},
+		},
+		// 3
+		{
+			obj: &api.Pod{
+				ObjectMeta: meta.ObjectMeta{
+					Labels:      map[string]string{"app": "echo"},
+					Annotations: map[string]string{"some": "annotation"},
+				},
+				Spec: api.PodSpec{
+					Volumes: []api.Volume{{Name: "data"}},
+					Containers: []api.Container{{
+						Name:  "echo",
+						Env:   []api.EnvVar{{Name: "PORT", Value: "8080"}},
+						Ports: []api.ContainerPort{{Name: "http", ContainerPort: 8080}},
+					}},
+				},
+				Status: api.PodStatus{
+					PodIP:             "172.17.0.11",
+					ContainerStatuses: []api.ContainerStatus{{Name: "echo"}},
+				},
+			},
+			expected: &api.Pod{
+				ObjectMeta: meta.ObjectMeta{
+					Labels: map[string]string{"app": "echo"},
+				},
+				Spec: api.PodSpec{
+					Containers: []api.Container{{
+						Name:  "echo",
+						Ports: []api.ContainerPort{{Name: "http", ContainerPort: 8080}},
+					}},
+				},
+				Status: api.PodStatus{
+					PodIP: "172.17.0.11",
+				},
+			},
+		},
+	}
+	for i, test := range testCases {
+		transformObject(test.obj)
+		if !reflect.DeepEqual(test.obj, test.expected) {
+			t.Errorf("object differs on %d, expected %+v but was %+v", i, test.expected, test.obj)
+		}
+	}
+}
+
+func TestTransformListWatch(t *testing.T) {
+	fakeWatch := watch.NewFake()
+	lw := &cache.ListWatch{
+		ListFunc: func(options meta.ListOptions) (runtime.Object, error) {
+			return &api.SecretList{Items: []api.Secret{
+				{Type: api.SecretTypeOpaque, Data: map[string][]byte{"auth": []byte("usr:pwd")}},
+				{Type: api.SecretTypeDockerConfigJson, Data: map[string][]byte{".dockerconfigjson": []byte("{}")}},
+			}}, nil
+		},
+		WatchFunc: func(options meta.ListOptions) (watch.Interface, error) {
+			return fakeWatch, nil
+		},
+	}
+	tlw := transformListWatch(lw, transformObject)
+
+	list, err := tlw.List(meta.ListOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	items := list.(*api.SecretList).Items
+	if items[0].Data == nil {
+		t.Errorf("expected data of the opaque secret")
+	}
+	if items[1].Data != nil {
+		t.Errorf("expected data of the docker config secret to be removed")
+	}
+
+	w, err := tlw.Watch(meta.ListOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer w.Stop()
+	go fakeWatch.Add(&api.Secret{
+		ObjectMeta: meta.ObjectMeta{ManagedFields: []meta.ManagedFieldsEntry{{Manager: "kubectl"}}},
+	})
+	event := <-w.ResultChan()
+	if sec := event.Object.(*api.Secret); sec.ManagedFields != nil {
+		t.Errorf("expected managed fields to be removed")
+	}
+}
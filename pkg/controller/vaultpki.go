@@ -0,0 +1,240 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/common/ingress"
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/common/net/ssl"
+	convtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/types"
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/types"
+)
+
+// vaultPKI issues server certificates from the PKI secrets engine of
+// HashiCorp Vault. Certificates are stored in the same directory of the
+// certificates read from secrets, and renewed in the background after
+// two thirds of their lifetime. A renewed certificate is written in the
+// same file, so haproxy can be updated via runtime api.
+type vaultPKI struct {
+	logger    types.Logger
+	client    *http.Client
+	address   string
+	tokenFile string
+	interval  time.Duration
+	notify    func(name string)
+	store     func(name string, crt, key []byte) (*ingress.SSLCert, error)
+	now       func() time.Time
+	mutex     sync.Mutex
+	certs     map[string]*vaultCert
+}
+
+type vaultCert struct {
+	mount     string
+	role      string
+	hostname  string
+	file      convtypes.CrtFile
+	notBefore time.Time
+	// if it was read since the last collect
+	read bool
+}
+
+type vaultIssueResponse struct {
+	Data struct {
+		Certificate string   `json:"certificate"`
+		IssuingCA   string   `json:"issuing_ca"`
+		CAChain     []string `json:"ca_chain"`
+		PrivateKey  string   `json:"private_key"`
+	} `json:"data"`
+	Errors []string `json:"errors"`
+}
+
+func newVaultPKI(logger types.Logger, address, tokenFile string, notify func(name string)) *vaultPKI {
+	return &vaultPKI{
+		logger:    logger,
+		client:    &http.Client{Timeout: 30 * time.Second},
+		address:   strings.TrimSuffix(address, "/"),
+		tokenFile: tokenFile,
+		interval:  time.Minute,
+		notify:    notify,
+		store: func(name string, crt, key []byte) (*ingress.SSLCert, error) {
+			return ssl.AddOrUpdateCertAndKey(name, crt, key, nil)
+		},
+		now:   time.Now,
+		certs: map[string]*vaultCert{},
+	}
+}
+
+// vaultCertName is the name used to track a certificate issued by Vault.
+// The tracker expects the namespace/name format of secrets, so the slashes
+// of the mount are changed, and a prefix that cannot be found in a
+// namespace name is used.
+func vaultCertName(mount, role, hostname string) string {
+	return "vault:" + strings.ReplaceAll(strings.Trim(mount, "/"), "/", ":") + "/" + role + ":" + hostname
+}
+
+// Run renews the certificates close to expire until stopCh is closed.
+func (v *vaultPKI) Run(stopCh <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(v.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				v.renew()
+			}
+		}
+	}()
+}
+
+// Get returns the certificate of a hostname issued by the role of a PKI
+// mount, issuing a new one if it wasn't issued yet or if it's close to expire.
+func (v *vaultPKI) Get(mount, role, hostname string) (convtypes.CrtFile, error) {
+	name := vaultCertName(mount, role, hostname)
+	v.mutex.Lock()
+	cert, found := v.certs[name]
+	if found && !v.needRenew(cert) {
+		cert.read = true
+		file := cert.file
+		v.mutex.Unlock()
+		return file, nil
+	}
+	v.mutex.Unlock()
+	if !found {
+		cert = &vaultCert{mount: mount, role: role, hostname: hostname}
+	}
+	file, notBefore, err := v.issue(cert)
+	if err != nil {
+		return convtypes.CrtFile{}, err
+	}
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	cert.file = file
+	cert.notBefore = notBefore
+	cert.read = true
+	v.certs[name] = cert
+	return file, nil
+}
+
+// Collect removes the certificates that weren't read since the last call,
+// and whose keep func returns false. Removed certificates aren't renewed.
+func (v *vaultPKI) Collect(keep func(name string) bool) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	for name, cert := range v.certs {
+		if !cert.read && !keep(name) {
+			v.logger.InfoV(2, "stopping renewal of vault certificate %s", name)
+			delete(v.certs, name)
+		} else {
+			cert.read = false
+		}
+	}
+}
+
+func (v *vaultPKI) needRenew(cert *vaultCert) bool {
+	lifetime := cert.file.NotAfter.Sub(cert.notBefore)
+	return v.now().After(cert.notBefore.Add(lifetime * 2 / 3))
+}
+
+func (v *vaultPKI) renew() {
+	v.mutex.Lock()
+	var renew []*vaultCert
+	for _, cert := range v.certs {
+		if v.needRenew(cert) {
+			renew = append(renew, cert)
+		}
+	}
+	v.mutex.Unlock()
+	for _, cert := range renew {
+		name := vaultCertName(cert.mount, cert.role, cert.hostname)
+		file, notBefore, err := v.issue(cert)
+		if err != nil {
+			v.logger.Warn("error renewing vault certificate %s: %v", name, err)
+			continue
+		}
+		v.mutex.Lock()
+		cert.file = file
+		cert.notBefore = notBefore
+		v.mutex.Unlock()
+		v.logger.Info("vault certificate %s renewed, expires %s", name, file.NotAfter.Format(time.RFC3339))
+		v.notify(name)
+	}
+}
+
+// issue asks Vault for a new certificate and private key, and writes them
+// in the certificate storage. The file name doesn't change between renewals.
+func (v *vaultPKI) issue(cert *vaultCert) (file convtypes.CrtFile, notBefore time.Time, err error) {
+	token, err := ioutil.ReadFile(v.tokenFile)
+	if err != nil {
+		return file, notBefore, fmt.Errorf("cannot read vault token: %w", err)
+	}
+	payload, _ := json.Marshal(map[string]string{"common_name": cert.hostname})
+	u := v.address + "/v1/" + strings.Trim(cert.mount, "/") + "/issue/" + cert.role
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(payload))
+	if err != nil {
+		return file, notBefore, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Vault-Token", strings.TrimSpace(string(token)))
+	res, err := v.client.Do(req)
+	if err != nil {
+		return file, notBefore, err
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	var issued vaultIssueResponse
+	if err := json.Unmarshal(body, &issued); err != nil && res.StatusCode == http.StatusOK {
+		return file, notBefore, fmt.Errorf("cannot parse vault response: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		msg := strings.Join(issued.Errors, "; ")
+		if msg == "" {
+			msg = strings.TrimSpace(string(body))
+		}
+		return file, notBefore, fmt.Errorf("vault returned %d: %s", res.StatusCode, msg)
+	}
+	if issued.Data.Certificate == "" || issued.Data.PrivateKey == "" {
+		return file, notBefore, fmt.Errorf("vault response does not have certificate and private key")
+	}
+	chain := issued.Data.CAChain
+	if len(chain) == 0 && issued.Data.IssuingCA != "" {
+		chain = []string{issued.Data.IssuingCA}
+	}
+	crt := strings.Join(append([]string{issued.Data.Certificate}, chain...), "\n")
+	storeName := "vault_" + strings.NewReplacer("/", "_", "*", "_").Replace(strings.Trim(cert.mount, "/")+"_"+cert.role+"_"+cert.hostname)
+	sslCert, err := v.store(storeName, []byte(crt+"\n"), []byte(issued.Data.PrivateKey))
+	if err != nil {
+		return file, notBefore, err
+	}
+	file = convtypes.CrtFile{
+		Filename:   sslCert.PemFileName,
+		SHA1Hash:   sslCert.PemSHA,
+		CommonName: sslCert.Certificate.Subject.CommonName,
+		DNSNames:   sslCert.CN,
+		NotAfter:   sslCert.Certificate.NotAfter,
+	}
+	return file, sslCert.Certificate.NotBefore, nil
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/common/ingress"
+	types_helper "github.com/jcmoraisjr/haproxy-ingress/pkg/types/helper_test"
+)
+
+func TestVaultPKI(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempdir)
+	tokenFile := filepath.Join(tempdir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("s.token\n"), 0600); err != nil {
+		t.Fatalf("error writing token: %v", err)
+	}
+
+	var reqs []string
+	issued := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		reqs = append(reqs, r.Method+" "+r.URL.Path+" "+r.Header.Get("X-Vault-Token")+" "+payload["common_name"])
+		if r.URL.Path != "/v1/pki/issue/web" {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"errors":["permission denied"]}`)
+			return
+		}
+		issued++
+		fmt.Fprintf(w, `{"data":{"certificate":"crt%d","issuing_ca":"ca","private_key":"key"}}`, issued)
+	}))
+	defer server.Close()
+
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	var stored []string
+	var notified []string
+	logger := types_helper.NewLoggerMock(t)
+	v := newVaultPKI(logger, server.URL+"/", tokenFile, func(name string) {
+		notified = append(notified, name)
+	})
+	v.now = func() time.Time { return now }
+	v.store = func(name string, crt, key []byte) (*ingress.SSLCert, error) {
+		stored = append(stored, name+" "+strings.ReplaceAll(string(crt), "\n", ",")+" "+string(key))
+		return &ingress.SSLCert{
+			Certificate: &x509.Certificate{
+				Subject:   pkix.Name{CommonName: "echo.local"},
+				NotBefore: now,
+				NotAfter:  now.Add(90 * time.Hour),
+			},
+			PemFileName: "/tls/" + name + ".pem",
+			PemSHA:      string(crt),
+		}, nil
+	}
+	check := func(step string, expReqs, expStored, expNotified []string) {
+		if fmt.Sprint(reqs) != fmt.Sprint(expReqs) {
+			t.Errorf("%s: expected requests %v but was %v", step, expReqs, reqs)
+		}
+		if fmt.Sprint(stored) != fmt.Sprint(expStored) {
+			t.Errorf("%s: expected stored %v but was %v", step, expStored, stored)
+		}
+		if fmt.Sprint(notified) != fmt.Sprint(expNotified) {
+			t.Errorf("%s: expected notified %v but was %v", step, expNotified, notified)
+		}
+		reqs = nil
+		stored = nil
+		notified = nil
+	}
+
+	// issue
+	file, err := v.Get("pki", "web", "echo.local")
+	if err != nil {
+		t.Errorf("unexpected error issuing certificate: %v", err)
+	}
+	if file.Filename != "/tls/vault_pki_web_echo.local.pem" || file.CommonName != "echo.local" {
+		t.Errorf("unexpected certificate file: %+v", file)
+	}
+	check("issue",
+		[]string{"POST /v1/pki/issue/web s.token echo.local"},
+		[]string{"vault_pki_web_echo.local crt1,ca, key"},
+		nil)
+
+	// cached
+	now = start.Add(59 * time.Hour)
+	_, _ = v.Get("pki", "web", "echo.local")
+	v.renew()
+	check("cached", nil, nil, nil)
+
+	// renew in the background
+	now = start.Add(61 * time.Hour)
+	v.renew()
+	file, _ = v.Get("pki", "web", "echo.local")
+	if file.SHA1Hash != "crt2\nca\n" {
+		t.Errorf("expected renewed certificate but was %q", file.SHA1Hash)
+	}
+	check("renew",
+		[]string{"POST /v1/pki/issue/web s.token echo.local"},
+		[]string{"vault_pki_web_echo.local crt2,ca, key"},
+		[]string{"vault:pki/web:echo.local"})
+
+	// vault error
+	_, err = v.Get("pki-int", "web", "echo.local")
+	if err == nil || err.Error() != "vault returned 403: permission denied" {
+		t.Errorf("expected permission denied error but was %v", err)
+	}
+	check("error", []string{"POST /v1/pki-int/issue/web s.token echo.local"}, nil, nil)
+
+	// collect, the first one resets the read state
+	v.Collect(func(name string) bool { return false })
+	if len(v.certs) != 1 {
+		t.Errorf("expected one certificate after the first collect but was %d", len(v.certs))
+	}
+	v.Collect(func(name string) bool { return false })
+	if len(v.certs) != 0 {
+		t.Errorf("expected no certificate after the second collect but was %d", len(v.certs))
+	}
+
+	logger.CompareLogging(`
+INFO vault certificate vault:pki/web:echo.local renewed, expires 2021-01-07T07:00:00Z
+INFO-V(2) stopping renewal of vault certificate vault:pki/web:echo.local`)
+}
@@ -0,0 +1,37 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+const (
+	roleAll     = "all"
+	roleControl = "control"
+	roleProxy   = "proxy"
+)
+
+// controllerRole distributes the work based on the --controller-role
+// command-line option.
+type controllerRole string
+
+// implements types.WorkDistribution
+func (r controllerRole) LeaderWork() bool {
+	return r == roleAll || r == roleControl
+}
+
+// implements types.WorkDistribution
+func (r controllerRole) ProxyWork() bool {
+	return r == roleAll || r == roleProxy
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+)
+
+func TestControllerRole(t *testing.T) {
+	testCases := []struct {
+		role      string
+		expLeader bool
+		expProxy  bool
+	}{
+		// 0
+		{
+			role:      roleAll,
+			expLeader: true,
+			expProxy:  true,
+		},
+		// 1
+		{
+			role:      roleControl,
+			expLeader: true,
+			expProxy:  false,
+		},
+		// 2
+		{
+			role:      roleProxy,
+			expLeader: false,
+			expProxy:  true,
+		},
+	}
+	for i, test := range testCases {
+		work := controllerRole(test.role)
+		if leader := work.LeaderWork(); leader != test.expLeader {
+			t.Errorf("leader work differs on %d, expected %v but was %v", i, test.expLeader, leader)
+		}
+		if proxy := work.ProxyWork(); proxy != test.expProxy {
+			t.Errorf("proxy work differs on %d, expected %v but was %v", i, test.expProxy, proxy)
+		}
+	}
+}
@@ -19,12 +19,14 @@ package configmap
 import (
 	"fmt"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
 	convtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/types"
 	convutils "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/utils"
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy"
+	hatypes "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/types"
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/types"
 )
 
@@ -48,14 +50,21 @@ type tcpSvcConverter struct {
 	haproxy haproxy.Config
 }
 
-var regexValidTime = regexp.MustCompile(`^[0-9]+(us|ms|s|m|h|d)$`)
+var (
+	regexValidTime = regexp.MustCompile(`^[0-9]+(us|ms|s|m|h|d)$`)
+	regexValidSNI  = regexp.MustCompile(`^[a-z0-9]([a-z0-9.-]*[a-z0-9])?$`)
+)
 
 func (c *tcpSvcConverter) Sync(tcpservices map[string]string) {
-	c.haproxy.TCPBackends().RemoveAll()
+	tcpbackends := c.haproxy.TCPBackends()
+	c.haproxy.AcmeData().Storages().RemoveAll(tcpbackends.AcmeStorages)
+	tcpbackends.AcmeStorages = nil
+	tcpbackends.RemoveAll()
 
 	// map[key]value is:
 	// - key   => port to expose
-	// - value => <service-name>:<port>:[<PROXY>]:[<PROXY[-<V1|V2>]]:<secret-name-cert>:check-interval:<secret-name-ca>
+	// - value => comma-separated list of [<sni>=]<service-spec>, at most one without sni
+	// - service-spec => <service-name>:<port>:[<PROXY>]:[<PROXY[-<V1|V2>]]:<secret-name-cert>:check-interval:<secret-name-ca>:<SSL>
 	//   - 0: namespace/name of the target service
 	//   - 1: target port number
 	//   - 2: "PROXY" means accept proxy protocol
@@ -63,103 +72,205 @@ func (c *tcpSvcConverter) Sync(tcpservices map[string]string) {
 	//   - 4: namespace/name of crt/key secret if should ssl-offload
 	//   - 5: check interval
 	//   - 6: namespace/name of ca/crl secret if should verify client ssl
+	//   - 7: "SSL" means connect to the service using ssl
+	//   - 8: "ACME" means the crt/key secret is signed by the acme signer, using sni as the domain
 	for k, v := range tcpservices {
 		publicport, err := strconv.Atoi(k)
 		if err != nil {
 			c.logger.Warn("skipping invalid public listening port of TCP service: %s", k)
 			continue
 		}
-		svc := c.parseService(v)
-		if svc.name == "" {
-			c.logger.Warn("skipping empty TCP service name on public port %d", publicport)
-			continue
-		}
-		service, err := c.cache.GetService(svc.name)
-		if err != nil {
-			c.logger.Warn("skipping TCP service on public port %d: %v", publicport, err)
-			continue
-		}
-		svcport := convutils.FindServicePort(service, svc.port)
-		if svcport == nil {
-			c.logger.Warn("skipping TCP service on public port %d: port not found: %s:%s", publicport, svc.name, svc.port)
-			continue
-		}
-		addrs, _, err := convutils.CreateEndpoints(c.cache, service, svcport)
-		if err != nil {
-			c.logger.Warn("skipping TCP service on public port %d: %v", svc.port, err)
-			continue
-		}
-		var crtfile convtypes.CrtFile
-		if svc.secretTLS != "" {
-			crtfile, err = c.cache.GetTLSSecretPath("", svc.secretTLS, convtypes.TrackingTarget{})
-			if err != nil {
-				c.logger.Warn("skipping TCP service on public port %d: %v", publicport, err)
+		var defaultBackend *hatypes.TCPBackend
+		var sniRoutes []*hatypes.TCPBackend
+		snis := map[string]bool{}
+		for _, spec := range strings.Split(v, ",") {
+			svc := c.parseService(strings.TrimSpace(spec))
+			if svc.name == "" {
+				c.logger.Warn("skipping empty TCP service name on public port %d", publicport)
 				continue
 			}
-		}
-		var cafile, crlfile convtypes.File
-		if svc.secretCA != "" {
-			cafile, crlfile, err = c.cache.GetCASecretPath("", svc.secretCA, convtypes.TrackingTarget{})
+			if snis[svc.sni] {
+				if svc.sni == "" {
+					c.logger.Warn("skipping duplicated TCP service without sni on public port %d", publicport)
+				} else {
+					c.logger.Warn("skipping duplicated sni '%s' of TCP service on public port %d", svc.sni, publicport)
+				}
+				continue
+			}
+			if svc.sni != "" && !regexValidSNI.MatchString(svc.sni) {
+				c.logger.Warn("skipping invalid sni '%s' of TCP service on public port %d", svc.sni, publicport)
+				continue
+			}
+			snis[svc.sni] = true
+			if strings.ToLower(svc.certSigner) == "acme" {
+				c.addAcmeStorage(publicport, svc)
+			}
+			backend, err := c.readService(publicport, svc)
 			if err != nil {
 				c.logger.Warn("skipping TCP service on public port %d: %v", publicport, err)
 				continue
 			}
-		}
-		checkInterval := "2s"
-		if svc.checkInt != "" {
-			if svc.checkInt == "-" {
-				checkInterval = ""
-			} else if regexValidTime.MatchString(svc.checkInt) {
-				checkInterval = svc.checkInt
+			if svc.sni == "" {
+				defaultBackend = backend
 			} else {
-				c.logger.Warn(
-					"using default check interval '%s' due to an invalid time config on TCP service %d: %s",
-					checkInterval, publicport, svc.checkInt)
+				sniRoutes = append(sniRoutes, backend)
 			}
 		}
-		servicename := fmt.Sprintf("%s_%s", service.Namespace, service.Name)
-		backend := c.haproxy.TCPBackends().Acquire(servicename, publicport)
-		for _, addr := range addrs {
-			backend.AddEndpoint(addr.IP, addr.Port)
+		if defaultBackend == nil && len(sniRoutes) == 0 {
+			continue
 		}
-		backend.ProxyProt.Decode = strings.ToLower(svc.inProxy) == "proxy"
-		backend.CheckInterval = checkInterval
-		switch strings.ToLower(svc.outProxy) {
-		case "proxy", "proxy-v2":
-			backend.ProxyProt.EncodeVersion = "v2"
-		case "proxy-v1":
-			backend.ProxyProt.EncodeVersion = "v1"
+		sort.Slice(sniRoutes, func(i, j int) bool {
+			return sniRoutes[i].SNI < sniRoutes[j].SNI
+		})
+		if defaultBackend == nil {
+			// only sni routes, connections without a matching sni are rejected
+			// and the PROXY protocol config of the bind is read from the first route
+			defaultBackend = &hatypes.TCPBackend{Name: "sni", Port: publicport}
+			defaultBackend.ProxyProt.Decode = sniRoutes[0].ProxyProt.Decode
+		}
+		if len(sniRoutes) > 0 {
+			passthrough := defaultBackend.SSL.Filename == ""
+			for _, route := range sniRoutes {
+				if route.SSL.Filename != "" {
+					passthrough = false
+				}
+			}
+			for _, route := range sniRoutes {
+				if passthrough && route.SSL.ServerSSL {
+					c.logger.Warn("ignoring ssl of TCP service '%s' on public port %d: tls passthrough of sni routes is already encrypted", route.SNI, publicport)
+					route.SSL.ServerSSL = false
+				}
+				if route.ProxyProt.Decode != defaultBackend.ProxyProt.Decode {
+					c.logger.Warn("ignoring PROXY protocol config of TCP service '%s' on public port %d: conflicts with the config of the shared bind", route.SNI, publicport)
+				}
+				// the bind, and so its client verification and proxy protocol config, is shared with the default service
+				route.SSL.CAFilename = ""
+				route.SSL.CRLFilename = ""
+				route.ProxyProt.Decode = false
+			}
+			defaultBackend.SNIPassthrough = passthrough
+			defaultBackend.SNIRoutes = sniRoutes
+		}
+		backend := c.haproxy.TCPBackends().Acquire(defaultBackend.Name, publicport)
+		*backend = *defaultBackend
+	}
+}
+
+// addAcmeStorage asks the acme signer to sign and renew the crt/key secret of
+// a TCP service. Acme storages are tracked by the TCP backends, so they can be
+// removed in the next sync.
+func (c *tcpSvcConverter) addAcmeStorage(publicport int, svc *tcpSvc) {
+	if svc.sni == "" {
+		c.logger.Warn("skipping cert signer of TCP service on public port %d: missing sni", publicport)
+		return
+	}
+	if svc.secretTLS == "" {
+		c.logger.Warn("skipping cert signer of TCP service '%s' on public port %d: missing secret name", svc.sni, publicport)
+		return
+	}
+	c.haproxy.AcmeData().Storages().Acquire(svc.secretTLS).AddDomains([]string{svc.sni})
+	tcpbackends := c.haproxy.TCPBackends()
+	tcpbackends.AcmeStorages = append(tcpbackends.AcmeStorages, svc.secretTLS)
+}
+
+// readService resolves the service, endpoints and secrets of a service spec
+// and returns them as a TCPBackend which is not added to the configuration.
+func (c *tcpSvcConverter) readService(publicport int, svc *tcpSvc) (*hatypes.TCPBackend, error) {
+	service, err := c.cache.GetService(svc.name)
+	if err != nil {
+		return nil, err
+	}
+	svcport := convutils.FindServicePort(service, svc.port)
+	if svcport == nil {
+		return nil, fmt.Errorf("port not found: %s:%s", svc.name, svc.port)
+	}
+	addrs, _, err := convutils.CreateEndpoints(c.cache, service, svcport)
+	if err != nil {
+		return nil, err
+	}
+	var crtfile convtypes.CrtFile
+	if svc.secretTLS != "" {
+		crtfile, err = c.cache.GetTLSSecretPath("", svc.secretTLS, convtypes.TrackingTarget{})
+		if err != nil {
+			return nil, err
+		}
+	}
+	var cafile, crlfile convtypes.File
+	if svc.secretCA != "" {
+		cafile, crlfile, err = c.cache.GetCASecretPath("", svc.secretCA, convtypes.TrackingTarget{})
+		if err != nil {
+			return nil, err
 		}
-		backend.SSL.Filename = crtfile.Filename
-		backend.SSL.CAFilename = cafile.Filename
-		backend.SSL.CRLFilename = crlfile.Filename
 	}
+	checkInterval := "2s"
+	if svc.checkInt != "" {
+		if svc.checkInt == "-" {
+			checkInterval = ""
+		} else if regexValidTime.MatchString(svc.checkInt) {
+			checkInterval = svc.checkInt
+		} else {
+			c.logger.Warn(
+				"using default check interval '%s' due to an invalid time config on TCP service %d: %s",
+				checkInterval, publicport, svc.checkInt)
+		}
+	}
+	backend := &hatypes.TCPBackend{
+		Name:          fmt.Sprintf("%s_%s", service.Namespace, service.Name),
+		Port:          publicport,
+		SNI:           svc.sni,
+		CheckInterval: checkInterval,
+	}
+	for _, addr := range addrs {
+		backend.AddEndpoint(addr.IP, addr.Port)
+	}
+	backend.ProxyProt.Decode = strings.ToLower(svc.inProxy) == "proxy"
+	switch strings.ToLower(svc.outProxy) {
+	case "proxy", "proxy-v2":
+		backend.ProxyProt.EncodeVersion = "v2"
+	case "proxy-v1":
+		backend.ProxyProt.EncodeVersion = "v1"
+	}
+	backend.SSL.Filename = crtfile.Filename
+	backend.SSL.CAFilename = cafile.Filename
+	backend.SSL.CRLFilename = crlfile.Filename
+	backend.SSL.ServerSSL = strings.ToLower(svc.outSSL) == "ssl"
+	return backend, nil
 }
 
 type tcpSvc struct {
-	name      string
-	port      string
-	inProxy   string
-	outProxy  string
-	secretTLS string
-	secretCA  string
-	checkInt  string
+	sni        string
+	name       string
+	port       string
+	inProxy    string
+	outProxy   string
+	secretTLS  string
+	secretCA   string
+	checkInt   string
+	outSSL     string
+	certSigner string
 }
 
 func (c *tcpSvcConverter) parseService(service string) *tcpSvc {
-	svc := make([]string, 7)
+	var sni string
+	if i := strings.Index(service, "="); i >= 0 {
+		sni, service = strings.ToLower(service[:i]), service[i+1:]
+	}
+	svc := make([]string, 9)
 	for i, v := range strings.Split(service, ":") {
-		if i < 7 {
+		if i < 9 {
 			svc[i] = v
 		}
 	}
 	return &tcpSvc{
-		name:      svc[0],
-		port:      svc[1],
-		inProxy:   svc[2],
-		outProxy:  svc[3],
-		secretTLS: svc[4],
-		checkInt:  svc[5],
-		secretCA:  svc[6],
+		sni:        sni,
+		name:       svc[0],
+		port:       svc[1],
+		inProxy:    svc[2],
+		outProxy:   svc[3],
+		secretTLS:  svc[4],
+		checkInt:   svc[5],
+		secretCA:   svc[6],
+		outSSL:     svc[7],
+		certSigner: svc[8],
 	}
 }
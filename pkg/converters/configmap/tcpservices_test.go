@@ -18,6 +18,7 @@ package configmap
 
 import (
 	"reflect"
+	"sort"
 	"strings"
 	"testing"
 
@@ -284,6 +285,115 @@ func TestTCPSvcSync(t *testing.T) {
 				},
 			},
 		},
+		// 19
+		{
+			svcmock: map[string]string{
+				"default/mqtt:8883": "172.17.0.101",
+				"default/pg:5432":   "172.17.0.102",
+			},
+			services: map[string]string{"8883": "Mqtt.local=default/mqtt:8883, pg.local=default/pg:5432::::-::ssl"},
+			expected: []*hatypes.TCPBackend{
+				{
+					Name:           "sni",
+					Port:           8883,
+					SNIPassthrough: true,
+					SNIRoutes: []*hatypes.TCPBackend{
+						{
+							Name: "default_mqtt",
+							Port: 8883,
+							Endpoints: []*hatypes.TCPEndpoint{
+								{Name: "srv001", IP: "172.17.0.101", Port: 8883},
+							},
+							CheckInterval: "2s",
+							SNI:           "mqtt.local",
+						},
+						{
+							Name: "default_pg",
+							Port: 8883,
+							Endpoints: []*hatypes.TCPEndpoint{
+								{Name: "srv001", IP: "172.17.0.102", Port: 5432},
+							},
+							SNI: "pg.local",
+						},
+					},
+				},
+			},
+			logging: `WARN ignoring ssl of TCP service 'pg.local' on public port 8883: tls passthrough of sni routes is already encrypted`,
+		},
+		// 20
+		{
+			svcmock: map[string]string{
+				"default/app:8443": "172.17.0.101",
+				"default/pg:5432":  "172.17.0.102",
+			},
+			secretCertMock: map[string]string{"default/pg-tls": "/var/haproxy/ssl/pg.pem"},
+			secretCAMock:   map[string]string{"default/pg-ca": "/var/haproxy/ssl/ca.pem"},
+			services:       map[string]string{"8443": "pg.local=default/pg:5432:PROXY::default/pg-tls:-:default/pg-ca:ssl,default/app:8443:::::,*.local=default/pg:5432,pg.local=default/app:8443,default/pg:5432"},
+			expected: []*hatypes.TCPBackend{
+				{
+					Name: "default_app",
+					Port: 8443,
+					Endpoints: []*hatypes.TCPEndpoint{
+						{Name: "srv001", IP: "172.17.0.101", Port: 8443},
+					},
+					CheckInterval: "2s",
+					SNIRoutes: []*hatypes.TCPBackend{
+						{
+							Name: "default_pg",
+							Port: 8443,
+							Endpoints: []*hatypes.TCPEndpoint{
+								{Name: "srv001", IP: "172.17.0.102", Port: 5432},
+							},
+							SNI: "pg.local",
+							SSL: hatypes.TCPSSL{
+								Filename:  "/var/haproxy/ssl/pg.pem",
+								ServerSSL: true,
+							},
+						},
+					},
+				},
+			},
+			logging: `
+WARN skipping invalid sni '*.local' of TCP service on public port 8443
+WARN skipping duplicated sni 'pg.local' of TCP service on public port 8443
+WARN skipping duplicated TCP service without sni on public port 8443
+WARN ignoring PROXY protocol config of TCP service 'pg.local' on public port 8443: conflicts with the config of the shared bind`,
+		},
+		// 21
+		{
+			svcmock: map[string]string{
+				"default/mqtt:8883": "172.17.0.101",
+				"default/pg:5432":   "172.17.0.102",
+			},
+			services: map[string]string{"8883": "pg.local=default/pg:5432::::-,mqtt.local=default/mqtt:8883:PROXY:::-"},
+			expected: []*hatypes.TCPBackend{
+				{
+					Name:           "sni",
+					Port:           8883,
+					ProxyProt:      hatypes.TCPProxyProt{Decode: true},
+					SNIPassthrough: true,
+					SNIRoutes: []*hatypes.TCPBackend{
+						{
+							Name: "default_mqtt",
+							Port: 8883,
+							Endpoints: []*hatypes.TCPEndpoint{
+								{Name: "srv001", IP: "172.17.0.101", Port: 8883},
+							},
+							SNI: "mqtt.local",
+						},
+						{
+							Name: "default_pg",
+							Port: 8883,
+							Endpoints: []*hatypes.TCPEndpoint{
+								{Name: "srv001", IP: "172.17.0.102", Port: 5432},
+							},
+							SNI: "pg.local",
+						},
+					},
+				},
+			},
+			logging: `WARN ignoring PROXY protocol config of TCP service 'pg.local' on public port 8883: conflicts with the config of the shared bind`,
+		},
 	}
 	for i, test := range testCases {
 		c := setup(t)
@@ -302,6 +412,11 @@ func TestTCPSvcSync(t *testing.T) {
 			for _, ep := range b.Endpoints {
 				ep.Target = ""
 			}
+			for _, route := range b.SNIRoutes {
+				for _, ep := range route.Endpoints {
+					ep.Target = ""
+				}
+			}
 		}
 		if !reflect.DeepEqual(backends, test.expected) {
 			t.Errorf("backend differs on %d -- expected: %+v -- actual: %+v", i, test.expected, backends)
@@ -311,6 +426,64 @@ func TestTCPSvcSync(t *testing.T) {
 	}
 }
 
+func TestTCPSvcAcme(t *testing.T) {
+	testCases := []struct {
+		services    map[string]string
+		expStorages []string
+		logging     string
+	}{
+		// 0
+		{
+			services:    map[string]string{"8443": "pg.local=default/pg:5432:::default/pg-tls::::ACME"},
+			expStorages: []string{"default/pg-tls,pg.local"},
+		},
+		// 1
+		{
+			services: map[string]string{"8443": "pg.local=default/pg:5432:::default/pg-tls"},
+		},
+		// 2
+		{
+			services:    map[string]string{"8443": "mqtt.local=default/mqtt:8883:::default/tls::::acme,pg.local=default/pg:5432:::default/tls::::acme"},
+			expStorages: []string{"default/tls,mqtt.local,pg.local"},
+		},
+		// 3
+		{
+			services: map[string]string{"15432": "default/pg:5432:::default/pg-tls::::ACME"},
+			logging:  `WARN skipping cert signer of TCP service on public port 15432: missing sni`,
+		},
+		// 4
+		{
+			services: map[string]string{"8443": "pg.local=default/pg:5432:::::::ACME"},
+			logging:  `WARN skipping cert signer of TCP service 'pg.local' on public port 8443: missing secret name`,
+		},
+	}
+	c := setup(t)
+	defer c.teardown()
+	svc, ep := conv_helper.CreateService("default/pg", "5432", "172.17.0.101")
+	c.cache.SvcList = append(c.cache.SvcList, svc)
+	c.cache.EpList["default/pg"] = ep
+	svc, ep = conv_helper.CreateService("default/mqtt", "8883", "172.17.0.102")
+	c.cache.SvcList = append(c.cache.SvcList, svc)
+	c.cache.EpList["default/mqtt"] = ep
+	c.cache.SecretTLSPath = map[string]string{
+		"default/pg-tls": "/var/haproxy/ssl/pg-tls.pem",
+		"default/tls":    "/var/haproxy/ssl/tls.pem",
+	}
+	// the same config is used in all the syncs, storages of the previous sync should be removed
+	for i, test := range testCases {
+		NewTCPServicesConverter(c.logger, c.haproxy, c.cache).Sync(test.services)
+		storages := c.haproxy.AcmeData().Storages().BuildAcmeStorages()
+		sort.Strings(storages)
+		if len(storages) == 0 {
+			storages = nil
+		}
+		if !reflect.DeepEqual(storages, test.expStorages) {
+			t.Errorf("acme storages differs on %d -- expected: %v -- actual: %v", i, test.expStorages, storages)
+		}
+		c.logger.CompareLogging(test.logging)
+	}
+}
+
 type testConfig struct {
 	t       *testing.T
 	haproxy haproxy.Config
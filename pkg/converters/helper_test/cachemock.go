@@ -19,6 +19,7 @@ package helper_test
 import (
 	"crypto/sha1"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
@@ -39,10 +40,16 @@ type CacheMock struct {
 	IngClassList  []*networking.IngressClass
 	SvcList       []*api.Service
 	EpList        map[string]*api.Endpoints
+	ConsulEpList  map[string][]convtypes.ExternalEndpoint
 	ConfigMapList map[string]*api.ConfigMap
 	TermPodList   map[string][]*api.Pod
 	PodList       map[string]*api.Pod
+	NodeList      []*api.Node
+	NodeName      string
 	SecretTLSPath map[string]string
+	SecretTLSPool []convtypes.CrtFile
+	SyncAt        time.Time
+	VaultCrtPath  map[string]string
 	SecretCAPath  map[string]string
 	SecretCRLPath map[string]string
 	SecretDHPath  map[string]string
@@ -117,6 +124,14 @@ func (c *CacheMock) GetEndpoints(service *api.Service) (*api.Endpoints, error) {
 	return nil, fmt.Errorf("could not find endpoints for service '%s'", serviceName)
 }
 
+// GetConsulEndpoints ...
+func (c *CacheMock) GetConsulEndpoints(address, consulService string, service *api.Service) ([]convtypes.ExternalEndpoint, error) {
+	if eps, found := c.ConsulEpList[consulService]; found {
+		return eps, nil
+	}
+	return nil, fmt.Errorf("consul service not found: '%s'", consulService)
+}
+
 // GetConfigMap ...
 func (c *CacheMock) GetConfigMap(configMapName string) (*api.ConfigMap, error) {
 	if configMap, found := c.ConfigMapList[configMapName]; found {
@@ -142,11 +157,34 @@ func (c *CacheMock) GetPod(podName string) (*api.Pod, error) {
 	return nil, fmt.Errorf("pod not found: '%s'", podName)
 }
 
+// GetNode ...
+func (c *CacheMock) GetNode(nodeName string) (*api.Node, error) {
+	for _, node := range c.NodeList {
+		if node.Name == nodeName {
+			return node, nil
+		}
+	}
+	return nil, fmt.Errorf("node not found: '%s'", nodeName)
+}
+
+// GetNodeList ...
+func (c *CacheMock) GetNodeList() ([]*api.Node, error) {
+	return c.NodeList, nil
+}
+
 // GetPodNamespace ...
 func (c *CacheMock) GetPodNamespace() string {
 	return "ingress-controller"
 }
 
+// GetControllerNodeName ...
+func (c *CacheMock) GetControllerNodeName() (string, error) {
+	if c.NodeName == "" {
+		return "", fmt.Errorf("controller pod not found")
+	}
+	return c.NodeName, nil
+}
+
 // GetTLSSecretPath ...
 func (c *CacheMock) GetTLSSecretPath(defaultNamespace, secretName string, track convtypes.TrackingTarget) (convtypes.CrtFile, error) {
 	fullname := c.buildSecretName(defaultNamespace, secretName)
@@ -163,8 +201,34 @@ func (c *CacheMock) GetTLSSecretPath(defaultNamespace, secretName string, track
 	return convtypes.CrtFile{}, fmt.Errorf("secret not found: '%s'", fullname)
 }
 
+// GetTLSSecretPool ...
+func (c *CacheMock) GetTLSSecretPool() ([]convtypes.CrtFile, error) {
+	return c.SecretTLSPool, nil
+}
+
+// GetVaultCertPath ...
+func (c *CacheMock) GetVaultCertPath(mount, role, hostname string, track convtypes.TrackingTarget) (convtypes.CrtFile, error) {
+	name := "vault:" + mount + "/" + role + ":" + hostname
+	if path, found := c.VaultCrtPath[name]; found {
+		c.tracker.Track(false, track, convtypes.SecretType, name)
+		return convtypes.CrtFile{
+			Filename:   path,
+			SHA1Hash:   fmt.Sprintf("%x", sha1.Sum([]byte(path))),
+			CommonName: hostname,
+			NotAfter:   time.Now().AddDate(0, 0, 30),
+		}, nil
+	}
+	c.tracker.Track(true, track, convtypes.SecretType, name)
+	return convtypes.CrtFile{}, fmt.Errorf("vault role not found: '%s/%s'", mount, role)
+}
+
 // GetCASecretPath ...
 func (c *CacheMock) GetCASecretPath(defaultNamespace, secretName string, track convtypes.TrackingTarget) (ca, crl convtypes.File, err error) {
+	rtype := convtypes.SecretType
+	if name := strings.TrimPrefix(secretName, "configmap://"); name != secretName {
+		rtype = convtypes.ConfigMapType
+		secretName = name
+	}
 	fullname := c.buildSecretName(defaultNamespace, secretName)
 	if path, found := c.SecretCAPath[fullname]; found {
 		ca = convtypes.File{
@@ -172,7 +236,7 @@ func (c *CacheMock) GetCASecretPath(defaultNamespace, secretName string, track c
 			SHA1Hash: fmt.Sprintf("%x", sha1.Sum([]byte(path))),
 		}
 	} else {
-		c.tracker.Track(true, track, convtypes.SecretType, fullname)
+		c.tracker.Track(true, track, rtype, fullname)
 		return ca, crl, fmt.Errorf("secret not found: '%s'", fullname)
 	}
 	if path, found := c.SecretCRLPath[fullname]; found {
@@ -181,7 +245,7 @@ func (c *CacheMock) GetCASecretPath(defaultNamespace, secretName string, track c
 			SHA1Hash: fmt.Sprintf("%x", sha1.Sum([]byte(path))),
 		}
 	}
-	c.tracker.Track(false, track, convtypes.SecretType, fullname)
+	c.tracker.Track(false, track, rtype, fullname)
 	return ca, crl, nil
 }
 
@@ -215,6 +279,19 @@ func (c *CacheMock) GetSecretContent(defaultNamespace, secretName, keyName strin
 // SwapChangedObjects ...
 func (c *CacheMock) SwapChangedObjects() *convtypes.ChangedObjects {
 	changed := c.Changed
+	if changed.GlobalChangedKeys == nil && changed.GlobalNew != nil {
+		for key, value := range changed.GlobalNew {
+			if curValue, found := changed.GlobalCur[key]; !found || curValue != value {
+				changed.GlobalChangedKeys = append(changed.GlobalChangedKeys, key)
+			}
+		}
+		for key := range changed.GlobalCur {
+			if _, found := changed.GlobalNew[key]; !found {
+				changed.GlobalChangedKeys = append(changed.GlobalChangedKeys, key)
+			}
+		}
+		sort.Strings(changed.GlobalChangedKeys)
+	}
 	c.Changed = &convtypes.ChangedObjects{
 		GlobalCur:       changed.GlobalNew,
 		TCPConfigMapCur: changed.TCPConfigMapNew,
@@ -273,3 +350,8 @@ func (c *CacheMock) SwapChangedObjects() *convtypes.ChangedObjects {
 func (c *CacheMock) NeedFullSync() bool {
 	return false
 }
+
+// ScheduleSync ...
+func (c *CacheMock) ScheduleSync(at time.Time) {
+	c.SyncAt = at
+}
@@ -22,14 +22,51 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
+
+	api "k8s.io/api/core/v1"
 
 	ingtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/types"
 	ingutils "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/utils"
 	convtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/types"
+	convutils "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/utils"
 	hatypes "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/types"
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/utils"
 )
 
+func (c *updater) buildBackendAccessLog(d *backData) {
+	if d.backend.ModeTCP {
+		return
+	}
+	for _, path := range d.backend.Paths {
+		config := d.mapper.GetConfig(path.Link)
+		if !config.Get(ingtypes.BackAccessLog).Bool() {
+			path.AccessLog = hatypes.AccessLog{Disabled: true}
+			continue
+		}
+		sample := config.Get(ingtypes.BackAccessLogSampleRatio)
+		if sample.Value == "" {
+			continue
+		}
+		ratio, err := strconv.ParseFloat(sample.Value, 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			c.logger.Warn("ignoring invalid access log sample ratio on %v: %s", sample.Source, sample.Value)
+			continue
+		}
+		threshold := int(ratio*10000 + 0.5)
+		if threshold == 0 {
+			path.AccessLog = hatypes.AccessLog{Disabled: true}
+		} else if threshold < 10000 {
+			path.AccessLog = hatypes.AccessLog{SampleThreshold: threshold}
+		}
+	}
+}
+
+var (
+	cookieDomainRegex = regexp.MustCompile(`^\.?[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)*$`)
+	cookieDynKeyRegex = regexp.MustCompile(`^[^"\\\s]+$`)
+)
+
 func (c *updater) buildBackendAffinity(d *backData) {
 	affinity := d.mapper.Get(ingtypes.BackAffinity)
 	if affinity.Source == nil {
@@ -68,13 +105,62 @@ func (c *updater) buildBackendAffinity(d *backData) {
 	d.backend.Cookie.Keywords = keywordsValue
 	d.backend.Cookie.Dynamic = d.mapper.Get(ingtypes.BackSessionCookieDynamic).Bool()
 	d.backend.Cookie.Preserve = d.mapper.Get(ingtypes.BackSessionCookiePreserve).Bool()
-	d.backend.Cookie.SameSite = d.mapper.Get(ingtypes.BackSessionCookieSameSite).Bool()
 	d.backend.Cookie.Shared = d.mapper.Get(ingtypes.BackSessionCookieShared).Bool()
 
+	keywordList := strings.Fields(keywordsValue)
+	hasKeyword := func(keyword string) bool {
+		for _, k := range keywordList {
+			if k == keyword {
+				return true
+			}
+		}
+		return false
+	}
+	sameSite := d.mapper.Get(ingtypes.BackSessionCookieSameSite)
+	switch strings.ToLower(sameSite.Value) {
+	case "", "false":
+	case "true", "none":
+		d.backend.Cookie.SameSite = "None"
+	case "lax":
+		d.backend.Cookie.SameSite = "Lax"
+	case "strict":
+		d.backend.Cookie.SameSite = "Strict"
+	default:
+		c.logger.Warn("ignoring invalid session-cookie-same-site on %v: %s", sameSite.Source, sameSite.Value)
+	}
+	// browsers refuse SameSite=None cookies without the Secure attribute
+	secure := d.mapper.Get(ingtypes.BackSessionCookieSecure).Bool() || d.backend.Cookie.SameSite == "None"
+	d.backend.Cookie.Secure = secure && !hasKeyword("secure")
+	d.backend.Cookie.HTTPOnly = d.mapper.Get(ingtypes.BackSessionCookieHTTPOnly).Bool() && !hasKeyword("httponly")
+
+	if domain := d.mapper.Get(ingtypes.BackSessionCookieDomain); domain.Value != "" {
+		if cookieDomainRegex.MatchString(domain.Value) {
+			d.backend.Cookie.Domain = domain.Value
+		} else {
+			c.logger.Warn("ignoring invalid session-cookie-domain on %v: %s", domain.Source, domain.Value)
+		}
+	}
+	if maxAge := d.mapper.Get(ingtypes.BackSessionCookieMaxAge); maxAge.Value != "" {
+		if duration, err := parseHAProxyTime(maxAge.Value); err == nil && duration >= time.Second {
+			d.backend.Cookie.MaxAge = int(duration / time.Second)
+		} else {
+			c.logger.Warn("ignoring invalid session-cookie-max-age on %v: %s", maxAge.Source, maxAge.Value)
+		}
+	}
+	if dynKey := d.mapper.Get(ingtypes.BackSessionCookieDynKey); dynKey.Value != "" {
+		if cookieDynKeyRegex.MatchString(dynKey.Value) {
+			d.backend.Cookie.DynamicKey = dynKey.Value
+		} else {
+			c.logger.Warn("ignoring invalid session-cookie-dynamic-key on %v", dynKey.Source)
+		}
+	}
+
 	cookieStrategy := d.mapper.Get(ingtypes.BackSessionCookieValue)
 	switch cookieStrategy.Value {
 	case "pod-uid":
 		d.backend.EpCookieStrategy = hatypes.EpCookiePodUID
+	case "server-name-hash":
+		d.backend.EpCookieStrategy = hatypes.EpCookieNameHash
 	case "server-name":
 		d.backend.EpCookieStrategy = hatypes.EpCookieName
 	default:
@@ -104,6 +190,10 @@ func (c *updater) buildBackendAuthExternal(d *backData) {
 			c.logger.Warn("external authentication on %v needs Lua json module, install lua-json4 and enable 'external-has-lua' global config", url.Source)
 			return
 		}
+		if !c.options.Capabilities.HasLua() {
+			c.logger.Warn("external authentication on %v needs Lua, but haproxy was built without Lua support", url.Source)
+			return
+		}
 
 		urlProto, urlHost, urlPort, urlPath, err := ingutils.ParseURL(url.Value)
 		if err != nil {
@@ -301,6 +391,92 @@ func extractUserlist(source, secret, users string) ([]hatypes.User, []error) {
 	return userlist, err
 }
 
+var (
+	balanceHdrRegex       = regexp.MustCompile(`^hdr\([A-Za-z0-9_-]+\)$`)
+	balanceRandomRegex    = regexp.MustCompile(`^random(\([1-9][0-9]*\))?$`)
+	balanceRDPCookieRegex = regexp.MustCompile(`^rdp-cookie(\([A-Za-z0-9_-]+\))?$`)
+	balanceParamRegex     = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+)
+
+// buildBackendAuthPassthrough configures backends whose servers authenticate
+// the connection instead of the request, like NTLM and some SPNEGO
+// implementations. The client connection is bound to a single server
+// connection, which cannot be reused by other clients.
+func (c *updater) buildBackendAuthPassthrough(d *backData) {
+	config := d.mapper.Get(ingtypes.BackAuthPassthrough)
+	if !config.Bool() {
+		return
+	}
+	if d.backend.ModeTCP {
+		c.logger.Warn("ignoring auth-passthrough on %v: backend is already in tcp mode", config.Source)
+		return
+	}
+	d.backend.AuthPassthrough = true
+}
+
+func (c *updater) buildBackendBalance(d *backData) {
+	balance := d.mapper.Get(ingtypes.BackBalanceAlgorithm)
+	fields := strings.Fields(balance.Value)
+	if err := validateBalance(fields); err != nil {
+		if balance.Source != nil {
+			c.logger.Warn("ignoring invalid balance algorithm on %v, using 'roundrobin': %v", balance.Source, err)
+		} else {
+			c.logger.Warn("ignoring invalid balance algorithm, using 'roundrobin': %v", err)
+		}
+		d.backend.BalanceAlgorithm = "roundrobin"
+		return
+	}
+	d.backend.BalanceAlgorithm = strings.Join(fields, " ")
+}
+
+// validateBalance checks the name and the arguments of a balance algorithm
+// split in fields, only algorithms that apply to HTTP backends are
+// accepted.
+func validateBalance(fields []string) error {
+	if len(fields) == 0 {
+		return fmt.Errorf("missing algorithm name")
+	}
+	algorithm, args := fields[0], fields[1:]
+	switch {
+	case algorithm == "roundrobin", algorithm == "static-rr", algorithm == "leastconn",
+		algorithm == "first", algorithm == "source",
+		balanceRandomRegex.MatchString(algorithm), balanceRDPCookieRegex.MatchString(algorithm):
+		if len(args) > 0 {
+			return fmt.Errorf("algorithm '%s' does not accept arguments: %s", algorithm, strings.Join(args, " "))
+		}
+	case algorithm == "uri":
+		for i := 0; i < len(args); i++ {
+			switch args[i] {
+			case "whole", "path-only":
+			case "len", "depth":
+				if i+1 == len(args) {
+					return fmt.Errorf("missing value of '%s' option", args[i])
+				}
+				if value, err := strconv.Atoi(args[i+1]); err != nil || value <= 0 {
+					return fmt.Errorf("value of '%s' option should be a positive number: %s", args[i], args[i+1])
+				}
+				i++
+			default:
+				return fmt.Errorf("unsupported option of 'uri' algorithm: %s", args[i])
+			}
+		}
+	case algorithm == "url_param":
+		if len(args) == 0 || !balanceParamRegex.MatchString(args[0]) {
+			return fmt.Errorf("missing or invalid parameter name of 'url_param' algorithm")
+		}
+		if len(args) > 2 || (len(args) == 2 && args[1] != "check_post") {
+			return fmt.Errorf("unsupported option of 'url_param' algorithm: %s", strings.Join(args[1:], " "))
+		}
+	case balanceHdrRegex.MatchString(algorithm):
+		if len(args) > 1 || (len(args) == 1 && args[0] != "use_domain_only") {
+			return fmt.Errorf("unsupported option of 'hdr' algorithm: %s", strings.Join(args, " "))
+		}
+	default:
+		return fmt.Errorf("unsupported algorithm: %s", algorithm)
+	}
+	return nil
+}
+
 func (c *updater) buildBackendBlueGreenBalance(d *backData) {
 	balance := d.mapper.Get(ingtypes.BackBlueGreenBalance)
 	if balance.Source == nil || balance.Value == "" {
@@ -522,6 +698,132 @@ func (c *updater) buildBackendBodySize(d *backData) {
 	}
 }
 
+// buildBackendConfigSnippet adds the config-backend snippet. Snippets declared
+// in Ingress and Service resources are only used if their namespace is allowed,
+// and if they don't use any of the forbidden keywords. Snippets from the global
+// config don't have a source and are always used.
+func (c *updater) buildBackendConfigSnippet(d *backData) {
+	config := d.mapper.Get(ingtypes.BackConfigBackend)
+	if config.Value == "" {
+		return
+	}
+	if config.Source != nil {
+		allowed := false
+		for _, ns := range utils.Split(d.mapper.Get(ingtypes.GlobalConfigBackendAllowedNS).Value, ",") {
+			if ns == "*" || ns == config.Source.Namespace {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			c.logger.Warn("skipping config-backend snippet on %v: namespace '%s' is not allowed to declare configuration snippets",
+				config.Source, config.Source.Namespace)
+			return
+		}
+		if keyword := findForbiddenKeyword(config.Value, utils.Split(d.mapper.Get(ingtypes.GlobalConfigBackendForbidden).Value, ",")); keyword != "" {
+			c.logger.Warn("skipping config-backend snippet on %v: forbidden keyword '%s'", config.Source, keyword)
+			return
+		}
+	}
+	d.backend.CustomConfig = utils.LineToSlice(config.Value)
+}
+
+// buildBackendConfigSnippets adds the backend injection points of the
+// config-snippets ConfigMaps, after the config-backend snippet. Injection
+// points only apply to the backends of the same namespace of the ConfigMap.
+func (c *updater) buildBackendConfigSnippets(d *backData) {
+	for _, snippet := range c.readConfigSnippets(d.mapper).backends {
+		if snippet.namespace == d.backend.Namespace && (snippet.service == "" || snippet.service == d.backend.Name) {
+			d.backend.CustomConfig = append(d.backend.CustomConfig, snippet.config...)
+		}
+	}
+}
+
+// findForbiddenKeyword returns the first keyword found in the snippet,
+// or an empty string if none was found. A keyword matches a whole word,
+// or the prefix of a word followed by a dot or a parenthesis, eg `lua`
+// matches `lua.auth` and `use-service lua.svc`.
+func findForbiddenKeyword(snippet string, keywords []string) string {
+	for _, word := range strings.Fields(snippet) {
+		for _, keyword := range keywords {
+			if keyword == "" {
+				continue
+			}
+			if word == keyword || strings.HasPrefix(word, keyword+".") || strings.HasPrefix(word, keyword+"(") {
+				return keyword
+			}
+		}
+	}
+	return ""
+}
+
+func (c *updater) buildBackendCache(d *backData) {
+	if !d.mapper.Get(ingtypes.BackCacheEnable).Bool() {
+		return
+	}
+	if d.backend.ModeTCP {
+		enable := d.mapper.Get(ingtypes.BackCacheEnable)
+		c.logger.Warn("ignoring cache on TCP backend %v", enable.Source)
+		return
+	}
+	// HAProxy's total-max-size is in megabytes, rounding up
+	totalSize := d.mapper.Get(ingtypes.BackCacheTotalSize)
+	total, err := utils.SizeSuffixToInt64(totalSize.Value)
+	totalMB := (total + 1<<20 - 1) >> 20
+	if err != nil || total <= 0 || totalMB > 4095 {
+		c.logger.Warn("ignoring cache on %v due to invalid total size: %s", totalSize.Source, totalSize.Value)
+		return
+	}
+	cache := hatypes.BackendCache{
+		Enabled:      true,
+		TotalMaxSize: totalMB,
+	}
+	if maxObjSize := d.mapper.Get(ingtypes.BackCacheMaxObjectSize); maxObjSize.Value != "" {
+		value, err := utils.SizeSuffixToInt64(maxObjSize.Value)
+		if err != nil || value <= 0 {
+			c.logger.Warn("ignoring invalid cache max object size on %v: %s", maxObjSize.Source, maxObjSize.Value)
+		} else if value > totalMB<<20/2 {
+			c.logger.Warn("ignoring cache max object size on %v, it should not be greater than half of the total size: %s", maxObjSize.Source, maxObjSize.Value)
+		} else {
+			cache.MaxObjectSize = value
+		}
+	}
+	if maxAge := d.mapper.Get(ingtypes.BackCacheMaxAge); maxAge.Value != "" {
+		value, err := strconv.Atoi(maxAge.Value)
+		if err != nil {
+			var duration time.Duration
+			duration, err = time.ParseDuration(maxAge.Value)
+			value = int(duration.Seconds())
+		}
+		if err != nil || value <= 0 {
+			c.logger.Warn("ignoring invalid cache max age on %v: %s", maxAge.Source, maxAge.Value)
+		} else {
+			cache.MaxAge = value
+		}
+	}
+	d.backend.Cache = cache
+}
+
+func (c *updater) buildBackendConnection(d *backData) {
+	d.backend.Server.MaxConn = d.mapper.Get(ingtypes.BackMaxconnServer).Int()
+	d.backend.Server.MaxQueue = d.mapper.Get(ingtypes.BackMaxQueueServer).Int()
+	minconn := d.mapper.Get(ingtypes.BackMinconnServer)
+	if minconn.Int() <= 0 {
+		return
+	}
+	// minconn is the lower limit of a dynamic maxconn, so it needs a valid maxconn as the upper one
+	maxconn := d.backend.Server.MaxConn
+	if maxconn <= 0 {
+		c.logger.Warn("ignoring minconn-server on %v: maxconn-server should also be declared", minconn.Source)
+		return
+	}
+	if minconn.Int() > maxconn {
+		c.logger.Warn("ignoring minconn-server on %v: value %d is greater than maxconn-server %d", minconn.Source, minconn.Int(), maxconn)
+		return
+	}
+	d.backend.Server.MinConn = minconn.Int()
+}
+
 func (c *updater) buildBackendCors(d *backData) {
 	for _, path := range d.backend.Paths {
 		config := d.mapper.GetConfig(path.Link)
@@ -557,6 +859,17 @@ func (c *updater) buildBackendDNS(d *backData) {
 		c.logger.Warn("skipping undeclared DNS resolver: %s", resolverName)
 		return
 	}
+	svc, err := c.cache.GetService(d.backend.Namespace + "/" + d.backend.Name)
+	if err == nil && svc.Spec.Type == api.ServiceTypeExternalName {
+		// the external name is resolved instead of the service name, the
+		// service name is a CNAME and has no SRV record of its named ports
+		port := convutils.FindServicePort(svc, d.backend.Port)
+		if port == nil || port.Port <= 0 {
+			c.logger.Warn("skipping DNS resolver on backend '%s': port not found on ExternalName service: %s", d.backend.ID, d.backend.Port)
+			return
+		}
+		d.backend.ResolverTarget = fmt.Sprintf("%s:%d", svc.Spec.ExternalName, port.Port)
+	}
 	d.backend.Resolver = resolverName
 }
 
@@ -568,11 +881,84 @@ func (c *updater) buildBackendDynamic(d *backData) {
 	}
 }
 
+// buildBackendFallback adds the ready endpoints of the fallback service as
+// backup servers. The fallback service is tracked by the hostnames of the
+// backend, so its changes rebuild the backend.
+func (c *updater) buildBackendFallback(d *backData) {
+	fallback := d.mapper.Get(ingtypes.BackFallbackService)
+	if fallback.Value == "" {
+		return
+	}
+	svcName := fallback.Value
+	var svcPort string
+	if pos := strings.Index(svcName, ":"); pos >= 0 {
+		svcPort = svcName[pos+1:]
+		svcName = svcName[:pos]
+	}
+	if !strings.Contains(svcName, "/") {
+		if fallback.Source == nil {
+			c.logger.Warn("ignoring fallback service without namespace on backend '%s': %s", d.backend.ID, fallback.Value)
+			return
+		}
+		svcName = fallback.Source.Namespace + "/" + svcName
+	}
+	if svcName == d.backend.Namespace+"/"+d.backend.Name {
+		c.logger.Warn("ignoring fallback service on %v: backend cannot fallback to itself", fallback.Source)
+		return
+	}
+	svc, err := c.cache.GetService(svcName)
+	for _, path := range d.backend.Paths {
+		c.tracker.Track(err != nil, convtypes.TrackingTarget{Hostname: path.Hostname()}, convtypes.ServiceType, svcName)
+	}
+	if err != nil {
+		c.logger.Warn("ignoring fallback service on %v: %v", fallback.Source, err)
+		return
+	}
+	var port *api.ServicePort
+	if svcPort == "" && len(svc.Spec.Ports) > 0 {
+		port = &svc.Spec.Ports[0]
+	} else {
+		port = convutils.FindServicePort(svc, svcPort)
+	}
+	if port == nil {
+		c.logger.Warn("ignoring fallback service on %v: port not found: '%s'", fallback.Source, svcPort)
+		return
+	}
+	ready, _, err := convutils.CreateEndpoints(c.cache, svc, port)
+	if err != nil {
+		c.logger.Warn("ignoring fallback service on %v: %v", fallback.Source, err)
+		return
+	}
+	for _, ep := range ready {
+		d.backend.AddBackupEndpoint(ep.IP, ep.Port)
+	}
+}
+
 func (c *updater) buildBackendAgentCheck(d *backData) {
+	port := d.mapper.Get(ingtypes.BackAgentCheckPort)
+	if port.Value == "" {
+		return
+	}
+	portNumber, err := strconv.Atoi(port.Value)
+	if err != nil || portNumber <= 0 || portNumber > 65535 {
+		c.logger.Warn("ignoring invalid agent check port on %v: %s", port.Source, port.Value)
+		return
+	}
 	d.backend.AgentCheck.Addr = d.mapper.Get(ingtypes.BackAgentCheckAddr).Value
 	d.backend.AgentCheck.Interval = c.validateTime(d.mapper.Get(ingtypes.BackAgentCheckInterval))
-	d.backend.AgentCheck.Port = d.mapper.Get(ingtypes.BackAgentCheckPort).Int()
-	d.backend.AgentCheck.Send = d.mapper.Get(ingtypes.BackAgentCheckSend).Value
+	d.backend.AgentCheck.Port = portNumber
+	d.backend.AgentCheck.Send = quoteString(d.mapper.Get(ingtypes.BackAgentCheckSend).Value)
+}
+
+// quoteString wraps a string in double quotes if it has
+// chars that would otherwise be misinterpreted by the HAProxy's config
+// parser. Backslash escape sequences like `\n` are preserved, so HAProxy
+// can convert them.
+func quoteString(send string) string {
+	if send == "" || !strings.ContainsAny(send, " \t#\"'") {
+		return send
+	}
+	return `"` + strings.ReplaceAll(send, `"`, `\"`) + `"`
 }
 
 func (c *updater) buildBackendHealthCheck(d *backData) {
@@ -586,6 +972,80 @@ func (c *updater) buildBackendHealthCheck(d *backData) {
 	d.backend.HealthCheck.Port = d.mapper.Get(ingtypes.BackHealthCheckPort).Int()
 	d.backend.HealthCheck.RiseCount = d.mapper.Get(ingtypes.BackHealthCheckRiseCount).Int()
 	d.backend.HealthCheck.URI = d.mapper.Get(ingtypes.BackHealthCheckURI).Value
+	c.buildBackendHealthCheckHTTP(d)
+	c.buildBackendHealthCheckObserve(d)
+}
+
+var (
+	healthCheckMethods = map[string]struct{}{
+		"GET": {}, "HEAD": {}, "OPTIONS": {}, "POST": {}, "PUT": {},
+	}
+	healthCheckStatusRegex = regexp.MustCompile(`^[1-5][0-9]{2}(-[1-5][0-9]{2})?$`)
+)
+
+func (c *updater) buildBackendHealthCheckHTTP(d *backData) {
+	if d.backend.HealthCheck.URI == "" {
+		return
+	}
+	method := d.mapper.Get(ingtypes.BackHealthCheckMethod)
+	if method.Value != "" {
+		methodUpper := strings.ToUpper(method.Value)
+		if _, found := healthCheckMethods[methodUpper]; found {
+			d.backend.HealthCheck.Method = methodUpper
+		} else {
+			c.logger.Warn("ignoring invalid health check method on %v: %s", method.Source, method.Value)
+		}
+	}
+	expStatus := d.mapper.Get(ingtypes.BackHealthCheckExpStatus)
+	expString := d.mapper.Get(ingtypes.BackHealthCheckExpString)
+	if expStatus.Value != "" {
+		var codes []string
+		for _, code := range utils.Split(expStatus.Value, ",") {
+			if !healthCheckStatusRegex.MatchString(code) {
+				c.logger.Warn("ignoring invalid health check expected status on %v: %s", expStatus.Source, code)
+				continue
+			}
+			codes = append(codes, code)
+		}
+		d.backend.HealthCheck.ExpectStatus = strings.Join(codes, ",")
+		if expString.Value != "" {
+			c.logger.Warn("ignoring health check expected string on %v due to expected status configuration", expString.Source)
+		}
+	} else if expString.Value != "" {
+		d.backend.HealthCheck.ExpectString = quoteString(expString.Value)
+	}
+}
+
+func (c *updater) buildBackendHealthCheckObserve(d *backData) {
+	observe := d.mapper.Get(ingtypes.BackHealthCheckObserve)
+	switch observe.Value {
+	case "":
+		return
+	case "layer4", "layer7":
+	default:
+		c.logger.Warn("ignoring invalid health check observe mode on %v: %s", observe.Source, observe.Value)
+		return
+	}
+	if observe.Value == "layer7" && d.backend.ModeTCP {
+		c.logger.Warn("ignoring layer7 health check observe mode on TCP backend %v", observe.Source)
+		return
+	}
+	errorLimit := d.mapper.Get(ingtypes.BackHealthCheckErrorLimit)
+	if errorLimit.Value != "" {
+		if value, err := strconv.Atoi(errorLimit.Value); err != nil || value <= 0 {
+			c.logger.Warn("ignoring invalid health check error limit on %v: %s", errorLimit.Source, errorLimit.Value)
+		} else {
+			d.backend.HealthCheck.ErrorLimit = value
+		}
+	}
+	onError := d.mapper.Get(ingtypes.BackHealthCheckOnError)
+	switch onError.Value {
+	case "", "fastinter", "fail-check", "sudden-death", "mark-down":
+		d.backend.HealthCheck.OnError = onError.Value
+	default:
+		c.logger.Warn("ignoring invalid health check on-error action on %v: %s", onError.Source, onError.Value)
+	}
+	d.backend.HealthCheck.Observe = observe.Value
 }
 
 func (c *updater) buildBackendHeaders(d *backData) {
@@ -625,10 +1085,60 @@ func (c *updater) buildBackendHSTS(d *backData) {
 	}
 }
 
+func (c *updater) buildBackendSecurityHeaders(d *backData) {
+	for _, path := range d.backend.Paths {
+		config := d.mapper.GetConfig(path.Link)
+		path.SecurityHeaders = hatypes.SecurityHeaders{
+			// the header value is a log-format string
+			ContentSecurityPolicy: strings.ReplaceAll(config.Get(ingtypes.BackContentSecurityPolicy).Value, "%", "%%"),
+			FrameOptions:          config.Get(ingtypes.BackXFrameOptions).Value,
+			ReferrerPolicy:        config.Get(ingtypes.BackReferrerPolicy).Value,
+		}
+	}
+}
+
+var (
+	limitKeyRegex       = regexp.MustCompile(`^(src|hdr\(([A-Za-z0-9-]+)\))$`)
+	limitTableSizeRegex = regexp.MustCompile(`^[1-9][0-9]*[kmg]?$`)
+)
+
 func (c *updater) buildBackendLimit(d *backData) {
 	d.backend.Limit.RPS = d.mapper.Get(ingtypes.BackLimitRPS).Int()
 	d.backend.Limit.Connections = d.mapper.Get(ingtypes.BackLimitConnections).Int()
 	d.backend.Limit.Whitelist = c.splitCIDR(d.mapper.Get(ingtypes.BackLimitWhitelist))
+	if d.backend.Limit.RPS == 0 && d.backend.Limit.Connections == 0 {
+		return
+	}
+	key := d.mapper.Get(ingtypes.BackLimitKey)
+	if match := limitKeyRegex.FindStringSubmatch(key.Value); match == nil {
+		c.logger.Warn("ignoring invalid limit key on %v, using 'src': %s", key.Source, key.Value)
+		d.backend.Limit.Key = "src"
+	} else if match[2] != "" {
+		d.backend.Limit.Key = "req.hdr(" + match[2] + ")"
+	} else {
+		d.backend.Limit.Key = "src"
+	}
+	size := d.mapper.Get(ingtypes.BackLimitTableSize)
+	if limitTableSizeRegex.MatchString(size.Value) {
+		d.backend.Limit.TableSize = size.Value
+	} else {
+		c.logger.Warn("ignoring invalid limit table size on %v, using '200k': %s", size.Source, size.Value)
+		d.backend.Limit.TableSize = "200k"
+	}
+	d.backend.Limit.TableExpire = c.validateTime(d.mapper.Get(ingtypes.BackLimitTableExpire))
+	if d.backend.Limit.TableExpire == "" {
+		d.backend.Limit.TableExpire = "5m"
+	}
+	if d.backend.Limit.Connections > 0 {
+		action := d.mapper.Get(ingtypes.BackLimitConnectionsAction)
+		switch action.Value {
+		case "deny":
+		case "queue":
+			d.backend.Limit.ConnectionsQueue = true
+		default:
+			c.logger.Warn("ignoring invalid limit connections action on %v, using 'deny': %s", action.Source, action.Value)
+		}
+	}
 }
 
 func (c *updater) buildBackendOAuth(d *backData) {
@@ -647,6 +1157,10 @@ func (c *updater) buildBackendOAuth(d *backData) {
 			c.logger.Warn("oauth2_proxy on %v needs Lua json module, install lua-json4 and enable 'external-has-lua' global config", oauth.Source)
 			return
 		}
+		if !c.options.Capabilities.HasLua() {
+			c.logger.Warn("oauth2_proxy on %v needs Lua, but haproxy was built without Lua support", oauth.Source)
+			return
+		}
 		if authURL := d.mapper.Get(ingtypes.BackAuthURL); authURL.Value != "" {
 			c.logger.Warn("ignoring oauth configuration on %v: auth-url was configured and has precedence", authURL.Source)
 			continue
@@ -763,6 +1277,15 @@ func (c *updater) buildBackendProtocol(d *backData) {
 			c.logger.Warn("skipping invalid domain (verify-hostname) on %v: %s", host.Source, host.Value)
 		}
 	}
+	verify := d.mapper.Get(ingtypes.BackSecureVerify)
+	switch verify.Value {
+	case "", "required":
+	case "none":
+		// the CA is ignored, eg a backend that cannot be verified by a default CA
+		return
+	default:
+		c.logger.Warn("ignoring invalid secure-verify option on %v, using 'required': %s", verify.Source, verify.Value)
+	}
 	if ca := d.mapper.Get(ingtypes.BackSecureVerifyCASecret); ca.Value != "" {
 		if caFile, crlFile, err := c.cache.GetCASecretPath(
 			ca.Source.Namespace,
@@ -785,19 +1308,39 @@ func (c *updater) buildBackendProxyProtocol(d *backData) {
 		return
 	}
 	switch cfg.Value {
+	case "", "no":
 	case "v1":
 		d.backend.Server.SendProxy = "send-proxy"
 	case "v2":
 		d.backend.Server.SendProxy = "send-proxy-v2"
-	case "v2-ssl":
-		d.backend.Server.SendProxy = "send-proxy-v2-ssl"
-	case "v2-ssl-cn":
-		d.backend.Server.SendProxy = "send-proxy-v2-ssl-cn"
+	case "v2-ssl", "v2-ssl-cn":
+		if d.backend.ModeTCP {
+			// ssl-passthrough backends don't offload the client's TLS connection,
+			// so there are no SSL related information to send.
+			c.logger.Warn("using proxy protocol v2 without ssl info on %v due to ssl-passthrough", cfg.Source)
+			d.backend.Server.SendProxy = "send-proxy-v2"
+		} else {
+			d.backend.Server.SendProxy = "send-proxy-" + cfg.Value
+		}
 	default:
 		c.logger.Warn("ignoring invalid proxy protocol version on %v: %s", cfg.Source, cfg.Value)
 	}
 }
 
+func (c *updater) buildBackendRequestBuffer(d *backData) {
+	d.backend.BufferRequest = d.mapper.Get(ingtypes.BackProxyRequestBuffering).Bool()
+	headerSize := d.mapper.Get(ingtypes.BackProxyHeaderSize)
+	if headerSize.Value == "" || headerSize.Value == "unlimited" {
+		return
+	}
+	value, err := utils.SizeSuffixToInt64(headerSize.Value)
+	if err != nil || value <= 0 {
+		c.logger.Warn("ignoring invalid header size on %v: %s", headerSize.Source, headerSize.Value)
+		return
+	}
+	d.backend.MaxHeaderSize = value
+}
+
 func (c *updater) buildBackendRewriteURL(d *backData) {
 	for _, path := range d.backend.Paths {
 		config := d.mapper.GetConfig(path.Link)
@@ -812,7 +1355,74 @@ func (c *updater) buildBackendRewriteURL(d *backData) {
 			continue
 		}
 		path.RewriteURL = rewrite.Value
+		path.RewriteResponse = c.buildRewriteResponse(path, config.Get(ingtypes.BackRewriteTargetResponse))
+	}
+}
+
+// buildRewriteResponse returns the rules that revert the rewrite-target
+// of a path in the Location and Set-Cookie response headers, so redirects
+// and cookies of the backend point to the path requested by the client.
+// Absolute URLs are only reverted if they point to the hostname of the path.
+func (c *updater) buildRewriteResponse(path *hatypes.BackendPath, headers *ConfigValue) []*hatypes.RewriteHeader {
+	if headers == nil || headers.Value == "" {
+		return nil
+	}
+	var location, cookie bool
+	for _, header := range utils.Split(headers.Value, ",") {
+		switch header {
+		case "location":
+			location = true
+		case "set-cookie":
+			cookie = true
+		default:
+			c.logger.Warn("ignoring invalid rewrite target response header on %v: %s", headers.Source, header)
+		}
+	}
+	from := regexp.QuoteMeta(strings.TrimSuffix(path.RewriteURL, "/"))
+	to := strings.TrimSuffix(path.Path(), "/")
+	if from == regexp.QuoteMeta(to) {
+		return nil
+	}
+	var rules []*hatypes.RewriteHeader
+	if location {
+		// group 1 is the optional scheme and authority of an absolute URL
+		origin := "()"
+		if hostname := path.Hostname(); hostname != hatypes.DefaultHost {
+			hostRegex := regexp.QuoteMeta(hostname)
+			if strings.HasPrefix(hostRegex, `\*`) {
+				hostRegex = "[^./]+" + hostRegex[2:]
+			}
+			origin = "(https?://" + hostRegex + "(:[0-9]+)?)?"
+		}
+		if to == "" {
+			rules = append(rules, &hatypes.RewriteHeader{
+				Name:    "Location",
+				Regex:   "^" + origin + from + "$",
+				Replace: `\1/`,
+			})
+		}
+		rules = append(rules, &hatypes.RewriteHeader{
+			Name:    "Location",
+			Regex:   "^" + origin + from + "(/.*)?$",
+			Replace: `\1` + to + `\` + strconv.Itoa(strings.Count(origin, "(")+1),
+		})
 	}
+	if cookie {
+		attr := `(.*;\s*[Pp]ath=)`
+		if to == "" {
+			rules = append(rules, &hatypes.RewriteHeader{
+				Name:    "Set-Cookie",
+				Regex:   "^" + attr + from + "(;.*)?$",
+				Replace: `\1/\2`,
+			})
+		}
+		rules = append(rules, &hatypes.RewriteHeader{
+			Name:    "Set-Cookie",
+			Regex:   "^" + attr + from + "(/[^;]*)?(;.*)?$",
+			Replace: `\1` + to + `\2\3`,
+		})
+	}
+	return rules
 }
 
 var epNamingRegex = regexp.MustCompile(`^(seq(uence)?|pod|ip)$`)
@@ -825,6 +1435,104 @@ func (c *updater) buildBackendServerNaming(d *backData) {
 	}
 }
 
+func (c *updater) buildBackendIPFamily(d *backData) {
+	// Only warning here, the IP family is used by the converter when the endpoints are added
+	family := d.mapper.Get(ingtypes.BackBackendIPFamily)
+	if family.Value != "" && family.Value != "ipv4" && family.Value != "ipv6" {
+		c.logger.Warn("ignoring invalid IP family '%s' on %s", family.Value, family.Source)
+	}
+}
+
+func (c *updater) buildBackendTrafficPolicy(d *backData) {
+	// Only warning here, the traffic policy is used by the converter when the endpoints are added
+	policy := d.mapper.Get(ingtypes.BackTrafficPolicy)
+	if policy.Value != "cluster" && policy.Value != "local" && policy.Value != "prefer-local" {
+		c.logger.Warn("ignoring invalid traffic policy '%s' on %s, using 'cluster' instead", policy.Value, policy.Source)
+	}
+}
+
+// buildBackendSource configures the source address and interface of the
+// connections to the backend servers. Both need to be declared in the
+// backend-source-allowlist global config, so the owner of an ingress
+// resource cannot choose an egress the cluster admin didn't allow.
+func (c *updater) buildBackendSource(d *backData) {
+	address := d.mapper.Get(ingtypes.BackBackendSourceAddress)
+	iface := d.mapper.Get(ingtypes.BackBackendSourceInterface)
+	if address.Value == "" && iface.Value == "" {
+		return
+	}
+	allowlist := c.haproxy.Global().SourceAllowlist
+	var source hatypes.BackendSource
+	if address.Value != "" {
+		if ip := net.ParseIP(address.Value); ip == nil {
+			c.logger.Warn("ignoring invalid backend source address on %v: %s", address.Source, address.Value)
+		} else if !sourceAddressAllowed(ip, allowlist.CIDR) {
+			c.logger.Warn("ignoring backend source address on %v: address not allowed: %s", address.Source, address.Value)
+		} else {
+			source.Address = address.Value
+		}
+	}
+	if iface.Value != "" {
+		allowed := false
+		for _, allowedIface := range allowlist.Interfaces {
+			if iface.Value == allowedIface {
+				allowed = true
+				break
+			}
+		}
+		if allowed {
+			source.Interface = iface.Value
+		} else {
+			c.logger.Warn("ignoring backend source interface on %v: interface not allowed: %s", iface.Source, iface.Value)
+		}
+	}
+	if source.Address == "" && source.Interface != "" {
+		// haproxy needs an address, let the kernel choose one from the interface
+		if d.mapper.Get(ingtypes.BackBackendIPFamily).Value == "ipv6" {
+			source.Address = "::"
+		} else {
+			source.Address = "0.0.0.0"
+		}
+	}
+	d.backend.Source = source
+}
+
+func sourceAddressAllowed(ip net.IP, allowlist []string) bool {
+	for _, cidr := range allowlist {
+		if allowed := net.ParseIP(cidr); allowed != nil {
+			if allowed.Equal(ip) {
+				return true
+			}
+		} else if _, ipnet, err := net.ParseCIDR(cidr); err == nil && ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// buildBackendSPOEAgents attaches the SPOE agents declared in the
+// spoe-agents-configmap global config. Agents not found are ignored.
+func (c *updater) buildBackendSPOEAgents(d *backData) {
+	config := d.mapper.Get(ingtypes.BackSPOEAgents)
+	if config.Value == "" {
+		return
+	}
+	agents := map[string]bool{}
+	for _, agent := range c.haproxy.Global().SPOEAgents {
+		agents[agent.Name] = true
+	}
+	for _, name := range utils.Split(config.Value, ",") {
+		if name == "" {
+			continue
+		}
+		if !agents[name] {
+			c.logger.Warn("ignoring SPOE agent '%s' on %v: agent not found", name, config.Source)
+			continue
+		}
+		d.backend.SPOEAgents = append(d.backend.SPOEAgents, name)
+	}
+}
+
 func (c *updater) buildBackendSSL(d *backData) {
 	d.backend.TLS.AddCertHeader = d.mapper.Get(ingtypes.BackAuthTLSCertHeader).Bool()
 	d.backend.TLS.FingerprintLower = d.mapper.Get(ingtypes.BackSSLFingerprintLower).Bool()
@@ -838,7 +1546,26 @@ func (c *updater) buildBackendSSL(d *backData) {
 }
 
 func (c *updater) buildBackendSSLRedirect(d *backData) {
+	var exceptions []string
+	cfg := d.mapper.Get(ingtypes.BackSSLRedirectExceptions)
+	for _, exception := range utils.Split(cfg.Value, ",") {
+		if !strings.HasPrefix(exception, "/") || strings.ContainsAny(exception, " \t") {
+			c.logger.Warn("ignoring invalid ssl-redirect exception on %v: %s", cfg.Source, exception)
+			continue
+		}
+		exceptions = append(exceptions, exception)
+	}
+	// paths of the HTTP-01 challenge are never redirected, even if
+	// no-tls-redirect-locations was changed
 	noTLSRedir := utils.Split(d.mapper.Get(ingtypes.GlobalNoTLSRedirectLocations).Value, ",")
+	noTLSRedir = append(noTLSRedir, strings.TrimSuffix(acmeChallengePrefix, "/"))
+	noTLSRedir = append(noTLSRedir, exceptions...)
+	// the embedded acme server only answers challenges that don't match a
+	// path of an ingress in the shared mode, so the backend receives them
+	if acme := c.haproxy.Global().Acme; acme.Enabled && acme.Shared {
+		exceptions = append(exceptions, acme.Prefix)
+	}
+	d.backend.SSLRedirectExceptions = exceptions
 	for _, path := range d.backend.Paths {
 		config := d.mapper.GetConfig(path.Link)
 		redir := config.Get(ingtypes.BackSSLRedirect).Bool()
@@ -853,6 +1580,23 @@ func (c *updater) buildBackendSSLRedirect(d *backData) {
 	}
 }
 
+func (c *updater) buildBackendRetry(d *backData) {
+	if cfg := d.mapper.Get(ingtypes.BackRedispatch); cfg.Source != nil {
+		if redispatch, err := strconv.ParseBool(cfg.Value); err == nil {
+			d.backend.Retry.Redispatch = redispatch
+			d.backend.Retry.RedispatchOverride = true
+		} else {
+			c.logger.Warn("ignoring invalid redispatch on %v: %s", cfg.Source, cfg.Value)
+		}
+	}
+	if cfg := d.mapper.Get(ingtypes.BackRetries); cfg.Source != nil {
+		d.backend.Retry.Retries = c.validateRetries(cfg)
+	}
+	if cfg := d.mapper.Get(ingtypes.BackRetryOn); cfg.Source != nil {
+		d.backend.Retry.RetryOn = c.validateRetryOn(cfg)
+	}
+}
+
 func (c *updater) buildBackendTimeout(d *backData) {
 	if cfg := d.mapper.Get(ingtypes.BackTimeoutConnect); cfg.Source != nil {
 		d.backend.Timeout.Connect = c.validateTime(cfg)
@@ -877,6 +1621,23 @@ func (c *updater) buildBackendTimeout(d *backData) {
 	}
 }
 
+func (c *updater) buildBackendTracing(d *backData) {
+	if d.backend.ModeTCP || !d.mapper.Get(ingtypes.BackTracingEnable).Bool() {
+		return
+	}
+	mode := d.mapper.Get(ingtypes.BackTracingMode)
+	format := d.mapper.Get(ingtypes.BackTracingHeaderFormat)
+	if mode.Source == nil && format.Source == nil {
+		d.backend.Tracing = c.haproxy.Global().Tracing
+		return
+	}
+	source := mode.Source
+	if source == nil {
+		source = format.Source
+	}
+	d.backend.Tracing = c.buildTracing(d.mapper, source)
+}
+
 func (c *updater) buildBackendWAF(d *backData) {
 	for _, path := range d.backend.Paths {
 		config := d.mapper.GetConfig(path.Link)
@@ -900,6 +1661,19 @@ func (c *updater) buildBackendWAF(d *backData) {
 	}
 }
 
+// buildBackendWebSocket applies a timeout profile of long lived connections.
+// Should be called after buildBackendTimeout, so timeouts explicitly declared
+// in the ingress or service resources have precedence.
+func (c *updater) buildBackendWebSocket(d *backData) {
+	d.backend.WebSocket = d.mapper.Get(ingtypes.BackWebSocket).Bool()
+	if !d.backend.WebSocket {
+		return
+	}
+	if d.backend.Timeout.Tunnel == "" {
+		d.backend.Timeout.Tunnel = "1h"
+	}
+}
+
 func (c *updater) buildBackendWhitelistHTTP(d *backData) {
 	if !d.backend.ModeTCP {
 		for _, path := range d.backend.Paths {
@@ -30,6 +30,115 @@ import (
 	hatypes "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/types"
 )
 
+func TestAccessLog(t *testing.T) {
+	annDefault := map[string]string{
+		ingtypes.BackAccessLog: "true",
+	}
+	testCases := []struct {
+		ann      map[string]map[string]string
+		paths    []string
+		expected map[string]hatypes.AccessLog
+		logging  string
+	}{
+		// 0
+		{
+			paths: []string{"/"},
+			expected: map[string]hatypes.AccessLog{
+				"/": {},
+			},
+		},
+		// 1
+		{
+			ann: map[string]map[string]string{
+				"/": {
+					ingtypes.BackAccessLog: "false",
+				},
+			},
+			expected: map[string]hatypes.AccessLog{
+				"/": {Disabled: true},
+			},
+		},
+		// 2
+		{
+			ann: map[string]map[string]string{
+				"/healthz": {
+					ingtypes.BackAccessLog: "false",
+				},
+				"/metrics": {
+					ingtypes.BackAccessLogSampleRatio: "0.1",
+				},
+			},
+			paths: []string{"/"},
+			expected: map[string]hatypes.AccessLog{
+				"/":        {},
+				"/healthz": {Disabled: true},
+				"/metrics": {SampleThreshold: 1000},
+			},
+		},
+		// 3
+		{
+			ann: map[string]map[string]string{
+				"/": {
+					ingtypes.BackAccessLogSampleRatio: "0",
+				},
+				"/app": {
+					ingtypes.BackAccessLogSampleRatio: "1",
+				},
+			},
+			expected: map[string]hatypes.AccessLog{
+				"/":    {Disabled: true},
+				"/app": {},
+			},
+		},
+		// 4
+		{
+			ann: map[string]map[string]string{
+				"/": {
+					ingtypes.BackAccessLogSampleRatio: "0.00004",
+				},
+				"/app": {
+					ingtypes.BackAccessLogSampleRatio: "0.00005",
+				},
+			},
+			expected: map[string]hatypes.AccessLog{
+				"/":    {Disabled: true},
+				"/app": {SampleThreshold: 1},
+			},
+		},
+		// 5
+		{
+			ann: map[string]map[string]string{
+				"/": {
+					ingtypes.BackAccessLogSampleRatio: "1.5",
+				},
+				"/app": {
+					ingtypes.BackAccessLogSampleRatio: "10%",
+				},
+			},
+			expected: map[string]hatypes.AccessLog{
+				"/":    {},
+				"/app": {},
+			},
+			logging: `
+WARN ignoring invalid access log sample ratio on ingress 'default/ing1': 1.5
+WARN ignoring invalid access log sample ratio on ingress 'default/ing1': 10%`,
+		},
+	}
+	source := &Source{Namespace: "default", Name: "ing1", Type: "ingress"}
+	for i, test := range testCases {
+		c := setup(t)
+		d := c.createBackendMappingData("default/app", source, annDefault, test.ann, test.paths)
+		c.createUpdater().buildBackendAccessLog(d)
+		actual := map[string]hatypes.AccessLog{}
+		for _, path := range d.backend.Paths {
+			actual[path.Path()] = path.AccessLog
+		}
+		c.compareObjects("access log", i, actual, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
 func TestAffinity(t *testing.T) {
 	testCase := []struct {
 		annDefault map[string]string
@@ -157,6 +266,63 @@ func TestAffinity(t *testing.T) {
 			expCookie:  hatypes.Cookie{Name: "INGRESSCOOKIE", Strategy: "insert", Dynamic: false, Keywords: "indirect nocache httponly"},
 			expLogging: "WARN invalid session-cookie-value-strategy 'err' on ingress 'default/ing1', using 'server-name' instead",
 		},
+		// 13
+		{
+			ann: map[string]string{
+				ingtypes.BackAffinity:              "cookie",
+				ingtypes.BackSessionCookieSameSite: "true",
+			},
+			expCookie: hatypes.Cookie{Name: "INGRESSCOOKIE", Strategy: "insert", Keywords: "indirect nocache httponly", SameSite: "None", Secure: true},
+		},
+		// 14
+		{
+			ann: map[string]string{
+				ingtypes.BackAffinity:              "cookie",
+				ingtypes.BackSessionCookieSameSite: "lax",
+				ingtypes.BackSessionCookieHTTPOnly: "true",
+			},
+			expCookie: hatypes.Cookie{Name: "INGRESSCOOKIE", Strategy: "insert", Keywords: "indirect nocache httponly", SameSite: "Lax"},
+		},
+		// 15
+		{
+			ann: map[string]string{
+				ingtypes.BackAffinity:              "cookie",
+				ingtypes.BackSessionCookieKeywords: "indirect",
+				ingtypes.BackSessionCookieSameSite: "Strict",
+				ingtypes.BackSessionCookieSecure:   "true",
+				ingtypes.BackSessionCookieHTTPOnly: "true",
+				ingtypes.BackSessionCookieDomain:   ".d1.local",
+				ingtypes.BackSessionCookieMaxAge:   "1d",
+				ingtypes.BackSessionCookieDynKey:   "s3cr3t",
+			},
+			expCookie: hatypes.Cookie{
+				Name:       "INGRESSCOOKIE",
+				Strategy:   "insert",
+				Keywords:   "indirect",
+				SameSite:   "Strict",
+				Secure:     true,
+				HTTPOnly:   true,
+				Domain:     ".d1.local",
+				MaxAge:     86400,
+				DynamicKey: "s3cr3t",
+			},
+		},
+		// 16
+		{
+			ann: map[string]string{
+				ingtypes.BackAffinity:              "cookie",
+				ingtypes.BackSessionCookieSameSite: "always",
+				ingtypes.BackSessionCookieDomain:   "d1.local;",
+				ingtypes.BackSessionCookieMaxAge:   "500ms",
+				ingtypes.BackSessionCookieDynKey:   `s3"cr3t`,
+			},
+			expCookie: hatypes.Cookie{Name: "INGRESSCOOKIE", Strategy: "insert", Keywords: "indirect nocache httponly"},
+			expLogging: `
+WARN ignoring invalid session-cookie-same-site on ingress 'default/ing1': always
+WARN ignoring invalid session-cookie-domain on ingress 'default/ing1': d1.local;
+WARN ignoring invalid session-cookie-max-age on ingress 'default/ing1': 500ms
+WARN ignoring invalid session-cookie-dynamic-key on ingress 'default/ing1'`,
+		},
 	}
 
 	source := &Source{
@@ -170,11 +336,102 @@ func TestAffinity(t *testing.T) {
 		d := c.createBackendData("default/app", source, test.ann, test.annDefault)
 		u.buildBackendAffinity(d)
 		c.compareObjects("affinity", i, d.backend.Cookie, test.expCookie)
+		if test.ann[ingtypes.BackSessionCookieValue] == "server-name-hash" && d.backend.EpCookieStrategy != hatypes.EpCookieNameHash {
+			t.Errorf("expected server-name-hash cookie strategy on %d", i)
+		}
 		c.logger.CompareLogging(test.expLogging)
 		c.teardown()
 	}
 }
 
+func TestAgentCheck(t *testing.T) {
+	testCase := []struct {
+		ann      map[string]string
+		expected hatypes.AgentCheck
+		logging  string
+	}{
+		// 0
+		{
+			ann: map[string]string{
+				ingtypes.BackAgentCheckInterval: "2s",
+				ingtypes.BackAgentCheckSend:     "ping",
+			},
+			expected: hatypes.AgentCheck{},
+		},
+		// 1
+		{
+			ann: map[string]string{
+				ingtypes.BackAgentCheckPort:     "8000",
+				ingtypes.BackAgentCheckAddr:     "10.0.0.1",
+				ingtypes.BackAgentCheckInterval: "5s",
+			},
+			expected: hatypes.AgentCheck{
+				Addr:     "10.0.0.1",
+				Interval: "5s",
+				Port:     8000,
+			},
+		},
+		// 2
+		{
+			ann: map[string]string{
+				ingtypes.BackAgentCheckPort: "80000",
+			},
+			expected: hatypes.AgentCheck{},
+			logging:  `WARN ignoring invalid agent check port on ingress 'default/ing1': 80000`,
+		},
+		// 3
+		{
+			ann: map[string]string{
+				ingtypes.BackAgentCheckPort: "agent",
+			},
+			expected: hatypes.AgentCheck{},
+			logging:  `WARN ignoring invalid agent check port on ingress 'default/ing1': agent`,
+		},
+		// 4
+		{
+			ann: map[string]string{
+				ingtypes.BackAgentCheckPort: "8000",
+				ingtypes.BackAgentCheckSend: `ping\n`,
+			},
+			expected: hatypes.AgentCheck{
+				Port: 8000,
+				Send: `ping\n`,
+			},
+		},
+		// 5
+		{
+			ann: map[string]string{
+				ingtypes.BackAgentCheckPort: "8000",
+				ingtypes.BackAgentCheckSend: `status of "app"\n`,
+			},
+			expected: hatypes.AgentCheck{
+				Port: 8000,
+				Send: `"status of \"app\"\n"`,
+			},
+		},
+		// 6
+		{
+			ann: map[string]string{
+				ingtypes.BackAgentCheckPort:     "8000",
+				ingtypes.BackAgentCheckInterval: "2t",
+			},
+			expected: hatypes.AgentCheck{
+				Port: 8000,
+			},
+			logging: `WARN ignoring invalid time format on ingress 'default/ing1': 2t`,
+		},
+	}
+	source := &Source{Namespace: "default", Name: "ing1", Type: "ingress"}
+	for i, test := range testCase {
+		c := setup(t)
+		d := c.createBackendData("default/app", source, test.ann, map[string]string{})
+		c.createUpdater().buildBackendAgentCheck(d)
+		c.compareObjects("agent check", i, d.backend.AgentCheck, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
 func TestAuthExternal(t *testing.T) {
 	testCase := []struct {
 		url        string
@@ -182,6 +439,7 @@ func TestAuthExternal(t *testing.T) {
 		headers    string
 		isExternal bool
 		hasLua     bool
+		caps       *hatypes.Capabilities
 		expBack    hatypes.AuthExternal
 		expIP      []string
 		logging    string
@@ -333,6 +591,22 @@ func TestAuthExternal(t *testing.T) {
 			},
 			expIP: []string{"10.0.0.11:8080"},
 		},
+		// 18
+		{
+			url:     "http://app1.local",
+			caps:    &hatypes.Capabilities{},
+			logging: `WARN external authentication on ingress 'default/ing1' needs Lua, but haproxy was built without Lua support`,
+		},
+		// 19
+		{
+			url:  "http://app1.local",
+			caps: &hatypes.Capabilities{Lua: true},
+			expBack: hatypes.AuthExternal{
+				AuthBackendName: "_auth_4001",
+				Path:            "/",
+			},
+			expIP: []string{"10.0.0.2:80"},
+		},
 	}
 	source := &Source{
 		Namespace: "default",
@@ -351,6 +625,7 @@ func TestAuthExternal(t *testing.T) {
 	for i, test := range testCase {
 		c := setup(t)
 		u := c.createUpdater()
+		u.options.Capabilities = test.caps
 		c.haproxy.Frontend().AuthProxy.RangeStart = 4001
 		c.haproxy.Frontend().AuthProxy.RangeEnd = 4009
 		if test.isExternal {
@@ -546,6 +821,137 @@ usr2::clearpwd2`)}},
 	}
 }
 
+func TestBalance(t *testing.T) {
+	testCases := []struct {
+		balance  string
+		expected string
+		logging  string
+	}{
+		// 0
+		{
+			balance:  "roundrobin",
+			expected: "roundrobin",
+		},
+		// 1
+		{
+			balance:  "leastconn",
+			expected: "leastconn",
+		},
+		// 2
+		{
+			balance:  "first",
+			expected: "first",
+		},
+		// 3
+		{
+			balance:  "source",
+			expected: "source",
+		},
+		// 4
+		{
+			balance:  "random",
+			expected: "random",
+		},
+		// 5
+		{
+			balance:  "random(3)",
+			expected: "random(3)",
+		},
+		// 6
+		{
+			balance:  "random(0)",
+			expected: "roundrobin",
+			logging:  "WARN ignoring invalid balance algorithm on ingress 'default/ing1', using 'roundrobin': unsupported algorithm: random(0)",
+		},
+		// 7
+		{
+			balance:  "uri",
+			expected: "uri",
+		},
+		// 8
+		{
+			balance:  "uri  whole len 10 depth 2",
+			expected: "uri whole len 10 depth 2",
+		},
+		// 9
+		{
+			balance:  "uri depth",
+			expected: "roundrobin",
+			logging:  "WARN ignoring invalid balance algorithm on ingress 'default/ing1', using 'roundrobin': missing value of 'depth' option",
+		},
+		// 10
+		{
+			balance:  "uri len -1",
+			expected: "roundrobin",
+			logging:  "WARN ignoring invalid balance algorithm on ingress 'default/ing1', using 'roundrobin': value of 'len' option should be a positive number: -1",
+		},
+		// 11
+		{
+			balance:  "uri full",
+			expected: "roundrobin",
+			logging:  "WARN ignoring invalid balance algorithm on ingress 'default/ing1', using 'roundrobin': unsupported option of 'uri' algorithm: full",
+		},
+		// 12
+		{
+			balance:  "hdr(User-Agent)",
+			expected: "hdr(User-Agent)",
+		},
+		// 13
+		{
+			balance:  "hdr(host) use_domain_only",
+			expected: "hdr(host) use_domain_only",
+		},
+		// 14
+		{
+			balance:  "hdr(host) full",
+			expected: "roundrobin",
+			logging:  "WARN ignoring invalid balance algorithm on ingress 'default/ing1', using 'roundrobin': unsupported option of 'hdr' algorithm: full",
+		},
+		// 15
+		{
+			balance:  "url_param userid check_post",
+			expected: "url_param userid check_post",
+		},
+		// 16
+		{
+			balance:  "url_param",
+			expected: "roundrobin",
+			logging:  "WARN ignoring invalid balance algorithm on ingress 'default/ing1', using 'roundrobin': missing or invalid parameter name of 'url_param' algorithm",
+		},
+		// 17
+		{
+			balance:  "leastconn 10",
+			expected: "roundrobin",
+			logging:  "WARN ignoring invalid balance algorithm on ingress 'default/ing1', using 'roundrobin': algorithm 'leastconn' does not accept arguments: 10",
+		},
+		// 18
+		{
+			balance:  "leastcon",
+			expected: "roundrobin",
+			logging:  "WARN ignoring invalid balance algorithm on ingress 'default/ing1', using 'roundrobin': unsupported algorithm: leastcon",
+		},
+		// 19
+		{
+			balance:  "",
+			expected: "roundrobin",
+			logging:  "WARN ignoring invalid balance algorithm on ingress 'default/ing1', using 'roundrobin': missing algorithm name",
+		},
+	}
+	source := &Source{
+		Namespace: "default",
+		Name:      "ing1",
+		Type:      "ingress",
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		d := c.createBackendData("default/app", source, map[string]string{ingtypes.BackBalanceAlgorithm: test.balance}, map[string]string{})
+		c.createUpdater().buildBackendBalance(d)
+		c.compareObjects("balance", i, d.backend.BalanceAlgorithm, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
 func TestBlueGreen(t *testing.T) {
 	buildPod := func(labels string) *api.Pod {
 		l := make(map[string]string)
@@ -1046,26 +1452,470 @@ const (
 	corsDefaultMaxAge  = 86400
 )
 
-func TestCors(t *testing.T) {
-	testCases := []struct {
-		paths    []string
-		ann      map[string]map[string]string
-		expected map[string]hatypes.Cors
+func TestCache(t *testing.T) {
+	testCase := []struct {
+		ann      map[string]string
+		modeTCP  bool
+		expected hatypes.BackendCache
 		logging  string
 	}{
 		// 0
 		{
-			paths: []string{"/"},
-			expected: map[string]hatypes.Cors{
-				"/": {},
-			},
+			ann:      map[string]string{},
+			expected: hatypes.BackendCache{},
 		},
 		// 1
 		{
-			ann: map[string]map[string]string{
-				"/": {
-					ingtypes.BackCorsEnable: "true",
-				},
+			ann: map[string]string{
+				ingtypes.BackCacheEnable: "true",
+			},
+			expected: hatypes.BackendCache{
+				Enabled:      true,
+				MaxAge:       60,
+				TotalMaxSize: 4,
+			},
+		},
+		// 2
+		{
+			ann: map[string]string{
+				ingtypes.BackCacheEnable:        "true",
+				ingtypes.BackCacheTotalSize:     "1500k",
+				ingtypes.BackCacheMaxObjectSize: "64k",
+				ingtypes.BackCacheMaxAge:        "5m",
+			},
+			expected: hatypes.BackendCache{
+				Enabled:       true,
+				MaxAge:        300,
+				MaxObjectSize: 65536,
+				TotalMaxSize:  2,
+			},
+		},
+		// 3
+		{
+			ann: map[string]string{
+				ingtypes.BackCacheEnable: "true",
+				ingtypes.BackCacheMaxAge: "3600",
+			},
+			expected: hatypes.BackendCache{
+				Enabled:      true,
+				MaxAge:       3600,
+				TotalMaxSize: 4,
+			},
+		},
+		// 4
+		{
+			ann: map[string]string{
+				ingtypes.BackCacheEnable:    "true",
+				ingtypes.BackCacheTotalSize: "8g",
+			},
+			expected: hatypes.BackendCache{},
+			logging:  `WARN ignoring cache on ingress 'default/ing1' due to invalid total size: 8g`,
+		},
+		// 5
+		{
+			ann: map[string]string{
+				ingtypes.BackCacheEnable:        "true",
+				ingtypes.BackCacheMaxObjectSize: "3m",
+				ingtypes.BackCacheMaxAge:        "1y",
+			},
+			expected: hatypes.BackendCache{
+				Enabled:      true,
+				TotalMaxSize: 4,
+			},
+			logging: `
+WARN ignoring cache max object size on ingress 'default/ing1', it should not be greater than half of the total size: 3m
+WARN ignoring invalid cache max age on ingress 'default/ing1': 1y`,
+		},
+		// 6
+		{
+			ann: map[string]string{
+				ingtypes.BackCacheEnable:        "true",
+				ingtypes.BackCacheMaxObjectSize: "1x",
+			},
+			expected: hatypes.BackendCache{
+				Enabled:      true,
+				MaxAge:       60,
+				TotalMaxSize: 4,
+			},
+			logging: `WARN ignoring invalid cache max object size on ingress 'default/ing1': 1x`,
+		},
+		// 7
+		{
+			ann: map[string]string{
+				ingtypes.BackCacheEnable: "true",
+			},
+			modeTCP:  true,
+			expected: hatypes.BackendCache{},
+			logging:  `WARN ignoring cache on TCP backend ingress 'default/ing1'`,
+		},
+	}
+	annDefault := map[string]string{
+		ingtypes.BackCacheEnable:    "false",
+		ingtypes.BackCacheMaxAge:    "60s",
+		ingtypes.BackCacheTotalSize: "4m",
+	}
+	source := &Source{Namespace: "default", Name: "ing1", Type: "ingress"}
+	for i, test := range testCase {
+		c := setup(t)
+		d := c.createBackendData("default/app", source, test.ann, annDefault)
+		d.backend.ModeTCP = test.modeTCP
+		c.createUpdater().buildBackendCache(d)
+		c.compareObjects("cache", i, d.backend.Cache, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestConfigSnippet(t *testing.T) {
+	defaultPolicy := map[string]string{
+		ingtypes.GlobalConfigBackendAllowedNS: "*",
+		ingtypes.GlobalConfigBackendForbidden: "ca-file,external-check,lua,-f",
+	}
+	testCases := []struct {
+		source     *Source
+		ann        map[string]string
+		annDefault map[string]string
+		expected   []string
+		logging    string
+	}{
+		// 0
+		{
+			ann:        map[string]string{ingtypes.BackConfigBackend: "http-request deny if { path /admin }"},
+			annDefault: defaultPolicy,
+			expected:   []string{"http-request deny if { path /admin }"},
+		},
+		// 1
+		{
+			annDefault: map[string]string{
+				ingtypes.BackConfigBackend:            "option external-check",
+				ingtypes.GlobalConfigBackendAllowedNS: "",
+			},
+			expected: []string{"option external-check"},
+		},
+		// 2
+		{
+			source: &Source{Namespace: "default", Name: "ing1", Type: "ingress"},
+			ann:    map[string]string{ingtypes.BackConfigBackend: "http-request deny if { path /admin }"},
+			annDefault: map[string]string{
+				ingtypes.GlobalConfigBackendAllowedNS: "ingress, admin",
+			},
+			logging: `WARN skipping config-backend snippet on ingress 'default/ing1': namespace 'default' is not allowed to declare configuration snippets`,
+		},
+		// 3
+		{
+			source: &Source{Namespace: "default", Name: "ing1", Type: "ingress"},
+			ann:    map[string]string{ingtypes.BackConfigBackend: "http-request deny if { path /admin }"},
+			annDefault: map[string]string{
+				ingtypes.GlobalConfigBackendAllowedNS: "admin,default",
+			},
+			expected: []string{"http-request deny if { path /admin }"},
+		},
+		// 4
+		{
+			source: &Source{Namespace: "default", Name: "ing1", Type: "ingress"},
+			ann: map[string]string{ingtypes.BackConfigBackend: `
+acl internal src 10.0.0.0/8
+option external-check
+`},
+			annDefault: defaultPolicy,
+			logging:    `WARN skipping config-backend snippet on ingress 'default/ing1': forbidden keyword 'external-check'`,
+		},
+		// 5
+		{
+			source:     &Source{Namespace: "default", Name: "svc1", Type: "service"},
+			ann:        map[string]string{ingtypes.BackConfigBackend: "http-request lua.auth"},
+			annDefault: defaultPolicy,
+			logging:    `WARN skipping config-backend snippet on service 'default/svc1': forbidden keyword 'lua'`,
+		},
+		// 6
+		{
+			source:     &Source{Namespace: "default", Name: "ing1", Type: "ingress"},
+			ann:        map[string]string{ingtypes.BackConfigBackend: "http-request deny if { src -f /etc/passwd }"},
+			annDefault: defaultPolicy,
+			logging:    `WARN skipping config-backend snippet on ingress 'default/ing1': forbidden keyword '-f'`,
+		},
+		// 7
+		{
+			source:     &Source{Namespace: "default", Name: "ing1", Type: "ingress"},
+			ann:        map[string]string{ingtypes.BackConfigBackend: "http-request set-header X-Lua lua-header"},
+			annDefault: defaultPolicy,
+			expected:   []string{"http-request set-header X-Lua lua-header"},
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		d := c.createBackendData("default/app", test.source, test.ann, test.annDefault)
+		c.createUpdater().buildBackendConfigSnippet(d)
+		c.compareObjects("config snippet", i, d.backend.CustomConfig, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestConfigSnippets(t *testing.T) {
+	defaultPolicy := map[string]string{
+		ingtypes.GlobalConfigBackendAllowedNS: "*",
+		ingtypes.GlobalConfigBackendForbidden: "ca-file,external-check,lua,-f",
+	}
+	testCases := []struct {
+		configMaps map[string]map[string]string
+		ann        map[string]string
+		annDefault map[string]string
+		snippets   string
+		expected   []string
+		logging    string
+	}{
+		// 0
+		{
+			annDefault: defaultPolicy,
+		},
+		// 1
+		{
+			configMaps: map[string]map[string]string{
+				"default/snippets": {
+					"backend.app":   "http-request deny if { path /admin }",
+					"backend":       "acl internal src 10.0.0.0/8",
+					"backend.other": "http-request deny",
+				},
+			},
+			annDefault: defaultPolicy,
+			snippets:   "default/snippets",
+			expected:   []string{"acl internal src 10.0.0.0/8", "http-request deny if { path /admin }"},
+		},
+		// 2
+		{
+			configMaps: map[string]map[string]string{
+				"default/snippets1": {"backend": "## snippets1"},
+				"default/snippets2": {"backend.app": "## snippets2"},
+			},
+			annDefault: defaultPolicy,
+			snippets:   "default/snippets2,default/snippets1",
+			expected:   []string{"## snippets2", "## snippets1"},
+		},
+		// 3
+		{
+			configMaps: map[string]map[string]string{
+				"default/snippets": {"backend": "## snippet"},
+			},
+			ann:        map[string]string{ingtypes.BackConfigBackend: "## config-backend"},
+			annDefault: defaultPolicy,
+			snippets:   "default/snippets",
+			expected:   []string{"## config-backend", "## snippet"},
+		},
+		// 4
+		{
+			configMaps: map[string]map[string]string{
+				"dev/snippets":                {"backend": "## dev"},
+				"ingress-controller/snippets": {"backend.app": "## controller"},
+			},
+			annDefault: defaultPolicy,
+			snippets:   "dev/snippets,snippets",
+		},
+		// 5
+		{
+			configMaps: map[string]map[string]string{
+				"default/snippets": {"backend": "## snippet"},
+			},
+			annDefault: map[string]string{
+				ingtypes.GlobalConfigBackendAllowedNS: "admin",
+			},
+			snippets: "default/snippets",
+			logging:  `WARN ignoring injection point 'backend' of configmap 'default/snippets': namespace 'default' is not allowed to declare configuration snippets`,
+		},
+		// 6
+		{
+			configMaps: map[string]map[string]string{
+				"default/snippets": {
+					"backend":     "## snippet",
+					"backend.app": "option external-check",
+				},
+			},
+			annDefault: defaultPolicy,
+			snippets:   "default/snippets",
+			expected:   []string{"## snippet"},
+			logging:    `WARN ignoring injection point 'backend.app' of configmap 'default/snippets': forbidden keyword 'external-check'`,
+		},
+		// 7
+		{
+			configMaps: map[string]map[string]string{
+				"default/snippets": {
+					"global":  "## global",
+					"listen":  "## listen",
+					"backend": "## snippet",
+				},
+			},
+			annDefault: defaultPolicy,
+			snippets:   "default/snippets,default/missing",
+			expected:   []string{"## snippet"},
+			logging: `
+WARN ignoring injection point 'global' of configmap 'default/snippets': only configmaps of the controller namespace can declare it
+WARN ignoring injection point 'listen' of configmap 'default/snippets': unsupported injection point
+ERROR error reading config snippets: configmap not found: default/missing`,
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		c.cache.ConfigMapList = map[string]*api.ConfigMap{}
+		for name, data := range test.configMaps {
+			cmName := strings.Split(name, "/")
+			c.cache.ConfigMapList[name] = &api.ConfigMap{
+				ObjectMeta: meta.ObjectMeta{Namespace: cmName[0], Name: cmName[1]},
+				Data:       data,
+			}
+		}
+		test.annDefault[ingtypes.GlobalConfigSnippets] = test.snippets
+		d := c.createBackendData("default/app", &Source{}, test.ann, test.annDefault)
+		u := c.createUpdater()
+		u.buildBackendConfigSnippet(d)
+		u.buildBackendConfigSnippets(d)
+		c.compareObjects("config snippets", i, d.backend.CustomConfig, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestConnection(t *testing.T) {
+	testCases := []struct {
+		ann      map[string]string
+		expected hatypes.ServerConfig
+		logging  string
+	}{
+		// 0
+		{
+			ann: map[string]string{},
+		},
+		// 1
+		{
+			ann: map[string]string{
+				ingtypes.BackMaxconnServer:  "100",
+				ingtypes.BackMaxQueueServer: "50",
+			},
+			expected: hatypes.ServerConfig{MaxConn: 100, MaxQueue: 50},
+		},
+		// 2
+		{
+			ann: map[string]string{
+				ingtypes.BackMaxconnServer: "100",
+				ingtypes.BackMinconnServer: "10",
+			},
+			expected: hatypes.ServerConfig{MaxConn: 100, MinConn: 10},
+		},
+		// 3
+		{
+			ann: map[string]string{
+				ingtypes.BackMinconnServer: "10",
+			},
+			logging: `WARN ignoring minconn-server on ingress 'default/ing1': maxconn-server should also be declared`,
+		},
+		// 4
+		{
+			ann: map[string]string{
+				ingtypes.BackMaxconnServer: "10",
+				ingtypes.BackMinconnServer: "20",
+			},
+			expected: hatypes.ServerConfig{MaxConn: 10},
+			logging:  `WARN ignoring minconn-server on ingress 'default/ing1': value 20 is greater than maxconn-server 10`,
+		},
+	}
+	source := &Source{Namespace: "default", Name: "ing1", Type: "ingress"}
+	for i, test := range testCases {
+		c := setup(t)
+		d := c.createBackendData("default/app", source, test.ann, map[string]string{})
+		c.createUpdater().buildBackendConnection(d)
+		c.compareObjects("connection", i, d.backend.Server, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestFallback(t *testing.T) {
+	testCases := []struct {
+		ann      map[string]string
+		expected []*hatypes.Endpoint
+		logging  string
+	}{
+		// 0
+		{
+			ann: map[string]string{},
+		},
+		// 1
+		{
+			ann: map[string]string{
+				ingtypes.BackFallbackService: "sorry",
+			},
+			expected: []*hatypes.Endpoint{
+				{Name: "backup001", IP: "172.17.0.21", Port: 8080, Target: "172.17.0.21:8080", Enabled: true, Weight: 1},
+				{Name: "backup002", IP: "172.17.0.22", Port: 8080, Target: "172.17.0.22:8080", Enabled: true, Weight: 1},
+			},
+		},
+		// 2
+		{
+			ann: map[string]string{
+				ingtypes.BackFallbackService: "system/sorry:http",
+			},
+			expected: []*hatypes.Endpoint{
+				{Name: "backup001", IP: "172.17.0.31", Port: 80, Target: "172.17.0.31:80", Enabled: true, Weight: 1},
+			},
+		},
+		// 3
+		{
+			ann: map[string]string{
+				ingtypes.BackFallbackService: "sorry:9000",
+			},
+			logging: `WARN ignoring fallback service on ingress 'default/ing1': port not found: '9000'`,
+		},
+		// 4
+		{
+			ann: map[string]string{
+				ingtypes.BackFallbackService: "other",
+			},
+			logging: `WARN ignoring fallback service on ingress 'default/ing1': service not found: 'default/other'`,
+		},
+		// 5
+		{
+			ann: map[string]string{
+				ingtypes.BackFallbackService: "app",
+			},
+			logging: `WARN ignoring fallback service on ingress 'default/ing1': backend cannot fallback to itself`,
+		},
+	}
+	source := &Source{Namespace: "default", Name: "ing1", Type: "ingress"}
+	for i, test := range testCases {
+		c := setup(t)
+		svc, ep := conv_helper.CreateService("default/sorry", "8080", "172.17.0.21,172.17.0.22")
+		c.cache.SvcList = append(c.cache.SvcList, svc)
+		c.cache.EpList["default/sorry"] = ep
+		svc, ep = conv_helper.CreateService("system/sorry", "http:80:8000", "172.17.0.31")
+		c.cache.SvcList = append(c.cache.SvcList, svc)
+		c.cache.EpList["system/sorry"] = ep
+		d := c.createBackendData("default/app", source, test.ann, map[string]string{})
+		c.createUpdater().buildBackendFallback(d)
+		c.compareObjects("fallback", i, d.backend.BackupEndpoints, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestCors(t *testing.T) {
+	testCases := []struct {
+		paths    []string
+		ann      map[string]map[string]string
+		expected map[string]hatypes.Cors
+		logging  string
+	}{
+		// 0
+		{
+			paths: []string{"/"},
+			expected: map[string]hatypes.Cors{
+				"/": {},
+			},
+		},
+		// 1
+		{
+			ann: map[string]map[string]string{
+				"/": {
+					ingtypes.BackCorsEnable: "true",
+				},
 			},
 			expected: map[string]hatypes.Cors{
 				"/": {
@@ -1081,200 +1931,667 @@ func TestCors(t *testing.T) {
 		},
 		// 2
 		{
-			ann: map[string]map[string]string{
-				"/": {
-					ingtypes.BackCorsEnable: "false",
-				},
-				"/sub": {
-					ingtypes.BackCorsEnable: "true",
-				},
-			},
-			expected: map[string]hatypes.Cors{
+			ann: map[string]map[string]string{
+				"/": {
+					ingtypes.BackCorsEnable: "false",
+				},
+				"/sub": {
+					ingtypes.BackCorsEnable: "true",
+				},
+			},
+			expected: map[string]hatypes.Cors{
+				"/": {},
+				"/sub": {
+					Enabled:          true,
+					AllowCredentials: false,
+					AllowHeaders:     corsDefaultHeaders,
+					AllowMethods:     corsDefaultMethods,
+					AllowOrigin:      corsDefaultOrigin,
+					ExposeHeaders:    "",
+					MaxAge:           corsDefaultMaxAge,
+				},
+			},
+		},
+	}
+	annDefault := map[string]string{
+		ingtypes.BackCorsAllowHeaders: corsDefaultHeaders,
+		ingtypes.BackCorsAllowMethods: corsDefaultMethods,
+		ingtypes.BackCorsAllowOrigin:  corsDefaultOrigin,
+		ingtypes.BackCorsMaxAge:       strconv.Itoa(corsDefaultMaxAge),
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		d := c.createBackendMappingData("default/app", &Source{}, annDefault, test.ann, test.paths)
+		c.createUpdater().buildBackendCors(d)
+		actual := map[string]hatypes.Cors{}
+		for _, path := range d.backend.Paths {
+			actual[path.Path()] = path.Cors
+		}
+		c.compareObjects("cors", i, actual, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestBackendDNS(t *testing.T) {
+	testCases := []struct {
+		port         string
+		resolver     string
+		externalName string
+		expResolver  string
+		expTarget    string
+		logging      string
+	}{
+		// 0
+		{},
+		// 1
+		{
+			port:     "8080",
+			resolver: "k8s",
+			logging:  `WARN skipping undeclared DNS resolver: k8s`,
+		},
+		// 2
+		{
+			port:        "8080",
+			resolver:    "kube-dns",
+			expResolver: "kube-dns",
+		},
+		// 3
+		{
+			port:         "8080",
+			resolver:     "kube-dns",
+			externalName: "app.domain.local",
+			expResolver:  "kube-dns",
+			expTarget:    "app.domain.local:8080",
+		},
+		// 4
+		{
+			port:         "http",
+			resolver:     "kube-dns",
+			externalName: "app.domain.local",
+			expResolver:  "kube-dns",
+			expTarget:    "app.domain.local:8080",
+		},
+		// 5
+		{
+			port:         "9000",
+			resolver:     "kube-dns",
+			externalName: "app.domain.local",
+			logging:      `WARN skipping DNS resolver on backend 'default_app_8080': port not found on ExternalName service: 9000`,
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		svc, _ := conv_helper.CreateService("default/app", "http:8080", "")
+		if test.externalName != "" {
+			svc.Spec.Type = api.ServiceTypeExternalName
+			svc.Spec.ExternalName = test.externalName
+		}
+		c.cache.SvcList = append(c.cache.SvcList, svc)
+		c.haproxy.Global().DNS.Resolvers = []*hatypes.DNSResolver{{Name: "kube-dns"}}
+		d := c.createBackendData("default/app", &Source{}, map[string]string{ingtypes.BackUseResolver: test.resolver}, map[string]string{})
+		d.backend.Port = test.port
+		c.createUpdater().buildBackendDNS(d)
+		c.compareObjects("resolver", i, d.backend.Resolver, test.expResolver)
+		c.compareObjects("resolver target", i, d.backend.ResolverTarget, test.expTarget)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	testCases := []struct {
+		headers  string
+		expected []*hatypes.BackendHeader
+		logging  string
+	}{
+		// 0
+		{
+			headers: `invalid`,
+			logging: `WARN ignored missing header name or value on ingress 'ing1/app': invalid`,
+		},
+		// 1
+		{
+			headers: `key value`,
+			expected: []*hatypes.BackendHeader{
+				{Name: "key", Value: "value"},
+			},
+		},
+		// 2
+		{
+			headers: `name: content`,
+			expected: []*hatypes.BackendHeader{
+				{Name: "name", Value: "content"},
+			},
+		},
+		// 3
+		{
+			headers: `k:v`,
+			expected: []*hatypes.BackendHeader{
+				{Name: "k", Value: "v"},
+			},
+		},
+		// 4
+		{
+			headers: `host: %[service].%[namespace].svc.cluster.local`,
+			expected: []*hatypes.BackendHeader{
+				{Name: "host", Value: "app.default.svc.cluster.local"},
+			},
+		},
+		// 5
+		{
+			headers: `
+k8snamespace: %[namespace]
+k8sservice: %[service]
+host: %[service].%[namespace].svc.cluster.local
+`,
+			expected: []*hatypes.BackendHeader{
+				{Name: "k8snamespace", Value: "default"},
+				{Name: "k8sservice", Value: "app"},
+				{Name: "host", Value: "app.default.svc.cluster.local"},
+			},
+		},
+	}
+	source := &Source{
+		Namespace: "ing1",
+		Name:      "app",
+		Type:      "ingress",
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		ann := map[string]map[string]string{
+			"/": {ingtypes.BackHeaders: test.headers},
+		}
+		d := c.createBackendMappingData("default/app", source, map[string]string{}, ann, []string{"/"})
+		c.createUpdater().buildBackendHeaders(d)
+		c.compareObjects("headers", i, d.backend.Headers, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestHealthCheckHTTP(t *testing.T) {
+	testCase := []struct {
+		ann      map[string]string
+		expected hatypes.HealthCheck
+		logging  string
+	}{
+		// 0
+		{
+			ann: map[string]string{
+				ingtypes.BackHealthCheckMethod:    "HEAD",
+				ingtypes.BackHealthCheckExpStatus: "200",
+			},
+			expected: hatypes.HealthCheck{},
+		},
+		// 1
+		{
+			ann: map[string]string{
+				ingtypes.BackHealthCheckURI:    "/health",
+				ingtypes.BackHealthCheckMethod: "head",
+			},
+			expected: hatypes.HealthCheck{
+				URI:    "/health",
+				Method: "HEAD",
+			},
+		},
+		// 2
+		{
+			ann: map[string]string{
+				ingtypes.BackHealthCheckURI:    "/health",
+				ingtypes.BackHealthCheckMethod: "FETCH",
+			},
+			expected: hatypes.HealthCheck{
+				URI: "/health",
+			},
+			logging: `WARN ignoring invalid health check method on ingress 'default/ing1': FETCH`,
+		},
+		// 3
+		{
+			ann: map[string]string{
+				ingtypes.BackHealthCheckURI:       "/health",
+				ingtypes.BackHealthCheckExpStatus: "200, 300-399,2xx",
+			},
+			expected: hatypes.HealthCheck{
+				URI:          "/health",
+				ExpectStatus: "200,300-399",
+			},
+			logging: `WARN ignoring invalid health check expected status on ingress 'default/ing1': 2xx`,
+		},
+		// 4
+		{
+			ann: map[string]string{
+				ingtypes.BackHealthCheckURI:       "/health",
+				ingtypes.BackHealthCheckExpString: "ok",
+			},
+			expected: hatypes.HealthCheck{
+				URI:          "/health",
+				ExpectString: "ok",
+			},
+		},
+		// 5
+		{
+			ann: map[string]string{
+				ingtypes.BackHealthCheckURI:       "/health",
+				ingtypes.BackHealthCheckExpString: `"status": "up"`,
+			},
+			expected: hatypes.HealthCheck{
+				URI:          "/health",
+				ExpectString: `"\"status\": \"up\""`,
+			},
+		},
+		// 6
+		{
+			ann: map[string]string{
+				ingtypes.BackHealthCheckURI:       "/health",
+				ingtypes.BackHealthCheckExpStatus: "204",
+				ingtypes.BackHealthCheckExpString: "ok",
+			},
+			expected: hatypes.HealthCheck{
+				URI:          "/health",
+				ExpectStatus: "204",
+			},
+			logging: `WARN ignoring health check expected string on ingress 'default/ing1' due to expected status configuration`,
+		},
+	}
+	source := &Source{Namespace: "default", Name: "ing1", Type: "ingress"}
+	for i, test := range testCase {
+		c := setup(t)
+		d := c.createBackendData("default/app", source, test.ann, map[string]string{})
+		d.backend.HealthCheck.URI = test.ann[ingtypes.BackHealthCheckURI]
+		c.createUpdater().buildBackendHealthCheckHTTP(d)
+		c.compareObjects("health check http", i, d.backend.HealthCheck, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestHealthCheckObserve(t *testing.T) {
+	testCase := []struct {
+		ann      map[string]string
+		modeTCP  bool
+		expected hatypes.HealthCheck
+		logging  string
+	}{
+		// 0
+		{
+			ann: map[string]string{
+				ingtypes.BackHealthCheckErrorLimit: "10",
+				ingtypes.BackHealthCheckOnError:    "mark-down",
+			},
+			expected: hatypes.HealthCheck{},
+		},
+		// 1
+		{
+			ann: map[string]string{
+				ingtypes.BackHealthCheckObserve: "layer7",
+			},
+			expected: hatypes.HealthCheck{
+				Observe: "layer7",
+			},
+		},
+		// 2
+		{
+			ann: map[string]string{
+				ingtypes.BackHealthCheckObserve:    "layer7",
+				ingtypes.BackHealthCheckErrorLimit: "5",
+				ingtypes.BackHealthCheckOnError:    "mark-down",
+			},
+			expected: hatypes.HealthCheck{
+				Observe:    "layer7",
+				ErrorLimit: 5,
+				OnError:    "mark-down",
+			},
+		},
+		// 3
+		{
+			ann: map[string]string{
+				ingtypes.BackHealthCheckObserve: "layer5",
+			},
+			expected: hatypes.HealthCheck{},
+			logging:  `WARN ignoring invalid health check observe mode on ingress 'default/ing1': layer5`,
+		},
+		// 4
+		{
+			ann: map[string]string{
+				ingtypes.BackHealthCheckObserve:    "layer4",
+				ingtypes.BackHealthCheckErrorLimit: "0",
+				ingtypes.BackHealthCheckOnError:    "eject",
+			},
+			expected: hatypes.HealthCheck{
+				Observe: "layer4",
+			},
+			logging: `
+WARN ignoring invalid health check error limit on ingress 'default/ing1': 0
+WARN ignoring invalid health check on-error action on ingress 'default/ing1': eject`,
+		},
+		// 5
+		{
+			ann: map[string]string{
+				ingtypes.BackHealthCheckObserve: "layer7",
+			},
+			modeTCP:  true,
+			expected: hatypes.HealthCheck{},
+			logging:  `WARN ignoring layer7 health check observe mode on TCP backend ingress 'default/ing1'`,
+		},
+		// 6
+		{
+			ann: map[string]string{
+				ingtypes.BackHealthCheckObserve: "layer4",
+				ingtypes.BackHealthCheckOnError: "fastinter",
+			},
+			modeTCP: true,
+			expected: hatypes.HealthCheck{
+				Observe: "layer4",
+				OnError: "fastinter",
+			},
+		},
+	}
+	source := &Source{Namespace: "default", Name: "ing1", Type: "ingress"}
+	for i, test := range testCase {
+		c := setup(t)
+		d := c.createBackendData("default/app", source, test.ann, map[string]string{})
+		d.backend.ModeTCP = test.modeTCP
+		c.createUpdater().buildBackendHealthCheckObserve(d)
+		c.compareObjects("health check observe", i, d.backend.HealthCheck, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestHSTS(t *testing.T) {
+	testCases := []struct {
+		paths      []string
+		source     Source
+		annDefault map[string]string
+		ann        map[string]map[string]string
+		expected   map[string]hatypes.HSTS
+		logging    string
+	}{
+		// 0
+		{
+			paths: []string{"/", "/url"},
+			annDefault: map[string]string{
+				ingtypes.BackHSTS:       "true",
+				ingtypes.BackHSTSMaxAge: "15768000",
+			},
+			ann: map[string]map[string]string{
+				"/": {},
+				"/url": {
+					ingtypes.BackHSTSMaxAge:  "50",
+					ingtypes.BackHSTSPreload: "true",
+				},
+			},
+			expected: map[string]hatypes.HSTS{
+				"/": {
+					Enabled:    true,
+					MaxAge:     15768000,
+					Subdomains: false,
+					Preload:    false,
+				},
+				"/url": {
+					Enabled:    true,
+					MaxAge:     50,
+					Subdomains: false,
+					Preload:    true,
+				},
+			},
+		},
+		// 1
+		{
+			paths: []string{"/"},
+			annDefault: map[string]string{
+				ingtypes.BackHSTS:       "true",
+				ingtypes.BackHSTSMaxAge: "15768000",
+			},
+			ann: map[string]map[string]string{
+				"/": {
+					ingtypes.BackHSTSMaxAge:            "50",
+					ingtypes.BackHSTSPreload:           "not-valid-bool",
+					ingtypes.BackHSTSIncludeSubdomains: "true",
+				},
+			},
+			expected: map[string]hatypes.HSTS{
+				"/": {
+					Enabled:    true,
+					MaxAge:     50,
+					Subdomains: true,
+					Preload:    false,
+				},
+			},
+			source:  Source{Namespace: "default", Name: "ing1", Type: "ingress"},
+			logging: `WARN ignoring invalid bool expression on ingress 'default/ing1' key 'hsts-preload': not-valid-bool`,
+		},
+		// 2
+		{
+			paths: []string{"/"},
+			expected: map[string]hatypes.HSTS{
 				"/": {},
-				"/sub": {
-					Enabled:          true,
-					AllowCredentials: false,
-					AllowHeaders:     corsDefaultHeaders,
-					AllowMethods:     corsDefaultMethods,
-					AllowOrigin:      corsDefaultOrigin,
-					ExposeHeaders:    "",
-					MaxAge:           corsDefaultMaxAge,
-				},
 			},
 		},
 	}
-	annDefault := map[string]string{
-		ingtypes.BackCorsAllowHeaders: corsDefaultHeaders,
-		ingtypes.BackCorsAllowMethods: corsDefaultMethods,
-		ingtypes.BackCorsAllowOrigin:  corsDefaultOrigin,
-		ingtypes.BackCorsMaxAge:       strconv.Itoa(corsDefaultMaxAge),
-	}
 	for i, test := range testCases {
 		c := setup(t)
-		d := c.createBackendMappingData("default/app", &Source{}, annDefault, test.ann, test.paths)
-		c.createUpdater().buildBackendCors(d)
-		actual := map[string]hatypes.Cors{}
+		d := c.createBackendMappingData("default/app", &test.source, test.annDefault, test.ann, test.paths)
+		u := c.createUpdater()
+		u.buildBackendHSTS(d)
+		actual := map[string]hatypes.HSTS{}
 		for _, path := range d.backend.Paths {
-			actual[path.Path()] = path.Cors
+			actual[path.Path()] = path.HSTS
 		}
-		c.compareObjects("cors", i, actual, test.expected)
+		c.compareObjects("hsts", i, actual, test.expected)
 		c.logger.CompareLogging(test.logging)
 		c.teardown()
 	}
 }
 
-func TestHeaders(t *testing.T) {
+func TestLimit(t *testing.T) {
+	defaultAnn := map[string]string{
+		ingtypes.BackLimitConnectionsAction: "deny",
+		ingtypes.BackLimitKey:               "src",
+		ingtypes.BackLimitTableExpire:       "5m",
+		ingtypes.BackLimitTableSize:         "200k",
+	}
 	testCases := []struct {
-		headers  string
-		expected []*hatypes.BackendHeader
+		ann      map[string]string
+		expected hatypes.BackendLimit
 		logging  string
 	}{
 		// 0
 		{
-			headers: `invalid`,
-			logging: `WARN ignored missing header name or value on ingress 'ing1/app': invalid`,
+			ann: map[string]string{},
 		},
 		// 1
 		{
-			headers: `key value`,
-			expected: []*hatypes.BackendHeader{
-				{Name: "key", Value: "value"},
+			ann: map[string]string{
+				ingtypes.BackLimitConnections: "10",
+			},
+			expected: hatypes.BackendLimit{
+				Connections: 10,
+				Key:         "src",
+				TableExpire: "5m",
+				TableSize:   "200k",
 			},
 		},
 		// 2
 		{
-			headers: `name: content`,
-			expected: []*hatypes.BackendHeader{
-				{Name: "name", Value: "content"},
+			ann: map[string]string{
+				ingtypes.BackLimitConnections:       "10",
+				ingtypes.BackLimitConnectionsAction: "queue",
+				ingtypes.BackLimitKey:               "hdr(X-Api-Key)",
+				ingtypes.BackLimitTableExpire:       "1h",
+				ingtypes.BackLimitTableSize:         "1m",
+			},
+			expected: hatypes.BackendLimit{
+				Connections:      10,
+				ConnectionsQueue: true,
+				Key:              "req.hdr(X-Api-Key)",
+				TableExpire:      "1h",
+				TableSize:        "1m",
 			},
 		},
 		// 3
 		{
-			headers: `k:v`,
-			expected: []*hatypes.BackendHeader{
-				{Name: "k", Value: "v"},
+			ann: map[string]string{
+				ingtypes.BackLimitRPS:               "20",
+				ingtypes.BackLimitConnectionsAction: "queue",
 			},
-		},
-		// 4
-		{
-			headers: `host: %[service].%[namespace].svc.cluster.local`,
-			expected: []*hatypes.BackendHeader{
-				{Name: "host", Value: "app.default.svc.cluster.local"},
+			expected: hatypes.BackendLimit{
+				RPS:         20,
+				Key:         "src",
+				TableExpire: "5m",
+				TableSize:   "200k",
 			},
 		},
-		// 5
+		// 4
 		{
-			headers: `
-k8snamespace: %[namespace]
-k8sservice: %[service]
-host: %[service].%[namespace].svc.cluster.local
-`,
-			expected: []*hatypes.BackendHeader{
-				{Name: "k8snamespace", Value: "default"},
-				{Name: "k8sservice", Value: "app"},
-				{Name: "host", Value: "app.default.svc.cluster.local"},
+			ann: map[string]string{
+				ingtypes.BackLimitConnections:       "10",
+				ingtypes.BackLimitConnectionsAction: "drop",
+				ingtypes.BackLimitKey:               "cookie(session)",
+				ingtypes.BackLimitTableExpire:       "1",
+				ingtypes.BackLimitTableSize:         "1t",
+			},
+			expected: hatypes.BackendLimit{
+				Connections: 10,
+				Key:         "src",
+				TableExpire: "5m",
+				TableSize:   "200k",
 			},
+			logging: `
+WARN ignoring invalid limit key on ingress 'default/ing1', using 'src': cookie(session)
+WARN ignoring invalid limit table size on ingress 'default/ing1', using '200k': 1t
+WARN ignoring invalid time format on ingress 'default/ing1': 1
+WARN ignoring invalid limit connections action on ingress 'default/ing1', using 'deny': drop`,
 		},
 	}
 	source := &Source{
-		Namespace: "ing1",
-		Name:      "app",
+		Namespace: "default",
+		Name:      "ing1",
 		Type:      "ingress",
 	}
 	for i, test := range testCases {
 		c := setup(t)
-		ann := map[string]map[string]string{
-			"/": {ingtypes.BackHeaders: test.headers},
-		}
-		d := c.createBackendMappingData("default/app", source, map[string]string{}, ann, []string{"/"})
-		c.createUpdater().buildBackendHeaders(d)
-		c.compareObjects("headers", i, d.backend.Headers, test.expected)
+		d := c.createBackendData("default/app", source, test.ann, defaultAnn)
+		c.createUpdater().buildBackendLimit(d)
+		c.compareObjects("limit", i, d.backend.Limit, test.expected)
 		c.logger.CompareLogging(test.logging)
 		c.teardown()
 	}
 }
 
-func TestHSTS(t *testing.T) {
+func TestSecurityHeaders(t *testing.T) {
 	testCases := []struct {
 		paths      []string
-		source     Source
 		annDefault map[string]string
 		ann        map[string]map[string]string
-		expected   map[string]hatypes.HSTS
+		expected   map[string]hatypes.SecurityHeaders
 		logging    string
 	}{
 		// 0
+		{
+			paths: []string{"/"},
+			expected: map[string]hatypes.SecurityHeaders{
+				"/": {},
+			},
+		},
+		// 1
 		{
 			paths: []string{"/", "/url"},
 			annDefault: map[string]string{
-				ingtypes.BackHSTS:       "true",
-				ingtypes.BackHSTSMaxAge: "15768000",
+				ingtypes.BackXFrameOptions:  "DENY",
+				ingtypes.BackReferrerPolicy: "no-referrer",
 			},
 			ann: map[string]map[string]string{
 				"/": {},
 				"/url": {
-					ingtypes.BackHSTSMaxAge:  "50",
-					ingtypes.BackHSTSPreload: "true",
+					ingtypes.BackXFrameOptions:         "sameorigin",
+					ingtypes.BackContentSecurityPolicy: "default-src 'self';\n  img-src *",
+					ingtypes.BackReferrerPolicy:        "no-referrer,strict-origin-when-cross-origin",
 				},
 			},
-			expected: map[string]hatypes.HSTS{
+			expected: map[string]hatypes.SecurityHeaders{
 				"/": {
-					Enabled:    true,
-					MaxAge:     15768000,
-					Subdomains: false,
-					Preload:    false,
+					FrameOptions:   "DENY",
+					ReferrerPolicy: "no-referrer",
 				},
 				"/url": {
-					Enabled:    true,
-					MaxAge:     50,
-					Subdomains: false,
-					Preload:    true,
+					ContentSecurityPolicy: "default-src 'self'; img-src *",
+					FrameOptions:          "SAMEORIGIN",
+					ReferrerPolicy:        "no-referrer, strict-origin-when-cross-origin",
 				},
 			},
 		},
-		// 1
+		// 2
 		{
 			paths: []string{"/"},
 			annDefault: map[string]string{
-				ingtypes.BackHSTS:       "true",
-				ingtypes.BackHSTSMaxAge: "15768000",
+				ingtypes.BackXFrameOptions: "DENY",
 			},
 			ann: map[string]map[string]string{
 				"/": {
-					ingtypes.BackHSTSMaxAge:            "50",
-					ingtypes.BackHSTSPreload:           "not-valid-bool",
-					ingtypes.BackHSTSIncludeSubdomains: "true",
+					ingtypes.BackXFrameOptions: "ALLOW-FROM https://app.local",
 				},
 			},
-			expected: map[string]hatypes.HSTS{
+			expected: map[string]hatypes.SecurityHeaders{
 				"/": {
-					Enabled:    true,
-					MaxAge:     50,
-					Subdomains: true,
-					Preload:    false,
+					FrameOptions: "DENY",
 				},
 			},
-			source:  Source{Namespace: "default", Name: "ing1", Type: "ingress"},
-			logging: `WARN ignoring invalid bool expression on ingress 'default/ing1' key 'hsts-preload': not-valid-bool`,
+			logging: `WARN ignoring invalid frame options on ingress 'default/ing1': ALLOW-FROM https://app.local`,
 		},
-		// 2
+		// 3
 		{
 			paths: []string{"/"},
-			expected: map[string]hatypes.HSTS{
+			ann: map[string]map[string]string{
+				"/": {
+					ingtypes.BackContentSecurityPolicy: `default-src "self"`,
+				},
+			},
+			expected: map[string]hatypes.SecurityHeaders{
+				"/": {},
+			},
+			logging: `WARN ignoring invalid content security policy on ingress 'default/ing1': default-src "self"`,
+		},
+		// 4
+		{
+			paths: []string{"/"},
+			ann: map[string]map[string]string{
+				"/": {
+					ingtypes.BackReferrerPolicy: "no-referrer,none",
+				},
+			},
+			expected: map[string]hatypes.SecurityHeaders{
 				"/": {},
 			},
+			logging: `WARN ignoring invalid referrer policy on ingress 'default/ing1': no-referrer,none`,
+		},
+		// 5
+		{
+			paths: []string{"/"},
+			ann: map[string]map[string]string{
+				"/": {
+					ingtypes.BackContentSecurityPolicy: "script-src 'self' https://cdn.local/%7Eapp/",
+				},
+			},
+			expected: map[string]hatypes.SecurityHeaders{
+				"/": {
+					ContentSecurityPolicy: "script-src 'self' https://cdn.local/%%7Eapp/",
+				},
+			},
 		},
 	}
+	source := &Source{Namespace: "default", Name: "ing1", Type: "ingress"}
 	for i, test := range testCases {
 		c := setup(t)
-		d := c.createBackendMappingData("default/app", &test.source, test.annDefault, test.ann, test.paths)
+		d := c.createBackendMappingData("default/app", source, test.annDefault, test.ann, test.paths)
 		u := c.createUpdater()
-		u.buildBackendHSTS(d)
-		actual := map[string]hatypes.HSTS{}
+		u.buildBackendSecurityHeaders(d)
+		actual := map[string]hatypes.SecurityHeaders{}
 		for _, path := range d.backend.Paths {
-			actual[path.Path()] = path.HSTS
+			actual[path.Path()] = path.SecurityHeaders
 		}
-		c.compareObjects("hsts", i, actual, test.expected)
+		c.compareObjects("security headers", i, actual, test.expected)
 		c.logger.CompareLogging(test.logging)
 		c.teardown()
 	}
@@ -1537,34 +2854,162 @@ func TestOAuth(t *testing.T) {
 				"/":    {},
 				"/app": {},
 			},
-			logging: `WARN ignoring oauth configuration on ingress 'default/ing1': auth-url was configured and has precedence`,
+			logging: `WARN ignoring oauth configuration on ingress 'default/ing1': auth-url was configured and has precedence`,
+		},
+	}
+
+	source := &Source{
+		Namespace: "default",
+		Name:      "ing1",
+		Type:      "ingress",
+	}
+	annDefault := map[string]string{ingtypes.BackOAuthHeaders: "X-Auth-Request-Email:req.auth_response_header.x_auth_request_email"}
+	for i, test := range testCases {
+		c := setup(t)
+		d := c.createBackendMappingData("default/app", source, annDefault, test.ann, []string{})
+		if test.external {
+			c.haproxy.Global().External.MasterSocket = "/tmp/master.sock"
+		}
+		c.haproxy.Global().External.HasLua = test.haslua
+		if test.backend != "" {
+			b := strings.Split(test.backend, ":")
+			backend := c.haproxy.Backends().AcquireBackend(b[0], b[1], "8080")
+			c.haproxy.Hosts().AcquireHost("app.local").AddPath(backend, b[2], hatypes.MatchBegin)
+		}
+		c.createUpdater().buildBackendOAuth(d)
+		actual := map[string]hatypes.AuthExternal{}
+		for _, path := range d.backend.Paths {
+			actual[path.Path()] = path.AuthExternal
+		}
+		c.compareObjects("oauth", i, actual, test.authExp)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestProxyProtocol(t *testing.T) {
+	testCase := []struct {
+		proxyProt string
+		modeTCP   bool
+		expected  string
+		logging   string
+	}{
+		// 0
+		{
+			proxyProt: "",
+			expected:  "",
+		},
+		// 1
+		{
+			proxyProt: "no",
+			expected:  "",
+		},
+		// 2
+		{
+			proxyProt: "v1",
+			expected:  "send-proxy",
+		},
+		// 3
+		{
+			proxyProt: "v2",
+			expected:  "send-proxy-v2",
+		},
+		// 4
+		{
+			proxyProt: "v2-ssl",
+			expected:  "send-proxy-v2-ssl",
+		},
+		// 5
+		{
+			proxyProt: "v2-ssl-cn",
+			expected:  "send-proxy-v2-ssl-cn",
+		},
+		// 6
+		{
+			proxyProt: "v2-ssl",
+			modeTCP:   true,
+			expected:  "send-proxy-v2",
+			logging:   `WARN using proxy protocol v2 without ssl info on ingress 'default/ing1' due to ssl-passthrough`,
+		},
+		// 7
+		{
+			proxyProt: "v1",
+			modeTCP:   true,
+			expected:  "send-proxy",
+		},
+		// 8
+		{
+			proxyProt: "v3",
+			expected:  "",
+			logging:   `WARN ignoring invalid proxy protocol version on ingress 'default/ing1': v3`,
+		},
+	}
+	source := &Source{Namespace: "default", Name: "ing1", Type: "ingress"}
+	for i, test := range testCase {
+		c := setup(t)
+		ann := map[string]string{ingtypes.BackProxyProtocol: test.proxyProt}
+		d := c.createBackendData("default/app", source, ann, map[string]string{})
+		d.backend.ModeTCP = test.modeTCP
+		c.createUpdater().buildBackendProxyProtocol(d)
+		c.compareObjects("proxy protocol", i, d.backend.Server.SendProxy, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestRequestBuffer(t *testing.T) {
+	testCases := []struct {
+		ann           map[string]string
+		expBuffer     bool
+		expHeaderSize int64
+		logging       string
+	}{
+		// 0
+		{
+			ann: map[string]string{},
+		},
+		// 1
+		{
+			ann: map[string]string{
+				ingtypes.BackProxyRequestBuffering: "true",
+			},
+			expBuffer: true,
+		},
+		// 2
+		{
+			ann: map[string]string{
+				ingtypes.BackProxyHeaderSize: "8k",
+			},
+			expHeaderSize: 8192,
+		},
+		// 3
+		{
+			ann: map[string]string{
+				ingtypes.BackProxyHeaderSize: "unlimited",
+			},
+		},
+		// 4
+		{
+			ann: map[string]string{
+				ingtypes.BackProxyHeaderSize: "8x",
+			},
+			logging: `WARN ignoring invalid header size on ingress 'default/ing1': 8x`,
+		},
+		// 5
+		{
+			ann: map[string]string{
+				ingtypes.BackProxyHeaderSize: "-1",
+			},
+			logging: `WARN ignoring invalid header size on ingress 'default/ing1': -1`,
 		},
 	}
-
-	source := &Source{
-		Namespace: "default",
-		Name:      "ing1",
-		Type:      "ingress",
-	}
-	annDefault := map[string]string{ingtypes.BackOAuthHeaders: "X-Auth-Request-Email:req.auth_response_header.x_auth_request_email"}
+	source := &Source{Namespace: "default", Name: "ing1", Type: "ingress"}
 	for i, test := range testCases {
 		c := setup(t)
-		d := c.createBackendMappingData("default/app", source, annDefault, test.ann, []string{})
-		if test.external {
-			c.haproxy.Global().External.MasterSocket = "/tmp/master.sock"
-		}
-		c.haproxy.Global().External.HasLua = test.haslua
-		if test.backend != "" {
-			b := strings.Split(test.backend, ":")
-			backend := c.haproxy.Backends().AcquireBackend(b[0], b[1], "8080")
-			c.haproxy.Hosts().AcquireHost("app.local").AddPath(backend, b[2], hatypes.MatchBegin)
-		}
-		c.createUpdater().buildBackendOAuth(d)
-		actual := map[string]hatypes.AuthExternal{}
-		for _, path := range d.backend.Paths {
-			actual[path.Path()] = path.AuthExternal
-		}
-		c.compareObjects("oauth", i, actual, test.authExp)
+		d := c.createBackendData("default/app", source, test.ann, map[string]string{})
+		c.createUpdater().buildBackendRequestBuffer(d)
+		c.compareObjects("buffer request", i, d.backend.BufferRequest, test.expBuffer)
+		c.compareObjects("header size", i, d.backend.MaxHeaderSize, test.expHeaderSize)
 		c.logger.CompareLogging(test.logging)
 		c.teardown()
 	}
@@ -1617,6 +3062,117 @@ func TestRewriteURL(t *testing.T) {
 	}
 }
 
+func TestRewriteResponse(t *testing.T) {
+	testCases := []struct {
+		hostname string
+		path     string
+		rewrite  string
+		headers  string
+		expected []*hatypes.RewriteHeader
+		logging  string
+	}{
+		// 0
+		{
+			path:    "/app",
+			rewrite: "/",
+		},
+		// 1
+		{
+			path:    "/app",
+			headers: "location",
+		},
+		// 2
+		{
+			path:    "/app/",
+			rewrite: "/app",
+			headers: "location,set-cookie",
+		},
+		// 3
+		{
+			path:    "/app",
+			rewrite: "/",
+			headers: "location",
+			expected: []*hatypes.RewriteHeader{
+				{Name: "Location", Regex: `^(https?://d1\.local(:[0-9]+)?)?(/.*)?$`, Replace: `\1/app\3`},
+			},
+		},
+		// 4
+		{
+			path:    "/app",
+			rewrite: "/v1.0/",
+			headers: "set-cookie, location",
+			expected: []*hatypes.RewriteHeader{
+				{Name: "Location", Regex: `^(https?://d1\.local(:[0-9]+)?)?/v1\.0(/.*)?$`, Replace: `\1/app\3`},
+				{Name: "Set-Cookie", Regex: `^(.*;\s*[Pp]ath=)/v1\.0(/[^;]*)?(;.*)?$`, Replace: `\1/app\2\3`},
+			},
+		},
+		// 5
+		{
+			path:    "/",
+			rewrite: "/api",
+			headers: "location,set-cookie",
+			expected: []*hatypes.RewriteHeader{
+				{Name: "Location", Regex: `^(https?://d1\.local(:[0-9]+)?)?/api$`, Replace: `\1/`},
+				{Name: "Location", Regex: `^(https?://d1\.local(:[0-9]+)?)?/api(/.*)?$`, Replace: `\1\3`},
+				{Name: "Set-Cookie", Regex: `^(.*;\s*[Pp]ath=)/api(;.*)?$`, Replace: `\1/\2`},
+				{Name: "Set-Cookie", Regex: `^(.*;\s*[Pp]ath=)/api(/[^;]*)?(;.*)?$`, Replace: `\1\2\3`},
+			},
+		},
+		// 6
+		{
+			hostname: "*.d1.local",
+			path:     "/app",
+			rewrite:  "/",
+			headers:  "location",
+			expected: []*hatypes.RewriteHeader{
+				{Name: "Location", Regex: `^(https?://[^./]+\.d1\.local(:[0-9]+)?)?(/.*)?$`, Replace: `\1/app\3`},
+			},
+		},
+		// 7
+		{
+			hostname: hatypes.DefaultHost,
+			path:     "/app",
+			rewrite:  "/",
+			headers:  "location",
+			expected: []*hatypes.RewriteHeader{
+				{Name: "Location", Regex: `^()(/.*)?$`, Replace: `\1/app\2`},
+			},
+		},
+		// 8
+		{
+			path:    "/app",
+			rewrite: "/",
+			headers: "location,content-location",
+			expected: []*hatypes.RewriteHeader{
+				{Name: "Location", Regex: `^(https?://d1\.local(:[0-9]+)?)?(/.*)?$`, Replace: `\1/app\3`},
+			},
+			logging: `WARN ignoring invalid rewrite target response header on ingress 'default/ing1': content-location`,
+		},
+	}
+	source := &Source{Namespace: "default", Name: "ing1", Type: "ingress"}
+	for i, test := range testCases {
+		c := setup(t)
+		hostname := test.hostname
+		if hostname == "" {
+			hostname = "d1.local"
+		}
+		ann := map[string]string{}
+		if test.rewrite != "" {
+			ann[ingtypes.BackRewriteTarget] = test.rewrite
+		}
+		if test.headers != "" {
+			ann[ingtypes.BackRewriteTargetResponse] = test.headers
+		}
+		d := c.createBackendData("default/app", source, map[string]string{}, map[string]string{})
+		d.backend.AddBackendPath(hatypes.CreatePathLink(hostname, test.path))
+		d.mapper.AddAnnotations(source, hatypes.CreatePathLink(hostname, test.path), ann)
+		c.createUpdater().buildBackendRewriteURL(d)
+		c.compareObjects("rewrite response", i, d.backend.Paths[0].RewriteResponse, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
 func TestBackendServerNaming(t *testing.T) {
 	testCases := []struct {
 		source  Source
@@ -1659,6 +3215,82 @@ func TestBackendServerNaming(t *testing.T) {
 	}
 }
 
+func TestBackendIPFamily(t *testing.T) {
+	testCases := []struct {
+		source  Source
+		family  string
+		logging string
+	}{
+		// 0
+		{
+			family: "",
+		},
+		// 1
+		{
+			family: "ipv4",
+		},
+		// 2
+		{
+			family: "ipv6",
+		},
+		// 3
+		{
+			source: Source{
+				Namespace: "default",
+				Name:      "ing1",
+				Type:      "ingress",
+			},
+			family:  "dual",
+			logging: "WARN ignoring invalid IP family 'dual' on ingress 'default/ing1'",
+		},
+	}
+	for _, test := range testCases {
+		c := setup(t)
+		d := c.createBackendData("default/app", &test.source, map[string]string{ingtypes.BackBackendIPFamily: test.family}, map[string]string{})
+		c.createUpdater().buildBackendIPFamily(d)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestBackendTrafficPolicy(t *testing.T) {
+	testCases := []struct {
+		source  Source
+		policy  string
+		logging string
+	}{
+		// 0
+		{
+			policy: "cluster",
+		},
+		// 1
+		{
+			policy: "local",
+		},
+		// 2
+		{
+			policy: "prefer-local",
+		},
+		// 3
+		{
+			source: Source{
+				Namespace: "default",
+				Name:      "ing1",
+				Type:      "ingress",
+			},
+			policy:  "zone",
+			logging: "WARN ignoring invalid traffic policy 'zone' on ingress 'default/ing1', using 'cluster' instead",
+		},
+	}
+	for _, test := range testCases {
+		c := setup(t)
+		d := c.createBackendData("default/app", &test.source, map[string]string{ingtypes.BackTrafficPolicy: test.policy}, map[string]string{})
+		c.createUpdater().buildBackendTrafficPolicy(d)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
 func TestBackendProtocol(t *testing.T) {
 	testCase := []struct {
 		source     Source
@@ -1928,17 +3560,189 @@ WARN skipping CA on service 'default/app1': secret not found: 'default/ca'`,
 				Secure:   true,
 				Protocol: "h1",
 			},
-			logging: `WARN skipping invalid domain (verify-hostname) on ingress 'default/app': invalid/domain`,
+			logging: `WARN skipping invalid domain (verify-hostname) on ingress 'default/app': invalid/domain`,
+		},
+		// 18
+		{
+			ann: map[string]map[string]string{
+				"/": {
+					ingtypes.BackSecureBackends:       "true",
+					ingtypes.BackSecureVerify:         "required",
+					ingtypes.BackSecureVerifyCASecret: "configmap://ingress/trust-store",
+				},
+			},
+			caSecrets: map[string]string{"ingress/trust-store": "/var/haproxy/ssl/ca_configmap_ingress_trust-store.pem"},
+			expected: hatypes.ServerConfig{
+				Protocol:   "h1",
+				Secure:     true,
+				CAFilename: "/var/haproxy/ssl/ca_configmap_ingress_trust-store.pem",
+				CAHash:     "668570e630b28587ffc2c084e0f069bdf15fb6e5",
+			},
+		},
+		// 19
+		{
+			annDefault: map[string]string{
+				ingtypes.BackSecureVerifyCASecret: "configmap://ingress/trust-store",
+			},
+			ann: map[string]map[string]string{
+				"/": {
+					ingtypes.BackSecureBackends: "true",
+					ingtypes.BackSecureSNI:      "host",
+					ingtypes.BackSecureVerify:   "none",
+				},
+			},
+			caSecrets: map[string]string{"ingress/trust-store": "/var/haproxy/ssl/ca_configmap_ingress_trust-store.pem"},
+			expected: hatypes.ServerConfig{
+				Protocol: "h1",
+				Secure:   true,
+				SNI:      "var(req.host)",
+			},
+		},
+		// 20
+		{
+			source: Source{Namespace: "default", Name: "app", Type: "ingress"},
+			ann: map[string]map[string]string{
+				"/": {
+					ingtypes.BackSecureBackends:       "true",
+					ingtypes.BackSecureVerify:         "optional",
+					ingtypes.BackSecureVerifyCASecret: "ca",
+				},
+			},
+			caSecrets: map[string]string{"default/ca": "/var/haproxy/ssl/ca_default_ca.pem"},
+			expected: hatypes.ServerConfig{
+				Protocol:   "h1",
+				Secure:     true,
+				CAFilename: "/var/haproxy/ssl/ca_default_ca.pem",
+				CAHash:     "2833dcaf6ff64e2f19753cb552ceeda67f4584ae",
+			},
+			logging: `WARN ignoring invalid secure-verify option on ingress 'default/app', using 'required': optional`,
+		},
+	}
+	for i, test := range testCase {
+		c := setup(t)
+		d := c.createBackendMappingData("defualt/app", &test.source, test.annDefault, test.ann, test.paths)
+		c.haproxy.Global().UseHTX = test.useHTX
+		c.cache.SecretTLSPath = test.tlsSecrets
+		c.cache.SecretCAPath = test.caSecrets
+		c.createUpdater().buildBackendProtocol(d)
+		c.compareObjects("secure", i, d.backend.Server, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestBackendSPOEAgents(t *testing.T) {
+	testCases := []struct {
+		ann      map[string]string
+		expected []string
+		logging  string
+	}{
+		// 0
+		{},
+		// 1
+		{
+			ann:      map[string]string{ingtypes.BackSPOEAgents: "authz"},
+			expected: []string{"authz"},
+		},
+		// 2
+		{
+			ann:      map[string]string{ingtypes.BackSPOEAgents: "waf, authz"},
+			expected: []string{"waf", "authz"},
+		},
+		// 3
+		{
+			ann:      map[string]string{ingtypes.BackSPOEAgents: "authz,modsecurity"},
+			expected: []string{"authz"},
+			logging:  `WARN ignoring SPOE agent 'modsecurity' on ingress 'default/ing1': agent not found`,
+		},
+	}
+	source := &Source{Namespace: "default", Name: "ing1", Type: "ingress"}
+	for i, test := range testCases {
+		c := setup(t)
+		c.haproxy.Global().SPOEAgents = []*hatypes.SPOEAgent{{Name: "authz"}, {Name: "waf"}}
+		d := c.createBackendData("default/app", source, test.ann, map[string]string{})
+		c.createUpdater().buildBackendSPOEAgents(d)
+		c.compareObjects("spoe agents", i, d.backend.SPOEAgents, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestBackendSource(t *testing.T) {
+	testCases := []struct {
+		ann      map[string]string
+		expected hatypes.BackendSource
+		logging  string
+	}{
+		// 0
+		{},
+		// 1
+		{
+			ann: map[string]string{
+				ingtypes.BackBackendSourceAddress: "10.0.0.10",
+			},
+			expected: hatypes.BackendSource{Address: "10.0.0.10"},
+		},
+		// 2
+		{
+			ann: map[string]string{
+				ingtypes.BackBackendSourceAddress:   "192.168.1.10",
+				ingtypes.BackBackendSourceInterface: "eth1",
+			},
+			expected: hatypes.BackendSource{Address: "192.168.1.10", Interface: "eth1"},
+		},
+		// 3
+		{
+			ann: map[string]string{
+				ingtypes.BackBackendSourceInterface: "eth1",
+			},
+			expected: hatypes.BackendSource{Address: "0.0.0.0", Interface: "eth1"},
+		},
+		// 4
+		{
+			ann: map[string]string{
+				ingtypes.BackBackendIPFamily:        "ipv6",
+				ingtypes.BackBackendSourceInterface: "eth1",
+			},
+			expected: hatypes.BackendSource{Address: "::", Interface: "eth1"},
+		},
+		// 5
+		{
+			ann: map[string]string{
+				ingtypes.BackBackendSourceAddress: "fd00::10",
+			},
+			expected: hatypes.BackendSource{Address: "fd00::10"},
+		},
+		// 6
+		{
+			ann: map[string]string{
+				ingtypes.BackBackendSourceAddress:   "10.0.1.10",
+				ingtypes.BackBackendSourceInterface: "eth0",
+			},
+			logging: `
+WARN ignoring backend source address on ingress 'default/ing1': address not allowed: 10.0.1.10
+WARN ignoring backend source interface on ingress 'default/ing1': interface not allowed: eth0`,
+		},
+		// 7
+		{
+			ann: map[string]string{
+				ingtypes.BackBackendSourceAddress:   "10.0.0.300",
+				ingtypes.BackBackendSourceInterface: "eth1",
+			},
+			expected: hatypes.BackendSource{Address: "0.0.0.0", Interface: "eth1"},
+			logging:  `WARN ignoring invalid backend source address on ingress 'default/ing1': 10.0.0.300`,
 		},
 	}
-	for i, test := range testCase {
+	source := &Source{Namespace: "default", Name: "ing1", Type: "ingress"}
+	for i, test := range testCases {
 		c := setup(t)
-		d := c.createBackendMappingData("defualt/app", &test.source, test.annDefault, test.ann, test.paths)
-		c.haproxy.Global().UseHTX = test.useHTX
-		c.cache.SecretTLSPath = test.tlsSecrets
-		c.cache.SecretCAPath = test.caSecrets
-		c.createUpdater().buildBackendProtocol(d)
-		c.compareObjects("secure", i, d.backend.Server, test.expected)
+		c.haproxy.Global().SourceAllowlist = hatypes.SourceAllowlistConfig{
+			CIDR:       []string{"10.0.0.0/24", "192.168.1.10", "fd00::/64"},
+			Interfaces: []string{"eth1"},
+		}
+		d := c.createBackendData("default/app", source, test.ann, map[string]string{})
+		c.createUpdater().buildBackendSource(d)
+		c.compareObjects("backend source", i, d.backend.Source, test.expected)
 		c.logger.CompareLogging(test.logging)
 		c.teardown()
 	}
@@ -1946,12 +3750,14 @@ WARN skipping CA on service 'default/app1': secret not found: 'default/ca'`,
 
 func TestSSLRedirect(t *testing.T) {
 	testCases := []struct {
-		annDefault map[string]string
-		ann        map[string]map[string]string
-		addPaths   []string
-		expected   map[bool][]string
-		source     Source
-		logging    string
+		annDefault    map[string]string
+		ann           map[string]map[string]string
+		addPaths      []string
+		acme          hatypes.Acme
+		expected      map[bool][]string
+		expExceptions []string
+		source        Source
+		logging       string
 	}{
 		// 0
 		{
@@ -2032,11 +3838,91 @@ func TestSSLRedirect(t *testing.T) {
 				true:  {"/api"},
 			},
 		},
+		// 5
+		{
+			annDefault: map[string]string{
+				ingtypes.GlobalNoTLSRedirectLocations: "/.hidden",
+			},
+			ann: map[string]map[string]string{
+				"/": {
+					ingtypes.BackSSLRedirect: "true",
+				},
+				"/.well-known/acme-challenge/token1": {
+					ingtypes.BackSSLRedirect: "true",
+				},
+			},
+			expected: map[bool][]string{
+				false: {"/.well-known/acme-challenge/token1"},
+				true:  {"/"},
+			},
+		},
+		// 6
+		{
+			ann: map[string]map[string]string{
+				"/": {
+					ingtypes.BackSSLRedirect:           "true",
+					ingtypes.BackSSLRedirectExceptions: "/healthz, /status",
+				},
+				"/status/app": {
+					ingtypes.BackSSLRedirect: "true",
+				},
+			},
+			expected: map[bool][]string{
+				false: {"/status/app"},
+				true:  {"/"},
+			},
+			expExceptions: []string{"/healthz", "/status"},
+		},
+		// 7
+		{
+			ann: map[string]map[string]string{
+				"/": {
+					ingtypes.BackSSLRedirect:           "true",
+					ingtypes.BackSSLRedirectExceptions: "/healthz,status,/a b",
+				},
+			},
+			expected: map[bool][]string{
+				true: {"/"},
+			},
+			expExceptions: []string{"/healthz"},
+			source:        Source{Namespace: "default", Name: "ing1", Type: "ingress"},
+			logging: `
+WARN ignoring invalid ssl-redirect exception on ingress 'default/ing1': status
+WARN ignoring invalid ssl-redirect exception on ingress 'default/ing1': /a b`,
+		},
+		// 8
+		{
+			ann: map[string]map[string]string{
+				"/": {
+					ingtypes.BackSSLRedirect: "true",
+				},
+			},
+			acme: hatypes.Acme{Enabled: true, Prefix: "/.well-known/acme-challenge/"},
+			expected: map[bool][]string{
+				true: {"/"},
+			},
+		},
+		// 9
+		{
+			ann: map[string]map[string]string{
+				"/": {
+					ingtypes.BackSSLRedirect:           "true",
+					ingtypes.BackSSLRedirectExceptions: "/healthz",
+				},
+			},
+			acme: hatypes.Acme{Enabled: true, Shared: true, Prefix: "/.well-known/acme-challenge/"},
+			expected: map[bool][]string{
+				true: {"/"},
+			},
+			expExceptions: []string{"/healthz", "/.well-known/acme-challenge/"},
+		},
 	}
 	for i, test := range testCases {
 		c := setup(t)
+		c.haproxy.Global().Acme = test.acme
 		d := c.createBackendMappingData("default/app", &test.source, test.annDefault, test.ann, test.addPaths)
 		c.createUpdater().buildBackendSSLRedirect(d)
+		c.compareObjects("sslredirect exceptions", i, d.backend.SSLRedirectExceptions, test.expExceptions)
 		actual := map[bool][]string{}
 		for _, path := range d.backend.Paths {
 			actual[path.SSLRedirect] = append(actual[path.SSLRedirect], path.Path())
@@ -2103,6 +3989,204 @@ func TestTimeout(t *testing.T) {
 	}
 }
 
+func TestRetry(t *testing.T) {
+	testCase := []struct {
+		annDefault map[string]string
+		ann        map[string]string
+		expected   hatypes.BackendRetryConfig
+		logging    string
+	}{
+		// 0
+		{
+			ann: map[string]string{
+				ingtypes.BackRetries: "5",
+			},
+			expected: hatypes.BackendRetryConfig{
+				Retries: "5",
+			},
+		},
+		// 1
+		{
+			ann: map[string]string{
+				ingtypes.BackRetries: "0",
+			},
+			expected: hatypes.BackendRetryConfig{
+				Retries: "0",
+			},
+		},
+		// 2
+		{
+			ann: map[string]string{
+				ingtypes.BackRetries: "-1",
+			},
+			logging: `WARN ignoring invalid number of retries on ingress 'default/ing1': -1`,
+		},
+		// 3
+		{
+			ann: map[string]string{
+				ingtypes.BackRetryOn: "conn-failure, empty-response 503",
+			},
+			expected: hatypes.BackendRetryConfig{
+				RetryOn: "conn-failure empty-response 503",
+			},
+		},
+		// 4
+		{
+			ann: map[string]string{
+				ingtypes.BackRetryOn: "conn-failure,5xx",
+			},
+			expected: hatypes.BackendRetryConfig{
+				RetryOn: "conn-failure",
+			},
+			logging: `WARN ignoring invalid retry-on keyword on ingress 'default/ing1': 5xx`,
+		},
+		// 5
+		{
+			ann: map[string]string{
+				ingtypes.BackRedispatch: "false",
+			},
+			expected: hatypes.BackendRetryConfig{
+				RedispatchOverride: true,
+			},
+		},
+		// 6
+		{
+			ann: map[string]string{
+				ingtypes.BackRedispatch: "yes",
+			},
+			logging: `WARN ignoring invalid redispatch on ingress 'default/ing1': yes`,
+		},
+		// 7
+		{
+			annDefault: map[string]string{
+				ingtypes.BackRetries:    "5",
+				ingtypes.BackRedispatch: "false",
+			},
+			// use only if declared as svc/ing annotation, otherwise defaults to HAProxy's defaults section
+			expected: hatypes.BackendRetryConfig{},
+		},
+		// 8
+		{
+			ann: map[string]string{
+				ingtypes.BackRedispatch: "true",
+			},
+			expected: hatypes.BackendRetryConfig{
+				Redispatch:         true,
+				RedispatchOverride: true,
+			},
+		},
+	}
+	source := &Source{Namespace: "default", Name: "ing1", Type: "ingress"}
+	for i, test := range testCase {
+		c := setup(t)
+		d := c.createBackendData("default/app", source, test.ann, test.annDefault)
+		c.createUpdater().buildBackendRetry(d)
+		c.compareObjects("backend retry", i, d.backend.Retry, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestBackendTracing(t *testing.T) {
+	global := hatypes.TracingConfig{
+		Mode:      "headers",
+		HeaderW3C: true,
+	}
+	testCase := []struct {
+		ann      map[string]string
+		modeTCP  bool
+		caps     *hatypes.Capabilities
+		expected hatypes.TracingConfig
+		logging  string
+	}{
+		// 0
+		{
+			ann:      map[string]string{},
+			expected: global,
+		},
+		// 1
+		{
+			ann: map[string]string{
+				ingtypes.BackTracingEnable: "false",
+			},
+			expected: hatypes.TracingConfig{},
+		},
+		// 2
+		{
+			ann:      map[string]string{},
+			modeTCP:  true,
+			expected: hatypes.TracingConfig{},
+		},
+		// 3
+		{
+			ann: map[string]string{
+				ingtypes.BackTracingHeaderFormat: "b3",
+			},
+			expected: hatypes.TracingConfig{
+				Mode:     "headers",
+				HeaderB3: true,
+			},
+		},
+		// 4
+		{
+			ann: map[string]string{
+				ingtypes.BackTracingMode: "none",
+			},
+			expected: hatypes.TracingConfig{},
+		},
+		// 5
+		{
+			ann: map[string]string{
+				ingtypes.BackTracingMode: "opentracing",
+			},
+			expected: hatypes.TracingConfig{
+				Mode:         "opentracing",
+				OTConfigFile: "/etc/haproxy/ot/ot.cfg",
+			},
+		},
+		// 6
+		{
+			ann: map[string]string{
+				ingtypes.BackTracingMode: "opentracing",
+			},
+			caps: &hatypes.Capabilities{Lua: true},
+			expected: hatypes.TracingConfig{
+				Mode:      "headers",
+				HeaderW3C: true,
+			},
+			logging: `WARN ignoring opentracing mode on ingress 'default/ing1': haproxy was built without OpenTracing support, using headers mode instead`,
+		},
+		// 7
+		{
+			ann: map[string]string{
+				ingtypes.BackTracingHeaderFormat: "jaeger",
+			},
+			expected: hatypes.TracingConfig{},
+			logging: `
+WARN ignoring invalid tracing header format on ingress 'default/ing1': jaeger
+WARN ignoring tracing config on ingress 'default/ing1' due to missing a valid header format`,
+		},
+	}
+	source := &Source{Namespace: "default", Name: "ing1", Type: "ingress"}
+	for i, test := range testCase {
+		c := setup(t)
+		c.haproxy.Global().Tracing = global
+		d := c.createBackendData("default/app", source, test.ann, map[string]string{
+			ingtypes.BackTracingEnable:         "true",
+			ingtypes.BackTracingHeaderFormat:   "w3c",
+			ingtypes.BackTracingMode:           "headers",
+			ingtypes.GlobalTracingOTConfigFile: "/etc/haproxy/ot/ot.cfg",
+		})
+		d.backend.ModeTCP = test.modeTCP
+		u := c.createUpdater()
+		u.options.Capabilities = test.caps
+		u.buildBackendTracing(d)
+		c.compareObjects("tracing", i, d.backend.Tracing, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
 func TestWAF(t *testing.T) {
 	testCase := []struct {
 		waf      string
@@ -2186,6 +4270,98 @@ func TestWAF(t *testing.T) {
 	}
 }
 
+func TestWebSocket(t *testing.T) {
+	testCases := []struct {
+		ann        map[string]string
+		expected   bool
+		expTimeout hatypes.BackendTimeoutConfig
+	}{
+		// 0
+		{
+			ann: map[string]string{},
+		},
+		// 1
+		{
+			ann: map[string]string{
+				ingtypes.BackWebSocket: "true",
+			},
+			expected:   true,
+			expTimeout: hatypes.BackendTimeoutConfig{Tunnel: "1h"},
+		},
+		// 2
+		{
+			ann: map[string]string{
+				ingtypes.BackWebSocket:     "true",
+				ingtypes.BackTimeoutTunnel: "10m",
+			},
+			expected:   true,
+			expTimeout: hatypes.BackendTimeoutConfig{Tunnel: "10m"},
+		},
+		// 3
+		{
+			ann: map[string]string{
+				ingtypes.BackWebSocket:     "false",
+				ingtypes.BackTimeoutTunnel: "10m",
+			},
+			expTimeout: hatypes.BackendTimeoutConfig{Tunnel: "10m"},
+		},
+	}
+	source := &Source{Namespace: "default", Name: "ing1", Type: "ingress"}
+	for i, test := range testCases {
+		c := setup(t)
+		d := c.createBackendData("default/app", source, test.ann, map[string]string{})
+		u := c.createUpdater()
+		u.buildBackendTimeout(d)
+		u.buildBackendWebSocket(d)
+		c.compareObjects("websocket", i, d.backend.WebSocket, test.expected)
+		c.compareObjects("websocket timeout", i, d.backend.Timeout, test.expTimeout)
+		c.teardown()
+	}
+}
+
+func TestAuthPassthrough(t *testing.T) {
+	testCases := []struct {
+		ann      map[string]string
+		modeTCP  bool
+		expected bool
+		logging  string
+	}{
+		// 0
+		{},
+		// 1
+		{
+			ann: map[string]string{
+				ingtypes.BackAuthPassthrough: "true",
+			},
+			expected: true,
+		},
+		// 2
+		{
+			ann: map[string]string{
+				ingtypes.BackAuthPassthrough: "false",
+			},
+		},
+		// 3
+		{
+			ann: map[string]string{
+				ingtypes.BackAuthPassthrough: "true",
+			},
+			modeTCP: true,
+			logging: `WARN ignoring auth-passthrough on ingress 'default/ing1': backend is already in tcp mode`,
+		},
+	}
+	source := &Source{Namespace: "default", Name: "ing1", Type: "ingress"}
+	for i, test := range testCases {
+		c := setup(t)
+		d := c.createBackendData("default/app", source, test.ann, map[string]string{})
+		d.backend.ModeTCP = test.modeTCP
+		c.createUpdater().buildBackendAuthPassthrough(d)
+		c.compareObjects("auth passthrough", i, d.backend.AuthPassthrough, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
 func TestWhitelistHTTP(t *testing.T) {
 	testCases := []struct {
 		paths       []string
@@ -18,11 +18,17 @@ package annotations
 
 import (
 	"fmt"
+	"net"
+	"net/http"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"gopkg.in/yaml.v2"
+	api "k8s.io/api/core/v1"
+
 	ingtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/types"
 	convtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/types"
 	hatypes "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/types"
@@ -48,7 +54,7 @@ func (c *updater) buildGlobalAcme(d *globalData) {
 	d.acmeData.Endpoint = endpoint
 	d.acmeData.Expiring = time.Duration(d.mapper.Get(ingtypes.GlobalAcmeExpiring).Int()) * 24 * time.Hour
 	d.acmeData.TermsAgreed = termsAgreed
-	d.global.Acme.Prefix = "/.well-known/acme-challenge/"
+	d.global.Acme.Prefix = acmeChallengePrefix
 	d.global.Acme.Socket = "/var/run/haproxy/acme.sock"
 	d.global.Acme.Enabled = true
 	d.global.Acme.Shared = d.mapper.Get(ingtypes.GlobalAcmeShared).Bool()
@@ -73,22 +79,108 @@ func (c *updater) buildGlobalAuthProxy(d *globalData) {
 }
 
 func (c *updater) buildGlobalBind(d *globalData) {
-	d.global.Bind.AcceptProxy = d.mapper.Get(ingtypes.GlobalUseProxyProtocol).Bool()
+	acceptProxy := d.mapper.Get(ingtypes.GlobalUseProxyProtocol).Bool()
+	d.global.Bind.HTTPAcceptProxy = readAcceptProxy(d, ingtypes.GlobalUseProxyProtocolHTTP, acceptProxy)
+	d.global.Bind.HTTPSAcceptProxy = readAcceptProxy(d, ingtypes.GlobalUseProxyProtocolHTTPS, acceptProxy)
+	d.global.Bind.FrontingAcceptProxy = acceptProxy
 	d.global.Bind.TCPBindIP = d.mapper.Get(ingtypes.GlobalBindIPAddrTCP).Value
+	if family := d.mapper.Get(ingtypes.GlobalBindIPFamily).Value; !bindIPFamilyRegex.MatchString(family) {
+		c.logger.Warn("ignoring invalid bind IP family '%s', using 'ipv4'", family)
+	}
 	if bindHTTP := d.mapper.Get(ingtypes.GlobalBindHTTP).Value; bindHTTP != "" {
 		d.global.Bind.HTTPBind = bindHTTP
 	} else {
-		ip := d.mapper.Get(ingtypes.GlobalBindIPAddrHTTP).Value
-		port := d.mapper.Get(ingtypes.GlobalHTTPPort).Int()
-		d.global.Bind.HTTPBind = fmt.Sprintf("%s:%d", ip, port)
+		d.global.Bind.HTTPBind = readBindAddr(d, d.mapper.Get(ingtypes.GlobalHTTPPort).Int())
 	}
 	if bindHTTPS := d.mapper.Get(ingtypes.GlobalBindHTTPS).Value; bindHTTPS != "" {
 		d.global.Bind.HTTPSBind = bindHTTPS
 	} else {
-		ip := d.mapper.Get(ingtypes.GlobalBindIPAddrHTTP).Value
-		port := d.mapper.Get(ingtypes.GlobalHTTPSPort).Int()
-		d.global.Bind.HTTPSBind = fmt.Sprintf("%s:%d", ip, port)
+		d.global.Bind.HTTPSBind = readBindAddr(d, d.mapper.Get(ingtypes.GlobalHTTPSPort).Int())
+	}
+	d.global.Bind.HTTPExtra = c.readBindExtra(d, ingtypes.GlobalBindHTTPExtra, false)
+	d.global.Bind.HTTPSExtra = c.readBindExtra(d, ingtypes.GlobalBindHTTPSExtra, true)
+}
+
+var bindIPFamilyRegex = regexp.MustCompile(`^(ipv4|ipv6|dual)?$`)
+
+// readBindAddr builds the address of a bind from bind-ip-addr-http and the
+// port. Binds on all the addresses, `*` or an empty IP, honor bind-ip-family:
+// `dual` listens on both IPv4 and IPv6 using a single IPv6 socket, and `ipv6`
+// listens on IPv6 only.
+func readBindAddr(d *globalData, port int) string {
+	ip := d.mapper.Get(ingtypes.GlobalBindIPAddrHTTP).Value
+	if ip == "" || ip == "*" {
+		switch d.mapper.Get(ingtypes.GlobalBindIPFamily).Value {
+		case "dual":
+			return fmt.Sprintf(":::%d v4v6", port)
+		case "ipv6":
+			return fmt.Sprintf(":::%d v6only", port)
+		}
+	}
+	return fmt.Sprintf("%s:%d", ip, port)
+}
+
+// readAcceptProxy reads the PROXY protocol config of a single bind,
+// using the global use-proxy-protocol config if not declared.
+func readAcceptProxy(d *globalData, key string, acceptProxy bool) bool {
+	if cfg := d.mapper.Get(key); cfg.Value != "" {
+		return cfg.Bool()
+	}
+	return acceptProxy
+}
+
+var sslMinVerRegex = regexp.MustCompile(`^(SSLv3|TLSv1\.[0-3])$`)
+
+// readBindExtra parses one additional bind per line: the address followed by
+// its options, eg `:8443 accept-proxy alpn=http/1.1 ssl-min-ver=TLSv1.2 thread=1-2`.
+// TLS related options are only valid on binds of the HTTPS frontend.
+func (c *updater) readBindExtra(d *globalData, key string, ssl bool) []*hatypes.BindExtraConfig {
+	var binds []*hatypes.BindExtraConfig
+	for _, line := range utils.LineToSlice(d.mapper.Get(key).Value) {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		bind := &hatypes.BindExtraConfig{Addr: fields[0]}
+		var invalid string
+		for _, opt := range fields[1:] {
+			name, value := opt, ""
+			if i := strings.Index(opt, "="); i >= 0 {
+				name, value = opt[:i], opt[i+1:]
+			}
+			switch {
+			case name == "accept-proxy" && value == "":
+				bind.AcceptProxy = true
+			case name == "internal" && value == "":
+				bind.Internal = true
+			case name == "tenant" && tenantNameRegex.MatchString(value):
+				bind.Tenant = value
+			case name == "thread" && value != "":
+				bind.Thread = value
+			case name == "alpn" && ssl && value != "":
+				bind.ALPN = value
+			case name == "ciphers" && ssl && value != "":
+				bind.Ciphers = value
+			case name == "ssl-min-ver" && ssl && sslMinVerRegex.MatchString(value):
+				bind.SSLMinVer = value
+			default:
+				invalid = opt
+			}
+			if invalid != "" {
+				break
+			}
+		}
+		if invalid != "" {
+			c.logger.Warn("ignoring bind '%s' of '%s': invalid option '%s'", line, key, invalid)
+			continue
+		}
+		if bind.Internal || bind.Tenant != "" {
+			// internal and tenant binds need an explicit id, used to distinguish them in the frontend
+			bind.ID = 10021 + len(binds)
+		}
+		binds = append(binds, bind)
 	}
+	return binds
 }
 
 func (c *updater) buildGlobalPathTypeOrder(d *globalData) {
@@ -205,15 +297,131 @@ func (c *updater) buildGlobalStats(d *globalData) {
 func (c *updater) buildGlobalSyslog(d *globalData) {
 	d.global.Syslog.Endpoint = d.mapper.Get(ingtypes.GlobalSyslogEndpoint).Value
 	d.global.Syslog.Format = d.mapper.Get(ingtypes.GlobalSyslogFormat).Value
+	if d.global.Syslog.Endpoint == "" && c.options.SyslogListener != "" {
+		// the embedded listener writes the message as is, syslog header is useless
+		d.global.Syslog.Endpoint = c.options.SyslogListener
+		d.global.Syslog.Format = "raw"
+	}
 	d.global.Syslog.Length = d.mapper.Get(ingtypes.GlobalSyslogLength).Int()
 	d.global.Syslog.Tag = d.mapper.Get(ingtypes.GlobalSyslogTag).Value
 	//
 	d.global.Syslog.AuthLogFormat = d.mapper.Get(ingtypes.GlobalAuthLogFormat).Value
 	d.global.Syslog.HTTPLogFormat = d.mapper.Get(ingtypes.GlobalHTTPLogFormat).Value
+	if d.global.Syslog.HTTPLogFormat == "json" {
+		d.global.Syslog.HTTPLogFormat = c.buildHTTPLogJSONFormat(d.mapper.Get(ingtypes.GlobalHTTPLogJSONFields).Value)
+	}
 	d.global.Syslog.HTTPSLogFormat = d.mapper.Get(ingtypes.GlobalHTTPSLogFormat).Value
 	d.global.Syslog.TCPLogFormat = d.mapper.Get(ingtypes.GlobalTCPLogFormat).Value
 }
 
+// httpLogJSONFields has the builtin fields of the JSON formatted HTTP log,
+// names are mapped to HAProxy's log format variables. String fields are
+// quoted, numeric ones are not.
+// httpLogJSONFields has the builtin fields of the JSON formatted HTTP log.
+// Quoted fields whose content comes from the request are read from sample
+// fetches, so they can be escaped with the json converter.
+var httpLogJSONFields = map[string]struct {
+	variable string
+	quote    bool
+}{
+	"backend":           {"%b", true},
+	"bytes_read":        {"%B", false},
+	"client_ip":         {"%ci", true},
+	"client_port":       {"%cp", false},
+	"frontend":          {"%f", true},
+	"method":            {"%[capture.req.method,json(utf8s)]", true},
+	"request_id":        {"%[unique-id,json(utf8s)]", true},
+	"server":            {"%s", true},
+	"status":            {"%ST", false},
+	"termination_state": {"%ts", true},
+	"time_connect":      {"%Tc", false},
+	"time_queue":        {"%Tw", false},
+	"time_request":      {"%TR", false},
+	"time_response":     {"%Tr", false},
+	"time_total":        {"%Ta", false},
+	"timestamp":         {"%tr", true},
+	"uri":               {"%[capture.req.uri,json(utf8s)]", true},
+	"version":           {"%[capture.req.ver,json(utf8s)]", true},
+}
+
+var httpLogJSONNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// buildHTTPLogJSONFormat creates a HAProxy log-format that writes the HTTP log
+// as a JSON object. fields is a comma-separated list of builtin field names,
+// or custom fields in the `name:format` syntax, e.g. `agent:%[capture.req.hdr(0)]`.
+// Custom formats only accept sample fetches, which are escaped with the
+// json converter, since log variables cannot be escaped.
+func (c *updater) buildHTTPLogJSONFormat(fields string) string {
+	var items []string
+	for _, field := range utils.Split(fields, ",") {
+		if field == "" {
+			continue
+		}
+		var name, value string
+		if idx := strings.Index(field, ":"); idx >= 0 {
+			name = strings.TrimSpace(field[:idx])
+			format := strings.TrimSpace(field[idx+1:])
+			escaped, ok := jsonEscapeLogFormat(format)
+			if !httpLogJSONNameRegex.MatchString(name) || !ok {
+				c.logger.Warn("ignoring invalid http log json field: %s", field)
+				continue
+			}
+			value = `"` + escaped + `"`
+		} else if builtin, found := httpLogJSONFields[field]; found {
+			name = field
+			value = builtin.variable
+			if builtin.quote {
+				value = `"` + value + `"`
+			}
+		} else {
+			c.logger.Warn("ignoring unknown http log json field: %s", field)
+			continue
+		}
+		items = append(items, `"`+name+`":`+value)
+	}
+	return "'{" + strings.Join(items, ",") + "}'"
+}
+
+// jsonEscapeLogFormat adds the json converter to all the sample fetches of
+// a log format, e.g. `%[capture.req.hdr(0)]`. Formats with log variables,
+// quotes or backslashes cannot be safely used as a JSON string, in this
+// case false is returned.
+func jsonEscapeLogFormat(format string) (string, bool) {
+	if format == "" || strings.ContainsAny(format, `"'\`) {
+		return "", false
+	}
+	var escaped strings.Builder
+	for {
+		idx := strings.Index(format, "%")
+		if idx < 0 {
+			escaped.WriteString(format)
+			return escaped.String(), true
+		}
+		escaped.WriteString(format[:idx])
+		format = format[idx:]
+		if !strings.HasPrefix(format, "%[") {
+			return "", false
+		}
+		depth, end := 0, -1
+		for i, ch := range format[1:] {
+			if ch == '[' {
+				depth++
+			} else if ch == ']' {
+				depth--
+				if depth == 0 {
+					end = i + 1
+					break
+				}
+			}
+		}
+		if end < 0 {
+			return "", false
+		}
+		escaped.WriteString(format[:end] + ",json(utf8s)]")
+		format = format[end+1:]
+	}
+}
+
 func (c *updater) buildGlobalTimeout(d *globalData) {
 	d.global.Timeout.Client = c.validateTime(d.mapper.Get(ingtypes.GlobalTimeoutClient))
 	d.global.Timeout.ClientFin = c.validateTime(d.mapper.Get(ingtypes.GlobalTimeoutClientFin))
@@ -225,6 +433,89 @@ func (c *updater) buildGlobalTimeout(d *globalData) {
 	d.global.Timeout.ServerFin = c.validateTime(d.mapper.Get(ingtypes.BackTimeoutServerFin))
 	d.global.Timeout.Stop = c.validateTime(d.mapper.Get(ingtypes.GlobalTimeoutStop))
 	d.global.Timeout.Tunnel = c.validateTime(d.mapper.Get(ingtypes.BackTimeoutTunnel))
+	d.global.Retry.Retries = c.validateRetries(d.mapper.Get(ingtypes.BackRetries))
+	d.global.Retry.RetryOn = c.validateRetryOn(d.mapper.Get(ingtypes.BackRetryOn))
+}
+
+// hardeningTimeouts has the longest global timeouts allowed by the
+// hardening profile. Shorter timeouts are preserved.
+var hardeningTimeouts = []struct {
+	name    string
+	timeout func(*hatypes.TimeoutConfig) *string
+	max     string
+}{
+	{"client", func(t *hatypes.TimeoutConfig) *string { return &t.Client }, "30s"},
+	{"client-fin", func(t *hatypes.TimeoutConfig) *string { return &t.ClientFin }, "10s"},
+	{"http-request", func(t *hatypes.TimeoutConfig) *string { return &t.HTTPRequest }, "5s"},
+	{"keep-alive", func(t *hatypes.TimeoutConfig) *string { return &t.KeepAlive }, "10s"},
+}
+
+var hardeningTableSizeRegex = regexp.MustCompile(`^[1-9][0-9]*[kmg]?$`)
+
+// buildGlobalHardening applies the hardening profile, it should be called
+// after buildGlobalTimeout.
+func (c *updater) buildGlobalHardening(d *globalData) {
+	profile := d.mapper.Get(ingtypes.GlobalHardeningProfile).Value
+	switch profile {
+	case "", "none":
+		return
+	case "strict":
+	default:
+		c.logger.Warn("ignoring invalid hardening profile: %s", profile)
+		return
+	}
+	rate := func(key string) int {
+		value := d.mapper.Get(key).Value
+		r, err := strconv.Atoi(value)
+		if err != nil || r < 0 {
+			c.logger.Warn("ignoring invalid %s, disabling its rule: %s", key, value)
+			return 0
+		}
+		return r
+	}
+	hardening := &d.global.Hardening
+	hardening.Enabled = true
+	hardening.ConnRate = rate(ingtypes.GlobalHardeningConnRate)
+	hardening.HTTPReqRate = rate(ingtypes.GlobalHardeningHTTPReqRate)
+	hardening.HTTPErrRate = rate(ingtypes.GlobalHardeningHTTPErrRate)
+	hardening.TableSize = d.mapper.Get(ingtypes.GlobalHardeningTableSize).Value
+	if !hardeningTableSizeRegex.MatchString(hardening.TableSize) {
+		c.logger.Warn("ignoring invalid hardening table size, using '1m': %s", hardening.TableSize)
+		hardening.TableSize = "1m"
+	}
+	headroom := d.mapper.Get(ingtypes.GlobalHardeningMaxConnHeadroom).Int()
+	if headroom < 0 {
+		c.logger.Warn("ignoring invalid hardening maxconn headroom, using '0': %d", headroom)
+		headroom = 0
+	}
+	hardening.MaxConn = d.global.MaxConn
+	d.global.MaxConn += d.global.MaxConn * headroom / 100
+	for _, t := range hardeningTimeouts {
+		timeout := t.timeout(&d.global.Timeout)
+		current, err := parseHAProxyTime(*timeout)
+		max, _ := parseHAProxyTime(t.max)
+		if *timeout == "" || err != nil || current > max {
+			*timeout = t.max
+		}
+	}
+}
+
+// parseHAProxyTime converts a time with suffix, as validated by validateTime,
+// to a time.Duration.
+func parseHAProxyTime(value string) (time.Duration, error) {
+	if !regexValidTime.MatchString(value) {
+		return 0, fmt.Errorf("invalid time format: %s", value)
+	}
+	units := map[string]time.Duration{
+		"us": time.Microsecond, "ms": time.Millisecond, "s": time.Second,
+		"m": time.Minute, "h": time.Hour, "d": 24 * time.Hour,
+	}
+	i := strings.IndexFunc(value, func(r rune) bool { return r < '0' || r > '9' })
+	n, err := strconv.Atoi(value[:i])
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(n) * units[value[i:]], nil
 }
 
 func (c *updater) buildSecurity(d *globalData) {
@@ -249,6 +540,80 @@ func (c *updater) buildSecurity(d *globalData) {
 	d.global.Security.UseChroot = d.mapper.Get(ingtypes.GlobalUseChroot).Bool()
 }
 
+func (c *updater) buildGlobalTune(d *globalData) {
+	if bufsize := d.mapper.Get(ingtypes.GlobalHTTPBufferSize).Value; bufsize != "" {
+		// haproxy refuses to start with buffers lesser than its header rewrite reserve
+		value, err := utils.SizeSuffixToInt64(bufsize)
+		if err != nil || value < 4096 {
+			c.logger.Warn("ignoring invalid http buffer size, should be at least 4k: %s", bufsize)
+		} else {
+			d.global.Tune.BufSize = value
+		}
+	}
+	if size := d.mapper.Get(ingtypes.GlobalH2HeaderTableSize).Int(); size > 65535 {
+		c.logger.Warn("ignoring h2 header table size greater than 65535: %d", size)
+	} else if size > 0 {
+		d.global.Tune.H2HeaderTableSize = size
+	}
+	if maxhdr := d.mapper.Get(ingtypes.GlobalHTTPMaxHeaders).Int(); maxhdr > 32767 {
+		c.logger.Warn("ignoring max number of http headers greater than 32767: %d", maxhdr)
+	} else if maxhdr > 0 {
+		d.global.Tune.HTTPMaxHeaders = maxhdr
+	}
+}
+
+func (c *updater) buildGlobalTracing(d *globalData) {
+	d.global.Tracing = c.buildTracing(d.mapper, nil)
+}
+
+// buildTracing builds the tracing config of the global defaults, or of a
+// backend if source is not nil, so the mode and the header format can be
+// overridden per backend. The opentracing mode falls back to the headers
+// mode if haproxy was built without OpenTracing support.
+func (c *updater) buildTracing(mapper *Mapper, source *Source) hatypes.TracingConfig {
+	var on string
+	if source != nil {
+		on = fmt.Sprintf(" on %v", source)
+	}
+	var tracing hatypes.TracingConfig
+	mode := mapper.Get(ingtypes.BackTracingMode).Value
+	if mode == "opentracing" && !c.options.Capabilities.HasOpenTracing() {
+		c.logger.Warn("ignoring opentracing mode%s: haproxy was built without OpenTracing support, using headers mode instead", on)
+		mode = "headers"
+	}
+	switch mode {
+	case "", "none":
+		return tracing
+	case "headers":
+		for _, format := range utils.Split(mapper.Get(ingtypes.BackTracingHeaderFormat).Value, ",") {
+			switch format {
+			case "b3":
+				tracing.HeaderB3 = true
+			case "w3c":
+				tracing.HeaderW3C = true
+			default:
+				c.logger.Warn("ignoring invalid tracing header format%s: %s", on, format)
+			}
+		}
+		if !tracing.HeaderB3 && !tracing.HeaderW3C {
+			c.logger.Warn("ignoring tracing config%s due to missing a valid header format", on)
+			return hatypes.TracingConfig{}
+		}
+	case "opentracing":
+		tracing.OTConfigFile = mapper.Get(ingtypes.GlobalTracingOTConfigFile).Value
+		tracing.OTID = mapper.Get(ingtypes.GlobalTracingOTID).Value
+		if tracing.OTConfigFile == "" {
+			c.logger.Warn("ignoring opentracing config%s due to missing config file", on)
+			return hatypes.TracingConfig{}
+		}
+	default:
+		c.logger.Warn("ignoring invalid tracing mode%s: %s", on, mode)
+		return tracing
+	}
+	tracing.Mode = mode
+	return tracing
+}
+
 func (c *updater) buildGlobalSSL(d *globalData) {
 	ssl := &d.global.SSL
 	ssl.ALPN = d.mapper.Get(ingtypes.HostTLSALPN).Value
@@ -281,7 +646,13 @@ func (c *updater) buildGlobalHTTPStoHTTP(d *globalData) {
 		if port == 0 {
 			return
 		}
-		bind = fmt.Sprintf("%s:%d", d.mapper.Get(ingtypes.GlobalBindIPAddrHTTP).Value, port)
+		bind = readBindAddr(d, port)
+	}
+	if bind == d.global.Bind.HTTPBind && d.global.Bind.FrontingAcceptProxy != d.global.Bind.HTTPAcceptProxy {
+		// the same bind is used by both, http config has precedence since it's more specific
+		c.logger.Warn("conflicting PROXY protocol config of the shared http and fronting proxy bind '%s', using %s=%t",
+			bind, ingtypes.GlobalUseProxyProtocolHTTP, d.global.Bind.HTTPAcceptProxy)
+		d.global.Bind.FrontingAcceptProxy = d.global.Bind.HTTPAcceptProxy
 	}
 	// TODO Change all `ToHTTP` naming to `FrontingProxy`
 	d.global.Bind.FrontingBind = bind
@@ -301,6 +672,126 @@ func (c *updater) buildGlobalModSecurity(d *globalData) {
 	d.global.ModSecurity.Timeout.Server = c.validateTime(d.mapper.Get(ingtypes.GlobalModsecurityTimeoutServer))
 }
 
+var (
+	spoeAgentNameRegex   = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+	spoeMessageNameRegex = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+)
+
+// SPOE events that can be used by a filter declared in a backend
+var spoeBackendEvents = map[string]struct{}{
+	"on-backend-tcp-request": {}, "on-backend-http-request": {},
+	"on-server-session": {}, "on-tcp-response": {}, "on-http-response": {},
+}
+
+type spoeAgentConfig struct {
+	Endpoints []string `yaml:"endpoints"`
+	Messages  []struct {
+		Name  string `yaml:"name"`
+		Args  string `yaml:"args"`
+		Event string `yaml:"event"`
+	} `yaml:"messages"`
+	Timeout struct {
+		Connect    string `yaml:"connect"`
+		Server     string `yaml:"server"`
+		Hello      string `yaml:"hello"`
+		Idle       string `yaml:"idle"`
+		Processing string `yaml:"processing"`
+	} `yaml:"timeout"`
+}
+
+// buildGlobalSPOEAgents reads the SPOE agents from the spoe-agents-configmap
+// ConfigMap, one agent per key, the key is the agent name. Missing timeouts
+// use the same timeouts of the ModSecurity agent, so it should be called
+// after buildGlobalModSecurity.
+func (c *updater) buildGlobalSPOEAgents(d *globalData) {
+	cmName := FullConfigMapName(d.mapper.Get(ingtypes.GlobalSPOEAgentsConfigMap).Value, c.cache.GetPodNamespace())
+	if cmName == "" {
+		return
+	}
+	cm, err := c.cache.GetConfigMap(cmName)
+	if err != nil {
+		c.logger.Error("error reading SPOE agents: %v", err)
+		return
+	}
+	names := make([]string, 0, len(cm.Data))
+	for name := range cm.Data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	modsecTimeout := d.global.ModSecurity.Timeout
+	timeout := func(agent, name, value, defaultValue string) string {
+		if value == "" {
+			return defaultValue
+		}
+		if !regexValidTime.MatchString(value) {
+			c.logger.Warn("ignoring invalid %s timeout of SPOE agent '%s', using '%s' instead: %s", name, agent, defaultValue, value)
+			return defaultValue
+		}
+		return value
+	}
+	for _, name := range names {
+		if !spoeAgentNameRegex.MatchString(name) || name == "modsecurity" {
+			c.logger.Warn("ignoring SPOE agent '%s' of configmap '%s': invalid agent name", name, cmName)
+			continue
+		}
+		var config spoeAgentConfig
+		if err := yaml.UnmarshalStrict([]byte(cm.Data[name]), &config); err != nil {
+			c.logger.Warn("ignoring SPOE agent '%s' of configmap '%s': %v", name, cmName, err)
+			continue
+		}
+		if len(config.Endpoints) == 0 {
+			c.logger.Warn("ignoring SPOE agent '%s' of configmap '%s': missing endpoints", name, cmName)
+			continue
+		}
+		validEndpoints := true
+		for _, ep := range config.Endpoints {
+			if ep == "" || strings.ContainsAny(ep, " \t\r\n") {
+				c.logger.Warn("ignoring SPOE agent '%s' of configmap '%s': invalid endpoint '%s'", name, cmName, ep)
+				validEndpoints = false
+				break
+			}
+		}
+		if !validEndpoints {
+			continue
+		}
+		agent := &hatypes.SPOEAgent{
+			Name:      name,
+			Endpoints: config.Endpoints,
+			Timeout: hatypes.SPOEAgentTimeoutConfig{
+				Connect:    timeout(name, "connect", config.Timeout.Connect, modsecTimeout.Connect),
+				Server:     timeout(name, "server", config.Timeout.Server, modsecTimeout.Server),
+				Hello:      timeout(name, "hello", config.Timeout.Hello, modsecTimeout.Hello),
+				Idle:       timeout(name, "idle", config.Timeout.Idle, modsecTimeout.Idle),
+				Processing: timeout(name, "processing", config.Timeout.Processing, modsecTimeout.Processing),
+			},
+		}
+		for _, msg := range config.Messages {
+			if !spoeMessageNameRegex.MatchString(msg.Name) {
+				c.logger.Warn("ignoring message '%s' of SPOE agent '%s': invalid message name", msg.Name, name)
+				continue
+			}
+			if strings.ContainsAny(msg.Args, "\r\n") {
+				c.logger.Warn("ignoring message '%s' of SPOE agent '%s': args should be declared in a single line", msg.Name, name)
+				continue
+			}
+			if _, found := spoeBackendEvents[msg.Event]; !found {
+				c.logger.Warn("ignoring message '%s' of SPOE agent '%s': unsupported event '%s'", msg.Name, name, msg.Event)
+				continue
+			}
+			agent.Messages = append(agent.Messages, &hatypes.SPOEMessage{
+				Name:  msg.Name,
+				Args:  msg.Args,
+				Event: msg.Event,
+			})
+		}
+		if len(agent.Messages) == 0 {
+			c.logger.Warn("ignoring SPOE agent '%s' of configmap '%s': missing messages", name, cmName)
+			continue
+		}
+		d.global.SPOEAgents = append(d.global.SPOEAgents, agent)
+	}
+}
+
 func (c *updater) buildGlobalDNS(d *globalData) {
 	resolvers := d.mapper.Get(ingtypes.GlobalDNSResolvers).Value
 	if resolvers == "" {
@@ -331,6 +822,13 @@ func (c *updater) buildGlobalDNS(d *globalData) {
 			if ns == "" {
 				continue
 			}
+			if ns == "auto" {
+				var err error
+				if ns, err = c.findClusterDNS(); err != nil {
+					c.logger.Warn("ignoring auto nameserver of resolver '%s': %v", dnsResolver.Name, err)
+					continue
+				}
+			}
 			if strings.Index(ns, ":") < 0 {
 				// missing port number
 				ns += ":53"
@@ -341,15 +839,174 @@ func (c *updater) buildGlobalDNS(d *globalData) {
 				Endpoint: ns,
 			})
 		}
+		if len(dnsResolver.Nameservers) == 0 {
+			c.logger.Warn("ignoring resolver without nameservers: %s", dnsResolver.Name)
+			continue
+		}
 		d.global.DNS.Resolvers = append(d.global.DNS.Resolvers, dnsResolver)
 	}
 	d.global.DNS.ClusterDomain = d.mapper.Get(ingtypes.GlobalDNSClusterDomain).Value
 }
 
+// clusterDNSServices are the services of the cluster DNS, kube-dns is kept
+// as the service name by most of the CoreDNS deployments.
+var clusterDNSServices = []string{"kube-system/kube-dns", "kube-system/coredns"}
+
+// findClusterDNS returns the address of the cluster DNS service, used by the
+// `auto` nameserver. Changes in the service aren't tracked, its ClusterIP is
+// not expected to change.
+func (c *updater) findClusterDNS() (string, error) {
+	for _, name := range clusterDNSServices {
+		svc, err := c.cache.GetService(name)
+		if err != nil || svc.Spec.ClusterIP == "" || svc.Spec.ClusterIP == api.ClusterIPNone {
+			continue
+		}
+		port := int32(53)
+		for _, svcPort := range svc.Spec.Ports {
+			if svcPort.Protocol == api.ProtocolUDP {
+				port = svcPort.Port
+				break
+			}
+		}
+		return fmt.Sprintf("%s:%d", svc.Spec.ClusterIP, port), nil
+	}
+	return "", fmt.Errorf("cluster DNS service not found, tried %s", strings.Join(clusterDNSServices, " and "))
+}
+
 var (
-	forwardRegex = regexp.MustCompile(`^(add|update|ignore|ifmissing)$`)
+	forwardRegex        = regexp.MustCompile(`^(add|update|ignore|ifmissing)$`)
+	errorPageClassRegex = regexp.MustCompile(`^[1-9][xX][xX]$`)
 )
 
+// errorfile supported status codes
+var errorPageCodes = map[int]struct{}{
+	400: {}, 401: {}, 403: {}, 404: {}, 405: {}, 407: {}, 408: {},
+	410: {}, 413: {}, 425: {}, 429: {}, 500: {}, 501: {}, 502: {}, 503: {}, 504: {},
+}
+
+func (c *updater) buildGlobalErrorPages(d *globalData) {
+	cmName := FullConfigMapName(d.mapper.Get(ingtypes.GlobalErrorPages).Value, c.cache.GetPodNamespace())
+	if cmName == "" {
+		return
+	}
+	cm, err := c.cache.GetConfigMap(cmName)
+	if err != nil {
+		c.logger.Error("error reading error pages: %v", err)
+		return
+	}
+	keys := make([]string, 0, len(cm.Data))
+	for key := range cm.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	// exact status codes have precedence over the class keys, eg 5xx
+	pages := map[int]string{}
+	var classKeys []string
+	for _, key := range keys {
+		if errorPageClassRegex.MatchString(key) {
+			classKeys = append(classKeys, key)
+			continue
+		}
+		code, err := strconv.Atoi(key)
+		if err != nil {
+			c.logger.Warn("ignoring error page '%s' of configmap '%s': invalid status code", key, cmName)
+			continue
+		}
+		if _, found := errorPageCodes[code]; !found {
+			c.logger.Warn("ignoring error page '%s' of configmap '%s': unsupported status code", key, cmName)
+			continue
+		}
+		pages[code] = cm.Data[key]
+	}
+	for _, key := range classKeys {
+		class := int(key[0] - '0')
+		var found bool
+		for code := range errorPageCodes {
+			if code/100 != class {
+				continue
+			}
+			found = true
+			if _, exists := pages[code]; !exists {
+				pages[code] = cm.Data[key]
+			}
+		}
+		if !found {
+			c.logger.Warn("ignoring error page '%s' of configmap '%s': unsupported status code", key, cmName)
+		}
+	}
+	codes := make([]int, 0, len(pages))
+	for code := range pages {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		content := pages[code]
+		if !strings.HasPrefix(content, "HTTP/") {
+			// only the body was provided, adding the status line and the headers
+			content = fmt.Sprintf("HTTP/1.0 %d %s\r\nCache-Control: no-cache\r\nConnection: close\r\nContent-Type: text/html\r\n\r\n%s",
+				code, http.StatusText(code), content)
+		}
+		d.global.ErrorPages = append(d.global.ErrorPages, &hatypes.ErrorPage{
+			Code:    code,
+			Content: content,
+		})
+	}
+}
+
+// buildGlobalBotMitigation reads the user agents and the paths of the
+// bot-mitigation-configmap ConfigMap, one pattern per line. Hosts opt in
+// the rules using the bot-mitigation annotation.
+func (c *updater) buildGlobalBotMitigation(d *globalData) {
+	cmName := FullConfigMapName(d.mapper.Get(ingtypes.GlobalBotMitigationConfigMap).Value, c.cache.GetPodNamespace())
+	if cmName == "" {
+		return
+	}
+	cm, err := c.cache.GetConfigMap(cmName)
+	if err != nil {
+		c.logger.Error("error reading bot mitigation rules: %v", err)
+		return
+	}
+	keys := make([]string, 0, len(cm.Data))
+	for key := range cm.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	readPatterns := func(key string) []string {
+		var patterns []string
+		for _, line := range utils.LineToSlice(cm.Data[key]) {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if key == "paths" && !strings.HasPrefix(line, "/") {
+				c.logger.Warn("ignoring path '%s' of bot mitigation configmap '%s': path should start with '/'", line, cmName)
+				continue
+			}
+			patterns = append(patterns, line)
+		}
+		return patterns
+	}
+	for _, key := range keys {
+		switch key {
+		case "user-agents":
+			d.global.BotMitigation.UserAgents = readPatterns(key)
+		case "paths":
+			d.global.BotMitigation.Paths = readPatterns(key)
+		default:
+			c.logger.Warn("ignoring key '%s' of bot mitigation configmap '%s': unsupported key", key, cmName)
+		}
+	}
+}
+
+// FullConfigMapName returns the full name of a ConfigMap declared
+// in the global config, using namespace if name doesn't have one.
+func FullConfigMapName(name, namespace string) string {
+	if name != "" && !strings.Contains(name, "/") {
+		return namespace + "/" + name
+	}
+	return name
+}
+
 func (c *updater) buildGlobalForwardFor(d *globalData) {
 	if forwardFor := d.mapper.Get(ingtypes.GlobalForwardfor).Value; forwardRegex.MatchString(forwardFor) {
 		d.global.ForwardFor = forwardFor
@@ -361,6 +1018,58 @@ func (c *updater) buildGlobalForwardFor(d *globalData) {
 	}
 }
 
+var sourceInterfaceRegex = regexp.MustCompile(`^[A-Za-z0-9_.:-]{1,15}$`)
+
+// buildGlobalSourceAllowlist reads the IPs, CIDRs and interface names that
+// backends are allowed to use as the source of their connections. An item
+// that isn't an IP or a CIDR is parsed as an interface name.
+func (c *updater) buildGlobalSourceAllowlist(d *globalData) {
+	for _, source := range utils.Split(d.mapper.Get(ingtypes.GlobalBackendSourceAllowlist).Value, ",") {
+		if source == "" {
+			continue
+		}
+		if net.ParseIP(source) != nil {
+			d.global.SourceAllowlist.CIDR = append(d.global.SourceAllowlist.CIDR, source)
+		} else if _, _, err := net.ParseCIDR(source); err == nil {
+			d.global.SourceAllowlist.CIDR = append(d.global.SourceAllowlist.CIDR, source)
+		} else if sourceInterfaceRegex.MatchString(source) {
+			d.global.SourceAllowlist.Interfaces = append(d.global.SourceAllowlist.Interfaces, source)
+		} else {
+			c.logger.Warn("skipping invalid backend source: %s", source)
+		}
+	}
+}
+
+var realIPHeaderRegex = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
+func (c *updater) buildGlobalRealIP(d *globalData) {
+	var trustedCIDR []string
+	for _, cidr := range utils.Split(d.mapper.Get(ingtypes.GlobalRealIPTrustedCIDR).Value, ",") {
+		if cidr == "" {
+			continue
+		}
+		var err error
+		if net.ParseIP(cidr) == nil {
+			_, _, err = net.ParseCIDR(cidr)
+		}
+		if err != nil {
+			c.logger.Warn("skipping invalid IP or cidr of trusted proxies: %s", cidr)
+			continue
+		}
+		trustedCIDR = append(trustedCIDR, cidr)
+	}
+	if len(trustedCIDR) == 0 {
+		return
+	}
+	header := d.mapper.Get(ingtypes.GlobalRealIPHeader).Value
+	if !realIPHeaderRegex.MatchString(header) {
+		c.logger.Warn("ignoring invalid real IP header '%s', using 'X-Forwarded-For' instead", header)
+		header = "X-Forwarded-For"
+	}
+	d.global.RealIP.Header = header
+	d.global.RealIP.TrustedCIDR = trustedCIDR
+}
+
 func (c *updater) buildGlobalCustomConfig(d *globalData) {
 	d.global.CustomConfig = utils.LineToSlice(d.mapper.Get(ingtypes.GlobalConfigGlobal).Value)
 	d.global.CustomDefaults = utils.LineToSlice(d.mapper.Get(ingtypes.GlobalConfigDefaults).Value)
@@ -383,5 +1092,15 @@ func (c *updater) buildGlobalCustomConfig(d *globalData) {
 		c.logger.Warn("non scoped %d line(s) in the config-proxy configuration were ignored", len(lines))
 		delete(proxy, "")
 	}
+	snippets := c.readConfigSnippets(d.mapper)
+	d.global.CustomConfig = append(d.global.CustomConfig, snippets.global...)
+	d.global.CustomDefaults = append(d.global.CustomDefaults, snippets.defaults...)
+	d.global.CustomFrontend = append(d.global.CustomFrontend, snippets.frontend...)
+	if len(snippets.frontendHTTP) > 0 {
+		proxy["_front_http"] = append(proxy["_front_http"], snippets.frontendHTTP...)
+	}
+	if len(snippets.frontendHTTPS) > 0 {
+		proxy["_front_https"] = append(proxy["_front_https"], snippets.frontendHTTPS...)
+	}
 	d.global.CustomProxy = proxy
 }
@@ -17,8 +17,13 @@ limitations under the License.
 package annotations
 
 import (
+	"strings"
 	"testing"
 
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	conv_helper "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/helper_test"
 	ingtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/types"
 	hatypes "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/types"
 )
@@ -82,6 +87,7 @@ func TestBind(t *testing.T) {
 	testCases := []struct {
 		ann      map[string]string
 		expected hatypes.GlobalBindConfig
+		logging  string
 	}{
 		// 0
 		{
@@ -132,6 +138,171 @@ func TestBind(t *testing.T) {
 				HTTPSBind: "*:8443",
 			},
 		},
+		// 5
+		{
+			ann: map[string]string{
+				ingtypes.GlobalBindHTTPExtra: ":8080 accept-proxy\n127.0.0.1:8081",
+			},
+			expected: hatypes.GlobalBindConfig{
+				HTTPBind:  "*:80",
+				HTTPSBind: "*:443",
+				HTTPExtra: []*hatypes.BindExtraConfig{
+					{Addr: ":8080", AcceptProxy: true},
+					{Addr: "127.0.0.1:8081"},
+				},
+			},
+		},
+		// 6
+		{
+			ann: map[string]string{
+				ingtypes.GlobalBindHTTPSExtra: ":8443 accept-proxy alpn=http/1.1\n:9443 ssl-min-ver=TLSv1.2 ciphers=ECDHE-RSA-AES128-GCM-SHA256",
+			},
+			expected: hatypes.GlobalBindConfig{
+				HTTPBind:  "*:80",
+				HTTPSBind: "*:443",
+				HTTPSExtra: []*hatypes.BindExtraConfig{
+					{Addr: ":8443", AcceptProxy: true, ALPN: "http/1.1"},
+					{Addr: ":9443", SSLMinVer: "TLSv1.2", Ciphers: "ECDHE-RSA-AES128-GCM-SHA256"},
+				},
+			},
+		},
+		// 7
+		{
+			ann: map[string]string{
+				ingtypes.GlobalBindHTTPExtra:  ":8080 alpn=h2\n:8081",
+				ingtypes.GlobalBindHTTPSExtra: ":8443 ssl-min-ver=TLSv2\n:9443 accept-proxy=true",
+			},
+			expected: hatypes.GlobalBindConfig{
+				HTTPBind:  "*:80",
+				HTTPSBind: "*:443",
+				HTTPExtra: []*hatypes.BindExtraConfig{
+					{Addr: ":8081"},
+				},
+			},
+			logging: `
+WARN ignoring bind ':8080 alpn=h2' of 'bind-http-extra': invalid option 'alpn=h2'
+WARN ignoring bind ':8443 ssl-min-ver=TLSv2' of 'bind-https-extra': invalid option 'ssl-min-ver=TLSv2'
+WARN ignoring bind ':9443 accept-proxy=true' of 'bind-https-extra': invalid option 'accept-proxy=true'`,
+		},
+		// 8
+		{
+			ann: map[string]string{
+				ingtypes.GlobalUseProxyProtocol: "true",
+			},
+			expected: hatypes.GlobalBindConfig{
+				HTTPAcceptProxy:     true,
+				HTTPSAcceptProxy:    true,
+				HTTPBind:            "*:80",
+				HTTPSBind:           "*:443",
+				FrontingAcceptProxy: true,
+			},
+		},
+		// 9
+		{
+			ann: map[string]string{
+				ingtypes.GlobalUseProxyProtocol:     "true",
+				ingtypes.GlobalUseProxyProtocolHTTP: "false",
+			},
+			expected: hatypes.GlobalBindConfig{
+				HTTPSAcceptProxy:    true,
+				HTTPBind:            "*:80",
+				HTTPSBind:           "*:443",
+				FrontingAcceptProxy: true,
+			},
+		},
+		// 10
+		{
+			ann: map[string]string{
+				ingtypes.GlobalUseProxyProtocolHTTPS: "true",
+			},
+			expected: hatypes.GlobalBindConfig{
+				HTTPSAcceptProxy: true,
+				HTTPBind:         "*:80",
+				HTTPSBind:        "*:443",
+			},
+		},
+		// 11
+		{
+			ann: map[string]string{
+				ingtypes.GlobalBindHTTPExtra:  ":8080\n10.0.0.10:8080 internal",
+				ingtypes.GlobalBindHTTPSExtra: "10.0.0.10:8443 internal accept-proxy\n:9443 internal=true",
+			},
+			expected: hatypes.GlobalBindConfig{
+				HTTPBind:  "*:80",
+				HTTPSBind: "*:443",
+				HTTPExtra: []*hatypes.BindExtraConfig{
+					{Addr: ":8080"},
+					{Addr: "10.0.0.10:8080", ID: 10022, Internal: true},
+				},
+				HTTPSExtra: []*hatypes.BindExtraConfig{
+					{Addr: "10.0.0.10:8443", ID: 10021, Internal: true, AcceptProxy: true},
+				},
+			},
+			logging: `
+WARN ignoring bind ':9443 internal=true' of 'bind-https-extra': invalid option 'internal=true'`,
+		},
+		// 12
+		{
+			ann: map[string]string{
+				ingtypes.GlobalBindHTTPExtra:  ":8080 thread=1\n:8081 tenant=team1 thread=2-3",
+				ingtypes.GlobalBindHTTPSExtra: ":8443 tenant=team1 thread=2-3\n:9443 tenant=team 2",
+			},
+			expected: hatypes.GlobalBindConfig{
+				HTTPBind:  "*:80",
+				HTTPSBind: "*:443",
+				HTTPExtra: []*hatypes.BindExtraConfig{
+					{Addr: ":8080", Thread: "1"},
+					{Addr: ":8081", ID: 10022, Tenant: "team1", Thread: "2-3"},
+				},
+				HTTPSExtra: []*hatypes.BindExtraConfig{
+					{Addr: ":8443", ID: 10021, Tenant: "team1", Thread: "2-3"},
+				},
+			},
+			logging: `
+WARN ignoring bind ':9443 tenant=team 2' of 'bind-https-extra': invalid option '2'`,
+		},
+		// 13
+		{
+			ann: map[string]string{
+				ingtypes.GlobalBindIPFamily: "dual",
+			},
+			expected: hatypes.GlobalBindConfig{
+				HTTPBind:  ":::80 v4v6",
+				HTTPSBind: ":::443 v4v6",
+			},
+		},
+		// 14
+		{
+			ann: map[string]string{
+				ingtypes.GlobalBindIPFamily: "ipv6",
+			},
+			expected: hatypes.GlobalBindConfig{
+				HTTPBind:  ":::80 v6only",
+				HTTPSBind: ":::443 v6only",
+			},
+		},
+		// 15
+		{
+			ann: map[string]string{
+				ingtypes.GlobalBindIPAddrHTTP: "127.0.0.1",
+				ingtypes.GlobalBindIPFamily:   "dual",
+			},
+			expected: hatypes.GlobalBindConfig{
+				HTTPBind:  "127.0.0.1:80",
+				HTTPSBind: "127.0.0.1:443",
+			},
+		},
+		// 16
+		{
+			ann: map[string]string{
+				ingtypes.GlobalBindIPFamily: "ipv5",
+			},
+			expected: hatypes.GlobalBindConfig{
+				HTTPBind:  "*:80",
+				HTTPSBind: "*:443",
+			},
+			logging: `WARN ignoring invalid bind IP family 'ipv5', using 'ipv4'`,
+		},
 	}
 	for i, test := range testCases {
 		c := setup(t)
@@ -143,6 +314,7 @@ func TestBind(t *testing.T) {
 		d.mapper.AddAnnotations(nil, hatypes.CreatePathLink("-", "-"), test.ann)
 		c.createUpdater().buildGlobalBind(d)
 		c.compareObjects("bind", i, d.global.Bind, test.expected)
+		c.logger.CompareLogging(test.logging)
 		c.teardown()
 	}
 }
@@ -205,6 +377,104 @@ proxy_1
 	}
 }
 
+func TestCustomConfigSnippets(t *testing.T) {
+	type custom struct {
+		Config   []string
+		Defaults []string
+		Frontend []string
+		Proxy    map[string][]string
+	}
+	testCases := []struct {
+		configMaps map[string]map[string]string
+		config     map[string]string
+		expected   custom
+		logging    string
+	}{
+		// 0
+		{},
+		// 1
+		{
+			configMaps: map[string]map[string]string{
+				"ingress-controller/snippets": {
+					"global":         "## global",
+					"defaults":       "## defaults",
+					"frontend":       "## frontend",
+					"frontend-http":  "## frontend-http",
+					"frontend-https": "## frontend-https",
+					"backend":        "## backend",
+				},
+			},
+			config: map[string]string{
+				ingtypes.GlobalConfigSnippets: "snippets",
+			},
+			expected: custom{
+				Config:   []string{"## global"},
+				Defaults: []string{"## defaults"},
+				Frontend: []string{"## frontend"},
+				Proxy: map[string][]string{
+					"_front_http":  {"## frontend-http"},
+					"_front_https": {"## frontend-https"},
+				},
+			},
+		},
+		// 2
+		{
+			configMaps: map[string]map[string]string{
+				"ingress-controller/snippets1": {"global": "## snippets1"},
+				"ingress-controller/snippets2": {"global": "## snippets2", "frontend-http": "## snippets2"},
+			},
+			config: map[string]string{
+				ingtypes.GlobalConfigGlobal:   "## config-global",
+				ingtypes.GlobalConfigProxy:    "_front_http\n  ## config-proxy",
+				ingtypes.GlobalConfigSnippets: "snippets2, ingress-controller/snippets1",
+			},
+			expected: custom{
+				Config: []string{"## config-global", "## snippets2", "## snippets1"},
+				Proxy: map[string][]string{
+					"_front_http": {"## config-proxy", "## snippets2"},
+				},
+			},
+		},
+		// 3
+		{
+			configMaps: map[string]map[string]string{
+				"default/snippets": {"global": "## global", "frontend-http": "## frontend-http"},
+			},
+			config: map[string]string{
+				ingtypes.GlobalConfigSnippets: "default/snippets",
+			},
+			logging: `
+WARN ignoring injection point 'frontend-http' of configmap 'default/snippets': only configmaps of the controller namespace can declare it
+WARN ignoring injection point 'global' of configmap 'default/snippets': only configmaps of the controller namespace can declare it`,
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		c.cache.ConfigMapList = map[string]*api.ConfigMap{}
+		for name, data := range test.configMaps {
+			cmName := strings.Split(name, "/")
+			c.cache.ConfigMapList[name] = &api.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: cmName[0], Name: cmName[1]},
+				Data:       data,
+			}
+		}
+		d := c.createGlobalData(test.config)
+		c.createUpdater().buildGlobalCustomConfig(d)
+		if test.expected.Proxy == nil {
+			test.expected.Proxy = map[string][]string{}
+		}
+		actual := custom{
+			Config:   d.global.CustomConfig,
+			Defaults: d.global.CustomDefaults,
+			Frontend: d.global.CustomFrontend,
+			Proxy:    d.global.CustomProxy,
+		}
+		c.compareObjects("custom config snippets", i, actual, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
 func TestModSecurity(t *testing.T) {
 	testCases := []struct {
 		endpoints string
@@ -235,9 +505,141 @@ func TestModSecurity(t *testing.T) {
 	}
 }
 
+func TestSPOEAgents(t *testing.T) {
+	modsecTimeout := hatypes.ModSecurityTimeoutConfig{
+		Connect:    "5s",
+		Server:     "5s",
+		Hello:      "100ms",
+		Idle:       "30s",
+		Processing: "1s",
+	}
+	testCases := []struct {
+		config   string
+		data     map[string]string
+		expected []*hatypes.SPOEAgent
+		logging  string
+	}{
+		// 0
+		{
+			config: "",
+		},
+		// 1
+		{
+			config:  "agents",
+			logging: `ERROR error reading SPOE agents: configmap not found: ingress-controller/agents`,
+		},
+		// 2
+		{
+			config: "ingress-controller/agents",
+			data: map[string]string{
+				"authz": `
+endpoints:
+- 10.0.0.201:12345
+messages:
+- name: check-request
+  args: method path req.hdrs_bin
+  event: on-backend-http-request
+timeout:
+  processing: 500ms
+`,
+			},
+			expected: []*hatypes.SPOEAgent{
+				{
+					Name:      "authz",
+					Endpoints: []string{"10.0.0.201:12345"},
+					Messages: []*hatypes.SPOEMessage{
+						{Name: "check-request", Args: "method path req.hdrs_bin", Event: "on-backend-http-request"},
+					},
+					Timeout: hatypes.SPOEAgentTimeoutConfig{
+						Connect:    "5s",
+						Server:     "5s",
+						Hello:      "100ms",
+						Idle:       "30s",
+						Processing: "500ms",
+					},
+				},
+			},
+		},
+		// 3
+		{
+			config: "agents",
+			data: map[string]string{
+				"waf": `
+endpoints: [10.0.0.211:12345]
+messages:
+- name: check-session
+  event: on-server-session
+- name: check-frontend
+  event: on-frontend-http-request
+- name: check.invalid
+  event: on-http-response
+- name: check-args
+  args: "status\nres.hdrs_bin"
+  event: on-http-response
+timeout:
+  idle: 1x
+`,
+			},
+			expected: []*hatypes.SPOEAgent{
+				{
+					Name:      "waf",
+					Endpoints: []string{"10.0.0.211:12345"},
+					Messages: []*hatypes.SPOEMessage{
+						{Name: "check-session", Event: "on-server-session"},
+					},
+					Timeout: hatypes.SPOEAgentTimeoutConfig(modsecTimeout),
+				},
+			},
+			logging: `
+WARN ignoring invalid idle timeout of SPOE agent 'waf', using '30s' instead: 1x
+WARN ignoring message 'check-frontend' of SPOE agent 'waf': unsupported event 'on-frontend-http-request'
+WARN ignoring message 'check.invalid' of SPOE agent 'waf': invalid message name
+WARN ignoring message 'check-args' of SPOE agent 'waf': args should be declared in a single line`,
+		},
+		// 4
+		{
+			config: "agents",
+			data: map[string]string{
+				"Authz":       `endpoints: [10.0.0.201:12345]`,
+				"modsecurity": `endpoints: [10.0.0.201:12345]`,
+				"a1":          `endpoint: 10.0.0.201:12345`,
+				"a2":          `messages: [{name: check, event: on-http-response}]`,
+				"a3":          `{endpoints: ["10.0.0.201:12345 check"], messages: [{name: check, event: on-http-response}]}`,
+				"a4":          `endpoints: [10.0.0.201:12345]`,
+			},
+			logging: `
+WARN ignoring SPOE agent 'Authz' of configmap 'ingress-controller/agents': invalid agent name
+WARN ignoring SPOE agent 'a1' of configmap 'ingress-controller/agents': yaml: unmarshal errors:
+  line 1: field endpoint not found in type annotations.spoeAgentConfig
+WARN ignoring SPOE agent 'a2' of configmap 'ingress-controller/agents': missing endpoints
+WARN ignoring SPOE agent 'a3' of configmap 'ingress-controller/agents': invalid endpoint '10.0.0.201:12345 check'
+WARN ignoring SPOE agent 'a4' of configmap 'ingress-controller/agents': missing messages
+WARN ignoring SPOE agent 'modsecurity' of configmap 'ingress-controller/agents': invalid agent name`,
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		if test.data != nil {
+			c.cache.ConfigMapList = map[string]*api.ConfigMap{
+				"ingress-controller/agents": {
+					ObjectMeta: metav1.ObjectMeta{Namespace: "ingress-controller", Name: "agents"},
+					Data:       test.data,
+				},
+			}
+		}
+		d := c.createGlobalData(map[string]string{ingtypes.GlobalSPOEAgentsConfigMap: test.config})
+		d.global.ModSecurity.Timeout = modsecTimeout
+		c.createUpdater().buildGlobalSPOEAgents(d)
+		c.compareObjects("spoe agents", i, d.global.SPOEAgents, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
 func TestDNS(t *testing.T) {
 	testCases := []struct {
 		config   map[string]string
+		services []*api.Service
 		expected hatypes.DNSConfig
 		logging  string
 	}{
@@ -325,9 +727,86 @@ k8s3=10.0.1.31:10053,10.0.1.32:10053,10.0.1.33:10053,
 				},
 			},
 		},
+		// 3
+		{
+			config: map[string]string{
+				ingtypes.GlobalDNSClusterDomain: "cluster.local",
+				ingtypes.GlobalDNSResolvers:     "k8s=auto",
+			},
+			services: []*api.Service{
+				createDNSService("kube-system/kube-dns", "10.96.0.10", api.ServicePort{Name: "dns", Port: 53, Protocol: api.ProtocolUDP}),
+			},
+			expected: hatypes.DNSConfig{
+				ClusterDomain: "cluster.local",
+				Resolvers: []*hatypes.DNSResolver{
+					{
+						Name: "k8s",
+						Nameservers: []*hatypes.DNSNameserver{
+							{
+								Name:     "ns01",
+								Endpoint: "10.96.0.10:53",
+							},
+						},
+					},
+				},
+			},
+		},
+		// 4
+		{
+			config: map[string]string{
+				ingtypes.GlobalDNSClusterDomain: "cluster.local",
+				ingtypes.GlobalDNSResolvers:     "k8s=10.0.1.11,auto",
+			},
+			services: []*api.Service{
+				createDNSService("kube-system/kube-dns", api.ClusterIPNone),
+				createDNSService("kube-system/coredns", "10.96.0.20",
+					api.ServicePort{Name: "dns-tcp", Port: 53, Protocol: api.ProtocolTCP},
+					api.ServicePort{Name: "dns", Port: 1053, Protocol: api.ProtocolUDP},
+				),
+			},
+			expected: hatypes.DNSConfig{
+				ClusterDomain: "cluster.local",
+				Resolvers: []*hatypes.DNSResolver{
+					{
+						Name: "k8s",
+						Nameservers: []*hatypes.DNSNameserver{
+							{
+								Name:     "ns01",
+								Endpoint: "10.0.1.11:53",
+							},
+							{
+								Name:     "ns02",
+								Endpoint: "10.96.0.20:1053",
+							},
+						},
+					},
+				},
+			},
+		},
+		// 5
+		{
+			config: map[string]string{
+				ingtypes.GlobalDNSClusterDomain: "cluster.local",
+				ingtypes.GlobalDNSResolvers:     "k8s=auto",
+			},
+			expected: hatypes.DNSConfig{
+				ClusterDomain: "cluster.local",
+			},
+			logging: `
+WARN ignoring auto nameserver of resolver 'k8s': cluster DNS service not found, tried kube-system/kube-dns and kube-system/coredns
+WARN ignoring resolver without nameservers: k8s`,
+		},
+		// 6
+		{
+			config: map[string]string{
+				ingtypes.GlobalDNSResolvers: "k8s=",
+			},
+			logging: `WARN ignoring resolver without nameservers: k8s`,
+		},
 	}
 	for i, test := range testCases {
 		c := setup(t)
+		c.cache.SvcList = test.services
 		d := c.createGlobalData(test.config)
 		c.createUpdater().buildGlobalDNS(d)
 		c.compareObjects("dns", i, d.global.DNS, test.expected)
@@ -336,33 +815,206 @@ k8s3=10.0.1.31:10053,10.0.1.32:10053,10.0.1.33:10053,
 	}
 }
 
-func TestForwardFor(t *testing.T) {
+func createDNSService(name, clusterIP string, ports ...api.ServicePort) *api.Service {
+	svc, _ := conv_helper.CreateService(name, "53", "")
+	svc.Spec.ClusterIP = clusterIP
+	svc.Spec.Ports = ports
+	return svc
+}
+
+func TestErrorPages(t *testing.T) {
 	testCases := []struct {
-		conf     string
-		expected string
+		config   string
+		data     map[string]string
+		expected []*hatypes.ErrorPage
 		logging  string
 	}{
 		// 0
 		{
-			conf:     "",
-			expected: "add",
-			logging:  "",
+			config: "",
 		},
 		// 1
 		{
-			conf:     "non",
-			expected: "add",
-			logging:  "WARN Invalid forwardfor value option on configmap: 'non'. Using 'add' instead",
+			config:  "default/pages",
+			logging: `ERROR error reading error pages: configmap not found: default/pages`,
 		},
 		// 2
 		{
-			conf:     "add",
-			expected: "add",
-			logging:  "",
+			config: "pages",
+			data: map[string]string{
+				"503": "HTTP/1.0 503 Service Unavailable\r\n\r\nunavailable",
+			},
+			expected: []*hatypes.ErrorPage{
+				{Code: 503, Content: "HTTP/1.0 503 Service Unavailable\r\n\r\nunavailable"},
+			},
 		},
 		// 3
 		{
-			conf:     "ignore",
+			config: "ingress-controller/pages",
+			data: map[string]string{
+				"504": "<h1>timeout</h1>",
+				"404": "<h1>not found</h1>",
+			},
+			expected: []*hatypes.ErrorPage{
+				{Code: 404, Content: "HTTP/1.0 404 Not Found\r\nCache-Control: no-cache\r\nConnection: close\r\nContent-Type: text/html\r\n\r\n<h1>not found</h1>"},
+				{Code: 504, Content: "HTTP/1.0 504 Gateway Timeout\r\nCache-Control: no-cache\r\nConnection: close\r\nContent-Type: text/html\r\n\r\n<h1>timeout</h1>"},
+			},
+		},
+		// 4
+		{
+			config: "pages",
+			data: map[string]string{
+				"3xx": "<h1>moved</h1>",
+				"302": "<h1>moved</h1>",
+				"50x": "<h1>error</h1>",
+			},
+			logging: `
+WARN ignoring error page '302' of configmap 'ingress-controller/pages': unsupported status code
+WARN ignoring error page '50x' of configmap 'ingress-controller/pages': invalid status code
+WARN ignoring error page '3xx' of configmap 'ingress-controller/pages': unsupported status code`,
+		},
+		// 5
+		{
+			config: "pages",
+			data: map[string]string{
+				"5xx": "HTTP/1.0 500 Internal Server Error\r\n\r\nerror",
+				"503": "HTTP/1.0 503 Service Unavailable\r\n\r\nunavailable",
+			},
+			expected: []*hatypes.ErrorPage{
+				{Code: 500, Content: "HTTP/1.0 500 Internal Server Error\r\n\r\nerror"},
+				{Code: 501, Content: "HTTP/1.0 500 Internal Server Error\r\n\r\nerror"},
+				{Code: 502, Content: "HTTP/1.0 500 Internal Server Error\r\n\r\nerror"},
+				{Code: 503, Content: "HTTP/1.0 503 Service Unavailable\r\n\r\nunavailable"},
+				{Code: 504, Content: "HTTP/1.0 500 Internal Server Error\r\n\r\nerror"},
+			},
+		},
+		// 6
+		{
+			config: "pages",
+			data: map[string]string{
+				"4XX": "<h1>client error</h1>",
+			},
+			expected: []*hatypes.ErrorPage{
+				{Code: 400, Content: "HTTP/1.0 400 Bad Request\r\nCache-Control: no-cache\r\nConnection: close\r\nContent-Type: text/html\r\n\r\n<h1>client error</h1>"},
+				{Code: 401, Content: "HTTP/1.0 401 Unauthorized\r\nCache-Control: no-cache\r\nConnection: close\r\nContent-Type: text/html\r\n\r\n<h1>client error</h1>"},
+				{Code: 403, Content: "HTTP/1.0 403 Forbidden\r\nCache-Control: no-cache\r\nConnection: close\r\nContent-Type: text/html\r\n\r\n<h1>client error</h1>"},
+				{Code: 404, Content: "HTTP/1.0 404 Not Found\r\nCache-Control: no-cache\r\nConnection: close\r\nContent-Type: text/html\r\n\r\n<h1>client error</h1>"},
+				{Code: 405, Content: "HTTP/1.0 405 Method Not Allowed\r\nCache-Control: no-cache\r\nConnection: close\r\nContent-Type: text/html\r\n\r\n<h1>client error</h1>"},
+				{Code: 407, Content: "HTTP/1.0 407 Proxy Authentication Required\r\nCache-Control: no-cache\r\nConnection: close\r\nContent-Type: text/html\r\n\r\n<h1>client error</h1>"},
+				{Code: 408, Content: "HTTP/1.0 408 Request Timeout\r\nCache-Control: no-cache\r\nConnection: close\r\nContent-Type: text/html\r\n\r\n<h1>client error</h1>"},
+				{Code: 410, Content: "HTTP/1.0 410 Gone\r\nCache-Control: no-cache\r\nConnection: close\r\nContent-Type: text/html\r\n\r\n<h1>client error</h1>"},
+				{Code: 413, Content: "HTTP/1.0 413 Request Entity Too Large\r\nCache-Control: no-cache\r\nConnection: close\r\nContent-Type: text/html\r\n\r\n<h1>client error</h1>"},
+				{Code: 425, Content: "HTTP/1.0 425 Too Early\r\nCache-Control: no-cache\r\nConnection: close\r\nContent-Type: text/html\r\n\r\n<h1>client error</h1>"},
+				{Code: 429, Content: "HTTP/1.0 429 Too Many Requests\r\nCache-Control: no-cache\r\nConnection: close\r\nContent-Type: text/html\r\n\r\n<h1>client error</h1>"},
+			},
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		if test.data != nil {
+			c.cache.ConfigMapList = map[string]*api.ConfigMap{
+				"ingress-controller/pages": {
+					ObjectMeta: metav1.ObjectMeta{Namespace: "ingress-controller", Name: "pages"},
+					Data:       test.data,
+				},
+			}
+		}
+		d := c.createGlobalData(map[string]string{ingtypes.GlobalErrorPages: test.config})
+		c.createUpdater().buildGlobalErrorPages(d)
+		c.compareObjects("error pages", i, d.global.ErrorPages, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestBotMitigation(t *testing.T) {
+	testCases := []struct {
+		config   string
+		data     map[string]string
+		expected hatypes.BotMitigationConfig
+		logging  string
+	}{
+		// 0
+		{
+			config: "",
+		},
+		// 1
+		{
+			config:  "default/bots",
+			logging: `ERROR error reading bot mitigation rules: configmap not found: default/bots`,
+		},
+		// 2
+		{
+			config: "bots",
+			data: map[string]string{
+				"user-agents": "# scanners\nnikto\n\n  sqlmap  \n",
+				"paths":       "/wp-login.php\n/.git/",
+			},
+			expected: hatypes.BotMitigationConfig{
+				UserAgents: []string{"nikto", "sqlmap"},
+				Paths:      []string{"/wp-login.php", "/.git/"},
+			},
+		},
+		// 3
+		{
+			config: "ingress-controller/bots",
+			data: map[string]string{
+				"paths":  "/admin\nphpmyadmin",
+				"denied": "10.0.0.0/8",
+			},
+			expected: hatypes.BotMitigationConfig{
+				Paths: []string{"/admin"},
+			},
+			logging: `
+WARN ignoring key 'denied' of bot mitigation configmap 'ingress-controller/bots': unsupported key
+WARN ignoring path 'phpmyadmin' of bot mitigation configmap 'ingress-controller/bots': path should start with '/'`,
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		if test.data != nil {
+			c.cache.ConfigMapList = map[string]*api.ConfigMap{
+				"ingress-controller/bots": {
+					ObjectMeta: metav1.ObjectMeta{Namespace: "ingress-controller", Name: "bots"},
+					Data:       test.data,
+				},
+			}
+		}
+		d := c.createGlobalData(map[string]string{ingtypes.GlobalBotMitigationConfigMap: test.config})
+		c.createUpdater().buildGlobalBotMitigation(d)
+		c.compareObjects("bot mitigation", i, d.global.BotMitigation, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestForwardFor(t *testing.T) {
+	testCases := []struct {
+		conf     string
+		expected string
+		logging  string
+	}{
+		// 0
+		{
+			conf:     "",
+			expected: "add",
+			logging:  "",
+		},
+		// 1
+		{
+			conf:     "non",
+			expected: "add",
+			logging:  "WARN Invalid forwardfor value option on configmap: 'non'. Using 'add' instead",
+		},
+		// 2
+		{
+			conf:     "add",
+			expected: "add",
+			logging:  "",
+		},
+		// 3
+		{
+			conf:     "ignore",
 			expected: "ignore",
 			logging:  "",
 		},
@@ -392,7 +1044,9 @@ func TestForwardFor(t *testing.T) {
 func TestFrontingProxy(t *testing.T) {
 	testCases := []struct {
 		ann      map[string]string
+		bind     hatypes.GlobalBindConfig
 		expected hatypes.GlobalBindConfig
+		logging  string
 	}{
 		// 0
 		{
@@ -432,14 +1086,328 @@ func TestFrontingProxy(t *testing.T) {
 				FrontingBind: "127.0.0.1:7000",
 			},
 		},
+		// 4
+		{
+			ann: map[string]string{
+				ingtypes.GlobalBindFrontingProxy: ":8000",
+			},
+			bind: hatypes.GlobalBindConfig{
+				HTTPBind:            ":80",
+				FrontingAcceptProxy: true,
+			},
+			expected: hatypes.GlobalBindConfig{
+				HTTPBind:            ":80",
+				FrontingAcceptProxy: true,
+				FrontingBind:        ":8000",
+			},
+		},
+		// 5
+		{
+			ann: map[string]string{
+				ingtypes.GlobalBindFrontingProxy: ":80",
+			},
+			bind: hatypes.GlobalBindConfig{
+				HTTPBind:            ":80",
+				FrontingAcceptProxy: true,
+			},
+			expected: hatypes.GlobalBindConfig{
+				HTTPBind:     ":80",
+				FrontingBind: ":80",
+			},
+			logging: `WARN conflicting PROXY protocol config of the shared http and fronting proxy bind ':80', using use-proxy-protocol-http=false`,
+		},
 	}
 	frontingSockID := 10011
 	for i, test := range testCases {
 		c := setup(t)
 		d := c.createGlobalData(test.ann)
+		d.global.Bind = test.bind
 		c.createUpdater().buildGlobalHTTPStoHTTP(d)
 		test.expected.FrontingSockID = frontingSockID
 		c.compareObjects("fronting proxy", i, d.global.Bind, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestHardening(t *testing.T) {
+	defaultConfig := map[string]string{
+		ingtypes.GlobalHardeningConnRate:        "200",
+		ingtypes.GlobalHardeningHTTPErrRate:     "100",
+		ingtypes.GlobalHardeningHTTPReqRate:     "1000",
+		ingtypes.GlobalHardeningMaxConnHeadroom: "25",
+		ingtypes.GlobalHardeningTableSize:       "1m",
+	}
+	defaultTimeout := hatypes.TimeoutConfig{
+		BackendTimeoutConfig: hatypes.BackendTimeoutConfig{
+			HTTPRequest: "5s",
+			KeepAlive:   "1m",
+		},
+		Client:    "50s",
+		ClientFin: "50s",
+	}
+	strictTimeout := hatypes.TimeoutConfig{
+		BackendTimeoutConfig: hatypes.BackendTimeoutConfig{
+			HTTPRequest: "5s",
+			KeepAlive:   "10s",
+		},
+		Client:    "30s",
+		ClientFin: "10s",
+	}
+	testCases := []struct {
+		config     map[string]string
+		timeout    *hatypes.TimeoutConfig
+		expected   hatypes.HardeningConfig
+		expMaxConn int
+		expTimeout hatypes.TimeoutConfig
+		logging    string
+	}{
+		// 0
+		{
+			config:     map[string]string{},
+			expMaxConn: 2000,
+			expTimeout: defaultTimeout,
+		},
+		// 1
+		{
+			config: map[string]string{
+				ingtypes.GlobalHardeningProfile: "none",
+			},
+			expMaxConn: 2000,
+			expTimeout: defaultTimeout,
+		},
+		// 2
+		{
+			config: map[string]string{
+				ingtypes.GlobalHardeningProfile: "loose",
+			},
+			expMaxConn: 2000,
+			expTimeout: defaultTimeout,
+			logging:    `WARN ignoring invalid hardening profile: loose`,
+		},
+		// 3
+		{
+			config: map[string]string{
+				ingtypes.GlobalHardeningProfile: "strict",
+			},
+			expected: hatypes.HardeningConfig{
+				Enabled:     true,
+				ConnRate:    200,
+				HTTPReqRate: 1000,
+				HTTPErrRate: 100,
+				TableSize:   "1m",
+				MaxConn:     2000,
+			},
+			expMaxConn: 2500,
+			expTimeout: strictTimeout,
+		},
+		// 4
+		{
+			config: map[string]string{
+				ingtypes.GlobalHardeningProfile:         "strict",
+				ingtypes.GlobalHardeningConnRate:        "0",
+				ingtypes.GlobalHardeningHTTPErrRate:     "-1",
+				ingtypes.GlobalHardeningHTTPReqRate:     "500",
+				ingtypes.GlobalHardeningMaxConnHeadroom: "50",
+				ingtypes.GlobalHardeningTableSize:       "100k",
+			},
+			expected: hatypes.HardeningConfig{
+				Enabled:     true,
+				HTTPReqRate: 500,
+				TableSize:   "100k",
+				MaxConn:     2000,
+			},
+			expMaxConn: 3000,
+			expTimeout: strictTimeout,
+			logging:    `WARN ignoring invalid hardening-http-err-rate, disabling its rule: -1`,
+		},
+		// 5
+		{
+			config: map[string]string{
+				ingtypes.GlobalHardeningProfile:         "strict",
+				ingtypes.GlobalHardeningMaxConnHeadroom: "-10",
+				ingtypes.GlobalHardeningTableSize:       "1 m",
+			},
+			expected: hatypes.HardeningConfig{
+				Enabled:     true,
+				ConnRate:    200,
+				HTTPReqRate: 1000,
+				HTTPErrRate: 100,
+				TableSize:   "1m",
+				MaxConn:     2000,
+			},
+			expMaxConn: 2000,
+			expTimeout: strictTimeout,
+			logging: `
+WARN ignoring invalid hardening table size, using '1m': 1 m
+WARN ignoring invalid hardening maxconn headroom, using '0': -10`,
+		},
+		// 6
+		{
+			config: map[string]string{
+				ingtypes.GlobalHardeningProfile: "strict",
+			},
+			timeout: &hatypes.TimeoutConfig{
+				BackendTimeoutConfig: hatypes.BackendTimeoutConfig{
+					HTTPRequest: "2s",
+					KeepAlive:   "500ms",
+				},
+				Client:    "1m",
+				ClientFin: "invalid",
+			},
+			expected: hatypes.HardeningConfig{
+				Enabled:     true,
+				ConnRate:    200,
+				HTTPReqRate: 1000,
+				HTTPErrRate: 100,
+				TableSize:   "1m",
+				MaxConn:     2000,
+			},
+			expMaxConn: 2500,
+			expTimeout: hatypes.TimeoutConfig{
+				BackendTimeoutConfig: hatypes.BackendTimeoutConfig{
+					HTTPRequest: "2s",
+					KeepAlive:   "500ms",
+				},
+				Client:    "30s",
+				ClientFin: "10s",
+			},
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		config := map[string]string{}
+		for key, value := range defaultConfig {
+			config[key] = value
+		}
+		for key, value := range test.config {
+			config[key] = value
+		}
+		d := c.createGlobalData(config)
+		d.global.MaxConn = 2000
+		d.global.Timeout = defaultTimeout
+		if test.timeout != nil {
+			d.global.Timeout = *test.timeout
+		}
+		c.createUpdater().buildGlobalHardening(d)
+		c.compareObjects("hardening", i, d.global.Hardening, test.expected)
+		c.compareObjects("maxconn", i, d.global.MaxConn, test.expMaxConn)
+		c.compareObjects("timeout", i, d.global.Timeout, test.expTimeout)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestRealIP(t *testing.T) {
+	testCases := []struct {
+		ann      map[string]string
+		expected hatypes.RealIPConfig
+		logging  string
+	}{
+		// 0
+		{
+			ann: map[string]string{},
+		},
+		// 1
+		{
+			ann: map[string]string{
+				ingtypes.GlobalRealIPTrustedCIDR: "10.0.0.0/8,192.168.1.10",
+			},
+			expected: hatypes.RealIPConfig{
+				Header:      "X-Forwarded-For",
+				TrustedCIDR: []string{"10.0.0.0/8", "192.168.1.10"},
+			},
+		},
+		// 2
+		{
+			ann: map[string]string{
+				ingtypes.GlobalRealIPHeader:      "CF-Connecting-IP",
+				ingtypes.GlobalRealIPTrustedCIDR: "173.245.48.0/20",
+			},
+			expected: hatypes.RealIPConfig{
+				Header:      "CF-Connecting-IP",
+				TrustedCIDR: []string{"173.245.48.0/20"},
+			},
+		},
+		// 3
+		{
+			ann: map[string]string{
+				ingtypes.GlobalRealIPHeader:      "True Client IP",
+				ingtypes.GlobalRealIPTrustedCIDR: "10.0.0.0/8,10.0.0.0/33",
+			},
+			expected: hatypes.RealIPConfig{
+				Header:      "X-Forwarded-For",
+				TrustedCIDR: []string{"10.0.0.0/8"},
+			},
+			logging: `
+WARN skipping invalid IP or cidr of trusted proxies: 10.0.0.0/33
+WARN ignoring invalid real IP header 'True Client IP', using 'X-Forwarded-For' instead`,
+		},
+		// 4
+		{
+			ann: map[string]string{
+				ingtypes.GlobalRealIPHeader: "True-Client-IP",
+			},
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		ann := map[string]string{
+			ingtypes.GlobalRealIPHeader: "X-Forwarded-For",
+		}
+		for key, value := range test.ann {
+			ann[key] = value
+		}
+		d := c.createGlobalData(ann)
+		c.createUpdater().buildGlobalRealIP(d)
+		c.compareObjects("real ip", i, d.global.RealIP, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestSourceAllowlist(t *testing.T) {
+	testCases := []struct {
+		allowlist string
+		expected  hatypes.SourceAllowlistConfig
+		logging   string
+	}{
+		// 0
+		{},
+		// 1
+		{
+			allowlist: "10.0.0.0/24, 192.168.1.10,fd00::/64",
+			expected: hatypes.SourceAllowlistConfig{
+				CIDR: []string{"10.0.0.0/24", "192.168.1.10", "fd00::/64"},
+			},
+		},
+		// 2
+		{
+			allowlist: "eth1,10.0.0.10,eth0.100",
+			expected: hatypes.SourceAllowlistConfig{
+				CIDR:       []string{"10.0.0.10"},
+				Interfaces: []string{"eth1", "eth0.100"},
+			},
+		},
+		// 3
+		{
+			allowlist: "10.0.0.0/33,eth 1,eth1",
+			expected: hatypes.SourceAllowlistConfig{
+				Interfaces: []string{"eth1"},
+			},
+			logging: `
+WARN skipping invalid backend source: 10.0.0.0/33
+WARN skipping invalid backend source: eth 1`,
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		d := c.createGlobalData(map[string]string{
+			ingtypes.GlobalBackendSourceAllowlist: test.allowlist,
+		})
+		c.createUpdater().buildGlobalSourceAllowlist(d)
+		c.compareObjects("source allowlist", i, d.global.SourceAllowlist, test.expected)
+		c.logger.CompareLogging(test.logging)
 		c.teardown()
 	}
 }
@@ -624,3 +1592,285 @@ func TestSecurity(t *testing.T) {
 		c.teardown()
 	}
 }
+
+func TestTracing(t *testing.T) {
+	testCases := []struct {
+		config   map[string]string
+		caps     *hatypes.Capabilities
+		expected hatypes.TracingConfig
+		logging  string
+	}{
+		// 0
+		{
+			config:   map[string]string{},
+			expected: hatypes.TracingConfig{},
+		},
+		// 1
+		{
+			config: map[string]string{
+				ingtypes.BackTracingMode:         "none",
+				ingtypes.BackTracingHeaderFormat: "w3c",
+			},
+			expected: hatypes.TracingConfig{},
+		},
+		// 2
+		{
+			config: map[string]string{
+				ingtypes.BackTracingMode:         "headers",
+				ingtypes.BackTracingHeaderFormat: "w3c",
+			},
+			expected: hatypes.TracingConfig{
+				Mode:      "headers",
+				HeaderW3C: true,
+			},
+		},
+		// 3
+		{
+			config: map[string]string{
+				ingtypes.BackTracingMode:         "headers",
+				ingtypes.BackTracingHeaderFormat: "b3, w3c, jaeger",
+			},
+			expected: hatypes.TracingConfig{
+				Mode:      "headers",
+				HeaderB3:  true,
+				HeaderW3C: true,
+			},
+			logging: `WARN ignoring invalid tracing header format: jaeger`,
+		},
+		// 4
+		{
+			config: map[string]string{
+				ingtypes.BackTracingMode:         "headers",
+				ingtypes.BackTracingHeaderFormat: "jaeger",
+			},
+			expected: hatypes.TracingConfig{},
+			logging: `
+WARN ignoring invalid tracing header format: jaeger
+WARN ignoring tracing config due to missing a valid header format`,
+		},
+		// 5
+		{
+			config: map[string]string{
+				ingtypes.BackTracingMode:           "opentracing",
+				ingtypes.GlobalTracingOTConfigFile: "/etc/haproxy/ot/ot.cfg",
+				ingtypes.GlobalTracingOTID:         "ot-ingress",
+			},
+			expected: hatypes.TracingConfig{
+				Mode:         "opentracing",
+				OTConfigFile: "/etc/haproxy/ot/ot.cfg",
+				OTID:         "ot-ingress",
+			},
+		},
+		// 6
+		{
+			config: map[string]string{
+				ingtypes.BackTracingMode:   "opentracing",
+				ingtypes.GlobalTracingOTID: "ot-ingress",
+			},
+			expected: hatypes.TracingConfig{},
+			logging:  `WARN ignoring opentracing config due to missing config file`,
+		},
+		// 7
+		{
+			config: map[string]string{
+				ingtypes.BackTracingMode: "zipkin",
+			},
+			expected: hatypes.TracingConfig{},
+			logging:  `WARN ignoring invalid tracing mode: zipkin`,
+		},
+		// 8
+		{
+			config: map[string]string{
+				ingtypes.BackTracingMode:           "opentracing",
+				ingtypes.GlobalTracingOTConfigFile: "/etc/haproxy/ot/ot.cfg",
+				ingtypes.BackTracingHeaderFormat:   "w3c",
+			},
+			caps: &hatypes.Capabilities{Lua: true},
+			expected: hatypes.TracingConfig{
+				Mode:      "headers",
+				HeaderW3C: true,
+			},
+			logging: `WARN ignoring opentracing mode: haproxy was built without OpenTracing support, using headers mode instead`,
+		},
+		// 9
+		{
+			config: map[string]string{
+				ingtypes.BackTracingMode:           "opentracing",
+				ingtypes.GlobalTracingOTConfigFile: "/etc/haproxy/ot/ot.cfg",
+			},
+			caps: &hatypes.Capabilities{OpenTracing: true},
+			expected: hatypes.TracingConfig{
+				Mode:         "opentracing",
+				OTConfigFile: "/etc/haproxy/ot/ot.cfg",
+			},
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		d := c.createGlobalData(test.config)
+		u := c.createUpdater()
+		u.options.Capabilities = test.caps
+		u.buildGlobalTracing(d)
+		c.compareObjects("tracing", i, d.global.Tracing, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestTune(t *testing.T) {
+	testCases := []struct {
+		ann      map[string]string
+		expected hatypes.TuneConfig
+		logging  string
+	}{
+		// 0
+		{
+			ann: map[string]string{},
+		},
+		// 1
+		{
+			ann: map[string]string{
+				ingtypes.GlobalHTTPBufferSize:    "32k",
+				ingtypes.GlobalH2HeaderTableSize: "8192",
+				ingtypes.GlobalHTTPMaxHeaders:    "200",
+			},
+			expected: hatypes.TuneConfig{
+				BufSize:           32768,
+				H2HeaderTableSize: 8192,
+				HTTPMaxHeaders:    200,
+			},
+		},
+		// 2
+		{
+			ann: map[string]string{
+				ingtypes.GlobalHTTPBufferSize:    "1k",
+				ingtypes.GlobalH2HeaderTableSize: "65536",
+				ingtypes.GlobalHTTPMaxHeaders:    "32768",
+			},
+			logging: `
+WARN ignoring invalid http buffer size, should be at least 4k: 1k
+WARN ignoring h2 header table size greater than 65535: 65536
+WARN ignoring max number of http headers greater than 32767: 32768`,
+		},
+		// 3
+		{
+			ann: map[string]string{
+				ingtypes.GlobalHTTPBufferSize: "16kb",
+			},
+			logging: `WARN ignoring invalid http buffer size, should be at least 4k: 16kb`,
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		d := c.createGlobalData(test.ann)
+		c.createUpdater().buildGlobalTune(d)
+		c.compareObjects("tune", i, d.global.Tune, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestHTTPLogJSONFormat(t *testing.T) {
+	testCases := []struct {
+		format   string
+		fields   string
+		expected string
+		logging  string
+	}{
+		// 0
+		{
+			format:   "%ci %ST",
+			fields:   "client_ip",
+			expected: "%ci %ST",
+		},
+		// 1
+		{
+			format:   "json",
+			fields:   "client_ip,status,backend",
+			expected: `'{"client_ip":"%ci","status":%ST,"backend":"%b"}'`,
+		},
+		// 2
+		{
+			format:   "json",
+			fields:   "client_ip, agent:%[capture.req.hdr(0)]",
+			expected: `'{"client_ip":"%ci","agent":"%[capture.req.hdr(0),json(utf8s)]"}'`,
+		},
+		// 3
+		{
+			format:   "json",
+			fields:   "status,host,bad name:%[src],quote:%[str(\")],var:%ci,open:%[src",
+			expected: `'{"status":%ST}'`,
+			logging: `
+WARN ignoring unknown http log json field: host
+WARN ignoring invalid http log json field: bad name:%[src]
+WARN ignoring invalid http log json field: quote:%[str(")]
+WARN ignoring invalid http log json field: var:%ci
+WARN ignoring invalid http log json field: open:%[src`,
+		},
+		// 4
+		{
+			format:   "json",
+			fields:   "uri,request_id,route:%[var(txn.path)]@%[req.hdr(host)]",
+			expected: `'{"uri":"%[capture.req.uri,json(utf8s)]","request_id":"%[unique-id,json(utf8s)]","route":"%[var(txn.path),json(utf8s)]@%[req.hdr(host),json(utf8s)]"}'`,
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		d := c.createGlobalData(map[string]string{
+			ingtypes.GlobalHTTPLogFormat:     test.format,
+			ingtypes.GlobalHTTPLogJSONFields: test.fields,
+		})
+		c.createUpdater().buildGlobalSyslog(d)
+		c.compareObjects("http log format", i, d.global.Syslog.HTTPLogFormat, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestSyslogListener(t *testing.T) {
+	testCases := []struct {
+		listener string
+		config   map[string]string
+		endpoint string
+		format   string
+	}{
+		// 0
+		{
+			config: map[string]string{
+				ingtypes.GlobalSyslogFormat: "rfc5424",
+			},
+			endpoint: "",
+			format:   "rfc5424",
+		},
+		// 1
+		{
+			listener: "/var/run/haproxy/log.sock",
+			config: map[string]string{
+				ingtypes.GlobalSyslogFormat: "rfc5424",
+			},
+			endpoint: "/var/run/haproxy/log.sock",
+			format:   "raw",
+		},
+		// 2
+		{
+			listener: "/var/run/haproxy/log.sock",
+			config: map[string]string{
+				ingtypes.GlobalSyslogEndpoint: "10.0.0.1:514",
+				ingtypes.GlobalSyslogFormat:   "rfc5424",
+			},
+			endpoint: "10.0.0.1:514",
+			format:   "rfc5424",
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		d := c.createGlobalData(test.config)
+		u := c.createUpdater()
+		u.options.SyslogListener = test.listener
+		u.buildGlobalSyslog(d)
+		c.compareObjects("syslog endpoint", i, d.global.Syslog.Endpoint, test.endpoint)
+		c.compareObjects("syslog format", i, d.global.Syslog.Format, test.format)
+		c.logger.CompareLogging("")
+		c.teardown()
+	}
+}
@@ -17,10 +17,25 @@ limitations under the License.
 package annotations
 
 import (
+	"regexp"
+
 	ingtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/types"
 	convtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/types"
 )
 
+func (c *updater) buildHostAlias(d *hostData) {
+	// a declared hostname has precedence over an alias with the same name,
+	// haproxy/config also skips it when the hostname is declared later
+	alias := d.mapper.Get(ingtypes.HostServerAlias)
+	if alias.Value != "" && c.haproxy.Hosts().FindHost(alias.Value) != nil {
+		c.logger.Warn("ignoring server-alias '%s' on %v: the alias is already declared as a hostname",
+			alias.Value, alias.Source)
+	} else {
+		d.host.Alias.AliasName = alias.Value
+	}
+	d.host.Alias.AliasRegex = d.mapper.Get(ingtypes.HostServerAliasRegex).Value
+}
+
 func (c *updater) buildHostAuthTLS(d *hostData) {
 	tlsSecret := d.mapper.Get(ingtypes.HostAuthTLSSecret)
 	if tlsSecret.Source == nil || tlsSecret.Value == "" {
@@ -54,6 +69,17 @@ func (c *updater) buildHostAuthTLS(d *hostData) {
 	tls.CAErrorPage = d.mapper.Get(ingtypes.HostAuthTLSErrorPage).Value
 }
 
+func (c *updater) buildHostBotMitigation(d *hostData) {
+	bot := d.mapper.Get(ingtypes.HostBotMitigation)
+	switch bot.Value {
+	case "", "false":
+	case "deny", "tarpit":
+		d.host.BotMitigation = bot.Value
+	default:
+		c.logger.Warn("ignoring invalid bot mitigation action on %v: %s", bot.Source, bot.Value)
+	}
+}
+
 func (c *updater) buildHostCertSigner(d *hostData) {
 	signer := d.mapper.Get(ingtypes.HostCertSigner)
 	if signer.Value == "" {
@@ -117,7 +143,34 @@ func (c *updater) buildHostSSLPassthrough(d *hostData) {
 	d.host.SetSSLPassthrough(true)
 }
 
+var tenantNameRegex = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+func (c *updater) buildHostTenant(d *hostData) {
+	tenant := d.mapper.Get(ingtypes.HostTenant)
+	if tenant.Value == "" {
+		return
+	}
+	if !tenantNameRegex.MatchString(tenant.Value) {
+		c.logger.Warn("ignoring invalid tenant on %v: %s", tenant.Source, tenant.Value)
+		return
+	}
+	d.host.Tenant = tenant.Value
+}
+
 func (c *updater) buildHostTLSConfig(d *hostData) {
+	if cfg := d.mapper.Get(ingtypes.HostSSLProfile); cfg.Value != "" {
+		if profile, found := c.readSSLProfiles(d.mapper)[cfg.Value]; found {
+			d.host.TLS.ALPN = profile.alpn
+			d.host.TLS.Ciphers = profile.ciphers
+			d.host.TLS.CipherSuites = profile.cipherSuites
+			d.host.TLS.Curves = profile.curves
+			d.host.TLS.SSLMaxVer = profile.maxVer
+			d.host.TLS.SSLMinVer = profile.minVer
+		} else {
+			c.logger.Warn("ignoring ssl-profile on %v: profile not found: %s", cfg.Source, cfg.Value)
+		}
+	}
+	// options declared in the ingress resources override the profile
 	if cfg := d.mapper.Get(ingtypes.HostSSLCiphers); cfg.Source != nil {
 		d.host.TLS.Ciphers = cfg.Value
 	}
@@ -116,6 +116,114 @@ func TestBuildHostRedirect(t *testing.T) {
 	}
 }
 
+func TestBuildHostAlias(t *testing.T) {
+	testCases := []struct {
+		ann      map[string]string
+		expected hatypes.HostAliasConfig
+		logging  string
+	}{
+		// 0
+		{},
+		// 1
+		{
+			ann: map[string]string{
+				ingtypes.HostServerAlias:      "*.d.local",
+				ingtypes.HostServerAliasRegex: "^[a-z]+\\.d\\.local$",
+			},
+			expected: hatypes.HostAliasConfig{AliasName: "*.d.local", AliasRegex: "^[a-z]+\\.d\\.local$"},
+		},
+		// 2
+		{
+			ann: map[string]string{
+				ingtypes.HostServerAlias:      "dprev.local",
+				ingtypes.HostServerAliasRegex: "^dprev\\.local$",
+			},
+			expected: hatypes.HostAliasConfig{AliasRegex: "^dprev\\.local$"},
+			logging:  `WARN ignoring server-alias 'dprev.local' on ingress 'default/ing1': the alias is already declared as a hostname`,
+		},
+	}
+	source := &Source{Namespace: "default", Name: "ing1", Type: "ingress"}
+	for i, test := range testCases {
+		c := setup(t)
+		d := c.createHostData(source, test.ann, map[string]string{})
+		c.haproxy.Hosts().AcquireHost("dprev.local")
+		d.host = c.haproxy.Hosts().AcquireHost("d.local")
+		c.createUpdater().buildHostAlias(d)
+		c.compareObjects("host alias", i, d.host.Alias, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestBuildHostBotMitigation(t *testing.T) {
+	testCases := []struct {
+		ann      map[string]string
+		expected string
+		logging  string
+	}{
+		// 0
+		{},
+		// 1
+		{
+			ann: map[string]string{ingtypes.HostBotMitigation: "false"},
+		},
+		// 2
+		{
+			ann:      map[string]string{ingtypes.HostBotMitigation: "deny"},
+			expected: "deny",
+		},
+		// 3
+		{
+			ann:      map[string]string{ingtypes.HostBotMitigation: "tarpit"},
+			expected: "tarpit",
+		},
+		// 4
+		{
+			ann:     map[string]string{ingtypes.HostBotMitigation: "true"},
+			logging: `WARN ignoring invalid bot mitigation action on ingress 'default/ing1': true`,
+		},
+	}
+	source := &Source{Namespace: "default", Name: "ing1", Type: "ingress"}
+	for i, test := range testCases {
+		c := setup(t)
+		d := c.createHostData(source, test.ann, map[string]string{})
+		c.createUpdater().buildHostBotMitigation(d)
+		c.compareObjects("bot mitigation", i, d.host.BotMitigation, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestBuildHostTenant(t *testing.T) {
+	testCases := []struct {
+		ann      map[string]string
+		expected string
+		logging  string
+	}{
+		// 0
+		{},
+		// 1
+		{
+			ann:      map[string]string{ingtypes.HostTenant: "team1"},
+			expected: "team1",
+		},
+		// 2
+		{
+			ann:     map[string]string{ingtypes.HostTenant: "team#1"},
+			logging: `WARN ignoring invalid tenant on ingress 'default/ing1': team#1`,
+		},
+	}
+	source := &Source{Namespace: "default", Name: "ing1", Type: "ingress"}
+	for i, test := range testCases {
+		c := setup(t)
+		d := c.createHostData(source, test.ann, map[string]string{})
+		c.createUpdater().buildHostTenant(d)
+		c.compareObjects("tenant", i, d.host.Tenant, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
 func TestTLSConfig(t *testing.T) {
 	testCases := []struct {
 		annDefault map[string]string
@@ -291,6 +399,78 @@ func TestTLSConfig(t *testing.T) {
 				Options: "ssl-min-ver TLSv1.0 ssl-max-ver TLSv1.2",
 			},
 		},
+		// 18
+		{
+			annDefault: map[string]string{
+				ingtypes.HostSSLProfile: "intermediate",
+			},
+			expected: hatypes.HostTLSConfig{
+				Ciphers:      builtinSSLProfiles["intermediate"].ciphers,
+				CipherSuites: builtinSSLProfiles["intermediate"].cipherSuites,
+				Curves:       "X25519:prime256v1:secp384r1",
+				SSLMinVer:    "TLSv1.2",
+			},
+		},
+		// 19
+		{
+			annDefault: map[string]string{
+				ingtypes.GlobalSSLProfiles: "internal min-ver=TLSv1.2 max-ver=TLSv1.2 ciphers=some-cipher-1 curves=X25519 alpn=http/1.1",
+			},
+			ann: map[string]string{
+				ingtypes.HostSSLProfile: "internal",
+				ingtypes.HostSSLCiphers: "some-cipher-2",
+			},
+			expected: hatypes.HostTLSConfig{
+				ALPN:      "http/1.1",
+				Ciphers:   "some-cipher-2",
+				Curves:    "X25519",
+				SSLMaxVer: "TLSv1.2",
+				SSLMinVer: "TLSv1.2",
+			},
+		},
+		// 20
+		{
+			ann: map[string]string{
+				ingtypes.HostSSLProfile: "internal",
+			},
+			expected: hatypes.HostTLSConfig{},
+			logging:  "WARN ignoring ssl-profile on ingress 'system/ing1': profile not found: internal",
+		},
+		// 21
+		{
+			annDefault: map[string]string{
+				ingtypes.GlobalSSLProfiles: `
+p1 min-ver=TLSv1.4
+p2 curves
+p3 ciphers=some-cipher-1 tickets=off
+p4 curves=X25519`,
+			},
+			ann: map[string]string{
+				ingtypes.HostSSLProfile: "p4",
+			},
+			expected: hatypes.HostTLSConfig{
+				Curves: "X25519",
+			},
+			logging: `
+WARN ignoring ssl profile 'p1': invalid min-ver: TLSv1.4
+WARN ignoring ssl profile 'p2': invalid option: curves
+WARN ignoring ssl profile 'p3': unsupported option: tickets`,
+		},
+		// 22
+		{
+			annDefault: map[string]string{
+				ingtypes.GlobalSSLProfiles: "modern min-ver=TLSv1.2",
+			},
+			ann: map[string]string{
+				ingtypes.HostSSLProfile: "modern",
+			},
+			expected: hatypes.HostTLSConfig{
+				CipherSuites: "TLS_AES_128_GCM_SHA256:TLS_AES_256_GCM_SHA384:TLS_CHACHA20_POLY1305_SHA256",
+				Curves:       "X25519:prime256v1:secp384r1",
+				SSLMinVer:    "TLSv1.3",
+			},
+			logging: "WARN ignoring ssl profile 'modern': cannot redeclare a builtin profile",
+		},
 	}
 	source := &Source{Namespace: "system", Name: "ing1", Type: "ingress"}
 	for i, test := range testCases {
@@ -0,0 +1,139 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package annotations
+
+import (
+	"sort"
+	"strings"
+
+	ingtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/types"
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/utils"
+)
+
+// configSnippets has the content of the injection points declared in the
+// ConfigMaps of the config-snippets global config, in the same order the
+// ConfigMaps were declared.
+type configSnippets struct {
+	global        []string
+	defaults      []string
+	frontend      []string
+	frontendHTTP  []string
+	frontendHTTPS []string
+	backends      []*backendSnippet
+}
+
+// backendSnippet is the content of a backend injection point. An empty
+// service means all the backends of the namespace.
+type backendSnippet struct {
+	namespace string
+	service   string
+	config    []string
+}
+
+// SnippetsConfigMapNames returns the full name of the ConfigMaps declared
+// in the config-snippets global config, using namespace if the name
+// doesn't have one.
+func SnippetsConfigMapNames(config, namespace string) []string {
+	var names []string
+	for _, name := range utils.Split(config, ",") {
+		if name != "" {
+			names = append(names, FullConfigMapName(name, namespace))
+		}
+	}
+	return names
+}
+
+// readConfigSnippets reads and validates the ConfigMaps of the config-snippets
+// global config. Global, defaults and frontend injection points can only be
+// declared in the controller namespace. Backend injection points only apply to
+// the backends of the ConfigMap namespace, and follow the same restrictions of
+// the config-backend snippet if declared outside the controller namespace.
+// The result is read once and reused by the global and all the backends.
+func (c *updater) readConfigSnippets(mapper *Mapper) *configSnippets {
+	if c.snippets != nil {
+		return c.snippets
+	}
+	c.snippets = &configSnippets{}
+	podNamespace := c.cache.GetPodNamespace()
+	allowedNS := utils.Split(mapper.Get(ingtypes.GlobalConfigBackendAllowedNS).Value, ",")
+	forbidden := utils.Split(mapper.Get(ingtypes.GlobalConfigBackendForbidden).Value, ",")
+	for _, cmName := range SnippetsConfigMapNames(mapper.Get(ingtypes.GlobalConfigSnippets).Value, podNamespace) {
+		cm, err := c.cache.GetConfigMap(cmName)
+		if err != nil {
+			c.logger.Error("error reading config snippets: %v", err)
+			continue
+		}
+		trusted := podNamespace != "" && cm.Namespace == podNamespace
+		keys := make([]string, 0, len(cm.Data))
+		for key := range cm.Data {
+			keys = append(keys, key)
+		}
+		// `backend` sorts before `backend.<service>`
+		sort.Strings(keys)
+		for _, key := range keys {
+			config := utils.LineToSlice(cm.Data[key])
+			var point *[]string
+			switch key {
+			case "global":
+				point = &c.snippets.global
+			case "defaults":
+				point = &c.snippets.defaults
+			case "frontend":
+				point = &c.snippets.frontend
+			case "frontend-http":
+				point = &c.snippets.frontendHTTP
+			case "frontend-https":
+				point = &c.snippets.frontendHTTPS
+			}
+			if point != nil {
+				if !trusted {
+					c.logger.Warn("ignoring injection point '%s' of configmap '%s': only configmaps of the controller namespace can declare it", key, cmName)
+					continue
+				}
+				*point = append(*point, config...)
+				continue
+			}
+			if key != "backend" && !strings.HasPrefix(key, "backend.") {
+				c.logger.Warn("ignoring injection point '%s' of configmap '%s': unsupported injection point", key, cmName)
+				continue
+			}
+			if !trusted {
+				allowed := false
+				for _, ns := range allowedNS {
+					if ns == "*" || ns == cm.Namespace {
+						allowed = true
+						break
+					}
+				}
+				if !allowed {
+					c.logger.Warn("ignoring injection point '%s' of configmap '%s': namespace '%s' is not allowed to declare configuration snippets", key, cmName, cm.Namespace)
+					continue
+				}
+				if keyword := findForbiddenKeyword(cm.Data[key], forbidden); keyword != "" {
+					c.logger.Warn("ignoring injection point '%s' of configmap '%s': forbidden keyword '%s'", key, cmName, keyword)
+					continue
+				}
+			}
+			c.snippets.backends = append(c.snippets.backends, &backendSnippet{
+				namespace: cm.Namespace,
+				service:   strings.TrimPrefix(strings.TrimPrefix(key, "backend"), "."),
+				config:    config,
+			})
+		}
+	}
+	return c.snippets
+}
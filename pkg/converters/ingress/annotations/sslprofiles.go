@@ -0,0 +1,125 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package annotations
+
+import (
+	"strings"
+
+	ingtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/types"
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/utils"
+)
+
+// sslProfile is a named set of TLS options of the bind of a host. Empty
+// options aren't configured in the host and use the global config instead.
+type sslProfile struct {
+	alpn         string
+	ciphers      string // TLS up to 1.2
+	cipherSuites string // TLS 1.3
+	curves       string
+	maxVer       string
+	minVer       string
+}
+
+// builtinSSLProfiles are based on the Mozilla's Server Side TLS guidelines.
+var builtinSSLProfiles = map[string]*sslProfile{
+	"modern": {
+		cipherSuites: "TLS_AES_128_GCM_SHA256:TLS_AES_256_GCM_SHA384:TLS_CHACHA20_POLY1305_SHA256",
+		curves:       "X25519:prime256v1:secp384r1",
+		minVer:       "TLSv1.3",
+	},
+	"intermediate": {
+		ciphers:      "ECDHE-ECDSA-AES128-GCM-SHA256:ECDHE-RSA-AES128-GCM-SHA256:ECDHE-ECDSA-AES256-GCM-SHA384:ECDHE-RSA-AES256-GCM-SHA384:ECDHE-ECDSA-CHACHA20-POLY1305:ECDHE-RSA-CHACHA20-POLY1305:DHE-RSA-AES128-GCM-SHA256:DHE-RSA-AES256-GCM-SHA384",
+		cipherSuites: "TLS_AES_128_GCM_SHA256:TLS_AES_256_GCM_SHA384:TLS_CHACHA20_POLY1305_SHA256",
+		curves:       "X25519:prime256v1:secp384r1",
+		minVer:       "TLSv1.2",
+	},
+	"old": {
+		ciphers:      "ECDHE-ECDSA-AES128-GCM-SHA256:ECDHE-RSA-AES128-GCM-SHA256:ECDHE-ECDSA-AES256-GCM-SHA384:ECDHE-RSA-AES256-GCM-SHA384:ECDHE-ECDSA-CHACHA20-POLY1305:ECDHE-RSA-CHACHA20-POLY1305:DHE-RSA-AES128-GCM-SHA256:DHE-RSA-AES256-GCM-SHA384:DHE-RSA-CHACHA20-POLY1305:ECDHE-ECDSA-AES128-SHA256:ECDHE-RSA-AES128-SHA256:ECDHE-ECDSA-AES128-SHA:ECDHE-RSA-AES128-SHA:ECDHE-ECDSA-AES256-SHA384:ECDHE-RSA-AES256-SHA384:ECDHE-ECDSA-AES256-SHA:ECDHE-RSA-AES256-SHA:DHE-RSA-AES128-SHA256:DHE-RSA-AES256-SHA256:AES128-GCM-SHA256:AES256-GCM-SHA384:AES128-SHA256:AES256-SHA256:AES128-SHA:AES256-SHA:DES-CBC3-SHA",
+		cipherSuites: "TLS_AES_128_GCM_SHA256:TLS_AES_256_GCM_SHA384:TLS_CHACHA20_POLY1305_SHA256",
+		curves:       "X25519:prime256v1:secp384r1",
+		minVer:       "TLSv1.0",
+	},
+}
+
+var sslVersions = map[string]bool{
+	"SSLv3": true, "TLSv1.0": true, "TLSv1.1": true, "TLSv1.2": true, "TLSv1.3": true,
+}
+
+// readSSLProfiles reads the custom profiles declared in the ssl-profiles
+// global config, one profile per line: the profile name followed by its
+// `option=value` pairs. The result also has the builtin profiles, and is
+// read once and reused by all the hosts.
+func (c *updater) readSSLProfiles(mapper *Mapper) map[string]*sslProfile {
+	if c.sslProfiles != nil {
+		return c.sslProfiles
+	}
+	c.sslProfiles = make(map[string]*sslProfile, len(builtinSSLProfiles))
+	for name, profile := range builtinSSLProfiles {
+		c.sslProfiles[name] = profile
+	}
+	for _, line := range utils.LineToSlice(mapper.Get(ingtypes.GlobalSSLProfiles).Value) {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		name := fields[0]
+		if _, found := builtinSSLProfiles[name]; found {
+			c.logger.Warn("ignoring ssl profile '%s': cannot redeclare a builtin profile", name)
+			continue
+		}
+		profile := &sslProfile{}
+		valid := true
+		for _, field := range fields[1:] {
+			option := strings.SplitN(field, "=", 2)
+			if len(option) != 2 || option[1] == "" {
+				c.logger.Warn("ignoring ssl profile '%s': invalid option: %s", name, field)
+				valid = false
+				break
+			}
+			value := option[1]
+			switch option[0] {
+			case "alpn":
+				profile.alpn = value
+			case "ciphers":
+				profile.ciphers = value
+			case "ciphersuites":
+				profile.cipherSuites = value
+			case "curves":
+				profile.curves = value
+			case "max-ver", "min-ver":
+				if !sslVersions[value] {
+					c.logger.Warn("ignoring ssl profile '%s': invalid %s: %s", name, option[0], value)
+					valid = false
+				} else if option[0] == "max-ver" {
+					profile.maxVer = value
+				} else {
+					profile.minVer = value
+				}
+			default:
+				c.logger.Warn("ignoring ssl profile '%s': unsupported option: %s", name, option[0])
+				valid = false
+			}
+			if !valid {
+				break
+			}
+		}
+		if valid {
+			c.sslProfiles[name] = profile
+		}
+	}
+	return c.sslProfiles
+}
@@ -19,6 +19,8 @@ package annotations
 import (
 	"net"
 	"regexp"
+	"strconv"
+	"strings"
 
 	ingtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/types"
 	convtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/types"
@@ -48,12 +50,14 @@ func NewUpdater(haproxy haproxy.Config, options *ingtypes.ConverterOptions) Upda
 }
 
 type updater struct {
-	haproxy haproxy.Config
-	options *ingtypes.ConverterOptions
-	logger  types.Logger
-	cache   convtypes.Cache
-	tracker convtypes.Tracker
-	fakeCA  convtypes.CrtFile
+	haproxy     haproxy.Config
+	options     *ingtypes.ConverterOptions
+	logger      types.Logger
+	cache       convtypes.Cache
+	tracker     convtypes.Tracker
+	fakeCA      convtypes.CrtFile
+	snippets    *configSnippets
+	sslProfiles map[string]*sslProfile
 }
 
 type globalData struct {
@@ -72,6 +76,9 @@ type backData struct {
 	mapper  *Mapper
 }
 
+// acmeChallengePrefix is the path prefix of the HTTP-01 challenges
+const acmeChallengePrefix = "/.well-known/acme-challenge/"
+
 var regexValidTime = regexp.MustCompile(`^[0-9]+(us|ms|s|m|h|d)$`)
 
 func (c *updater) validateTime(cfg *ConfigValue) string {
@@ -86,6 +93,36 @@ func (c *updater) validateTime(cfg *ConfigValue) string {
 	return cfg.Value
 }
 
+func (c *updater) validateRetries(cfg *ConfigValue) string {
+	if cfg.Value == "" {
+		return ""
+	}
+	if retries, err := strconv.Atoi(cfg.Value); err != nil || retries < 0 {
+		c.logger.Warn("ignoring invalid number of retries on %v: %s", cfg.Source, cfg.Value)
+		return ""
+	}
+	return cfg.Value
+}
+
+var retryOnKeywords = map[string]struct{}{
+	"none": {}, "conn-failure": {}, "empty-response": {}, "junk-response": {},
+	"response-timeout": {}, "0rtt-rejected": {}, "all-retryable-errors": {},
+	"401": {}, "403": {}, "404": {}, "408": {}, "425": {},
+	"500": {}, "501": {}, "502": {}, "503": {}, "504": {},
+}
+
+func (c *updater) validateRetryOn(cfg *ConfigValue) string {
+	var keywords []string
+	for _, keyword := range strings.FieldsFunc(cfg.Value, func(r rune) bool { return r == ',' || r == ' ' }) {
+		if _, found := retryOnKeywords[keyword]; !found {
+			c.logger.Warn("ignoring invalid retry-on keyword on %v: %s", cfg.Source, keyword)
+			continue
+		}
+		keywords = append(keywords, keyword)
+	}
+	return strings.Join(keywords, " ")
+}
+
 func (c *updater) splitCIDR(cidrlist *ConfigValue) []string {
 	allow, deny := c.splitDualCIDR(cidrlist)
 	if len(deny) > 0 {
@@ -133,11 +170,13 @@ func (c *updater) UpdateGlobalConfig(haproxyConfig haproxy.Config, mapper *Mappe
 	d.global.MaxConn = mapper.Get(ingtypes.GlobalMaxConnections).Int()
 	d.global.DefaultBackendRedir = mapper.Get(ingtypes.GlobalDefaultBackendRedirect).String()
 	d.global.DefaultBackendRedirCode = mapper.Get(ingtypes.GlobalDefaultBackendRedirectCode).Int()
+	d.global.DefaultPages = c.options.DefaultPages
 	d.global.DrainSupport.Drain = mapper.Get(ingtypes.GlobalDrainSupport).Bool()
 	d.global.DrainSupport.Redispatch = mapper.Get(ingtypes.GlobalDrainSupportRedispatch).Bool()
 	d.global.Cookie.Key = mapper.Get(ingtypes.GlobalCookieKey).Value
 	d.global.External.HasLua = mapper.Get(ingtypes.GlobalExternalHasLua).Bool()
 	d.global.External.MasterSocket = c.options.MasterSocket
+	d.global.External.Remote = c.options.RemoteHAProxy
 	d.global.LoadServerState = mapper.Get(ingtypes.GlobalLoadServerState).Bool()
 	d.global.Master.ExitOnFailure = mapper.Get(ingtypes.GlobalMasterExitOnFailure).Bool()
 	d.global.Master.WorkerMaxReloads = mapper.Get(ingtypes.GlobalWorkerMaxReloads).Int()
@@ -149,18 +188,26 @@ func (c *updater) UpdateGlobalConfig(haproxyConfig haproxy.Config, mapper *Mappe
 	c.buildGlobalAcme(d)
 	c.buildGlobalAuthProxy(d)
 	c.buildGlobalBind(d)
+	c.buildGlobalBotMitigation(d)
 	c.buildGlobalCustomConfig(d)
 	c.buildGlobalDNS(d)
+	c.buildGlobalErrorPages(d)
 	c.buildGlobalForwardFor(d)
 	c.buildGlobalHTTPStoHTTP(d)
 	c.buildGlobalModSecurity(d)
 	c.buildGlobalPathTypeOrder(d)
 	c.buildGlobalProc(d)
+	c.buildGlobalRealIP(d)
 	c.buildSecurity(d)
+	c.buildGlobalSourceAllowlist(d)
+	c.buildGlobalSPOEAgents(d)
 	c.buildGlobalSSL(d)
 	c.buildGlobalStats(d)
 	c.buildGlobalSyslog(d)
 	c.buildGlobalTimeout(d)
+	c.buildGlobalTracing(d)
+	c.buildGlobalTune(d)
+	c.buildGlobalHardening(d)
 }
 
 func (c *updater) UpdateHostConfig(host *hatypes.Host, mapper *Mapper) {
@@ -169,13 +216,15 @@ func (c *updater) UpdateHostConfig(host *hatypes.Host, mapper *Mapper) {
 		mapper: mapper,
 	}
 	host.RootRedirect = mapper.Get(ingtypes.HostAppRoot).Value
-	host.Alias.AliasName = mapper.Get(ingtypes.HostServerAlias).Value
-	host.Alias.AliasRegex = mapper.Get(ingtypes.HostServerAliasRegex).Value
+	host.Internal = mapper.Get(ingtypes.HostInternal).Bool()
 	host.VarNamespace = mapper.Get(ingtypes.HostVarNamespace).Bool()
+	c.buildHostAlias(data)
 	c.buildHostAuthTLS(data)
+	c.buildHostBotMitigation(data)
 	c.buildHostCertSigner(data)
 	c.buildHostRedirect(data)
 	c.buildHostSSLPassthrough(data)
+	c.buildHostTenant(data)
 	c.buildHostTLSConfig(data)
 }
 
@@ -185,19 +234,23 @@ func (c *updater) UpdateBackendConfig(backend *hatypes.Backend, mapper *Mapper)
 		mapper:  mapper,
 	}
 	// TODO check ModeTCP with HTTP annotations
-	backend.BalanceAlgorithm = mapper.Get(ingtypes.BackBalanceAlgorithm).Value
-	backend.CustomConfig = utils.LineToSlice(mapper.Get(ingtypes.BackConfigBackend).Value)
-	backend.Server.MaxConn = mapper.Get(ingtypes.BackMaxconnServer).Int()
-	backend.Server.MaxQueue = mapper.Get(ingtypes.BackMaxQueueServer).Int()
+	c.buildBackendAccessLog(data)
 	c.buildBackendAffinity(data)
 	c.buildBackendAuthExternal(data)
 	c.buildBackendAuthHTTP(data)
+	c.buildBackendAuthPassthrough(data)
+	c.buildBackendBalance(data)
 	c.buildBackendBlueGreenBalance(data)
 	c.buildBackendBlueGreenSelector(data)
 	c.buildBackendBodySize(data)
+	c.buildBackendCache(data)
+	c.buildBackendConfigSnippet(data)
+	c.buildBackendConfigSnippets(data)
+	c.buildBackendConnection(data)
 	c.buildBackendCors(data)
 	c.buildBackendDNS(data)
 	c.buildBackendDynamic(data)
+	c.buildBackendFallback(data)
 	c.buildBackendAgentCheck(data)
 	c.buildBackendHeaders(data)
 	c.buildBackendHealthCheck(data)
@@ -206,12 +259,21 @@ func (c *updater) UpdateBackendConfig(backend *hatypes.Backend, mapper *Mapper)
 	c.buildBackendOAuth(data)
 	c.buildBackendProtocol(data)
 	c.buildBackendProxyProtocol(data)
+	c.buildBackendRequestBuffer(data)
+	c.buildBackendRetry(data)
 	c.buildBackendRewriteURL(data)
+	c.buildBackendSecurityHeaders(data)
 	c.buildBackendServerNaming(data)
+	c.buildBackendIPFamily(data)
+	c.buildBackendSource(data)
+	c.buildBackendSPOEAgents(data)
 	c.buildBackendSSL(data)
 	c.buildBackendSSLRedirect(data)
 	c.buildBackendTimeout(data)
+	c.buildBackendTracing(data)
+	c.buildBackendTrafficPolicy(data)
 	c.buildBackendWAF(data)
+	c.buildBackendWebSocket(data)
 	c.buildBackendWhitelistHTTP(data)
 	c.buildBackendWhitelistTCP(data)
 }
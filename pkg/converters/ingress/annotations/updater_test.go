@@ -24,6 +24,7 @@ import (
 
 	conv_helper "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/helper_test"
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/tracker"
+	ingtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/types"
 	convtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/types"
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy"
 	hatypes "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/types"
@@ -135,6 +136,7 @@ func (c *testConfig) teardown() {
 func (c *testConfig) createUpdater() *updater {
 	return &updater{
 		haproxy: c.haproxy,
+		options: &ingtypes.ConverterOptions{},
 		cache:   c.cache,
 		logger:  c.logger,
 		tracker: c.tracker,
@@ -19,6 +19,7 @@ package annotations
 import (
 	"regexp"
 	"strconv"
+	"strings"
 
 	ingtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/types"
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/types"
@@ -37,7 +38,13 @@ var (
 	corsHeadersRegex = regexp.MustCompile(`^([A-Za-z0-9\-\_]+,?\s?)+$`)
 )
 
+var referrerPolicies = map[string]bool{
+	"no-referrer": true, "no-referrer-when-downgrade": true, "origin": true, "origin-when-cross-origin": true,
+	"same-origin": true, "strict-origin": true, "strict-origin-when-cross-origin": true, "unsafe-url": true,
+}
+
 var validators = map[string]func(v validate) (string, bool){
+	ingtypes.BackAccessLog:            validateBool,
 	ingtypes.BackCorsAllowCredentials: validateBool,
 	ingtypes.BackCorsAllowHeaders: func(v validate) (string, bool) {
 		if corsHeadersRegex.MatchString(v.value) {
@@ -80,6 +87,35 @@ var validators = map[string]func(v validate) (string, bool){
 	ingtypes.BackHSTSPreload:           validateBool,
 	ingtypes.BackHSTSIncludeSubdomains: validateBool,
 	ingtypes.BackSSLRedirect:           validateBool,
+	ingtypes.BackContentSecurityPolicy: func(v validate) (string, bool) {
+		// a multiline policy is joined in a single line
+		policy := strings.Join(strings.Fields(v.value), " ")
+		if strings.ContainsAny(policy, `"\`) {
+			v.logger.Warn("ignoring invalid content security policy on %s: %s", v.source, v.value)
+			return "", false
+		}
+		return policy, true
+	},
+	ingtypes.BackReferrerPolicy: func(v validate) (string, bool) {
+		// a list of policies is used as fallbacks by the browser
+		policies := strings.Split(v.value, ",")
+		for i, policy := range policies {
+			policies[i] = strings.TrimSpace(policy)
+			if !referrerPolicies[policies[i]] {
+				v.logger.Warn("ignoring invalid referrer policy on %s: %s", v.source, v.value)
+				return "", false
+			}
+		}
+		return strings.Join(policies, ", "), true
+	},
+	ingtypes.BackXFrameOptions: func(v validate) (string, bool) {
+		options := strings.ToUpper(v.value)
+		if options != "DENY" && options != "SAMEORIGIN" {
+			v.logger.Warn("ignoring invalid frame options on %s: %s", v.source, v.value)
+			return "", false
+		}
+		return options, true
+	},
 }
 
 func validateBool(v validate) (string, bool) {
@@ -26,6 +26,8 @@ const (
 	defaultSSLCiphers = "ECDHE-ECDSA-AES128-GCM-SHA256:ECDHE-RSA-AES128-GCM-SHA256:ECDHE-ECDSA-AES256-GCM-SHA384:ECDHE-RSA-AES256-GCM-SHA384:ECDHE-ECDSA-CHACHA20-POLY1305:ECDHE-RSA-CHACHA20-POLY1305:DHE-RSA-AES128-GCM-SHA256:DHE-RSA-AES256-GCM-SHA384"
 	// TLS 1.3
 	defaultSSLCipherSuites = "TLS_AES_128_GCM_SHA256:TLS_AES_256_GCM_SHA384:TLS_CHACHA20_POLY1305_SHA256"
+	// fields of the JSON formatted HTTP log
+	defaultHTTPLogJSONFields = "timestamp,client_ip,client_port,frontend,backend,server,method,uri,status,bytes_read,time_request,time_queue,time_connect,time_response,time_total,termination_state"
 )
 
 func createDefaults() map[string]string {
@@ -35,16 +37,22 @@ func createDefaults() map[string]string {
 		types.HostSSLCiphers:         defaultSSLCiphers,
 		types.HostSSLCipherSuites:    defaultSSLCipherSuites,
 		types.HostSSLOptionsHost:     "",
+		types.HostSSLProfile:         "",
 		types.HostTLSALPN:            "h2,http/1.1",
 		//
+		types.BackAccessLog:              "true",
 		types.BackBackendServerNaming:    "sequence",
 		types.BackBackendServerSlotsInc:  "1",
 		types.BackSlotsMinFree:           "6",
 		types.BackBalanceAlgorithm:       "roundrobin",
+		types.BackCacheEnable:            "false",
+		types.BackCacheMaxAge:            "60s",
+		types.BackCacheTotalSize:         "4m",
 		types.BackCorsAllowHeaders:       "DNT,X-CustomHeader,Keep-Alive,User-Agent,X-Requested-With,If-Modified-Since,Cache-Control,Content-Type,Authorization",
 		types.BackCorsAllowMethods:       "GET, PUT, POST, DELETE, PATCH, OPTIONS",
 		types.BackCorsAllowOrigin:        "*",
 		types.BackCorsMaxAge:             "86400",
+		types.BackAuthPassthrough:        "false",
 		types.BackDynamicScaling:         "true",
 		types.BackHealthCheckInterval:    "2s",
 		types.BackHSTS:                   "true",
@@ -52,7 +60,12 @@ func createDefaults() map[string]string {
 		types.BackHSTSMaxAge:             "15768000",
 		types.BackHSTSPreload:            "false",
 		types.BackInitialWeight:          "1",
+		types.BackLimitConnectionsAction: "deny",
+		types.BackLimitKey:               "src",
+		types.BackLimitTableExpire:       "5m",
+		types.BackLimitTableSize:         "200k",
 		types.BackOAuthHeaders:           "X-Auth-Request-Email:req.auth_response_header.x_auth_request_email",
+		types.BackSecureVerify:           "required",
 		types.BackSessionCookieDynamic:   "true",
 		types.BackSessionCookiePreserve:  "false",
 		types.BackSessionCookieValue:     "server-name",
@@ -67,10 +80,17 @@ func createDefaults() map[string]string {
 		types.BackTimeoutServer:          "50s",
 		types.BackTimeoutServerFin:       "50s",
 		types.BackTimeoutTunnel:          "1h",
+		types.BackTracingEnable:          "true",
+		types.BackTracingHeaderFormat:    "w3c",
+		types.BackTracingMode:            "none",
+		types.BackTrafficPolicy:          "cluster",
 		types.BackWAFMode:                "deny",
 		//
 		types.GlobalAcmeExpiring:                 "30",
 		types.GlobalAuthProxy:                    "_front__auth:14415-14499",
+		types.GlobalBindIPFamily:                 "ipv4",
+		types.GlobalConfigBackendAllowedNS:       "*",
+		types.GlobalConfigBackendForbidden:       "ca-file,crl-file,crt,errorfile,external-check,lua,-f",
 		types.GlobalCookieKey:                    "Ingress",
 		types.GlobalDNSAcceptedPayloadSize:       "8192",
 		types.GlobalDNSClusterDomain:             "cluster.local",
@@ -79,7 +99,14 @@ func createDefaults() map[string]string {
 		types.GlobalDNSTimeoutRetry:              "1s",
 		types.GlobalDrainSupportRedispatch:       "true",
 		types.GlobalForwardfor:                   "add",
+		types.GlobalHardeningConnRate:            "200",
+		types.GlobalHardeningHTTPErrRate:         "100",
+		types.GlobalHardeningHTTPReqRate:         "1000",
+		types.GlobalHardeningMaxConnHeadroom:     "25",
+		types.GlobalHardeningProfile:             "none",
+		types.GlobalHardeningTableSize:           "1m",
 		types.GlobalHealthzPort:                  "10253",
+		types.GlobalHostConflictPolicy:           "merge",
 		types.GlobalHTTPPort:                     "80",
 		types.GlobalHTTPSPort:                    "443",
 		types.GlobalMasterExitOnFailure:          "true",
@@ -89,14 +116,18 @@ func createDefaults() map[string]string {
 		types.GlobalModsecurityTimeoutIdle:       "30s",
 		types.GlobalModsecurityTimeoutProcessing: "1s",
 		types.GlobalModsecurityTimeoutServer:     "5s",
+		types.GlobalNamespaceConfigKeys:          "access-log,access-log-sample-ratio,proxy-body-size,timeout-connect,timeout-http-request,timeout-keep-alive,timeout-queue,timeout-server,timeout-server-fin,timeout-tunnel",
 		types.GlobalNbprocBalance:                "1",
 		types.GlobalNbthread:                     "2",
 		types.GlobalNoTLSRedirectLocations:       "/.well-known/acme-challenge",
 		types.GlobalPathTypeOrder:                "exact,prefix,begin,regex",
+		types.GlobalRealIPHeader:                 "X-Forwarded-For",
+		types.GlobalServicePortGracePeriod:       "5m",
 		types.GlobalSSLDHDefaultMaxSize:          "2048",
 		types.GlobalSSLHeadersPrefix:             "X-SSL",
 		types.GlobalSSLOptions:                   defaultSSLOptions,
 		types.GlobalStatsPort:                    "1936",
+		types.GlobalHTTPLogJSONFields:            defaultHTTPLogJSONFields,
 		types.GlobalSyslogFormat:                 "rfc5424",
 		types.GlobalSyslogLength:                 "1024",
 		types.GlobalSyslogTag:                    "ingress",
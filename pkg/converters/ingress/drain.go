@@ -0,0 +1,118 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingress
+
+import (
+	"strings"
+	"time"
+
+	networking "k8s.io/api/networking/v1"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/annotations"
+	ingtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/types"
+	hatypes "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/types"
+)
+
+// syncDrainingHosts adds the hostnames of the removed ingress resources
+// that declare a drain period, and updates the haproxy model of all the
+// draining hosts. Draining hosts aren't tracked: a full sync clears and
+// acquires them again, and an ingress resource that declares a draining
+// hostname creates it from scratch, ending its drain period. A sync is
+// scheduled to the expiration of every drain period, so the hostname is
+// removed even if nothing else changes in the cluster.
+func (c *converter) syncDrainingHosts() {
+	now := time.Now()
+	for _, ing := range c.changed.IngressesDel {
+		c.addDrainingHosts(ing, now)
+	}
+	hosts := c.haproxy.Hosts()
+	for hostname, drain := range c.options.DrainingHosts {
+		host := hosts.FindHost(hostname)
+		if host != nil && (!host.Drain.Draining || len(host.Paths) > 0) {
+			// declared again by an ingress resource
+			host.Drain = hatypes.HostDrainConfig{}
+			delete(c.options.DrainingHosts, hostname)
+		} else if !now.Before(drain.Expire) {
+			delete(c.options.DrainingHosts, hostname)
+			if host != nil {
+				hosts.RemoveAll([]string{hostname})
+			}
+		} else if host == nil {
+			host = hosts.AcquireHost(hostname)
+			host.Drain = hatypes.HostDrainConfig{
+				Draining: true,
+				Location: drain.Location,
+			}
+		}
+	}
+}
+
+// addDrainingHosts starts the drain period of the hostnames declared by
+// a removed ingress resource, provided that they aren't declared by any
+// other ingress resource.
+func (c *converter) addDrainingHosts(ing *networking.Ingress, now time.Time) {
+	source := &annotations.Source{
+		Namespace: ing.Namespace,
+		Name:      ing.Name,
+		Type:      "ingress",
+	}
+	annHost, _ := c.readAnnotations(source, ing.Annotations)
+	readConfig := func(key string) string {
+		if value, found := annHost[key]; found {
+			return value
+		}
+		return c.globalConfig.Get(key).Value
+	}
+	period := readConfig(ingtypes.HostDrainPeriod)
+	if period == "" {
+		return
+	}
+	duration, err := time.ParseDuration(period)
+	if err != nil || duration < 0 {
+		c.logger.Warn("ignoring invalid host drain period on %v: %s", source, period)
+		return
+	}
+	if duration == 0 {
+		return
+	}
+	var location string
+	response := readConfig(ingtypes.HostDrainResponse)
+	if strings.HasPrefix(response, "http://") || strings.HasPrefix(response, "https://") {
+		location = response
+	} else if response != "" && response != "410" {
+		c.logger.Warn("ignoring invalid host drain response on %v, using 410: %s", source, response)
+	}
+	hosts := c.haproxy.Hosts()
+	var added bool
+	for _, rule := range ing.Spec.Rules {
+		hostname := rule.Host
+		if hostname == "" || hostname == hatypes.DefaultHost {
+			continue
+		}
+		if host := hosts.FindHost(hostname); host != nil && !host.Drain.Draining {
+			continue
+		}
+		c.options.DrainingHosts[hostname] = &ingtypes.DrainingHost{
+			Expire:   now.Add(duration),
+			Location: location,
+		}
+		added = true
+	}
+	if added {
+		c.cache.ScheduleSync(now.Add(duration))
+	}
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingress
+
+import (
+	"testing"
+	"time"
+
+	networking "k8s.io/api/networking/v1"
+
+	ingtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/types"
+)
+
+func TestSyncDrainingHosts(t *testing.T) {
+	testCases := []struct {
+		global    map[string]string
+		ann       map[string]string
+		expFront  string
+		expSyncAt bool
+		expLog    string
+	}{
+		// 0
+		{
+			expFront: `
+- hostname: d2.local
+  paths:
+  - path: /
+    backend: default_echo_8080`,
+		},
+		// 1
+		{
+			ann: map[string]string{
+				"ingress.kubernetes.io/host-drain-period": "10m",
+			},
+			expFront: `
+- hostname: d1.local
+  paths: []
+  drain:
+    draining: true
+- hostname: d2.local
+  paths:
+  - path: /
+    backend: default_echo_8080`,
+			expSyncAt: true,
+		},
+		// 2
+		{
+			global: map[string]string{
+				ingtypes.HostDrainPeriod: "10m",
+			},
+			ann: map[string]string{
+				"ingress.kubernetes.io/host-drain-response": "https://app.local/moved",
+			},
+			expFront: `
+- hostname: d1.local
+  paths: []
+  drain:
+    draining: true
+    location: https://app.local/moved
+- hostname: d2.local
+  paths:
+  - path: /
+    backend: default_echo_8080`,
+			expSyncAt: true,
+		},
+		// 3
+		{
+			ann: map[string]string{
+				"ingress.kubernetes.io/host-drain-period": "0",
+			},
+			expFront: `
+- hostname: d2.local
+  paths:
+  - path: /
+    backend: default_echo_8080`,
+		},
+		// 4
+		{
+			ann: map[string]string{
+				"ingress.kubernetes.io/host-drain-period": "10",
+			},
+			expFront: `
+- hostname: d2.local
+  paths:
+  - path: /
+    backend: default_echo_8080`,
+			expLog: `
+WARN ignoring invalid host drain period on ingress 'default/ing1': 10`,
+		},
+		// 5
+		{
+			ann: map[string]string{
+				"ingress.kubernetes.io/host-drain-period":   "10m",
+				"ingress.kubernetes.io/host-drain-response": "/moved",
+			},
+			expFront: `
+- hostname: d1.local
+  paths: []
+  drain:
+    draining: true
+- hostname: d2.local
+  paths:
+  - path: /
+    backend: default_echo_8080`,
+			expSyncAt: true,
+			expLog: `
+WARN ignoring invalid host drain response on ingress 'default/ing1', using 410: /moved`,
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		c.cache.Changed.GlobalNew = test.global
+		if c.cache.Changed.GlobalNew == nil {
+			c.cache.Changed.GlobalNew = map[string]string{}
+		}
+		c.createSvc1("default/echo", "8080", "172.17.0.11")
+		ing1 := c.createIng1Ann("default/ing1", "d1.local", "/", "echo:8080", test.ann)
+		ing2 := c.createIng1("default/ing2", "d2.local", "/", "echo:8080")
+		c.Sync(ing1, ing2)
+		c.hconfig.Commit()
+		c.logger.Logging = []string{}
+		c.cache.Changed.IngressesDel = []*networking.Ingress{ing1}
+		c.Sync()
+		c.compareConfigFront(test.expFront)
+		if syncAt := !c.cache.SyncAt.IsZero(); syncAt != test.expSyncAt {
+			t.Errorf("%d: expected scheduled sync '%t' but was '%t'", i, test.expSyncAt, syncAt)
+		}
+		c.logger.CompareLogging("INFO-V(2) syncing 2 host(s) and 1 backend(s)" + test.expLog)
+		c.teardown()
+	}
+}
+
+func TestSyncDrainingHostsUpdate(t *testing.T) {
+	testCases := []struct {
+		expire   time.Duration
+		ingAdd   bool
+		expFront string
+		expLog   string
+	}{
+		// 0
+		{
+			expire: time.Minute,
+			expFront: `
+- hostname: d1.local
+  paths: []
+  drain:
+    draining: true`,
+			expLog: `INFO-V(2) syncing 0 host(s) and 0 backend(s)`,
+		},
+		// 1
+		{
+			expire:   -time.Minute,
+			expFront: `[]`,
+			expLog:   `INFO-V(2) syncing 0 host(s) and 0 backend(s)`,
+		},
+		// 2
+		{
+			expire: time.Minute,
+			ingAdd: true,
+			expFront: `
+- hostname: d1.local
+  paths:
+  - path: /
+    backend: default_echo_8080`,
+			expLog: `INFO-V(2) syncing 1 host(s) and 0 backend(s)`,
+		},
+	}
+	for _, test := range testCases {
+		c := setup(t)
+		c.createSvc1("default/echo", "8080", "172.17.0.11")
+		c.drains["d1.local"] = &ingtypes.DrainingHost{Expire: time.Now().Add(test.expire)}
+		c.Sync()
+		c.hconfig.Commit()
+		c.logger.Logging = []string{}
+		if test.ingAdd {
+			c.cache.Changed.IngressesAdd = []*networking.Ingress{
+				c.createIng1("default/ing1", "d1.local", "/", "echo:8080"),
+			}
+		}
+		c.Sync()
+		c.compareConfigFront(test.expFront)
+		c.logger.CompareLogging(test.expLog)
+		c.teardown()
+	}
+}
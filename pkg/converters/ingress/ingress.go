@@ -17,12 +17,15 @@ limitations under the License.
 package ingress
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"reflect"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
+	"gopkg.in/yaml.v2"
 	api "k8s.io/api/core/v1"
 	networking "k8s.io/api/networking/v1"
 
@@ -34,6 +37,7 @@ import (
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy"
 	hatypes "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/types"
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/types"
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/utils"
 )
 
 // Config ...
@@ -46,11 +50,19 @@ func NewIngressConverter(options *ingtypes.ConverterOptions, haproxy haproxy.Con
 	if options.DefaultConfig == nil {
 		options.DefaultConfig = createDefaults
 	}
+	if options.ServicePorts == nil {
+		options.ServicePorts = map[string]*ingtypes.ServicePort{}
+	}
+	if options.DrainingHosts == nil {
+		options.DrainingHosts = map[string]*ingtypes.DrainingHost{}
+	}
+	if options.Conditions == nil {
+		options.Conditions = map[string]*ingtypes.IngressConditions{}
+	}
 	changed := options.Cache.SwapChangedObjects()
 	// IMPLEMENT
 	// config option to allow partial parsing
 	// cache also need to know if partial parsing is enabled
-	needFullSync := options.Cache.NeedFullSync() || globalConfigNeedFullSync(changed)
 	globalConfig := changed.GlobalCur
 	if changed.GlobalNew != nil {
 		globalConfig = changed.GlobalNew
@@ -59,6 +71,20 @@ func NewIngressConverter(options *ingtypes.ConverterOptions, haproxy haproxy.Con
 	for key, value := range globalConfig {
 		defaultConfig[key] = value
 	}
+	var annPrefix string
+	if len(options.AnnotationPrefix) > 0 {
+		// used in the log messages, which refer to the prefix with the highest priority
+		annPrefix = options.AnnotationPrefix[0] + "/"
+	}
+	podNamespace := options.Cache.GetPodNamespace()
+	errorPages := annotations.FullConfigMapName(defaultConfig[ingtypes.GlobalErrorPages], podNamespace)
+	spoeAgents := annotations.FullConfigMapName(defaultConfig[ingtypes.GlobalSPOEAgentsConfigMap], podNamespace)
+	botMitigation := annotations.FullConfigMapName(defaultConfig[ingtypes.GlobalBotMitigationConfigMap], podNamespace)
+	snippets := annotations.SnippetsConfigMapNames(defaultConfig[ingtypes.GlobalConfigSnippets], podNamespace)
+	globalChangedKeys := globalConfigChangedKeys(changed, options.DefaultConfig)
+	needFullSync := options.Cache.NeedFullSync() ||
+		globalConfigNeedFullSync(changed, globalChangedKeys) ||
+		configMapNeedFullSync(changed, append(snippets, errorPages, spoeAgents, botMitigation)...)
 	return &converter{
 		haproxy:            haproxy,
 		options:            options,
@@ -66,13 +92,18 @@ func NewIngressConverter(options *ingtypes.ConverterOptions, haproxy haproxy.Con
 		logger:             options.Logger,
 		cache:              options.Cache,
 		tracker:            options.Tracker,
+		metrics:            options.Metrics,
 		defaultBackSource:  annotations.Source{Name: "<default-backend>", Type: "ingress"},
-		mapBuilder:         annotations.NewMapBuilder(options.Logger, options.AnnotationPrefix+"/", defaultConfig),
+		mapBuilder:         annotations.NewMapBuilder(options.Logger, annPrefix, defaultConfig),
 		updater:            annotations.NewUpdater(haproxy, options),
 		globalConfig:       annotations.NewMapBuilder(options.Logger, "", defaultConfig).NewMapper(),
 		hostAnnotations:    map[*hatypes.Host]*annotations.Mapper{},
 		backendAnnotations: map[*hatypes.Backend]*annotations.Mapper{},
 		ingressClasses:     map[string]*ingressClassConfig{},
+		namespaceConfigs:   map[string]*ingressClassConfig{},
+		hostOwners:         map[string]string{},
+		hostConflicts:      map[string]int{},
+		globalChangedKeys:  globalChangedKeys,
 		needFullSync:       needFullSync,
 	}
 }
@@ -84,6 +115,7 @@ type converter struct {
 	logger             types.Logger
 	cache              convtypes.Cache
 	tracker            convtypes.Tracker
+	metrics            types.Metrics
 	defaultCrt         convtypes.CrtFile
 	defaultBackSource  annotations.Source
 	mapBuilder         *annotations.MapBuilder
@@ -92,6 +124,11 @@ type converter struct {
 	hostAnnotations    map[*hatypes.Host]*annotations.Mapper
 	backendAnnotations map[*hatypes.Backend]*annotations.Mapper
 	ingressClasses     map[string]*ingressClassConfig
+	namespaceConfigs   map[string]*ingressClassConfig
+	hostOwners         map[string]string
+	hostConflicts      map[string]int
+	hostConflictReject bool
+	globalChangedKeys  []string
 	needFullSync       bool
 }
 
@@ -101,34 +138,186 @@ type ingressClassConfig struct {
 	config       map[string]string
 }
 
+// Sync parses the changed ingress resources and updates the haproxy model.
+// It runs in a single goroutine: the model and the tracker aren't thread
+// safe, only the rendering of the configuration files is made concurrently.
 func (c *converter) Sync() {
+	c.syncQuotas()
 	if c.needFullSync {
 		c.haproxy.Clear()
 	}
 	c.syncDefaultCrt()
+	c.hostConflictReject = c.readHostConflictPolicy()
 	if c.needFullSync {
 		c.syncFull()
 	} else {
 		c.syncPartial()
 	}
+	c.syncDrainingHosts()
 }
 
-func globalConfigNeedFullSync(changed *convtypes.ChangedObjects) bool {
-	// Currently if a global is changed, all the ingress objects are parsed again.
-	// This need to be done due to:
-	//
-	//   1. Default host and backend annotations. If a default value
-	//      changes, such default may impact any ingress object;
-	//   2. At the time of this writing, the following global
-	//      configuration keys are used during annotation parsing:
-	//        * GlobalDNSResolvers
-	//        * GlobalDrainSupport
-	//        * GlobalNoTLSRedirectLocations
-	//
-	// This might be improved after implement a way to guarantee that a global
-	// is just a haproxy global, default or frontend config.
-	cur, new := changed.GlobalCur, changed.GlobalNew
-	return new != nil && !reflect.DeepEqual(cur, new)
+// globalKeyImpact classifies the impact of a global config key change
+// in the haproxy model, see globalKeyImpacts.
+type globalKeyImpact int
+
+const (
+	// keyImpactFull is the impact of keys used during annotation parsing,
+	// either as a global config or as a default host or backend annotation.
+	// All the ingress objects need to be parsed again.
+	keyImpactFull globalKeyImpact = iota
+
+	// keyImpactGlobal is the impact of keys used in the global, defaults or
+	// backend sections of the configuration. Only the global config need to
+	// be parsed again, hosts and backends are preserved. Backend sections can
+	// be in backend shards, so all of them are rendered again.
+	keyImpactGlobal
+
+	// keyImpactFrontend is the impact of keys used only in the frontend
+	// sections of the configuration. Only the global config need to be parsed
+	// again, and only the main configuration file is rendered again.
+	keyImpactFrontend
+)
+
+// globalKeyImpacts has the global config keys whose changes don't need
+// a full sync. Keys missing here, including all the host and backend
+// annotations, default to keyImpactFull. Global config keys used during
+// annotation parsing, like GlobalDNSResolvers, GlobalDrainSupport,
+// GlobalExternalHasLua, GlobalNoTLSRedirectLocations, GlobalTracing* and
+// GlobalUseHTX, should not be added here. GlobalCookieKey is also missing
+// because it's used to build the cookie values of the backend servers,
+// and GlobalStrictHost because it's applied on changed hosts only.
+var globalKeyImpacts = map[string]globalKeyImpact{
+	ingtypes.GlobalBindIPAddrHealthz:            keyImpactFrontend,
+	ingtypes.GlobalBindIPAddrPrometheus:         keyImpactFrontend,
+	ingtypes.GlobalBindIPAddrStats:              keyImpactFrontend,
+	ingtypes.GlobalConfigDefaults:               keyImpactGlobal,
+	ingtypes.GlobalConfigFrontend:               keyImpactFrontend,
+	ingtypes.GlobalConfigGlobal:                 keyImpactGlobal,
+	ingtypes.GlobalConfigSections:               keyImpactGlobal,
+	ingtypes.GlobalCPUMap:                       keyImpactGlobal,
+	ingtypes.GlobalDefaultBackendRedirect:       keyImpactGlobal,
+	ingtypes.GlobalDefaultBackendRedirectCode:   keyImpactGlobal,
+	ingtypes.GlobalDNSAcceptedPayloadSize:       keyImpactGlobal,
+	ingtypes.GlobalDNSHoldObsolete:              keyImpactGlobal,
+	ingtypes.GlobalDNSHoldValid:                 keyImpactGlobal,
+	ingtypes.GlobalDNSTimeoutRetry:              keyImpactGlobal,
+	ingtypes.GlobalDrainSupportRedispatch:       keyImpactGlobal,
+	ingtypes.GlobalGroupname:                    keyImpactGlobal,
+	ingtypes.GlobalHardeningConnRate:            keyImpactFrontend,
+	ingtypes.GlobalHardeningHTTPErrRate:         keyImpactFrontend,
+	ingtypes.GlobalHardeningHTTPReqRate:         keyImpactFrontend,
+	ingtypes.GlobalHardeningMaxConnHeadroom:     keyImpactGlobal,
+	ingtypes.GlobalHardeningProfile:             keyImpactGlobal,
+	ingtypes.GlobalHardeningTableSize:           keyImpactGlobal,
+	ingtypes.GlobalHealthzPort:                  keyImpactFrontend,
+	ingtypes.GlobalHTTPLogFormat:                keyImpactFrontend,
+	ingtypes.GlobalHTTPLogJSONFields:            keyImpactFrontend,
+	ingtypes.GlobalHTTPSLogFormat:               keyImpactFrontend,
+	ingtypes.GlobalLoadServerState:              keyImpactGlobal,
+	ingtypes.GlobalMasterExitOnFailure:          keyImpactGlobal,
+	ingtypes.GlobalMaxConnections:               keyImpactGlobal,
+	ingtypes.GlobalModsecurityEndpoints:         keyImpactGlobal,
+	ingtypes.GlobalModsecurityTimeoutConnect:    keyImpactGlobal,
+	ingtypes.GlobalModsecurityTimeoutHello:      keyImpactGlobal,
+	ingtypes.GlobalModsecurityTimeoutIdle:       keyImpactGlobal,
+	ingtypes.GlobalModsecurityTimeoutProcessing: keyImpactGlobal,
+	ingtypes.GlobalModsecurityTimeoutServer:     keyImpactGlobal,
+	ingtypes.GlobalNbprocBalance:                keyImpactGlobal,
+	ingtypes.GlobalNbprocSSL:                    keyImpactGlobal,
+	ingtypes.GlobalNbthread:                     keyImpactGlobal,
+	ingtypes.GlobalPrometheusPort:               keyImpactFrontend,
+	ingtypes.GlobalSSLDHDefaultMaxSize:          keyImpactGlobal,
+	ingtypes.GlobalSSLDHParam:                   keyImpactGlobal,
+	ingtypes.GlobalSSLEngine:                    keyImpactGlobal,
+	ingtypes.GlobalSSLModeAsync:                 keyImpactGlobal,
+	ingtypes.GlobalStatsAuth:                    keyImpactFrontend,
+	ingtypes.GlobalStatsPort:                    keyImpactFrontend,
+	ingtypes.GlobalStatsProxyProtocol:           keyImpactFrontend,
+	ingtypes.GlobalStatsSSLCert:                 keyImpactFrontend,
+	ingtypes.GlobalSyslogEndpoint:               keyImpactGlobal,
+	ingtypes.GlobalSyslogFormat:                 keyImpactGlobal,
+	ingtypes.GlobalSyslogLength:                 keyImpactGlobal,
+	ingtypes.GlobalSyslogTag:                    keyImpactGlobal,
+	ingtypes.GlobalTCPLogFormat:                 keyImpactGlobal,
+	ingtypes.GlobalTimeoutClient:                keyImpactGlobal,
+	ingtypes.GlobalTimeoutClientFin:             keyImpactGlobal,
+	ingtypes.GlobalTimeoutStop:                  keyImpactGlobal,
+	ingtypes.GlobalUseChroot:                    keyImpactGlobal,
+	ingtypes.GlobalUseCPUMap:                    keyImpactGlobal,
+	ingtypes.GlobalUseHAProxyUser:               keyImpactGlobal,
+	ingtypes.GlobalUsername:                     keyImpactGlobal,
+	ingtypes.GlobalWorkerMaxReloads:             keyImpactGlobal,
+}
+
+// globalConfigChangedKeys filters the global config keys changed in the
+// cache, see ChangedObjects.GlobalChangedKeys, returning only the keys whose
+// effective value, after merged with the default config, was changed.
+// Adding or removing a key with its default value is not a change.
+func globalConfigChangedKeys(changed *convtypes.ChangedObjects, defaultConfig func() map[string]string) []string {
+	if changed.GlobalNew == nil || len(changed.GlobalChangedKeys) == 0 {
+		return nil
+	}
+	defaults := defaultConfig()
+	value := func(config map[string]string, key string) (string, bool) {
+		if v, found := config[key]; found {
+			return v, true
+		}
+		v, found := defaults[key]
+		return v, found
+	}
+	var keys []string
+	for _, key := range changed.GlobalChangedKeys {
+		curValue, curFound := value(changed.GlobalCur, key)
+		newValue, newFound := value(changed.GlobalNew, key)
+		if curFound != newFound || curValue != newValue {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// globalConfigNeedFullSync returns true if any of the changed keys is used
+// during annotation parsing. If a default value of a host or backend
+// annotation changes, such default may impact any ingress object. Global
+// only changes are applied in the partial sync, see globalKeyImpacts.
+func globalConfigNeedFullSync(changed *convtypes.ChangedObjects, changedKeys []string) bool {
+	if changed.GlobalCur == nil && changed.GlobalNew != nil {
+		// first sync, there is no previous global config to compare with
+		return true
+	}
+	for _, key := range changedKeys {
+		if globalKeyImpacts[key] == keyImpactFull {
+			return true
+		}
+	}
+	return false
+}
+
+// globalConfigFrontendOnly returns true if all the changed keys are used only
+// in the frontend sections, so the backend shards don't need to be rendered.
+func globalConfigFrontendOnly(changedKeys []string) bool {
+	for _, key := range changedKeys {
+		if globalKeyImpacts[key] != keyImpactFrontend {
+			return false
+		}
+	}
+	return true
+}
+
+// configMapNeedFullSync returns true if any of cmNames, ConfigMaps used by
+// the global config, was changed. Such ConfigMaps aren't tracked by hostname
+// or backend, so a change should start a full sync.
+func configMapNeedFullSync(changed *convtypes.ChangedObjects, cmNames ...string) bool {
+	for _, cmList := range [][]*api.ConfigMap{changed.ConfigMapsDel, changed.ConfigMapsUpd, changed.ConfigMapsAdd} {
+		for _, cm := range cmList {
+			for _, cmName := range cmNames {
+				if cmName != "" && cm.Namespace+"/"+cm.Name == cmName {
+					return true
+				}
+			}
+		}
+	}
+	return false
 }
 
 func (c *converter) syncDefaultCrt() {
@@ -150,12 +339,35 @@ func (c *converter) syncDefaultCrt() {
 			c.needFullSync = true
 		}
 	}
-	if c.needFullSync && crt == c.options.FakeCrtFile {
+	if c.needFullSync && crt.Filename == c.options.FakeCrtFile.Filename {
 		c.logger.Info("using auto generated fake certificate")
 	}
 	frontend.DefaultCrtFile = crt.Filename
 	frontend.DefaultCrtHash = crt.SHA1Hash
 	c.defaultCrt = crt
+	pool, err := c.cache.GetTLSSecretPool()
+	if err != nil {
+		c.logger.Warn("ignoring default certificate pool due to an error reading its secrets: %v", err)
+	}
+	// haproxy selects the first declared certificate if more than one
+	// matches the same name, so the longest expiration time wins
+	sort.SliceStable(pool, func(i, j int) bool {
+		return pool[i].NotAfter.After(pool[j].NotAfter)
+	})
+	frontend.DefaultCrtPool = make([]*hatypes.CrtPoolFile, len(pool))
+	for i, crt := range pool {
+		names := append([]string{crt.CommonName}, crt.DNSNames...)
+		for _, name := range crt.DNSNames {
+			if name == crt.CommonName {
+				names = crt.DNSNames
+				break
+			}
+		}
+		frontend.DefaultCrtPool[i] = &hatypes.CrtPoolFile{
+			Filename: crt.Filename,
+			Names:    names,
+		}
+	}
 }
 
 func (c *converter) syncDefaultBackend() {
@@ -176,10 +388,24 @@ func (c *converter) syncFull() {
 		return
 	}
 	sortIngress(ingList)
+	c.sortIngressPriority(ingList)
 	c.syncDefaultBackend()
+	for name := range c.options.Conditions {
+		delete(c.options.Conditions, name)
+	}
 	for _, ing := range ingList {
 		c.syncIngress(ing)
 	}
+	for key := range c.options.ServicePorts {
+		if _, err := c.cache.GetService(key[:strings.LastIndex(key, ":")]); err != nil {
+			delete(c.options.ServicePorts, key)
+		}
+	}
+	c.metrics.ClearHostConflicts()
+	for hostname, count := range c.hostConflicts {
+		c.metrics.SetHostConflicts(hostname, count)
+	}
+	c.syncHostDefaultBackends(c.haproxy.Hosts().Items())
 	c.fullSyncAnnotations()
 	c.syncEndpointCookies()
 }
@@ -247,6 +473,18 @@ func (c *converter) syncPartial() {
 		c.logger.InfoV(2, "applying %d change notification(s): %v", len(c.changed.Objects), c.changed.Objects)
 	}
 
+	// global config changes that don't need a full sync
+	if len(c.globalChangedKeys) > 0 {
+		c.logger.InfoV(2, "applying global config change(s): %v", c.globalChangedKeys)
+		// global is only updated by UpdateGlobalConfig(), and some of its
+		// builders append items, so it must start from an empty state
+		*c.haproxy.Global() = hatypes.Global{}
+		c.updater.UpdateGlobalConfig(c.haproxy, c.globalConfig)
+		if !globalConfigFrontendOnly(c.globalChangedKeys) {
+			c.haproxy.Backends().ChangeAllShards()
+		}
+	}
+
 	// remove changed/deleted data
 	delIngNames := ing2names(c.changed.IngressesDel)
 	updIngNames := ing2names(c.changed.IngressesUpd)
@@ -261,6 +499,7 @@ func (c *converter) syncPartial() {
 	addCMNames := cm2names(c.changed.ConfigMapsAdd)
 	oldCMNames := append(delCMNames, updCMNames...)
 	delSvcNames := svc2names(c.changed.ServicesDel)
+	c.removeServicePorts(delSvcNames)
 	updSvcNames := svc2names(c.changed.ServicesUpd)
 	addSvcNames := svc2names(c.changed.ServicesAdd)
 	oldSvcNames := append(delSvcNames, updSvcNames...)
@@ -270,6 +509,7 @@ func (c *converter) syncPartial() {
 	updSecretNames := secret2names(c.changed.SecretsUpd)
 	addSecretNames := secret2names(c.changed.SecretsAdd)
 	oldSecretNames := append(delSecretNames, updSecretNames...)
+	oldSecretNames = append(oldSecretNames, c.changed.ExternalSecretsUpd...)
 	addPodNames := pod2names(c.changed.Pods)
 	c.trackAddedIngress()
 	dirtyIngs, dirtyHosts, dirtyBacks, dirtyUsers, dirtyStorages :=
@@ -292,6 +532,10 @@ func (c *converter) syncPartial() {
 	c.haproxy.AcmeData().Storages().RemoveAll(dirtyStorages)
 	c.logger.InfoV(2, "syncing %d host(s) and %d backend(s)", len(dirtyHosts), len(dirtyBacks))
 
+	for _, ing := range delIngNames {
+		delete(c.options.Conditions, ing)
+	}
+
 	// merge dirty and added ingress objects into a single list
 	ingMap := make(map[string]*networking.Ingress)
 	for _, ing := range dirtyIngs {
@@ -324,9 +568,14 @@ func (c *converter) syncPartial() {
 
 	// reinclude changed/added data
 	sortIngress(ingList)
+	c.sortIngressPriority(ingList)
 	for _, ing := range ingList {
 		c.syncIngress(ing)
 	}
+	for _, hostname := range dirtyHosts {
+		c.metrics.SetHostConflicts(hostname, c.hostConflicts[hostname])
+	}
+	c.syncHostDefaultBackends(c.haproxy.Hosts().ItemsAdd())
 	c.partialSyncAnnotations()
 	c.syncChangedEndpointCookies()
 }
@@ -394,21 +643,133 @@ func sortIngress(ingress []*networking.Ingress) {
 	})
 }
 
+func (c *converter) readHostConflictPolicy() bool {
+	switch policy := c.globalConfig.Get(ingtypes.GlobalHostConflictPolicy).String(); policy {
+	case "", "merge":
+		return false
+	case "reject":
+		return true
+	default:
+		c.logger.Warn("ignoring invalid host conflict policy '%s', using 'merge'", policy)
+		return false
+	}
+}
+
+// sortIngressPriority moves ingress resources with a higher host conflict
+// priority, configured in the IngressClass Parameters, to the start of the
+// list. Ingress resources with the same priority preserve their order.
+func (c *converter) sortIngressPriority(ingress []*networking.Ingress) {
+	if !c.hostConflictReject {
+		return
+	}
+	priorities := make(map[*networking.Ingress]int, len(ingress))
+	for _, ing := range ingress {
+		priorities[ing] = c.readHostConflictPriority(ing)
+	}
+	sort.SliceStable(ingress, func(i, j int) bool {
+		return priorities[ingress[i]] > priorities[ingress[j]]
+	})
+}
+
+func (c *converter) readHostConflictPriority(ing *networking.Ingress) int {
+	if ing.Spec.IngressClassName == nil {
+		return 0
+	}
+	ingressClass, err := c.cache.GetIngressClass(*ing.Spec.IngressClassName)
+	if err != nil {
+		return 0
+	}
+	var priority string
+	for _, rule := range ing.Spec.Rules {
+		hostname := rule.Host
+		if hostname == "" {
+			hostname = hatypes.DefaultHost
+		}
+		// track all the hostnames, a priority change should sort them again
+		priority = c.readParameters(ingressClass, hostname)[ingtypes.GlobalHostConflictPriority]
+	}
+	if priority == "" {
+		return 0
+	}
+	value, err := strconv.Atoi(priority)
+	if err != nil {
+		c.logger.Warn("ignoring host conflict priority of IngressClass '%s': invalid number: %s", ingressClass.Name, priority)
+		return 0
+	}
+	return value
+}
+
+// readRejectedHosts returns the hostnames of an ingress resource that
+// belong to another namespace, if the host conflict policy is reject. A
+// hostname belongs to the namespace of the first ingress declaring it.
+// Rejected hostnames are tracked, so the ingress is parsed again and
+// acquires the hostname as soon as its owner removes it.
+func (c *converter) readRejectedHosts(source *annotations.Source, ing *networking.Ingress) map[string]bool {
+	if !c.hostConflictReject {
+		return nil
+	}
+	var hostnames []string
+	for _, rule := range ing.Spec.Rules {
+		hostname := rule.Host
+		if hostname == "" {
+			hostname = hatypes.DefaultHost
+		}
+		hostnames = append(hostnames, hostname)
+	}
+	for _, tls := range ing.Spec.TLS {
+		hostnames = append(hostnames, tls.Hosts...)
+	}
+	rejected := map[string]bool{}
+	for _, hostname := range hostnames {
+		owner, found := c.hostOwners[hostname]
+		if !found {
+			c.hostOwners[hostname] = source.Namespace
+			continue
+		}
+		if owner == source.Namespace || rejected[hostname] {
+			continue
+		}
+		rejected[hostname] = true
+		c.hostConflicts[hostname]++
+		c.tracker.TrackHostname(convtypes.IngressType, source.FullName(), hostname)
+		c.logger.Warn("skipping host '%s' of %v: hostname belongs to namespace '%s'", hostname, source, owner)
+		c.ingressConditions(source).SkipHost(hostname, fmt.Sprintf("hostname belongs to namespace '%s'", owner))
+	}
+	return rejected
+}
+
+// ingressConditions returns the conditions of the ingress resource being
+// parsed, or nil if source isn't an ingress resource.
+func (c *converter) ingressConditions(source *annotations.Source) *ingtypes.IngressConditions {
+	return c.options.Conditions[source.FullName()]
+}
+
 func (c *converter) syncIngress(ing *networking.Ingress) {
+	start := time.Now()
+	defer func() { c.metrics.IngressParseTime(time.Since(start)) }()
 	fullIngName := fmt.Sprintf("%s/%s", ing.Namespace, ing.Name)
 	source := &annotations.Source{
 		Namespace: ing.Namespace,
 		Name:      ing.Name,
 		Type:      "ingress",
 	}
-	annHost, annBack := c.readAnnotations(ing.Annotations)
+	conditions := &ingtypes.IngressConditions{}
+	c.options.Conditions[fullIngName] = conditions
+	if reason, found := c.options.QuotaRejected[fullIngName]; found {
+		c.logger.Warn("skipping %v: %s", source, reason)
+		conditions.Rejected = reason
+		return
+	}
+	annHost, annBack := c.readAnnotations(source, ing.Annotations)
+	annPaths := c.readPathConfig(source, annBack)
+	rejectedHosts := c.readRejectedHosts(source, ing)
 	if ing.Spec.DefaultBackend != nil {
 		svcName, svcPort, err := readServiceNamePort(ing.Spec.DefaultBackend)
 		if err == nil {
 			err = c.addDefaultHostBackend(source, ing.Namespace+"/"+svcName, svcPort, annHost, annBack)
 		}
 		if err != nil {
-			c.logger.Warn("skipping default backend of ingress '%s': %v", fullIngName, err)
+			c.logger.Warn("skipping default backend of %v: %v", source, err)
 		}
 	}
 	for _, rule := range ing.Spec.Rules {
@@ -419,26 +780,34 @@ func (c *converter) syncIngress(ing *networking.Ingress) {
 		if hostname == "" {
 			hostname = hatypes.DefaultHost
 		}
+		if rejectedHosts[hostname] {
+			continue
+		}
 		ingressClass := c.readIngressClass(source, hostname, ing.Spec.IngressClassName)
-		host := c.addHost(hostname, source, annHost)
+		host := c.addHost(hostname, source, c.readClassHostAnn(ingressClass, hostname, annHost))
 		for _, path := range rule.HTTP.Paths {
 			uri := path.Path
 			if uri == "" {
 				uri = "/"
 			}
 			if host.FindPath(uri) != nil {
-				c.logger.Warn("skipping redeclared path '%s' of ingress '%s'", uri, fullIngName)
+				c.logger.Warn("skipping redeclared path '%s' of %v", uri, source)
 				continue
 			}
 			svcName, svcPort, err := readServiceNamePort(&path.Backend)
 			if err != nil {
-				c.logger.Warn("skipping backend config of ingress '%s': %v", fullIngName, err)
+				c.logger.Warn("skipping backend config of %v: %v", source, err)
 				continue
 			}
 			fullSvcName := ing.Namespace + "/" + svcName
-			backend, err := c.addBackendWithClass(source, hostname, uri, fullSvcName, svcPort, annBack, ingressClass)
+			annPath := annBack
+			if ann, found := annPaths[uri]; found {
+				annPath = ann
+				delete(annPaths, uri)
+			}
+			backend, err := c.addBackendWithClass(source, hostname, uri, fullSvcName, svcPort, annPath, ingressClass)
 			if err != nil {
-				c.logger.Warn("skipping backend config of ingress '%s': %v", fullIngName, err)
+				c.logger.Warn("skipping backend config of %v: %v", source, err)
 				continue
 			}
 			match := c.readPathType(path, annHost[ingtypes.HostPathType])
@@ -446,13 +815,13 @@ func (c *converter) syncIngress(ing *networking.Ingress) {
 			sslpassthrough, _ := strconv.ParseBool(annHost[ingtypes.HostSSLPassthrough])
 			sslpasshttpport := annHost[ingtypes.HostSSLPassthroughHTTPPort]
 			if sslpassthrough && sslpasshttpport != "" {
-				if _, err := c.addBackend(source, hostname, uri, fullSvcName, sslpasshttpport, annBack); err != nil {
+				if _, err := c.addBackend(source, hostname, uri, fullSvcName, sslpasshttpport, annPath); err != nil {
 					c.logger.Warn("skipping http port config of ssl-passthrough on %v: %v", source, err)
 				}
 			}
 			// pre-building the auth-url backend
 			// TODO move to updater.buildBackendAuthExternal()
-			if url := annBack[ingtypes.BackAuthURL]; url != "" {
+			if url := annPath[ingtypes.BackAuthURL]; url != "" {
 				urlProto, urlHost, urlPort, _, _ := ingutils.ParseURL(url)
 				if (urlProto == "service" || urlProto == "svc") && urlHost != "" && urlPort != "" {
 					_, err := c.addBackend(source, hostname, uri, ing.Namespace+"/"+urlHost, urlPort, map[string]string{})
@@ -463,11 +832,18 @@ func (c *converter) syncIngress(ing *networking.Ingress) {
 			}
 		}
 	}
+	for uri := range annPaths {
+		c.logger.Warn("ignoring path config of '%s' on %v: path not found", uri, source)
+	}
 	for _, tls := range ing.Spec.TLS {
 		// tls secret
 		for _, hostname := range tls.Hosts {
+			if rejectedHosts[hostname] {
+				continue
+			}
 			host := c.addHost(hostname, source, annHost)
-			tlsPath := c.addTLS(source, hostname, tls.SecretName)
+			conditions.HasTLS = true
+			tlsPath := c.addTLS(source, hostname, tls.SecretName, annHost)
 			if host.TLS.TLSHash == "" {
 				host.TLS.TLSFilename = tlsPath.Filename
 				host.TLS.TLSHash = tlsPath.SHA1Hash
@@ -476,9 +852,9 @@ func (c *converter) syncIngress(ing *networking.Ingress) {
 			} else if host.TLS.TLSHash != tlsPath.SHA1Hash {
 				msg := fmt.Sprintf("TLS of host '%s' was already assigned", host.Hostname)
 				if tls.SecretName != "" {
-					c.logger.Warn("skipping TLS secret '%s' of ingress '%s': %s", tls.SecretName, fullIngName, msg)
+					c.logger.Warn("skipping TLS secret '%s' of %v: %s", tls.SecretName, source, msg)
 				} else {
-					c.logger.Warn("skipping default TLS secret of ingress '%s': %s", fullIngName, msg)
+					c.logger.Warn("skipping default TLS secret of %v: %s", source, msg)
 				}
 			}
 		}
@@ -493,17 +869,82 @@ func (c *converter) syncIngress(ing *networking.Ingress) {
 			tlsAcme = strings.ToLower(annHost[ingtypes.HostCertSigner]) == "acme"
 		}
 		if tlsAcme {
+			domains := tls.Hosts
+			if len(rejectedHosts) > 0 {
+				domains = nil
+				for _, hostname := range tls.Hosts {
+					if !rejectedHosts[hostname] {
+						domains = append(domains, hostname)
+					}
+				}
+			}
 			if tls.SecretName != "" {
 				secretName := ing.Namespace + "/" + tls.SecretName
-				c.haproxy.AcmeData().Storages().Acquire(secretName).AddDomains(tls.Hosts)
+				storage := c.haproxy.AcmeData().Storages().Acquire(secretName)
+				storage.AddDomains(domains)
+				c.readAcmeOptions(source, storage, annHost)
 				c.tracker.TrackStorage(convtypes.IngressType, fullIngName, secretName)
 			} else {
-				c.logger.Warn("skipping cert signer of ingress '%s': missing secret name", fullIngName)
+				c.logger.Warn("skipping cert signer of %v: missing secret name", source)
 			}
 		}
 	}
 }
 
+// readAcmeOptions reads the options of the acme order of a certificate. The
+// options are overwritten if more than one ingress declares the same secret.
+func (c *converter) readAcmeOptions(source *annotations.Source, storage *hatypes.AcmeCerts, annHost map[string]string) {
+	if keyType := annHost[ingtypes.HostAcmeKeyType]; keyType != "" {
+		switch keyType {
+		case "rsa2048", "rsa4096", "ecdsa256", "ecdsa384":
+			storage.KeyType = keyType
+		default:
+			c.logger.Warn("ignoring invalid acme key type on %v: %s", source, keyType)
+		}
+	}
+	if chain := annHost[ingtypes.HostAcmePreferredChain]; chain != "" {
+		if strings.ContainsAny(chain, ",;") {
+			c.logger.Warn("ignoring invalid acme preferred chain on %v: %s", source, chain)
+		} else {
+			storage.PreferredChain = chain
+		}
+	}
+}
+
+// syncHostDefaultBackends adds the backend configured in the default-backend
+// host annotation as the root path of the hosts that doesn't declare one.
+// This should be done after all the ingress resources are parsed, so a root
+// path declared in any ingress has precedence.
+func (c *converter) syncHostDefaultBackends(hosts map[string]*hatypes.Host) {
+	hostnames := make([]string, 0, len(hosts))
+	for hostname := range hosts {
+		hostnames = append(hostnames, hostname)
+	}
+	sort.Strings(hostnames)
+	for _, hostname := range hostnames {
+		host := hosts[hostname]
+		mapper, found := c.hostAnnotations[host]
+		if !found || host.FindPath("/") != nil {
+			continue
+		}
+		cfg := mapper.Get(ingtypes.HostDefaultBackend)
+		if cfg.Value == "" || cfg.Source == nil {
+			continue
+		}
+		svc := strings.Split(cfg.Value, ":")
+		if len(svc) != 2 || svc[0] == "" || svc[1] == "" {
+			c.logger.Warn("ignoring default backend on %v: invalid service name and port: %s", cfg.Source, cfg.Value)
+			continue
+		}
+		backend, err := c.addBackend(cfg.Source, host.Hostname, "/", cfg.Source.Namespace+"/"+svc[0], svc[1], map[string]string{})
+		if err != nil {
+			c.logger.Warn("ignoring default backend on %v: %v", cfg.Source, err)
+			continue
+		}
+		host.AddPath(backend, "/", hatypes.MatchBegin)
+	}
+}
+
 func (c *converter) syncEndpointCookies() {
 	for _, backend := range c.haproxy.Backends().Items() {
 		c.syncBackendEndpointCookies(backend)
@@ -623,6 +1064,17 @@ func (c *converter) addHost(hostname string, source *annotations.Source, ann map
 	return host
 }
 
+// appProtocols maps the well known appProtocol values of a service port to
+// their backend-protocol. Other values are ignored.
+var appProtocols = map[string]string{
+	"http":              "h1",
+	"https":             "h1-ssl",
+	"grpc":              "h2",
+	"kubernetes.io/h2c": "h2",
+	"kubernetes.io/ws":  "h1",
+	"kubernetes.io/wss": "h1-ssl",
+}
+
 func (c *converter) addBackend(source *annotations.Source, hostname, uri, fullSvcName, svcPort string, ann map[string]string) (*hatypes.Backend, error) {
 	return c.addBackendWithClass(source, hostname, uri, fullSvcName, svcPort, ann, nil)
 }
@@ -643,7 +1095,7 @@ func (c *converter) addBackendWithClass(source *annotations.Source, hostname, ur
 		// from the api.Service object
 		svcPort = svc.Spec.Ports[0].TargetPort.String()
 	}
-	port := convutils.FindServicePort(svc, svcPort)
+	port := c.findServicePort(source, svc, svcPort)
 	if port == nil {
 		return nil, fmt.Errorf("port not found: '%s'", svcPort)
 	}
@@ -654,12 +1106,13 @@ func (c *converter) addBackendWithClass(source *annotations.Source, hostname, ur
 	if !found {
 		// New backend, initialize with service annotations, giving precedence
 		mapper = c.mapBuilder.NewMapper()
-		_, ann := c.readAnnotations(svc.Annotations)
-		mapper.AddAnnotations(&annotations.Source{
+		svcSource := &annotations.Source{
 			Namespace: namespace,
 			Name:      svcName,
 			Type:      "service",
-		}, pathlink, ann)
+		}
+		_, ann := c.readAnnotations(svcSource, svc.Annotations)
+		mapper.AddAnnotations(svcSource, pathlink, ann)
 		c.backendAnnotations[backend] = mapper
 	}
 	// Merging Ingress annotations
@@ -668,6 +1121,23 @@ func (c *converter) addBackendWithClass(source *annotations.Source, hostname, ur
 		c.logger.Warn("skipping backend '%s:%s' annotation(s) from %v due to conflict: %v",
 			svcName, svcPort, source, conflict)
 	}
+	// Merging the appProtocol of the service port with less priority than
+	// annotations, ignoring conflicts
+	if port.AppProtocol != nil {
+		if proto, found := appProtocols[strings.ToLower(*port.AppProtocol)]; found {
+			svcSource := &annotations.Source{
+				Namespace: namespace,
+				Name:      svcName,
+				Type:      "service",
+			}
+			_ = mapper.AddAnnotations(svcSource, pathlink, map[string]string{ingtypes.BackBackendProtocol: proto})
+		}
+	}
+	// Merging the namespace config with less priority, using the same
+	// work around of the IngressClass Parameters below
+	if cfg := c.readNamespaceConfig(namespace, hostname); cfg != nil {
+		_ = mapper.AddAnnotations(source, pathlink, cfg)
+	}
 	// Merging IngressClass Parameters with less priority
 	if ingressClass != nil {
 		if cfg := c.readParameters(ingressClass, hostname); cfg != nil {
@@ -690,14 +1160,27 @@ func (c *converter) addBackendWithClass(source *annotations.Source, hostname, ur
 		default:
 			backend.EpNaming = hatypes.EpSequence
 		}
-		if mapper.Get(ingtypes.BackServiceUpstream).Bool() {
+		family := mapper.Get(ingtypes.BackBackendIPFamily).Value
+		if family != "ipv4" && family != "ipv6" {
+			// invalid values are warned by the updater
+			family = ""
+		}
+		if consulSvc := mapper.Get(ingtypes.BackConsulService).Value; consulSvc != "" {
+			if err := c.addConsulEndpoints(svc, consulSvc, backend); err != nil {
+				c.logger.Error("error adding endpoints of consul service '%s': %v", consulSvc, err)
+			}
+		} else if mapper.Get(ingtypes.BackServiceUpstream).Bool() {
 			if addr, err := convutils.CreateSvcEndpoint(svc, port); err == nil {
+				if ip := convutils.SelectIPFamily(svc.Spec.ClusterIPs, family); ip != "" {
+					addr.IP = ip
+				}
 				backend.AcquireEndpoint(addr.IP, addr.Port, addr.TargetRef)
 			} else {
 				c.logger.Error("error adding IP of service '%s': %v", fullSvcName, err)
 			}
 		} else {
-			if err := c.addEndpoints(svc, port, backend); err != nil {
+			node := c.readTrafficPolicyNode(svc, mapper.Get(ingtypes.BackTrafficPolicy))
+			if err := c.addEndpoints(svc, port, backend, family, node); err != nil {
 				c.logger.Error("error adding endpoints of service '%s': %v", fullSvcName, err)
 			}
 		}
@@ -705,6 +1188,62 @@ func (c *converter) addBackendWithClass(source *annotations.Source, hostname, ur
 	return backend, nil
 }
 
+// findServicePort finds svcPort in the service. If svcPort was removed or
+// renamed, the port number it was resolved to in a former sync is used up
+// to the service-port-grace-period global config, so a service update
+// doesn't drop the backend while its ingress resources are being updated.
+func (c *converter) findServicePort(source *annotations.Source, svc *api.Service, svcPort string) *api.ServicePort {
+	key := svc.Namespace + "/" + svc.Name + ":" + svcPort
+	if port := convutils.FindServicePort(svc, svcPort); port != nil {
+		c.options.ServicePorts[key] = &ingtypes.ServicePort{Port: port.Port}
+		return port
+	}
+	last, found := c.options.ServicePorts[key]
+	if !found {
+		return nil
+	}
+	var gracePeriod time.Duration
+	if value := c.globalConfig.Get(ingtypes.GlobalServicePortGracePeriod).String(); value != "" {
+		var err error
+		if gracePeriod, err = time.ParseDuration(value); err != nil {
+			c.logger.Warn("ignoring invalid service port grace period: %s", value)
+		}
+	}
+	justMissing := last.Missing.IsZero()
+	if justMissing {
+		last.Missing = time.Now()
+	}
+	if time.Since(last.Missing) >= gracePeriod {
+		delete(c.options.ServicePorts, key)
+		return nil
+	}
+	for i := range svc.Spec.Ports {
+		port := &svc.Spec.Ports[i]
+		if port.Port == last.Port {
+			if justMissing {
+				// the former port should be removed even if nothing else changes
+				c.cache.ScheduleSync(last.Missing.Add(gracePeriod))
+			}
+			c.logger.Warn("port '%s' not found on service '%s/%s' of %v, using the former port %d during the grace period",
+				svcPort, svc.Namespace, svc.Name, source, port.Port)
+			return port
+		}
+	}
+	return nil
+}
+
+// removeServicePorts removes the last known ports of deleted services, so
+// a service created again with the same name doesn't use them.
+func (c *converter) removeServicePorts(svcNames []string) {
+	for _, svcName := range svcNames {
+		for key := range c.options.ServicePorts {
+			if strings.HasPrefix(key, svcName+":") {
+				delete(c.options.ServicePorts, key)
+			}
+		}
+	}
+}
+
 func (c *converter) syncBackendEndpointCookies(backend *hatypes.Backend) {
 	cookieAffinity := backend.CookieAffinity()
 	for _, ep := range backend.Endpoints {
@@ -712,6 +1251,12 @@ func (c *converter) syncBackendEndpointCookies(backend *hatypes.Backend) {
 			switch backend.EpCookieStrategy {
 			default:
 				ep.CookieValue = ep.Name
+			case hatypes.EpCookieNameHash:
+				key := backend.Cookie.DynamicKey
+				if key == "" {
+					key = c.haproxy.Global().Cookie.Key
+				}
+				ep.CookieValue = cookieIdentityHash(key, endpointIdentity(ep))
 			case hatypes.EpCookiePodUID:
 				if ep.TargetRef != "" {
 					pod, err := c.cache.GetPod(ep.TargetRef)
@@ -727,7 +1272,39 @@ func (c *converter) syncBackendEndpointCookies(backend *hatypes.Backend) {
 	}
 }
 
-func (c *converter) addTLS(source *annotations.Source, hostname, secretName string) convtypes.CrtFile {
+// cookieIdentityHash returns a hash of the identity of a server, salted
+// with the cookie key, so the cookie value doesn't expose the server, and
+// is preserved across endpoint updates while the server identity and the
+// key don't change.
+func cookieIdentityHash(key, identity string) string {
+	hash := sha256.Sum256([]byte(key + "/" + identity))
+	return hex.EncodeToString(hash[:8])
+}
+
+// endpointIdentity returns the pod of an endpoint, or its address if the
+// endpoint isn't a pod. Server names are slots reused by distinct pods
+// when the endpoints change, so they cannot be used to persist a session.
+func endpointIdentity(ep *hatypes.Endpoint) string {
+	if ep.TargetRef != "" {
+		return ep.TargetRef
+	}
+	return fmt.Sprintf("%s:%d", ep.IP, ep.Port)
+}
+
+func (c *converter) addTLS(source *annotations.Source, hostname, secretName string, ann map[string]string) convtypes.CrtFile {
+	if role := ann[ingtypes.HostVaultPKIRole]; role != "" {
+		mount := ann[ingtypes.HostVaultPKIMount]
+		if mount == "" {
+			mount = "pki"
+		}
+		tlsFile, err := c.cache.GetVaultCertPath(mount, role, hostname, convtypes.TrackingTarget{Hostname: hostname})
+		if err == nil {
+			return tlsFile
+		}
+		c.logger.Warn("using %s due to an error issuing certificate of '%s' from vault role '%s/%s' on %s: %v", c.defaultCrtDesc(hostname), hostname, mount, role, source, err)
+		c.ingressConditions(source).AddCertError(hostname, err.Error())
+		return c.defaultCrt
+	}
 	if secretName != "" {
 		tlsFile, err := c.cache.GetTLSSecretPath(
 			source.Namespace,
@@ -737,22 +1314,42 @@ func (c *converter) addTLS(source *annotations.Source, hostname, secretName stri
 		if err == nil {
 			return tlsFile
 		}
-		c.logger.Warn("using default certificate due to an error reading secret '%s' on %s: %v", secretName, source, err)
+		c.logger.Warn("using %s due to an error reading secret '%s' on %s: %v", c.defaultCrtDesc(hostname), secretName, source, err)
+		c.ingressConditions(source).AddCertError(hostname, err.Error())
 	}
 	return c.defaultCrt
 }
 
-func (c *converter) addEndpoints(svc *api.Service, svcPort *api.ServicePort, backend *hatypes.Backend) error {
+// defaultCrtDesc describes the certificate that haproxy selects to hostname
+// if it doesn't have its own one.
+func (c *converter) defaultCrtDesc(hostname string) string {
+	if c.haproxy.Frontend().FindPoolCrt(hostname) != "" {
+		return "certificate of the default pool"
+	}
+	return "default certificate"
+}
+
+func (c *converter) addEndpoints(svc *api.Service, svcPort *api.ServicePort, backend *hatypes.Backend, family string, node trafficPolicyNode) error {
 	ready, notReady, err := convutils.CreateEndpoints(c.cache, svc, svcPort)
 	if err != nil {
 		return err
 	}
+	if node.name != "" {
+		local := filterNodeEndpoints(ready, node.name)
+		if len(local) > 0 || !node.prefer {
+			ready = local
+			notReady = filterNodeEndpoints(notReady, node.name)
+		} else {
+			// prefer-local falls back to all the endpoints
+			node.name = ""
+		}
+	}
 	for _, addr := range ready {
-		backend.AcquireEndpoint(addr.IP, addr.Port, addr.TargetRef)
+		backend.AcquireEndpoint(c.readEndpointIP(addr, family), addr.Port, addr.TargetRef)
 	}
 	if c.globalConfig.Get(ingtypes.GlobalDrainSupport).Bool() {
 		for _, addr := range notReady {
-			ep := backend.AcquireEndpoint(addr.IP, addr.Port, addr.TargetRef)
+			ep := backend.AcquireEndpoint(c.readEndpointIP(addr, family), addr.Port, addr.TargetRef)
 			ep.Weight = 0
 		}
 		pods, err := c.cache.GetTerminatingPods(svc, convtypes.TrackingTarget{Backend: backend.BackendID()})
@@ -760,9 +1357,16 @@ func (c *converter) addEndpoints(svc *api.Service, svcPort *api.ServicePort, bac
 			return fmt.Errorf("cannot fetch terminating pods on drain-support mode: %v", err)
 		}
 		for _, pod := range pods {
+			if node.name != "" && pod.Spec.NodeName != node.name {
+				continue
+			}
 			targetPort := convutils.FindContainerPort(pod, svcPort)
 			if targetPort > 0 {
-				ep := backend.AcquireEndpoint(pod.Status.PodIP, targetPort, pod.Namespace+"/"+pod.Name)
+				podIP := pod.Status.PodIP
+				if ip := convutils.SelectIPFamily(readPodIPs(pod), family); ip != "" {
+					podIP = ip
+				}
+				ep := backend.AcquireEndpoint(podIP, targetPort, pod.Namespace+"/"+pod.Name)
 				ep.Weight = 0
 			} else {
 				c.logger.Warn("skipping endpoint %s of service %s/%s: port '%s' was not found",
@@ -773,17 +1377,170 @@ func (c *converter) addEndpoints(svc *api.Service, svcPort *api.ServicePort, bac
 	return nil
 }
 
-func (c *converter) readAnnotations(annotations map[string]string) (annHost, annBack map[string]string) {
-	annHost = make(map[string]string, len(annotations))
-	annBack = make(map[string]string, len(annotations))
-	prefix := c.options.AnnotationPrefix + "/"
-	for annName, annValue := range annotations {
-		if strings.HasPrefix(annName, prefix) {
+// trafficPolicyNode is the node whose endpoints should be used by a backend
+// configured with a local traffic policy. An empty name uses the endpoints
+// of all the nodes.
+type trafficPolicyNode struct {
+	name   string
+	prefer bool
+}
+
+// readTrafficPolicyNode returns the node of the controller pod if the backend
+// should use only the endpoints running on the same node, e.g. on DaemonSet
+// deployments. Invalid policies are warned by the updater.
+func (c *converter) readTrafficPolicyNode(svc *api.Service, policy *annotations.ConfigValue) trafficPolicyNode {
+	if policy.Value != "local" && policy.Value != "prefer-local" {
+		return trafficPolicyNode{}
+	}
+	if svc.Spec.Type == api.ServiceTypeExternalName {
+		// external names don't run on cluster nodes
+		return trafficPolicyNode{}
+	}
+	name, err := c.cache.GetControllerNodeName()
+	if err != nil {
+		c.logger.Warn("ignoring traffic policy '%s' on %s: cannot read the controller node: %v", policy.Value, policy.Source, err)
+		return trafficPolicyNode{}
+	}
+	return trafficPolicyNode{
+		name:   name,
+		prefer: policy.Value == "prefer-local",
+	}
+}
+
+func filterNodeEndpoints(endpoints []*convutils.Endpoint, node string) []*convutils.Endpoint {
+	var filtered []*convutils.Endpoint
+	for _, ep := range endpoints {
+		if ep.NodeName == node {
+			filtered = append(filtered, ep)
+		}
+	}
+	return filtered
+}
+
+// readEndpointIP returns the IP address of an endpoint in the preferred
+// family. The Endpoints resource of a dual-stack service only has the
+// addresses of the service's primary family, the address of the other
+// family is read from the endpoint's pod. The endpoint address is used if
+// the pod cannot be read or doesn't have an address of that family.
+func (c *converter) readEndpointIP(addr *convutils.Endpoint, family string) string {
+	if family == "" || addr.TargetRef == "" || convutils.IPFamily(addr.IP) == family {
+		return addr.IP
+	}
+	pod, err := c.cache.GetPod(addr.TargetRef)
+	if err != nil {
+		return addr.IP
+	}
+	if ip := convutils.SelectIPFamily(readPodIPs(pod), family); ip != "" {
+		return ip
+	}
+	return addr.IP
+}
+
+func readPodIPs(pod *api.Pod) []string {
+	ips := make([]string, len(pod.Status.PodIPs))
+	for i, podIP := range pod.Status.PodIPs {
+		ips[i] = podIP.IP
+	}
+	return ips
+}
+
+// addConsulEndpoints adds the healthy endpoints of a Consul service to the
+// backend. The cache watches the Consul service and notifies changes as
+// endpoint changes of the kubernetes service.
+func (c *converter) addConsulEndpoints(svc *api.Service, consulSvc string, backend *hatypes.Backend) error {
+	address := c.globalConfig.Get(ingtypes.GlobalConsulAddress).String()
+	if address == "" {
+		return fmt.Errorf("missing global config '%s'", ingtypes.GlobalConsulAddress)
+	}
+	endpoints, err := c.cache.GetConsulEndpoints(address, consulSvc, svc)
+	if err != nil {
+		return err
+	}
+	for _, ep := range endpoints {
+		backend.AcquireEndpoint(ep.IP, ep.Port, "")
+	}
+	return nil
+}
+
+// readPathConfig reads the per path overrides of the backend annotations,
+// declared in the path-config annotation as a YAML map of paths to their
+// annotations. The overrides are merged into a copy of annBack, one copy per
+// path. path-config itself is removed from annBack.
+func (c *converter) readPathConfig(source *annotations.Source, annBack map[string]string) map[string]map[string]string {
+	pathConfig, found := annBack[ingtypes.BackPathConfig]
+	if !found {
+		return nil
+	}
+	delete(annBack, ingtypes.BackPathConfig)
+	var config map[string]map[string]string
+	if err := yaml.Unmarshal([]byte(pathConfig), &config); err != nil {
+		c.logger.Warn("ignoring path config on %v: %v", source, err)
+		return nil
+	}
+	annPaths := make(map[string]map[string]string, len(config))
+	for uri, ann := range config {
+		annPath := make(map[string]string, len(annBack)+len(ann))
+		for key, value := range annBack {
+			annPath[key] = value
+		}
+		for key, value := range ann {
+			if _, isHostAnn := ingtypes.AnnHost[key]; isHostAnn || key == ingtypes.BackPathConfig {
+				c.logger.Warn("ignoring key '%s' of path config '%s' on %v: only backend annotations can be declared per path", key, uri, source)
+				continue
+			}
+			annPath[key] = value
+		}
+		annPaths[uri] = annPath
+	}
+	return annPaths
+}
+
+func (c *converter) readAnnotations(source *annotations.Source, ann map[string]string) (annHost, annBack map[string]string) {
+	annHost = make(map[string]string, len(ann))
+	annBack = make(map[string]string, len(ann))
+	addAnn := func(name, value string) {
+		if _, isHostAnn := ingtypes.AnnHost[name]; isHostAnn {
+			annHost[name] = value
+		} else {
+			annBack[name] = value
+		}
+	}
+	annNames := make([]string, 0, len(ann))
+	for annName := range ann {
+		annNames = append(annNames, annName)
+	}
+	sort.Strings(annNames)
+	// prefixes are sorted by priority, the first one wins if the same
+	// key is declared using more than one prefix
+	declared := make(map[string]string, len(ann))
+	for _, prefix := range c.options.AnnotationPrefix {
+		prefix += "/"
+		for _, annName := range annNames {
+			if !strings.HasPrefix(annName, prefix) {
+				continue
+			}
 			name := strings.TrimPrefix(annName, prefix)
-			if _, isHostAnn := ingtypes.AnnHost[name]; isHostAnn {
-				annHost[name] = annValue
-			} else {
-				annBack[name] = annValue
+			if winner, found := declared[name]; found {
+				if ann[winner] != ann[annName] {
+					c.logger.Warn("ignoring annotation '%s' on %v: conflicts with '%s'", annName, source, winner)
+				}
+				continue
+			}
+			declared[name] = annName
+			addAnn(name, ann[annName])
+		}
+	}
+	if c.options.TranslateNginx {
+		translated, skipped := translateNginxAnnotations(ann)
+		for _, annName := range skipped {
+			c.logger.Warn("ignoring annotation '%s' on %v: cannot translate to a native configuration", annName, source)
+		}
+		for name, value := range translated {
+			// native annotations have precedence
+			if _, found := annHost[name]; !found {
+				if _, found := annBack[name]; !found {
+					addAnn(name, value)
+				}
 			}
 		}
 	}
@@ -840,6 +1597,82 @@ func (c *converter) parseParameters(ingressClass *networking.IngressClass, track
 	}
 }
 
+// classHostKeys are the host keys that can be declared in the IngressClass
+// Parameters, see readClassHostAnn.
+var classHostKeys = []string{ingtypes.HostInternal, ingtypes.HostTenant}
+
+// readClassHostAnn adds the internal and tenant host configs of the
+// IngressClass Parameters to the host annotations, so all the hosts of a
+// class can share them. Annotations of the ingress have precedence.
+func (c *converter) readClassHostAnn(ingressClass *networking.IngressClass, hostname string, annHost map[string]string) map[string]string {
+	if ingressClass == nil {
+		return annHost
+	}
+	params := c.readParameters(ingressClass, hostname)
+	var ann map[string]string
+	for _, key := range classHostKeys {
+		value, found := params[key]
+		if !found {
+			continue
+		}
+		if _, found := annHost[key]; found {
+			continue
+		}
+		if ann == nil {
+			ann = make(map[string]string, len(annHost)+len(classHostKeys))
+			for key, value := range annHost {
+				ann[key] = value
+			}
+		}
+		ann[key] = value
+	}
+	if ann == nil {
+		return annHost
+	}
+	return ann
+}
+
+// readNamespaceConfig reads the namespace config ConfigMap, filtering out
+// the keys not allowed by the namespace-config-keys global config. The
+// ConfigMap is optional and is tracked as missing if not found, so it's
+// applied as soon as it's created.
+func (c *converter) readNamespaceConfig(namespace, trackingHostname string) map[string]string {
+	if c.options.NamespaceConfig == "" {
+		return nil
+	}
+	configMapName := namespace + "/" + c.options.NamespaceConfig
+	nsConfig, found := c.namespaceConfigs[namespace]
+	if !found {
+		nsConfig = &ingressClassConfig{}
+		if configMap, err := c.cache.GetConfigMap(configMapName); err == nil {
+			allowed := map[string]bool{}
+			for _, key := range utils.Split(c.globalConfig.Get(ingtypes.GlobalNamespaceConfigKeys).String(), ",") {
+				allowed[key] = true
+			}
+			config := make(map[string]string, len(configMap.Data))
+			for key, value := range configMap.Data {
+				if allowed[key] {
+					config[key] = value
+				} else {
+					c.logger.Warn("ignoring key '%s' of namespace config '%s': key is not allowed", key, configMapName)
+				}
+			}
+			nsConfig = &ingressClassConfig{
+				resourceType: convtypes.ConfigMapType,
+				resourceName: configMapName,
+				config:       config,
+			}
+		}
+		c.namespaceConfigs[namespace] = nsConfig
+	}
+	if nsConfig.resourceName != "" {
+		c.tracker.TrackHostname(nsConfig.resourceType, nsConfig.resourceName, trackingHostname)
+	} else {
+		c.tracker.TrackMissingOnHostname(convtypes.ConfigMapType, configMapName, trackingHostname)
+	}
+	return nsConfig.config
+}
+
 func readServiceNamePort(backend *networking.IngressBackend) (string, string, error) {
 	if backend.Service == nil {
 		return "", "", fmt.Errorf("resource backend is not supported yet")
@@ -17,9 +17,11 @@ limitations under the License.
 package ingress
 
 import (
+	"reflect"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/kylelemons/godebug/diff"
 	yaml "gopkg.in/yaml.v2"
@@ -111,6 +113,103 @@ WARN skipping backend config of ingress 'default/echo': port not found: 'non'
 `)
 }
 
+func TestSyncSvcNamedPortChanged(t *testing.T) {
+	testCases := []struct {
+		grace    string
+		svcPort  string
+		expFront string
+		expBack  string
+		logging  string
+		schedule bool
+	}{
+		// 0
+		{
+			grace:   "1m",
+			svcPort: "web:8080",
+			expFront: `
+- hostname: echo.example.com
+  paths:
+  - path: /
+    backend: default_echo_8080`,
+			expBack: `
+- id: default_echo_8080
+  endpoints:
+  - ip: 172.17.0.12
+    port: 8080`,
+			logging: `
+INFO-V(2) syncing 1 host(s) and 1 backend(s)
+WARN port 'http' not found on service 'default/echo' of ingress 'default/echo', using the former port 8080 during the grace period`,
+			schedule: true,
+		},
+		// 1
+		{
+			grace:   "1m",
+			svcPort: "web:9090:8080",
+			expFront: `
+- hostname: echo.example.com
+  paths: []`,
+			logging: `
+INFO-V(2) syncing 1 host(s) and 1 backend(s)
+WARN skipping backend config of ingress 'default/echo': port not found: 'http'`,
+		},
+		// 2
+		{
+			grace:   "",
+			svcPort: "web:8080",
+			expFront: `
+- hostname: echo.example.com
+  paths: []`,
+			logging: `
+INFO-V(2) syncing 1 host(s) and 1 backend(s)
+WARN skipping backend config of ingress 'default/echo': port not found: 'http'`,
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		c.cache.Changed.GlobalNew = map[string]string{ingtypes.GlobalServicePortGracePeriod: test.grace}
+		c.createSvc1("default/echo", "http:8080", "172.17.0.11")
+		c.Sync(c.createIng1("default/echo", "echo.example.com", "/", "echo:http"))
+		c.hconfig.Commit()
+		c.logger.Logging = []string{}
+
+		svc, _ := c.createSvc1("default/echo", test.svcPort, "172.17.0.12")
+		c.cache.Changed.ServicesUpd = []*api.Service{svc}
+		c.Sync()
+
+		c.compareConfigFront(test.expFront)
+		c.compareConfigBack(test.expBack + defaultBackendConfig)
+		if schedule := !c.cache.SyncAt.IsZero(); schedule != test.schedule {
+			t.Errorf("scheduled sync differs on %d - expected: %v - actual: %v", i, test.schedule, schedule)
+		}
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestSyncSvcNamedPortRemoved(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	c.createSvc1("default/echo", "http:8080", "172.17.0.11")
+	c.Sync(c.createIng1("default/echo", "echo.example.com", "/", "echo:http"))
+	c.hconfig.Commit()
+	if _, found := c.ports["default/echo:http"]; !found {
+		t.Errorf("expected port of 'default/echo:http' to be tracked")
+	}
+
+	svc := c.cache.SvcList[len(c.cache.SvcList)-1]
+	c.cache.SvcList = c.cache.SvcList[:len(c.cache.SvcList)-1]
+	c.cache.Changed.ServicesDel = []*api.Service{svc}
+	c.logger.Logging = []string{}
+	c.Sync()
+	if _, found := c.ports["default/echo:http"]; found {
+		t.Errorf("expected port of 'default/echo:http' to be removed")
+	}
+	c.logger.CompareLogging(`
+INFO-V(2) syncing 1 host(s) and 1 backend(s)
+WARN skipping backend config of ingress 'default/echo': service not found: 'default/echo'`)
+}
+
 func TestSyncSvcNamedPort(t *testing.T) {
 	c := setup(t)
 	defer c.teardown()
@@ -175,6 +274,41 @@ func TestSyncSvcUpstream(t *testing.T) {
     port: 8080` + defaultBackendConfig)
 }
 
+func TestSyncSvcConsul(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	c.createSvc1Ann("default/echo1", "8080", "172.17.1.101", map[string]string{
+		"ingress.kubernetes.io/consul-service": "echo",
+	})
+	c.createSvc1Ann("default/echo2", "8080", "172.17.1.102", map[string]string{
+		"ingress.kubernetes.io/consul-service": "missing",
+	})
+	c.cache.ConsulEpList = map[string][]convtypes.ExternalEndpoint{
+		"echo": {
+			{IP: "10.0.1.11", Port: 9000, ID: "echo-1"},
+			{IP: "10.0.1.12", Port: 9000, ID: "echo-2"},
+		},
+	}
+	c.cache.Changed.GlobalNew = map[string]string{"consul-address": "http://consul:8500"}
+	c.Sync(
+		c.createIng1("default/echo1", "echo1.example.com", "/", "echo1:8080"),
+		c.createIng1("default/echo2", "echo2.example.com", "/", "echo2:8080"),
+	)
+
+	c.compareConfigBack(`
+- id: default_echo1_8080
+  endpoints:
+  - ip: 10.0.1.11
+    port: 9000
+  - ip: 10.0.1.12
+    port: 9000
+- id: default_echo2_8080` + defaultBackendConfig)
+
+	c.logger.CompareLogging(`
+ERROR error adding endpoints of consul service 'missing': consul service not found: 'missing'`)
+}
+
 func TestSyncSingle(t *testing.T) {
 	c := setup(t)
 	defer c.teardown()
@@ -319,6 +453,210 @@ func TestSyncDrainSupport(t *testing.T) {
 	c.logger.CompareLogging("WARN skipping endpoint 172.17.1.104 of service default/echo: port 'http' was not found")
 }
 
+func TestSyncBackendIPFamily(t *testing.T) {
+	testCases := []struct {
+		ann     map[string]string
+		expBack string
+	}{
+		// 0
+		{
+			expBack: `
+- id: default_echo_8080
+  endpoints:
+  - ip: 172.17.0.11
+    port: 8080
+  - ip: 172.17.0.12
+    port: 8080`,
+		},
+		// 1
+		{
+			ann: map[string]string{"ingress.kubernetes.io/backend-ip-family": "ipv4"},
+			expBack: `
+- id: default_echo_8080
+  endpoints:
+  - ip: 172.17.0.11
+    port: 8080
+  - ip: 172.17.0.12
+    port: 8080`,
+		},
+		// 2
+		{
+			ann: map[string]string{"ingress.kubernetes.io/backend-ip-family": "ipv6"},
+			expBack: `
+- id: default_echo_8080
+  endpoints:
+  - ip: fd00::11
+    port: 8080
+  - ip: 172.17.0.12
+    port: 8080`,
+		},
+		// 3
+		{
+			ann: map[string]string{
+				"ingress.kubernetes.io/backend-ip-family": "ipv6",
+				"ingress.kubernetes.io/service-upstream":  "true",
+			},
+			expBack: `
+- id: default_echo_8080
+  endpoints:
+  - ip: fd00::10
+    port: 8080`,
+		},
+		// 4
+		{
+			ann: map[string]string{"ingress.kubernetes.io/backend-ip-family": "ipx"},
+			expBack: `
+- id: default_echo_8080
+  endpoints:
+  - ip: 172.17.0.11
+    port: 8080
+  - ip: 172.17.0.12
+    port: 8080`,
+		},
+	}
+	for _, test := range testCases {
+		c := setup(t)
+		svc, ep := c.createSvc1Ann("default/echo", "8080", "172.17.0.11,172.17.0.12", test.ann)
+		svc.Spec.ClusterIPs = []string{"10.0.0.10", "fd00::10"}
+		ep.Subsets[0].Addresses[1].TargetRef.Name = "echo-yyyyy"
+		pod1 := c.createPod1("default/echo-xxxxx", "172.17.0.11", "http:8080")
+		pod1.Status.PodIPs = []api.PodIP{{IP: "172.17.0.11"}, {IP: "fd00::11"}}
+		pod2 := c.createPod1("default/echo-yyyyy", "172.17.0.12", "http:8080")
+		pod2.Status.PodIPs = []api.PodIP{{IP: "172.17.0.12"}}
+		c.cache.PodList = map[string]*api.Pod{
+			"default/echo-xxxxx": pod1,
+			"default/echo-yyyyy": pod2,
+		}
+		c.Sync(c.createIng1("default/echo", "echo.example.com", "/", "echo:8080"))
+		c.compareConfigBack(test.expBack + `
+- id: system_default_8080
+  endpoints:
+  - ip: 172.17.0.99
+    port: 8080`)
+		c.logger.CompareLogging("")
+		c.teardown()
+	}
+}
+
+func TestSyncBackendTrafficPolicy(t *testing.T) {
+	testCases := []struct {
+		ann      map[string]string
+		nodeName string
+		expBack  string
+		logging  string
+	}{
+		// 0
+		{
+			nodeName: "node1",
+			expBack: `
+- id: default_echo_8080
+  endpoints:
+  - ip: 172.17.0.11
+    port: 8080
+  - ip: 172.17.0.12
+    port: 8080
+  - ip: 172.17.0.13
+    port: 8080
+    drain: true`,
+		},
+		// 1
+		{
+			ann:      map[string]string{"ingress.kubernetes.io/traffic-policy": "local"},
+			nodeName: "node1",
+			expBack: `
+- id: default_echo_8080
+  endpoints:
+  - ip: 172.17.0.11
+    port: 8080
+  - ip: 172.17.0.13
+    port: 8080
+    drain: true`,
+		},
+		// 2
+		{
+			ann:      map[string]string{"ingress.kubernetes.io/traffic-policy": "local"},
+			nodeName: "node3",
+			expBack: `
+- id: default_echo_8080`,
+		},
+		// 3
+		{
+			ann:      map[string]string{"ingress.kubernetes.io/traffic-policy": "prefer-local"},
+			nodeName: "node2",
+			expBack: `
+- id: default_echo_8080
+  endpoints:
+  - ip: 172.17.0.12
+    port: 8080`,
+		},
+		// 4
+		{
+			ann:      map[string]string{"ingress.kubernetes.io/traffic-policy": "prefer-local"},
+			nodeName: "node3",
+			expBack: `
+- id: default_echo_8080
+  endpoints:
+  - ip: 172.17.0.11
+    port: 8080
+  - ip: 172.17.0.12
+    port: 8080
+  - ip: 172.17.0.13
+    port: 8080
+    drain: true`,
+		},
+		// 5
+		{
+			ann: map[string]string{"ingress.kubernetes.io/traffic-policy": "local"},
+			expBack: `
+- id: default_echo_8080
+  endpoints:
+  - ip: 172.17.0.11
+    port: 8080
+  - ip: 172.17.0.12
+    port: 8080
+  - ip: 172.17.0.13
+    port: 8080
+    drain: true`,
+			logging: `WARN ignoring traffic policy 'local' on service 'default/echo': cannot read the controller node: controller pod not found`,
+		},
+		// 6
+		{
+			ann:      map[string]string{"ingress.kubernetes.io/traffic-policy": "zone"},
+			nodeName: "node1",
+			expBack: `
+- id: default_echo_8080
+  endpoints:
+  - ip: 172.17.0.11
+    port: 8080
+  - ip: 172.17.0.12
+    port: 8080
+  - ip: 172.17.0.13
+    port: 8080
+    drain: true`,
+		},
+	}
+	for _, test := range testCases {
+		c := setup(t)
+		svc, ep := c.createSvc1Ann("default/echo", "8080", "172.17.0.11,172.17.0.12", test.ann)
+		node1, node2 := "node1", "node2"
+		ep.Subsets[0].Addresses[0].NodeName = &node1
+		ep.Subsets[0].Addresses[1].NodeName = &node2
+		pod := c.createPod1("default/echo-zzzzz", "172.17.0.13", "http:8080")
+		pod.Spec.NodeName = node1
+		c.cache.TermPodList[svc.Namespace+"/"+svc.Name] = []*api.Pod{pod}
+		c.cache.NodeName = test.nodeName
+		c.cache.Changed.GlobalNew = map[string]string{"drain-support": "true"}
+		c.Sync(c.createIng1("default/echo", "echo.example.com", "/", "echo:8080"))
+		c.compareConfigBack(test.expBack + `
+- id: system_default_8080
+  endpoints:
+  - ip: 172.17.0.99
+    port: 8080`)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
 func TestSyncRootPathLast(t *testing.T) {
 	c := setup(t)
 	defer c.teardown()
@@ -456,6 +794,70 @@ func TestSyncTLSSecretNotFound(t *testing.T) {
 WARN using default certificate due to an error reading secret 'ing-tls' on ingress 'default/echo': secret not found: 'default/ing-tls'`)
 }
 
+func TestSyncTLSDefaultPool(t *testing.T) {
+	now := time.Now()
+	pool := []convtypes.CrtFile{
+		{Filename: "/tls/wildcard.pem", CommonName: "*.example.com", NotAfter: now.AddDate(0, 0, 30)},
+		{Filename: "/tls/wildcard-long.pem", CommonName: "*.example.com", NotAfter: now.AddDate(0, 0, 60)},
+		{Filename: "/tls/san.pem", CommonName: "app.local", DNSNames: []string{"app.local", "echo.example.com"}, NotAfter: now.AddDate(0, 0, 10)},
+		{Filename: "/tls/other.pem", CommonName: "*.other.local", NotAfter: now.AddDate(0, 0, 90)},
+	}
+	expectedPool := []*hatypes.CrtPoolFile{
+		{Filename: "/tls/other.pem", Names: []string{"*.other.local"}},
+		{Filename: "/tls/wildcard-long.pem", Names: []string{"*.example.com"}},
+		{Filename: "/tls/wildcard.pem", Names: []string{"*.example.com"}},
+		{Filename: "/tls/san.pem", Names: []string{"app.local", "echo.example.com"}},
+	}
+	testCases := []struct {
+		hostname string
+		secret   string
+		expected string
+		logging  string
+	}{
+		// 0
+		{
+			hostname: "echo.example.com",
+			expected: "/tls/tls-default.pem",
+		},
+		// 1
+		{
+			hostname: "echo.example.com",
+			secret:   "tls-echo",
+			expected: "/tls/default/tls-echo.pem",
+		},
+		// 2
+		{
+			hostname: "app.example.com",
+			secret:   "tls-missing",
+			expected: "/tls/tls-default.pem",
+			logging:  `WARN using certificate of the default pool due to an error reading secret 'tls-missing' on ingress 'default/echo': secret not found: 'default/tls-missing'`,
+		},
+		// 3
+		{
+			hostname: "sub.app.example.com",
+			secret:   "tls-missing",
+			expected: "/tls/tls-default.pem",
+			logging:  `WARN using default certificate due to an error reading secret 'tls-missing' on ingress 'default/echo': secret not found: 'default/tls-missing'`,
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		c.cache.SecretTLSPool = append([]convtypes.CrtFile{}, pool...)
+		c.createSecretTLS1("default/tls-echo")
+		c.createSvc1Auto()
+		c.Sync(c.createIngTLS1("default/echo", test.hostname, "/", "echo:8080", test.secret))
+		actual := c.hconfig.Hosts().AcquireHost(test.hostname).TLS.TLSFilename
+		if actual != test.expected {
+			c.t.Errorf("tls filename does not match in %d: expected '%s', actual '%s'", i, test.expected, actual)
+		}
+		if actualPool := c.hconfig.Frontend().DefaultCrtPool; !reflect.DeepEqual(actualPool, expectedPool) {
+			c.t.Errorf("default crt pool does not match in %d: expected %+v, actual %+v", i, expectedPool, actualPool)
+		}
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
 func TestSyncTLSCustom(t *testing.T) {
 	c := setup(t)
 	defer c.teardown()
@@ -601,6 +1003,103 @@ func TestSyncTLSSecretWithoutHost(t *testing.T) {
     tlsfilename: /tls/default/tls-echo.pem`)
 }
 
+func TestSyncTLSVaultPKI(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	c.createSvc1Auto()
+	c.createSecretTLS1("default/tls-echo")
+	c.cache.VaultCrtPath = map[string]string{
+		"vault:pki/web:echo1.example.com":     "/tls/vault_pki_web_echo1.example.com.pem",
+		"vault:pki-int/web:echo2.example.com": "/tls/vault_pki-int_web_echo2.example.com.pem",
+	}
+	ing1 := c.createIngTLS1("default/echo1", "echo1.example.com", "/", "echo:8080", "tls-echo")
+	ing1.SetAnnotations(map[string]string{
+		"ingress.kubernetes.io/vault-pki-role": "web",
+	})
+	ing2 := c.createIngTLS1("default/echo2", "echo2.example.com", "/", "echo:8080", "")
+	ing2.SetAnnotations(map[string]string{
+		"ingress.kubernetes.io/vault-pki-mount": "pki-int",
+		"ingress.kubernetes.io/vault-pki-role":  "web",
+	})
+	ing3 := c.createIngTLS1("default/echo3", "echo3.example.com", "/", "echo:8080", "")
+	ing3.SetAnnotations(map[string]string{
+		"ingress.kubernetes.io/vault-pki-role": "missing",
+	})
+	c.Sync(ing1, ing2, ing3)
+
+	c.compareConfigFront(`
+- hostname: echo1.example.com
+  paths:
+  - path: /
+    backend: default_echo_8080
+  tls:
+    tlsfilename: /tls/vault_pki_web_echo1.example.com.pem
+- hostname: echo2.example.com
+  paths:
+  - path: /
+    backend: default_echo_8080
+  tls:
+    tlsfilename: /tls/vault_pki-int_web_echo2.example.com.pem
+- hostname: echo3.example.com
+  paths:
+  - path: /
+    backend: default_echo_8080
+  tls:
+    tlsfilename: /tls/tls-default.pem`)
+
+	c.logger.CompareLogging(`
+WARN using default certificate due to an error issuing certificate of 'echo3.example.com' from vault role 'pki/missing' on ingress 'default/echo3': vault role not found: 'pki/missing'`)
+}
+
+func TestSyncTLSAcmeOptions(t *testing.T) {
+	testCases := []struct {
+		ann         map[string]string
+		expStorages []string
+		logging     string
+	}{
+		// 0
+		{
+			ann:         map[string]string{},
+			expStorages: []string{"default/tls-echo,echo.example.com"},
+		},
+		// 1
+		{
+			ann: map[string]string{
+				"ingress.kubernetes.io/acme-key-type":        "ecdsa256",
+				"ingress.kubernetes.io/acme-preferred-chain": "ISRG Root X1",
+			},
+			expStorages: []string{"default/tls-echo,echo.example.com;key-type=ecdsa256;preferred-chain=ISRG Root X1"},
+		},
+		// 2
+		{
+			ann: map[string]string{
+				"ingress.kubernetes.io/acme-key-type":        "dsa1024",
+				"ingress.kubernetes.io/acme-preferred-chain": "Root;X1",
+			},
+			expStorages: []string{"default/tls-echo,echo.example.com"},
+			logging: `
+WARN ignoring invalid acme key type on ingress 'default/echo': dsa1024
+WARN ignoring invalid acme preferred chain on ingress 'default/echo': Root;X1`,
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		c.createSvc1Auto()
+		c.createSecretTLS1("default/tls-echo")
+		ing := c.createIngTLS1("default/echo", "echo.example.com", "/", "echo:8080", "tls-echo")
+		test.ann["ingress.kubernetes.io/cert-signer"] = "acme"
+		ing.SetAnnotations(test.ann)
+		c.Sync(ing)
+		storages := c.hconfig.AcmeData().Storages().BuildAcmeStorages()
+		if !reflect.DeepEqual(storages, test.expStorages) {
+			t.Errorf("acme storages differs on %d: expected %v but was %v", i, test.expStorages, storages)
+		}
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
 func TestSyncIngressClass(t *testing.T) {
 	apiGroup1 := "some.io"
 	testCases := []struct {
@@ -1446,6 +1945,180 @@ func TestSyncPartialDefaultBackend(t *testing.T) {
 	c.logger.CompareLogging(`INFO-V(2) syncing 1 host(s) and 1 backend(s)`)
 }
 
+func TestSyncPartialGlobal(t *testing.T) {
+	testCases := []struct {
+		global  map[string]string
+		logging string
+		shards  []int
+	}{
+		// 0
+		{
+			global: map[string]string{ingtypes.GlobalTimeoutClient: "1s"},
+			logging: `
+INFO-V(2) applying global config change(s): [timeout-client]
+INFO-V(2) syncing 0 host(s) and 0 backend(s)`,
+			shards: []int{0, 1},
+		},
+		// 1
+		{
+			global: map[string]string{ingtypes.GlobalStatsPort: "1937"},
+			logging: `
+INFO-V(2) applying global config change(s): [stats-port]
+INFO-V(2) syncing 0 host(s) and 0 backend(s)`,
+			shards: []int{},
+		},
+		// 2
+		{
+			global: map[string]string{ingtypes.GlobalStatsPort: "1937", ingtypes.GlobalTimeoutClient: "1s"},
+			logging: `
+INFO-V(2) applying global config change(s): [stats-port timeout-client]
+INFO-V(2) syncing 0 host(s) and 0 backend(s)`,
+			shards: []int{0, 1},
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		c.hconfig = haproxy.CreateInstance(c.logger, haproxy.InstanceOptions{BackendShards: 2}).Config()
+
+		c.createSvc1Auto()
+		c.Sync(c.createIng1("default/echo", "echo.example.com", "/", "echo:8080"))
+		c.hconfig.Commit()
+		c.logger.Logging = []string{}
+
+		c.cache.Changed.GlobalNew = test.global
+		c.Sync()
+
+		c.compareConfigFront(`
+- hostname: echo.example.com
+  paths:
+  - path: /
+    backend: default_echo_8080`)
+		if shards := c.hconfig.Backends().ChangedShards(); !reflect.DeepEqual(shards, test.shards) {
+			t.Errorf("changed shards differ on %d - expected: %v - actual: %v", i, test.shards, shards)
+		}
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestGlobalConfigNeedFullSync(t *testing.T) {
+	testCases := []struct {
+		cur      map[string]string
+		new      map[string]string
+		changed  []string
+		keys     []string
+		fullSync bool
+	}{
+		// 0
+		{
+			cur:      nil,
+			new:      map[string]string{},
+			fullSync: true,
+		},
+		// 1
+		{
+			cur: map[string]string{},
+			new: nil,
+		},
+		// 2
+		{
+			cur:     map[string]string{},
+			new:     map[string]string{ingtypes.BackInitialWeight: "100"},
+			changed: []string{ingtypes.BackInitialWeight},
+		},
+		// 3
+		{
+			cur:     map[string]string{},
+			new:     map[string]string{ingtypes.GlobalTimeoutClient: "1s"},
+			changed: []string{ingtypes.GlobalTimeoutClient},
+			keys:    []string{ingtypes.GlobalTimeoutClient},
+		},
+		// 4
+		{
+			cur:     map[string]string{ingtypes.GlobalTimeoutClient: "1s", ingtypes.GlobalMaxConnections: "1000"},
+			new:     map[string]string{ingtypes.GlobalMaxConnections: "2000"},
+			changed: []string{ingtypes.GlobalMaxConnections, ingtypes.GlobalTimeoutClient},
+			keys:    []string{ingtypes.GlobalMaxConnections, ingtypes.GlobalTimeoutClient},
+		},
+		// 5
+		{
+			cur:      map[string]string{},
+			new:      map[string]string{ingtypes.GlobalTimeoutClient: "1s", ingtypes.BackBalanceAlgorithm: "leastconn"},
+			changed:  []string{ingtypes.BackBalanceAlgorithm, ingtypes.GlobalTimeoutClient},
+			keys:     []string{ingtypes.BackBalanceAlgorithm, ingtypes.GlobalTimeoutClient},
+			fullSync: true,
+		},
+		// 6
+		{
+			cur:      map[string]string{ingtypes.GlobalDrainSupport: "true"},
+			new:      map[string]string{},
+			changed:  []string{ingtypes.GlobalDrainSupport},
+			keys:     []string{ingtypes.GlobalDrainSupport},
+			fullSync: true,
+		},
+		// 7
+		{
+			cur:      map[string]string{},
+			new:      map[string]string{ingtypes.GlobalCookieKey: "s3cret"},
+			changed:  []string{ingtypes.GlobalCookieKey},
+			keys:     []string{ingtypes.GlobalCookieKey},
+			fullSync: true,
+		},
+		// 8
+		{
+			cur:     map[string]string{ingtypes.BackInitialWeight: "100", ingtypes.GlobalModsecurityTimeoutServer: "5s"},
+			new:     map[string]string{ingtypes.GlobalModsecurityTimeoutServer: "10s"},
+			changed: []string{ingtypes.BackInitialWeight, ingtypes.GlobalModsecurityTimeoutServer},
+			keys:    []string{ingtypes.GlobalModsecurityTimeoutServer},
+		},
+	}
+	defaultConfig := func() map[string]string {
+		return map[string]string{
+			ingtypes.BackInitialWeight: "100",
+		}
+	}
+	for i, test := range testCases {
+		changed := &convtypes.ChangedObjects{
+			GlobalCur:         test.cur,
+			GlobalNew:         test.new,
+			GlobalChangedKeys: test.changed,
+		}
+		keys := globalConfigChangedKeys(changed, defaultConfig)
+		if !reflect.DeepEqual(keys, test.keys) {
+			t.Errorf("changed keys differ on %d - expected: %v - actual: %v", i, test.keys, keys)
+		}
+		if fullSync := globalConfigNeedFullSync(changed, keys); fullSync != test.fullSync {
+			t.Errorf("need full sync differs on %d - expected: %v - actual: %v", i, test.fullSync, fullSync)
+		}
+	}
+}
+
+func TestEndpointIdentity(t *testing.T) {
+	testCases := []struct {
+		ep       hatypes.Endpoint
+		expected string
+	}{
+		// 0
+		{
+			ep:       hatypes.Endpoint{Name: "srv001", IP: "10.0.0.11", Port: 8080, TargetRef: "default/app-1"},
+			expected: "default/app-1",
+		},
+		// 1
+		{
+			ep:       hatypes.Endpoint{Name: "srv001", IP: "10.0.0.11", Port: 8080},
+			expected: "10.0.0.11:8080",
+		},
+	}
+	for i, test := range testCases {
+		if identity := endpointIdentity(&test.ep); identity != test.expected {
+			t.Errorf("identity differs on %d - expected: %s - actual: %s", i, test.expected, identity)
+		}
+	}
+	if cookieIdentityHash("key1", "default/app-1") == cookieIdentityHash("key2", "default/app-1") {
+		t.Errorf("expected distinct hashes on distinct keys")
+	}
+}
+
 /* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * *
  *
  *  ANNOTATIONS
@@ -1626,6 +2299,110 @@ func TestSyncAnnBacksSvcIng(t *testing.T) {
   maxconnserver: 10` + defaultBackendConfig)
 }
 
+func TestSyncAnnBackPathConfig(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	c.createSvc1("default/echo1", "8080", "172.17.0.11")
+	c.createSvc1("default/echo2", "8080", "172.17.0.12")
+	ing := c.createIng1Ann("default/echo", "echo.example.com", "/", "echo1:8080", map[string]string{
+		"ingress.kubernetes.io/balance-algorithm": "leastconn",
+		"ingress.kubernetes.io/maxconn-server":    "10",
+		"ingress.kubernetes.io/path-config": `
+/app:
+  balance-algorithm: first
+  app-root: /login
+/other:
+  maxconn-server: 20
+`,
+	})
+	path := *ing.Spec.Rules[0].HTTP.Paths[0].DeepCopy()
+	path.Path = "/app"
+	path.Backend.Service.Name = "echo2"
+	ing.Spec.Rules[0].HTTP.Paths = append(ing.Spec.Rules[0].HTTP.Paths, path)
+	c.Sync(ing)
+
+	c.compareConfigFront(`
+- hostname: echo.example.com
+  paths:
+  - path: /app
+    backend: default_echo2_8080
+  - path: /
+    backend: default_echo1_8080`)
+
+	c.compareConfigBack(`
+- id: default_echo1_8080
+  endpoints:
+  - ip: 172.17.0.11
+    port: 8080
+  balancealgorithm: leastconn
+  maxconnserver: 10
+- id: default_echo2_8080
+  endpoints:
+  - ip: 172.17.0.12
+    port: 8080
+  balancealgorithm: first
+  maxconnserver: 10` + defaultBackendConfig)
+
+	c.logger.CompareLogging(`
+WARN ignoring key 'app-root' of path config '/app' on ingress 'default/echo': only backend annotations can be declared per path
+WARN ignoring path config of '/other' on ingress 'default/echo': path not found`)
+}
+
+func TestSyncAnnBackAppProtocol(t *testing.T) {
+	testCases := []struct {
+		appProto string
+		annSvc   map[string]string
+		annIng   map[string]string
+		expected string
+	}{
+		// 0
+		{
+			appProto: "kubernetes.io/h2c",
+			expected: "h2",
+		},
+		// 1
+		{
+			appProto: "HTTPS",
+			expected: "h1-ssl",
+		},
+		// 2
+		{
+			appProto: "tcp",
+			expected: "",
+		},
+		// 3
+		{
+			appProto: "grpc",
+			annIng:   map[string]string{"ingress.kubernetes.io/backend-protocol": "h1"},
+			expected: "h1",
+		},
+		// 4
+		{
+			appProto: "grpc",
+			annSvc:   map[string]string{"ingress.kubernetes.io/backend-protocol": "h2-ssl"},
+			expected: "h2-ssl",
+		},
+	}
+	for _, test := range testCases {
+		c := setup(t)
+		svc, _ := c.createSvc1Ann("default/echo", "8080", "172.17.0.11", test.annSvc)
+		svc.Spec.Ports[0].AppProtocol = &test.appProto
+		c.Sync(c.createIng1Ann("default/echo", "echo.example.com", "/", "echo:8080", test.annIng))
+		var protocol string
+		if test.expected != "" {
+			protocol = `
+  protocol: ` + test.expected
+		}
+		c.compareConfigBack(`
+- id: default_echo_8080
+  endpoints:
+  - ip: 172.17.0.11
+    port: 8080` + protocol + defaultBackendConfig)
+		c.teardown()
+	}
+}
+
 func TestSyncAnnBackDefault(t *testing.T) {
 	c := setup(t)
 	defer c.teardown()
@@ -1713,6 +2490,214 @@ WARN skipping backend 'echo5:8080' annotation(s) from ingress 'default/echo5' du
 WARN skipping backend 'echo7:8080' annotation(s) from ingress 'default/echo7' due to conflict: [balance-algorithm]`)
 }
 
+func TestSyncAnnBackNamespaceConfig(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	c.nsCfg = "haproxy-config"
+	c.cache.ConfigMapList = map[string]*api.ConfigMap{
+		"default/haproxy-config": {Data: map[string]string{
+			"balance-algorithm": "first",
+			"maxconn-server":    "10",
+		}},
+	}
+	c.createSvc1("default/echo1", "8080", "172.17.0.11")
+	c.createSvc1Ann("default/echo2", "8080", "172.17.0.12", map[string]string{
+		"ingress.kubernetes.io/balance-algorithm": "leastconn",
+	})
+	c.createSvc1("other/echo3", "8080", "172.17.0.13")
+	c.cache.Changed.GlobalNew = map[string]string{
+		"balance-algorithm":     "roundrobin",
+		"namespace-config-keys": "balance-algorithm",
+	}
+	c.Sync(
+		c.createIng1("default/echo1", "echo.example.com", "/app1", "echo1:8080"),
+		c.createIng1("default/echo2", "echo.example.com", "/app2", "echo2:8080"),
+		c.createIng1("other/echo3", "echo.example.com", "/app3", "echo3:8080"),
+	)
+
+	c.compareConfigBack(`
+- id: default_echo1_8080
+  endpoints:
+  - ip: 172.17.0.11
+    port: 8080
+  balancealgorithm: first
+- id: default_echo2_8080
+  endpoints:
+  - ip: 172.17.0.12
+    port: 8080
+  balancealgorithm: leastconn
+- id: other_echo3_8080
+  endpoints:
+  - ip: 172.17.0.13
+    port: 8080
+  balancealgorithm: roundrobin
+- id: system_default_8080
+  endpoints:
+  - ip: 172.17.0.99
+    port: 8080
+  balancealgorithm: roundrobin`)
+
+	c.logger.CompareLogging(`
+WARN ignoring key 'maxconn-server' of namespace config 'default/haproxy-config': key is not allowed`)
+}
+
+func TestSyncConfigHierarchy(t *testing.T) {
+	testCases := []struct {
+		global   string
+		class    string
+		ns       string
+		ann      string
+		expected string
+	}{
+		// 0
+		{
+			global:   "first",
+			expected: "first",
+		},
+		// 1
+		{
+			global:   "first",
+			class:    "leastconn",
+			expected: "leastconn",
+		},
+		// 2
+		{
+			global:   "first",
+			ns:       "source",
+			expected: "source",
+		},
+		// 3
+		{
+			global:   "first",
+			class:    "leastconn",
+			ns:       "source",
+			expected: "source",
+		},
+		// 4
+		{
+			global:   "first",
+			class:    "leastconn",
+			ns:       "source",
+			ann:      "uri",
+			expected: "uri",
+		},
+	}
+	className := "haproxy-config"
+	toData := func(value string) map[string]string {
+		if value == "" {
+			return nil
+		}
+		return map[string]string{"balance-algorithm": value}
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		c.nsCfg = "haproxy-config"
+		c.cache.ConfigMapList = map[string]*api.ConfigMap{
+			"ingress-controller/class": {Data: toData(test.class)},
+			"default/haproxy-config":   {Data: toData(test.ns)},
+		}
+		c.cache.IngClassList = []*networking.IngressClass{{
+			ObjectMeta: metav1.ObjectMeta{Name: className},
+			Spec: networking.IngressClassSpec{
+				Parameters: &api.TypedLocalObjectReference{Kind: "ConfigMap", Name: "class"},
+			},
+		}}
+		c.cache.Changed.GlobalNew = map[string]string{
+			"balance-algorithm":     test.global,
+			"namespace-config-keys": "balance-algorithm",
+		}
+		var ann map[string]string
+		if test.ann != "" {
+			ann = map[string]string{"ingress.kubernetes.io/balance-algorithm": test.ann}
+		}
+		c.createSvc1Auto()
+		ing := c.createIng1Ann("default/echo", "echo.example.com", "/", "echo:8080", ann)
+		ing.Spec.IngressClassName = &className
+		c.Sync(ing)
+		backend := c.hconfig.Backends().FindBackend("default", "echo", "8080")
+		if backend.BalanceAlgorithm != test.expected {
+			t.Errorf("balance algorithm differs on %d - expected: %s - actual: %s", i, test.expected, backend.BalanceAlgorithm)
+		}
+		c.teardown()
+	}
+}
+
+func TestSyncAnnPrefixes(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	c.prefix = []string{"haproxy-ingress.github.io", "ingress.kubernetes.io"}
+	c.createSvc1AutoAnn(map[string]string{
+		"ingress.kubernetes.io/maxconn-server": "10",
+	})
+	c.Sync(
+		c.createIng1Ann("default/echo", "echo.example.com", "/", "echo:8080", map[string]string{
+			"haproxy-ingress.github.io/balance-algorithm": "leastconn",
+			"ingress.kubernetes.io/balance-algorithm":     "first",
+			"ingress.kubernetes.io/app-root":              "/app",
+			"haproxy-ingress.github.io/app-root":          "/app",
+		}),
+	)
+
+	c.compareConfigFront(`
+- hostname: echo.example.com
+  paths:
+  - path: /
+    backend: default_echo_8080
+  rootredirect: /app`)
+
+	c.compareConfigBack(`
+- id: default_echo_8080
+  endpoints:
+  - ip: 172.17.0.11
+    port: 8080
+  balancealgorithm: leastconn
+  maxconnserver: 10` + defaultBackendConfig)
+
+	c.logger.CompareLogging(`
+WARN ignoring annotation 'ingress.kubernetes.io/balance-algorithm' on ingress 'default/echo': conflicts with 'haproxy-ingress.github.io/balance-algorithm'`)
+}
+
+func TestSyncAnnBackNginx(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	c.nginx = true
+	c.createSvc1("default/echo1", "8080", "172.17.0.11")
+	c.createSvc1AutoAnn(map[string]string{
+		"nginx.ingress.kubernetes.io/load-balance": "round_robin",
+	})
+	c.Sync(
+		c.createIng1Ann("default/echo1", "echo.example.com", "/app1", "echo1:8080", map[string]string{
+			"ingress.kubernetes.io/balance-algorithm":       "leastconn",
+			"nginx.ingress.kubernetes.io/load-balance":      "round_robin",
+			"nginx.ingress.kubernetes.io/server-snippet":    "location /x {}",
+			"nginx.ingress.kubernetes.io/ssl-redirect":      "false",
+			"nginx.ingress.kubernetes.io/upstream-hash-by":  "$request_uri",
+			"nginx.ingress.kubernetes.io/proxy-buffer-size": "8k",
+		}),
+		c.createIng1("default/echo", "echo.example.com", "/app2", "echo:8080"),
+	)
+
+	c.compareConfigBack(`
+- id: default_echo1_8080
+  endpoints:
+  - ip: 172.17.0.11
+    port: 8080
+  balancealgorithm: leastconn
+- id: default_echo_8080
+  endpoints:
+  - ip: 172.17.0.11
+    port: 8080
+  balancealgorithm: roundrobin` + defaultBackendConfig)
+
+	c.logger.CompareLogging(`
+WARN ignoring annotation 'nginx.ingress.kubernetes.io/proxy-buffer-size' on ingress 'default/echo1': cannot translate to a native configuration
+WARN ignoring annotation 'nginx.ingress.kubernetes.io/server-snippet' on ingress 'default/echo1': cannot translate to a native configuration
+WARN ignoring annotation 'nginx.ingress.kubernetes.io/upstream-hash-by' on ingress 'default/echo1': cannot translate to a native configuration`)
+}
+
 func TestSyncAnnAuthURL(t *testing.T) {
 	c := setup(t)
 	defer c.teardown()
@@ -1747,6 +2732,233 @@ func TestSyncAnnAuthURL(t *testing.T) {
 	c.logger.CompareLogging(`WARN skipping auth-url on ingress 'default/echo2': service not found: 'default/authsvc2'`)
 }
 
+func TestSyncAnnHostDefaultBackend(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	c.createSvc1("default/echo", "http:8080", "172.17.1.101")
+	c.createSvc1("default/fallback", "http:8080", "172.17.1.102")
+	c.Sync(
+		c.createIng1Ann("default/echo1", "echo1.example.com", "/app", "echo:8080",
+			map[string]string{
+				"ingress.kubernetes.io/default-backend": "fallback:8080",
+			}),
+		c.createIng1Ann("default/echo2", "echo2.example.com", "/app", "echo:8080",
+			map[string]string{
+				"ingress.kubernetes.io/default-backend": "fallback:8080",
+			}),
+		c.createIng1("default/echo3", "echo2.example.com", "/", "echo:8080"),
+		c.createIng1Ann("default/echo4", "echo3.example.com", "/app", "echo:8080",
+			map[string]string{
+				"ingress.kubernetes.io/default-backend": "notfound:8080",
+			}),
+		c.createIng1Ann("default/echo5", "echo4.example.com", "/app", "echo:8080",
+			map[string]string{
+				"ingress.kubernetes.io/default-backend": "fallback",
+			}),
+	)
+
+	c.compareConfigFront(`
+- hostname: echo1.example.com
+  paths:
+  - path: /app
+    backend: default_echo_8080
+  - path: /
+    backend: default_fallback_8080
+- hostname: echo2.example.com
+  paths:
+  - path: /app
+    backend: default_echo_8080
+  - path: /
+    backend: default_echo_8080
+- hostname: echo3.example.com
+  paths:
+  - path: /app
+    backend: default_echo_8080
+- hostname: echo4.example.com
+  paths:
+  - path: /app
+    backend: default_echo_8080
+`)
+	c.logger.CompareLogging(`
+WARN ignoring default backend on ingress 'default/echo4': service not found: 'default/notfound'
+WARN ignoring default backend on ingress 'default/echo5': invalid service name and port: fallback`)
+}
+
+func TestSyncAnnHostInternal(t *testing.T) {
+	testCases := []struct {
+		ann      map[string]string
+		params   map[string]string
+		expected bool
+	}{
+		// 0
+		{},
+		// 1
+		{
+			ann:      map[string]string{"ingress.kubernetes.io/internal": "true"},
+			expected: true,
+		},
+		// 2
+		{
+			params:   map[string]string{"internal": "true"},
+			expected: true,
+		},
+		// 3
+		{
+			ann:      map[string]string{"ingress.kubernetes.io/internal": "false"},
+			params:   map[string]string{"internal": "true"},
+			expected: false,
+		},
+	}
+	className := "private"
+	for i, test := range testCases {
+		c := setup(t)
+		c.cache.ConfigMapList = map[string]*api.ConfigMap{
+			"ingress-controller/private": {Data: test.params},
+		}
+		c.cache.IngClassList = []*networking.IngressClass{{
+			ObjectMeta: metav1.ObjectMeta{Name: className},
+			Spec: networking.IngressClassSpec{
+				Parameters: &api.TypedLocalObjectReference{Kind: "ConfigMap", Name: "private"},
+			},
+		}}
+		c.createSvc1Auto()
+		ing := c.createIng1Ann("default/echo", "echo.example.com", "/", "echo:8080", test.ann)
+		ing.Spec.IngressClassName = &className
+		c.Sync(ing)
+		if internal := c.hconfig.Hosts().FindHost("echo.example.com").Internal; internal != test.expected {
+			t.Errorf("%d: expected internal %v but was %v", i, test.expected, internal)
+		}
+		c.teardown()
+	}
+}
+
+func TestSyncHostConflict(t *testing.T) {
+	testCases := []struct {
+		policy   string
+		priority string
+		expFront string
+		expLog   string
+	}{
+		// 0
+		{
+			expFront: `
+- hostname: echo.example.com
+  paths:
+  - path: /app
+    backend: other_echo_8080
+  - path: /
+    backend: default_echo_8080`,
+		},
+		// 1
+		{
+			policy: "reject",
+			expFront: `
+- hostname: echo.example.com
+  paths:
+  - path: /
+    backend: default_echo_8080`,
+			expLog: `
+WARN skipping host 'echo.example.com' of ingress 'other/echo': hostname belongs to namespace 'default'`,
+		},
+		// 2
+		{
+			policy:   "reject",
+			priority: "10",
+			expFront: `
+- hostname: echo.example.com
+  paths:
+  - path: /app
+    backend: other_echo_8080`,
+			expLog: `
+WARN skipping host 'echo.example.com' of ingress 'default/echo': hostname belongs to namespace 'other'`,
+		},
+		// 3
+		{
+			policy:   "reject",
+			priority: "high",
+			expFront: `
+- hostname: echo.example.com
+  paths:
+  - path: /
+    backend: default_echo_8080`,
+			expLog: `
+WARN ignoring host conflict priority of IngressClass 'tenant': invalid number: high
+WARN skipping host 'echo.example.com' of ingress 'other/echo': hostname belongs to namespace 'default'`,
+		},
+		// 4
+		{
+			policy: "first",
+			expFront: `
+- hostname: echo.example.com
+  paths:
+  - path: /app
+    backend: other_echo_8080
+  - path: /
+    backend: default_echo_8080`,
+			expLog: `
+WARN ignoring invalid host conflict policy 'first', using 'merge'`,
+		},
+	}
+	className := "tenant"
+	for _, test := range testCases {
+		c := setup(t)
+		c.cache.Changed.GlobalNew = map[string]string{ingtypes.GlobalHostConflictPolicy: test.policy}
+		c.cache.ConfigMapList = map[string]*api.ConfigMap{
+			"ingress-controller/tenant": {Data: map[string]string{ingtypes.GlobalHostConflictPriority: test.priority}},
+		}
+		c.cache.IngClassList = []*networking.IngressClass{{
+			ObjectMeta: metav1.ObjectMeta{Name: className},
+			Spec: networking.IngressClassSpec{
+				Parameters: &api.TypedLocalObjectReference{Kind: "ConfigMap", Name: "tenant"},
+			},
+		}}
+		c.createSvc1("default/echo", "8080", "172.17.0.11")
+		c.createSvc1("other/echo", "8080", "172.17.0.12")
+		ing2 := c.createIng1("other/echo", "echo.example.com", "/app", "echo:8080")
+		ing2.Spec.IngressClassName = &className
+		c.Sync(
+			c.createIng1("default/echo", "echo.example.com", "/", "echo:8080"),
+			ing2,
+		)
+		c.compareConfigFront(test.expFront)
+		c.logger.CompareLogging(test.expLog)
+		c.teardown()
+	}
+}
+
+func TestSyncIngressConditions(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+	c.cache.Changed.GlobalNew = map[string]string{ingtypes.GlobalHostConflictPolicy: "reject"}
+	c.createSvc1("default/echo", "8080", "172.17.0.11")
+	c.createSvc1("other/echo", "8080", "172.17.0.12")
+	c.createSecretTLS1("other/tls-echo")
+	c.Sync(
+		c.createIng1("default/echo", "echo.example.com", "/", "echo:8080"),
+		c.createIng1("other/echo", "echo.example.com", "/app", "echo:8080"),
+		c.createIngTLS1("other/echo1", "echo1.example.com", "/", "echo:8080", "tls-echo"),
+		c.createIngTLS1("other/echo2", "echo2.example.com", "/", "echo:8080", "tls-missing"),
+	)
+	expected := map[string]*ingtypes.IngressConditions{
+		"default/echo": {},
+		"other/echo": {
+			SkippedHosts: map[string]string{"echo.example.com": "hostname belongs to namespace 'default'"},
+		},
+		"other/echo1": {HasTLS: true},
+		"other/echo2": {
+			HasTLS:     true,
+			CertErrors: map[string]string{"echo2.example.com": "secret not found: 'other/tls-missing'"},
+		},
+	}
+	if !reflect.DeepEqual(c.conds, expected) {
+		t.Errorf("conditions differ - expected: %+v - actual: %+v", expected, c.conds)
+	}
+	c.logger.CompareLogging(`
+WARN skipping host 'echo.example.com' of ingress 'other/echo': hostname belongs to namespace 'default'
+WARN using default certificate due to an error reading secret 'tls-missing' on ingress 'other/echo2': secret not found: 'other/tls-missing'`)
+}
+
 func TestSyncAnnPassthrough(t *testing.T) {
 	c := setup(t)
 	defer c.teardown()
@@ -1822,6 +3034,12 @@ type testConfig struct {
 	cache   *conv_helper.CacheMock
 	tracker convtypes.Tracker
 	updater *updaterMock
+	nsCfg   string
+	nginx   bool
+	prefix  []string
+	ports   map[string]*ingtypes.ServicePort
+	drains  map[string]*ingtypes.DrainingHost
+	conds   map[string]*ingtypes.IngressConditions
 }
 
 func setup(t *testing.T) *testConfig {
@@ -1834,6 +3052,9 @@ func setup(t *testing.T) *testConfig {
 		cache:   conv_helper.NewCacheMock(tracker),
 		logger:  logger,
 		tracker: tracker,
+		ports:   map[string]*ingtypes.ServicePort{},
+		drains:  map[string]*ingtypes.DrainingHost{},
+		conds:   map[string]*ingtypes.IngressConditions{},
 	}
 	c.createSvc1("system/default", "8080", "172.17.0.99")
 	return c
@@ -1875,15 +3096,25 @@ func (c *testConfig) createConverter() *converter {
 			ingtypes.BackInitialWeight: "100",
 		}
 	}
+	prefix := c.prefix
+	if prefix == nil {
+		prefix = []string{"ingress.kubernetes.io"}
+	}
 	return NewIngressConverter(
 		&ingtypes.ConverterOptions{
 			Cache:            c.cache,
 			Logger:           c.logger,
 			Tracker:          c.tracker,
+			Metrics:          types_helper.NewMetricsMock(),
 			DefaultConfig:    defaultConfig,
 			DefaultBackend:   "system/default",
 			DefaultCrtSecret: "system/default",
-			AnnotationPrefix: "ingress.kubernetes.io",
+			AnnotationPrefix: prefix,
+			NamespaceConfig:  c.nsCfg,
+			TranslateNginx:   c.nginx,
+			ServicePorts:     c.ports,
+			DrainingHosts:    c.drains,
+			Conditions:       c.conds,
 		},
 		c.hconfig,
 	).(*converter)
@@ -2100,11 +3331,14 @@ func (u *updaterMock) UpdateGlobalConfig(haproxyConfig haproxy.Config, config *a
 
 func (u *updaterMock) UpdateHostConfig(host *hatypes.Host, mapper *annotations.Mapper) {
 	host.RootRedirect = mapper.Get(ingtypes.HostAppRoot).Value
+	host.Internal = mapper.Get(ingtypes.HostInternal).Bool()
+	host.Tenant = mapper.Get(ingtypes.HostTenant).Value
 }
 
 func (u *updaterMock) UpdateBackendConfig(backend *hatypes.Backend, mapper *annotations.Mapper) {
 	backend.Server.MaxConn = mapper.Get(ingtypes.BackMaxconnServer).Int()
 	backend.BalanceAlgorithm = mapper.Get(ingtypes.BackBalanceAlgorithm).Value
+	backend.Server.Protocol = mapper.Get(ingtypes.BackBackendProtocol).Value
 }
 
 type (
@@ -2118,11 +3352,18 @@ type (
 	tlsMock struct {
 		TLSFilename string `yaml:",omitempty"`
 	}
+	drainMock struct {
+		Draining bool   `yaml:",omitempty"`
+		Location string `yaml:",omitempty"`
+	}
 	hostMock struct {
 		Hostname     string
 		Paths        []pathMock
-		RootRedirect string  `yaml:",omitempty"`
-		TLS          tlsMock `yaml:",omitempty"`
+		RootRedirect string    `yaml:",omitempty"`
+		Internal     bool      `yaml:",omitempty"`
+		Tenant       string    `yaml:",omitempty"`
+		TLS          tlsMock   `yaml:",omitempty"`
+		Drain        drainMock `yaml:",omitempty"`
 	}
 )
 
@@ -2137,7 +3378,10 @@ func convertHost(hafronts ...*hatypes.Host) []hostMock {
 			Hostname:     f.Hostname,
 			Paths:        paths,
 			RootRedirect: f.RootRedirect,
+			Internal:     f.Internal,
+			Tenant:       f.Tenant,
 			TLS:          tlsMock{TLSFilename: f.TLS.TLSFilename},
+			Drain:        drainMock{Draining: f.Drain.Draining, Location: f.Drain.Location},
 		})
 	}
 	return hosts
@@ -2167,6 +3411,7 @@ type (
 		Endpoints        []endpointMock `yaml:",omitempty"`
 		BalanceAlgorithm string         `yaml:",omitempty"`
 		MaxConnServer    int            `yaml:",omitempty"`
+		Protocol         string         `yaml:",omitempty"`
 	}
 )
 
@@ -2182,6 +3427,7 @@ func convertBackend(habackends ...*hatypes.Backend) []backendMock {
 			Endpoints:        endpoints,
 			BalanceAlgorithm: b.BalanceAlgorithm,
 			MaxConnServer:    b.Server.MaxConn,
+			Protocol:         b.Server.Protocol,
 		})
 	}
 	return backends
@@ -0,0 +1,146 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingress
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	ingtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/types"
+)
+
+const nginxAnnPrefix = "nginx.ingress.kubernetes.io/"
+
+// nginxAnnotation translates the value of an ingress-nginx annotation
+// to a native configuration key and value. An empty key means that the
+// value cannot be translated.
+type nginxAnnotation func(value string) (key, newValue string)
+
+// nginxAnnotations has the ingress-nginx annotations that have a native
+// counterpart, see translateNginxAnnotations.
+var nginxAnnotations = map[string]nginxAnnotation{
+	"affinity":               nginxSame(ingtypes.BackAffinity),
+	"app-root":               nginxSame(ingtypes.HostAppRoot),
+	"auth-realm":             nginxSame(ingtypes.BackAuthRealm),
+	"auth-secret":            nginxSame(ingtypes.BackAuthSecret),
+	"auth-signin":            nginxSame(ingtypes.BackAuthSignin),
+	"auth-tls-error-page":    nginxSame(ingtypes.HostAuthTLSErrorPage),
+	"auth-tls-secret":        nginxSame(ingtypes.HostAuthTLSSecret),
+	"auth-tls-verify-client": nginxSame(ingtypes.HostAuthTLSVerifyClient),
+	"auth-url":               nginxSame(ingtypes.BackAuthURL),
+	"backend-protocol": nginxEnum(ingtypes.BackBackendProtocol, map[string]string{
+		"HTTP":  "h1",
+		"HTTPS": "h1-ssl",
+		"GRPC":  "h2",
+		"GRPCS": "h2-ssl",
+	}),
+	"cors-allow-credentials": nginxSame(ingtypes.BackCorsAllowCredentials),
+	"cors-allow-headers":     nginxSame(ingtypes.BackCorsAllowHeaders),
+	"cors-allow-methods":     nginxSame(ingtypes.BackCorsAllowMethods),
+	"cors-allow-origin":      nginxSame(ingtypes.BackCorsAllowOrigin),
+	"cors-expose-headers":    nginxSame(ingtypes.BackCorsExposeHeaders),
+	"cors-max-age":           nginxSame(ingtypes.BackCorsMaxAge),
+	"denylist-source-range":  nginxSame(ingtypes.BackDenylistSourceRange),
+	"enable-cors":            nginxSame(ingtypes.BackCorsEnable),
+	"force-ssl-redirect":     nginxSame(ingtypes.BackSSLRedirect),
+	"limit-connections":      nginxSame(ingtypes.BackLimitConnections),
+	"limit-rps":              nginxSame(ingtypes.BackLimitRPS),
+	"limit-whitelist":        nginxSame(ingtypes.BackLimitWhitelist),
+	"load-balance": nginxEnum(ingtypes.BackBalanceAlgorithm, map[string]string{
+		"round_robin": "roundrobin",
+	}),
+	"proxy-body-size": func(value string) (string, string) {
+		if value == "0" {
+			return ingtypes.BackProxyBodySize, "unlimited"
+		}
+		return ingtypes.BackProxyBodySize, value
+	},
+	"proxy-connect-timeout": nginxSeconds(ingtypes.BackTimeoutConnect),
+	"proxy-read-timeout":    nginxSeconds(ingtypes.BackTimeoutServer),
+	"rewrite-target": func(value string) (string, string) {
+		if strings.Contains(value, "$") {
+			// regex captures have no native counterpart
+			return "", ""
+		}
+		return ingtypes.BackRewriteTarget, value
+	},
+	"server-alias":           nginxSame(ingtypes.HostServerAlias),
+	"service-upstream":       nginxSame(ingtypes.BackServiceUpstream),
+	"session-cookie-name":    nginxSame(ingtypes.BackSessionCookieName),
+	"ssl-passthrough":        nginxSame(ingtypes.HostSSLPassthrough),
+	"ssl-redirect":           nginxSame(ingtypes.BackSSLRedirect),
+	"whitelist-source-range": nginxSame(ingtypes.BackAllowlistSourceRange),
+}
+
+func nginxSame(key string) nginxAnnotation {
+	return func(value string) (string, string) {
+		return key, value
+	}
+}
+
+func nginxEnum(key string, values map[string]string) nginxAnnotation {
+	return func(value string) (string, string) {
+		for nginxValue, newValue := range values {
+			if strings.EqualFold(value, nginxValue) {
+				return key, newValue
+			}
+		}
+		return "", ""
+	}
+}
+
+// nginxSeconds translates timeouts, ingress-nginx uses seconds without a suffix
+func nginxSeconds(key string) nginxAnnotation {
+	return func(value string) (string, string) {
+		if _, err := strconv.Atoi(value); err == nil {
+			return key, value + "s"
+		}
+		return "", ""
+	}
+}
+
+// translateNginxAnnotations returns the native configuration keys of the
+// ingress-nginx annotations, and the sorted list of the annotations that
+// couldn't be translated. Annotations without the ingress-nginx prefix
+// are ignored. Annotations are read in alphabetical order, the first one
+// wins if more than one translate to the same key, eg force-ssl-redirect
+// has precedence over ssl-redirect.
+func translateNginxAnnotations(ann map[string]string) (translated map[string]string, skipped []string) {
+	names := make([]string, 0, len(ann))
+	for annName := range ann {
+		if strings.HasPrefix(annName, nginxAnnPrefix) {
+			names = append(names, annName)
+		}
+	}
+	sort.Strings(names)
+	translated = make(map[string]string, len(names))
+	for _, annName := range names {
+		var key, value string
+		if translate, found := nginxAnnotations[strings.TrimPrefix(annName, nginxAnnPrefix)]; found {
+			key, value = translate(ann[annName])
+		}
+		if key == "" {
+			skipped = append(skipped, annName)
+			continue
+		}
+		if _, found := translated[key]; !found {
+			translated[key] = value
+		}
+	}
+	return translated, skipped
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingress
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTranslateNginxAnnotations(t *testing.T) {
+	testCases := []struct {
+		ann        map[string]string
+		expected   map[string]string
+		expSkipped []string
+	}{
+		// 0
+		{
+			ann: map[string]string{
+				"ingress.kubernetes.io/ssl-redirect":                 "true",
+				"nginx.ingress.kubernetes.io/whitelist-source-range": "10.0.0.0/8",
+				"nginx.ingress.kubernetes.io/app-root":               "/app",
+			},
+			expected: map[string]string{
+				"allowlist-source-range": "10.0.0.0/8",
+				"app-root":               "/app",
+			},
+		},
+		// 1
+		{
+			ann: map[string]string{
+				"nginx.ingress.kubernetes.io/proxy-body-size":       "0",
+				"nginx.ingress.kubernetes.io/proxy-connect-timeout": "10",
+				"nginx.ingress.kubernetes.io/proxy-read-timeout":    "1m",
+			},
+			expected: map[string]string{
+				"proxy-body-size": "unlimited",
+				"timeout-connect": "10s",
+			},
+			expSkipped: []string{"nginx.ingress.kubernetes.io/proxy-read-timeout"},
+		},
+		// 2
+		{
+			ann: map[string]string{
+				"nginx.ingress.kubernetes.io/backend-protocol": "GRPCS",
+				"nginx.ingress.kubernetes.io/load-balance":     "ewma",
+			},
+			expected: map[string]string{
+				"backend-protocol": "h2-ssl",
+			},
+			expSkipped: []string{"nginx.ingress.kubernetes.io/load-balance"},
+		},
+		// 3
+		{
+			ann: map[string]string{
+				"nginx.ingress.kubernetes.io/rewrite-target":        "/$2",
+				"nginx.ingress.kubernetes.io/configuration-snippet": "more_set_headers \"X-Id: 1\";",
+			},
+			expected: map[string]string{},
+			expSkipped: []string{
+				"nginx.ingress.kubernetes.io/configuration-snippet",
+				"nginx.ingress.kubernetes.io/rewrite-target",
+			},
+		},
+		// 4
+		{
+			ann: map[string]string{
+				"nginx.ingress.kubernetes.io/ssl-redirect":       "false",
+				"nginx.ingress.kubernetes.io/force-ssl-redirect": "true",
+				"nginx.ingress.kubernetes.io/rewrite-target":     "/",
+			},
+			expected: map[string]string{
+				"rewrite-target": "/",
+				"ssl-redirect":   "true",
+			},
+		},
+	}
+	for i, test := range testCases {
+		translated, skipped := translateNginxAnnotations(test.ann)
+		if !reflect.DeepEqual(translated, test.expected) {
+			t.Errorf("translated differs on %d, expected %v but was %v", i, test.expected, translated)
+		}
+		if !reflect.DeepEqual(skipped, test.expSkipped) {
+			t.Errorf("skipped differs on %d, expected %v but was %v", i, test.expSkipped, skipped)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingress
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	networking "k8s.io/api/networking/v1"
+
+	ingtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/types"
+	hatypes "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/types"
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/utils"
+)
+
+// defaultQuotaNamespace is the namespace name of the quota applied to
+// all the namespaces without their own quota.
+const defaultQuotaNamespace = "*"
+
+// namespaceQuota has the maximum number of distinct hosts, paths and
+// backends that the ingress resources of a namespace can declare. A
+// negative number means unlimited.
+type namespaceQuota struct {
+	hosts    int
+	paths    int
+	backends int
+}
+
+// namespaceUsage has the distinct hosts, paths and backends already
+// declared by the admitted ingress resources of a namespace.
+type namespaceUsage struct {
+	hosts    map[string]bool
+	paths    map[string]bool
+	backends map[string]bool
+}
+
+// syncQuotas calculates the ingress resources that exceed the quota of
+// their namespaces. Quotas are calculated from the full ingress list, so
+// an ingress resource can be admitted or rejected due to a change in
+// another ingress resource. A full sync is started in such case, since
+// the ingress resource whose admission changed isn't tracked as dirty.
+func (c *converter) syncQuotas() {
+	quotas := c.readNamespaceQuotas()
+	var rejected map[string]string
+	if len(quotas) > 0 {
+		ingList, err := c.cache.GetIngressList()
+		if err != nil {
+			c.logger.Error("error reading ingress list: %v", err)
+			return
+		}
+		sortIngress(ingList)
+		rejected = readQuotaRejected(quotas, ingList)
+	}
+	if !c.needFullSync && !reflect.DeepEqual(rejected, c.options.QuotaRejected) {
+		c.needFullSync = true
+	}
+	c.options.QuotaRejected = rejected
+}
+
+// readNamespaceQuotas reads the quotas declared in the namespace-quotas
+// global config, one namespace per line: the namespace name, or `*` for
+// all the other namespaces, followed by its `option=value` pairs.
+func (c *converter) readNamespaceQuotas() map[string]*namespaceQuota {
+	quotas := map[string]*namespaceQuota{}
+	for _, line := range utils.LineToSlice(c.globalConfig.Get(ingtypes.GlobalNamespaceQuotas).Value) {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		namespace := fields[0]
+		quota := &namespaceQuota{hosts: -1, paths: -1, backends: -1}
+		valid := true
+		for _, field := range fields[1:] {
+			option := strings.SplitN(field, "=", 2)
+			var value int
+			var err error
+			if len(option) == 2 {
+				value, err = strconv.Atoi(option[1])
+			}
+			if len(option) != 2 || err != nil || value < 0 {
+				c.logger.Warn("ignoring quota of namespace '%s': invalid option: %s", namespace, field)
+				valid = false
+				break
+			}
+			switch option[0] {
+			case "hosts":
+				quota.hosts = value
+			case "paths":
+				quota.paths = value
+			case "backends":
+				quota.backends = value
+			default:
+				c.logger.Warn("ignoring quota of namespace '%s': unsupported option: %s", namespace, option[0])
+				valid = false
+			}
+			if !valid {
+				break
+			}
+		}
+		if valid {
+			quotas[namespace] = quota
+		}
+	}
+	return quotas
+}
+
+// readQuotaRejected returns the ingress resources, and the reason, that
+// exceed the quota of their namespaces. ingList should be sorted, older
+// ingress resources are admitted first.
+func readQuotaRejected(quotas map[string]*namespaceQuota, ingList []*networking.Ingress) map[string]string {
+	rejected := map[string]string{}
+	usages := map[string]*namespaceUsage{}
+	for _, ing := range ingList {
+		quota, found := quotas[ing.Namespace]
+		if !found {
+			quota, found = quotas[defaultQuotaNamespace]
+			if !found {
+				continue
+			}
+		}
+		usage, found := usages[ing.Namespace]
+		if !found {
+			usage = &namespaceUsage{
+				hosts:    map[string]bool{},
+				paths:    map[string]bool{},
+				backends: map[string]bool{},
+			}
+			usages[ing.Namespace] = usage
+		}
+		hosts, paths, backends := readIngressUsage(ing)
+		if exceed(usage.hosts, hosts, quota.hosts) {
+			rejected[ing.Namespace+"/"+ing.Name] = fmt.Sprintf("namespace '%s' exceeds its quota of %d host(s)", ing.Namespace, quota.hosts)
+		} else if exceed(usage.paths, paths, quota.paths) {
+			rejected[ing.Namespace+"/"+ing.Name] = fmt.Sprintf("namespace '%s' exceeds its quota of %d path(s)", ing.Namespace, quota.paths)
+		} else if exceed(usage.backends, backends, quota.backends) {
+			rejected[ing.Namespace+"/"+ing.Name] = fmt.Sprintf("namespace '%s' exceeds its quota of %d backend(s)", ing.Namespace, quota.backends)
+		} else {
+			for hostname := range hosts {
+				usage.hosts[hostname] = true
+			}
+			for path := range paths {
+				usage.paths[path] = true
+			}
+			for backend := range backends {
+				usage.backends[backend] = true
+			}
+		}
+	}
+	if len(rejected) == 0 {
+		return nil
+	}
+	return rejected
+}
+
+// readIngressUsage returns the distinct hosts, paths and backends
+// declared by an ingress resource.
+func readIngressUsage(ing *networking.Ingress) (hosts, paths, backends map[string]bool) {
+	hosts = map[string]bool{}
+	paths = map[string]bool{}
+	backends = map[string]bool{}
+	addBackend := func(backend *networking.IngressBackend) {
+		if svcName, svcPort, err := readServiceNamePort(backend); err == nil {
+			backends[svcName+":"+svcPort] = true
+		}
+	}
+	if ing.Spec.DefaultBackend != nil {
+		addBackend(ing.Spec.DefaultBackend)
+	}
+	for _, rule := range ing.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		hostname := rule.Host
+		if hostname == "" {
+			hostname = hatypes.DefaultHost
+		}
+		hosts[hostname] = true
+		for _, path := range rule.HTTP.Paths {
+			uri := path.Path
+			if uri == "" {
+				uri = "/"
+			}
+			paths[hostname+uri] = true
+			addBackend(&path.Backend)
+		}
+	}
+	return hosts, paths, backends
+}
+
+// exceed returns true if the distinct items of used and add is greater
+// than max. A negative max means unlimited.
+func exceed(used, add map[string]bool, max int) bool {
+	if max < 0 {
+		return false
+	}
+	count := len(used)
+	for item := range add {
+		if !used[item] {
+			count++
+		}
+	}
+	return count > max
+}
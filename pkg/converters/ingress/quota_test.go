@@ -0,0 +1,163 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingress
+
+import (
+	"testing"
+
+	ingtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/ingress/types"
+)
+
+func TestSyncQuotas(t *testing.T) {
+	testCases := []struct {
+		quotas   string
+		expFront string
+		expLog   string
+	}{
+		// 0
+		{
+			expFront: `
+- hostname: d1.local
+  paths:
+  - path: /
+    backend: default_echo1_8080
+- hostname: d2.local
+  paths:
+  - path: /app
+    backend: default_echo2_8080
+  - path: /
+    backend: default_echo1_8080
+- hostname: d3.local
+  paths:
+  - path: /
+    backend: other_echo_8080`,
+		},
+		// 1
+		{
+			quotas: "default hosts=1",
+			expFront: `
+- hostname: d1.local
+  paths:
+  - path: /
+    backend: default_echo1_8080
+- hostname: d3.local
+  paths:
+  - path: /
+    backend: other_echo_8080`,
+			expLog: `
+WARN skipping ingress 'default/ing2': namespace 'default' exceeds its quota of 1 host(s)
+WARN skipping ingress 'default/ing3': namespace 'default' exceeds its quota of 1 host(s)`,
+		},
+		// 2
+		{
+			quotas: "default hosts=2 paths=2",
+			expFront: `
+- hostname: d1.local
+  paths:
+  - path: /
+    backend: default_echo1_8080
+- hostname: d2.local
+  paths:
+  - path: /
+    backend: default_echo1_8080
+- hostname: d3.local
+  paths:
+  - path: /
+    backend: other_echo_8080`,
+			expLog: `
+WARN skipping ingress 'default/ing3': namespace 'default' exceeds its quota of 2 path(s)`,
+		},
+		// 3
+		{
+			quotas: "* backends=1",
+			expFront: `
+- hostname: d1.local
+  paths:
+  - path: /
+    backend: default_echo1_8080
+- hostname: d2.local
+  paths:
+  - path: /
+    backend: default_echo1_8080
+- hostname: d3.local
+  paths:
+  - path: /
+    backend: other_echo_8080`,
+			expLog: `
+WARN skipping ingress 'default/ing3': namespace 'default' exceeds its quota of 1 backend(s)`,
+		},
+		// 4
+		{
+			quotas: `
+* hosts=0
+default hosts=5`,
+			expFront: `
+- hostname: d1.local
+  paths:
+  - path: /
+    backend: default_echo1_8080
+- hostname: d2.local
+  paths:
+  - path: /app
+    backend: default_echo2_8080
+  - path: /
+    backend: default_echo1_8080`,
+			expLog: `
+WARN skipping ingress 'other/ing4': namespace 'other' exceeds its quota of 0 host(s)`,
+		},
+		// 5
+		{
+			quotas: `
+default hosts=1 paths
+other ingresses=1`,
+			expFront: `
+- hostname: d1.local
+  paths:
+  - path: /
+    backend: default_echo1_8080
+- hostname: d2.local
+  paths:
+  - path: /app
+    backend: default_echo2_8080
+  - path: /
+    backend: default_echo1_8080
+- hostname: d3.local
+  paths:
+  - path: /
+    backend: other_echo_8080`,
+			expLog: `
+WARN ignoring quota of namespace 'default': invalid option: paths
+WARN ignoring quota of namespace 'other': unsupported option: ingresses`,
+		},
+	}
+	for _, test := range testCases {
+		c := setup(t)
+		c.cache.Changed.GlobalNew = map[string]string{ingtypes.GlobalNamespaceQuotas: test.quotas}
+		c.createSvc1("default/echo1", "8080", "172.17.0.11")
+		c.createSvc1("default/echo2", "8080", "172.17.0.12")
+		c.createSvc1("other/echo", "8080", "172.17.0.13")
+		c.Sync(
+			c.createIng1("default/ing1", "d1.local", "/", "echo1:8080"),
+			c.createIng1("default/ing2", "d2.local", "/", "echo1:8080"),
+			c.createIng1("default/ing3", "d2.local", "/app", "echo2:8080"),
+			c.createIng1("other/ing4", "d3.local", "/", "echo:8080"),
+		)
+		c.compareConfigFront(test.expFront)
+		c.logger.CompareLogging(test.expLog)
+		c.teardown()
+	}
+}
@@ -52,6 +52,8 @@ type tracker struct {
 	// configMap
 	configMapHostname stringStringMap
 	hostnameConfigMap stringStringMap
+	configMapBackend  stringBackendMap
+	backendConfigMap  backendStringMap
 	// service
 	serviceHostname stringStringMap
 	hostnameService stringStringMap
@@ -71,6 +73,8 @@ type tracker struct {
 	// configMap (missing)
 	configMapHostnameMissing stringStringMap
 	hostnameConfigMapMissing stringStringMap
+	configMapBackendMissing  stringBackendMap
+	backendConfigMapMissing  backendStringMap
 	// service (missing)
 	serviceHostnameMissing stringStringMap
 	hostnameServiceMissing stringStringMap
@@ -132,6 +136,9 @@ func (t *tracker) TrackBackend(rtype convtypes.ResourceType, name string, backen
 	case convtypes.IngressType:
 		addStringBackendTracking(&t.ingressBackend, name, backendID)
 		addBackendStringTracking(&t.backendIngress, backendID, name)
+	case convtypes.ConfigMapType:
+		addStringBackendTracking(&t.configMapBackend, name, backendID)
+		addBackendStringTracking(&t.backendConfigMap, backendID, name)
 	case convtypes.SecretType:
 		addStringBackendTracking(&t.secretBackend, name, backendID)
 		addBackendStringTracking(&t.backendSecret, backendID, name)
@@ -188,6 +195,9 @@ func (t *tracker) TrackMissingOnHostname(rtype convtypes.ResourceType, name, hos
 func (t *tracker) TrackMissingOnBackend(rtype convtypes.ResourceType, name string, backendID hatypes.BackendID) {
 	validName(rtype, name)
 	switch rtype {
+	case convtypes.ConfigMapType:
+		addStringBackendTracking(&t.configMapBackendMissing, name, backendID)
+		addBackendStringTracking(&t.backendConfigMapMissing, backendID, name)
 	case convtypes.SecretType:
 		addStringBackendTracking(&t.secretBackendMissing, name, backendID)
 		addBackendStringTracking(&t.backendSecretMissing, backendID, name)
@@ -282,6 +292,12 @@ func (t *tracker) GetDirtyLinks(
 				build(t.getIngressByHostname(hostname))
 			}
 		}
+		for _, backend := range t.getBackendsByConfigMap(className) {
+			if _, found := backsMap[backend]; !found {
+				backsMap[backend] = empty{}
+				build(t.getIngressByBackend(backend))
+			}
+		}
 	}
 	for _, className := range addConfigMapList {
 		for _, hostname := range t.getHostnamesByConfigMapMissing(className) {
@@ -290,6 +306,12 @@ func (t *tracker) GetDirtyLinks(
 				build(t.getIngressByHostname(hostname))
 			}
 		}
+		for _, backend := range t.getBackendsByConfigMapMissing(className) {
+			if _, found := backsMap[backend]; !found {
+				backsMap[backend] = empty{}
+				build(t.getIngressByBackend(backend))
+			}
+		}
 	}
 	//
 	for _, svcName := range oldServiceList {
@@ -440,6 +462,14 @@ func (t *tracker) DeleteBackends(backends []hatypes.BackendID) {
 			deleteStringBackendTracking(&t.ingressBackend, ing, backend)
 		}
 		deleteBackendStringMapKey(&t.backendIngress, backend)
+		for configMap := range t.backendConfigMap[backend] {
+			deleteStringBackendTracking(&t.configMapBackend, configMap, backend)
+		}
+		deleteBackendStringMapKey(&t.backendConfigMap, backend)
+		for configMap := range t.backendConfigMapMissing[backend] {
+			deleteStringBackendTracking(&t.configMapBackendMissing, configMap, backend)
+		}
+		deleteBackendStringMapKey(&t.backendConfigMapMissing, backend)
 		for secret := range t.backendSecret[backend] {
 			deleteStringBackendTracking(&t.secretBackend, secret, backend)
 		}
@@ -473,6 +503,159 @@ func (t *tracker) DeleteStorages(storages []string) {
 	}
 }
 
+// GetIngressesByBackend returns the sorted list of ingress names,
+// in the namespace/name format, which reference the backend.
+func (t *tracker) GetIngressesByBackend(backendID hatypes.BackendID) []string {
+	ingresses := t.getIngressByBackend(backendID)
+	sort.Strings(ingresses)
+	return ingresses
+}
+
+// GetTrackedCount returns the number of distinct resources, per resource
+// type, that are currently tracked, including the missing ones.
+func (t *tracker) GetTrackedCount() map[convtypes.ResourceType]int {
+	count := map[convtypes.ResourceType]int{}
+	for _, rtype := range []convtypes.ResourceType{
+		convtypes.IngressType,
+		convtypes.IngressClassType,
+		convtypes.ConfigMapType,
+		convtypes.ServiceType,
+		convtypes.SecretType,
+		convtypes.PodType,
+	} {
+		count[rtype] = countNames(t.trackingByType(rtype))
+	}
+	return count
+}
+
+// IsTracked returns true if the resource is currently tracked by
+// any hostname, backend, userlist or storage, including as missing.
+func (t *tracker) IsTracked(rtype convtypes.ResourceType, name string) bool {
+	stringTracking, backendTracking := t.trackingByType(rtype)
+	for _, tracking := range stringTracking {
+		if _, found := tracking[name]; found {
+			return true
+		}
+	}
+	for _, tracking := range backendTracking {
+		if _, found := tracking[name]; found {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *tracker) trackingByType(rtype convtypes.ResourceType) ([]stringStringMap, []stringBackendMap) {
+	switch rtype {
+	case convtypes.IngressType:
+		return []stringStringMap{t.ingressHostname, t.ingressStorages},
+			[]stringBackendMap{t.ingressBackend}
+	case convtypes.IngressClassType:
+		return []stringStringMap{t.ingressClassHostname, t.ingressClassHostnameMissing}, nil
+	case convtypes.ConfigMapType:
+		return []stringStringMap{t.configMapHostname, t.configMapHostnameMissing},
+			[]stringBackendMap{t.configMapBackend, t.configMapBackendMissing}
+	case convtypes.ServiceType:
+		return []stringStringMap{t.serviceHostname, t.serviceHostnameMissing}, nil
+	case convtypes.SecretType:
+		return []stringStringMap{t.secretHostname, t.secretUserlist, t.secretHostnameMissing},
+			[]stringBackendMap{t.secretBackend, t.secretBackendMissing}
+	case convtypes.PodType:
+		return nil, []stringBackendMap{t.podBackend}
+	}
+	return nil, nil
+}
+
+// Dump returns a copy of all the tracking links, used for troubleshooting.
+// Names of the outer map are the source and target types, e.g. `ingressHostname`,
+// inner maps are indexed by the source name and have a sorted list of targets.
+func (t *tracker) Dump() map[string]map[string][]string {
+	dump := map[string]map[string][]string{}
+	for name, tracking := range map[string]stringStringMap{
+		"ingressHostname":             t.ingressHostname,
+		"hostnameIngress":             t.hostnameIngress,
+		"ingressStorages":             t.ingressStorages,
+		"storagesIngress":             t.storagesIngress,
+		"ingressClassHostname":        t.ingressClassHostname,
+		"hostnameIngressClass":        t.hostnameIngressClass,
+		"configMapHostname":           t.configMapHostname,
+		"hostnameConfigMap":           t.hostnameConfigMap,
+		"serviceHostname":             t.serviceHostname,
+		"hostnameService":             t.hostnameService,
+		"secretHostname":              t.secretHostname,
+		"hostnameSecret":              t.hostnameSecret,
+		"secretUserlist":              t.secretUserlist,
+		"userlistSecret":              t.userlistSecret,
+		"ingressClassHostnameMissing": t.ingressClassHostnameMissing,
+		"hostnameIngressClassMissing": t.hostnameIngressClassMissing,
+		"configMapHostnameMissing":    t.configMapHostnameMissing,
+		"hostnameConfigMapMissing":    t.hostnameConfigMapMissing,
+		"serviceHostnameMissing":      t.serviceHostnameMissing,
+		"hostnameServiceMissing":      t.hostnameServiceMissing,
+		"secretHostnameMissing":       t.secretHostnameMissing,
+		"hostnameSecretMissing":       t.hostnameSecretMissing,
+	} {
+		links := make(map[string][]string, len(tracking))
+		for key, values := range tracking {
+			list := getStringTracking(values)
+			sort.Strings(list)
+			links[key] = list
+		}
+		dump[name] = links
+	}
+	for name, tracking := range map[string]stringBackendMap{
+		"ingressBackend":          t.ingressBackend,
+		"configMapBackend":        t.configMapBackend,
+		"secretBackend":           t.secretBackend,
+		"podBackend":              t.podBackend,
+		"configMapBackendMissing": t.configMapBackendMissing,
+		"secretBackendMissing":    t.secretBackendMissing,
+	} {
+		links := make(map[string][]string, len(tracking))
+		for key, values := range tracking {
+			list := make([]string, 0, len(values))
+			for backend := range values {
+				list = append(list, backend.String())
+			}
+			sort.Strings(list)
+			links[key] = list
+		}
+		dump[name] = links
+	}
+	for name, tracking := range map[string]backendStringMap{
+		"backendIngress":          t.backendIngress,
+		"backendConfigMap":        t.backendConfigMap,
+		"backendSecret":           t.backendSecret,
+		"backendPod":              t.backendPod,
+		"backendConfigMapMissing": t.backendConfigMapMissing,
+		"backendSecretMissing":    t.backendSecretMissing,
+	} {
+		links := make(map[string][]string, len(tracking))
+		for backend, values := range tracking {
+			list := getStringTracking(values)
+			sort.Strings(list)
+			links[backend.String()] = list
+		}
+		dump[name] = links
+	}
+	return dump
+}
+
+func countNames(stringTracking []stringStringMap, backendTracking []stringBackendMap) int {
+	names := map[string]empty{}
+	for _, tracking := range stringTracking {
+		for name := range tracking {
+			names[name] = empty{}
+		}
+	}
+	for _, tracking := range backendTracking {
+		for name := range tracking {
+			names[name] = empty{}
+		}
+	}
+	return len(names)
+}
+
 func (t *tracker) getIngressByHostname(hostname string) []string {
 	if t.hostnameIngress == nil {
 		return nil
@@ -543,6 +726,20 @@ func (t *tracker) getHostnamesByConfigMapMissing(configMapName string) []string
 	return getStringTracking(t.configMapHostnameMissing[configMapName])
 }
 
+func (t *tracker) getBackendsByConfigMap(configMapName string) []hatypes.BackendID {
+	if t.configMapBackend == nil {
+		return nil
+	}
+	return getBackendTracking(t.configMapBackend[configMapName])
+}
+
+func (t *tracker) getBackendsByConfigMapMissing(configMapName string) []hatypes.BackendID {
+	if t.configMapBackendMissing == nil {
+		return nil
+	}
+	return getBackendTracking(t.configMapBackendMissing[configMapName])
+}
+
 func (t *tracker) getHostnamesByService(serviceName string) []string {
 	if t.serviceHostname == nil {
 		return nil
@@ -316,6 +316,24 @@ func TestGetDirtyLinks(t *testing.T) {
 			addConfigMapList: []string{"ingress/config"},
 			expDirtyHosts:    []string{"app1.local"},
 		},
+		// 23
+		{
+			trackedBacks: []backTracking{
+				{convtypes.ConfigMapType, "default/ca1", back1a},
+				{convtypes.ConfigMapType, "default/ca2", back2a},
+			},
+			oldConfigMapList: []string{"default/ca1"},
+			expDirtyBacks:    []hatypes.BackendID{back1b},
+		},
+		// 24
+		{
+			trackedMissingBacks: []backTracking{
+				{convtypes.ConfigMapType, "default/ca1", back1a},
+				{convtypes.ConfigMapType, "default/ca2", back2a},
+			},
+			addConfigMapList: []string{"default/ca2"},
+			expDirtyBacks:    []hatypes.BackendID{back2b},
+		},
 	}
 	for i, test := range testCases {
 		c := setup(t)
@@ -588,6 +606,11 @@ func TestDeleteBackends(t *testing.T) {
 		//
 		expSecretBackendMissing stringBackendMap
 		expBackendSecretMissing backendStringMap
+		//
+		expConfigMapBackend        stringBackendMap
+		expBackendConfigMap        backendStringMap
+		expConfigMapBackendMissing stringBackendMap
+		expBackendConfigMapMissing backendStringMap
 	}{
 		// 0
 		{},
@@ -639,6 +662,22 @@ func TestDeleteBackends(t *testing.T) {
 			expSecretBackendMissing: stringBackendMap{"default/secret2": {back2b: empty{}}},
 			expBackendSecretMissing: backendStringMap{back2b: {"default/secret2": empty{}}},
 		},
+		// 6
+		{
+			trackedBacks: []backTracking{
+				{convtypes.ConfigMapType, "default/ca1", back1a},
+				{convtypes.ConfigMapType, "default/ca2", back2a},
+			},
+			trackedMissingBacks: []backTracking{
+				{convtypes.ConfigMapType, "default/ca3", back1a},
+				{convtypes.ConfigMapType, "default/ca3", back2a},
+			},
+			deleteBackends:             []hatypes.BackendID{back1b},
+			expConfigMapBackend:        stringBackendMap{"default/ca2": {back2b: empty{}}},
+			expBackendConfigMap:        backendStringMap{back2b: {"default/ca2": empty{}}},
+			expConfigMapBackendMissing: stringBackendMap{"default/ca3": {back2b: empty{}}},
+			expBackendConfigMapMissing: backendStringMap{back2b: {"default/ca3": empty{}}},
+		},
 	}
 	for i, test := range testCases {
 		c := setup(t)
@@ -655,10 +694,109 @@ func TestDeleteBackends(t *testing.T) {
 		c.compareObjects("backendSecret", i, c.tracker.backendSecret, test.expBackendSecret)
 		c.compareObjects("secretBackendMissing", i, c.tracker.secretBackendMissing, test.expSecretBackendMissing)
 		c.compareObjects("backendSecretMissing", i, c.tracker.backendSecretMissing, test.expBackendSecretMissing)
+		c.compareObjects("configMapBackend", i, c.tracker.configMapBackend, test.expConfigMapBackend)
+		c.compareObjects("backendConfigMap", i, c.tracker.backendConfigMap, test.expBackendConfigMap)
+		c.compareObjects("configMapBackendMissing", i, c.tracker.configMapBackendMissing, test.expConfigMapBackendMissing)
+		c.compareObjects("backendConfigMapMissing", i, c.tracker.backendConfigMapMissing, test.expBackendConfigMapMissing)
+		c.teardown()
+	}
+}
+
+func TestGetIngressesByBackend(t *testing.T) {
+	testCases := []struct {
+		trackedBacks []backTracking
+		backend      hatypes.BackendID
+		expected     []string
+	}{
+		// 0
+		{
+			backend: back1b,
+		},
+		// 1
+		{
+			trackedBacks: []backTracking{
+				{convtypes.IngressType, "default/ing2", back1a},
+				{convtypes.IngressType, "default/ing1", back1a},
+				{convtypes.IngressType, "default/ing3", back2a},
+				{convtypes.SecretType, "default/secret1", back1a},
+			},
+			backend:  back1b,
+			expected: []string{"default/ing1", "default/ing2"},
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		for _, trackedBack := range test.trackedBacks {
+			c.tracker.TrackBackend(trackedBack.rtype, trackedBack.name, trackedBack.backend)
+		}
+		c.compareObjects("ingresses", i, c.tracker.GetIngressesByBackend(test.backend), test.expected)
 		c.teardown()
 	}
 }
 
+func TestGetTrackedCount(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+	c.tracker.TrackHostname(convtypes.IngressType, "default/ing1", "domain1.local")
+	c.tracker.TrackBackend(convtypes.IngressType, "default/ing1", back1a)
+	c.tracker.TrackBackend(convtypes.IngressType, "default/ing2", back2a)
+	c.tracker.TrackHostname(convtypes.SecretType, "default/secret1", "domain1.local")
+	c.tracker.TrackMissingOnHostname(convtypes.SecretType, "default/secret2", "domain1.local")
+	c.tracker.TrackBackend(convtypes.PodType, "default/pod1", back1a)
+	expected := map[convtypes.ResourceType]int{
+		convtypes.IngressType:      2,
+		convtypes.IngressClassType: 0,
+		convtypes.ConfigMapType:    0,
+		convtypes.ServiceType:      0,
+		convtypes.SecretType:       2,
+		convtypes.PodType:          1,
+	}
+	c.compareObjects("tracked count", 0, c.tracker.GetTrackedCount(), expected)
+}
+
+func TestIsTracked(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+	c.tracker.TrackHostname(convtypes.SecretType, "default/secret1", "domain1.local")
+	c.tracker.TrackMissingOnHostname(convtypes.SecretType, "default/secret2", "domain1.local")
+	c.tracker.TrackBackend(convtypes.SecretType, "default/secret3", back1a)
+	c.tracker.TrackHostname(convtypes.ConfigMapType, "default/cm1", "domain1.local")
+	testCases := []struct {
+		rtype   convtypes.ResourceType
+		name    string
+		tracked bool
+	}{
+		// 0
+		{rtype: convtypes.SecretType, name: "default/secret1", tracked: true},
+		// 1
+		{rtype: convtypes.SecretType, name: "default/secret2", tracked: true},
+		// 2
+		{rtype: convtypes.SecretType, name: "default/secret3", tracked: true},
+		// 3
+		{rtype: convtypes.SecretType, name: "default/secret4", tracked: false},
+		// 4
+		{rtype: convtypes.ConfigMapType, name: "default/cm1", tracked: true},
+		// 5
+		{rtype: convtypes.ConfigMapType, name: "default/secret1", tracked: false},
+	}
+	for i, test := range testCases {
+		c.compareObjects("is tracked", i, c.tracker.IsTracked(test.rtype, test.name), test.tracked)
+	}
+}
+
+func TestDump(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+	c.tracker.TrackHostname(convtypes.IngressType, "default/ing1", "domain1.local")
+	c.tracker.TrackBackend(convtypes.IngressType, "default/ing1", back1a)
+	c.tracker.TrackBackend(convtypes.IngressType, "default/ing1", back2a)
+	dump := c.tracker.Dump()
+	c.compareObjects("ingressHostname", 0, dump["ingressHostname"], map[string][]string{"default/ing1": {"domain1.local"}})
+	c.compareObjects("ingressBackend", 0, dump["ingressBackend"], map[string][]string{"default/ing1": {"default_svc1_8080", "default_svc2_8080"}})
+	c.compareObjects("backendIngress", 0, dump["backendIngress"], map[string][]string{"default_svc1_8080": {"default/ing1"}, "default_svc2_8080": {"default/ing1"}})
+	c.compareObjects("secretHostname", 0, dump["secretHostname"], map[string][]string{})
+}
+
 func TestDeleteUserlists(t *testing.T) {
 	testCases := []struct {
 		trackedUsers []userTracking
@@ -18,12 +18,19 @@ package types
 
 // Host Annotations
 const (
+	HostAcmeKeyType            = "acme-key-type"
+	HostAcmePreferredChain     = "acme-preferred-chain"
 	HostAppRoot                = "app-root"
 	HostAuthTLSErrorPage       = "auth-tls-error-page"
 	HostAuthTLSSecret          = "auth-tls-secret"
 	HostAuthTLSStrict          = "auth-tls-strict"
 	HostAuthTLSVerifyClient    = "auth-tls-verify-client"
+	HostBotMitigation          = "bot-mitigation"
 	HostCertSigner             = "cert-signer"
+	HostDefaultBackend         = "default-backend"
+	HostDrainPeriod            = "host-drain-period"
+	HostDrainResponse          = "host-drain-response"
+	HostInternal               = "internal"
 	HostPathType               = "path-type"
 	HostServerAlias            = "server-alias"
 	HostServerAliasRegex       = "server-alias-regex"
@@ -35,19 +42,30 @@ const (
 	HostSSLOptionsHost         = "ssl-options-host"
 	HostSSLPassthrough         = "ssl-passthrough"
 	HostSSLPassthroughHTTPPort = "ssl-passthrough-http-port"
+	HostSSLProfile             = "ssl-profile"
+	HostTenant                 = "tenant"
 	HostTLSALPN                = "tls-alpn"
 	HostVarNamespace           = "var-namespace"
+	HostVaultPKIMount          = "vault-pki-mount"
+	HostVaultPKIRole           = "vault-pki-role"
 )
 
 var (
 	// AnnHost ...
 	AnnHost = map[string]struct{}{
+		HostAcmeKeyType:            {},
+		HostAcmePreferredChain:     {},
 		HostAppRoot:                {},
 		HostAuthTLSErrorPage:       {},
 		HostAuthTLSSecret:          {},
 		HostAuthTLSStrict:          {},
 		HostAuthTLSVerifyClient:    {},
+		HostBotMitigation:          {},
 		HostCertSigner:             {},
+		HostDefaultBackend:         {},
+		HostDrainPeriod:            {},
+		HostDrainResponse:          {},
+		HostInternal:               {},
 		HostServerAlias:            {},
 		HostPathType:               {},
 		HostServerAliasRegex:       {},
@@ -59,13 +77,19 @@ var (
 		HostSSLOptionsHost:         {},
 		HostSSLPassthrough:         {},
 		HostSSLPassthroughHTTPPort: {},
+		HostSSLProfile:             {},
+		HostTenant:                 {},
 		HostTLSALPN:                {},
 		HostVarNamespace:           {},
+		HostVaultPKIMount:          {},
+		HostVaultPKIRole:           {},
 	}
 )
 
 // Backend Annotations
 const (
+	BackAccessLog              = "access-log"
+	BackAccessLogSampleRatio   = "access-log-sample-ratio"
 	BackAffinity               = "affinity"
 	BackAgentCheckAddr         = "agent-check-addr"
 	BackAgentCheckInterval     = "agent-check-interval"
@@ -73,15 +97,19 @@ const (
 	BackAgentCheckSend         = "agent-check-send"
 	BackAllowlistSourceRange   = "allowlist-source-range"
 	BackAuthHeaders            = "auth-headers"
+	BackAuthPassthrough        = "auth-passthrough"
 	BackAuthRealm              = "auth-realm"
 	BackAuthSecret             = "auth-secret"
 	BackAuthSignin             = "auth-signin"
 	BackAuthTLSCertHeader      = "auth-tls-cert-header"
 	BackAuthURL                = "auth-url"
 	BackBackendCheckInterval   = "backend-check-interval"
+	BackBackendIPFamily        = "backend-ip-family"
 	BackBackendProtocol        = "backend-protocol"
 	BackBackendServerNaming    = "backend-server-naming"
 	BackBackendServerSlotsInc  = "backend-server-slots-increment"
+	BackBackendSourceAddress   = "backend-source-address"
+	BackBackendSourceInterface = "backend-source-interface"
 	BackBalanceAlgorithm       = "balance-algorithm"
 	BackBlueGreenBalance       = "blue-green-balance"
 	BackBlueGreenCookie        = "blue-green-cookie"
@@ -89,6 +117,12 @@ const (
 	BackBlueGreenHeader        = "blue-green-header"
 	BackBlueGreenMode          = "blue-green-mode"
 	BackConfigBackend          = "config-backend"
+	BackCacheEnable            = "cache-enable"
+	BackCacheMaxAge            = "cache-max-age"
+	BackCacheMaxObjectSize     = "cache-max-object-size"
+	BackCacheTotalSize         = "cache-total-size"
+	BackConsulService          = "consul-service"
+	BackContentSecurityPolicy  = "content-security-policy"
 	BackCorsAllowCredentials   = "cors-allow-credentials"
 	BackCorsAllowHeaders       = "cors-allow-headers"
 	BackCorsAllowMethods       = "cors-allow-methods"
@@ -98,10 +132,17 @@ const (
 	BackCorsMaxAge             = "cors-max-age"
 	BackDenylistSourceRange    = "denylist-source-range"
 	BackDynamicScaling         = "dynamic-scaling"
+	BackFallbackService        = "fallback-service"
 	BackHeaders                = "headers"
 	BackHealthCheckAddr        = "health-check-addr"
+	BackHealthCheckErrorLimit  = "health-check-error-limit"
+	BackHealthCheckExpStatus   = "health-check-expect-status"
+	BackHealthCheckExpString   = "health-check-expect-string"
 	BackHealthCheckFallCount   = "health-check-fall-count"
 	BackHealthCheckInterval    = "health-check-interval"
+	BackHealthCheckMethod      = "health-check-method"
+	BackHealthCheckObserve     = "health-check-observe"
+	BackHealthCheckOnError     = "health-check-on-error"
 	BackHealthCheckPort        = "health-check-port"
 	BackHealthCheckRiseCount   = "health-check-rise-count"
 	BackHealthCheckURI         = "health-check-uri"
@@ -111,36 +152,57 @@ const (
 	BackHSTSPreload            = "hsts-preload"
 	BackInitialWeight          = "initial-weight"
 	BackLimitConnections       = "limit-connections"
+	BackLimitConnectionsAction = "limit-connections-action"
+	BackLimitKey               = "limit-key"
 	BackLimitRPS               = "limit-rps"
+	BackLimitTableExpire       = "limit-table-expire"
+	BackLimitTableSize         = "limit-table-size"
 	BackLimitWhitelist         = "limit-whitelist"
 	BackMaxconnServer          = "maxconn-server"
 	BackMaxQueueServer         = "maxqueue-server"
+	BackMinconnServer          = "minconn-server"
 	BackOAuth                  = "oauth"
 	BackOAuthHeaders           = "oauth-headers"
 	BackOAuthURIPrefix         = "oauth-uri-prefix"
+	BackPathConfig             = "path-config"
 	BackProxyBodySize          = "proxy-body-size"
+	BackProxyHeaderSize        = "proxy-header-size"
 	BackProxyProtocol          = "proxy-protocol"
+	BackProxyRequestBuffering  = "proxy-request-buffering"
+	BackRedispatch             = "redispatch"
+	BackReferrerPolicy         = "referrer-policy"
+	BackRetries                = "retries"
+	BackRetryOn                = "retry-on"
 	BackRewriteTarget          = "rewrite-target"
+	BackRewriteTargetResponse  = "rewrite-target-response"
 	BackSlotsMinFree           = "slots-min-free"
 	BackSecureBackends         = "secure-backends"
 	BackSecureCrtSecret        = "secure-crt-secret"
 	BackSecureSNI              = "secure-sni"
+	BackSecureVerify           = "secure-verify"
 	BackSecureVerifyCASecret   = "secure-verify-ca-secret"
 	BackSecureVerifyHostname   = "secure-verify-hostname"
 	BackServiceUpstream        = "service-upstream"
+	BackSessionCookieDomain    = "session-cookie-domain"
 	BackSessionCookieDynamic   = "session-cookie-dynamic"
+	BackSessionCookieDynKey    = "session-cookie-dynamic-key"
+	BackSessionCookieHTTPOnly  = "session-cookie-httponly"
 	BackSessionCookieKeywords  = "session-cookie-keywords"
+	BackSessionCookieMaxAge    = "session-cookie-max-age"
 	BackSessionCookieName      = "session-cookie-name"
 	BackSessionCookiePreserve  = "session-cookie-preserve"
 	BackSessionCookieSameSite  = "session-cookie-same-site"
+	BackSessionCookieSecure    = "session-cookie-secure"
 	BackSessionCookieShared    = "session-cookie-shared"
 	BackSessionCookieStrategy  = "session-cookie-strategy"
 	BackSessionCookieValue     = "session-cookie-value-strategy"
+	BackSPOEAgents             = "spoe-agents"
 	BackSSLCipherSuitesBackend = "ssl-cipher-suites-backend"
 	BackSSLCiphersBackend      = "ssl-ciphers-backend"
 	BackSSLFingerprintLower    = "ssl-fingerprint-lower"
 	BackSSLOptionsBackend      = "ssl-options-backend"
 	BackSSLRedirect            = "ssl-redirect"
+	BackSSLRedirectExceptions  = "ssl-redirect-exceptions"
 	BackTimeoutConnect         = "timeout-connect"
 	BackTimeoutHTTPRequest     = "timeout-http-request"
 	BackTimeoutKeepAlive       = "timeout-keep-alive"
@@ -148,10 +210,16 @@ const (
 	BackTimeoutServer          = "timeout-server"
 	BackTimeoutServerFin       = "timeout-server-fin"
 	BackTimeoutTunnel          = "timeout-tunnel"
+	BackTracingEnable          = "tracing-enable"
+	BackTracingHeaderFormat    = "tracing-header-format"
+	BackTracingMode            = "tracing-mode"
+	BackTrafficPolicy          = "traffic-policy"
 	BackUseResolver            = "use-resolver"
 	BackWAF                    = "waf"
 	BackWAFMode                = "waf-mode"
+	BackWebSocket              = "websocket"
 	BackWhitelistSourceRange   = "whitelist-source-range"
+	BackXFrameOptions          = "x-frame-options"
 )
 
 // Extra Annotations
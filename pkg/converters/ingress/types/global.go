@@ -25,20 +25,29 @@ const (
 	GlobalAcmeTermsAgreed              = "acme-terms-agreed"
 	GlobalAuthLogFormat                = "auth-log-format"
 	GlobalAuthProxy                    = "auth-proxy"
+	GlobalBackendSourceAllowlist       = "backend-source-allowlist"
 	GlobalBindFrontingProxy            = "bind-fronting-proxy"
 	GlobalBindHTTP                     = "bind-http"
+	GlobalBindHTTPExtra                = "bind-http-extra"
 	GlobalBindHTTPS                    = "bind-https"
+	GlobalBindHTTPSExtra               = "bind-https-extra"
 	GlobalBindIPAddrHealthz            = "bind-ip-addr-healthz"
 	GlobalBindIPAddrHTTP               = "bind-ip-addr-http"
 	GlobalBindIPAddrPrometheus         = "bind-ip-addr-prometheus"
 	GlobalBindIPAddrStats              = "bind-ip-addr-stats"
 	GlobalBindIPAddrTCP                = "bind-ip-addr-tcp"
+	GlobalBindIPFamily                 = "bind-ip-family"
+	GlobalBotMitigationConfigMap       = "bot-mitigation-configmap"
+	GlobalConfigBackendAllowedNS       = "config-backend-allowed-namespaces"
+	GlobalConfigBackendForbidden       = "config-backend-forbidden-keywords"
 	GlobalConfigDefaults               = "config-defaults"
 	GlobalConfigFrontend               = "config-frontend"
 	GlobalConfigGlobal                 = "config-global"
 	GlobalConfigProxy                  = "config-proxy"
 	GlobalConfigSections               = "config-sections"
+	GlobalConfigSnippets               = "config-snippets"
 	GlobalConfigTCP                    = "config-tcp"
+	GlobalConsulAddress                = "consul-address"
 	GlobalCookieKey                    = "cookie-key"
 	GlobalCPUMap                       = "cpu-map"
 	GlobalDefaultBackendRedirect       = "default-backend-redirect"
@@ -51,12 +60,25 @@ const (
 	GlobalDNSTimeoutRetry              = "dns-timeout-retry"
 	GlobalDrainSupport                 = "drain-support"
 	GlobalDrainSupportRedispatch       = "drain-support-redispatch"
+	GlobalErrorPages                   = "error-pages"
 	GlobalExternalHasLua               = "external-has-lua"
 	GlobalForwardfor                   = "forwardfor"
 	GlobalFrontingProxyPort            = "fronting-proxy-port"
 	GlobalGroupname                    = "groupname"
+	GlobalH2HeaderTableSize            = "h2-header-table-size"
+	GlobalHardeningConnRate            = "hardening-conn-rate"
+	GlobalHardeningHTTPErrRate         = "hardening-http-err-rate"
+	GlobalHardeningHTTPReqRate         = "hardening-http-req-rate"
+	GlobalHardeningMaxConnHeadroom     = "hardening-maxconn-headroom"
+	GlobalHardeningProfile             = "hardening-profile"
+	GlobalHardeningTableSize           = "hardening-table-size"
 	GlobalHealthzPort                  = "healthz-port"
+	GlobalHostConflictPolicy           = "host-conflict-policy"
+	GlobalHostConflictPriority         = "host-conflict-priority"
+	GlobalHTTPBufferSize               = "http-buffer-size"
 	GlobalHTTPLogFormat                = "http-log-format"
+	GlobalHTTPLogJSONFields            = "http-log-json-fields"
+	GlobalHTTPMaxHeaders               = "http-max-headers"
 	GlobalHTTPPort                     = "http-port"
 	GlobalHTTPSLogFormat               = "https-log-format"
 	GlobalHTTPSPort                    = "https-port"
@@ -70,6 +92,8 @@ const (
 	GlobalModsecurityTimeoutIdle       = "modsecurity-timeout-idle"
 	GlobalModsecurityTimeoutProcessing = "modsecurity-timeout-processing"
 	GlobalModsecurityTimeoutServer     = "modsecurity-timeout-server"
+	GlobalNamespaceConfigKeys          = "namespace-config-keys"
+	GlobalNamespaceQuotas              = "namespace-quotas"
 	GlobalNbprocBalance                = "nbproc-balance"
 	GlobalNbprocSSL                    = "nbproc-ssl"
 	GlobalNbthread                     = "nbthread"
@@ -77,12 +101,17 @@ const (
 	GlobalPathTypeOrder                = "path-type-order"
 	GlobalUsername                     = "username"
 	GlobalPrometheusPort               = "prometheus-port"
+	GlobalRealIPHeader                 = "real-ip-header"
+	GlobalRealIPTrustedCIDR            = "real-ip-trusted-cidr"
+	GlobalServicePortGracePeriod       = "service-port-grace-period"
+	GlobalSPOEAgentsConfigMap          = "spoe-agents-configmap"
 	GlobalSSLDHDefaultMaxSize          = "ssl-dh-default-max-size"
 	GlobalSSLDHParam                   = "ssl-dh-param"
 	GlobalSSLEngine                    = "ssl-engine"
 	GlobalSSLHeadersPrefix             = "ssl-headers-prefix"
 	GlobalSSLModeAsync                 = "ssl-mode-async"
 	GlobalSSLOptions                   = "ssl-options"
+	GlobalSSLProfiles                  = "ssl-profiles"
 	GlobalSSLRedirectCode              = "ssl-redirect-code"
 	GlobalStatsAuth                    = "stats-auth"
 	GlobalStatsPort                    = "stats-port"
@@ -97,11 +126,15 @@ const (
 	GlobalTimeoutClient                = "timeout-client"
 	GlobalTimeoutClientFin             = "timeout-client-fin"
 	GlobalTimeoutStop                  = "timeout-stop"
+	GlobalTracingOTConfigFile          = "tracing-opentracing-config"
+	GlobalTracingOTID                  = "tracing-opentracing-id"
 	GlobalUseChroot                    = "use-chroot"
 	GlobalUseCPUMap                    = "use-cpu-map"
 	GlobalUseForwardedProto            = "use-forwarded-proto"
 	GlobalUseHAProxyUser               = "use-haproxy-user"
 	GlobalUseHTX                       = "use-htx"
 	GlobalUseProxyProtocol             = "use-proxy-protocol"
+	GlobalUseProxyProtocolHTTP         = "use-proxy-protocol-http"
+	GlobalUseProxyProtocolHTTPS        = "use-proxy-protocol-https"
 	GlobalWorkerMaxReloads             = "worker-max-reloads"
 )
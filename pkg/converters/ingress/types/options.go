@@ -17,7 +17,10 @@ limitations under the License.
 package types
 
 import (
+	"time"
+
 	convtypes "github.com/jcmoraisjr/haproxy-ingress/pkg/converters/types"
+	hatypes "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/types"
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/types"
 )
 
@@ -26,12 +29,74 @@ type ConverterOptions struct {
 	Logger           types.Logger
 	Cache            convtypes.Cache
 	Tracker          convtypes.Tracker
+	Metrics          types.Metrics
 	MasterSocket     string
+	RemoteHAProxy    bool
+	Capabilities     *hatypes.Capabilities
+	SyslogListener   string
 	DefaultConfig    func() map[string]string
 	DefaultBackend   string
+	DefaultPages     string
 	DefaultCrtSecret string
 	FakeCrtFile      convtypes.CrtFile
 	FakeCAFile       convtypes.CrtFile
-	AnnotationPrefix string
+	AnnotationPrefix []string
 	AcmeTrackTLSAnn  bool
+	NamespaceConfig  string
+	TranslateNginx   bool
+	ServicePorts     map[string]*ServicePort
+	QuotaRejected    map[string]string
+	DrainingHosts    map[string]*DrainingHost
+	Conditions       map[string]*IngressConditions
+}
+
+// ServicePort is the port number that a service port reference of an ingress
+// resource was last resolved to. Missing is the first time the reference
+// couldn't be found in the service, or zero if it is being resolved.
+type ServicePort struct {
+	Port    int32
+	Missing time.Time
+}
+
+// DrainingHost is a hostname whose ingress resources were removed, and
+// that should be answered with a redirect to Location, or 410 Gone if
+// Location is empty, until Expire.
+type DrainingHost struct {
+	Expire   time.Time
+	Location string
+}
+
+// IngressConditions is the outcome of the last parse of an ingress resource.
+// Rejected is the reason the whole resource was skipped, or empty if it was
+// accepted. SkippedHosts and CertErrors have, per hostname, the reason a
+// host was skipped or is using the default certificate.
+type IngressConditions struct {
+	Rejected     string
+	SkippedHosts map[string]string
+	HasTLS       bool
+	CertErrors   map[string]string
+}
+
+// SkipHost adds a hostname which was skipped. A nil IngressConditions
+// is a no-op, used when the source isn't an ingress resource.
+func (c *IngressConditions) SkipHost(hostname, reason string) {
+	if c == nil {
+		return
+	}
+	if c.SkippedHosts == nil {
+		c.SkippedHosts = map[string]string{}
+	}
+	c.SkippedHosts[hostname] = reason
+}
+
+// AddCertError adds a hostname whose certificate couldn't be resolved.
+// A nil IngressConditions is a no-op.
+func (c *IngressConditions) AddCertError(hostname, reason string) {
+	if c == nil {
+		return
+	}
+	if c.CertErrors == nil {
+		c.CertErrors = map[string]string{}
+	}
+	c.CertErrors[hostname] = reason
 }
@@ -17,6 +17,7 @@ limitations under the License.
 package types
 
 import (
+	"fmt"
 	"time"
 
 	api "k8s.io/api/core/v1"
@@ -32,22 +33,32 @@ type Cache interface {
 	GetIngressClass(className string) (*networking.IngressClass, error)
 	GetService(serviceName string) (*api.Service, error)
 	GetEndpoints(service *api.Service) (*api.Endpoints, error)
+	GetConsulEndpoints(address, consulService string, service *api.Service) ([]ExternalEndpoint, error)
 	GetConfigMap(configMapName string) (*api.ConfigMap, error)
 	GetTerminatingPods(service *api.Service, track TrackingTarget) ([]*api.Pod, error)
 	GetPod(podName string) (*api.Pod, error)
+	GetNode(nodeName string) (*api.Node, error)
+	GetNodeList() ([]*api.Node, error)
 	GetPodNamespace() string
+	GetControllerNodeName() (string, error)
 	GetTLSSecretPath(defaultNamespace, secretName string, track TrackingTarget) (CrtFile, error)
+	GetTLSSecretPool() ([]CrtFile, error)
+	GetVaultCertPath(mount, role, hostname string, track TrackingTarget) (CrtFile, error)
 	GetCASecretPath(defaultNamespace, secretName string, track TrackingTarget) (ca, crl File, err error)
 	GetDHSecretPath(defaultNamespace, secretName string) (File, error)
 	GetSecretContent(defaultNamespace, secretName, keyName string, track TrackingTarget) ([]byte, error)
 	SwapChangedObjects() *ChangedObjects
 	NeedFullSync() bool
+	ScheduleSync(at time.Time)
 }
 
 // ChangedObjects ...
 type ChangedObjects struct {
 	//
 	GlobalCur, GlobalNew map[string]string
+	// GlobalChangedKeys has the sorted list of global config keys that were
+	// added, removed or updated from GlobalCur to GlobalNew
+	GlobalChangedKeys []string
 	//
 	TCPConfigMapCur, TCPConfigMapNew map[string]string
 	//
@@ -61,6 +72,8 @@ type ChangedObjects struct {
 	//
 	SecretsDel, SecretsUpd, SecretsAdd []*api.Secret
 	//
+	ExternalSecretsUpd []string
+	//
 	ConfigMapsDel, ConfigMapsUpd, ConfigMapsAdd []*api.ConfigMap
 	//
 	Pods []*api.Pod
@@ -80,6 +93,10 @@ type Tracker interface {
 	DeleteBackends(backends []hatypes.BackendID)
 	DeleteUserlists(userlists []string)
 	DeleteStorages(storages []string)
+	GetIngressesByBackend(backendID hatypes.BackendID) []string
+	GetTrackedCount() map[ResourceType]int
+	IsTracked(rtype ResourceType, name string) bool
+	Dump() map[string]map[string][]string
 }
 
 // TrackingTarget ...
@@ -89,6 +106,13 @@ type TrackingTarget struct {
 	Userlist string
 }
 
+// ExternalEndpoint is an endpoint of a service discovered outside of the cluster.
+type ExternalEndpoint struct {
+	IP   string
+	Port int
+	ID   string
+}
+
 // File ...
 type File struct {
 	Filename string
@@ -100,6 +124,7 @@ type CrtFile struct {
 	Filename   string
 	SHA1Hash   string
 	CommonName string
+	DNSNames   []string
 	NotAfter   time.Time
 }
 
@@ -125,3 +150,22 @@ const (
 	// PodType ...
 	PodType
 )
+
+// String ...
+func (rtype ResourceType) String() string {
+	switch rtype {
+	case IngressType:
+		return "ingress"
+	case IngressClassType:
+		return "ingressclass"
+	case ConfigMapType:
+		return "configmap"
+	case ServiceType:
+		return "service"
+	case SecretType:
+		return "secret"
+	case PodType:
+		return "pod"
+	}
+	return fmt.Sprintf("unknown(%d)", int(rtype))
+}
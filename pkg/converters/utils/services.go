@@ -71,6 +71,7 @@ type Endpoint struct {
 	IP        string
 	Port      int
 	TargetRef string
+	NodeName  string
 }
 
 // CreateEndpoints ...
@@ -115,6 +116,30 @@ func CreateSvcEndpoint(svc *api.Service, svcPort *api.ServicePort) (endpoint *En
 	return newEndpointIP(svc.Spec.ClusterIP, int(port)), nil
 }
 
+// IPFamily returns `ipv4` or `ipv6` depending on the family of ip, or an
+// empty string if ip isn't a valid IP address.
+func IPFamily(ip string) string {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return ""
+	}
+	if addr.To4() != nil {
+		return "ipv4"
+	}
+	return "ipv6"
+}
+
+// SelectIPFamily returns the first IP address of ips whose family is family,
+// or an empty string if there isn't such address.
+func SelectIPFamily(ips []string, family string) string {
+	for _, ip := range ips {
+		if family != "" && IPFamily(ip) == family {
+			return ip
+		}
+	}
+	return ""
+}
+
 var lookup = net.LookupIP
 
 func createEndpointsExternalName(svc *api.Service, svcPort *api.ServicePort) (endpoints []*Endpoint, err error) {
@@ -135,10 +160,15 @@ func createEndpointsExternalName(svc *api.Service, svcPort *api.ServicePort) (en
 }
 
 func newEndpointAddr(addr *api.EndpointAddress, port int) *Endpoint {
+	var nodeName string
+	if addr.NodeName != nil {
+		nodeName = *addr.NodeName
+	}
 	return &Endpoint{
 		IP:        addr.IP,
 		Port:      port,
 		TargetRef: targetRefToString(addr.TargetRef),
+		NodeName:  nodeName,
 	}
 }
 
@@ -138,3 +138,48 @@ func setup(t *testing.T) *config {
 }
 
 func (c *config) teardown() {}
+
+func TestSelectIPFamily(t *testing.T) {
+	testCases := []struct {
+		ips      []string
+		family   string
+		expected string
+	}{
+		// 0
+		{
+			ips:      []string{"10.0.0.1", "fd00::1"},
+			family:   "",
+			expected: "",
+		},
+		// 1
+		{
+			ips:      []string{"10.0.0.1", "fd00::1"},
+			family:   "ipv4",
+			expected: "10.0.0.1",
+		},
+		// 2
+		{
+			ips:      []string{"10.0.0.1", "fd00::1", "fd00::2"},
+			family:   "ipv6",
+			expected: "fd00::1",
+		},
+		// 3
+		{
+			ips:      []string{"10.0.0.1", "10.0.0.2"},
+			family:   "ipv6",
+			expected: "",
+		},
+		// 4
+		{
+			ips:      []string{"invalid", "::ffff:10.0.0.1"},
+			family:   "ipv4",
+			expected: "::ffff:10.0.0.1",
+		},
+	}
+	for i, test := range testCases {
+		ip := SelectIPFamily(test.ips, test.family)
+		if ip != test.expected {
+			t.Errorf("IP differs on %d, expected '%s' but was '%s'", i, test.expected, ip)
+		}
+	}
+}
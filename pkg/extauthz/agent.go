@@ -0,0 +1,335 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extauthz
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/types"
+)
+
+// MessageName is the name of the SPOE message that the agent translates
+// to an ext_authz CheckRequest. Other messages are acknowledged without
+// any action.
+const MessageName = "check-request"
+
+// Options ...
+type Options struct {
+	// Address is the ip:port the SPOE agent listens to
+	Address string
+	// Target is the gRPC address of the ext_authz compatible authorization service
+	Target  string
+	Timeout time.Duration
+	// CA is the CA bundle file used to verify the certificate of the
+	// authorization service. The connection uses TLS if CA or TLSCert is
+	// declared, system CAs are used if CA is missing.
+	CA string
+	// TLSCert and TLSKey are the client certificate and private key files
+	// sent to the authorization service
+	TLSCert string
+	TLSKey  string
+}
+
+// Agent ...
+type Agent interface {
+	Listen(stopCh chan struct{}) error
+}
+
+// NewAgent ...
+func NewAgent(logger types.Logger, options Options) Agent {
+	if options.Timeout <= 0 {
+		options.Timeout = time.Second
+	}
+	return &agent{
+		logger:  logger,
+		options: options,
+	}
+}
+
+type agent struct {
+	logger  types.Logger
+	options Options
+	client  authv3.AuthorizationClient
+}
+
+func (a *agent) Listen(stopCh chan struct{}) error {
+	creds, err := a.transportCredentials()
+	if err != nil {
+		return err
+	}
+	conn, err := grpc.Dial(a.options.Target, creds)
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", a.options.Address)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	a.client = authv3.NewAuthorizationClient(conn)
+	a.logger.Info("ext-authz: listening on %s, authorization service is %s", a.options.Address, a.options.Target)
+	go a.serve(listener)
+	go func() {
+		<-stopCh
+		a.logger.Info("ext-authz: closing listener")
+		if err := listener.Close(); err != nil {
+			a.logger.Error("ext-authz: error closing listener: %v", err)
+		}
+		conn.Close()
+	}()
+	return nil
+}
+
+func (a *agent) transportCredentials() (grpc.DialOption, error) {
+	if a.options.CA == "" && a.options.TLSCert == "" {
+		return grpc.WithInsecure(), nil
+	}
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if a.options.CA != "" {
+		ca, err := ioutil.ReadFile(a.options.CA)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no valid certificate found in %s", a.options.CA)
+		}
+	}
+	if a.options.TLSCert != "" {
+		crt, err := tls.LoadX509KeyPair(a.options.TLSCert, a.options.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{crt}
+	}
+	return grpc.WithTransportCredentials(credentials.NewTLS(config)), nil
+}
+
+func (a *agent) serve(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if !strings.Contains(err.Error(), "use of closed network connection") {
+				a.logger.Error("ext-authz: error accepting connection: %v", err)
+			}
+			return
+		}
+		go func() {
+			defer conn.Close()
+			if err := a.handle(conn); err != nil {
+				a.logger.Warn("ext-authz: closing connection from %s: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// handle processes the frames of a SPOE connection: the hello handshake,
+// the notify frames of the SPOE messages, and the disconnection.
+func (a *agent) handle(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+	f, err := readFrame(r, spoeMaxFrameSize)
+	if err != nil {
+		return err
+	}
+	if f.ftype != frameHAProxyHello {
+		return fmt.Errorf("expected HAPROXY-HELLO frame, found type %d", f.ftype)
+	}
+	hello, err := decodeKVList(f.payload)
+	if err != nil {
+		return err
+	}
+	versions, _ := hello["supported-versions"].(string)
+	if !supportsVersion(versions) {
+		return fmt.Errorf("unsupported SPOP versions: %s", versions)
+	}
+	maxFrameSize := uint32(spoeMaxFrameSize)
+	if size, ok := hello["max-frame-size"].(uint64); ok && size < uint64(maxFrameSize) {
+		maxFrameSize = uint32(size)
+	}
+	err = writeFrame(conn, &frame{
+		ftype: frameAgentHello,
+		flags: frameFlagFin,
+		payload: encodeKVList([]kv{
+			{name: "version", value: spoeVersion},
+			{name: "max-frame-size", value: maxFrameSize},
+			{name: "capabilities", value: ""},
+		}),
+	})
+	if err != nil {
+		return err
+	}
+	if healthcheck, _ := hello["healthcheck"].(bool); healthcheck {
+		return nil
+	}
+	for {
+		f, err := readFrame(r, maxFrameSize)
+		if err != nil {
+			return err
+		}
+		switch f.ftype {
+		case frameNotify:
+			msgs, err := decodeMessages(f.payload)
+			if err != nil {
+				return err
+			}
+			var actions []action
+			for _, msg := range msgs {
+				if msg.name == MessageName {
+					actions = append(actions, a.check(msg)...)
+				}
+			}
+			err = writeFrame(conn, &frame{
+				ftype:    frameAck,
+				flags:    frameFlagFin,
+				streamID: f.streamID,
+				frameID:  f.frameID,
+				payload:  encodeActions(actions),
+			})
+			if err != nil {
+				return err
+			}
+		case frameHAProxyDisconnect:
+			return writeFrame(conn, &frame{
+				ftype: frameAgentDisconnect,
+				flags: frameFlagFin,
+				payload: encodeKVList([]kv{
+					{name: "status-code", value: uint32(0)},
+					{name: "message", value: "normal"},
+				}),
+			})
+		default:
+			return fmt.Errorf("unexpected frame type %d", f.ftype)
+		}
+	}
+}
+
+func supportsVersion(versions string) bool {
+	for _, v := range strings.Split(versions, ",") {
+		if strings.TrimSpace(v) == spoeVersion {
+			return true
+		}
+	}
+	return false
+}
+
+// check sends the attributes of a request to the authorization service,
+// and returns the variables that should be set in the transaction scope:
+// allowed, a boolean, and status, the HTTP status code of the response if
+// the request was denied. Errors calling the authorization service are
+// logged and no variable is set, so requests are denied by default.
+func (a *agent) check(msg *message) []action {
+	req := buildCheckRequest(msg)
+	ctx, cancel := context.WithTimeout(context.Background(), a.options.Timeout)
+	defer cancel()
+	resp, err := a.client.Check(ctx, req)
+	if err != nil {
+		a.logger.Warn("ext-authz: error checking request: %v", err)
+		return nil
+	}
+	if resp.Status != nil && codes.Code(resp.Status.Code) != codes.OK {
+		status := 403
+		if denied := resp.GetDeniedResponse(); denied != nil && denied.Status != nil && denied.Status.Code != 0 {
+			status = int(denied.Status.Code)
+		}
+		return []action{
+			{name: "allowed", value: false},
+			{name: "status", value: status},
+		}
+	}
+	return []action{{name: "allowed", value: true}}
+}
+
+// buildCheckRequest builds an ext_authz CheckRequest from the arguments of
+// a SPOE message. Supported arguments are method, path, host, scheme,
+// version, headers, a req.hdrs_bin output, src and src_port.
+func buildCheckRequest(msg *message) *authv3.CheckRequest {
+	http := &authv3.AttributeContext_HttpRequest{
+		Headers: map[string]string{},
+		Size:    -1,
+	}
+	var src net.IP
+	var srcPort uint32
+	for _, arg := range msg.args {
+		switch arg.name {
+		case "method":
+			http.Method, _ = arg.value.(string)
+		case "path":
+			http.Path, _ = arg.value.(string)
+		case "host":
+			http.Host, _ = arg.value.(string)
+		case "scheme":
+			http.Scheme, _ = arg.value.(string)
+		case "version":
+			if version, _ := arg.value.(string); version != "" {
+				http.Protocol = "HTTP/" + version
+			}
+		case "headers":
+			buf, _ := arg.value.([]byte)
+			headers, _ := decodeHeaders(buf)
+			for _, h := range headers {
+				name := strings.ToLower(h.name)
+				value := h.value.(string)
+				if current, found := http.Headers[name]; found {
+					value = current + "," + value
+				}
+				http.Headers[name] = value
+			}
+		case "src":
+			src, _ = arg.value.(net.IP)
+		case "src_port":
+			switch port := arg.value.(type) {
+			case int64:
+				srcPort = uint32(port)
+			case uint64:
+				srcPort = uint32(port)
+			}
+		}
+	}
+	if http.Host == "" {
+		http.Host = http.Headers["host"]
+	}
+	attrs := &authv3.AttributeContext{
+		Request: &authv3.AttributeContext_Request{Http: http},
+	}
+	if src != nil {
+		attrs.Source = &authv3.AttributeContext_Peer{
+			Address: &corev3.Address{
+				Address: &corev3.Address_SocketAddress{
+					SocketAddress: &corev3.SocketAddress{
+						Address:       src.String(),
+						PortSpecifier: &corev3.SocketAddress_PortValue{PortValue: srcPort},
+					},
+				},
+			},
+		}
+	}
+	return &authv3.CheckRequest{Attributes: attrs}
+}
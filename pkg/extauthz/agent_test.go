@@ -0,0 +1,390 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extauthz
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/types/helper_test"
+)
+
+func TestVarint(t *testing.T) {
+	testCases := []struct {
+		value   uint64
+		encoded []byte
+	}{
+		// 0
+		{value: 0, encoded: []byte{0}},
+		// 1
+		{value: 239, encoded: []byte{239}},
+		// 2
+		{value: 240, encoded: []byte{240, 0}},
+		// 3
+		{value: 2287, encoded: []byte{255, 127}},
+		// 4
+		{value: 2288, encoded: []byte{240, 128, 0}},
+		// 5
+		{value: 1 << 40, encoded: []byte{240, 241, 254, 254, 254, 254, 0}},
+	}
+	for i, test := range testCases {
+		e := &encoder{}
+		e.varint(test.value)
+		if !bytes.Equal(e.buf, test.encoded) {
+			t.Errorf("encoding differs on %d - expected: %v - actual: %v", i, test.encoded, e.buf)
+		}
+		d := &decoder{buf: test.encoded}
+		if value := d.varint(); value != test.value || d.err != nil {
+			t.Errorf("decoding differs on %d - expected: %d - actual: %d, %v", i, test.value, value, d.err)
+		}
+	}
+}
+
+func TestBuildCheckRequest(t *testing.T) {
+	headers := func(hdrs ...string) []byte {
+		e := &encoder{}
+		for _, h := range hdrs {
+			e.string(h)
+		}
+		e.string("")
+		e.string("")
+		return e.buf
+	}
+	testCases := []struct {
+		args     []kv
+		expected *authv3.AttributeContext
+	}{
+		// 0
+		{
+			expected: &authv3.AttributeContext{
+				Request: &authv3.AttributeContext_Request{
+					Http: &authv3.AttributeContext_HttpRequest{
+						Headers: map[string]string{},
+						Size:    -1,
+					},
+				},
+			},
+		},
+		// 1
+		{
+			args: []kv{
+				{name: "method", value: "GET"},
+				{name: "path", value: "/app?q=1"},
+				{name: "scheme", value: "https"},
+				{name: "version", value: "1.1"},
+				{name: "headers", value: headers("Host", "d1.local", "X-Id", "1", "x-id", "2")},
+				{name: "src", value: net.ParseIP("10.0.0.1").To4()},
+				{name: "src_port", value: int64(40000)},
+			},
+			expected: &authv3.AttributeContext{
+				Source: &authv3.AttributeContext_Peer{
+					Address: &corev3.Address{
+						Address: &corev3.Address_SocketAddress{
+							SocketAddress: &corev3.SocketAddress{
+								Address:       "10.0.0.1",
+								PortSpecifier: &corev3.SocketAddress_PortValue{PortValue: 40000},
+							},
+						},
+					},
+				},
+				Request: &authv3.AttributeContext_Request{
+					Http: &authv3.AttributeContext_HttpRequest{
+						Method:   "GET",
+						Path:     "/app?q=1",
+						Host:     "d1.local",
+						Scheme:   "https",
+						Protocol: "HTTP/1.1",
+						Headers:  map[string]string{"host": "d1.local", "x-id": "1,2"},
+						Size:     -1,
+					},
+				},
+			},
+		},
+		// 2
+		{
+			args: []kv{
+				{name: "host", value: "d2.local"},
+				{name: "headers", value: headers("Host", "d1.local")},
+				{name: "other", value: "ignored"},
+			},
+			expected: &authv3.AttributeContext{
+				Request: &authv3.AttributeContext_Request{
+					Http: &authv3.AttributeContext_HttpRequest{
+						Host:    "d2.local",
+						Headers: map[string]string{"host": "d1.local"},
+						Size:    -1,
+					},
+				},
+			},
+		},
+	}
+	for i, test := range testCases {
+		req := buildCheckRequest(&message{name: MessageName, args: test.args})
+		if !proto.Equal(req.Attributes, test.expected) {
+			t.Errorf("check request differs on %d - expected: %v - actual: %v", i, test.expected, req.Attributes)
+		}
+	}
+}
+
+type clientMock struct {
+	resp *authv3.CheckResponse
+	err  error
+	reqs []*authv3.CheckRequest
+}
+
+func (c *clientMock) Check(ctx context.Context, in *authv3.CheckRequest, opts ...grpc.CallOption) (*authv3.CheckResponse, error) {
+	c.reqs = append(c.reqs, in)
+	return c.resp, c.err
+}
+
+func TestHandle(t *testing.T) {
+	testCases := []struct {
+		resp     *authv3.CheckResponse
+		err      error
+		msgs     []string
+		expCalls int
+		expVars  []action
+		logging  string
+	}{
+		// 0
+		{
+			resp: &authv3.CheckResponse{
+				Status: &rpcstatus.Status{Code: int32(codes.OK)},
+			},
+			msgs:     []string{MessageName},
+			expCalls: 1,
+			expVars:  []action{{name: "allowed", value: true}},
+		},
+		// 1
+		{
+			resp: &authv3.CheckResponse{
+				Status: &rpcstatus.Status{Code: int32(codes.PermissionDenied)},
+			},
+			msgs:     []string{MessageName},
+			expCalls: 1,
+			expVars: []action{
+				{name: "allowed", value: false},
+				{name: "status", value: 403},
+			},
+		},
+		// 2
+		{
+			resp: &authv3.CheckResponse{
+				Status: &rpcstatus.Status{Code: int32(codes.Unauthenticated)},
+				HttpResponse: &authv3.CheckResponse_DeniedResponse{
+					DeniedResponse: &authv3.DeniedHttpResponse{
+						Status: &typev3.HttpStatus{Code: typev3.StatusCode_Unauthorized},
+					},
+				},
+			},
+			msgs:     []string{MessageName},
+			expCalls: 1,
+			expVars: []action{
+				{name: "allowed", value: false},
+				{name: "status", value: 401},
+			},
+		},
+		// 3
+		{
+			err:      fmt.Errorf("connection refused"),
+			msgs:     []string{MessageName},
+			expCalls: 1,
+			logging:  `WARN ext-authz: error checking request: connection refused`,
+		},
+		// 4
+		{
+			msgs: []string{"other-message"},
+		},
+	}
+	for i, test := range testCases {
+		logger := &helper_test.LoggerMock{T: t}
+		client := &clientMock{resp: test.resp, err: test.err}
+		a := &agent{
+			logger:  logger,
+			options: Options{Timeout: time.Second},
+			client:  client,
+		}
+		conn, haproxy := net.Pipe()
+		done := make(chan error)
+		go func() {
+			done <- a.handle(conn)
+			conn.Close()
+		}()
+
+		e := &encoder{}
+		for _, name := range test.msgs {
+			e.string(name)
+			e.byte(1)
+			e.string("method")
+			e.data("GET")
+		}
+		exchange := []struct {
+			send    *frame
+			expType byte
+			expLoad []byte
+		}{
+			{
+				send: &frame{ftype: frameHAProxyHello, flags: frameFlagFin, payload: encodeKVList([]kv{
+					{name: "supported-versions", value: "2.0"},
+					{name: "max-frame-size", value: uint32(16380)},
+					{name: "capabilities", value: "pipelining,async"},
+				})},
+				expType: frameAgentHello,
+				expLoad: encodeKVList([]kv{
+					{name: "version", value: "2.0"},
+					{name: "max-frame-size", value: uint32(16380)},
+					{name: "capabilities", value: ""},
+				}),
+			},
+			{
+				send:    &frame{ftype: frameNotify, flags: frameFlagFin, streamID: 10, frameID: 1, payload: e.buf},
+				expType: frameAck,
+				expLoad: encodeActions(test.expVars),
+			},
+			{
+				send: &frame{ftype: frameHAProxyDisconnect, flags: frameFlagFin, payload: encodeKVList([]kv{
+					{name: "status-code", value: uint32(0)},
+					{name: "message", value: "normal"},
+				})},
+				expType: frameAgentDisconnect,
+				expLoad: encodeKVList([]kv{
+					{name: "status-code", value: uint32(0)},
+					{name: "message", value: "normal"},
+				}),
+			},
+		}
+		for j, ex := range exchange {
+			if err := writeFrame(haproxy, ex.send); err != nil {
+				t.Fatalf("error writing frame %d on %d: %v", j, i, err)
+			}
+			f, err := readFrame(haproxy, spoeMaxFrameSize)
+			if err != nil {
+				t.Fatalf("error reading frame %d on %d: %v", j, i, err)
+			}
+			if f.ftype != ex.expType || !bytes.Equal(f.payload, ex.expLoad) {
+				t.Errorf("frame %d differs on %d - expected: %d %v - actual: %d %v", j, i, ex.expType, ex.expLoad, f.ftype, f.payload)
+			}
+			if f.ftype == frameAck && (f.streamID != 10 || f.frameID != 1) {
+				t.Errorf("ack ids differ on %d - expected: 10/1 - actual: %d/%d", i, f.streamID, f.frameID)
+			}
+		}
+		if err := <-done; err != nil {
+			t.Errorf("unexpected error on %d: %v", i, err)
+		}
+		haproxy.Close()
+		if len(client.reqs) != test.expCalls {
+			t.Errorf("check calls differ on %d - expected: %d - actual: %d", i, test.expCalls, len(client.reqs))
+		}
+		if test.expCalls > 0 && client.reqs[0].Attributes.Request.Http.Method != "GET" {
+			t.Errorf("check request method differs on %d: %v", i, client.reqs[0].Attributes.Request.Http.Method)
+		}
+		logger.CompareLogging(test.logging)
+	}
+}
+
+func TestHandleHealthcheck(t *testing.T) {
+	a := &agent{logger: &helper_test.LoggerMock{T: t}}
+	conn, haproxy := net.Pipe()
+	done := make(chan error)
+	go func() {
+		done <- a.handle(conn)
+		conn.Close()
+	}()
+	err := writeFrame(haproxy, &frame{ftype: frameHAProxyHello, flags: frameFlagFin, payload: encodeKVList([]kv{
+		{name: "supported-versions", value: "1.0,2.0"},
+		{name: "max-frame-size", value: uint32(1024)},
+		{name: "healthcheck", value: true},
+	})})
+	if err != nil {
+		t.Fatalf("error writing hello: %v", err)
+	}
+	f, err := readFrame(haproxy, spoeMaxFrameSize)
+	if err != nil {
+		t.Fatalf("error reading hello: %v", err)
+	}
+	hello, err := decodeKVList(f.payload)
+	if err != nil {
+		t.Fatalf("error decoding hello: %v", err)
+	}
+	if size := hello["max-frame-size"]; size != uint64(1024) {
+		t.Errorf("max-frame-size differs - expected: 1024 - actual: %v", size)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	haproxy.Close()
+}
+
+func TestTransportCredentials(t *testing.T) {
+	dir := t.TempDir()
+	invalidCA := filepath.Join(dir, "ca.crt")
+	if err := ioutil.WriteFile(invalidCA, []byte("invalid"), 0644); err != nil {
+		t.Fatalf("error writing ca: %v", err)
+	}
+	testCases := []struct {
+		options Options
+		expErr  string
+	}{
+		// 0
+		{
+			options: Options{},
+		},
+		// 1
+		{
+			options: Options{CA: invalidCA},
+			expErr:  "no valid certificate found in " + invalidCA,
+		},
+		// 2
+		{
+			options: Options{CA: filepath.Join(dir, "missing.crt")},
+			expErr:  "open " + filepath.Join(dir, "missing.crt") + ": no such file or directory",
+		},
+		// 3
+		{
+			options: Options{TLSCert: filepath.Join(dir, "missing.crt"), TLSKey: filepath.Join(dir, "missing.key")},
+			expErr:  "open " + filepath.Join(dir, "missing.crt") + ": no such file or directory",
+		},
+	}
+	for i, test := range testCases {
+		a := &agent{options: test.options}
+		creds, err := a.transportCredentials()
+		var errStr string
+		if err != nil {
+			errStr = err.Error()
+		}
+		if errStr != test.expErr {
+			t.Errorf("error differs on %d - expected: '%s' - actual: '%s'", i, test.expErr, errStr)
+		}
+		if err == nil && creds == nil {
+			t.Errorf("expected credentials on %d", i)
+		}
+	}
+}
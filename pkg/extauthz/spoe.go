@@ -0,0 +1,346 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extauthz
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+)
+
+// SPOE frame and data types, see https://www.haproxy.org/download/2.0/doc/SPOE.txt
+const (
+	frameHAProxyHello      byte = 1
+	frameHAProxyDisconnect byte = 2
+	frameNotify            byte = 3
+	frameAgentHello        byte = 101
+	frameAgentDisconnect   byte = 102
+	frameAck               byte = 103
+
+	frameFlagFin uint32 = 1
+
+	dataNull   byte = 0
+	dataBool   byte = 1
+	dataInt32  byte = 2
+	dataUint32 byte = 3
+	dataInt64  byte = 4
+	dataUint64 byte = 5
+	dataIPv4   byte = 6
+	dataIPv6   byte = 7
+	dataString byte = 8
+	dataBinary byte = 9
+
+	dataFlagTrue byte = 0x10
+
+	actionSetVar byte = 1
+
+	scopeTransaction byte = 2
+
+	spoeVersion      = "2.0"
+	spoeMaxFrameSize = 16380
+)
+
+// frame is a SPOE frame without its length.
+type frame struct {
+	ftype    byte
+	flags    uint32
+	streamID uint64
+	frameID  uint64
+	payload  []byte
+}
+
+// kv is a name/value pair of a SPOE KV-LIST, the value is a bool,
+// int64, uint64, net.IP, string, []byte or nil.
+type kv struct {
+	name  string
+	value interface{}
+}
+
+// message is a SPOE message of a NOTIFY frame.
+type message struct {
+	name string
+	args []kv
+}
+
+// action is a set-var action of an ACK frame.
+type action struct {
+	name  string
+	value interface{}
+}
+
+func readFrame(r io.Reader, maxSize uint32) (*frame, error) {
+	var size uint32
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+	if size > maxSize {
+		return nil, fmt.Errorf("frame size %d exceeds the maximum of %d", size, maxSize)
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	d := &decoder{buf: buf}
+	f := &frame{}
+	f.ftype = d.byte()
+	f.flags = d.uint32()
+	f.streamID = d.varint()
+	f.frameID = d.varint()
+	if d.err != nil {
+		return nil, d.err
+	}
+	f.payload = d.buf[d.pos:]
+	return f, nil
+}
+
+func writeFrame(w io.Writer, f *frame) error {
+	e := &encoder{}
+	e.byte(f.ftype)
+	e.uint32(f.flags)
+	e.varint(f.streamID)
+	e.varint(f.frameID)
+	e.buf = append(e.buf, f.payload...)
+	buf := make([]byte, 4, 4+len(e.buf))
+	binary.BigEndian.PutUint32(buf, uint32(len(e.buf)))
+	_, err := w.Write(append(buf, e.buf...))
+	return err
+}
+
+// decodeKVList decodes the KV-LIST payload of the HELLO and DISCONNECT frames.
+func decodeKVList(payload []byte) (map[string]interface{}, error) {
+	d := &decoder{buf: payload}
+	list := map[string]interface{}{}
+	for d.more() {
+		name := d.string()
+		list[name] = d.data()
+	}
+	return list, d.err
+}
+
+func encodeKVList(list []kv) []byte {
+	e := &encoder{}
+	for _, item := range list {
+		e.string(item.name)
+		e.data(item.value)
+	}
+	return e.buf
+}
+
+// decodeMessages decodes the LIST-OF-MESSAGES payload of a NOTIFY frame.
+func decodeMessages(payload []byte) ([]*message, error) {
+	d := &decoder{buf: payload}
+	var msgs []*message
+	for d.more() {
+		msg := &message{name: d.string()}
+		nbArgs := int(d.byte())
+		for i := 0; i < nbArgs && d.err == nil; i++ {
+			name := d.string()
+			msg.args = append(msg.args, kv{name: name, value: d.data()})
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, d.err
+}
+
+// encodeActions encodes the LIST-OF-ACTIONS payload of an ACK frame.
+func encodeActions(actions []action) []byte {
+	e := &encoder{}
+	for _, a := range actions {
+		e.byte(actionSetVar)
+		e.byte(3)
+		e.byte(scopeTransaction)
+		e.string(a.name)
+		e.data(a.value)
+	}
+	return e.buf
+}
+
+// decodeHeaders decodes the output of the req.hdrs_bin sample fetch.
+func decodeHeaders(buf []byte) ([]kv, error) {
+	d := &decoder{buf: buf}
+	var headers []kv
+	for d.more() {
+		name := d.string()
+		value := d.string()
+		if name == "" && value == "" {
+			break
+		}
+		headers = append(headers, kv{name: name, value: value})
+	}
+	return headers, d.err
+}
+
+type decoder struct {
+	buf []byte
+	pos int
+	err error
+}
+
+func (d *decoder) more() bool {
+	return d.err == nil && d.pos < len(d.buf)
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || d.pos+n > len(d.buf) {
+		d.err = fmt.Errorf("unexpected end of frame")
+		return nil
+	}
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b
+}
+
+func (d *decoder) byte() byte {
+	if b := d.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) uint32() uint32 {
+	if b := d.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+// varint decodes the SPOE variable-length integer.
+func (d *decoder) varint() uint64 {
+	i := uint64(d.byte())
+	if i < 240 {
+		return i
+	}
+	for r := uint(4); d.err == nil; r += 7 {
+		b := uint64(d.byte())
+		i += b << r
+		if b < 128 {
+			break
+		}
+	}
+	return i
+}
+
+func (d *decoder) bytes() []byte {
+	return d.next(int(d.varint()))
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes())
+}
+
+func (d *decoder) data() interface{} {
+	t := d.byte()
+	switch t & 0x0f {
+	case dataNull:
+		return nil
+	case dataBool:
+		return t&dataFlagTrue != 0
+	case dataInt32, dataInt64:
+		return int64(d.varint())
+	case dataUint32, dataUint64:
+		return d.varint()
+	case dataIPv4:
+		return net.IP(d.next(4))
+	case dataIPv6:
+		return net.IP(d.next(16))
+	case dataString:
+		return d.string()
+	case dataBinary:
+		return d.bytes()
+	}
+	if d.err == nil {
+		d.err = fmt.Errorf("unsupported data type: %d", t&0x0f)
+	}
+	return nil
+}
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) byte(b byte) {
+	e.buf = append(e.buf, b)
+}
+
+func (e *encoder) uint32(i uint32) {
+	e.buf = append(e.buf, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(e.buf[len(e.buf)-4:], i)
+}
+
+// varint encodes the SPOE variable-length integer.
+func (e *encoder) varint(i uint64) {
+	if i < 240 {
+		e.byte(byte(i))
+		return
+	}
+	e.byte(byte(i) | 240)
+	i = (i - 240) >> 4
+	for i >= 128 {
+		e.byte(byte(i) | 128)
+		i = (i - 128) >> 7
+	}
+	e.byte(byte(i))
+}
+
+func (e *encoder) string(s string) {
+	e.varint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) data(value interface{}) {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			e.byte(dataBool | dataFlagTrue)
+		} else {
+			e.byte(dataBool)
+		}
+	case int:
+		e.byte(dataInt64)
+		e.varint(uint64(v))
+	case int64:
+		e.byte(dataInt64)
+		e.varint(uint64(v))
+	case uint32:
+		e.byte(dataUint32)
+		e.varint(uint64(v))
+	case uint64:
+		e.byte(dataUint64)
+		e.varint(v)
+	case string:
+		e.byte(dataString)
+		e.string(v)
+	case []byte:
+		e.byte(dataBinary)
+		e.varint(uint64(len(v)))
+		e.buf = append(e.buf, v...)
+	case net.IP:
+		if ip4 := v.To4(); ip4 != nil {
+			e.byte(dataIPv4)
+			e.buf = append(e.buf, ip4...)
+		} else {
+			e.byte(dataIPv6)
+			e.buf = append(e.buf, v.To16()...)
+		}
+	default:
+		e.byte(dataNull)
+	}
+}
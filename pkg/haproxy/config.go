@@ -18,6 +18,7 @@ package haproxy
 
 import (
 	"fmt"
+	"io/ioutil"
 	"reflect"
 	"strconv"
 	"strings"
@@ -34,6 +35,8 @@ type Config interface {
 	SyncConfig()
 	WriteFrontendMaps() error
 	WriteBackendMaps() error
+	WriteErrorPages() error
+	WriteBotMitigation() error
 	AcmeData() *hatypes.AcmeData
 	Global() *hatypes.Global
 	TCPBackends() *hatypes.TCPBackends
@@ -101,7 +104,7 @@ func (c *config) SyncConfig() {
 		// One single HAProxy's frontend and bind
 		c.frontend.BindName = "_public"
 		c.frontend.BindSocket = c.global.Bind.HTTPSBind
-		c.frontend.AcceptProxy = c.global.Bind.AcceptProxy
+		c.frontend.AcceptProxy = c.global.Bind.HTTPSAcceptProxy
 	}
 	for _, host := range c.hosts.ItemsAdd() {
 		if host.SSLPassthrough() {
@@ -158,6 +161,11 @@ func (c *config) WriteFrontendMaps() error {
 		RedirCodeMap:      mapBuilder.AddMap(mapsDir + "/_front_redir_code.map"),
 		SSLPassthroughMap: mapBuilder.AddMap(mapsDir + "/_front_sslpassthrough.map"),
 		VarNamespaceMap:   mapBuilder.AddMap(mapsDir + "/_front_namespace.map"),
+		InternalHostMap:   mapBuilder.AddMap(mapsDir + "/_front_internal_host.map"),
+		TenantHostMap:     mapBuilder.AddMap(mapsDir + "/_front_tenant_host.map"),
+		DrainRedirMap:     mapBuilder.AddMap(mapsDir + "/_front_drain_redir.map"),
+		DrainGoneList:     mapBuilder.AddMap(mapsDir + "/_front_drain_gone.list"),
+		BotMitigationMap:  mapBuilder.AddMap(mapsDir + "/_front_bot_mitigation.map"),
 		//
 		TLSAuthList:           mapBuilder.AddMap(mapsDir + "/_front_tls_auth.list"),
 		TLSNeedCrtList:        mapBuilder.AddMap(mapsDir + "/_front_tls_needcrt.list"),
@@ -192,18 +200,22 @@ func (c *config) WriteFrontendMaps() error {
 		//
 		// Starting here to the end of the outer for-loop has only HTTP/L7 map configuration
 		//
+		// a declared hostname has precedence over the alias of another host
+		alias := host.Alias
+		if alias.AliasName != "" && c.hosts.FindHost(alias.AliasName) != nil {
+			alias.AliasName = ""
+		}
 		for _, path := range host.Paths {
 			backendID := path.Backend.ID
-			// IMPLEMENT check if host.Alias.AliasName was already used as a hostname
 			if host.HasTLSAuth() {
 				fmaps.HTTPSSNIMap.AddHostnamePathMapping(host.Hostname, path, backendID)
-				fmaps.HTTPSSNIMap.AddAliasPathMapping(host.Alias, path, backendID)
+				fmaps.HTTPSSNIMap.AddAliasPathMapping(alias, path, backendID)
 			} else {
 				fmaps.HTTPSHostMap.AddHostnamePathMapping(host.Hostname, path, backendID)
-				fmaps.HTTPSHostMap.AddAliasPathMapping(host.Alias, path, backendID)
+				fmaps.HTTPSHostMap.AddAliasPathMapping(alias, path, backendID)
 			}
 			fmaps.HTTPHostMap.AddHostnamePathMapping(host.Hostname, path, backendID)
-			fmaps.HTTPHostMap.AddAliasPathMapping(host.Alias, path, backendID)
+			fmaps.HTTPHostMap.AddAliasPathMapping(alias, path, backendID)
 			if hasVarNamespace {
 				// add "-" on missing paths to avoid overlap
 				var ns string
@@ -214,6 +226,14 @@ func (c *config) WriteFrontendMaps() error {
 				}
 				fmaps.VarNamespaceMap.AddHostnamePathMapping(host.Hostname, path, ns)
 			}
+			if host.Internal {
+				fmaps.InternalHostMap.AddHostnamePathMapping(host.Hostname, path, "internal")
+				fmaps.InternalHostMap.AddAliasPathMapping(alias, path, "internal")
+			}
+			if host.Tenant != "" {
+				fmaps.TenantHostMap.AddHostnamePathMapping(host.Hostname, path, host.Tenant)
+				fmaps.TenantHostMap.AddAliasPathMapping(alias, path, host.Tenant)
+			}
 		}
 		var redirectCode string
 		if host.Redirect.RedirectCode > 0 && host.Redirect.RedirectCode != c.frontend.DefaultServerRedirectCode {
@@ -249,17 +269,39 @@ func (c *config) WriteFrontendMaps() error {
 		if host.RootRedirect != "" {
 			fmaps.RedirFromRootMap.AddHostnameMapping(host.Hostname, host.RootRedirect)
 		}
+		if host.Drain.Draining {
+			if host.Drain.Location != "" {
+				fmaps.DrainRedirMap.AddHostnameMapping(host.Hostname, host.Drain.Location)
+			} else {
+				fmaps.DrainGoneList.AddHostnameMapping(host.Hostname, "")
+			}
+		}
+		if host.BotMitigation != "" && c.global.BotMitigation.HasRules() {
+			fmaps.BotMitigationMap.AddHostnameMapping(host.Hostname, host.BotMitigation)
+		}
 		//
 		tls := host.TLS
 		crtFile := tls.TLSFilename
 		if crtFile == "" {
 			crtFile = c.frontend.DefaultCrtFile
 		}
-		if crtFile != c.frontend.DefaultCrtFile ||
+		hasPoolCrt := false
+		if crtFile == c.frontend.DefaultCrtFile {
+			// a custom tls config below creates a line of the host, which would
+			// hide the certificates of the pool, so the same match is used here
+			if poolCrt := c.frontend.FindPoolCrt(host.Hostname); poolCrt != "" {
+				crtFile = poolCrt
+				hasPoolCrt = true
+			}
+		}
+		if (crtFile != c.frontend.DefaultCrtFile && !hasPoolCrt) ||
 			tls.ALPN != "" ||
 			tls.CAFilename != "" ||
 			tls.Ciphers != "" ||
 			tls.CipherSuites != "" ||
+			tls.Curves != "" ||
+			tls.SSLMinVer != "" ||
+			tls.SSLMaxVer != "" ||
 			tls.Options != "" {
 			// has custom tls config
 			//
@@ -282,6 +324,15 @@ func (c *config) WriteFrontendMaps() error {
 			if tls.CipherSuites != "" {
 				bindConf = append(bindConf, "ciphersuites", tls.CipherSuites)
 			}
+			if tls.Curves != "" {
+				bindConf = append(bindConf, "curves", tls.Curves)
+			}
+			if tls.SSLMinVer != "" {
+				bindConf = append(bindConf, "ssl-min-ver", tls.SSLMinVer)
+			}
+			if tls.SSLMaxVer != "" {
+				bindConf = append(bindConf, "ssl-max-ver", tls.SSLMaxVer)
+			}
 			if tls.Options != "" {
 				bindConf = append(bindConf, tls.Options)
 			}
@@ -295,6 +346,12 @@ func (c *config) WriteFrontendMaps() error {
 			crtListItems = append(crtListItems, &hatypes.HostsMapEntry{Key: crtListEntry})
 		}
 	}
+	// certificates of the default pool are declared after the hosts, without
+	// sni filters, so haproxy selects them via SNI only if a host doesn't have
+	// its own certificate
+	for _, crt := range c.frontend.DefaultCrtPool {
+		crtListItems = append(crtListItems, &hatypes.HostsMapEntry{Key: crt.Filename})
+	}
 	if err := c.options.mapsTemplate.WriteOutput(crtListItems, c.frontend.CrtListFile); err != nil {
 		return err
 	}
@@ -338,16 +395,55 @@ func (c *config) WriteBackendMaps() error {
 	return writeMaps(mapBuilder, c.options.mapsTemplate)
 }
 
-func writeMaps(maps *hatypes.HostsMaps, template *template.Config) error {
+// WriteErrorPages writes the content of the custom error pages
+// used by the errorfile keyword. Should be called before write the
+// main config file. This func doesn't change model state, except
+// the link to the error page files.
+func (c *config) WriteErrorPages() error {
+	for _, page := range c.global.ErrorPages {
+		filename := fmt.Sprintf("%s/_error%d.http", c.options.mapsDir, page.Code)
+		if err := ioutil.WriteFile(filename, []byte(page.Content), 0644); err != nil {
+			return err
+		}
+		page.Filename = filename
+	}
+	return nil
+}
+
+// WriteBotMitigation writes the user agent and path lists of the bot
+// mitigation rules. Should be called before write the main config file.
+// This func doesn't change model state, except the link to the list files.
+func (c *config) WriteBotMitigation() error {
+	bot := &c.global.BotMitigation
+	bot.UserAgentsFile = ""
+	bot.PathsFile = ""
+	writeList := func(name string, items []string) (string, error) {
+		if len(items) == 0 {
+			return "", nil
+		}
+		filename := c.options.mapsDir + "/" + name
+		content := strings.Join(items, "\n") + "\n"
+		return filename, ioutil.WriteFile(filename, []byte(content), 0644)
+	}
+	var err error
+	if bot.UserAgentsFile, err = writeList("_bot_useragents.list", bot.UserAgents); err != nil {
+		return err
+	}
+	bot.PathsFile, err = writeList("_bot_paths.list", bot.Paths)
+	return err
+}
+
+func writeMaps(maps *hatypes.HostsMaps, tmpl *template.Config) error {
+	var outputs []template.Output
 	for _, hmap := range maps.Items {
 		for _, matchFile := range hmap.MatchFiles() {
-			filename := matchFile.Filename()
-			if err := template.WriteOutput(matchFile.Values(), filename); err != nil {
-				return err
-			}
+			outputs = append(outputs, template.Output{
+				Data:     matchFile.Values(),
+				Filename: matchFile.Filename(),
+			})
 		}
 	}
-	return nil
+	return tmpl.WriteOutputs(outputs)
 }
 
 func (c *config) AcmeData() *hatypes.AcmeData {
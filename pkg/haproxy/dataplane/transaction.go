@@ -0,0 +1,123 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dataplane
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ServerChange is a structured change of a backend server, applied
+// via the configuration API instead of pushing the whole configuration.
+type ServerChange struct {
+	Backend     string
+	Name        string
+	Address     string
+	Port        int
+	Weight      int
+	Maintenance bool
+}
+
+// ApplyServers applies a list of server changes in a single transaction.
+// The Data Plane API validates the resulting configuration on commit,
+// and applies it via runtime api if possible, reloading haproxy
+// otherwise. The transaction is discarded if any change fails.
+func (c *Client) ApplyServers(changes []ServerChange) error {
+	version, err := c.configVersion()
+	if err != nil {
+		return err
+	}
+	txn, err := c.startTransaction(version)
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		if err := c.replaceServer(txn, change); err != nil {
+			_, _ = c.do(http.MethodDelete, "/transactions/"+url.PathEscape(txn), nil, "", nil)
+			return err
+		}
+	}
+	_, err = c.do(http.MethodPut, "/transactions/"+url.PathEscape(txn), nil, "", nil)
+	return err
+}
+
+func (c *Client) configVersion() (int, error) {
+	out, err := c.doJSON(http.MethodGet, "/configuration/version", nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	version, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid configuration version '%s' on %s", strings.TrimSpace(string(out)), c.endpoint.Host)
+	}
+	return version, nil
+}
+
+func (c *Client) startTransaction(version int) (string, error) {
+	query := url.Values{"version": {strconv.Itoa(version)}}
+	out, err := c.doJSON(http.MethodPost, "/transactions", query, nil)
+	if err != nil {
+		return "", err
+	}
+	var txn struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(out, &txn); err != nil || txn.ID == "" {
+		return "", fmt.Errorf("cannot read the transaction id from %s: %s", c.endpoint.Host, string(out))
+	}
+	return txn.ID, nil
+}
+
+// replaceServer reads the current server of the transaction, and changes
+// only the fields managed by the controller, so the other server options
+// rendered by the template are preserved.
+func (c *Client) replaceServer(txn string, change ServerChange) error {
+	path := "/configuration/servers/" + url.PathEscape(change.Name)
+	query := url.Values{"backend": {change.Backend}, "transaction_id": {txn}}
+	out, err := c.doJSON(http.MethodGet, path, query, nil)
+	if err != nil {
+		return err
+	}
+	var current struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(out, &current); err != nil || current.Data == nil {
+		return fmt.Errorf("cannot read server %s/%s from %s: %s", change.Backend, change.Name, c.endpoint.Host, string(out))
+	}
+	server := current.Data
+	server["address"] = change.Address
+	server["port"] = change.Port
+	server["weight"] = change.Weight
+	server["maintenance"] = map[bool]string{true: "enabled", false: "disabled"}[change.Maintenance]
+	body, err := json.Marshal(server)
+	if err != nil {
+		return err
+	}
+	_, err = c.doJSON(http.MethodPut, path, query, body)
+	return err
+}
+
+// doJSON sends a request with a json payload, returning the response body.
+func (c *Client) doJSON(method, path string, query url.Values, body []byte) ([]byte, error) {
+	var out []byte
+	_, err := c.request(method, path, query, "application/json", body, &out)
+	return out, err
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dataplane
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApplyServers(t *testing.T) {
+	testCases := []struct {
+		changes  []ServerChange
+		failPut  bool
+		expReqs  []string
+		expError bool
+	}{
+		// 0
+		{
+			changes: []ServerChange{
+				{Backend: "default_app_8080", Name: "srv001", Address: "172.17.0.2", Port: 8080, Weight: 1},
+				{Backend: "default_app_8080", Name: "srv002", Address: "127.0.0.1", Port: 1023, Maintenance: true},
+			},
+			expReqs: []string{
+				"GET /v2/services/haproxy/configuration/version",
+				"POST /v2/services/haproxy/transactions?version=5",
+				"GET /v2/services/haproxy/configuration/servers/srv001?backend=default_app_8080&transaction_id=t1",
+				`PUT /v2/services/haproxy/configuration/servers/srv001?backend=default_app_8080&transaction_id=t1 {"address":"172.17.0.2","check":"enabled","maintenance":"disabled","name":"srv001","port":8080,"weight":1}`,
+				"GET /v2/services/haproxy/configuration/servers/srv002?backend=default_app_8080&transaction_id=t1",
+				`PUT /v2/services/haproxy/configuration/servers/srv002?backend=default_app_8080&transaction_id=t1 {"address":"127.0.0.1","check":"enabled","maintenance":"enabled","name":"srv002","port":1023,"weight":0}`,
+				"PUT /v2/services/haproxy/transactions/t1",
+			},
+		},
+		// 1
+		{
+			changes: []ServerChange{
+				{Backend: "default_app_8080", Name: "srv001", Address: "172.17.0.2", Port: 8080, Weight: 1},
+			},
+			failPut: true,
+			expReqs: []string{
+				"GET /v2/services/haproxy/configuration/version",
+				"POST /v2/services/haproxy/transactions?version=5",
+				"GET /v2/services/haproxy/configuration/servers/srv001?backend=default_app_8080&transaction_id=t1",
+				`PUT /v2/services/haproxy/configuration/servers/srv001?backend=default_app_8080&transaction_id=t1 {"address":"172.17.0.2","check":"enabled","maintenance":"disabled","name":"srv001","port":8080,"weight":1}`,
+				"DELETE /v2/services/haproxy/transactions/t1",
+			},
+			expError: true,
+		},
+	}
+	for i, test := range testCases {
+		var reqs []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			reqs = append(reqs, strings.TrimSpace(r.Method+" "+r.URL.RequestURI()+" "+string(body)))
+			switch {
+			case strings.HasSuffix(r.URL.Path, "/version"):
+				fmt.Fprint(w, "5\n")
+			case r.Method == http.MethodPost:
+				w.WriteHeader(http.StatusCreated)
+				fmt.Fprint(w, `{"id":"t1","status":"in_progress"}`)
+			case r.Method == http.MethodGet:
+				name := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+				fmt.Fprintf(w, `{"_version":5,"data":{"name":"%s","address":"127.0.0.1","port":1023,"check":"enabled"}}`, name)
+			case r.Method == http.MethodPut && test.failPut && strings.Contains(r.URL.Path, "/servers/"):
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		}))
+		c, _ := NewClient(server.URL, time.Second)
+		err := c.ApplyServers(test.changes)
+		server.Close()
+		if (err != nil) != test.expError {
+			t.Errorf("%d: expected error %t but was %v", i, test.expError, err)
+		}
+		if fmt.Sprint(reqs) != fmt.Sprint(test.expReqs) {
+			t.Errorf("%d: expected requests:\n%s\nbut was:\n%s", i, strings.Join(test.expReqs, "\n"), strings.Join(reqs, "\n"))
+		}
+	}
+}
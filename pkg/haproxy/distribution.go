@@ -0,0 +1,192 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package haproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// distribution serves the configuration files - haproxy config, maps,
+// certificates, error pages - to haproxy replicas running outside the
+// controller pod. Replicas poll the manifest, download the files whose
+// checksum changed, and reload haproxy. The version of the manifest is
+// incremented whenever a new configuration is published.
+type distribution struct {
+	sources []string
+	mutex   sync.RWMutex
+	version int
+	files   map[string]distributionFile
+	// closed and recreated on every new version
+	changed chan struct{}
+}
+
+type distributionFile struct {
+	content []byte
+	hash    string
+}
+
+type distributionManifest struct {
+	Version int                        `json:"version"`
+	Files   []distributionManifestFile `json:"files"`
+}
+
+type distributionManifestFile struct {
+	Path string `json:"path"`
+	SHA1 string `json:"sha1"`
+	Size int    `json:"size"`
+}
+
+const distributionMaxWait = 5 * time.Minute
+
+func newDistribution(sources []string) *distribution {
+	return &distribution{
+		sources: sources,
+		files:   map[string]distributionFile{},
+		changed: make(chan struct{}),
+	}
+}
+
+// publish reads the current content of the sources, and creates a new
+// version of the manifest if any file was added, changed or removed.
+func (d *distribution) publish() (changed bool, err error) {
+	paths, err := listFiles(d.sources)
+	if err != nil {
+		return false, err
+	}
+	files := make(map[string]distributionFile, len(paths))
+	for _, path := range paths {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return false, err
+		}
+		files[path] = distributionFile{content: content, hash: sha1Hash(content)}
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	changed = len(files) != len(d.files) || d.version == 0
+	for path, file := range files {
+		if cur, found := d.files[path]; !found || cur.hash != file.hash {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+	d.files = files
+	d.version++
+	close(d.changed)
+	d.changed = make(chan struct{})
+	return true, nil
+}
+
+// ServeHTTP implements the distribution api:
+//
+//   * GET /v1/manifest - the current version and the checksum of all the files.
+//     `?version=<n>&wait=<duration>` blocks up to the wait duration while the
+//     current version is the same of the requested one.
+//   * GET /v1/files/<path> - the content of a file of the current version.
+//     `?sha1=<hash>` fails with 409 if the file changed in the mean time.
+func (d *distribution) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch {
+	case r.URL.Path == "/v1/manifest":
+		d.serveManifest(w, r)
+	case strings.HasPrefix(r.URL.Path, "/v1/files/"):
+		d.serveFile(w, r, strings.TrimPrefix(r.URL.Path, "/v1/files"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (d *distribution) serveManifest(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if waitStr := query.Get("wait"); waitStr != "" {
+		wait, err := time.ParseDuration(waitStr)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid wait: %v", err), http.StatusBadRequest)
+			return
+		}
+		if wait > distributionMaxWait {
+			wait = distributionMaxWait
+		}
+		version, _ := strconv.Atoi(query.Get("version"))
+		d.mutex.RLock()
+		current, changed := d.version, d.changed
+		d.mutex.RUnlock()
+		if current == version {
+			select {
+			case <-changed:
+			case <-time.After(wait):
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+	d.mutex.RLock()
+	manifest := distributionManifest{
+		Version: d.version,
+		Files:   make([]distributionManifestFile, 0, len(d.files)),
+	}
+	for path, file := range d.files {
+		manifest.Files = append(manifest.Files, distributionManifestFile{
+			Path: path,
+			SHA1: file.hash,
+			Size: len(file.content),
+		})
+	}
+	d.mutex.RUnlock()
+	if manifest.Version == 0 {
+		http.Error(w, "configuration was not published yet", http.StatusServiceUnavailable)
+		return
+	}
+	sort.Slice(manifest.Files, func(i, j int) bool {
+		return manifest.Files[i].Path < manifest.Files[j].Path
+	})
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(manifest)
+}
+
+func (d *distribution) serveFile(w http.ResponseWriter, r *http.Request, path string) {
+	d.mutex.RLock()
+	file, found := d.files[path]
+	version := d.version
+	d.mutex.RUnlock()
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	if hash := r.URL.Query().Get("sha1"); hash != "" && hash != file.hash {
+		http.Error(w, "file changed, read the manifest again", http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("X-Checksum-Sha1", file.hash)
+	w.Header().Set("X-Version", strconv.Itoa(version))
+	_, _ = w.Write(file.content)
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package haproxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDistribution(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempdir)
+	writeFile := func(name, content string) string {
+		path := filepath.Join(tempdir, name)
+		_ = os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("error writing %s: %v", path, err)
+		}
+		return path
+	}
+	cfgFile := writeFile("haproxy/haproxy.cfg", "global\n")
+	writeFile("haproxy/haproxy.cfg.20210101-101010.000", "old\n")
+	crtFile := writeFile("crt/default.pem", "crt1")
+
+	d := newDistribution([]string{filepath.Join(tempdir, "haproxy"), filepath.Join(tempdir, "crt")})
+	server := httptest.NewServer(d)
+	defer server.Close()
+	get := func(uri string) (int, string) {
+		res, err := http.Get(server.URL + uri)
+		if err != nil {
+			t.Fatalf("error requesting %s: %v", uri, err)
+		}
+		defer res.Body.Close()
+		body, _ := ioutil.ReadAll(res.Body)
+		return res.StatusCode, strings.TrimSpace(strings.ReplaceAll(string(body), tempdir, "TMP"))
+	}
+	publish := func(expChanged bool) {
+		changed, err := d.publish()
+		if err != nil {
+			t.Errorf("unexpected error publishing: %v", err)
+		}
+		if changed != expChanged {
+			t.Errorf("expected changed %t but was %t", expChanged, changed)
+		}
+	}
+
+	testCases := []struct {
+		uri       string
+		setup     func()
+		expStatus int
+		expBody   string
+	}{
+		// 0
+		{
+			uri:       "/v1/manifest",
+			expStatus: http.StatusServiceUnavailable,
+			expBody:   "configuration was not published yet",
+		},
+		// 1
+		{
+			uri:       "/v1/manifest",
+			setup:     func() { publish(true) },
+			expStatus: http.StatusOK,
+			expBody:   `{"version":1,"files":[{"path":"TMP/crt/default.pem","sha1":"` + sha1Hash([]byte("crt1")) + `","size":4},{"path":"TMP/haproxy/haproxy.cfg","sha1":"` + sha1Hash([]byte("global\n")) + `","size":7}]}`,
+		},
+		// 2
+		{
+			uri:       "/v1/files" + cfgFile,
+			setup:     func() { publish(false) },
+			expStatus: http.StatusOK,
+			expBody:   "global",
+		},
+		// 3
+		{
+			uri:       "/v1/files" + crtFile + "?sha1=" + sha1Hash([]byte("crt1")),
+			expStatus: http.StatusOK,
+			expBody:   "crt1",
+		},
+		// 4
+		{
+			uri: "/v1/files" + crtFile + "?sha1=" + sha1Hash([]byte("crt1")),
+			setup: func() {
+				writeFile("crt/default.pem", "crt2")
+				publish(true)
+			},
+			expStatus: http.StatusConflict,
+			expBody:   "file changed, read the manifest again",
+		},
+		// 5
+		{
+			uri:       "/v1/files" + filepath.Join(tempdir, "haproxy/haproxy.cfg.20210101-101010.000"),
+			expStatus: http.StatusNotFound,
+			expBody:   "404 page not found",
+		},
+		// 6
+		{
+			uri:       "/v1/files/../../etc/passwd",
+			expStatus: http.StatusNotFound,
+			expBody:   "404 page not found",
+		},
+		// 7
+		{
+			uri: "/v1/manifest?version=2&wait=1m",
+			setup: func() {
+				time.AfterFunc(50*time.Millisecond, func() {
+					_ = os.Remove(crtFile)
+					publish(true)
+				})
+			},
+			expStatus: http.StatusOK,
+			expBody:   `{"version":3,"files":[{"path":"TMP/haproxy/haproxy.cfg","sha1":"` + sha1Hash([]byte("global\n")) + `","size":7}]}`,
+		},
+		// 8
+		{
+			uri:       "/v1/manifest?version=3&wait=10ms",
+			expStatus: http.StatusOK,
+			expBody:   `{"version":3,"files":[{"path":"TMP/haproxy/haproxy.cfg","sha1":"` + sha1Hash([]byte("global\n")) + `","size":7}]}`,
+		},
+		// 9
+		{
+			uri:       "/v1/manifest?wait=1x",
+			expStatus: http.StatusBadRequest,
+			expBody:   `invalid wait: time: unknown unit "x" in duration "1x"`,
+		},
+	}
+	for i, test := range testCases {
+		if test.setup != nil {
+			test.setup()
+		}
+		status, body := get(test.uri)
+		if status != test.expStatus {
+			t.Errorf("%d: expected status %d but was %d", i, test.expStatus, status)
+		}
+		if body != test.expBody {
+			t.Errorf("%d: expected body '%s' but was '%s'", i, test.expBody, body)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package haproxy
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	hatypes "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/types"
+	hautils "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/utils"
+)
+
+// Drift is a difference between the desired state of the last update and
+// the state of the running haproxy, e.g. due to a dynamic update that
+// failed without being noticed.
+type Drift struct {
+	// Kind is either `server` or `cert`
+	Kind string
+	// Name is `<backend>/<server>` of a server, or the certificate filename
+	Name   string
+	Reason string
+}
+
+type driftServer struct {
+	addr    string
+	port    int
+	enabled bool
+}
+
+// driftState is a copy of the desired state of the servers and the
+// certificates, and of the instance state the drift check needs. Neither
+// the model nor the instance are thread safe, so they cannot be read by
+// the drift check.
+type driftState struct {
+	mutex   sync.Mutex
+	up      bool
+	socket  string
+	servers map[string]driftServer
+	certs   map[string]time.Time
+	reload  bool
+}
+
+// update copies the desired state from the model. Should be called from
+// the same goroutine that updates the model.
+func (d *driftState) update(config Config, up bool) {
+	servers := map[string]driftServer{}
+	addServer := func(backend *hatypes.Backend, ep *hatypes.Endpoint, enabled bool) {
+		servers[backend.ID+"/"+ep.Name] = driftServer{
+			addr:    ep.IP,
+			port:    ep.Port,
+			enabled: enabled,
+		}
+	}
+	for _, backend := range config.Backends().Items() {
+		if backend.Resolver != "" {
+			// addresses are updated by haproxy via DNS
+			continue
+		}
+		for _, ep := range backend.Endpoints {
+			addServer(backend, ep, ep.Enabled)
+		}
+		for _, ep := range backend.BackupEndpoints {
+			addServer(backend, ep, true)
+		}
+	}
+	certs := map[string]time.Time{}
+	for _, host := range config.Hosts().Items() {
+		if host.TLS.TLSFilename != "" {
+			certs[host.TLS.TLSFilename] = host.TLS.TLSNotAfter
+		}
+	}
+	d.mutex.Lock()
+	d.up = up
+	d.socket = config.Global().AdminSocket
+	d.servers = servers
+	d.certs = certs
+	d.mutex.Unlock()
+}
+
+// requestReload asks the next update to reload haproxy, even if the
+// changes could be dynamically applied.
+func (d *driftState) requestReload() {
+	d.mutex.Lock()
+	d.reload = true
+	d.mutex.Unlock()
+}
+
+// reloadRequested returns and clears a reload request.
+func (d *driftState) reloadRequested() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	reload := d.reload
+	d.reload = false
+	return reload
+}
+
+// CheckDrift compares the state of the last update with the servers and
+// the certificates of the running haproxy.
+func (i *instance) CheckDrift() ([]Drift, error) {
+	if i.detached() {
+		return nil, nil
+	}
+	i.drift.mutex.Lock()
+	up, socket := i.drift.up, i.drift.socket
+	servers, certs := i.drift.servers, i.drift.certs
+	i.drift.mutex.Unlock()
+	if !up || servers == nil {
+		// no update applied yet
+		return nil, nil
+	}
+	states, err := hautils.HAProxyServersState(socket, "")
+	if err != nil {
+		return nil, fmt.Errorf("error reading servers state: %w", err)
+	}
+	drifts := compareServers(servers, states)
+	if len(certs) > 0 {
+		running, err := hautils.HAProxySSLCerts(socket, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error reading certificates: %w", err)
+		}
+		drifts = append(drifts, compareCerts(certs, running)...)
+	}
+	return drifts, nil
+}
+
+// RequestReload configures the next update to fully reload haproxy,
+// used to reconcile a drifted instance.
+func (i *instance) RequestReload() {
+	i.drift.requestReload()
+}
+
+// compareServers compares the desired servers with the output of
+// `show servers state`. Servers in maintenance or drain, which were
+// enabled in the configuration, aren't reported: they could have been
+// changed by an operator via the runtime API.
+func compareServers(expected map[string]driftServer, states []hautils.ServerState) []Drift {
+	var drifts []Drift
+	found := make(map[string]bool, len(states))
+	for _, state := range states {
+		name := state.Backend + "/" + state.Server
+		server, ok := expected[name]
+		if !ok {
+			// backends not managed by the model, e.g. stats or the
+			// default backend, or a server added by the template
+			continue
+		}
+		found[name] = true
+		switch {
+		case server.addr != state.Addr || server.port != state.Port:
+			drifts = append(drifts, Drift{
+				Kind:   "server",
+				Name:   name,
+				Reason: fmt.Sprintf("address is %s:%d, expected %s:%d", state.Addr, state.Port, server.addr, server.port),
+			})
+		case !server.enabled && !state.Maint():
+			drifts = append(drifts, Drift{
+				Kind:   "server",
+				Name:   name,
+				Reason: "server is enabled, expected maintenance",
+			})
+		}
+	}
+	var missing []string
+	for name := range expected {
+		if !found[name] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	for _, name := range missing {
+		drifts = append(drifts, Drift{
+			Kind:   "server",
+			Name:   name,
+			Reason: "server not found",
+		})
+	}
+	return drifts
+}
+
+// compareCerts compares the desired certificate files, and their expiration
+// date, with the certificates loaded by haproxy.
+func compareCerts(expected, running map[string]time.Time) []Drift {
+	filenames := make([]string, 0, len(expected))
+	for filename := range expected {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	var drifts []Drift
+	for _, filename := range filenames {
+		notAfter := expected[filename]
+		runningNotAfter, found := running[filename]
+		switch {
+		case !found:
+			drifts = append(drifts, Drift{
+				Kind:   "cert",
+				Name:   filename,
+				Reason: "certificate not loaded",
+			})
+		case !notAfter.IsZero() && !runningNotAfter.IsZero() && !notAfter.Equal(runningNotAfter):
+			drifts = append(drifts, Drift{
+				Kind:   "cert",
+				Name:   filename,
+				Reason: fmt.Sprintf("certificate expires at %s, expected %s", runningNotAfter.Format(time.RFC3339), notAfter.Format(time.RFC3339)),
+			})
+		}
+	}
+	return drifts
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package haproxy
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	hautils "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/utils"
+)
+
+func TestDrift(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	b := c.config.Backends().AcquireBackend("default", "app", "8080")
+	b.AcquireEndpoint("172.17.0.11", 8080, "").Enabled = true
+	b.AcquireEndpoint("172.17.0.12", 8080, "").Enabled = true
+	b.AddEmptyEndpoint()
+	notAfter := time.Date(2030, 12, 31, 23, 59, 59, 0, time.UTC)
+	h := c.config.Hosts().AcquireHost("d1.local")
+	h.TLS.TLSFilename = "/var/haproxy/ssl/certs/d1.pem"
+	h.TLS.TLSNotAfter = notAfter
+	h = c.config.Hosts().AcquireHost("d2.local")
+	h.TLS.TLSFilename = "/var/haproxy/ssl/certs/d2.pem"
+	c.config.Hosts().AcquireHost("d3.local")
+
+	d := &c.instance.drift
+	d.update(c.config, true)
+
+	testCases := []struct {
+		states   []hautils.ServerState
+		certs    map[string]time.Time
+		expected []Drift
+	}{
+		// 0
+		{
+			states: []hautils.ServerState{
+				{Backend: "default_app_8080", Server: "srv001", Addr: "172.17.0.11", Port: 8080, OpState: 2},
+				{Backend: "default_app_8080", Server: "srv002", Addr: "172.17.0.12", Port: 8080, OpState: 2, AdminState: 0x01},
+				{Backend: "default_app_8080", Server: "srv003", Addr: "127.0.0.1", Port: 1023, AdminState: 0x04},
+				{Backend: "_default_backend", Server: "srv001", Addr: "172.17.0.99", Port: 8080, OpState: 2},
+			},
+			certs: map[string]time.Time{
+				"/var/haproxy/ssl/certs/d1.pem": notAfter,
+				"/var/haproxy/ssl/certs/d2.pem": notAfter,
+			},
+		},
+		// 1
+		{
+			states: []hautils.ServerState{
+				{Backend: "default_app_8080", Server: "srv001", Addr: "172.17.0.21", Port: 8080, OpState: 2},
+				{Backend: "default_app_8080", Server: "srv003", Addr: "127.0.0.1", Port: 1023, OpState: 0},
+			},
+			certs: map[string]time.Time{
+				"/var/haproxy/ssl/certs/d1.pem": notAfter.Add(-24 * time.Hour),
+			},
+			expected: []Drift{
+				{Kind: "server", Name: "default_app_8080/srv001", Reason: "address is 172.17.0.21:8080, expected 172.17.0.11:8080"},
+				{Kind: "server", Name: "default_app_8080/srv003", Reason: "server is enabled, expected maintenance"},
+				{Kind: "server", Name: "default_app_8080/srv002", Reason: "server not found"},
+				{Kind: "cert", Name: "/var/haproxy/ssl/certs/d1.pem", Reason: "certificate expires at 2030-12-30T23:59:59Z, expected 2030-12-31T23:59:59Z"},
+				{Kind: "cert", Name: "/var/haproxy/ssl/certs/d2.pem", Reason: "certificate not loaded"},
+			},
+		},
+	}
+	for i, test := range testCases {
+		drifts := compareServers(d.servers, test.states)
+		drifts = append(drifts, compareCerts(d.certs, test.certs)...)
+		if !reflect.DeepEqual(drifts, test.expected) {
+			t.Errorf("drift differs on %d - expected: %+v - actual: %+v", i, test.expected, drifts)
+		}
+	}
+
+	if d.reloadRequested() {
+		t.Errorf("expected no reload request")
+	}
+	c.instance.RequestReload()
+	if !d.reloadRequested() {
+		t.Errorf("expected a reload request")
+	}
+	if d.reloadRequested() {
+		t.Errorf("expected the reload request to be cleared")
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/dataplane"
 	hatypes "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/types"
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/utils"
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/types"
@@ -37,6 +38,10 @@ type dynUpdater struct {
 	cmd     func(socket string, observer func(duration time.Duration), commands ...string) ([]string, error)
 	cmdCnt  int
 	metrics types.Metrics
+	// dataplane collects server changes in servers instead of sending
+	// commands to the admin socket, see --apply-mode
+	dataplane bool
+	servers   []dataplane.ServerChange
 }
 
 type hostPair struct {
@@ -56,11 +61,12 @@ type epPair struct {
 
 func (i *instance) newDynUpdater() *dynUpdater {
 	return &dynUpdater{
-		logger:  i.logger,
-		config:  i.config.(*config),
-		socket:  i.config.Global().AdminSocket,
-		cmd:     utils.HAProxyCommand,
-		metrics: i.metrics,
+		logger:    i.logger,
+		config:    i.config.(*config),
+		socket:    i.config.Global().AdminSocket,
+		cmd:       utils.HAProxyCommand,
+		metrics:   i.metrics,
+		dataplane: i.remote != nil && i.options.ApplyMode == "dataplane",
 	}
 }
 
@@ -187,7 +193,7 @@ func (d *dynUpdater) checkHostPair(pair *hostPair) bool {
 
 	if curHost.TLS.HasTLS() && oldHost.TLS.TLSHash != curHost.TLS.TLSHash &&
 		oldHost.TLS.TLSFilename == curHost.TLS.TLSFilename &&
-		!d.execUpdateCert(curHost.Hostname, curHost.TLS.TLSFilename) {
+		!d.execUpdateCert("host", curHost.Hostname, curHost.TLS.TLSFilename) {
 		updated = false
 	}
 
@@ -204,17 +210,26 @@ func (d *dynUpdater) checkBackendPair(pair *backendPair) bool {
 	// if a reload fail
 	updated := true
 
-	// check equality of everything but endpoints
+	// check equality of everything but endpoints and client certificate
 	// TODO move this check to the backend type
 	oldBackCopy := *oldBack
 	oldBackCopy.ID = curBack.ID
 	oldBackCopy.Dynamic = curBack.Dynamic
 	oldBackCopy.Endpoints = curBack.Endpoints
+	oldBackCopy.Server.CrtHash = curBack.Server.CrtHash
 	if !reflect.DeepEqual(&oldBackCopy, curBack) {
 		d.logger.InfoV(2, "diff outside endpoints of backend '%s'", curBack.ID)
 		updated = false
 	}
 
+	// client certificate used to connect to the backend servers, the same
+	// filename is updated via runtime api
+	if curBack.Server.CrtFilename != "" && oldBack.Server.CrtHash != curBack.Server.CrtHash &&
+		oldBack.Server.CrtFilename == curBack.Server.CrtFilename &&
+		!d.execUpdateCert("backend", curBack.ID, curBack.Server.CrtFilename) {
+		updated = false
+	}
+
 	// can decrease endpoints, cannot increase
 	if len(oldBack.Endpoints) < len(curBack.Endpoints) {
 		d.logger.InfoV(2, "added endpoints on backend '%s'", curBack.ID)
@@ -363,11 +378,16 @@ func (d *dynUpdater) alignSlots() {
 
 var readFile func(filename string) ([]byte, error) = ioutil.ReadFile
 
-func (d *dynUpdater) execUpdateCert(hostname, filename string) bool {
+func (d *dynUpdater) execUpdateCert(kind, name, filename string) bool {
+	if d.dataplane {
+		// certificates are shipped to the remote instances on reload
+		d.logger.InfoV(2, "certificate of %s '%s' changed", kind, name)
+		return false
+	}
 	// TODO read from the internal storage
 	payload, err := readFile(filename)
 	if err != nil {
-		d.logger.Error("error reading certificate file for %s: %v", hostname, err)
+		d.logger.Error("error reading certificate file for %s: %v", name, err)
 		return false
 	}
 	// TODO removing an empty line between crt and key, runtime api didn't like it.
@@ -379,7 +399,7 @@ func (d *dynUpdater) execUpdateCert(hostname, filename string) bool {
 	}
 	msg, err := d.execCommand(d.metrics.HAProxySetSSLCertResponseTime, cmd)
 	if err != nil {
-		d.logger.Error("error updating certificate for %s: %v", hostname, err)
+		d.logger.Error("error updating certificate for %s: %v", name, err)
 		return false
 	}
 	for _, m := range msg {
@@ -389,14 +409,26 @@ func (d *dynUpdater) execUpdateCert(hostname, filename string) bool {
 		}
 	}
 	if strings.Index(msg[1], "Success") < 0 {
-		d.logger.Warn("cannot update certificate for %s", hostname)
+		d.logger.Warn("cannot update certificate for %s", name)
 		return false
 	}
-	d.logger.InfoV(2, "certificate updated for %s", hostname)
+	d.logger.InfoV(2, "certificate updated for %s", name)
 	return true
 }
 
 func (d *dynUpdater) execDisableEndpoint(backname string, ep *hatypes.Endpoint) bool {
+	if d.dataplane {
+		d.addServerChange(dataplane.ServerChange{
+			Backend:     backname,
+			Name:        ep.Name,
+			Address:     "127.0.0.1",
+			Port:        1023,
+			Weight:      0,
+			Maintenance: true,
+		})
+		d.logger.InfoV(2, "disabled endpoint '%s' on backend/server '%s/%s'", ep.Target, backname, ep.Name)
+		return true
+	}
 	server := fmt.Sprintf("set server %s/%s ", backname, ep.Name)
 	cmd := []string{
 		server + "state maint",
@@ -419,6 +451,19 @@ func (d *dynUpdater) execDisableEndpoint(backname string, ep *hatypes.Endpoint)
 
 func (d *dynUpdater) execEnableEndpoint(backname string, oldEP, curEP *hatypes.Endpoint) bool {
 	state := map[bool]string{true: "ready", false: "drain"}[curEP.Weight > 0]
+	event := map[bool]string{true: "updated", false: "added"}[oldEP != nil]
+	if d.dataplane {
+		d.addServerChange(dataplane.ServerChange{
+			Backend: backname,
+			Name:    curEP.Name,
+			Address: curEP.IP,
+			Port:    curEP.Port,
+			Weight:  curEP.Weight,
+		})
+		d.logger.InfoV(2, "%s endpoint '%s' weight '%d' on backend/server '%s/%s'",
+			event, curEP.Target, curEP.Weight, backname, curEP.Name)
+		return true
+	}
 	server := fmt.Sprintf("set server %s/%s ", backname, curEP.Name)
 	cmd := []string{
 		server + "addr " + curEP.IP + " port " + strconv.Itoa(curEP.Port),
@@ -430,7 +475,6 @@ func (d *dynUpdater) execEnableEndpoint(backname string, oldEP, curEP *hatypes.E
 		d.logger.Error("error adding/updating endpoint %s/%s: %v", backname, curEP.Name, err)
 		return false
 	}
-	event := map[bool]string{true: "updated", false: "added"}[oldEP != nil]
 	d.logger.InfoV(2, "%s endpoint '%s' weight '%d' state '%s' on backend/server '%s/%s'",
 		event, curEP.Target, curEP.Weight, state, backname, curEP.Name)
 	for _, m := range msg {
@@ -446,3 +490,8 @@ func (d *dynUpdater) execCommand(observer func(duration time.Duration), cmd []st
 	d.cmdCnt = d.cmdCnt + len(cmd)
 	return msg, err
 }
+
+func (d *dynUpdater) addServerChange(change dataplane.ServerChange) {
+	d.servers = append(d.servers, change)
+	d.cmdCnt++
+}
@@ -920,6 +920,52 @@ INFO-V(2) need to reload due to config changes: [hosts]
 			logging: `
 INFO-V(2) removed host 'domain2.local'
 INFO-V(2) need to reload due to config changes: [hosts]
+`,
+		},
+		// 33
+		{
+			doconfig1: func(c *testConfig) {
+				b := c.config.Backends().AcquireBackend("default", "app", "8080")
+				b.Server.CrtFilename = "/tmp/client.pem"
+				b.Server.CrtHash = "1"
+			},
+			doconfig2: func(c *testConfig) {
+				b := c.config.Backends().AcquireBackend("default", "app", "8080")
+				b.Server.CrtFilename = "/tmp/client.pem"
+				b.Server.CrtHash = "2"
+			},
+			dynamic: true,
+			cmd: `
+set ssl cert /tmp/client.pem <<
+<content>
+commit ssl cert /tmp/client.pem
+`,
+			cmdOutput: []string{
+				"Transaction created for certificate /tmp/client.pem!\n\n",
+				"Committing /tmp/client.pem.\nSuccess!\n\n",
+			},
+			logging: `
+INFO-V(2) response from server: Transaction created for certificate /tmp/client.pem!
+INFO-V(2) response from server: Committing /tmp/client.pem. \\ Success!
+INFO-V(2) certificate updated for default_app_8080
+`,
+		},
+		// 34
+		{
+			doconfig1: func(c *testConfig) {
+				b := c.config.Backends().AcquireBackend("default", "app", "8080")
+				b.Server.CrtFilename = "/tmp/client1.pem"
+				b.Server.CrtHash = "1"
+			},
+			doconfig2: func(c *testConfig) {
+				b := c.config.Backends().AcquireBackend("default", "app", "8080")
+				b.Server.CrtFilename = "/tmp/client2.pem"
+				b.Server.CrtHash = "2"
+			},
+			dynamic: false,
+			logging: `
+INFO-V(2) diff outside endpoints of backend 'default_app_8080'
+INFO-V(2) need to reload due to config changes: [backends]
 `,
 		},
 	}
@@ -974,3 +1020,101 @@ INFO-V(2) need to reload due to config changes: [hosts]
 		c.teardown()
 	}
 }
+
+func TestDynUpdateDataplane(t *testing.T) {
+	testCases := []struct {
+		doconfig1 func(c *testConfig)
+		doconfig2 func(c *testConfig)
+		dynamic   bool
+		servers   []string
+		logging   string
+	}{
+		// 0
+		{
+			doconfig1: func(c *testConfig) {
+				b := c.config.Backends().AcquireBackend("default", "app", "8080")
+				b.AcquireEndpoint("172.17.0.2", 8080, "")
+				b.AcquireEndpoint("172.17.0.3", 8080, "")
+				b.AddEmptyEndpoint()
+			},
+			doconfig2: func(c *testConfig) {
+				b := c.config.Backends().AcquireBackend("default", "app", "8080")
+				b.Dynamic.DynUpdate = true
+				b.AcquireEndpoint("172.17.0.2", 8080, "")
+			},
+			dynamic: true,
+			servers: []string{
+				"{default_app_8080 srv002 127.0.0.1 1023 0 true}",
+			},
+			logging: `INFO-V(2) disabled endpoint '172.17.0.3:8080' on backend/server 'default_app_8080/srv002'`,
+		},
+		// 1
+		{
+			doconfig1: func(c *testConfig) {
+				b := c.config.Backends().AcquireBackend("default", "app", "8080")
+				b.AcquireEndpoint("172.17.0.2", 8080, "")
+				b.AddEmptyEndpoint()
+			},
+			doconfig2: func(c *testConfig) {
+				b := c.config.Backends().AcquireBackend("default", "app", "8080")
+				b.Dynamic.DynUpdate = true
+				b.AcquireEndpoint("172.17.0.2", 8080, "")
+				b.AcquireEndpoint("172.17.0.3", 8080, "").Weight = 0
+			},
+			dynamic: true,
+			servers: []string{
+				"{default_app_8080 srv002 172.17.0.3 8080 0 false}",
+			},
+			logging: `INFO-V(2) added endpoint '172.17.0.3:8080' weight '0' on backend/server 'default_app_8080/srv002'`,
+		},
+		// 2
+		{
+			doconfig1: func(c *testConfig) {
+				h1 := c.config.Hosts().AcquireHost("domain1.local")
+				h1.TLS.TLSFilename = "/tmp/domain1.pem"
+				h1.TLS.TLSHash = "1"
+			},
+			doconfig2: func(c *testConfig) {
+				h1 := c.config.Hosts().AcquireHost("domain1.local")
+				h1.TLS.TLSFilename = "/tmp/domain1.pem"
+				h1.TLS.TLSHash = "2"
+			},
+			dynamic: false,
+			logging: `
+INFO-V(2) certificate of host 'domain1.local' changed
+INFO-V(2) need to reload due to config changes: [hosts]
+`,
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		if test.doconfig1 != nil {
+			test.doconfig1(c)
+		}
+		c.instance.config.Commit()
+		c.config.Hosts().RemoveAll([]string{"domain1.local"})
+		c.config.Backends().RemoveAll([]types.BackendID{{Namespace: "default", Name: "app", Port: "8080"}})
+		if test.doconfig2 != nil {
+			test.doconfig2(c)
+		}
+		dynUpdater := c.instance.newDynUpdater()
+		dynUpdater.dataplane = true
+		dynUpdater.cmd = func(socket string, observer func(duration time.Duration), command ...string) ([]string, error) {
+			t.Errorf("unexpected socket command on %d: %v", i, command)
+			return nil, nil
+		}
+		dynamic := dynUpdater.update()
+		if dynamic != test.dynamic {
+			t.Errorf("dynamic expected as '%t' on %d, but was '%t'", test.dynamic, i, dynamic)
+		}
+		var servers []string
+		for _, server := range dynUpdater.servers {
+			servers = append(servers, fmt.Sprint(server))
+		}
+		if !reflect.DeepEqual(servers, test.servers) {
+			t.Errorf("servers expected and actual differs on %d -- expected: %v -- actual: %v", i, test.servers, servers)
+		}
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
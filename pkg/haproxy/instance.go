@@ -18,12 +18,17 @@ package haproxy
 
 import (
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/acme"
@@ -38,15 +43,29 @@ import (
 type InstanceOptions struct {
 	AcmeSigner        acme.Signer
 	AcmeQueue         utils.Queue
+	ApplyMode         string
 	BackendShards     int
+	ControlOnly       bool
+	DataplaneURLs     []string
+	DataplaneStorage  string
+	Distribute        bool
 	HAProxyCfgDir     string
+	HAProxyFileDirs   []string
 	HAProxyMapsDir    string
+	HealthzReloadFail int
 	LeaderElector     types.LeaderElector
 	MaxOldConfigFiles int
 	Metrics           types.Metrics
 	ReloadStrategy    string
+	RenderWorkers     int
+	RollbackDir       string
+	RollbackFailures  int
+	RollbackNotify    func(message string)
+	SnapshotDir       string
 	SortEndpointsBy   string
 	StopCh            chan struct{}
+	TemplatesDir      string
+	UnhealthyWithdraw time.Duration
 	ValidateConfig    bool
 	// TODO Fake is used to skip real haproxy calls. Use a mock instead.
 	fake bool
@@ -56,32 +75,113 @@ type InstanceOptions struct {
 type Instance interface {
 	AcmeCheck(source string) (int, error)
 	ParseTemplates() error
+	OverrideTemplates(templates map[string]string) error
 	Config() Config
 	CalcIdleMetric()
-	Update(timer *utils.Timer)
+	CalcServersDownMetric()
+	CheckDrift() ([]Drift, error)
+	RequestReload()
+	ReadStats() ([]map[string]string, error)
+	CheckHealth() error
+	CheckReady() error
+	Drain(timeout time.Duration) error
+	ReadConfig() ([]byte, error)
+	RestoreSnapshot(start bool) error
+	DistributionHandler() http.Handler
+	Render() error
+	Update(timer *utils.Timer) UpdateStatus
+}
+
+// UpdateStatus is the outcome of an haproxy update: how the changes were
+// applied - noop, dynamic or full, and the reason if they couldn't be applied.
+type UpdateStatus struct {
+	Update  string
+	Failure string
 }
 
 // CreateInstance ...
 func CreateInstance(logger types.Logger, options InstanceOptions) Instance {
+	haproxyTmpl := template.CreateConfig()
+	mapsTmpl := template.CreateConfig()
+	modsecTmpl := template.CreateConfig()
+	spoeTmpl := template.CreateConfig()
+	if options.Metrics != nil {
+		haproxyTmpl.SetObserver(options.Metrics.TemplateProcTime)
+		modsecTmpl.SetObserver(options.Metrics.TemplateProcTime)
+		spoeTmpl.SetObserver(options.Metrics.TemplateProcTime)
+	}
+	haproxyTmpl.SetWorkers(options.RenderWorkers)
+	mapsTmpl.SetWorkers(options.RenderWorkers)
+	var snap, lastGood, pending *snapshot
+	if options.SnapshotDir != "" {
+		snap = newSnapshot(options.SnapshotDir, options.HAProxyFileDirs)
+	}
+	if options.RollbackFailures > 0 {
+		lastGood = newSnapshot(options.RollbackDir, options.HAProxyFileDirs)
+		pending = newSnapshot(filepath.Join(options.RollbackDir, "pending"), options.HAProxyFileDirs)
+	}
+	var r *remote
+	if len(options.DataplaneURLs) > 0 {
+		var err error
+		r, err = newRemote(options.DataplaneURLs, options.DataplaneStorage, options.HAProxyCfgDir, options.HAProxyFileDirs)
+		if err != nil {
+			logger.Fatal("error configuring remote haproxy instances: %v", err)
+		}
+	}
+	var dist *distribution
+	if options.Distribute {
+		dist = newDistribution(options.HAProxyFileDirs)
+	}
 	return &instance{
 		logger:      logger,
 		options:     &options,
-		haproxyTmpl: template.CreateConfig(),
-		mapsTmpl:    template.CreateConfig(),
-		modsecTmpl:  template.CreateConfig(),
+		haproxyTmpl: haproxyTmpl,
+		mapsTmpl:    mapsTmpl,
+		modsecTmpl:  modsecTmpl,
+		spoeTmpl:    spoeTmpl,
 		metrics:     options.Metrics,
+		snapshot:    snap,
+		lastGood:    lastGood,
+		pending:     pending,
+		remote:      r,
+		dist:        dist,
 	}
 }
 
 type instance struct {
-	up          bool
-	logger      types.Logger
-	options     *InstanceOptions
-	haproxyTmpl *template.Config
-	mapsTmpl    *template.Config
-	modsecTmpl  *template.Config
-	config      Config
-	metrics     types.Metrics
+	up           bool
+	logger       types.Logger
+	options      *InstanceOptions
+	haproxyTmpl  *template.Config
+	mapsTmpl     *template.Config
+	modsecTmpl   *template.Config
+	spoeTmpl     *template.Config
+	config       Config
+	metrics      types.Metrics
+	snapshot     *snapshot
+	lastGood     *snapshot
+	pending      *snapshot
+	remote       *remote
+	dist         *distribution
+	rollback     bool
+	restoredAt   time.Time
+	failedInputs []rollbackInput
+	health       instanceHealth
+	drift        driftState
+	// requested template overrides, and if they are in use
+	tmplOverride   map[string]string
+	tmplOverridden bool
+	tmplChanged    bool
+}
+
+type instanceHealth struct {
+	mutex       sync.Mutex
+	ready       bool
+	reloadFail  int
+	lastReload  time.Time
+	lastFailure string
+	// first check that found haproxy unhealthy or with a stale config
+	unhealthySince time.Time
 }
 
 func (i *instance) AcmeCheck(source string) (int, error) {
@@ -136,30 +236,112 @@ func (i *instance) acmeRemoveStorage(storage string) {
 }
 
 func (i *instance) ParseTemplates() error {
+	return i.parseTemplates(nil)
+}
+
+// OverrideTemplates replaces the built-in templates with the ones found in
+// templates, using the name of the template as the key, eg `haproxy.tmpl`.
+// An empty map restores the built-in templates. The built-in templates are
+// also used if any of the overrides fails to parse. The configuration is
+// rendered again and haproxy is reloaded in the next update.
+func (i *instance) OverrideTemplates(templates map[string]string) error {
+	if len(templates) == 0 {
+		templates = nil
+	}
+	if reflect.DeepEqual(templates, i.tmplOverride) {
+		return nil
+	}
+	i.tmplOverride = templates
+	i.tmplChanged = true
+	err := i.parseTemplates(templates)
+	if err == nil {
+		i.tmplOverridden = templates != nil
+		if i.tmplOverridden {
+			names := make([]string, 0, len(templates))
+			for name := range templates {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			i.logger.Info("using template overrides: %v", names)
+		}
+		return nil
+	}
+	i.tmplOverridden = false
+	if err := i.parseTemplates(nil); err != nil {
+		return err
+	}
+	return fmt.Errorf("ignoring template overrides, using the built-in templates: %w", err)
+}
+
+// writeTemplates calls write, which renders the templates, and calls it again
+// with the built-in templates if the overrides fail to render.
+func (i *instance) writeTemplates(write func() error) error {
+	err := write()
+	if err == nil || !i.tmplOverridden {
+		return err
+	}
+	i.logger.Error("error rendering the template overrides, using the built-in templates: %v", err)
+	i.tmplOverridden = false
+	if err := i.parseTemplates(nil); err != nil {
+		return err
+	}
+	return write()
+}
+
+func (i *instance) parseTemplates(override map[string]string) error {
+	for name := range override {
+		if name != "haproxy.tmpl" && name != "map.tmpl" && name != "modsecurity.tmpl" && name != "spoe.tmpl" {
+			return fmt.Errorf("unsupported template: %s", name)
+		}
+	}
 	i.haproxyTmpl.ClearTemplates()
 	i.mapsTmpl.ClearTemplates()
 	i.modsecTmpl.ClearTemplates()
-	if err := i.modsecTmpl.NewTemplate(
+	i.spoeTmpl.ClearTemplates()
+	templatesDir := i.options.TemplatesDir
+	if templatesDir == "" {
+		templatesDir = "/etc/templates"
+	}
+	newTemplate := func(tmpl *template.Config, name, file, output string, rotate, startingBufferSize int) error {
+		if text, found := override[name]; found {
+			return tmpl.NewTemplateText(name, text, output, rotate, startingBufferSize)
+		}
+		return tmpl.NewTemplate(name, filepath.Join(templatesDir, file), output, rotate, startingBufferSize)
+	}
+	if err := newTemplate(
+		i.modsecTmpl,
 		"modsecurity.tmpl",
-		"/etc/templates/modsecurity/modsecurity.tmpl",
-		"/etc/haproxy/spoe-modsecurity.conf",
+		"modsecurity/modsecurity.tmpl",
+		filepath.Join(i.options.HAProxyCfgDir, "spoe-modsecurity.conf"),
 		0,
 		1024,
 	); err != nil {
 		return err
 	}
-	if err := i.haproxyTmpl.NewTemplate(
+	if err := newTemplate(
+		i.spoeTmpl,
+		"spoe.tmpl",
+		"spoe/spoe.tmpl",
+		filepath.Join(i.options.HAProxyCfgDir, "spoe-agents.conf"),
+		0,
+		1024,
+	); err != nil {
+		return err
+	}
+	if err := newTemplate(
+		i.haproxyTmpl,
 		"haproxy.tmpl",
-		"/etc/templates/haproxy/haproxy.tmpl",
-		"/etc/haproxy/haproxy.cfg",
+		"haproxy/haproxy.tmpl",
+		filepath.Join(i.options.HAProxyCfgDir, "haproxy.cfg"),
 		i.options.MaxOldConfigFiles,
 		16384,
 	); err != nil {
 		return err
 	}
-	err := i.mapsTmpl.NewTemplate(
+	err := newTemplate(
+		i.mapsTmpl,
 		"map.tmpl",
-		"/etc/templates/map/map.tmpl",
+		"map/map.tmpl",
 		"",
 		0,
 		2048,
@@ -182,7 +364,7 @@ func (i *instance) Config() Config {
 var idleRegex = regexp.MustCompile(`Idle_pct: ([0-9]+)`)
 
 func (i *instance) CalcIdleMetric() {
-	if !i.up {
+	if !i.up || i.detached() {
 		return
 	}
 	msg, err := hautils.HAProxyCommand(i.config.Global().AdminSocket, i.metrics.HAProxyShowInfoResponseTime, "show info")
@@ -202,9 +384,258 @@ func (i *instance) CalcIdleMetric() {
 	i.metrics.AddIdleFactor(idle)
 }
 
-func (i *instance) Update(timer *utils.Timer) {
+func (i *instance) CalcServersDownMetric() {
+	if !i.up || i.detached() {
+		return
+	}
+	// -1 4 -1: all proxies, servers only
+	msg, err := hautils.HAProxyCommand(i.config.Global().AdminSocket, i.metrics.HAProxyShowStatResponseTime, "show stat -1 4 -1")
+	if err != nil {
+		i.logger.Error("error reading admin socket: %v", err)
+		return
+	}
+	stats, err := parseStats(msg[0])
+	if err != nil {
+		i.logger.Error("error parsing show stat output: %v", err)
+		return
+	}
+	i.metrics.ClearServersDown()
+	for backend, count := range countServersDown(stats) {
+		i.metrics.SetServersDown(backend, count)
+	}
+}
+
+// countServersDown returns, for every backend found in the parsed output
+// of a `show stat` command, the number of servers whose status is
+// currently DOWN.
+func countServersDown(stats []map[string]string) map[string]int {
+	serversDown := map[string]int{}
+	for _, stat := range stats {
+		pxname, svname := stat["pxname"], stat["svname"]
+		if pxname == "" || svname == "" || svname == "FRONTEND" || svname == "BACKEND" {
+			continue
+		}
+		count := serversDown[pxname]
+		// "DOWN" and also "DOWN 1/2" when the server is going up
+		if strings.HasPrefix(stat["status"], "DOWN") {
+			count++
+		}
+		serversDown[pxname] = count
+	}
+	return serversDown
+}
+
+func (i *instance) ReadStats() ([]map[string]string, error) {
+	if !i.up || i.detached() {
+		return nil, nil
+	}
+	msg, err := hautils.HAProxyCommand(i.config.Global().AdminSocket, i.metrics.HAProxyShowStatResponseTime, "show stat")
+	if err != nil {
+		return nil, err
+	}
+	return parseStats(msg[0])
+}
+
+// parseStats reads the CSV output of a `show stat` command and returns
+// one map per proxy or server, indexed by the field names of the header.
+func parseStats(stat string) ([]map[string]string, error) {
+	lines := strings.Split(stat, "\n")
+	if len(lines) == 0 || !strings.HasPrefix(lines[0], "# ") {
+		return nil, fmt.Errorf("missing show stat header")
+	}
+	header := strings.Split(strings.TrimPrefix(lines[0], "# "), ",")
+	var stats []map[string]string
+	for _, line := range lines[1:] {
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		stat := make(map[string]string, len(header))
+		for idx, name := range header {
+			if name != "" && idx < len(fields) {
+				stat[name] = fields[idx]
+			}
+		}
+		stats = append(stats, stat)
+	}
+	return stats, nil
+}
+
+func (h *instanceHealth) reloaded(err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if err != nil {
+		h.reloadFail++
+		h.lastFailure = err.Error()
+		return
+	}
+	h.ready = true
+	h.reloadFail = 0
+	h.lastReload = time.Now()
+}
+
+// CheckHealth fails if the number of consecutive failed reloads reaches
+// the configured threshold, or if haproxy has no running worker.
+func (i *instance) CheckHealth() error {
+	i.health.mutex.Lock()
+	ready := i.health.ready
+	reloadFail := i.health.reloadFail
+	lastReload := i.health.lastReload
+	lastFailure := i.health.lastFailure
+	i.health.mutex.Unlock()
+	threshold := i.options.HealthzReloadFail
+	if threshold > 0 && reloadFail >= threshold {
+		if lastReload.IsZero() {
+			return fmt.Errorf("%d consecutive failed reloads, haproxy was never reloaded: %s", reloadFail, lastFailure)
+		}
+		return fmt.Errorf("%d consecutive failed reloads, last successful reload at %s: %s",
+			reloadFail, lastReload.Format(time.RFC3339), lastFailure)
+	}
+	if !ready || i.options.fake || i.detached() {
+		// haproxy wasn't started yet, its workers are checked by the
+		// Data Plane API on every push, or by the replicas themselves
+		return nil
+	}
+	global := i.config.Global()
+	if global.External.IsExternal() {
+		procs, err := hautils.HAProxyCurrentProcs(global.External.MasterSocket)
+		if err != nil {
+			return fmt.Errorf("error reading procs from master socket: %w", err)
+		}
+		if len(procs.Workers) == 0 {
+			return fmt.Errorf("haproxy has no running worker")
+		}
+		return nil
+	}
+	if _, err := hautils.HAProxyCommand(global.AdminSocket, nil, "show info"); err != nil {
+		return fmt.Errorf("error reading admin socket: %w", err)
+	}
+	return nil
+}
+
+// CheckReady fails if haproxy wasn't successfully reloaded yet. If
+// UnhealthyWithdraw is configured, it also fails if haproxy is unhealthy or
+// its config is stale for longer than UnhealthyWithdraw, so the address of
+// this instance is withdrawn from services and ingress status.
+func (i *instance) CheckReady() error {
+	i.health.mutex.Lock()
+	ready := i.health.ready
+	i.health.mutex.Unlock()
+	if !ready {
+		return fmt.Errorf("haproxy wasn't successfully reloaded yet")
+	}
+	if i.options.UnhealthyWithdraw > 0 {
+		return i.checkWithdraw()
+	}
+	return nil
+}
+
+func (i *instance) checkWithdraw() error {
+	err := i.CheckHealth()
+	i.health.mutex.Lock()
+	defer i.health.mutex.Unlock()
+	if err == nil && i.health.reloadFail > 0 {
+		// the last changes couldn't be applied, haproxy is running an outdated config
+		err = fmt.Errorf("haproxy config is stale, %d consecutive failed reloads: %s", i.health.reloadFail, i.health.lastFailure)
+	}
+	if err == nil {
+		i.health.unhealthySince = time.Time{}
+		return nil
+	}
+	now := time.Now()
+	if i.health.unhealthySince.IsZero() {
+		i.health.unhealthySince = now
+	}
+	if unhealthy := now.Sub(i.health.unhealthySince); unhealthy >= i.options.UnhealthyWithdraw {
+		return fmt.Errorf("withdrawing address, unhealthy for %s: %w", unhealthy.Round(time.Second), err)
+	}
+	return nil
+}
+
+var currConnsRegex = regexp.MustCompile(`CurrConns: ([0-9]+)`)
+
+// Drain stops all the frontends from accepting new connections, and waits
+// up to timeout for the active connections to finish.
+func (i *instance) Drain(timeout time.Duration) error {
+	if !i.up || i.detached() {
+		// remote instances and replicas aren't stopped along with the controller
+		return nil
+	}
+	socket := i.config.Global().AdminSocket
+	// -1 1 -1: all proxies, frontends only
+	msg, err := hautils.HAProxyCommand(socket, nil, "show stat -1 1 -1")
+	if err != nil {
+		return err
+	}
+	stats, err := parseStats(msg[0])
+	if err != nil {
+		return err
+	}
+	cmds := buildDisableFrontends(stats)
+	if _, err := hautils.HAProxyCommand(socket, nil, cmds...); err != nil {
+		return err
+	}
+	i.logger.Info("disabled %d frontend(s), waiting up to %s for the active connections", len(cmds), timeout)
+	deadline := time.Now().Add(timeout)
+	for {
+		msg, err := hautils.HAProxyCommand(socket, nil, "show info")
+		if err != nil {
+			return err
+		}
+		connsStr := currConnsRegex.FindStringSubmatch(msg[0])
+		if len(connsStr) < 2 {
+			return fmt.Errorf("cannot find CurrConns field in the show info socket command")
+		}
+		// the connection of the show info command is also counted
+		conns, _ := strconv.Atoi(connsStr[1])
+		if conns <= 1 {
+			i.logger.Info("all the active connections finished")
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout waiting for %d active connection(s)", conns-1)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// buildDisableFrontends builds the commands that stop the frontends
+// found in the parsed output of a `show stat` command.
+func buildDisableFrontends(stats []map[string]string) []string {
+	var cmds []string
+	for _, stat := range stats {
+		if stat["svname"] == "FRONTEND" {
+			cmds = append(cmds, "disable frontend "+stat["pxname"])
+		}
+	}
+	return cmds
+}
+
+func (i *instance) Update(timer *utils.Timer) UpdateStatus {
 	i.acmeUpdate()
-	i.haproxyUpdate(timer)
+	if i.options.ControlOnly {
+		return i.controlUpdate()
+	}
+	status := i.haproxyUpdate(timer)
+	if i.config != nil {
+		i.drift.update(i.config, i.up)
+	}
+	return status
+}
+
+// controlUpdate commits the current state without configuring haproxy.
+// Used by controller instances that only do the leader-only work, which
+// still need the parsed configuration, eg the acme data.
+func (i *instance) controlUpdate() UpdateStatus {
+	if i.config == nil {
+		return UpdateStatus{}
+	}
+	defer i.config.Commit()
+	i.config.SyncConfig()
+	i.up = true
+	i.metrics.IncUpdateNoop()
+	i.metrics.UpdateApplied()
+	return UpdateStatus{Update: "noop"}
 }
 
 func (i *instance) acmeUpdate() {
@@ -229,29 +660,45 @@ func (i *instance) acmeUpdate() {
 	}
 }
 
-func (i *instance) haproxyUpdate(timer *utils.Timer) {
+func (i *instance) haproxyUpdate(timer *utils.Timer) UpdateStatus {
 	// nil config, just ignore
 	if i.config == nil {
-		return
+		return UpdateStatus{}
 	}
 	//
 	// this should be taken into account when refactoring this func:
 	//   - dynUpdater might change config state, so it should be called before templates.Write()
 	//   - i.metrics.IncUpdate<Status>() should be called always, but only once
 	//   - i.metrics.UpdateSuccessful(<bool>) should be called only if haproxy is reloaded or cfg is validated
+	//   - i.metrics.IncUpdateFailure(<reason>) should be called whenever the changes cannot be applied
+	//   - i.metrics.UpdateApplied() should be called only if the changes were successfully applied
 	//
 	defer i.config.Commit()
 	i.config.SyncConfig()
 	i.config.Shrink()
-	if err := i.config.WriteFrontendMaps(); err != nil {
+	if err := i.writeTemplates(i.config.WriteFrontendMaps); err != nil {
 		i.logger.Error("error building frontend maps: %v", err)
 		i.metrics.IncUpdateNoop()
-		return
+		i.metrics.IncUpdateFailure("maps")
+		return UpdateStatus{Update: "noop", Failure: "maps"}
 	}
-	if err := i.config.WriteBackendMaps(); err != nil {
+	if err := i.writeTemplates(i.config.WriteBackendMaps); err != nil {
 		i.logger.Error("error building backend maps: %v", err)
 		i.metrics.IncUpdateNoop()
-		return
+		i.metrics.IncUpdateFailure("maps")
+		return UpdateStatus{Update: "noop", Failure: "maps"}
+	}
+	if err := i.config.WriteErrorPages(); err != nil {
+		i.logger.Error("error writing error pages: %v", err)
+		i.metrics.IncUpdateNoop()
+		i.metrics.IncUpdateFailure("error_pages")
+		return UpdateStatus{Update: "noop", Failure: "error_pages"}
+	}
+	if err := i.config.WriteBotMitigation(); err != nil {
+		i.logger.Error("error writing bot mitigation lists: %v", err)
+		i.metrics.IncUpdateNoop()
+		i.metrics.IncUpdateFailure("bot_mitigation")
+		return UpdateStatus{Update: "noop", Failure: "bot_mitigation"}
 	}
 	timer.Tick("write_maps")
 	if !i.options.fake {
@@ -259,7 +706,25 @@ func (i *instance) haproxyUpdate(timer *utils.Timer) {
 		i.logChanged()
 	}
 	updater := i.newDynUpdater()
-	updated := updater.update()
+	var updated bool
+	if i.drift.reloadRequested() || i.rollback || i.tmplChanged || (i.detached() && !updater.dataplane) {
+		// a reload was requested to reconcile a drifted instance, or
+		// haproxy is running a rolled back configuration, or a remote
+		// one which has no admin socket reachable by the controller,
+		// or the templates changed, the committed state cannot be
+		// dynamically updated
+		updater.alignSlots()
+	} else {
+		updated = updater.update()
+	}
+	if updated && len(updater.servers) > 0 && !i.options.fake {
+		if err := i.remote.applyServers(updater.servers); err != nil {
+			i.logger.Warn("error applying changes via data plane api, pushing the whole configuration:\n%v", err)
+			updater.alignSlots()
+			updated = false
+		}
+		timer.Tick("apply_dataplane")
+	}
 	if i.options.SortEndpointsBy != "random" {
 		i.config.Backends().SortChangedEndpoints(i.options.SortEndpointsBy)
 	} else if !updated {
@@ -271,48 +736,200 @@ func (i *instance) haproxyUpdate(timer *utils.Timer) {
 		// only need to rewrtite config files if:
 		//   - !updated           - there are changes that cannot be dynamically applied
 		//   - updater.cmdCnt > 0 - there are changes that was dynamically applied
-		err := i.writeConfig()
+		err := i.writeTemplates(i.writeConfig)
 		timer.Tick("write_config")
 		if err != nil {
 			i.logger.Error("error writing configuration: %v", err)
 			i.metrics.IncUpdateNoop()
-			return
+			i.metrics.IncUpdateFailure("config")
+			return UpdateStatus{Update: "noop", Failure: "config"}
 		}
+		i.tmplChanged = false
 	}
 	i.updateCertExpiring()
 	if updated {
+		status := UpdateStatus{Update: "noop"}
 		if updater.cmdCnt > 0 {
+			status.Update = "dynamic"
 			if i.options.ValidateConfig {
 				var err error
 				if err = i.check(); err != nil {
 					i.logger.Error("error validating config file:\n%v", err)
+					i.metrics.IncUpdateFailure("validate")
+					status.Failure = "validate"
 				}
 				timer.Tick("validate_cfg")
 				i.metrics.UpdateSuccessful(err == nil)
+				if err == nil {
+					i.metrics.UpdateApplied()
+				}
+			} else {
+				i.metrics.UpdateApplied()
 			}
 			i.logger.Info("haproxy updated without needing to reload. Commands sent: %d", updater.cmdCnt)
 			i.metrics.IncUpdateDynamic()
+			i.saveSnapshot()
+			i.rollbackSaveGood()
 		} else {
 			i.logger.Info("old and new configurations match")
 			i.metrics.IncUpdateNoop()
+			i.metrics.UpdateApplied()
 		}
-		return
+		return status
+	}
+	if i.rollbackBlocked() {
+		i.metrics.IncUpdateNoop()
+		return UpdateStatus{Update: "noop"}
 	}
 	i.metrics.IncUpdateFull()
 	if err := i.reload(); err != nil {
 		i.logger.Error("error reloading server:\n%v", err)
 		i.metrics.UpdateSuccessful(false)
+		i.metrics.IncUpdateFailure("reload")
+		i.health.reloaded(err)
+		i.rollbackFailed(err)
 		timer.Tick("reload_haproxy")
-		return
+		return UpdateStatus{Update: "full", Failure: "reload"}
 	}
 	i.up = true
+	i.health.reloaded(nil)
 	i.metrics.UpdateSuccessful(true)
-	if i.config.Global().External.IsExternal() {
+	i.metrics.UpdateApplied()
+	if i.dist != nil {
+		i.logger.Info("haproxy configuration successfully published (distribution)")
+	} else if i.remote != nil {
+		i.logger.Info("haproxy successfully reloaded (remote)")
+	} else if i.config.Global().External.IsExternal() {
 		i.logger.Info("haproxy successfully reloaded (external)")
 	} else {
 		i.logger.Info("haproxy successfully reloaded (embedded)")
 	}
 	timer.Tick("reload_haproxy")
+	i.saveSnapshot()
+	i.rollbackSaveGood()
+	timer.Tick("save_snapshot")
+	return UpdateStatus{Update: "full"}
+}
+
+// Render writes the maps and the configuration files of the current state
+// without applying them to haproxy. Used to render the configuration of
+// a set of resources offline, see the render subcommand.
+func (i *instance) Render() error {
+	if i.config == nil {
+		return nil
+	}
+	defer i.config.Commit()
+	i.config.SyncConfig()
+	i.config.Shrink()
+	if err := i.writeTemplates(i.config.WriteFrontendMaps); err != nil {
+		return fmt.Errorf("error building frontend maps: %w", err)
+	}
+	if err := i.writeTemplates(i.config.WriteBackendMaps); err != nil {
+		return fmt.Errorf("error building backend maps: %w", err)
+	}
+	if err := i.config.WriteErrorPages(); err != nil {
+		return fmt.Errorf("error writing error pages: %w", err)
+	}
+	if err := i.config.WriteBotMitigation(); err != nil {
+		return fmt.Errorf("error writing bot mitigation lists: %w", err)
+	}
+	i.config.Backends().SortChangedEndpoints(i.options.SortEndpointsBy)
+	if err := i.writeTemplates(i.writeConfig); err != nil {
+		return fmt.Errorf("error writing configuration: %w", err)
+	}
+	return nil
+}
+
+// RestoreSnapshot copies the files of the last applied configuration back
+// to their original location, and starts the embedded haproxy if start is
+// true. Used on startup to start proxying requests before the informers
+// finish to sync. The next update reloads haproxy with the current state
+// of the cluster.
+func (i *instance) RestoreSnapshot(start bool) error {
+	if i.snapshot == nil {
+		return nil
+	}
+	restored, err := i.snapshot.restore(false)
+	if os.IsNotExist(err) {
+		i.logger.Info("configuration snapshot not found, waiting the first sync to start haproxy")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	i.logger.Info("restored %d file(s) from the snapshot of the last applied configuration", restored)
+	if i.dist != nil && !i.options.fake {
+		// replicas can start with the last applied configuration as well
+		return i.publish()
+	}
+	if !start || i.options.fake {
+		return nil
+	}
+	return i.reloadEmbedded()
+}
+
+// ReadConfig returns the configuration files of the haproxy instance,
+// concatenated in the same order haproxy reads them from HAProxyCfgDir:
+// the main haproxy.cfg followed by the backend shards, if configured.
+func (i *instance) ReadConfig() ([]byte, error) {
+	files, err := filepath.Glob(filepath.Join(i.options.HAProxyCfgDir, "*.cfg"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no configuration file found in %s", i.options.HAProxyCfgDir)
+	}
+	sort.Strings(files)
+	var cfg []byte
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		cfg = append(cfg, content...)
+	}
+	return cfg, nil
+}
+
+// DistributionHandler returns the handler of the distribution api, or nil
+// if the configuration is not distributed to haproxy replicas.
+func (i *instance) DistributionHandler() http.Handler {
+	if i.dist == nil {
+		return nil
+	}
+	return i.dist
+}
+
+func (i *instance) publish() error {
+	changed, err := i.dist.publish()
+	if err != nil {
+		return err
+	}
+	if changed {
+		i.logger.InfoV(2, "published version %d of the configuration files", i.dist.version)
+	}
+	return nil
+}
+
+// detached returns true if haproxy doesn't run along with the controller:
+// either remote instances managed via the Data Plane API, or replicas that
+// read the configuration files from the distribution api.
+func (i *instance) detached() bool {
+	return i.remote != nil || i.dist != nil
+}
+
+func (i *instance) saveSnapshot() {
+	if i.snapshot == nil || i.options.fake {
+		return
+	}
+	changed, err := i.snapshot.save()
+	if err != nil {
+		i.logger.Error("error saving configuration snapshot: %v", err)
+		return
+	}
+	if changed > 0 {
+		i.logger.InfoV(2, "updated %d file(s) of the configuration snapshot", changed)
+	}
 }
 
 func (i *instance) logChanged() {
@@ -361,6 +978,13 @@ func (i *instance) writeConfig() (err error) {
 		return err
 	}
 	//
+	// spoe agents template execution
+	//
+	err = i.spoeTmpl.Write(i.config)
+	if err != nil {
+		return err
+	}
+	//
 	// haproxy template execution
 	//
 	//   a single template is used to generate all haproxy cfg files
@@ -381,19 +1005,31 @@ func (i *instance) writeConfig() (err error) {
 	// backend shards -- fills the .Global and .Backends attributes
 	if i.options.BackendShards > 0 {
 		shards := i.config.Backends().ChangedShards()
+		if i.rollback || i.tmplChanged {
+			// files of the unchanged shards might have been restored from a rollback,
+			// or rendered by distinct templates
+			shards = make([]int, i.options.BackendShards)
+			for j := range shards {
+				shards[j] = j
+			}
+		}
 		if len(shards) > 0 {
 			strshards := make([]string, len(shards))
+			outputs := make([]template.Output, len(shards))
 			for n, j := range shards {
 				str := fmt.Sprintf("%03d", j)
-				configFile := filepath.Join(i.options.HAProxyCfgDir, "haproxy5-backend"+str+".cfg")
-				if err = i.haproxyTmpl.WriteOutput(datatype{
-					Global:   i.config.Global(),
-					Backends: i.config.Backends().BuildSortedShard(j),
-				}, configFile); err != nil {
-					return err
+				outputs[n] = template.Output{
+					Data: datatype{
+						Global:   i.config.Global(),
+						Backends: i.config.Backends().BuildSortedShard(j),
+					},
+					Filename: filepath.Join(i.options.HAProxyCfgDir, "haproxy5-backend"+str+".cfg"),
 				}
 				strshards[n] = str
 			}
+			if err = i.haproxyTmpl.WriteOutputs(outputs); err != nil {
+				return err
+			}
 			i.logger.InfoV(2, "updated main cfg and %d backend file(s): %v", len(strshards), strshards)
 		}
 	}
@@ -432,6 +1068,9 @@ func (i *instance) check() error {
 		i.logger.Info("(test) check was skipped")
 		return nil
 	}
+	if i.remote != nil {
+		return i.remote.push(true)
+	}
 	if i.config.Global().External.IsExternal() {
 		// TODO check config on remote haproxy
 	} else {
@@ -450,6 +1089,12 @@ func (i *instance) reload() error {
 		i.logger.Info("(test) reload was skipped")
 		return nil
 	}
+	if i.remote != nil {
+		return i.remote.push(false)
+	}
+	if i.dist != nil {
+		return i.publish()
+	}
 	if i.config.Global().External.IsExternal() {
 		return i.reloadExternal()
 	}
@@ -464,10 +1109,14 @@ func (i *instance) reloadEmbedded() error {
 	// TODO Move all magic strings to a single place
 	out, err := exec.Command("/haproxy-reload.sh", i.options.ReloadStrategy, i.options.HAProxyCfgDir, state).CombinedOutput()
 	outstr := string(out)
+	if err != nil {
+		// the output has the lines and files that haproxy failed to load, see rollbackFailingInputs()
+		return fmt.Errorf("%v\n%s", err, outstr)
+	}
 	if len(outstr) > 0 {
 		i.logger.Warn("output from haproxy:\n%v", outstr)
 	}
-	return err
+	return nil
 }
 
 func (i *instance) reloadExternal() error {
@@ -24,6 +24,7 @@ import (
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/kylelemons/godebug/diff"
 	yaml "gopkg.in/yaml.v2"
@@ -90,10 +91,28 @@ func TestBackends(t *testing.T) {
 				b.Cookie.Name = "Ingress"
 				b.Cookie.Strategy = "insert"
 				b.Cookie.Keywords = "indirect nocache httponly"
-				b.Cookie.SameSite = true
+				b.Cookie.SameSite = "None"
+				b.Cookie.Secure = true
 			},
 			expected: `
     cookie Ingress insert attr SameSite=None secure indirect nocache httponly`,
+		},
+		{
+			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
+				b.Cookie.Name = "Ingress"
+				b.Cookie.Strategy = "insert"
+				b.Cookie.Keywords = "indirect nocache"
+				b.Cookie.SameSite = "Strict"
+				b.Cookie.Secure = true
+				b.Cookie.HTTPOnly = true
+				b.Cookie.MaxAge = 3600
+				b.Cookie.Domain = ".d1.local"
+				b.Cookie.Dynamic = true
+				b.Cookie.DynamicKey = "s3cr3t"
+			},
+			expected: `
+    cookie Ingress insert attr SameSite=Strict secure httponly attr Max-Age=3600 indirect nocache domain .d1.local dynamic
+    dynamic-cookie-key "s3cr3t"`,
 		},
 		{
 			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
@@ -181,6 +200,41 @@ d1.local#/path path02
 d1.local#/ path01`,
 			},
 		},
+		{
+			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
+				b.FindBackendPath(h.FindPath("/").Link).SecurityHeaders = hatypes.SecurityHeaders{
+					ContentSecurityPolicy: "default-src 'self'",
+					FrameOptions:          "DENY",
+					ReferrerPolicy:        "no-referrer",
+				}
+				b.FindBackendPath(h.FindPath("/app").Link).SecurityHeaders = hatypes.SecurityHeaders{
+					FrameOptions: "SAMEORIGIN",
+				}
+			},
+			path: []string{"/", "/app"},
+			expected: `
+    # path01 = d1.local/
+    # path02 = d1.local/app
+    http-request set-var(txn.pathID) var(req.base),lower,map_beg(/etc/haproxy/maps/_back_d1_app_8080_idpath__begin.map)
+    http-response set-header X-Frame-Options "DENY" if { var(txn.pathID) path01 }
+    http-response set-header Content-Security-Policy "default-src 'self'" if { var(txn.pathID) path01 }
+    http-response set-header Referrer-Policy "no-referrer" if { var(txn.pathID) path01 }
+    http-response set-header X-Frame-Options "SAMEORIGIN" if { var(txn.pathID) path02 }`,
+			expCheck: map[string]string{
+				"_back_d1_app_8080_idpath__begin.map": `
+d1.local#/app path02
+d1.local#/ path01`,
+			},
+		},
+		{
+			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
+				b.FindBackendPath(h.FindPath("/").Link).SecurityHeaders = hatypes.SecurityHeaders{
+					ReferrerPolicy: "same-origin",
+				}
+			},
+			expected: `
+    http-response set-header Referrer-Policy "same-origin"`,
+		},
 		{
 			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
 				g.ForwardFor = "add"
@@ -238,6 +292,24 @@ d1.local#/path2 path02
 d1.local#/path1 path01`,
 			},
 		},
+		{
+			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
+				path := b.FindBackendPath(h.FindPath("/app").Link)
+				path.RewriteURL = "/"
+				path.RewriteResponse = []*hatypes.RewriteHeader{
+					{Name: "Location", Regex: `^(https?://d1\.local(:[0-9]+)?)?(/.*)?$`, Replace: `\1/app\3`},
+					{Name: "Set-Cookie", Regex: `^(.*;\s*[Pp]ath=)(/[^;]*)?(;.*)?$`, Replace: `\1/app\2\3`},
+				}
+			},
+			path: []string{"/app", "/path"},
+			expected: `
+    # path01 = d1.local/app
+    # path02 = d1.local/path
+    http-request set-var(txn.pathID) var(req.base),lower,map_beg(/etc/haproxy/maps/_back_d1_app_8080_idpath__begin.map)
+    http-request replace-path ^/app/?(.*)$     /\1     if { var(txn.pathID) path01 }
+    http-response replace-header Location ^(https?://d1\.local(:[0-9]+)?)?(/.*)?$ \1/app\3 if { var(txn.pathID) path01 }
+    http-response replace-header Set-Cookie ^(.*;\s*[Pp]ath=)(/[^;]*)?(;.*)?$ \1/app\2\3 if { var(txn.pathID) path01 }`,
+		},
 		{
 			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
 				b.FindBackendPath(h.FindPath("/app").Link).SSLRedirect = true
@@ -262,6 +334,15 @@ d1.local#/path1 path01`,
     # path02 = d1.local/path
     http-request set-var(txn.pathID) var(req.base),lower,map_beg(/etc/haproxy/maps/_back_d1_app_8080_idpath__begin.map)
     http-request redirect scheme https code 301 if !https-request { var(txn.pathID) path01 }`,
+		},
+		{
+			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
+				b.FindBackendPath(h.FindPath("/").Link).SSLRedirect = true
+				b.SSLRedirectExceptions = []string{"/healthz", "/.well-known/acme-challenge/"}
+			},
+			expected: `
+    acl https-request ssl_fc
+    http-request redirect scheme https if !https-request !{ path_beg /healthz /.well-known/acme-challenge/ }`,
 		},
 		{
 			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
@@ -448,6 +529,17 @@ d1.local#/api path02`,
 			},
 			path: []string{"/", "/app"},
 			expected: `
+    http-request use-service lua.send-413 if { req.body_size,sub(1024) gt 0 }`,
+		},
+		{
+			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
+				b.BufferRequest = true
+				b.MaxHeaderSize = 8192
+				b.FindBackendPath(h.FindPath("/").Link).MaxBodySize = 1024
+			},
+			expected: `
+    option http-buffer-request
+    http-request deny deny_status 400 if { req.hdrs_len gt 8192 }
     http-request use-service lua.send-413 if { req.body_size,sub(1024) gt 0 }`,
 		},
 		{
@@ -463,6 +555,40 @@ d1.local#/api path02`,
 			expCheck: map[string]string{
 				"_back_d1_app_8080_idpath__begin.map": `
 d1.local#/app path02
+d1.local#/ path01`,
+			},
+		},
+		{
+			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
+				b.FindBackendPath(h.FindPath("/").Link).AccessLog.Disabled = true
+			},
+			expected: `
+    http-request set-log-level silent`,
+		},
+		{
+			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
+				b.FindBackendPath(h.FindPath("/").Link).AccessLog.SampleThreshold = 2500
+			},
+			expected: `
+    http-request set-log-level silent if { rand(10000) ge 2500 }`,
+		},
+		{
+			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
+				b.FindBackendPath(h.FindPath("/app").Link).AccessLog.Disabled = true
+				b.FindBackendPath(h.FindPath("/sub").Link).AccessLog.SampleThreshold = 100
+			},
+			path: []string{"/", "/app", "/sub"},
+			expected: `
+    # path01 = d1.local/
+    # path02 = d1.local/app
+    # path03 = d1.local/sub
+    http-request set-var(txn.pathID) var(req.base),lower,map_beg(/etc/haproxy/maps/_back_d1_app_8080_idpath__begin.map)
+    http-request set-log-level silent if { var(txn.pathID) path02 }
+    http-request set-log-level silent if { var(txn.pathID) path03 } { rand(10000) ge 100 }`,
+			expCheck: map[string]string{
+				"_back_d1_app_8080_idpath__begin.map": `
+d1.local#/sub path03
+d1.local#/app path02
 d1.local#/ path01`,
 			},
 		},
@@ -534,6 +660,67 @@ d1.local#/ path01`,
     option httpchk /check`,
 			srvsuffix: "check port 4000",
 		},
+		{
+			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
+				b.Tracing = hatypes.TracingConfig{
+					Mode:      "headers",
+					HeaderB3:  true,
+					HeaderW3C: true,
+				}
+			},
+			expected: `
+    http-request set-var(txn.trace_id) uuid,regsub(-,,g)
+    http-request set-var(txn.span_id) uuid,regsub(-,,g),bytes(0,16)
+    http-request set-header traceparent 00-%[var(txn.trace_id)]-%[var(txn.span_id)]-01 unless { req.hdr(traceparent) -m found }
+    http-request set-header X-B3-TraceId %[var(txn.trace_id)] unless { req.hdr(x-b3-traceid) -m found }
+    http-request set-header X-B3-SpanId %[var(txn.span_id)] unless { req.hdr(x-b3-traceid) -m found }
+    http-request set-header X-B3-Sampled 1 unless { req.hdr(x-b3-traceid) -m found }`,
+		},
+		{
+			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
+				b.Tracing = hatypes.TracingConfig{
+					Mode:         "opentracing",
+					OTConfigFile: "/etc/haproxy/ot.cfg",
+					OTID:         "ot-ingress",
+				}
+			},
+			expected: `
+    filter opentracing id ot-ingress config /etc/haproxy/ot.cfg`,
+		},
+		{
+			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
+				b.HealthCheck.URI = "/health"
+				b.HealthCheck.Method = "HEAD"
+				b.HealthCheck.ExpectStatus = "200,300-399"
+			},
+			expected: `
+    option httpchk HEAD /health
+    http-check expect status 200,300-399`,
+		},
+		{
+			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
+				b.HealthCheck.URI = "/health"
+				b.HealthCheck.ExpectString = `"status: up"`
+			},
+			expected: `
+    option httpchk /health
+    http-check expect string "status: up"`,
+		},
+		{
+			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
+				b.HealthCheck.Interval = "2s"
+				b.HealthCheck.Observe = "layer7"
+				b.HealthCheck.ErrorLimit = 5
+				b.HealthCheck.OnError = "mark-down"
+			},
+			srvsuffix: "check inter 2s observe layer7 error-limit 5 on-error mark-down",
+		},
+		{
+			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
+				b.HealthCheck.Observe = "layer4"
+			},
+			srvsuffix: "check observe layer4",
+		},
 		{
 			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
 				b.AgentCheck.Port = 8000
@@ -541,6 +728,73 @@ d1.local#/ path01`,
 			},
 			srvsuffix: "agent-check agent-port 8000 agent-inter 2s",
 		},
+		{
+			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
+				b.Timeout.Connect = "2s"
+				b.Retry.Retries = "5"
+				b.Retry.RetryOn = "conn-failure 503"
+				b.Retry.Redispatch = true
+				b.Retry.RedispatchOverride = true
+			},
+			expected: `
+    timeout connect 2s
+    retries 5
+    retry-on conn-failure 503
+    option redispatch`,
+		},
+		{
+			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
+				b.Retry.Retries = "0"
+				b.Retry.RedispatchOverride = true
+			},
+			expected: `
+    retries 0
+    no option redispatch`,
+		},
+		{
+			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
+				b.Source.Address = "10.0.0.10"
+			},
+			expected: `
+    source 10.0.0.10`,
+		},
+		{
+			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
+				b.Retry.Redispatch = true
+				b.Retry.RedispatchOverride = true
+				b.Source.Address = "0.0.0.0"
+				b.Source.Interface = "eth1"
+			},
+			expected: `
+    option redispatch
+    source 0.0.0.0 interface eth1`,
+		},
+		{
+			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
+				b.Timeout.Tunnel = "1h"
+				b.WebSocket = true
+			},
+			expected: `
+    timeout tunnel 1h
+    no option http-server-close`,
+		},
+		{
+			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
+				b.AuthPassthrough = true
+			},
+			expected: `
+    no option http-server-close
+    http-reuse never
+    option prefer-last-server`,
+		},
+		{
+			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
+				b.Server.MaxConn = 100
+				b.Server.MaxQueue = 50
+				b.Server.MinConn = 10
+			},
+			srvsuffix: "minconn 10 maxconn 100 maxqueue 50",
+		},
 		{
 			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
 				b.Server.Secure = true
@@ -635,6 +889,9 @@ d1.local#/ path01`,
 				b.Limit.Connections = 200
 				b.Limit.RPS = 20
 				b.Limit.Whitelist = []string{"192.168.0.0/16", "10.1.1.101"}
+				b.Limit.Key = "src"
+				b.Limit.TableSize = "200k"
+				b.Limit.TableExpire = "5m"
 			},
 			expected: `
     stick-table type ip size 200k expire 5m store conn_cur,conn_rate(1s)
@@ -646,6 +903,9 @@ d1.local#/ path01`,
 		{
 			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
 				b.Limit.RPS = 20
+				b.Limit.Key = "src"
+				b.Limit.TableSize = "200k"
+				b.Limit.TableExpire = "5m"
 			},
 			expected: `
     stick-table type ip size 200k expire 5m store conn_cur,conn_rate(1s)
@@ -655,11 +915,27 @@ d1.local#/ path01`,
 		{
 			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
 				b.Limit.Connections = 200
+				b.Limit.Key = "src"
+				b.Limit.TableSize = "200k"
+				b.Limit.TableExpire = "5m"
 			},
 			expected: `
     stick-table type ip size 200k expire 5m store conn_cur,conn_rate(1s)
     http-request track-sc1 src
     http-request deny deny_status 429 if { sc1_conn_cur gt 200 }`,
+		},
+		{
+			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
+				b.Limit.Connections = 10
+				b.Limit.ConnectionsQueue = true
+				b.Limit.Key = "req.hdr(X-Api-Key)"
+				b.Limit.TableSize = "1m"
+				b.Limit.TableExpire = "1h"
+			},
+			expected: `
+    stick-table type string len 64 size 1m expire 1h store conn_cur,conn_rate(1s)
+    http-request track-sc1 req.hdr(X-Api-Key)
+    http-request set-priority-class int(1) if { sc1_conn_cur gt 10 }`,
 		},
 		{
 			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
@@ -667,6 +943,9 @@ d1.local#/ path01`,
 				b.Limit.Connections = 200
 				b.Limit.RPS = 20
 				b.Limit.Whitelist = []string{"192.168.0.0/16", "10.1.1.101"}
+				b.Limit.Key = "src"
+				b.Limit.TableSize = "200k"
+				b.Limit.TableExpire = "5m"
 			},
 			expected: `
     stick-table type ip size 200k expire 5m store conn_cur,conn_rate(1s)
@@ -674,6 +953,20 @@ d1.local#/ path01`,
     acl wlist_conn src 192.168.0.0/16 10.1.1.101
     tcp-request content reject if !wlist_conn { sc1_conn_cur gt 200 }
     tcp-request content reject if !wlist_conn { sc1_conn_rate gt 20 }`,
+		},
+		{
+			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
+				b.ModeTCP = true
+				b.Limit.Connections = 10
+				b.Limit.ConnectionsQueue = true
+				b.Limit.Key = "req.hdr(X-Api-Key)"
+				b.Limit.TableSize = "200k"
+				b.Limit.TableExpire = "5m"
+			},
+			expected: `
+    stick-table type ip size 200k expire 5m store conn_cur,conn_rate(1s)
+    tcp-request content track-sc1 src
+    tcp-request content set-priority-class int(1) if { sc1_conn_cur gt 10 }`,
 		},
 		{
 			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
@@ -727,6 +1020,18 @@ d1.local#/ path01`,
     server s31 172.17.0.131:8080 weight 100
     server s32 172.17.0.132:8080 weight 100
     server s33 172.17.0.133:8080 weight 100`,
+		},
+		{
+			doconfig: func(g *hatypes.Global, h *hatypes.Host, b *hatypes.Backend) {
+				b.AddBackupEndpoint("172.17.0.21", 8080)
+				b.AddBackupEndpoint("172.17.0.22", 8080)
+			},
+			skipSrv: true,
+			expected: `
+    option allbackups
+    server s1 172.17.0.11:8080 weight 100
+    server backup001 172.17.0.21:8080 backup weight 1
+    server backup002 172.17.0.22:8080 backup weight 1`,
 		},
 		// simulates a config where the cookie value is a pod id
 		{
@@ -859,9 +1164,10 @@ func TestInstanceGlobalBind(t *testing.T) {
 		// 1
 		{
 			bind: hatypes.GlobalBindConfig{
-				HTTPBind:    ":80",
-				HTTPSBind:   ":443",
-				AcceptProxy: true,
+				HTTPBind:         ":80",
+				HTTPSBind:        ":443",
+				HTTPAcceptProxy:  true,
+				HTTPSAcceptProxy: true,
 			},
 			expectedHTTP:  "bind :80 accept-proxy",
 			expectedHTTPS: "bind :443 accept-proxy ssl alpn h2,http/1.1 crt-list /etc/haproxy/maps/_front_bind_crt.list ca-ignore-err all crt-ignore-err all",
@@ -875,6 +1181,52 @@ func TestInstanceGlobalBind(t *testing.T) {
 			expectedHTTP:  "bind 127.0.0.1:80",
 			expectedHTTPS: "bind 127.0.0.1:443 ssl alpn h2,http/1.1 crt-list /etc/haproxy/maps/_front_bind_crt.list ca-ignore-err all crt-ignore-err all",
 		},
+		// 3
+		{
+			bind: hatypes.GlobalBindConfig{
+				HTTPBind:  ":80",
+				HTTPSBind: ":443",
+				HTTPExtra: []*hatypes.BindExtraConfig{
+					{Addr: ":8080", AcceptProxy: true},
+				},
+				HTTPSExtra: []*hatypes.BindExtraConfig{
+					{Addr: ":8443", AcceptProxy: true},
+					{Addr: "127.0.0.1:9443", ALPN: "http/1.1", SSLMinVer: "TLSv1.2", Ciphers: "ECDHE-RSA-AES128-GCM-SHA256"},
+				},
+			},
+			expectedHTTP: `bind :80
+    bind :8080 accept-proxy`,
+			expectedHTTPS: `bind :443 ssl alpn h2,http/1.1 crt-list /etc/haproxy/maps/_front_bind_crt.list ca-ignore-err all crt-ignore-err all
+    bind :8443 accept-proxy ssl alpn h2,http/1.1 crt-list /etc/haproxy/maps/_front_bind_crt.list ca-ignore-err all crt-ignore-err all
+    bind 127.0.0.1:9443 ssl alpn http/1.1 ssl-min-ver TLSv1.2 ciphers ECDHE-RSA-AES128-GCM-SHA256 crt-list /etc/haproxy/maps/_front_bind_crt.list ca-ignore-err all crt-ignore-err all`,
+		},
+		// 4
+		{
+			bind: hatypes.GlobalBindConfig{
+				HTTPBind:         ":80",
+				HTTPSBind:        ":443",
+				HTTPSAcceptProxy: true,
+			},
+			expectedHTTP:  "bind :80",
+			expectedHTTPS: "bind :443 accept-proxy ssl alpn h2,http/1.1 crt-list /etc/haproxy/maps/_front_bind_crt.list ca-ignore-err all crt-ignore-err all",
+		},
+		// 5
+		{
+			bind: hatypes.GlobalBindConfig{
+				HTTPBind:  ":80",
+				HTTPSBind: ":443",
+				HTTPExtra: []*hatypes.BindExtraConfig{
+					{Addr: "10.0.0.10:8080", ID: 10021, Internal: true},
+				},
+				HTTPSExtra: []*hatypes.BindExtraConfig{
+					{Addr: "10.0.0.10:8443", ID: 10021, Internal: true, AcceptProxy: true},
+				},
+			},
+			expectedHTTP: `bind :80
+    bind 10.0.0.10:8080 id 10021`,
+			expectedHTTPS: `bind :443 ssl alpn h2,http/1.1 crt-list /etc/haproxy/maps/_front_bind_crt.list ca-ignore-err all crt-ignore-err all
+    bind 10.0.0.10:8443 id 10021 accept-proxy ssl alpn h2,http/1.1 crt-list /etc/haproxy/maps/_front_bind_crt.list ca-ignore-err all crt-ignore-err all`,
+		},
 	}
 	for _, test := range testCases {
 		c := setup(t)
@@ -923,6 +1275,77 @@ frontend _front_https
 	}
 }
 
+func TestInstanceRealIP(t *testing.T) {
+	testCases := []struct {
+		realIP   hatypes.RealIPConfig
+		expected string
+	}{
+		// 0
+		{},
+		// 1
+		{
+			realIP: hatypes.RealIPConfig{
+				Header:      "X-Forwarded-For",
+				TrustedCIDR: []string{"10.0.0.0/8", "192.168.1.10"},
+			},
+			expected: `
+    acl trusted-proxy src 10.0.0.0/8 192.168.1.10
+    http-request set-src hdr_ip(X-Forwarded-For,-1) if trusted-proxy { hdr(X-Forwarded-For) -m found }`,
+		},
+		// 2
+		{
+			realIP: hatypes.RealIPConfig{
+				Header:      "CF-Connecting-IP",
+				TrustedCIDR: []string{"173.245.48.0/20"},
+			},
+			expected: `
+    acl trusted-proxy src 173.245.48.0/20
+    http-request set-src hdr_ip(CF-Connecting-IP,-1) if trusted-proxy { hdr(CF-Connecting-IP) -m found }`,
+		},
+	}
+	for _, test := range testCases {
+		c := setup(t)
+		var h *hatypes.Host
+		var b *hatypes.Backend
+
+		b = c.config.Backends().AcquireBackend("d1", "app", "8080")
+		b.Endpoints = []*hatypes.Endpoint{endpointS1}
+		h = c.config.Hosts().AcquireHost("d1.local")
+		h.AddPath(b, "/", hatypes.MatchBegin)
+
+		c.config.Global().RealIP = test.realIP
+
+		c.Update()
+		c.checkConfig(`
+<<global>>
+<<defaults>>
+backend d1_app_8080
+    mode http
+    server s1 172.17.0.11:8080 weight 100
+<<backends-default>>
+frontend _front_http
+    mode http
+    bind :80` + test.expected + `
+    <<set-req-base>>
+    <<http-headers>>
+    http-request set-var(req.backend) var(req.base),lower,map_beg(/etc/haproxy/maps/_front_http_host__begin.map)
+    use_backend %[var(req.backend)] if { var(req.backend) -m found }
+    default_backend _error404
+frontend _front_https
+    mode http
+    bind :443 ssl alpn h2,http/1.1 crt-list /etc/haproxy/maps/_front_bind_crt.list ca-ignore-err all crt-ignore-err all` + test.expected + `
+    <<set-req-base>>
+    http-request set-var(req.hostbackend) var(req.base),lower,map_beg(/etc/haproxy/maps/_front_https_host__begin.map)
+    <<https-headers>>
+    use_backend %[var(req.hostbackend)] if { var(req.hostbackend) -m found }
+    default_backend _error404
+<<support>>
+`)
+		c.logger.CompareLogging(defaultLogging)
+		c.teardown()
+	}
+}
+
 func TestInstanceEmpty(t *testing.T) {
 	c := setup(t)
 	defer c.teardown()
@@ -1036,28 +1459,24 @@ empty#/ default_empty_8080`)
 	c.logger.CompareLogging(defaultLogging)
 }
 
-func TestInstanceEmptyExternal(t *testing.T) {
+func TestDefaultPages(t *testing.T) {
 	c := setup(t)
 	defer c.teardown()
 
-	c.config.global.External.MasterSocket = "/tmp/master.sock"
-	c.config.global.Master.WorkerMaxReloads = 20
-	c.config.global.Security.Username = "external"
-	c.config.global.Security.Groupname = "external"
-
+	c.config.Global().DefaultPages = "127.0.0.1:8181"
 	c.config.Hosts().AcquireHost("empty").AddPath(c.config.Backends().AcquireBackend("default", "empty", "8080"), "/", hatypes.MatchBegin)
+
 	c.Update()
 
 	c.checkConfig(`
 global
-    master-worker
-    user external
-    group external
-    unix-bind user external group external mode 0600
+    daemon
+    unix-bind mode 0600
     stats socket /var/run/haproxy.sock level admin expose-fd listeners mode 600
     maxconn 2000
     hard-stop-after 15m
-    mworker-max-reloads 20
+    lua-prepend-path /etc/haproxy/lua/?.lua
+    lua-load /etc/haproxy/lua/auth-request.lua
     lua-load /etc/haproxy/lua/services.lua
     ssl-dh-param-file /var/haproxy/tls/dhparam.pem
     ssl-default-bind-ciphers ECDHE-RSA-AES128-GCM-SHA256:ECDHE-ECDSA-AES128-GCM-SHA256
@@ -1065,7 +1484,173 @@ global
     ssl-default-bind-options no-sslv3
     ssl-default-server-ciphers ECDHE-RSA-AES128-GCM-SHA256:ECDHE-ECDSA-AES128-GCM-SHA256
     ssl-default-server-ciphersuites TLS_AES_128_GCM_SHA256
-<<defaults>>
+defaults
+    log global
+    maxconn 2000
+    option redispatch
+    option dontlognull
+    option http-server-close
+    option http-keep-alive
+    timeout client          50s
+    timeout client-fin      50s
+    timeout connect         5s
+    timeout http-keep-alive 1m
+    timeout http-request    5s
+    timeout queue           5s
+    timeout server          50s
+    timeout server-fin      50s
+    timeout tunnel          1h
+backend default_empty_8080
+    mode http
+backend _error404
+    mode http
+    server _default_pages 127.0.0.1:8181
+<<frontends-default>>
+<<support>>
+`)
+
+	c.checkMap("_front_http_host__begin.map", `
+empty#/ default_empty_8080`)
+	c.checkMap("_front_https_host__begin.map", `
+empty#/ default_empty_8080`)
+	c.logger.CompareLogging(defaultLogging)
+}
+
+func TestErrorPages(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	c.config.Global().ErrorPages = []*hatypes.ErrorPage{
+		{Code: 404, Content: "HTTP/1.0 404 Not Found\r\n\r\nnot found"},
+		{Code: 413, Content: "HTTP/1.0 413 Payload Too Large\r\n\r\ntoo large"},
+		{Code: 503, Content: "HTTP/1.0 503 Service Unavailable\r\n\r\nunavailable"},
+	}
+	h := c.config.Hosts().AcquireHost("empty")
+	b := c.config.Backends().AcquireBackend("default", "empty", "8080")
+	h.AddPath(b, "/", hatypes.MatchBegin)
+	b.FindBackendPath(h.FindPath("/").Link).MaxBodySize = 1024
+
+	c.Update()
+
+	c.checkConfig(`
+global
+    daemon
+    unix-bind mode 0600
+    stats socket /var/run/haproxy.sock level admin expose-fd listeners mode 600
+    maxconn 2000
+    hard-stop-after 15m
+    lua-prepend-path /etc/haproxy/lua/?.lua
+    lua-load /etc/haproxy/lua/auth-request.lua
+    lua-load /etc/haproxy/lua/services.lua
+    ssl-dh-param-file /var/haproxy/tls/dhparam.pem
+    ssl-default-bind-ciphers ECDHE-RSA-AES128-GCM-SHA256:ECDHE-ECDSA-AES128-GCM-SHA256
+    ssl-default-bind-ciphersuites TLS_AES_128_GCM_SHA256
+    ssl-default-bind-options no-sslv3
+    ssl-default-server-ciphers ECDHE-RSA-AES128-GCM-SHA256:ECDHE-ECDSA-AES128-GCM-SHA256
+    ssl-default-server-ciphersuites TLS_AES_128_GCM_SHA256
+defaults
+    log global
+    maxconn 2000
+    option redispatch
+    option dontlognull
+    option http-server-close
+    option http-keep-alive
+    timeout client          50s
+    timeout client-fin      50s
+    timeout connect         5s
+    timeout http-keep-alive 1m
+    timeout http-request    5s
+    timeout queue           5s
+    timeout server          50s
+    timeout server-fin      50s
+    timeout tunnel          1h
+    errorfile 404 /etc/haproxy/maps/_error404.http
+    errorfile 413 /etc/haproxy/maps/_error413.http
+    errorfile 503 /etc/haproxy/maps/_error503.http
+backend default_empty_8080
+    mode http
+    http-request deny deny_status 413 if { req.body_size,sub(1024) gt 0 }
+backend _error404
+    mode http
+    http-request deny deny_status 404
+<<frontends-default>>
+<<support>>
+`)
+
+	page, err := ioutil.ReadFile(filepath.Join(c.tempdir, "_error503.http"))
+	if err != nil {
+		c.t.Errorf("error reading error page: %v", err)
+	}
+	c.compareText("_error503.http", string(page), "HTTP/1.0 503 Service Unavailable\r\n\r\nunavailable")
+	c.logger.CompareLogging(defaultLogging)
+}
+
+func TestInstanceCache(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	h := c.config.Hosts().AcquireHost("d1.local")
+	b := c.config.Backends().AcquireBackend("d1", "app", "8080")
+	h.AddPath(b, "/", hatypes.MatchBegin)
+	b.Cache = hatypes.BackendCache{
+		Enabled:       true,
+		MaxAge:        300,
+		MaxObjectSize: 65536,
+		TotalMaxSize:  16,
+	}
+	b.Endpoints = []*hatypes.Endpoint{endpointS1}
+
+	c.Update()
+
+	c.checkConfig(`
+<<global>>
+<<defaults>>
+cache d1_app_8080
+    total-max-size 16
+    max-object-size 65536
+    max-age 300
+backend d1_app_8080
+    mode http
+    http-request cache-use d1_app_8080
+    http-response cache-store d1_app_8080
+    server s1 172.17.0.11:8080 weight 100
+<<backends-default>>
+<<frontends-default>>
+<<support>>
+`)
+	c.logger.CompareLogging(defaultLogging)
+}
+
+func TestInstanceEmptyExternal(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	c.config.global.External.MasterSocket = "/tmp/master.sock"
+	c.config.global.Master.WorkerMaxReloads = 20
+	c.config.global.Security.Username = "external"
+	c.config.global.Security.Groupname = "external"
+
+	c.config.Hosts().AcquireHost("empty").AddPath(c.config.Backends().AcquireBackend("default", "empty", "8080"), "/", hatypes.MatchBegin)
+	c.Update()
+
+	c.checkConfig(`
+global
+    master-worker
+    user external
+    group external
+    unix-bind user external group external mode 0600
+    stats socket /var/run/haproxy.sock level admin expose-fd listeners mode 600
+    maxconn 2000
+    hard-stop-after 15m
+    mworker-max-reloads 20
+    lua-load /etc/haproxy/lua/services.lua
+    ssl-dh-param-file /var/haproxy/tls/dhparam.pem
+    ssl-default-bind-ciphers ECDHE-RSA-AES128-GCM-SHA256:ECDHE-ECDSA-AES128-GCM-SHA256
+    ssl-default-bind-ciphersuites TLS_AES_128_GCM_SHA256
+    ssl-default-bind-options no-sslv3
+    ssl-default-server-ciphers ECDHE-RSA-AES128-GCM-SHA256:ECDHE-ECDSA-AES128-GCM-SHA256
+    ssl-default-server-ciphersuites TLS_AES_128_GCM_SHA256
+<<defaults>>
 backend default_empty_8080
     mode http
 backend _error404
@@ -1686,6 +2271,54 @@ listen _tcp_pq_5432
     mode tcp
     server srv001 172.17.0.2:5432 send-proxy-v2`,
 		},
+		// 6
+		{
+			doconfig: func(c *testConfig) {
+				b := c.config.TCPBackends().Acquire("sni", 8883)
+				b.SNIPassthrough = true
+				r1 := &hatypes.TCPBackend{Name: "default_mqtt", Port: 8883, SNI: "mqtt.local"}
+				r1.AddEndpoint("172.17.0.2", 8883)
+				r2 := &hatypes.TCPBackend{Name: "default_pq", Port: 8883, SNI: "pq.local", CheckInterval: "2s"}
+				r2.AddEndpoint("172.17.0.3", 5432)
+				b.SNIRoutes = []*hatypes.TCPBackend{r1, r2}
+			},
+			expected: `
+listen _tcp_sni_8883
+    bind :8883
+    mode tcp
+    tcp-request inspect-delay 5s
+    tcp-request content accept if { req.ssl_hello_type 1 }
+    use_backend _tcp_sni_8883_mqtt.local if { req.ssl_sni -i mqtt.local }
+    use_backend _tcp_sni_8883_pq.local if { req.ssl_sni -i pq.local }
+backend _tcp_sni_8883_mqtt.local
+    mode tcp
+    server srv001 172.17.0.2:8883
+backend _tcp_sni_8883_pq.local
+    mode tcp
+    server srv001 172.17.0.3:5432 check port 5432 inter 2s`,
+		},
+		// 7
+		{
+			doconfig: func(c *testConfig) {
+				b := c.config.TCPBackends().Acquire("default_app", 8443)
+				b.AddEndpoint("172.17.0.2", 8443)
+				b.SSL.Filename = "/var/haproxy/ssl/app.pem"
+				r1 := &hatypes.TCPBackend{Name: "default_pq", Port: 8443, SNI: "pq.local"}
+				r1.AddEndpoint("172.17.0.3", 5432)
+				r1.SSL.Filename = "/var/haproxy/ssl/pq.pem"
+				r1.SSL.ServerSSL = true
+				b.SNIRoutes = []*hatypes.TCPBackend{r1}
+			},
+			expected: `
+listen _tcp_default_app_8443
+    bind :8443 ssl crt /var/haproxy/ssl/app.pem crt /var/haproxy/ssl/pq.pem
+    mode tcp
+    use_backend _tcp_default_app_8443_pq.local if { ssl_fc_sni -i pq.local }
+    server srv001 172.17.0.2:8443
+backend _tcp_default_app_8443_pq.local
+    mode tcp
+    server srv001 172.17.0.3:5432 ssl verify none`,
+		},
 	}
 	for _, test := range testCases {
 		c := setup(t)
@@ -1747,55 +2380,416 @@ func TestInstanceDefaultHost(t *testing.T) {
 <<defaults>>
 backend d1_app_8080
     mode http
-    acl https-request ssl_fc
-    http-request redirect scheme https if !https-request
-    server s1 172.17.0.11:8080 weight 100
-backend d2_app_8080
-    mode http
-    acl https-request ssl_fc
-    http-request redirect scheme https if !https-request
+    acl https-request ssl_fc
+    http-request redirect scheme https if !https-request
+    server s1 172.17.0.11:8080 weight 100
+backend d2_app_8080
+    mode http
+    acl https-request ssl_fc
+    http-request redirect scheme https if !https-request
+    server s1 172.17.0.11:8080 weight 100
+backend default_default-backend_8080
+    mode http
+    server s0 172.17.0.99:8080 weight 100
+frontend _front_http
+    mode http
+    bind :80
+    <<set-req-base>>
+    http-request set-var(txn.namespace) var(req.base),lower,map_beg(/etc/haproxy/maps/_front_namespace__begin.map)
+    http-request set-var(txn.namespace) str(-) if !{ var(txn.namespace) -m found }
+    <<http-headers>>
+    http-request set-var(req.backend) var(req.base),lower,map_beg(/etc/haproxy/maps/_front_http_host__begin.map)
+    use_backend %[var(req.backend)] if { var(req.backend) -m found }
+    use_backend d1_app_8080
+    default_backend default_default-backend_8080
+frontend _front_https
+    mode http
+    bind :443 ssl alpn h2,http/1.1 crt-list /etc/haproxy/maps/_front_bind_crt.list ca-ignore-err all crt-ignore-err all
+    <<set-req-base>>
+    http-request set-var(req.hostbackend) var(req.base),lower,map_beg(/etc/haproxy/maps/_front_https_host__begin.map)
+    http-request set-var(txn.namespace) var(req.base),lower,map_beg(/etc/haproxy/maps/_front_namespace__begin.map)
+    http-request set-var(txn.namespace) str(-) if !{ var(txn.namespace) -m found }
+    <<https-headers>>
+    use_backend %[var(req.hostbackend)] if { var(req.hostbackend) -m found }
+    use_backend d1_app_8080
+    default_backend default_default-backend_8080
+<<support>>
+`)
+
+	c.checkMap("_front_http_host__begin.map", `
+d2.local#/app d2_app_8080
+`)
+	c.checkMap("_front_bind_crt.list", `
+/var/haproxy/ssl/certs/default.pem !*
+`)
+	c.checkMap("_front_namespace__begin.map", `
+d2.local#/app d2
+`)
+	c.checkMap("_front_https_host__begin.map", `
+d2.local#/app d2_app_8080
+`)
+
+	c.logger.CompareLogging(defaultLogging)
+}
+
+func TestInstanceInternalHost(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	var h *hatypes.Host
+	var b *hatypes.Backend
+
+	b = c.config.Backends().AcquireBackend("d1", "app", "8080")
+	b.Endpoints = []*hatypes.Endpoint{endpointS1}
+	h = c.config.Hosts().AcquireHost("d1.local")
+	h.AddPath(b, "/", hatypes.MatchBegin)
+	h.Internal = true
+	h.Alias.AliasName = "d1.internal"
+
+	b = c.config.Backends().AcquireBackend("d2", "app", "8080")
+	b.Endpoints = []*hatypes.Endpoint{endpointS1}
+	h = c.config.Hosts().AcquireHost("d2.local")
+	h.AddPath(b, "/", hatypes.MatchBegin)
+
+	c.config.Global().Bind.HTTPExtra = []*hatypes.BindExtraConfig{
+		{Addr: "10.0.0.10:8080", ID: 10021, Internal: true},
+	}
+
+	c.Update()
+	c.checkConfig(`
+<<global>>
+<<defaults>>
+backend d1_app_8080
+    mode http
+    server s1 172.17.0.11:8080 weight 100
+backend d2_app_8080
+    mode http
+    server s1 172.17.0.11:8080 weight 100
+<<backends-default>>
+frontend _front_http
+    mode http
+    bind :80
+    bind 10.0.0.10:8080 id 10021
+    <<set-req-base>>
+    acl internal-bind so_id 10021
+    http-request set-var(req.internal) var(req.base),lower,map_beg(/etc/haproxy/maps/_front_internal_host__begin.map)
+    http-request deny deny_status 404 if { var(req.internal) -m found } !internal-bind
+    <<http-headers>>
+    http-request set-var(req.backend) var(req.base),lower,map_beg(/etc/haproxy/maps/_front_http_host__begin.map)
+    use_backend %[var(req.backend)] if { var(req.backend) -m found }
+    default_backend _error404
+frontend _front_https
+    mode http
+    bind :443 ssl alpn h2,http/1.1 crt-list /etc/haproxy/maps/_front_bind_crt.list ca-ignore-err all crt-ignore-err all
+    <<set-req-base>>
+    http-request set-var(req.internal) var(req.base),lower,map_beg(/etc/haproxy/maps/_front_internal_host__begin.map)
+    http-request deny deny_status 404 if { var(req.internal) -m found }
+    http-request set-var(req.hostbackend) var(req.base),lower,map_beg(/etc/haproxy/maps/_front_https_host__begin.map)
+    <<https-headers>>
+    use_backend %[var(req.hostbackend)] if { var(req.hostbackend) -m found }
+    default_backend _error404
+<<support>>
+`)
+
+	c.checkMap("_front_internal_host__begin.map", `
+d1.internal#/ internal
+d1.local#/ internal
+`)
+	c.checkMap("_front_http_host__begin.map", `
+d1.internal#/ d1_app_8080
+d1.local#/ d1_app_8080
+d2.local#/ d2_app_8080
+`)
+
+	c.logger.CompareLogging(defaultLogging)
+}
+
+func TestInstanceTenantHost(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	var h *hatypes.Host
+	var b *hatypes.Backend
+
+	b = c.config.Backends().AcquireBackend("d1", "app", "8080")
+	b.Endpoints = []*hatypes.Endpoint{endpointS1}
+	h = c.config.Hosts().AcquireHost("d1.local")
+	h.AddPath(b, "/", hatypes.MatchBegin)
+	h.Tenant = "team1"
+
+	b = c.config.Backends().AcquireBackend("d2", "app", "8080")
+	b.Endpoints = []*hatypes.Endpoint{endpointS1}
+	h = c.config.Hosts().AcquireHost("d2.local")
+	h.AddPath(b, "/", hatypes.MatchBegin)
+	h.Tenant = "team2"
+
+	c.config.Global().Bind.HTTPExtra = []*hatypes.BindExtraConfig{
+		{Addr: ":8080", ID: 10021, Tenant: "team1", Thread: "2"},
+		{Addr: ":8081", ID: 10022, Tenant: "team2", Thread: "3"},
+	}
+
+	c.Update()
+	c.checkConfig(`
+<<global>>
+<<defaults>>
+backend d1_app_8080
+    mode http
+    server s1 172.17.0.11:8080 weight 100
+backend d2_app_8080
+    mode http
+    server s1 172.17.0.11:8080 weight 100
+<<backends-default>>
+frontend _front_http
+    mode http
+    bind :80
+    bind :8080 id 10021 thread 2
+    bind :8081 id 10022 thread 3
+    <<set-req-base>>
+    http-request set-var(req.bindtenant) str(team1) if { so_id 10021 }
+    http-request set-var(req.bindtenant) str(team2) if { so_id 10022 }
+    http-request set-var(req.tenant) var(req.base),lower,map_beg(/etc/haproxy/maps/_front_tenant_host__begin.map)
+    acl tenant-match var(req.tenant),strcmp(req.bindtenant) eq 0
+    http-request deny deny_status 404 if { var(req.tenant) -m found } !tenant-match
+    http-request deny deny_status 404 if { var(req.bindtenant) -m found } !tenant-match
+    <<http-headers>>
+    http-request set-var(req.backend) var(req.base),lower,map_beg(/etc/haproxy/maps/_front_http_host__begin.map)
+    use_backend %[var(req.backend)] if { var(req.backend) -m found }
+    default_backend _error404
+frontend _front_https
+    mode http
+    bind :443 ssl alpn h2,http/1.1 crt-list /etc/haproxy/maps/_front_bind_crt.list ca-ignore-err all crt-ignore-err all
+    <<set-req-base>>
+    http-request set-var(req.tenant) var(req.base),lower,map_beg(/etc/haproxy/maps/_front_tenant_host__begin.map)
+    acl tenant-match var(req.tenant),strcmp(req.bindtenant) eq 0
+    http-request deny deny_status 404 if { var(req.tenant) -m found } !tenant-match
+    http-request set-var(req.hostbackend) var(req.base),lower,map_beg(/etc/haproxy/maps/_front_https_host__begin.map)
+    <<https-headers>>
+    use_backend %[var(req.hostbackend)] if { var(req.hostbackend) -m found }
+    default_backend _error404
+<<support>>
+`)
+
+	c.checkMap("_front_tenant_host__begin.map", `
+d1.local#/ team1
+d2.local#/ team2
+`)
+
+	c.logger.CompareLogging(defaultLogging)
+}
+
+func TestInstanceDrainingHost(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	var h *hatypes.Host
+	var b *hatypes.Backend
+
+	b = c.config.Backends().AcquireBackend("d1", "app", "8080")
+	b.Endpoints = []*hatypes.Endpoint{endpointS1}
+	h = c.config.Hosts().AcquireHost("d1.local")
+	h.AddPath(b, "/", hatypes.MatchBegin)
+
+	h = c.config.Hosts().AcquireHost("d2.local")
+	h.Drain.Draining = true
+
+	h = c.config.Hosts().AcquireHost("d3.local")
+	h.Drain.Draining = true
+	h.Drain.Location = "https://d1.local"
+
+	c.Update()
+	c.checkConfig(`
+<<global>>
+<<defaults>>
+backend d1_app_8080
+    mode http
+    server s1 172.17.0.11:8080 weight 100
+<<backends-default>>
+frontend _front_http
+    mode http
+    bind :80
+    <<set-req-base>>
+    http-request set-var(req.drainredir) var(req.host),map_str(/etc/haproxy/maps/_front_drain_redir__exact.map)
+    http-request redirect location %[var(req.drainredir)] if { var(req.drainredir) -m found }
+    http-request return status 410 if { var(req.host) -i -m str -f /etc/haproxy/maps/_front_drain_gone__exact.list }
+    <<http-headers>>
+    http-request set-var(req.backend) var(req.base),lower,map_beg(/etc/haproxy/maps/_front_http_host__begin.map)
+    use_backend %[var(req.backend)] if { var(req.backend) -m found }
+    default_backend _error404
+frontend _front_https
+    mode http
+    bind :443 ssl alpn h2,http/1.1 crt-list /etc/haproxy/maps/_front_bind_crt.list ca-ignore-err all crt-ignore-err all
+    <<set-req-base>>
+    http-request set-var(req.drainredir) var(req.host),map_str(/etc/haproxy/maps/_front_drain_redir__exact.map)
+    http-request redirect location %[var(req.drainredir)] if { var(req.drainredir) -m found }
+    http-request return status 410 if { var(req.host) -i -m str -f /etc/haproxy/maps/_front_drain_gone__exact.list }
+    http-request set-var(req.hostbackend) var(req.base),lower,map_beg(/etc/haproxy/maps/_front_https_host__begin.map)
+    <<https-headers>>
+    use_backend %[var(req.hostbackend)] if { var(req.hostbackend) -m found }
+    default_backend _error404
+<<support>>
+`)
+
+	c.checkMap("_front_drain_redir__exact.map", `
+d3.local https://d1.local
+`)
+	c.checkMap("_front_drain_gone__exact.list", `
+d2.local
+`)
+
+	c.logger.CompareLogging(defaultLogging)
+}
+
+func TestInstanceBotMitigation(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	var h *hatypes.Host
+	var b *hatypes.Backend
+
+	c.config.Global().BotMitigation.UserAgents = []string{"nikto", "sqlmap"}
+	c.config.Global().BotMitigation.Paths = []string{"/wp-login.php", "/.git/"}
+
+	b = c.config.Backends().AcquireBackend("d1", "app", "8080")
+	b.Endpoints = []*hatypes.Endpoint{endpointS1}
+	h = c.config.Hosts().AcquireHost("d1.local")
+	h.AddPath(b, "/", hatypes.MatchBegin)
+	h.BotMitigation = "deny"
+
+	h = c.config.Hosts().AcquireHost("d2.local")
+	h.AddPath(b, "/", hatypes.MatchBegin)
+	h.BotMitigation = "tarpit"
+
+	h = c.config.Hosts().AcquireHost("d3.local")
+	h.AddPath(b, "/", hatypes.MatchBegin)
+
+	c.Update()
+	c.checkConfig(`
+<<global>>
+<<defaults>>
+backend d1_app_8080
+    mode http
+    server s1 172.17.0.11:8080 weight 100
+backend _bot_mitigation
+    mode http
+    http-request tarpit deny_status 403 if { var(req.botaction) -m str tarpit }
+    http-request deny deny_status 403
+<<backends-default>>
+frontend _front_http
+    mode http
+    bind :80
+    <<set-req-base>>
+    http-request set-var(req.botmatch) bool(true) if { req.hdr(user-agent) -i -m sub -f /etc/haproxy/maps/_bot_useragents.list }
+    http-request set-var(req.botmatch) bool(true) if { path -m beg -f /etc/haproxy/maps/_bot_paths.list }
+    http-request set-var(req.botaction) var(req.host),map_str(/etc/haproxy/maps/_front_bot_mitigation__exact.map) if { var(req.botmatch) -m bool }
+    <<http-headers>>
+    http-request set-var(req.backend) var(req.base),lower,map_beg(/etc/haproxy/maps/_front_http_host__begin.map)
+    use_backend _bot_mitigation if { var(req.botaction) -m found }
+    use_backend %[var(req.backend)] if { var(req.backend) -m found }
+    default_backend _error404
+frontend _front_https
+    mode http
+    bind :443 ssl alpn h2,http/1.1 crt-list /etc/haproxy/maps/_front_bind_crt.list ca-ignore-err all crt-ignore-err all
+    <<set-req-base>>
+    http-request set-var(req.botmatch) bool(true) if { req.hdr(user-agent) -i -m sub -f /etc/haproxy/maps/_bot_useragents.list }
+    http-request set-var(req.botmatch) bool(true) if { path -m beg -f /etc/haproxy/maps/_bot_paths.list }
+    http-request set-var(req.botaction) var(req.host),map_str(/etc/haproxy/maps/_front_bot_mitigation__exact.map) if { var(req.botmatch) -m bool }
+    http-request set-var(req.hostbackend) var(req.base),lower,map_beg(/etc/haproxy/maps/_front_https_host__begin.map)
+    <<https-headers>>
+    use_backend _bot_mitigation if { var(req.botaction) -m found }
+    use_backend %[var(req.hostbackend)] if { var(req.hostbackend) -m found }
+    default_backend _error404
+<<support>>
+`)
+
+	c.checkMap("_front_bot_mitigation__exact.map", `
+d1.local deny
+d2.local tarpit
+`)
+	for _, list := range []struct{ name, content string }{
+		{"_bot_useragents.list", "nikto\nsqlmap\n"},
+		{"_bot_paths.list", "/wp-login.php\n/.git/\n"},
+	} {
+		content, err := ioutil.ReadFile(filepath.Join(c.tempdir, list.name))
+		if err != nil {
+			c.t.Errorf("error reading bot mitigation list: %v", err)
+		}
+		c.compareText(list.name, string(content), list.content)
+	}
+
+	c.logger.CompareLogging(defaultLogging)
+}
+
+func TestInstanceHardening(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	var h *hatypes.Host
+	var b *hatypes.Backend
+
+	c.config.Global().Hardening = hatypes.HardeningConfig{
+		Enabled:     true,
+		ConnRate:    200,
+		HTTPReqRate: 1000,
+		TableSize:   "1m",
+		MaxConn:     1600,
+	}
+
+	b = c.config.Backends().AcquireBackend("d1", "app", "8080")
+	b.Endpoints = []*hatypes.Endpoint{endpointS1}
+	h = c.config.Hosts().AcquireHost("d1.local")
+	h.AddPath(b, "/", hatypes.MatchBegin)
+
+	c.Update()
+	c.checkConfig(`
+<<global>>
+defaults
+    log global
+    maxconn 1600
+    option redispatch
+    option dontlognull
+    option http-server-close
+    option http-keep-alive
+    timeout client          50s
+    timeout client-fin      50s
+    timeout connect         5s
+    timeout http-keep-alive 1m
+    timeout http-request    5s
+    timeout queue           5s
+    timeout server          50s
+    timeout server-fin      50s
+    timeout tunnel          1h
+backend d1_app_8080
+    mode http
     server s1 172.17.0.11:8080 weight 100
-backend default_default-backend_8080
-    mode http
-    server s0 172.17.0.99:8080 weight 100
+backend _hardening
+    stick-table type ipv6 size 1m expire 1m store conn_rate(10s),http_req_rate(10s),http_err_rate(10s)
+<<backends-default>>
 frontend _front_http
     mode http
     bind :80
+    tcp-request connection track-sc0 src table _hardening
+    tcp-request connection silent-drop if { sc0_conn_rate gt 200 }
+    http-request track-sc2 src table _hardening
+    http-request silent-drop if { sc2_http_req_rate gt 1000 }
     <<set-req-base>>
-    http-request set-var(txn.namespace) var(req.base),lower,map_beg(/etc/haproxy/maps/_front_namespace__begin.map)
-    http-request set-var(txn.namespace) str(-) if !{ var(txn.namespace) -m found }
     <<http-headers>>
     http-request set-var(req.backend) var(req.base),lower,map_beg(/etc/haproxy/maps/_front_http_host__begin.map)
     use_backend %[var(req.backend)] if { var(req.backend) -m found }
-    use_backend d1_app_8080
-    default_backend default_default-backend_8080
+    default_backend _error404
 frontend _front_https
     mode http
     bind :443 ssl alpn h2,http/1.1 crt-list /etc/haproxy/maps/_front_bind_crt.list ca-ignore-err all crt-ignore-err all
+    tcp-request connection track-sc0 src table _hardening
+    tcp-request connection silent-drop if { sc0_conn_rate gt 200 }
+    http-request track-sc2 src table _hardening
+    http-request silent-drop if { sc2_http_req_rate gt 1000 }
     <<set-req-base>>
     http-request set-var(req.hostbackend) var(req.base),lower,map_beg(/etc/haproxy/maps/_front_https_host__begin.map)
-    http-request set-var(txn.namespace) var(req.base),lower,map_beg(/etc/haproxy/maps/_front_namespace__begin.map)
-    http-request set-var(txn.namespace) str(-) if !{ var(txn.namespace) -m found }
     <<https-headers>>
     use_backend %[var(req.hostbackend)] if { var(req.hostbackend) -m found }
-    use_backend d1_app_8080
-    default_backend default_default-backend_8080
+    default_backend _error404
 <<support>>
 `)
-
-	c.checkMap("_front_http_host__begin.map", `
-d2.local#/app d2_app_8080
-`)
-	c.checkMap("_front_bind_crt.list", `
-/var/haproxy/ssl/certs/default.pem !*
-`)
-	c.checkMap("_front_namespace__begin.map", `
-d2.local#/app d2
-`)
-	c.checkMap("_front_https_host__begin.map", `
-d2.local#/app d2_app_8080
-`)
-
 	c.logger.CompareLogging(defaultLogging)
 }
 
@@ -1983,6 +2977,52 @@ d2.local#/app -
 	c.logger.CompareLogging(defaultLogging)
 }
 
+func TestInstanceFrontendCrtPool(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	var h *hatypes.Host
+	var b *hatypes.Backend
+
+	b = c.config.Backends().AcquireBackend("d", "app", "8080")
+	b.Endpoints = []*hatypes.Endpoint{endpointS1}
+
+	h = c.config.Hosts().AcquireHost("d1.local")
+	h.AddPath(b, "/", hatypes.MatchBegin)
+	h.TLS.TLSFilename = "/var/haproxy/ssl/certs/d1.pem"
+	h.TLS.TLSHash = "1"
+
+	h = c.config.Hosts().AcquireHost("d2.example.com")
+	h.AddPath(b, "/", hatypes.MatchBegin)
+	h.TLS.TLSFilename = "/var/haproxy/ssl/certs/default.pem"
+
+	h = c.config.Hosts().AcquireHost("d3.example.com")
+	h.AddPath(b, "/", hatypes.MatchBegin)
+	h.TLS.TLSFilename = "/var/haproxy/ssl/certs/default.pem"
+	h.TLS.ALPN = "h2"
+
+	h = c.config.Hosts().AcquireHost("d4.local")
+	h.AddPath(b, "/", hatypes.MatchBegin)
+	h.TLS.TLSFilename = "/var/haproxy/ssl/certs/default.pem"
+	h.TLS.ALPN = "h2"
+
+	c.config.Frontend().DefaultCrtPool = []*hatypes.CrtPoolFile{
+		{Filename: "/var/haproxy/ssl/certs/pool-d1.pem", Names: []string{"d1.local"}},
+		{Filename: "/var/haproxy/ssl/certs/pool-wildcard.pem", Names: []string{"*.example.com"}},
+	}
+
+	c.Update()
+	c.checkMap("_front_bind_crt.list", `
+/var/haproxy/ssl/certs/default.pem !*
+/var/haproxy/ssl/certs/d1.pem d1.local
+/var/haproxy/ssl/certs/pool-wildcard.pem [alpn h2] d3.example.com
+/var/haproxy/ssl/certs/default.pem [alpn h2] d4.local
+/var/haproxy/ssl/certs/pool-d1.pem
+/var/haproxy/ssl/certs/pool-wildcard.pem
+`)
+	c.logger.CompareLogging(defaultLogging)
+}
+
 func TestInstanceFrontendCA(t *testing.T) {
 	c := setup(t)
 	defer c.teardown()
@@ -2037,6 +3077,14 @@ func TestInstanceFrontendCA(t *testing.T) {
 	h.TLS.TLSHash = "0"
 	h.TLS.Options = "ssl-min-ver TLSv1.0 ssl-max-ver TLSv1.2"
 
+	h = c.config.Hosts().AcquireHost("d7.local")
+	h.AddPath(b, "/", hatypes.MatchBegin)
+	h.TLS.TLSFilename = "/var/haproxy/ssl/certs/default.pem"
+	h.TLS.TLSHash = "0"
+	h.TLS.Curves = "X25519:prime256v1"
+	h.TLS.SSLMinVer = "TLSv1.2"
+	h.TLS.SSLMaxVer = "TLSv1.3"
+
 	for _, path := range b.Paths {
 		path.SSLRedirect = true
 	}
@@ -2111,6 +3159,7 @@ d3.local#/ d_app_8080
 d4.local#/ d_app_8080
 d5.local#/ d_app_8080
 d6.local#/ d_app_8080
+d7.local#/ d_app_8080
 `)
 	c.checkMap("_front_http_host__regex.map", `
 ^[^.]+\.d1\.local#/ d_app_8080
@@ -2123,12 +3172,14 @@ d6.local#/ d_app_8080
 /var/haproxy/ssl/certs/default.pem [ciphersuites TLS_CHACHA20_POLY1305_SHA256:TLS_AES_128_GCM_SHA256] d4.local
 /var/haproxy/ssl/certs/default.pem [alpn h2] d5.local
 /var/haproxy/ssl/certs/default.pem [ssl-min-ver TLSv1.0 ssl-max-ver TLSv1.2] d6.local
+/var/haproxy/ssl/certs/default.pem [curves X25519:prime256v1 ssl-min-ver TLSv1.2 ssl-max-ver TLSv1.3] d7.local
 `)
 	c.checkMap("_front_https_host__begin.map", `
 d3.local#/ d_app_8080
 d4.local#/ d_app_8080
 d5.local#/ d_app_8080
 d6.local#/ d_app_8080
+d7.local#/ d_app_8080
 `)
 	c.checkMap("_front_https_sni__begin.map", `
 d2.local#/ d_app_8080
@@ -2789,6 +3840,7 @@ func TestInstanceAlias(t *testing.T) {
 	b.Endpoints = []*hatypes.Endpoint{endpointS31}
 	h = c.config.Hosts().AcquireHost("d3.local")
 	h.AddPath(b, "/", hatypes.MatchBegin)
+	h.Alias.AliasName = "d1.local" // declared hostname has precedence
 	h.Alias.AliasRegex = "d3\\.local$"
 
 	c.Update()
@@ -3124,6 +4176,13 @@ func TestDNS(t *testing.T) {
 	h = c.config.Hosts().AcquireHost("d2.local")
 	h.AddPath(b, "/", hatypes.MatchBegin)
 
+	b = c.config.Backends().AcquireBackend("d3", "app", "http")
+	b.Endpoints = []*hatypes.Endpoint{endpointS21}
+	b.Resolver = "k8s"
+	b.ResolverTarget = "app.domain.local:8080"
+	h = c.config.Hosts().AcquireHost("d3.local")
+	h.AddPath(b, "/", hatypes.MatchBegin)
+
 	c.Update()
 	c.checkConfig(`
 <<global>>
@@ -3142,6 +4201,9 @@ backend d1_app_8080
 backend d2_app_http
     mode http
     server-template srv 2 _http._tcp.app.d2.svc.cluster.local resolvers k8s resolve-prefer ipv4 init-addr none weight 1
+backend d3_app_http
+    mode http
+    server-template srv 1 app.domain.local:8080 resolvers k8s resolve-prefer ipv4 init-addr none weight 1
 <<backends-default>>
 <<frontends-default>>
 <<support>>
@@ -3564,6 +4626,134 @@ backend d1_app_8080
 	}
 }
 
+func TestInstanceSPOEAgents(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	if err := c.instance.modsecTmpl.NewTemplate(
+		"modsecurity.tmpl",
+		"../../rootfs/etc/templates/modsecurity/modsecurity.tmpl",
+		filepath.Join(c.tempdir, "spoe-modsecurity.conf"),
+		0,
+		1024,
+	); err != nil {
+		t.Errorf("error parsing modsecurity.tmpl: %v", err)
+	}
+	if err := c.instance.spoeTmpl.NewTemplate(
+		"spoe.tmpl",
+		"../../rootfs/etc/templates/spoe/spoe.tmpl",
+		filepath.Join(c.tempdir, "spoe-agents.conf"),
+		0,
+		1024,
+	); err != nil {
+		t.Errorf("error parsing spoe.tmpl: %v", err)
+	}
+
+	var h *hatypes.Host
+	var b *hatypes.Backend
+
+	b = c.config.Backends().AcquireBackend("d1", "app", "8080")
+	b.Endpoints = []*hatypes.Endpoint{endpointS1}
+	b.SPOEAgents = []string{"authz", "waf"}
+	h = c.config.Hosts().AcquireHost("d1.local")
+	h.AddPath(b, "/", hatypes.MatchBegin)
+
+	timeout := hatypes.SPOEAgentTimeoutConfig{
+		Connect:    "1s",
+		Server:     "2s",
+		Hello:      "100ms",
+		Idle:       "30s",
+		Processing: "500ms",
+	}
+	global := c.config.Global()
+	global.ModSecurity.Timeout = hatypes.ModSecurityTimeoutConfig(timeout)
+	global.SPOEAgents = []*hatypes.SPOEAgent{
+		{
+			Name:      "authz",
+			Endpoints: []string{"10.0.0.201:12345"},
+			Messages: []*hatypes.SPOEMessage{
+				{Name: "check-request", Args: "method path req.hdrs_bin", Event: "on-backend-http-request"},
+			},
+			Timeout: timeout,
+		},
+		{
+			Name:      "waf",
+			Endpoints: []string{"10.0.0.211:12345", "10.0.0.212:12345"},
+			Messages: []*hatypes.SPOEMessage{
+				{Name: "check-session", Event: "on-server-session"},
+				{Name: "check-response", Args: "status res.hdrs_bin", Event: "on-http-response"},
+			},
+			Timeout: timeout,
+		},
+	}
+
+	c.Update()
+	c.checkConfig(`
+<<global>>
+<<defaults>>
+backend d1_app_8080
+    mode http
+    filter spoe engine authz config /etc/haproxy/spoe-agents.conf
+    filter spoe engine waf config /etc/haproxy/spoe-agents.conf
+    server s1 172.17.0.11:8080 weight 100
+<<backends-default>>
+<<frontends-default>>
+<<support>>
+backend spoe-agent-authz
+    mode tcp
+    timeout connect 1s
+    timeout server  2s
+    server spoa0 10.0.0.201:12345
+backend spoe-agent-waf
+    mode tcp
+    timeout connect 1s
+    timeout server  2s
+    server spoa0 10.0.0.211:12345
+    server spoa1 10.0.0.212:12345
+`)
+	c.checkConfigFile(`
+[modsecurity]
+spoe-agent modsecurity-agent
+    messages     check-request
+    option       var-prefix  modsec
+    timeout      hello       100ms
+    timeout      idle        30s
+    timeout      processing  500ms
+    use-backend  spoe-modsecurity
+spoe-message check-request
+    args   unique-id method path query req.ver req.hdrs_bin req.body_size req.body
+    event  on-backend-http-request
+`, "spoe-modsecurity.conf")
+	c.checkConfigFile(`
+[authz]
+spoe-agent authz-agent
+    messages     check-request
+    option       var-prefix  authz
+    timeout      hello       100ms
+    timeout      idle        30s
+    timeout      processing  500ms
+    use-backend  spoe-agent-authz
+spoe-message check-request
+    args   method path req.hdrs_bin
+    event  on-backend-http-request
+[waf]
+spoe-agent waf-agent
+    messages     check-session check-response
+    option       var-prefix  waf
+    timeout      hello       100ms
+    timeout      idle        30s
+    timeout      processing  500ms
+    use-backend  spoe-agent-waf
+spoe-message check-session
+    event  on-server-session
+spoe-message check-response
+    args   status res.hdrs_bin
+    event  on-http-response
+`, "spoe-agents.conf")
+
+	c.logger.CompareLogging(defaultLogging)
+}
+
 func TestInstanceWildcardHostname(t *testing.T) {
 	c := setup(t)
 	defer c.teardown()
@@ -3739,6 +4929,268 @@ backend d3_app_8080
 INFO-V(2) updated main cfg and 2 backend file(s): [000 002]` + defaultLogging)
 }
 
+func TestCountServersDown(t *testing.T) {
+	testCases := []struct {
+		stat     string
+		expected map[string]int
+	}{
+		// 0
+		{
+			stat:     "# pxname,svname,scur\n",
+			expected: map[string]int{},
+		},
+		// 1
+		{
+			stat: `# pxname,svname,qcur,status,weight
+d1_app_8080,srv001,0,UP,1
+d1_app_8080,srv002,0,DOWN,1
+d1_app_8080,srv003,0,DOWN 1/2,1
+d1_app_8080,BACKEND,0,UP,2
+d2_app_8080,srv001,0,UP,1
+d2_app_8080,srv002,0,MAINT,1
+`,
+			expected: map[string]int{
+				"d1_app_8080": 2,
+				"d2_app_8080": 0,
+			},
+		},
+	}
+	for i, test := range testCases {
+		stats, err := parseStats(test.stat)
+		if err != nil {
+			t.Errorf("unexpected error on %d: %v", i, err)
+		}
+		serversDown := countServersDown(stats)
+		if fmt.Sprint(serversDown) != fmt.Sprint(test.expected) {
+			t.Errorf("servers down differs on %d - expected: %v, actual: %v", i, test.expected, serversDown)
+		}
+	}
+}
+
+func TestParseStats(t *testing.T) {
+	testCases := []struct {
+		stat     string
+		expected []map[string]string
+		err      string
+	}{
+		// 0
+		{
+			stat: "",
+			err:  "missing show stat header",
+		},
+		// 1
+		{
+			stat: "# pxname,svname,scur,\n",
+		},
+		// 2
+		{
+			stat: `# pxname,svname,scur,status,
+_front_http,FRONTEND,3,OPEN,
+d1_app_8080,srv001,,UP,
+d1_app_8080,BACKEND,0
+`,
+			expected: []map[string]string{
+				{"pxname": "_front_http", "svname": "FRONTEND", "scur": "3", "status": "OPEN"},
+				{"pxname": "d1_app_8080", "svname": "srv001", "scur": "", "status": "UP"},
+				{"pxname": "d1_app_8080", "svname": "BACKEND", "scur": "0"},
+			},
+		},
+	}
+	for i, test := range testCases {
+		stats, err := parseStats(test.stat)
+		var errstr string
+		if err != nil {
+			errstr = err.Error()
+		}
+		if errstr != test.err {
+			t.Errorf("error differs on %d - expected: %s, actual: %s", i, test.err, errstr)
+		}
+		if fmt.Sprint(stats) != fmt.Sprint(test.expected) {
+			t.Errorf("stats differs on %d - expected: %v, actual: %v", i, test.expected, stats)
+		}
+	}
+}
+
+func TestInstanceHealth(t *testing.T) {
+	testCases := []struct {
+		threshold    int
+		withdraw     time.Duration
+		unhealthyFor time.Duration
+		reloads      []error
+		expHealth    string
+		expReady     string
+	}{
+		// 0
+		{
+			expReady: "haproxy wasn't successfully reloaded yet",
+		},
+		// 1
+		{
+			reloads: []error{nil},
+		},
+		// 2
+		{
+			threshold: 2,
+			reloads:   []error{fmt.Errorf("fail1")},
+			expReady:  "haproxy wasn't successfully reloaded yet",
+		},
+		// 3
+		{
+			threshold: 2,
+			reloads:   []error{fmt.Errorf("fail1"), fmt.Errorf("fail2")},
+			expHealth: "2 consecutive failed reloads, haproxy was never reloaded: fail2",
+			expReady:  "haproxy wasn't successfully reloaded yet",
+		},
+		// 4
+		{
+			threshold: 2,
+			reloads:   []error{fmt.Errorf("fail1"), nil, fmt.Errorf("fail2")},
+		},
+		// 5
+		{
+			reloads: []error{nil, fmt.Errorf("fail1"), fmt.Errorf("fail2")},
+		},
+		// 6
+		{
+			withdraw: time.Minute,
+			reloads:  []error{nil, fmt.Errorf("fail1")},
+		},
+		// 7
+		{
+			withdraw:     time.Minute,
+			unhealthyFor: 2 * time.Minute,
+			reloads:      []error{nil, fmt.Errorf("fail1")},
+			expReady:     "withdrawing address, unhealthy for 2m0s: haproxy config is stale, 1 consecutive failed reloads: fail1",
+		},
+		// 8
+		{
+			withdraw:     time.Minute,
+			unhealthyFor: 2 * time.Minute,
+			reloads:      []error{nil, fmt.Errorf("fail1"), nil},
+		},
+	}
+	errStr := func(err error) string {
+		if err != nil {
+			return err.Error()
+		}
+		return ""
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		c.instance.options.HealthzReloadFail = test.threshold
+		c.instance.options.UnhealthyWithdraw = test.withdraw
+		for _, err := range test.reloads {
+			c.instance.health.reloaded(err)
+		}
+		if test.unhealthyFor > 0 {
+			c.instance.health.unhealthySince = time.Now().Add(-test.unhealthyFor)
+		}
+		if health := errStr(c.instance.CheckHealth()); health != test.expHealth {
+			t.Errorf("health differs on %d - expected: %s, actual: %s", i, test.expHealth, health)
+		}
+		if ready := errStr(c.instance.CheckReady()); ready != test.expReady {
+			t.Errorf("ready differs on %d - expected: %s, actual: %s", i, test.expReady, ready)
+		}
+		c.teardown()
+	}
+}
+
+func TestInstanceOverrideTemplates(t *testing.T) {
+	testCases := []struct {
+		templates     map[string]string
+		expError      string
+		expOverridden bool
+		expChanged    bool
+		logging       string
+	}{
+		// 0
+		{
+			templates:     map[string]string{"haproxy.tmpl": "global\n"},
+			expOverridden: true,
+			expChanged:    true,
+			logging:       `INFO using template overrides: [haproxy.tmpl]`,
+		},
+		// 1
+		{
+			templates:     map[string]string{"haproxy.tmpl": "global\n"},
+			expOverridden: true,
+		},
+		// 2
+		{
+			templates:  map[string]string{"haproxy.tmpl": "global\n    maxconn {{ .Cfg"},
+			expError:   "ignoring template overrides, using the built-in templates: cannot parse template: template: haproxy.tmpl:2: unclosed action",
+			expChanged: true,
+		},
+		// 3
+		{
+			templates:  map[string]string{"haproxy.tmpl": "global\n", "maps.tmpl": ""},
+			expError:   "ignoring template overrides, using the built-in templates: unsupported template: maps.tmpl",
+			expChanged: true,
+		},
+		// 4
+		{
+			templates:     map[string]string{"haproxy.tmpl": "global\n", "map.tmpl": "{{ . }}"},
+			expOverridden: true,
+			expChanged:    true,
+			logging:       `INFO using template overrides: [haproxy.tmpl map.tmpl]`,
+		},
+		// 5
+		{
+			templates:  map[string]string{},
+			expChanged: true,
+		},
+	}
+	c := setup(t)
+	defer c.teardown()
+	c.instance.options.TemplatesDir = "../../rootfs/etc/templates"
+	for i, test := range testCases {
+		c.instance.tmplChanged = false
+		var errMsg string
+		if err := c.instance.OverrideTemplates(test.templates); err != nil {
+			errMsg = err.Error()
+		}
+		if errMsg != test.expError {
+			t.Errorf("error differs on %d - expected: %s, actual: %s", i, test.expError, errMsg)
+		}
+		if c.instance.tmplOverridden != test.expOverridden {
+			t.Errorf("overridden differs on %d - expected: %t, actual: %t", i, test.expOverridden, c.instance.tmplOverridden)
+		}
+		if c.instance.tmplChanged != test.expChanged {
+			t.Errorf("changed differs on %d - expected: %t, actual: %t", i, test.expChanged, c.instance.tmplChanged)
+		}
+		c.logger.CompareLogging(test.logging)
+	}
+}
+
+func TestBuildDisableFrontends(t *testing.T) {
+	testCases := []struct {
+		stats    []map[string]string
+		expected []string
+	}{
+		// 0
+		{},
+		// 1
+		{
+			stats: []map[string]string{
+				{"pxname": "_front_http", "svname": "FRONTEND"},
+				{"pxname": "_front__tls", "svname": "FRONTEND"},
+				{"pxname": "d1_app_8080", "svname": "srv001"},
+				{"pxname": "d1_app_8080", "svname": "BACKEND"},
+			},
+			expected: []string{
+				"disable frontend _front_http",
+				"disable frontend _front__tls",
+			},
+		},
+	}
+	for i, test := range testCases {
+		cmds := buildDisableFrontends(test.stats)
+		if fmt.Sprint(cmds) != fmt.Sprint(test.expected) {
+			t.Errorf("commands differ on %d - expected: %v, actual: %v", i, test.expected, cmds)
+		}
+	}
+}
+
 /* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * *
  *
  *  BUILDERS
@@ -0,0 +1,185 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package haproxy
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/dataplane"
+)
+
+// remote ships the configuration files to haproxy instances running
+// outside the controller pod, via their Data Plane API. The haproxy
+// config files are concatenated and pushed as a raw configuration,
+// other files - maps, certificates, error pages - are uploaded to the
+// general storage, and their paths are changed to the remote ones.
+type remote struct {
+	clients    []*dataplane.Client
+	storageDir string
+	cfgDir     string
+	// sources has all the local dirs, including cfgDir
+	sources []string
+	// uploaded files, per client, name -> hash
+	uploaded []map[string]string
+}
+
+func newRemote(endpoints []string, storageDir, cfgDir string, sources []string) (*remote, error) {
+	r := &remote{
+		storageDir: strings.TrimSuffix(storageDir, "/"),
+		cfgDir:     cfgDir,
+		sources:    sources,
+	}
+	for _, endpoint := range endpoints {
+		client, err := dataplane.NewClient(endpoint, 30*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		r.clients = append(r.clients, client)
+		r.uploaded = append(r.uploaded, map[string]string{})
+	}
+	return r, nil
+}
+
+// storageName flattens a local file path to a general storage file name.
+func storageName(path string) string {
+	return strings.ReplaceAll(strings.TrimPrefix(path, "/"), "/", "_")
+}
+
+// isConfigFile returns true if path is one of the haproxy config files,
+// which are pushed as a single raw configuration.
+func (r *remote) isConfigFile(path string) bool {
+	return filepath.Dir(path) == filepath.Clean(r.cfgDir) && strings.HasSuffix(path, ".cfg")
+}
+
+// build reads the local files, returning the raw configuration and the
+// files that should be uploaded, indexed by their storage names. Local
+// paths are changed to the remote ones.
+func (r *remote) build() (config []byte, files map[string][]byte, err error) {
+	paths, err := listFiles(r.sources)
+	if err != nil {
+		return nil, nil, err
+	}
+	var cfgPaths, filePaths []string
+	for _, path := range paths {
+		if r.isConfigFile(path) {
+			cfgPaths = append(cfgPaths, path)
+		} else {
+			filePaths = append(filePaths, path)
+		}
+	}
+	// longer paths first, so a path isn't partially replaced by a shorter one
+	replaceOrder := append([]string{}, filePaths...)
+	sort.Slice(replaceOrder, func(i, j int) bool {
+		return len(replaceOrder[i]) > len(replaceOrder[j])
+	})
+	oldnew := make([]string, 0, 2*len(replaceOrder))
+	for _, path := range replaceOrder {
+		oldnew = append(oldnew, path, r.storageDir+"/"+storageName(path))
+	}
+	replacer := strings.NewReplacer(oldnew...)
+	files = make(map[string][]byte, len(filePaths))
+	for _, path := range filePaths {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		files[storageName(path)] = []byte(replacer.Replace(string(content)))
+	}
+	var cfg bytes.Buffer
+	for _, path := range cfgPaths {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		cfg.WriteString(replacer.Replace(string(content)))
+		cfg.WriteString("\n")
+	}
+	return cfg.Bytes(), files, nil
+}
+
+// push ships the changed files and the configuration to all the remote
+// instances. onlyValidate asks the remote instances to validate the
+// configuration without applying it, files are uploaded in both cases.
+func (r *remote) push(onlyValidate bool) error {
+	config, files, err := r.build()
+	if err != nil {
+		return err
+	}
+	var errs []string
+	for i := range r.clients {
+		if err := r.pushClient(i, config, files, onlyValidate); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d remote haproxy instance(s) failed:\n%s", len(errs), len(r.clients), strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+func (r *remote) pushClient(i int, config []byte, files map[string][]byte, onlyValidate bool) error {
+	client := r.clients[i]
+	uploaded := r.uploaded[i]
+	for name, content := range files {
+		hash := sha1Hash(content)
+		if uploaded[name] == hash {
+			continue
+		}
+		if err := client.UploadFile(name, content); err != nil {
+			// forces a new upload attempt on the next push
+			delete(uploaded, name)
+			return err
+		}
+		uploaded[name] = hash
+	}
+	if err := client.PushRawConfig(config, onlyValidate); err != nil {
+		return err
+	}
+	if onlyValidate {
+		return nil
+	}
+	for name := range uploaded {
+		if _, found := files[name]; !found {
+			if err := client.DeleteFile(name); err != nil {
+				return err
+			}
+			delete(uploaded, name)
+		}
+	}
+	return nil
+}
+
+// applyServers applies structured server changes to all the remote
+// instances, each one in its own transaction.
+func (r *remote) applyServers(changes []dataplane.ServerChange) error {
+	var errs []string
+	for _, client := range r.clients {
+		if err := client.ApplyServers(changes); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d remote haproxy instance(s) failed:\n%s", len(errs), len(r.clients), strings.Join(errs, "\n"))
+	}
+	return nil
+}
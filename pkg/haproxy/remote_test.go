@@ -0,0 +1,95 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package haproxy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestRemotePush(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempdir)
+	cfgDir := filepath.Join(tempdir, "haproxy")
+	crtDir := filepath.Join(tempdir, "crt")
+	writeFile := func(filename, content string) {
+		_ = os.MkdirAll(filepath.Dir(filename), 0755)
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatalf("error writing %s: %v", filename, err)
+		}
+	}
+	mapFile := filepath.Join(cfgDir, "maps", "_front001_host.map")
+	mapFile2 := filepath.Join(cfgDir, "maps", "_front001_host.map2")
+	crtFile := filepath.Join(crtDir, "default_tls.pem")
+	writeFile(filepath.Join(cfgDir, "haproxy.cfg"), "frontend f\n    bind :443 ssl crt "+crtFile+"\n    use_backend %[base,map("+mapFile+")]\n")
+	writeFile(filepath.Join(cfgDir, "haproxy.cfg.20210101-101010.000"), "old\n")
+	writeFile(mapFile, "d1.local/ default_app_8080\n")
+	writeFile(mapFile2, "d2.local/ default_app_8080\n")
+	writeFile(crtFile, "crt1")
+
+	var reqs []string
+	var config string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut || r.Method == http.MethodDelete {
+			reqs = append(reqs, r.Method+" "+filepath.Base(r.URL.Path))
+		} else if strings.HasSuffix(r.URL.Path, "/raw") {
+			body, _ := ioutil.ReadAll(r.Body)
+			config = string(body)
+		}
+	}))
+	defer server.Close()
+	r, err := newRemote([]string{server.URL}, "/etc/haproxy/general/", cfgDir, []string{cfgDir, crtDir})
+	if err != nil {
+		t.Fatalf("unexpected error creating remote: %v", err)
+	}
+	push := func(expReqs []string) {
+		reqs = nil
+		if err := r.push(false); err != nil {
+			t.Errorf("unexpected error pushing configuration: %v", err)
+		}
+		sort.Strings(reqs)
+		if fmt.Sprint(reqs) != fmt.Sprint(expReqs) {
+			t.Errorf("expected requests %v but was %v", expReqs, reqs)
+		}
+	}
+	mapName := storageName(mapFile)
+	mapName2 := storageName(mapFile2)
+	crtName := storageName(crtFile)
+
+	push([]string{"PUT " + crtName, "PUT " + mapName, "PUT " + mapName2})
+	expConfig := "frontend f\n    bind :443 ssl crt /etc/haproxy/general/" + crtName +
+		"\n    use_backend %[base,map(/etc/haproxy/general/" + mapName + ")]\n\n"
+	if config != expConfig {
+		t.Errorf("expected config:\n%s\nbut was:\n%s", expConfig, config)
+	}
+
+	push(nil)
+
+	writeFile(crtFile, "crt2")
+	_ = os.Remove(mapFile2)
+	push([]string{"DELETE " + mapName2, "PUT " + crtName})
+}
@@ -0,0 +1,285 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package haproxy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// a line of a config file, e.g. `parsing [/etc/haproxy/haproxy.cfg:42] : ...`
+var rollbackLineRegex = regexp.MustCompile(`\[(/[^\]:]+):([0-9]+)\]`)
+
+// a quoted file, e.g. `unable to load SSL certificate from PEM file '/var/lib/haproxy/crt/default.pem'`
+var rollbackFileRegex = regexp.MustCompile(`'(/[^']+)'`)
+
+// rollbackInput is a piece of the configuration that haproxy failed
+// to load: a line of a config file, or the whole content of a file.
+type rollbackInput struct {
+	filename string
+	line     string
+	hash     string
+}
+
+// present returns true if the input is still part of the configuration
+// files, so the same failure is expected if haproxy is reloaded.
+func (in rollbackInput) present() bool {
+	content, err := ioutil.ReadFile(in.filename)
+	if err != nil {
+		return os.IsNotExist(err) && in.line == "" && in.hash == ""
+	}
+	if in.line == "" {
+		return sha1Hash(content) == in.hash
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if line == in.line {
+			return true
+		}
+	}
+	return false
+}
+
+// rollbackFailingInputs returns the lines and files, found in the sources,
+// that haproxy complained about when it failed to reload. All the files
+// that differ from the last known good configuration are used if the
+// reload error doesn't reference any of them.
+func rollbackFailingInputs(reloadErr error, sources []string, good map[string]snapshotFile) ([]rollbackInput, error) {
+	inSources := func(filename string) bool {
+		for _, source := range sources {
+			if strings.HasPrefix(filename, strings.TrimSuffix(source, "/")+"/") {
+				return true
+			}
+		}
+		return false
+	}
+	var inputs []rollbackInput
+	var msg string
+	if reloadErr != nil {
+		msg = reloadErr.Error()
+	}
+	for _, match := range rollbackLineRegex.FindAllStringSubmatch(msg, -1) {
+		filename := match[1]
+		linenum, _ := strconv.Atoi(match[2])
+		if !inSources(filename) || linenum == 0 {
+			continue
+		}
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			continue
+		}
+		lines := strings.Split(string(content), "\n")
+		if linenum <= len(lines) {
+			inputs = append(inputs, rollbackInput{filename: filename, line: lines[linenum-1]})
+		}
+	}
+	for _, match := range rollbackFileRegex.FindAllStringSubmatch(msg, -1) {
+		filename := match[1]
+		if !inSources(filename) {
+			continue
+		}
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			continue
+		}
+		inputs = append(inputs, rollbackInput{filename: filename, hash: sha1Hash(content)})
+	}
+	if len(inputs) > 0 {
+		return inputs, nil
+	}
+	files, err := listFiles(sources)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool, len(files))
+	for _, filename := range files {
+		found[filename] = true
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		hash := sha1Hash(content)
+		if good[filename].SHA1Hash != hash {
+			inputs = append(inputs, rollbackInput{filename: filename, hash: hash})
+		}
+	}
+	for filename := range good {
+		if !found[filename] {
+			// removed since the last known good configuration
+			inputs = append(inputs, rollbackInput{filename: filename})
+		}
+	}
+	return inputs, nil
+}
+
+// rollbackSaveGood updates the copy of the last known good configuration,
+// and leaves the rollback state if haproxy was running a rolled back one.
+func (i *instance) rollbackSaveGood() {
+	if i.lastGood == nil || i.options.fake {
+		return
+	}
+	if i.rollback {
+		i.logger.Info("configuration fixed, leaving the rollback state")
+		i.rollback = false
+		i.failedInputs = nil
+		if err := os.RemoveAll(i.pending.dir); err != nil {
+			i.logger.Warn("error removing the pending configuration: %v", err)
+		}
+		i.pending.files = nil
+	}
+	if _, err := i.lastGood.save(); err != nil {
+		i.logger.Error("error saving the last known good configuration: %v", err)
+	}
+}
+
+// rollbackBlocked returns true if haproxy is running a rolled back
+// configuration and the input that failed to reload - a line of the
+// configuration file or a certificate, for example - is still there.
+// The last known good files are restored in this case, and haproxy is
+// not reloaded. Otherwise the pending configuration, which has all the
+// changes made since the rollback, is copied back so it can be applied.
+func (i *instance) rollbackBlocked() bool {
+	if !i.rollback {
+		return false
+	}
+	err := i.rollbackRefreshPending()
+	if err != nil {
+		i.logger.Error("error updating the pending configuration: %v", err)
+	} else {
+		failing := false
+		for _, in := range i.failedInputs {
+			if in.present() {
+				failing = true
+				break
+			}
+		}
+		if !failing {
+			i.logger.Info("the configuration that failed to reload changed, applying the pending configuration")
+			return false
+		}
+	}
+	if _, err := i.lastGood.restore(true); err != nil {
+		i.logger.Error("error restoring the last known good configuration: %v", err)
+	}
+	i.restoredAt = time.Now()
+	i.logger.Warn("skipping reload, configuration has the same error that caused the rollback. Fix or remove the malformed object")
+	return true
+}
+
+// rollbackRefreshPending merges the files written since the last known good
+// configuration was restored into the pending configuration, and copies it
+// back to the haproxy dirs. Maps and certificates are only written when they
+// change, so the pending copy is the only place where the files that the
+// controller wrote before the rollback are preserved.
+func (i *instance) rollbackRefreshPending() error {
+	files, err := listFiles(i.pending.sources)
+	if err != nil {
+		return err
+	}
+	type written struct {
+		content []byte
+		mode    os.FileMode
+	}
+	changed := make(map[string]written)
+	for _, filename := range files {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return err
+		}
+		if !info.ModTime().After(i.restoredAt) {
+			continue
+		}
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		changed[filename] = written{content: content, mode: info.Mode().Perm()}
+	}
+	if _, err := i.pending.restore(true); err != nil {
+		return err
+	}
+	for filename, w := range changed {
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filename, w.content, w.mode); err != nil {
+			return err
+		}
+	}
+	_, err = i.pending.save()
+	return err
+}
+
+// rollbackFailed restores the last known good configuration and reloads
+// haproxy, after the configured number of consecutive failed reloads.
+// Further failures are rolled back immediately until haproxy is
+// successfully reloaded.
+func (i *instance) rollbackFailed(reloadErr error) {
+	if i.lastGood == nil || i.options.fake {
+		return
+	}
+	i.health.mutex.Lock()
+	reloadFail := i.health.reloadFail
+	i.health.mutex.Unlock()
+	if !i.rollback && reloadFail < i.options.RollbackFailures {
+		return
+	}
+	good, err := i.lastGood.readManifest()
+	if os.IsNotExist(err) {
+		i.logger.Warn("cannot roll back, haproxy was never successfully reloaded")
+		return
+	}
+	if err != nil {
+		i.logger.Error("error reading the last known good configuration: %v", err)
+		return
+	}
+	inputs, err := rollbackFailingInputs(reloadErr, i.lastGood.sources, good)
+	if err != nil {
+		i.logger.Error("error reading the failed configuration: %v", err)
+		return
+	}
+	if _, err := i.pending.save(); err != nil {
+		i.logger.Error("error saving the pending configuration: %v", err)
+		return
+	}
+	restored, err := i.lastGood.restore(true)
+	if err != nil {
+		i.logger.Error("error restoring the last known good configuration: %v", err)
+		return
+	}
+	i.restoredAt = time.Now()
+	if err := i.reload(); err != nil {
+		i.logger.Error("error reloading the last known good configuration:\n%v", err)
+		return
+	}
+	i.health.reloaded(nil)
+	i.rollback = true
+	i.failedInputs = inputs
+	// haproxy output, if any, was already logged; only the first line goes to the event
+	reason := strings.SplitN(reloadErr.Error(), "\n", 2)[0]
+	msg := fmt.Sprintf("haproxy failed to reload %d time(s), rolled back to the last known good configuration (%d files): %s",
+		reloadFail, restored, reason)
+	i.logger.Warn("%s", msg)
+	if i.options.RollbackNotify != nil {
+		i.options.RollbackNotify(msg)
+	}
+}
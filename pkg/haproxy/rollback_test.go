@@ -0,0 +1,202 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package haproxy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRollbackFailingInputs(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempdir)
+	cfgDir := filepath.Join(tempdir, "haproxy")
+	crtDir := filepath.Join(tempdir, "crt")
+	cfgFile := filepath.Join(cfgDir, "haproxy.cfg")
+	mapFile := filepath.Join(cfgDir, "maps", "_front_http_host.map")
+	crtFile := filepath.Join(crtDir, "default_tls.pem")
+	_ = os.MkdirAll(filepath.Dir(mapFile), 0755)
+	_ = os.MkdirAll(crtDir, 0755)
+	_ = ioutil.WriteFile(cfgFile, []byte("global\n    daemon\n    malformed\n"), 0644)
+	_ = ioutil.WriteFile(mapFile, []byte("d1.local/ backend\n"), 0644)
+	_ = ioutil.WriteFile(crtFile, []byte("crt"), 0644)
+	good := map[string]snapshotFile{
+		cfgFile:                              {SHA1Hash: sha1Hash([]byte("global\n    daemon\n"))},
+		mapFile:                              {SHA1Hash: sha1Hash([]byte("d1.local/ backend\n"))},
+		crtFile:                              {SHA1Hash: sha1Hash([]byte("crt"))},
+		filepath.Join(crtDir, "removed.pem"): {SHA1Hash: sha1Hash([]byte("removed"))},
+	}
+	testCases := []struct {
+		err      string
+		expected []rollbackInput
+	}{
+		// 0
+		{
+			err: fmt.Sprintf("[ALERT] : config : parsing [%s:3] : unknown keyword 'malformed'", cfgFile),
+			expected: []rollbackInput{
+				{filename: cfgFile, line: "    malformed"},
+			},
+		},
+		// 1
+		{
+			err: fmt.Sprintf("[ALERT] : config : unable to load SSL certificate from PEM file '%s'", crtFile),
+			expected: []rollbackInput{
+				{filename: crtFile, hash: sha1Hash([]byte("crt"))},
+			},
+		},
+		// 2
+		{
+			err: fmt.Sprintf("parsing [%s:3] : error\nloading '%s'", cfgFile, crtFile),
+			expected: []rollbackInput{
+				{filename: cfgFile, line: "    malformed"},
+				{filename: crtFile, hash: sha1Hash([]byte("crt"))},
+			},
+		},
+		// 3
+		{
+			err: "parsing [/tmp/other.cfg:3] : error in '/tmp/other.pem'",
+			expected: []rollbackInput{
+				{filename: cfgFile, hash: sha1Hash([]byte("global\n    daemon\n    malformed\n"))},
+				{filename: filepath.Join(crtDir, "removed.pem")},
+			},
+		},
+		// 4
+		{
+			err: "exit status 1",
+			expected: []rollbackInput{
+				{filename: cfgFile, hash: sha1Hash([]byte("global\n    daemon\n    malformed\n"))},
+				{filename: filepath.Join(crtDir, "removed.pem")},
+			},
+		},
+	}
+	for i, test := range testCases {
+		inputs, err := rollbackFailingInputs(fmt.Errorf(test.err), []string{cfgDir, crtDir}, good)
+		if err != nil {
+			t.Errorf("%d: unexpected error: %v", i, err)
+		}
+		if !reflect.DeepEqual(inputs, test.expected) {
+			t.Errorf("%d: expected inputs %+v but was %+v", i, test.expected, inputs)
+		}
+		for _, in := range inputs {
+			if !in.present() {
+				t.Errorf("%d: expected input %+v to be present", i, in)
+			}
+		}
+	}
+
+	// the failing line is removed, the whole file changed, the missing file was re-created
+	_ = ioutil.WriteFile(cfgFile, []byte("global\n    daemon\n    nbthread 2\n"), 0644)
+	_ = ioutil.WriteFile(filepath.Join(crtDir, "removed.pem"), []byte("removed"), 0644)
+	for _, in := range []rollbackInput{
+		{filename: cfgFile, line: "    malformed"},
+		{filename: cfgFile, hash: sha1Hash([]byte("global\n    daemon\n    malformed\n"))},
+		{filename: filepath.Join(crtDir, "removed.pem")},
+	} {
+		if in.present() {
+			t.Errorf("expected input %+v to not be present", in)
+		}
+	}
+}
+
+func TestRollbackRefreshPending(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempdir)
+	cfgDir := filepath.Join(tempdir, "haproxy")
+	crtDir := filepath.Join(tempdir, "crt")
+	cfgFile := filepath.Join(cfgDir, "haproxy.cfg")
+	crtFile := filepath.Join(crtDir, "default_tls.pem")
+	newFile := filepath.Join(crtDir, "new.pem")
+	_ = os.MkdirAll(cfgDir, 0755)
+	_ = os.MkdirAll(crtDir, 0755)
+	readFile := func(filename string) string {
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return "<missing>"
+		}
+		return string(content)
+	}
+	sources := []string{cfgDir, crtDir}
+	i := &instance{
+		lastGood: newSnapshot(filepath.Join(tempdir, "rollback"), sources),
+		pending:  newSnapshot(filepath.Join(tempdir, "rollback", "pending"), sources),
+	}
+
+	// last known good configuration
+	_ = ioutil.WriteFile(cfgFile, []byte("good"), 0644)
+	_ = ioutil.WriteFile(crtFile, []byte("crt1"), 0644)
+	if _, err := i.lastGood.save(); err != nil {
+		t.Fatalf("error saving last good: %v", err)
+	}
+
+	// failed configuration, rolled back
+	_ = ioutil.WriteFile(cfgFile, []byte("bad"), 0644)
+	_ = ioutil.WriteFile(crtFile, []byte("crt2"), 0644)
+	if _, err := i.pending.save(); err != nil {
+		t.Fatalf("error saving pending: %v", err)
+	}
+	if _, err := i.lastGood.restore(true); err != nil {
+		t.Fatalf("error restoring last good: %v", err)
+	}
+	i.restoredAt = time.Now()
+
+	// controller renders the config file again and adds a new certificate,
+	// the changed certificate isn't written again
+	time.Sleep(10 * time.Millisecond)
+	_ = ioutil.WriteFile(cfgFile, []byte("fixed"), 0644)
+	_ = ioutil.WriteFile(newFile, []byte("crt3"), 0644)
+	if err := i.rollbackRefreshPending(); err != nil {
+		t.Fatalf("error refreshing pending: %v", err)
+	}
+	for filename, expected := range map[string]string{
+		cfgFile: "fixed",
+		crtFile: "crt2",
+		newFile: "crt3",
+	} {
+		if content := readFile(filename); content != expected {
+			t.Errorf("expected content of %s to be '%s' but was '%s'", filename, expected, content)
+		}
+	}
+
+	// restored again, nothing written by the controller
+	if _, err := i.lastGood.restore(true); err != nil {
+		t.Fatalf("error restoring last good: %v", err)
+	}
+	i.restoredAt = time.Now()
+	if err := i.rollbackRefreshPending(); err != nil {
+		t.Fatalf("error refreshing pending: %v", err)
+	}
+	for filename, expected := range map[string]string{
+		cfgFile: "fixed",
+		crtFile: "crt2",
+		newFile: "crt3",
+	} {
+		if content := readFile(filename); content != expected {
+			t.Errorf("expected content of %s to be '%s' but was '%s'", filename, expected, content)
+		}
+	}
+}
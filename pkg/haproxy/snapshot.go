@@ -0,0 +1,231 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package haproxy
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+const snapshotManifest = "snapshot.json"
+
+// rotated config files, see template.writeToDisk()
+var snapshotSkipRegex = regexp.MustCompile(`\.[0-9]{8}-[0-9]{6}\.[0-9]{3}$`)
+
+// snapshot copies the files used by haproxy - configuration, maps,
+// certificates - to a distinct directory, so a restarted controller
+// can start haproxy with the last applied configuration before the
+// informers finish to sync.
+type snapshot struct {
+	dir     string
+	sources []string
+	files   map[string]snapshotFile
+}
+
+type snapshotData struct {
+	Files map[string]snapshotFile `json:"files"`
+}
+
+type snapshotFile struct {
+	SHA1Hash string      `json:"sha1"`
+	Mode     os.FileMode `json:"mode"`
+}
+
+func newSnapshot(dir string, sources []string) *snapshot {
+	return &snapshot{
+		dir:     dir,
+		sources: sources,
+	}
+}
+
+func (s *snapshot) storage(filename string) string {
+	return filepath.Join(s.dir, "files", filename)
+}
+
+func (s *snapshot) readManifest() (map[string]snapshotFile, error) {
+	content, err := ioutil.ReadFile(filepath.Join(s.dir, snapshotManifest))
+	if err != nil {
+		return nil, err
+	}
+	var data snapshotData
+	if err := json.Unmarshal(content, &data); err != nil {
+		return nil, fmt.Errorf("cannot parse snapshot manifest: %w", err)
+	}
+	return data.Files, nil
+}
+
+func (s *snapshot) listSources() ([]string, error) {
+	return listFiles(s.sources)
+}
+
+// listFiles returns the sorted list of the regular files found in the
+// sources directories, except rotated config files. Missing directories
+// are ignored.
+func listFiles(sources []string) ([]string, error) {
+	var files []string
+	for _, source := range sources {
+		err := filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if info.Mode().IsRegular() && !snapshotSkipRegex.MatchString(path) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// save updates the snapshot with the current content of the sources.
+// Only files whose hash changed since the last save are copied.
+func (s *snapshot) save() (changed int, err error) {
+	if s.files == nil {
+		// missing or broken manifest, all the files are copied
+		s.files, _ = s.readManifest()
+	}
+	sources, err := s.listSources()
+	if err != nil {
+		return 0, err
+	}
+	files := make(map[string]snapshotFile, len(sources))
+	for _, source := range sources {
+		info, err := os.Stat(source)
+		if err != nil {
+			return 0, err
+		}
+		content, err := ioutil.ReadFile(source)
+		if err != nil {
+			return 0, err
+		}
+		f := snapshotFile{SHA1Hash: sha1Hash(content), Mode: info.Mode().Perm()}
+		files[source] = f
+		if s.files[source] == f {
+			continue
+		}
+		target := s.storage(source)
+		if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+			return 0, err
+		}
+		if err := ioutil.WriteFile(target, content, 0600); err != nil {
+			return 0, err
+		}
+		changed++
+	}
+	for source := range s.files {
+		if _, found := files[source]; !found {
+			_ = os.Remove(s.storage(source))
+			changed++
+		}
+	}
+	if changed == 0 {
+		return 0, nil
+	}
+	content, err := json.Marshal(snapshotData{Files: files})
+	if err != nil {
+		return 0, err
+	}
+	manifest := filepath.Join(s.dir, snapshotManifest)
+	if err := ioutil.WriteFile(manifest+".tmp", content, 0600); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(manifest+".tmp", manifest); err != nil {
+		return 0, err
+	}
+	s.files = files
+	return changed, nil
+}
+
+// sourcesHash returns a hash of the current content of the sources.
+func (s *snapshot) sourcesHash() (string, error) {
+	sources, err := s.listSources()
+	if err != nil {
+		return "", err
+	}
+	hash := sha1.New()
+	for _, source := range sources {
+		content, err := ioutil.ReadFile(source)
+		if err != nil {
+			return "", err
+		}
+		hash.Write([]byte(source))
+		hash.Write(content)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// restore copies the files of the snapshot back to their original
+// location. Nothing is copied if a file is missing or its hash doesn't
+// match the one saved in the manifest. prune removes the files found in
+// the sources that aren't part of the snapshot.
+func (s *snapshot) restore(prune bool) (restored int, err error) {
+	files, err := s.readManifest()
+	if err != nil {
+		return 0, err
+	}
+	contents := make(map[string][]byte, len(files))
+	for source, f := range files {
+		content, err := ioutil.ReadFile(s.storage(source))
+		if err != nil || sha1Hash(content) != f.SHA1Hash {
+			return 0, fmt.Errorf("snapshot of '%s' is missing or has an invalid hash", source)
+		}
+		contents[source] = content
+	}
+	for source, f := range files {
+		if err := os.MkdirAll(filepath.Dir(source), 0755); err != nil {
+			return restored, err
+		}
+		if err := ioutil.WriteFile(source, contents[source], f.Mode); err != nil {
+			return restored, err
+		}
+		restored++
+	}
+	if prune {
+		sources, err := s.listSources()
+		if err != nil {
+			return restored, err
+		}
+		for _, source := range sources {
+			if _, found := files[source]; !found {
+				if err := os.Remove(source); err != nil {
+					return restored, err
+				}
+			}
+		}
+	}
+	s.files = files
+	return restored, nil
+}
+
+func sha1Hash(content []byte) string {
+	hash := sha1.Sum(content)
+	return hex.EncodeToString(hash[:])
+}
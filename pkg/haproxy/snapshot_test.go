@@ -0,0 +1,139 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package haproxy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempdir)
+	cfgDir := filepath.Join(tempdir, "haproxy")
+	crtDir := filepath.Join(tempdir, "crt")
+	snapDir := filepath.Join(tempdir, "snapshot")
+	writeFile := func(filename, content string) {
+		_ = os.MkdirAll(filepath.Dir(filename), 0755)
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatalf("error writing %s: %v", filename, err)
+		}
+	}
+	readFile := func(filename string) string {
+		content, _ := ioutil.ReadFile(filename)
+		return string(content)
+	}
+	saveSnapshot := func(s *snapshot, expChanged int) {
+		changed, err := s.save()
+		if err != nil {
+			t.Errorf("unexpected error saving snapshot: %v", err)
+		}
+		if changed != expChanged {
+			t.Errorf("expected %d changed files but was %d", expChanged, changed)
+		}
+	}
+
+	cfgFile := filepath.Join(cfgDir, "haproxy.cfg")
+	mapFile := filepath.Join(cfgDir, "maps", "_front001_host.map")
+	crtFile := filepath.Join(crtDir, "default_tls.pem")
+	writeFile(cfgFile, "global\n")
+	writeFile(cfgFile+".20210101-101010.000", "old global\n")
+	writeFile(mapFile, "d1.local\n")
+	writeFile(crtFile, "crt1")
+
+	s := newSnapshot(snapDir, []string{cfgDir, crtDir, filepath.Join(tempdir, "missing")})
+	saveSnapshot(s, 3)
+	saveSnapshot(s, 0)
+	writeFile(crtFile, "crt2")
+	_ = os.Remove(mapFile)
+	saveSnapshot(s, 2)
+
+	// simulates a new pod, starting with empty dirs
+	_ = os.RemoveAll(cfgDir)
+	_ = os.RemoveAll(crtDir)
+	restored, err := newSnapshot(snapDir, nil).restore(false)
+	if err != nil {
+		t.Errorf("unexpected error restoring snapshot: %v", err)
+	}
+	if restored != 2 {
+		t.Errorf("expected 2 restored files but was %d", restored)
+	}
+	if content := readFile(cfgFile); content != "global\n" {
+		t.Errorf("unexpected content of haproxy.cfg: %s", content)
+	}
+	if content := readFile(crtFile); content != "crt2" {
+		t.Errorf("unexpected content of the certificate: %s", content)
+	}
+	if _, err := os.Stat(mapFile); !os.IsNotExist(err) {
+		t.Errorf("expected removed map file to not be restored")
+	}
+
+	// broken snapshot shouldn't be restored
+	_ = os.RemoveAll(cfgDir)
+	writeFile(filepath.Join(snapDir, "files", crtFile), "crt3")
+	if _, err := newSnapshot(snapDir, nil).restore(false); err == nil {
+		t.Errorf("expected error restoring a broken snapshot")
+	}
+	if _, err := os.Stat(cfgFile); !os.IsNotExist(err) {
+		t.Errorf("expected no file to be restored from a broken snapshot")
+	}
+}
+
+func TestSnapshotRestorePrune(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempdir)
+	cfgDir := filepath.Join(tempdir, "haproxy")
+	_ = os.MkdirAll(cfgDir, 0755)
+	cfgFile := filepath.Join(cfgDir, "haproxy.cfg")
+	shardFile := filepath.Join(cfgDir, "haproxy5-backend001.cfg")
+	rotatedFile := cfgFile + ".20210101-101010.000"
+	_ = ioutil.WriteFile(cfgFile, []byte("good"), 0644)
+	_ = ioutil.WriteFile(rotatedFile, []byte("old"), 0644)
+
+	s := newSnapshot(filepath.Join(tempdir, "rollback"), []string{cfgDir})
+	if _, err := s.save(); err != nil {
+		t.Errorf("unexpected error saving snapshot: %v", err)
+	}
+	goodHash, _ := s.sourcesHash()
+	_ = ioutil.WriteFile(cfgFile, []byte("bad"), 0644)
+	_ = ioutil.WriteFile(shardFile, []byte("bad"), 0644)
+	badHash, _ := s.sourcesHash()
+	if goodHash == badHash {
+		t.Errorf("expected distinct hashes of good and bad sources")
+	}
+
+	if _, err := s.restore(true); err != nil {
+		t.Errorf("unexpected error restoring snapshot: %v", err)
+	}
+	if hash, _ := s.sourcesHash(); hash != goodHash {
+		t.Errorf("expected hash of the restored sources to be %s but was %s", goodHash, hash)
+	}
+	if _, err := os.Stat(shardFile); !os.IsNotExist(err) {
+		t.Errorf("expected file not found in the snapshot to be removed")
+	}
+	if _, err := os.Stat(rotatedFile); err != nil {
+		t.Errorf("expected rotated file to be preserved: %v", err)
+	}
+}
@@ -21,7 +21,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"sync"
 	gotemplate "text/template"
+	"time"
 )
 
 // CreateConfig ...
@@ -32,6 +34,28 @@ func CreateConfig() *Config {
 // Config ...
 type Config struct {
 	templates []*template
+	observer  func(step string, duration time.Duration)
+	workers   int
+}
+
+// Output is the data used to render the templates and the file
+// where the rendered content should be written.
+type Output struct {
+	Data     interface{}
+	Filename string
+}
+
+// SetObserver configures a func that receives the time spent rendering
+// the templates and writing them to disk, on every WriteOutput() call.
+func (c *Config) SetObserver(observer func(step string, duration time.Duration)) {
+	c.observer = observer
+}
+
+// SetWorkers configures the number of goroutines used by WriteOutputs()
+// to render and write the outputs concurrently. A number lesser than 2
+// renders the outputs sequentially.
+func (c *Config) SetWorkers(workers int) {
+	c.workers = workers
 }
 
 // ClearTemplates ...
@@ -45,13 +69,27 @@ func (c *Config) NewTemplate(name, file, output string, rotate, startingBufferSi
 	if err != nil {
 		return fmt.Errorf("cannot read template file: %v", err)
 	}
+	c.addTemplate(tmpl, output, rotate, startingBufferSize)
+	return nil
+}
+
+// NewTemplateText adds a template whose content is text instead of a file.
+func (c *Config) NewTemplateText(name, text, output string, rotate, startingBufferSize int) error {
+	tmpl, err := gotemplate.New(name).Funcs(funcMap).Parse(text)
+	if err != nil {
+		return fmt.Errorf("cannot parse template: %v", err)
+	}
+	c.addTemplate(tmpl, output, rotate, startingBufferSize)
+	return nil
+}
+
+func (c *Config) addTemplate(tmpl *gotemplate.Template, output string, rotate, startingBufferSize int) {
 	c.templates = append(c.templates, &template{
 		tmpl:      tmpl,
 		output:    output,
 		rotate:    rotate,
 		rawConfig: bytes.NewBuffer(make([]byte, 0, startingBufferSize)),
 	})
-	return nil
 }
 
 // Write ...
@@ -61,26 +99,96 @@ func (c *Config) Write(data interface{}) error {
 
 // WriteOutput ...
 func (c *Config) WriteOutput(data interface{}, output string) error {
+	start := time.Now()
 	for _, t := range c.templates {
 		t.rawConfig.Reset()
 		if err := t.tmpl.Execute(t.rawConfig, data); err != nil {
 			return err
 		}
 	}
+	rendered := time.Now()
 	for _, t := range c.templates {
 		if err := t.writeToDisk(output); err != nil {
 			return err
 		}
 	}
+	if c.observer != nil {
+		c.observer("render", rendered.Sub(start))
+		c.observer("write", time.Since(rendered))
+	}
+	return nil
+}
+
+// WriteOutputs renders and writes a list of outputs, concurrently if
+// SetWorkers() was configured. Old files are rotated per output, the
+// same way WriteOutput() does. The error of the first failing output, in the list order, is returned.
+func (c *Config) WriteOutputs(outputs []Output) error {
+	start := time.Now()
+	errs := make([]error, len(outputs))
+	write := func(i int) {
+		var buf bytes.Buffer
+		for _, t := range c.templates {
+			buf.Reset()
+			if err := t.tmpl.Execute(&buf, outputs[i].Data); err != nil {
+				errs[i] = err
+				return
+			}
+			if err := t.rotateFile(outputs[i].Filename); err != nil {
+				errs[i] = err
+				return
+			}
+			if err := ioutil.WriteFile(outputs[i].Filename, buf.Bytes(), 0644); err != nil {
+				errs[i] = fmt.Errorf("cannot write %s: %v", outputs[i].Filename, err)
+				return
+			}
+		}
+	}
+	workers := c.workers
+	if workers > len(outputs) {
+		workers = len(outputs)
+	}
+	if workers < 2 {
+		for i := range outputs {
+			write(i)
+		}
+	} else {
+		next := make(chan int)
+		var wg sync.WaitGroup
+		wg.Add(workers)
+		for w := 0; w < workers; w++ {
+			go func() {
+				defer wg.Done()
+				for i := range next {
+					write(i)
+				}
+			}()
+		}
+		for i := range outputs {
+			next <- i
+		}
+		close(next)
+		wg.Wait()
+	}
+	if c.observer != nil {
+		c.observer("render_write", time.Since(start))
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 type template struct {
-	tmpl        *gotemplate.Template
-	output      string
-	rotate      int
-	rawConfig   *bytes.Buffer
-	configFiles []string
+	tmpl      *gotemplate.Template
+	output    string
+	rotate    int
+	rawConfig *bytes.Buffer
+	// configFiles has the rotated files of each output, the mutex
+	// protects it from the concurrent writes of WriteOutputs()
+	configFiles map[string][]string
+	mutex       sync.Mutex
 }
 
 func (t *template) writeToDisk(output string) error {
@@ -90,32 +198,47 @@ func (t *template) writeToDisk(output string) error {
 	if output == "" {
 		return fmt.Errorf("output file is empty, configure on NewTemplate() or use WriteOutput()")
 	}
-	if t.rotate > 0 {
-		// Include timestamp in rotated config file names to aid troubleshooting.
-		// When using a single, ever-changing config file it was difficult
-		// to know what config was loaded by any given haproxy process
-		//
-		// rename current config file, if exists
-		if f, err := os.Stat(output); f != nil {
-			rotateTo := output + "." + f.ModTime().Format("20060102-150405.000")
-			if err := os.Rename(output, rotateTo); err != nil {
-				return fmt.Errorf("cannot rotate %s: %v", output, err)
-			}
-			t.configFiles = append(t.configFiles, rotateTo)
-		} else if err != nil && !os.IsNotExist(err) {
-			return fmt.Errorf("cannot rotate %s: %v", output, err)
-		}
-		// remove old config files
-		for len(t.configFiles) > t.rotate {
-			name := t.configFiles[0]
-			if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
-				return fmt.Errorf("cannot remove old config file %s: %v", name, err)
-			}
-			t.configFiles = t.configFiles[1:]
-		}
+	if err := t.rotateFile(output); err != nil {
+		return err
 	}
 	if err := ioutil.WriteFile(output, t.rawConfig.Bytes(), 0644); err != nil {
 		return fmt.Errorf("cannot write %s: %v", output, err)
 	}
 	return nil
 }
+
+func (t *template) rotateFile(output string) error {
+	if t.rotate <= 0 {
+		return nil
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.configFiles == nil {
+		t.configFiles = make(map[string][]string)
+	}
+	configFiles := t.configFiles[output]
+	// Include timestamp in rotated config file names to aid troubleshooting.
+	// When using a single, ever-changing config file it was difficult
+	// to know what config was loaded by any given haproxy process
+	//
+	// rename current config file, if exists
+	if f, err := os.Stat(output); f != nil {
+		rotateTo := output + "." + f.ModTime().Format("20060102-150405.000")
+		if err := os.Rename(output, rotateTo); err != nil {
+			return fmt.Errorf("cannot rotate %s: %v", output, err)
+		}
+		configFiles = append(configFiles, rotateTo)
+	} else if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot rotate %s: %v", output, err)
+	}
+	// remove old config files
+	for len(configFiles) > t.rotate {
+		name := configFiles[0]
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("cannot remove old config file %s: %v", name, err)
+		}
+		configFiles = configFiles[1:]
+	}
+	t.configFiles[output] = configFiles
+	return nil
+}
@@ -52,6 +52,40 @@ func TestNewTemplateFileNotFound(t *testing.T) {
 	}
 }
 
+func TestNewTemplateText(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+	if err := c.templateConfig.NewTemplateText("h.cfg", "{{ .", "/tmp/out", 0, 1024); err == nil {
+		t.Errorf("expected error")
+	}
+	output := c.tempdir + string(os.PathSeparator) + "h.cfg"
+	if err := c.templateConfig.NewTemplateText("h.cfg", "name: {{ . }}", output, 0, 1024); err != nil {
+		t.Errorf("error parsing template: %v", err)
+	}
+	if err := c.templateConfig.Write("jack1"); err != nil {
+		t.Errorf("error writing template: %v", err)
+	}
+	if out, _ := ioutil.ReadFile(output); string(out) != "name: jack1" {
+		t.Errorf("expected 'name: jack1' but was '%s'", string(out))
+	}
+}
+
+func TestObserver(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+	var steps []string
+	c.templateConfig.SetObserver(func(step string, duration time.Duration) {
+		steps = append(steps, step)
+	})
+	c.newTemplate("{{ . }}", 0)
+	if err := c.templateConfig.Write("jack1"); err != nil {
+		t.Errorf("error writing template: %v", err)
+	}
+	if fmt.Sprint(steps) != "[render write]" {
+		t.Errorf("expected render and write steps, found: %v", steps)
+	}
+}
+
 func TestWrite(t *testing.T) {
 	type tmplContent struct {
 		content string
@@ -275,6 +309,104 @@ func TestWrite(t *testing.T) {
 	}
 }
 
+func TestWriteOutputs(t *testing.T) {
+	type data1 struct {
+		Name string
+	}
+	testCases := []struct {
+		workers  int
+		content  string
+		rotate   int
+		writes   int
+		names    []string
+		expError string
+	}{
+		// 0
+		{
+			workers: 0,
+			content: "{{ .Name }}",
+			names:   []string{"jack1", "jack2", "jack3"},
+		},
+		// 1
+		{
+			workers: 2,
+			content: "{{ .Name }}",
+			names:   []string{"james1", "james2", "james3", "james4", "james5"},
+		},
+		// 2
+		{
+			workers:  4,
+			content:  "{{ .NameFail }}",
+			names:    []string{"joe1", "joe2"},
+			expError: `template: h1.tmpl:1:3: executing "h1.tmpl" at <.NameFail>: can't evaluate field NameFail in type template.data1`,
+		},
+		// 3
+		{
+			workers: 2,
+			content: "{{ .Name }}",
+			rotate:  2,
+			writes:  2,
+			names:   []string{"jim1", "jim2", "jim3"},
+		},
+		// 4
+		{
+			workers: 2,
+			content: "{{ .Name }}",
+			rotate:  1,
+			writes:  3,
+			names:   []string{"john1", "john2", "john3"},
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		c.newTemplate(test.content, test.rotate)
+		c.templateConfig.SetWorkers(test.workers)
+		var outputs []Output
+		for _, name := range test.names {
+			outputs = append(outputs, Output{
+				Data:     data1{Name: name},
+				Filename: c.tempdir + string(os.PathSeparator) + name + ".cfg",
+			})
+		}
+		writes := test.writes
+		if writes == 0 {
+			writes = 1
+		}
+		var err error
+		for w := 0; w < writes && err == nil; w++ {
+			if w > 0 {
+				// writes would override older configs
+				// generated in the same millisecond
+				time.Sleep(10 * time.Millisecond)
+			}
+			err = c.templateConfig.WriteOutputs(outputs)
+		}
+		if test.expError != "" {
+			if err == nil || err.Error() != test.expError {
+				t.Errorf("error differs on %d, expected '%s' but was '%v'", i, test.expError, err)
+			}
+		} else if err != nil {
+			t.Errorf("unexpected error on %d: %v", i, err)
+		} else {
+			for _, output := range outputs {
+				cnt, _ := ioutil.ReadFile(output.Filename)
+				if expected := output.Data.(data1).Name; string(cnt) != expected {
+					t.Errorf("content differs on %d, expected '%s' but was '%s'", i, expected, string(cnt))
+				}
+				rotated, _ := filepath.Glob(output.Filename + ".*")
+				expRotated := writes - 1
+				if expRotated > test.rotate {
+					expRotated = test.rotate
+				}
+				if len(rotated) != expRotated {
+					t.Errorf("rotated files of %s differs on %d, expected %d but was %d", output.Filename, i, expRotated, len(rotated))
+				}
+			}
+		}
+		c.teardown()
+	}
+}
+
 func (c *testConfig) newTemplate(content string, rotate int) {
 	cnt := len(c.templateConfig.templates) + 1
 	templateFileName := fmt.Sprintf("h%d.tmpl", cnt)
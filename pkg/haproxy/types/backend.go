@@ -55,6 +55,21 @@ func (b *Backend) AcquireEndpoint(ip string, port int, targetRef string) *Endpoi
 	return b.addEndpoint(ip, port, targetRef)
 }
 
+// AddBackupEndpoint adds a backup server, used only when all the
+// endpoints of the backend are down.
+func (b *Backend) AddBackupEndpoint(ip string, port int) *Endpoint {
+	endpoint := &Endpoint{
+		Name:    fmt.Sprintf("backup%03d", len(b.BackupEndpoints)+1),
+		IP:      ip,
+		Port:    port,
+		Target:  fmt.Sprintf("%s:%d", ip, port),
+		Enabled: true,
+		Weight:  1,
+	}
+	b.BackupEndpoints = append(b.BackupEndpoints, endpoint)
+	return endpoint
+}
+
 // AddEmptyEndpoint ...
 func (b *Backend) AddEmptyEndpoint() *Endpoint {
 	endpoint := b.addEndpoint("127.0.0.1", 1023, "")
@@ -131,6 +131,14 @@ func (b *Backends) Commit() {
 	b.itemsAdd = map[string]*Backend{}
 	b.itemsDel = map[string]*Backend{}
 	b.changedShards = map[int]bool{}
+	b.changedAll = false
+}
+
+// ChangeAllShards marks all the shards as changed, so they are rendered
+// again even if none of their backends changed. Used when a global config
+// used in the backend sections changes.
+func (b *Backends) ChangeAllShards() {
+	b.changedAll = true
 }
 
 // Changed ...
@@ -141,12 +149,11 @@ func (b *Backends) Changed() bool {
 // ChangedShards ...
 func (b *Backends) ChangedShards() []int {
 	changed := []int{}
-	for i, c := range b.changedShards {
-		if c {
+	for i := range b.shards {
+		if b.changedAll || b.changedShards[i] {
 			changed = append(changed, i)
 		}
 	}
-	sort.Ints(changed)
 	return changed
 }
 
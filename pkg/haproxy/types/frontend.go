@@ -19,6 +19,7 @@ package types
 import (
 	"fmt"
 	"sort"
+	"strings"
 )
 
 // AcquireAuthBackendName ...
@@ -85,6 +86,31 @@ func hasBackend(backends []BackendID, backend BackendID) bool {
 	return false
 }
 
+// FindPoolCrt returns the filename of the certificate of the default pool
+// that haproxy would select via SNI for hostname: an exact match has
+// precedence over a wildcard one, and the first declared certificate wins
+// on ties. An empty string is returned if no certificate matches.
+func (f *Frontend) FindPoolCrt(hostname string) string {
+	hostname = strings.ToLower(hostname)
+	var domain string
+	if pos := strings.Index(hostname, "."); pos > 0 {
+		domain = hostname[pos:]
+	}
+	var wildcard string
+	for _, crt := range f.DefaultCrtPool {
+		for _, name := range crt.Names {
+			name = strings.ToLower(name)
+			if name == hostname {
+				return crt.Filename
+			}
+			if wildcard == "" && domain != "" && strings.HasPrefix(name, "*.") && name[1:] == domain {
+				wildcard = crt.Filename
+			}
+		}
+	}
+	return wildcard
+}
+
 // Changed ...
 func (f *Frontend) Changed() bool {
 	return f.changed
@@ -188,3 +188,47 @@ func TestRemoveAuthBackendByTarget(t *testing.T) {
 		c.teardown()
 	}
 }
+
+func TestFindPoolCrt(t *testing.T) {
+	pool := []*CrtPoolFile{
+		{Filename: "/tls/wildcard-long.pem", Names: []string{"*.example.com"}},
+		{Filename: "/tls/wildcard.pem", Names: []string{"*.example.com"}},
+		{Filename: "/tls/san.pem", Names: []string{"app.local", "Echo.example.com"}},
+	}
+	testCases := []struct {
+		hostname string
+		expected string
+	}{
+		// 0
+		{
+			hostname: "echo.example.com",
+			expected: "/tls/san.pem",
+		},
+		// 1
+		{
+			hostname: "app.example.com",
+			expected: "/tls/wildcard-long.pem",
+		},
+		// 2
+		{
+			hostname: "App.local",
+			expected: "/tls/san.pem",
+		},
+		// 3
+		{
+			hostname: "sub.app.example.com",
+			expected: "",
+		},
+		// 4
+		{
+			hostname: "example.com",
+			expected: "",
+		},
+	}
+	for i, test := range testCases {
+		f := &Frontend{DefaultCrtPool: pool}
+		if actual := f.FindPoolCrt(test.hostname); actual != test.expected {
+			t.Errorf("pool crt differs on %d - expected: '%s' - actual: '%s'", i, test.expected, actual)
+		}
+	}
+}
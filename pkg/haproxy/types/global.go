@@ -59,6 +59,17 @@ func (c *AcmeStorages) BuildAcmeStorages() []string {
 	return buildAcmeStorages(c.items)
 }
 
+// Names returns the sorted names of the storages, which are the names of
+// the secrets of the certificates.
+func (c *AcmeStorages) Names() []string {
+	names := make([]string, 0, len(c.items))
+	for name := range c.items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // BuildAcmeStoragesAdd ...
 func (c *AcmeStorages) BuildAcmeStoragesAdd() []string {
 	c.shrink()
@@ -84,6 +95,14 @@ func buildAcmeStorages(items map[string]*AcmeCerts) []string {
 		}
 		sort.Strings(certs)
 		storages[i] = name + "," + strings.Join(certs, ",")
+		// options of the order are appended as `;key=value`, domains and
+		// secret names don't have semicolons
+		if item.KeyType != "" {
+			storages[i] += ";key-type=" + item.KeyType
+		}
+		if item.PreferredChain != "" {
+			storages[i] += ";preferred-chain=" + item.PreferredChain
+		}
 		i++
 	}
 	return storages
@@ -121,9 +140,53 @@ func (c *AcmeCerts) AddDomains(domains []string) {
 	}
 }
 
+// FindErrorPage ...
+func (g *Global) FindErrorPage(code int) *ErrorPage {
+	for _, page := range g.ErrorPages {
+		if page.Code == code {
+			return page
+		}
+	}
+	return nil
+}
+
+// HasRules ...
+func (b *BotMitigationConfig) HasRules() bool {
+	return len(b.UserAgents) > 0 || len(b.Paths) > 0
+}
+
 // IsExternal ...
 func (e *ExternalConfig) IsExternal() bool {
-	return e.MasterSocket != ""
+	return e.MasterSocket != "" || e.Remote
+}
+
+// HasLua ...
+func (c *Capabilities) HasLua() bool {
+	// nil means unknown capabilities, eg an external haproxy, so features are assumed as available
+	return c == nil || c.Lua
+}
+
+// HasOpenTracing ...
+func (c *Capabilities) HasOpenTracing() bool {
+	return c == nil || c.OpenTracing
+}
+
+func (c *Capabilities) String() string {
+	if c == nil {
+		return "unknown"
+	}
+	var features []string
+	add := func(name string, enabled bool) {
+		if enabled {
+			features = append(features, name)
+		}
+	}
+	add("jwt", c.JWT)
+	add("lua", c.Lua)
+	add("opentracing", c.OpenTracing)
+	add("otel", c.OTel)
+	add("quic", c.QUIC)
+	return fmt.Sprintf("version=%s features=%s", c.Version, strings.Join(features, ","))
 }
 
 func (dns *DNSConfig) String() string {
@@ -147,3 +210,43 @@ func (b GlobalBindConfig) ShareHTTPPort() bool {
 func (b GlobalBindConfig) HasFrontingProxy() bool {
 	return b.FrontingBind != ""
 }
+
+// HTTPInternalIDs ...
+func (b GlobalBindConfig) HTTPInternalIDs() []int {
+	return internalIDs(b.HTTPExtra)
+}
+
+// HTTPSInternalIDs ...
+func (b GlobalBindConfig) HTTPSInternalIDs() []int {
+	return internalIDs(b.HTTPSExtra)
+}
+
+// HTTPTenantIDs ...
+func (b GlobalBindConfig) HTTPTenantIDs() map[string][]int {
+	return tenantIDs(b.HTTPExtra)
+}
+
+// HTTPSTenantIDs ...
+func (b GlobalBindConfig) HTTPSTenantIDs() map[string][]int {
+	return tenantIDs(b.HTTPSExtra)
+}
+
+func tenantIDs(binds []*BindExtraConfig) map[string][]int {
+	ids := map[string][]int{}
+	for _, bind := range binds {
+		if bind.Tenant != "" {
+			ids[bind.Tenant] = append(ids[bind.Tenant], bind.ID)
+		}
+	}
+	return ids
+}
+
+func internalIDs(binds []*BindExtraConfig) []int {
+	var ids []int
+	for _, bind := range binds {
+		if bind.Internal {
+			ids = append(ids, bind.ID)
+		}
+	}
+	return ids
+}
@@ -25,7 +25,10 @@ import (
 func TestBuildAcmeStorages(t *testing.T) {
 	testCases := []struct {
 		certs    [][]string
+		keyType  string
+		chain    string
 		expected []string
+		expNames []string
 	}{
 		// 0
 		{
@@ -35,6 +38,7 @@ func TestBuildAcmeStorages(t *testing.T) {
 			expected: []string{
 				"cert1,d1.local",
 			},
+			expNames: []string{"cert1"},
 		},
 		// 1
 		{
@@ -45,6 +49,7 @@ func TestBuildAcmeStorages(t *testing.T) {
 			expected: []string{
 				"cert1,d1.local,d2.local,d3.local",
 			},
+			expNames: []string{"cert1"},
 		},
 		// 2
 		{
@@ -56,18 +61,37 @@ func TestBuildAcmeStorages(t *testing.T) {
 				"cert1,d1.local,d2.local",
 				"cert2,d2.local,d3.local",
 			},
+			expNames: []string{"cert1", "cert2"},
+		},
+		// 3
+		{
+			certs: [][]string{
+				{"cert1", "d1.local"},
+			},
+			keyType: "ecdsa256",
+			chain:   "ISRG Root X1",
+			expected: []string{
+				"cert1,d1.local;key-type=ecdsa256;preferred-chain=ISRG Root X1",
+			},
+			expNames: []string{"cert1"},
 		},
 	}
 	for i, test := range testCases {
 		acme := AcmeData{}
 		for _, cert := range test.certs {
-			acme.Storages().Acquire(cert[0]).AddDomains(cert[1:])
+			storage := acme.Storages().Acquire(cert[0])
+			storage.AddDomains(cert[1:])
+			storage.KeyType = test.keyType
+			storage.PreferredChain = test.chain
 		}
 		storages := acme.Storages().BuildAcmeStorages()
 		sort.Strings(storages)
 		if !reflect.DeepEqual(storages, test.expected) {
 			t.Errorf("acme certs differs on %d - expected: %+v, actual: %+v", i, test.expected, storages)
 		}
+		if names := acme.Storages().Names(); !reflect.DeepEqual(names, test.expNames) {
+			t.Errorf("acme names differs on %d - expected: %+v, actual: %+v", i, test.expNames, names)
+		}
 	}
 }
 
@@ -85,45 +109,45 @@ func TestShrink(t *testing.T) {
 		},
 		// 1
 		{
-			itemAdd: map[string]*AcmeCerts{"cert1": {d1}},
-			expAdd:  map[string]*AcmeCerts{"cert1": {d1}},
+			itemAdd: map[string]*AcmeCerts{"cert1": {certs: d1}},
+			expAdd:  map[string]*AcmeCerts{"cert1": {certs: d1}},
 			expDel:  map[string]*AcmeCerts{},
 		},
 		// 2
 		{
-			itemAdd: map[string]*AcmeCerts{"cert1": {d1}},
-			itemDel: map[string]*AcmeCerts{"cert1": {d1}},
+			itemAdd: map[string]*AcmeCerts{"cert1": {certs: d1}},
+			itemDel: map[string]*AcmeCerts{"cert1": {certs: d1}},
 			expAdd:  map[string]*AcmeCerts{},
 			expDel:  map[string]*AcmeCerts{},
 		},
 		// 3
 		{
 			itemAdd: map[string]*AcmeCerts{
-				"cert1": {d1},
-				"cert2": {d1},
+				"cert1": {certs: d1},
+				"cert2": {certs: d1},
 			},
 			itemDel: map[string]*AcmeCerts{
-				"cert1": {d1},
-				"cert2": {d2},
+				"cert1": {certs: d1},
+				"cert2": {certs: d2},
 			},
 			expAdd: map[string]*AcmeCerts{
-				"cert2": {d1},
+				"cert2": {certs: d1},
 			},
 			expDel: map[string]*AcmeCerts{
-				"cert2": {d2},
+				"cert2": {certs: d2},
 			},
 		},
 		// 4
 		{
 			itemAdd: map[string]*AcmeCerts{
-				"cert1": {d1},
-				"cert2": {d1},
+				"cert1": {certs: d1},
+				"cert2": {certs: d1},
 			},
 			itemDel: map[string]*AcmeCerts{
-				"cert1": {d1},
+				"cert1": {certs: d1},
 			},
 			expAdd: map[string]*AcmeCerts{
-				"cert2": {d1},
+				"cert2": {certs: d1},
 			},
 			expDel: map[string]*AcmeCerts{},
 		},
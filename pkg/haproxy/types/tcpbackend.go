@@ -98,3 +98,19 @@ func (b *TCPBackend) AddEndpoint(ip string, port int) *TCPEndpoint {
 	b.Endpoints = append(b.Endpoints, ep)
 	return ep
 }
+
+// CrtFilenames returns the certificates of the bind of a TCP service. The
+// certificate of the default service, if any, comes first and is used when
+// the client doesn't send the SNI extension.
+func (b *TCPBackend) CrtFilenames() []string {
+	var crts []string
+	if b.SSL.Filename != "" {
+		crts = append(crts, b.SSL.Filename)
+	}
+	for _, route := range b.SNIRoutes {
+		if route.SSL.Filename != "" {
+			crts = append(crts, route.SSL.Filename)
+		}
+	}
+	return crts
+}
@@ -37,7 +37,9 @@ type AcmeStorages struct {
 
 // AcmeCerts ...
 type AcmeCerts struct {
-	certs map[string]struct{}
+	certs          map[string]struct{}
+	KeyType        string
+	PreferredChain string
 }
 
 // Acme ...
@@ -55,13 +57,19 @@ type Global struct {
 	Syslog                  SyslogConfig
 	MaxConn                 int
 	Timeout                 TimeoutConfig
+	Retry                   BackendRetryConfig
+	Tracing                 TracingConfig
+	Tune                    TuneConfig
 	SSL                     SSLConfig
 	DNS                     DNSConfig
 	ModSecurity             ModSecurityConfig
+	SPOEAgents              []*SPOEAgent
 	Cookie                  CookieConfig
 	DrainSupport            DrainConfig
 	Acme                    Acme
+	BotMitigation           BotMitigationConfig
 	ForwardFor              string
+	Hardening               HardeningConfig
 	LoadServerState         bool
 	AdminSocket             string
 	External                ExternalConfig
@@ -69,12 +77,16 @@ type Global struct {
 	Master                  MasterConfig
 	MatchOrder              []MatchType
 	Prometheus              PromConfig
+	RealIP                  RealIPConfig
 	Security                SecurityConfig
+	SourceAllowlist         SourceAllowlistConfig
 	Stats                   StatsConfig
 	StrictHost              bool
 	UseHTX                  bool
 	DefaultBackendRedir     string
 	DefaultBackendRedirCode int
+	DefaultPages            string
+	ErrorPages              []*ErrorPage
 	CustomConfig            []string
 	CustomDefaults          []string
 	CustomFrontend          []string
@@ -83,15 +95,93 @@ type Global struct {
 	CustomTCP               []string
 }
 
+// SourceAllowlistConfig ...
+type SourceAllowlistConfig struct {
+	CIDR       []string
+	Interfaces []string
+}
+
+// RealIPConfig ...
+type RealIPConfig struct {
+	Header      string
+	TrustedCIDR []string
+}
+
+// TracingConfig ...
+type TracingConfig struct {
+	Mode         string
+	HeaderB3     bool
+	HeaderW3C    bool
+	OTConfigFile string
+	OTID         string
+}
+
+// TuneConfig ...
+type TuneConfig struct {
+	BufSize           int64
+	H2HeaderTableSize int
+	HTTPMaxHeaders    int
+}
+
+// HardeningConfig has the DDoS mitigation rules of the HTTP and HTTPS
+// frontends. Clients exceeding any of the rates, measured in a 10s period,
+// have their connections silently dropped. A zero rate disables its rule.
+// MaxConn is the maxconn of the proxies, lower than the global maxconn so
+// stats, healthz and prometheus are still reachable during an attack.
+type HardeningConfig struct {
+	Enabled     bool
+	ConnRate    int
+	HTTPReqRate int
+	HTTPErrRate int
+	TableSize   string
+	MaxConn     int
+}
+
+// BotMitigationConfig has the patterns of the requests, usually from bots
+// and vulnerability scanners, that are denied or tarpitted in the hosts
+// that opt in. UserAgents are case insensitive substrings of the User-Agent
+// header, Paths are prefixes of the request path. The filenames are filled
+// when the lists are written.
+type BotMitigationConfig struct {
+	UserAgents     []string
+	Paths          []string
+	UserAgentsFile string
+	PathsFile      string
+}
+
+// ErrorPage ...
+type ErrorPage struct {
+	Code     int
+	Content  string
+	Filename string
+}
+
 // GlobalBindConfig ...
 type GlobalBindConfig struct {
-	AcceptProxy      bool
-	HTTPBind         string
-	HTTPSBind        string
-	TCPBindIP        string
-	FrontingBind     string
-	FrontingSockID   int
-	FrontingUseProto bool
+	HTTPAcceptProxy     bool
+	HTTPSAcceptProxy    bool
+	HTTPBind            string
+	HTTPSBind           string
+	TCPBindIP           string
+	FrontingAcceptProxy bool
+	FrontingBind        string
+	FrontingSockID      int
+	FrontingUseProto    bool
+	HTTPExtra           []*BindExtraConfig
+	HTTPSExtra          []*BindExtraConfig
+}
+
+// BindExtraConfig ...
+type BindExtraConfig struct {
+	Addr        string
+	ID          int
+	AcceptProxy bool
+	ALPN        string
+	Ciphers     string
+	Internal    bool
+	SSLMinVer   string
+	Tenant      string
+	Thread      string
 }
 
 // ProcsConfig ...
@@ -175,6 +265,32 @@ type ModSecurityConfig struct {
 	Timeout   ModSecurityTimeoutConfig
 }
 
+// SPOEAgent ...
+type SPOEAgent struct {
+	Name      string
+	Endpoints []string
+	Messages  []*SPOEMessage
+	Timeout   SPOEAgentTimeoutConfig
+}
+
+// SPOEMessage ...
+type SPOEMessage struct {
+	Name  string
+	Args  string
+	Event string
+}
+
+// SPOEAgentTimeoutConfig ...
+type SPOEAgentTimeoutConfig struct {
+	// Backend
+	Connect string
+	Server  string
+	// SPOE
+	Hello      string
+	Idle       string
+	Processing string
+}
+
 // CookieConfig ...
 type CookieConfig struct {
 	Key string
@@ -190,6 +306,17 @@ type DrainConfig struct {
 type ExternalConfig struct {
 	HasLua       bool
 	MasterSocket string
+	Remote       bool
+}
+
+// Capabilities ...
+type Capabilities struct {
+	Version     string
+	JWT         bool
+	Lua         bool
+	OpenTracing bool
+	OTel        bool
+	QUIC        bool
 }
 
 // HealthzConfig ...
@@ -241,6 +368,8 @@ type ModSecurityTimeoutConfig struct {
 // TCPBackends ...
 type TCPBackends struct {
 	items, itemsAdd, itemsDel map[int]*TCPBackend
+	// AcmeStorages has the acme storages added by the TCP services
+	AcmeStorages []string
 }
 
 // TCPBackend ...
@@ -251,6 +380,10 @@ type TCPBackend struct {
 	CheckInterval string
 	SSL           TCPSSL
 	ProxyProt     TCPProxyProt
+	// SNI routing, SNI is only declared in the items of SNIRoutes
+	SNI            string
+	SNIPassthrough bool
+	SNIRoutes      []*TCPBackend
 }
 
 // TCPEndpoint ...
@@ -266,6 +399,7 @@ type TCPSSL struct {
 	Filename    string
 	CAFilename  string
 	CRLFilename string
+	ServerSSL   bool
 }
 
 // TCPProxyProt ...
@@ -324,6 +458,11 @@ type FrontendMaps struct {
 	RedirCodeMap      *HostsMap
 	SSLPassthroughMap *HostsMap
 	VarNamespaceMap   *HostsMap
+	InternalHostMap   *HostsMap
+	TenantHostMap     *HostsMap
+	DrainRedirMap     *HostsMap
+	DrainGoneList     *HostsMap
+	BotMitigationMap  *HostsMap
 	//
 	TLSAuthList           *HostsMap
 	TLSNeedCrtList        *HostsMap
@@ -359,11 +498,20 @@ type Frontend struct {
 	//
 	DefaultCrtFile string
 	DefaultCrtHash string
+	DefaultCrtPool []*CrtPoolFile
 	CrtListFile    string
 	//
 	DefaultServerRedirectCode int
 }
 
+// CrtPoolFile is a certificate of the default certificate pool. It is added
+// to the crt-list, so haproxy can select it via SNI if a host doesn't have
+// its own certificate.
+type CrtPoolFile struct {
+	Filename string
+	Names    []string
+}
+
 // DefaultHost ...
 const DefaultHost = "<default>"
 
@@ -386,9 +534,13 @@ type Host struct {
 	Paths    []*HostPath
 	//
 	Alias                  HostAliasConfig
+	BotMitigation          string
+	Drain                  HostDrainConfig
 	Redirect               HostRedirectConfig
 	HTTPPassthroughBackend string
+	Internal               bool
 	RootRedirect           string
+	Tenant                 string
 	TLS                    HostTLSConfig
 	VarNamespace           bool
 	//
@@ -446,6 +598,14 @@ type HostAliasConfig struct {
 	AliasRegex string
 }
 
+// HostDrainConfig has the response of a host whose ingress resources were
+// removed, while its drain period doesn't expire: a redirect to Location
+// if declared, or 410 Gone otherwise.
+type HostDrainConfig struct {
+	Draining bool
+	Location string
+}
+
 // HostRedirectConfig ...
 type HostRedirectConfig struct {
 	RedirectCode      int
@@ -464,7 +624,10 @@ type HostTLSConfig struct {
 	CipherSuites     string
 	CRLFilename      string
 	CRLHash          string
+	Curves           string
 	Options          string
+	SSLMaxVer        string
+	SSLMinVer        string
 	TLSCommonName    string
 	TLSFilename      string
 	TLSHash          string
@@ -488,6 +651,7 @@ type EndpointCookieStrategy int
 const (
 	EpCookieName EndpointCookieStrategy = iota
 	EpCookiePodUID
+	EpCookieNameHash
 )
 
 // Backends ...
@@ -497,6 +661,7 @@ type Backends struct {
 	authBackends   map[string]*Backend
 	shards         []map[string]*Backend
 	changedShards  map[int]bool
+	changedAll     bool
 	DefaultBackend *Backend
 }
 
@@ -531,23 +696,35 @@ type Backend struct {
 	//
 	// per backend config
 	//
-	AgentCheck       AgentCheck
-	AllowedIPTCP     AccessConfig
-	BalanceAlgorithm string
-	BlueGreen        BlueGreenConfig
-	Cookie           Cookie
-	CustomConfig     []string
-	DeniedIPTCP      AccessConfig
-	Dynamic          DynBackendConfig
-	EpCookieStrategy EndpointCookieStrategy
-	Headers          []*BackendHeader
-	HealthCheck      HealthCheck
-	Limit            BackendLimit
-	ModeTCP          bool
-	Resolver         string
-	Server           ServerConfig
-	Timeout          BackendTimeoutConfig
-	TLS              BackendTLSConfig
+	AgentCheck            AgentCheck
+	AllowedIPTCP          AccessConfig
+	AuthPassthrough       bool
+	BackupEndpoints       []*Endpoint
+	BalanceAlgorithm      string
+	BlueGreen             BlueGreenConfig
+	BufferRequest         bool
+	Cache                 BackendCache
+	Cookie                Cookie
+	CustomConfig          []string
+	DeniedIPTCP           AccessConfig
+	Dynamic               DynBackendConfig
+	EpCookieStrategy      EndpointCookieStrategy
+	Headers               []*BackendHeader
+	HealthCheck           HealthCheck
+	Limit                 BackendLimit
+	MaxHeaderSize         int64
+	ModeTCP               bool
+	Resolver              string
+	ResolverTarget        string
+	Retry                 BackendRetryConfig
+	Server                ServerConfig
+	Source                BackendSource
+	SPOEAgents            []string
+	SSLRedirectExceptions []string
+	Timeout               BackendTimeoutConfig
+	TLS                   BackendTLSConfig
+	Tracing               TracingConfig
+	WebSocket             bool
 }
 
 // Endpoint ...
@@ -563,6 +740,14 @@ type Endpoint struct {
 	CookieValue string
 }
 
+// BackendCache ...
+type BackendCache struct {
+	Enabled       bool
+	MaxAge        int
+	MaxObjectSize int64
+	TotalMaxSize  int64
+}
+
 // BlueGreenConfig ...
 type BlueGreenConfig struct {
 	CookieName string
@@ -590,16 +775,35 @@ type BackendPath struct {
 	//
 	// config fields
 	//
-	AllowedIPHTTP AccessConfig
-	AuthHTTP      AuthHTTP
-	AuthExternal  AuthExternal
-	Cors          Cors
-	DeniedIPHTTP  AccessConfig
-	HSTS          HSTS
-	MaxBodySize   int64
-	RewriteURL    string
-	SSLRedirect   bool
-	WAF           WAF
+	AccessLog       AccessLog
+	AllowedIPHTTP   AccessConfig
+	AuthHTTP        AuthHTTP
+	AuthExternal    AuthExternal
+	Cors            Cors
+	DeniedIPHTTP    AccessConfig
+	HSTS            HSTS
+	MaxBodySize     int64
+	RewriteResponse []*RewriteHeader
+	RewriteURL      string
+	SecurityHeaders SecurityHeaders
+	SSLRedirect     bool
+	WAF             WAF
+}
+
+// AccessLog ...
+type AccessLog struct {
+	Disabled bool
+	// SampleThreshold is the number of requests, out of 10000, that should
+	// be logged. Zero means to log everything.
+	SampleThreshold int
+}
+
+// RewriteHeader is a response header rewrite, Regex and Replace are
+// the arguments of a `http-response replace-header` keyword.
+type RewriteHeader struct {
+	Name    string
+	Regex   string
+	Replace string
 }
 
 // BackendHeader ...
@@ -625,19 +829,29 @@ type DynBackendConfig struct {
 
 // HealthCheck ...
 type HealthCheck struct {
-	Addr      string
-	FallCount int
-	Interval  string
-	Port      int
-	RiseCount int
-	URI       string
+	Addr         string
+	ErrorLimit   int
+	ExpectStatus string
+	ExpectString string
+	FallCount    int
+	Interval     string
+	Method       string
+	Observe      string
+	OnError      string
+	Port         int
+	RiseCount    int
+	URI          string
 }
 
 // BackendLimit ...
 type BackendLimit struct {
-	Connections int
-	RPS         int
-	Whitelist   []string
+	Connections      int
+	ConnectionsQueue bool
+	Key              string
+	RPS              int
+	TableExpire      string
+	TableSize        string
+	Whitelist        []string
 }
 
 // AccessConfig ...
@@ -659,6 +873,7 @@ type ServerConfig struct {
 	InitialWeight int
 	MaxConn       int
 	MaxQueue      int
+	MinConn       int
 	Options       string
 	Protocol      string
 	Secure        bool
@@ -667,6 +882,12 @@ type ServerConfig struct {
 	VerifyHost    string
 }
 
+// BackendSource ...
+type BackendSource struct {
+	Address   string
+	Interface string
+}
+
 // BackendTimeoutConfig ...
 type BackendTimeoutConfig struct {
 	Connect     string
@@ -678,6 +899,16 @@ type BackendTimeoutConfig struct {
 	Tunnel      string
 }
 
+// BackendRetryConfig ...
+type BackendRetryConfig struct {
+	// Redispatch is used only if RedispatchOverride is true, otherwise
+	// the redispatch option of the defaults section is used
+	Redispatch         bool
+	RedispatchOverride bool
+	Retries            string
+	RetryOn            string
+}
+
 // BackendTLSConfig ...
 type BackendTLSConfig struct {
 	AddCertHeader    bool
@@ -693,13 +924,18 @@ type UserlistConfig struct {
 
 // Cookie ...
 type Cookie struct {
-	Name     string
-	Dynamic  bool
-	Preserve bool
-	SameSite bool
-	Shared   bool
-	Strategy string
-	Keywords string
+	Name       string
+	Domain     string
+	Dynamic    bool
+	DynamicKey string
+	HTTPOnly   bool
+	MaxAge     int
+	Preserve   bool
+	SameSite   string
+	Secure     bool
+	Shared     bool
+	Strategy   string
+	Keywords   string
 }
 
 // AuthExternal ...
@@ -737,6 +973,13 @@ type HSTS struct {
 	Preload    bool
 }
 
+// SecurityHeaders ...
+type SecurityHeaders struct {
+	ContentSecurityPolicy string
+	FrameOptions          string
+	ReferrerPolicy        string
+}
+
 // WAF Defines the WAF Config structure for the Backend
 type WAF struct {
 	// Mode defines On or DetectionOnly
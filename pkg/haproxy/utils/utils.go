@@ -20,12 +20,15 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"os/exec"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	k8snet "k8s.io/apimachinery/pkg/util/net"
 
+	hatypes "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/types"
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/utils"
 )
 
@@ -122,6 +125,20 @@ func HAProxyProcs(masterSocket string) (*ProcTable, error) {
 	}
 }
 
+// HAProxyCurrentProcs reads and converts `show proc` from the master CLI to a
+// ProcTable instance. Unlike HAProxyProcs, an error is returned without waiting
+// if the master CLI cannot be reached.
+func HAProxyCurrentProcs(masterSocket string) (*ProcTable, error) {
+	out, err := haproxyCmd(masterSocket, nil, "show proc")
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return &ProcTable{}, nil
+	}
+	return buildProcTable(out[0]), nil
+}
+
 // buildProcTable parses `show proc` output and creates a corresponding ProcTable
 //
 //                   1               3               4               6               8               9
@@ -176,3 +193,216 @@ func buildProcTable(procOutput string) *ProcTable {
 	}
 	return &procTable
 }
+
+// ServerState is a server of the `show servers state` output.
+type ServerState struct {
+	Backend    string
+	Server     string
+	Addr       string
+	Port       int
+	OpState    int
+	AdminState int
+}
+
+// server admin state flags, see `show servers state` in the management guide
+const (
+	srvAdminStateMaint = 0x01 | 0x02 | 0x04 | 0x20
+	srvAdminStateDrain = 0x08 | 0x10
+)
+
+// Maint ...
+func (s *ServerState) Maint() bool {
+	return s.AdminState&srvAdminStateMaint != 0
+}
+
+// Drain ...
+func (s *ServerState) Drain() bool {
+	return s.AdminState&srvAdminStateDrain != 0
+}
+
+// Up ...
+func (s *ServerState) Up() bool {
+	return s.OpState == 2
+}
+
+// HAProxyServersState reads and converts `show servers state` from the admin
+// socket. All the backends are read if backend is empty.
+func HAProxyServersState(socket, backend string) ([]ServerState, error) {
+	cmd := "show servers state"
+	if backend != "" {
+		cmd += " " + backend
+	}
+	out, err := haproxyCmd(socket, nil, cmd)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return buildServersState(out[0])
+}
+
+// buildServersState parses the version 1 of the `show servers state` output,
+// the header is used to find the fields of every server line:
+//
+//   1
+//   # be_id be_name srv_id srv_name srv_addr srv_op_state srv_admin_state ... srv_port ...
+//   3 default_app_8080 1 srv001 10.0.0.11 2 0 1 1 43 6 3 4 6 0 0 0 - 8080 -
+//
+func buildServersState(stateOutput string) ([]ServerState, error) {
+	lines := utils.LineToSlice(stateOutput)
+	if len(lines) < 2 {
+		return nil, nil
+	}
+	if version := strings.TrimSpace(lines[0]); version != "1" {
+		return nil, fmt.Errorf("unsupported servers state version: %s", version)
+	}
+	fields := map[string]int{}
+	for i, field := range strings.Fields(strings.TrimPrefix(lines[1], "#")) {
+		fields[field] = i
+	}
+	for _, field := range []string{"be_name", "srv_name", "srv_addr", "srv_op_state", "srv_admin_state", "srv_port"} {
+		if _, found := fields[field]; !found {
+			return nil, fmt.Errorf("missing servers state field: %s", field)
+		}
+	}
+	var states []ServerState
+	for _, line := range lines[2:] {
+		values := strings.Fields(line)
+		if len(values) < len(fields) {
+			continue
+		}
+		atoi := func(field string) int {
+			i, _ := strconv.Atoi(values[fields[field]])
+			return i
+		}
+		states = append(states, ServerState{
+			Backend:    values[fields["be_name"]],
+			Server:     values[fields["srv_name"]],
+			Addr:       values[fields["srv_addr"]],
+			Port:       atoi("srv_port"),
+			OpState:    atoi("srv_op_state"),
+			AdminState: atoi("srv_admin_state"),
+		})
+	}
+	return states, nil
+}
+
+// HAProxySSLCerts reads the certificate files loaded by haproxy, and the
+// expiration date of each of them, from `show ssl cert`.
+func HAProxySSLCerts(socket string, observer func(duration time.Duration)) (map[string]time.Time, error) {
+	out, err := haproxyCmd(socket, observer, "show ssl cert")
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	filenames := buildSSLCertList(out[0])
+	if len(filenames) == 0 {
+		return nil, nil
+	}
+	cmds := make([]string, len(filenames))
+	for i, filename := range filenames {
+		cmds[i] = "show ssl cert " + filename
+	}
+	out, err = haproxyCmd(socket, observer, cmds...)
+	if err != nil {
+		return nil, err
+	}
+	certs := make(map[string]time.Time, len(filenames))
+	for i, filename := range filenames {
+		var notAfter time.Time
+		if i < len(out) {
+			notAfter = buildSSLCertNotAfter(out[i])
+		}
+		certs[filename] = notAfter
+	}
+	return certs, nil
+}
+
+// buildSSLCertList parses the output of `show ssl cert` without arguments.
+// Files of an uncommitted transaction are prefixed with `*` and are skipped.
+func buildSSLCertList(certOutput string) []string {
+	var filenames []string
+	for _, line := range utils.LineToSlice(certOutput) {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || line[0] == '*' {
+			continue
+		}
+		filenames = append(filenames, line)
+	}
+	return filenames
+}
+
+// buildSSLCertNotAfter reads the expiration date from the output of
+// `show ssl cert <filename>`, a zero time is returned if not found.
+func buildSSLCertNotAfter(certOutput string) time.Time {
+	for _, line := range utils.LineToSlice(certOutput) {
+		sep := strings.Index(line, ":")
+		if sep < 0 || !strings.EqualFold(line[:sep], "notAfter") {
+			continue
+		}
+		// ASN1_TIME_print() format, e.g. `Sep  5 21:20:51 2020 GMT`
+		notAfter, err := time.Parse("Jan _2 15:04:05 2006 MST", strings.TrimSpace(line[sep+1:]))
+		if err != nil {
+			return time.Time{}
+		}
+		return notAfter.UTC()
+	}
+	return time.Time{}
+}
+
+// HAProxyCapabilities reads the version and the optional features of the
+// local haproxy binary from `haproxy -vv`.
+func HAProxyCapabilities() (*hatypes.Capabilities, error) {
+	out, err := exec.Command("haproxy", "-vv").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("error running haproxy -vv: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return buildCapabilities(string(out)), nil
+}
+
+var haproxyVersionRegex = regexp.MustCompile(`^HA-?Proxy version ([0-9]+)\.([0-9]+)[^ ]*`)
+
+// buildCapabilities parses `haproxy -vv` output. Features are read from the
+// `Feature list` line, and from the `Built with` lines of older versions:
+//
+//   HAProxy version 2.3.10-4764f0e 2021/04/22 - https://haproxy.org/
+//   ...
+//   Feature list : +EPOLL -KQUEUE +NETFILTER +OPENSSL +LUA -OT -QUIC ...
+//   ...
+//   Built with Lua version : Lua 5.3.6
+//
+func buildCapabilities(vv string) *hatypes.Capabilities {
+	caps := &hatypes.Capabilities{}
+	var major, minor int
+	features := map[string]bool{}
+	for _, line := range utils.LineToSlice(vv) {
+		line = strings.TrimSpace(line)
+		if v := haproxyVersionRegex.FindStringSubmatch(line); v != nil {
+			caps.Version = strings.Fields(line)[2]
+			major, _ = strconv.Atoi(v[1])
+			minor, _ = strconv.Atoi(v[2])
+		} else if strings.HasPrefix(line, "Feature list :") {
+			for _, feature := range strings.Fields(strings.TrimPrefix(line, "Feature list :")) {
+				if strings.HasPrefix(feature, "+") {
+					features[feature[1:]] = true
+				}
+			}
+		} else if strings.HasPrefix(line, "Built with Lua version") {
+			features["LUA"] = true
+		} else if strings.HasPrefix(line, "Built with OpenTracing support") {
+			features["OT"] = true
+		} else if strings.HasPrefix(line, "Built with OpenSSL version") {
+			features["OPENSSL"] = true
+		}
+	}
+	caps.Lua = features["LUA"]
+	caps.OpenTracing = features["OT"]
+	caps.OTel = features["OTEL"]
+	caps.QUIC = features["QUIC"]
+	// jwt_verify converter was added in 2.5 and needs openssl
+	caps.JWT = features["OPENSSL"] && (major > 2 || major == 2 && minor >= 5)
+	return caps
+}
@@ -22,6 +22,8 @@ import (
 	"syscall"
 	"testing"
 	"time"
+
+	hatypes "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/types"
 )
 
 func TestHAProxyCommand(t *testing.T) {
@@ -212,7 +214,7 @@ func TestHAProxyProcsLoop(t *testing.T) {
 		start := time.Now()
 		_, err := HAProxyProcs("")
 		if err != nil {
-			t.Errorf("%d should not return an error: %w", i, err)
+			t.Errorf("%d should not return an error: %v", i, err)
 		}
 		elapsed := time.Now().Sub(start)
 		if elapsed < test.minDelay {
@@ -224,6 +226,207 @@ func TestHAProxyProcsLoop(t *testing.T) {
 	}
 }
 
+func TestHAProxyCurrentProcs(t *testing.T) {
+	c := setup(t)
+	c.cmdError = syscall.ECONNREFUSED
+	if _, err := HAProxyCurrentProcs(""); err == nil {
+		t.Errorf("expected connection refused error")
+	}
+	if c.callCnt != 1 {
+		t.Errorf("expected one call to the master socket, but was %d", c.callCnt)
+	}
+	c.cmdError = nil
+	c.cmdOutput = []string{`#<PID>          <type>          <relative PID>  <reloads>       <uptime>        <version>
+1               master          0               1               0d00h00m08s     2.2.3-0e58a34
+# workers
+3               worker          1               0               0d00h00m00s     2.2.3-0e58a34
+# old workers
+# programs
+
+`}
+	out, err := HAProxyCurrentProcs("")
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	expected := &ProcTable{
+		Master:  Proc{Type: "master", PID: 1, RPID: 0, Reloads: 1},
+		Workers: []Proc{{Type: "worker", PID: 3, RPID: 1, Reloads: 0}},
+	}
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("expected %+v but was %+v", expected, out)
+	}
+}
+
+func TestHAProxyServersState(t *testing.T) {
+	testCases := []struct {
+		output   string
+		expected []ServerState
+		expError string
+	}{
+		// 0
+		{
+			output: "1\n# be_id be_name srv_id srv_name srv_addr srv_op_state srv_admin_state srv_uweight srv_iweight srv_time_since_last_change srv_check_status srv_check_result srv_check_health srv_check_state srv_agent_state bk_f_forced_id srv_f_forced_id srv_fqdn srv_port srvrecord\n",
+		},
+		// 1
+		{
+			output: `1
+# be_id be_name srv_id srv_name srv_addr srv_op_state srv_admin_state srv_uweight srv_iweight srv_time_since_last_change srv_check_status srv_check_result srv_check_health srv_check_state srv_agent_state bk_f_forced_id srv_f_forced_id srv_fqdn srv_port srvrecord
+3 default_app_8080 1 srv001 10.0.0.11 2 0 1 1 43 6 3 4 6 0 0 0 - 8080 -
+3 default_app_8080 2 srv002 10.0.0.12 2 8 1 1 43 6 3 4 6 0 0 0 - 8080 -
+3 default_app_8080 3 srv003 127.0.0.1 0 5 1 1 43 1 0 0 14 0 0 0 - 1023 -
+`,
+			expected: []ServerState{
+				{Backend: "default_app_8080", Server: "srv001", Addr: "10.0.0.11", Port: 8080, OpState: 2, AdminState: 0},
+				{Backend: "default_app_8080", Server: "srv002", Addr: "10.0.0.12", Port: 8080, OpState: 2, AdminState: 8},
+				{Backend: "default_app_8080", Server: "srv003", Addr: "127.0.0.1", Port: 1023, OpState: 0, AdminState: 5},
+			},
+		},
+		// 2
+		{
+			output:   "2\n# be_id be_name\n",
+			expError: "unsupported servers state version: 2",
+		},
+		// 3
+		{
+			output:   "1\n# be_id be_name srv_id srv_name\n",
+			expError: "missing servers state field: srv_addr",
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		c.cmdOutput = []string{test.output}
+		states, err := HAProxyServersState("", "")
+		var errMsg string
+		if err != nil {
+			errMsg = err.Error()
+		}
+		if errMsg != test.expError {
+			t.Errorf("error differs on %d - expected: %s - actual: %s", i, test.expError, errMsg)
+		}
+		if !reflect.DeepEqual(states, test.expected) {
+			t.Errorf("servers state differs on %d - expected: %+v, actual: %+v", i, test.expected, states)
+		}
+	}
+	states, _ := buildServersState(testCases[1].output)
+	if !states[0].Up() || states[0].Drain() || states[0].Maint() {
+		t.Errorf("expected srv001 up")
+	}
+	if !states[1].Drain() || states[1].Maint() {
+		t.Errorf("expected srv002 in drain")
+	}
+	if states[2].Up() || !states[2].Maint() {
+		t.Errorf("expected srv003 down and in maint")
+	}
+}
+
+func TestBuildSSLCerts(t *testing.T) {
+	filenames := buildSSLCertList(`# transaction
+*/var/lib/haproxy/crt/default_app.pem
+# filename
+/var/lib/haproxy/crt/default-fake-certificate.pem
+/var/lib/haproxy/crt/default_app.pem
+`)
+	expFilenames := []string{
+		"/var/lib/haproxy/crt/default-fake-certificate.pem",
+		"/var/lib/haproxy/crt/default_app.pem",
+	}
+	if !reflect.DeepEqual(filenames, expFilenames) {
+		t.Errorf("filenames differ - expected: %v - actual: %v", expFilenames, filenames)
+	}
+
+	testCases := []struct {
+		output   string
+		expected time.Time
+	}{
+		// 0
+		{
+			output: `Filename: /var/lib/haproxy/crt/default_app.pem
+Status: Used
+Serial: 0D933C1B1089BF660AE5253A245BB388
+notBefore: Sep 13 21:20:51 2019 GMT
+notAfter: Sep  5 21:20:51 2020 GMT
+Subject Alternative Name: DNS:d1.local
+`,
+			expected: time.Date(2020, 9, 5, 21, 20, 51, 0, time.UTC),
+		},
+		// 1
+		{
+			output:   "notAfter: Dec 31 23:59:59 2030 GMT",
+			expected: time.Date(2030, 12, 31, 23, 59, 59, 0, time.UTC),
+		},
+		// 2
+		{
+			output: "Filename: /var/lib/haproxy/crt/default_app.pem\nStatus: Unused\n",
+		},
+		// 3
+		{
+			output: "notAfter: invalid",
+		},
+	}
+	for i, test := range testCases {
+		notAfter := buildSSLCertNotAfter(test.output)
+		if !notAfter.Equal(test.expected) {
+			t.Errorf("notAfter differs on %d - expected: %v - actual: %v", i, test.expected, notAfter)
+		}
+	}
+}
+
+func TestBuildCapabilities(t *testing.T) {
+	testCases := []struct {
+		vv       string
+		expected *hatypes.Capabilities
+	}{
+		// 0
+		{
+			expected: &hatypes.Capabilities{},
+		},
+		// 1
+		{
+			vv: `
+HA-Proxy version 2.0.22-b2ee8d5 2021/04/01 - https://haproxy.org/
+Build options :
+  TARGET  = linux-glibc
+Built with OpenSSL version : OpenSSL 1.1.1k  25 Mar 2021
+Built with Lua version : Lua 5.3.6
+`,
+			expected: &hatypes.Capabilities{Version: "2.0.22-b2ee8d5", Lua: true},
+		},
+		// 2
+		{
+			vv: `
+HAProxy version 2.3.10-4764f0e 2021/04/22 - https://haproxy.org/
+Feature list : +EPOLL -KQUEUE +NETFILTER +PCRE -PCRE_JIT +OPENSSL +LUA -OT
+Built with OpenSSL version : OpenSSL 1.1.1k  25 Mar 2021
+Built with Lua version : Lua 5.3.6
+`,
+			expected: &hatypes.Capabilities{Version: "2.3.10-4764f0e", Lua: true},
+		},
+		// 3
+		{
+			vv: `
+HAProxy version 2.6.0-a1efc04 2022/05/31 - https://haproxy.org/
+Feature list : +EPOLL -KQUEUE +NETFILTER +OPENSSL -LUA +OT +QUIC
+Built with OpenTracing support.
+`,
+			expected: &hatypes.Capabilities{Version: "2.6.0-a1efc04", JWT: true, OpenTracing: true, QUIC: true},
+		},
+		// 4
+		{
+			vv: `
+HAProxy version 2.4.0-6cbbecf 2021/05/14 - https://haproxy.org/
+Feature list : +EPOLL -OPENSSL +LUA
+`,
+			expected: &hatypes.Capabilities{Version: "2.4.0-6cbbecf", Lua: true},
+		},
+	}
+	for i, test := range testCases {
+		caps := buildCapabilities(test.vv)
+		if !reflect.DeepEqual(caps, test.expected) {
+			t.Errorf("capabilities differs on %d - expected: %+v, actual: %+v", i, test.expected, caps)
+		}
+	}
+}
+
 type testConfig struct {
 	t         *testing.T
 	cmdOutput []string
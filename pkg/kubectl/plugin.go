@@ -0,0 +1,477 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubectl
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// adminClient sends requests to the admin endpoints of the controller pods.
+// request reaches the read only endpoints of the healthz port, and runtime
+// reaches the runtime api, which changes the state of the controller and
+// authenticates its clients.
+type adminClient interface {
+	controllers() ([]string, error)
+	request(method, pod, path string, params map[string]string) ([]byte, error)
+	runtime(method, pod, path string, params map[string]string) ([]byte, error)
+}
+
+type pluginOptions struct {
+	kubeconfig    string
+	context       string
+	namespace     string
+	selector      string
+	pod           string
+	port          int
+	runtimePort   int
+	tlsCert       string
+	tlsKey        string
+	tlsCA         string
+	tlsServerName string
+}
+
+type command struct {
+	usage string
+	short string
+	run   func(o *pluginOptions, client adminClient, args []string, stdout io.Writer) error
+}
+
+var commands = map[string]command{
+	"backends": {
+		usage: "backends [backend]",
+		short: "Show the backend servers, their pods and state in haproxy",
+		run:   runBackends,
+	},
+	"drain": {
+		usage: "drain <namespace>/<pod>",
+		short: "Drain the backend servers of a pod: new connections are sent to other servers",
+		run:   runPodState("drain"),
+	},
+	"enable": {
+		usage: "enable <namespace>/<pod>",
+		short: "Move the backend servers of a drained pod back to the ready state",
+		run:   runPodState("ready"),
+	},
+	"diff": {
+		usage: "diff [file]",
+		short: "Show the running haproxy.cfg, or its differences to a local file, e.g. the render output",
+		run:   runDiff,
+	},
+	"resync": {
+		usage: "resync",
+		short: "Trigger a full resync: all the ingress resources are parsed again",
+		run:   runResync,
+	},
+	"deps": {
+		usage: "deps [name]",
+		short: "Show the tracker dependencies between resources, hostnames and backends",
+		run:   runDeps,
+	},
+}
+
+// NewCommand creates the root command of the kubectl-haproxy_ingress plugin.
+// The read only admin endpoints of the controller are reached through the
+// pod proxy of the API server, so the user only needs permission to proxy
+// the controller pods. Commands that change the state of the controller
+// connect to the runtime api of the pods using a client certificate.
+func NewCommand(stdout, stderr io.Writer) *cobra.Command {
+	var opt pluginOptions
+	root := &cobra.Command{
+		Use:           "haproxy-ingress",
+		Short:         "Operational actions on the HAProxy Ingress controller pods",
+		SilenceErrors: true,
+		SilenceUsage:  true,
+	}
+	root.SetOut(stdout)
+	root.SetErr(stderr)
+	// kubectl doesn't complete the commands of plugins
+	root.CompletionOptions.DisableDefaultCmd = true
+	opt.addFlags(root.PersistentFlags())
+	for _, cmd := range commands {
+		run := cmd.run
+		root.AddCommand(&cobra.Command{
+			Use:   cmd.usage,
+			Short: cmd.short,
+			RunE: func(c *cobra.Command, args []string) error {
+				client, err := opt.createClient()
+				if err != nil {
+					return err
+				}
+				return run(&opt, client, args, c.OutOrStdout())
+			},
+		})
+	}
+	return root
+}
+
+func (o *pluginOptions) addFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&o.kubeconfig, "kubeconfig", "",
+		`Path to a kubeconfig file, defaults to $KUBECONFIG or ~/.kube/config`)
+	flags.StringVar(&o.context, "context", "",
+		`Name of the kubeconfig context to use`)
+	flags.StringVarP(&o.namespace, "namespace", "n", "ingress-controller",
+		`Namespace of the controller pods`)
+	flags.StringVarP(&o.selector, "selector", "l", "app.kubernetes.io/name=haproxy-ingress",
+		`Label selector of the controller pods`)
+	flags.StringVar(&o.pod, "pod", "",
+		`Name of a single controller pod, all the selected pods are used if empty`)
+	flags.IntVar(&o.port, "port", 10254,
+		`Port of the controller's healthz and admin endpoints, see the controller's --healthz-port`)
+	flags.IntVar(&o.runtimePort, "runtime-api-port", 10262,
+		`Port of the controller's runtime api, see the controller's --runtime-api-address`)
+	flags.StringVar(&o.tlsCert, "tls-cert", "",
+		`Client certificate used to connect to the runtime api, needed by drain, enable and resync`)
+	flags.StringVar(&o.tlsKey, "tls-key", "",
+		`Private key of the client certificate`)
+	flags.StringVar(&o.tlsCA, "tls-ca", "",
+		`CA bundle used to validate the certificate of the runtime api`)
+	flags.StringVar(&o.tlsServerName, "tls-server-name", "",
+		`Name used to validate the certificate of the runtime api, defaults to the IP of the pod`)
+}
+
+func (o *pluginOptions) createClient() (adminClient, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = o.kubeconfig
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		rules, &clientcmd.ConfigOverrides{CurrentContext: o.context}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error reading kubeconfig: %w", err)
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &kubeClient{
+		client:    client,
+		options:   o,
+		namespace: o.namespace,
+		selector:  o.selector,
+		pod:       o.pod,
+		port:      o.port,
+		podIPs:    map[string]string{},
+	}, nil
+}
+
+type kubeClient struct {
+	client     kubernetes.Interface
+	options    *pluginOptions
+	namespace  string
+	selector   string
+	pod        string
+	port       int
+	podIPs     map[string]string
+	httpClient *http.Client
+}
+
+func (c *kubeClient) controllers() ([]string, error) {
+	if c.pod != "" {
+		pod, err := c.client.CoreV1().Pods(c.namespace).Get(context.Background(), c.pod, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		c.podIPs[pod.Name] = pod.Status.PodIP
+		return []string{c.pod}, nil
+	}
+	pods, err := c.client.CoreV1().Pods(c.namespace).List(context.Background(), metav1.ListOptions{LabelSelector: c.selector})
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == api.PodRunning {
+			names = append(names, pod.Name)
+			c.podIPs[pod.Name] = pod.Status.PodIP
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no running controller pod found in namespace '%s' with selector '%s'", c.namespace, c.selector)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (c *kubeClient) request(method, pod, path string, params map[string]string) ([]byte, error) {
+	req := c.client.CoreV1().RESTClient().Verb(method).
+		Namespace(c.namespace).
+		Resource("pods").
+		SubResource("proxy").
+		Name(fmt.Sprintf("%s:%d", pod, c.port)).
+		Suffix(path)
+	for name, value := range params {
+		req = req.Param(name, value)
+	}
+	out, err := req.DoRaw(context.Background())
+	if err != nil && len(out) > 0 {
+		// the admin endpoints answer errors in plain text
+		return nil, fmt.Errorf("%s", strings.TrimSpace(string(out)))
+	}
+	return out, err
+}
+
+func (c *kubeClient) runtime(method, pod, path string, params map[string]string) ([]byte, error) {
+	if c.httpClient == nil {
+		tlsConfig, err := c.options.runtimeTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		c.httpClient = &http.Client{
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+			Timeout:   30 * time.Second,
+		}
+	}
+	ip := c.podIPs[pod]
+	if ip == "" {
+		return nil, fmt.Errorf("pod has no IP address")
+	}
+	query := url.Values{}
+	for name, value := range params {
+		query.Set(name, value)
+	}
+	u := url.URL{
+		Scheme:   "https",
+		Host:     net.JoinHostPort(ip, strconv.Itoa(c.options.runtimePort)),
+		Path:     path,
+		RawQuery: query.Encode(),
+	}
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	out, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		// the runtime api answers errors in plain text
+		return nil, fmt.Errorf("%s", strings.TrimSpace(string(out)))
+	}
+	return out, nil
+}
+
+func (o *pluginOptions) runtimeTLSConfig() (*tls.Config, error) {
+	if o.tlsCert == "" || o.tlsKey == "" {
+		return nil, fmt.Errorf("--tls-cert and --tls-key are needed to connect to the runtime api")
+	}
+	cert, err := tls.LoadX509KeyPair(o.tlsCert, o.tlsKey)
+	if err != nil {
+		return nil, fmt.Errorf("error reading client certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ServerName:   o.tlsServerName,
+	}
+	if o.tlsCA != "" {
+		ca, err := ioutil.ReadFile(o.tlsCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in %s", o.tlsCA)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// forEachController runs fn on all the controller pods, adding a header
+// with the pod name if more than one pod is found.
+func forEachController(client adminClient, stdout io.Writer, fn func(pod string) error) error {
+	pods, err := client.controllers()
+	if err != nil {
+		return err
+	}
+	for i, pod := range pods {
+		if len(pods) > 1 {
+			if i > 0 {
+				fmt.Fprintln(stdout)
+			}
+			fmt.Fprintf(stdout, "# %s\n", pod)
+		}
+		if err := fn(pod); err != nil {
+			return fmt.Errorf("%s: %w", pod, err)
+		}
+	}
+	return nil
+}
+
+type serverState struct {
+	Backend string `json:"backend"`
+	Server  string `json:"server"`
+	Address string `json:"address"`
+	Pod     string `json:"pod"`
+	State   string `json:"state"`
+}
+
+func runBackends(o *pluginOptions, client adminClient, args []string, stdout io.Writer) error {
+	if len(args) > 1 {
+		return fmt.Errorf("expected at most one backend name")
+	}
+	return forEachController(client, stdout, func(pod string) error {
+		out, err := client.request(http.MethodGet, pod, "/servers", nil)
+		if err != nil {
+			return err
+		}
+		var servers []serverState
+		if err := json.Unmarshal(out, &servers); err != nil {
+			return fmt.Errorf("error decoding servers state: %w", err)
+		}
+		w := tabwriter.NewWriter(stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "BACKEND\tSERVER\tADDRESS\tPOD\tSTATE")
+		for _, s := range servers {
+			if len(args) == 1 && s.Backend != args[0] {
+				continue
+			}
+			pod := s.Pod
+			if pod == "" {
+				pod = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", s.Backend, s.Server, s.Address, pod, s.State)
+		}
+		return w.Flush()
+	})
+}
+
+func runPodState(state string) func(o *pluginOptions, client adminClient, args []string, stdout io.Writer) error {
+	return func(o *pluginOptions, client adminClient, args []string, stdout io.Writer) error {
+		if len(args) != 1 || strings.Count(args[0], "/") != 1 {
+			return fmt.Errorf("expected one pod in the form namespace/name")
+		}
+		params := map[string]string{"pod": args[0], "state": state}
+		return forEachController(client, stdout, func(pod string) error {
+			out, err := client.runtime(http.MethodPost, pod, "/v1/pod-state", params)
+			if err != nil {
+				return err
+			}
+			var servers []string
+			if err := json.Unmarshal(out, &servers); err != nil {
+				return fmt.Errorf("error decoding servers: %w", err)
+			}
+			for _, server := range servers {
+				fmt.Fprintf(stdout, "%s: %s\n", server, state)
+			}
+			return nil
+		})
+	}
+}
+
+func runDiff(o *pluginOptions, client adminClient, args []string, stdout io.Writer) error {
+	if len(args) > 1 {
+		return fmt.Errorf("expected at most one file name")
+	}
+	var local []byte
+	if len(args) == 1 {
+		var err error
+		if local, err = ioutil.ReadFile(args[0]); err != nil {
+			return err
+		}
+	}
+	return forEachController(client, stdout, func(pod string) error {
+		running, err := client.request(http.MethodGet, pod, "/debug/haproxy.cfg", nil)
+		if err != nil {
+			return err
+		}
+		if local == nil {
+			_, err := stdout.Write(running)
+			return err
+		}
+		for _, line := range lineDiff(splitLines(running), splitLines(local)) {
+			fmt.Fprintln(stdout, line)
+		}
+		return nil
+	})
+}
+
+func runResync(o *pluginOptions, client adminClient, args []string, stdout io.Writer) error {
+	if len(args) > 0 {
+		return fmt.Errorf("resync does not expect arguments")
+	}
+	return forEachController(client, stdout, func(pod string) error {
+		out, err := client.runtime(http.MethodPost, pod, "/v1/resync", nil)
+		if err != nil {
+			return err
+		}
+		_, err = stdout.Write(out)
+		return err
+	})
+}
+
+func runDeps(o *pluginOptions, client adminClient, args []string, stdout io.Writer) error {
+	if len(args) > 1 {
+		return fmt.Errorf("expected at most one resource, hostname or backend name")
+	}
+	return forEachController(client, stdout, func(pod string) error {
+		out, err := client.request(http.MethodGet, pod, "/debug/cache", nil)
+		if err != nil {
+			return err
+		}
+		var cache struct {
+			Tracker map[string]map[string][]string `json:"tracker"`
+		}
+		if err := json.Unmarshal(out, &cache); err != nil {
+			return fmt.Errorf("error decoding cache: %w", err)
+		}
+		links := make([]string, 0, len(cache.Tracker))
+		for link := range cache.Tracker {
+			links = append(links, link)
+		}
+		sort.Strings(links)
+		for _, link := range links {
+			sources := make([]string, 0, len(cache.Tracker[link]))
+			for source := range cache.Tracker[link] {
+				if len(args) == 0 || source == args[0] {
+					sources = append(sources, source)
+				}
+			}
+			if len(sources) == 0 {
+				continue
+			}
+			sort.Strings(sources)
+			fmt.Fprintf(stdout, "%s:\n", link)
+			for _, source := range sources {
+				fmt.Fprintf(stdout, "  %s: %s\n", source, strings.Join(cache.Tracker[link][source], ", "))
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,306 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubectl
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type clientMock struct {
+	pods      []string
+	responses map[string]string
+	reqs      []string
+}
+
+func (c *clientMock) controllers() ([]string, error) {
+	if len(c.pods) == 0 {
+		return nil, fmt.Errorf("no running controller pod found")
+	}
+	return c.pods, nil
+}
+
+func (c *clientMock) request(method, pod, path string, params map[string]string) ([]byte, error) {
+	return c.do(method, pod, path, params)
+}
+
+func (c *clientMock) runtime(method, pod, path string, params map[string]string) ([]byte, error) {
+	return c.do(method, pod+"/runtime", path, params)
+}
+
+func (c *clientMock) do(method, pod, path string, params map[string]string) ([]byte, error) {
+	req := method + " " + pod + path
+	if len(params) > 0 {
+		req += fmt.Sprintf("?pod=%s&state=%s", params["pod"], params["state"])
+	}
+	c.reqs = append(c.reqs, req)
+	out, found := c.responses[path]
+	if !found {
+		return nil, fmt.Errorf("404 page not found")
+	}
+	return []byte(out), nil
+}
+
+func TestCommands(t *testing.T) {
+	dir, err := ioutil.TempDir("", "haproxy-ingress-kubectl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	localCfg := filepath.Join(dir, "haproxy.cfg")
+	if err := ioutil.WriteFile(localCfg, []byte("global\n    maxconn 4000\ndefaults\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	servers := `[
+  {"backend":"default_app_8080","server":"srv001","address":"10.0.0.11:8080","pod":"default/app-1","state":"up"},
+  {"backend":"default_app_8080","server":"srv002","address":"127.0.0.1:1023","state":"maint"},
+  {"backend":"default_web_80","server":"srv001","address":"10.0.0.12:80","pod":"default/web-1","state":"drain"}
+]`
+	testCases := []struct {
+		pods      []string
+		responses map[string]string
+		cmd       string
+		args      []string
+		expReqs   []string
+		expOutput string
+		expError  string
+	}{
+		// 0
+		{
+			pods:      []string{"haproxy-1"},
+			responses: map[string]string{"/servers": servers},
+			cmd:       "backends",
+			expReqs:   []string{"GET haproxy-1/servers"},
+			expOutput: `
+BACKEND            SERVER   ADDRESS          POD             STATE
+default_app_8080   srv001   10.0.0.11:8080   default/app-1   up
+default_app_8080   srv002   127.0.0.1:1023   -               maint
+default_web_80     srv001   10.0.0.12:80     default/web-1   drain
+`,
+		},
+		// 1
+		{
+			pods:      []string{"haproxy-1", "haproxy-2"},
+			responses: map[string]string{"/servers": servers},
+			cmd:       "backends",
+			args:      []string{"default_web_80"},
+			expReqs:   []string{"GET haproxy-1/servers", "GET haproxy-2/servers"},
+			expOutput: `
+# haproxy-1
+BACKEND          SERVER   ADDRESS        POD             STATE
+default_web_80   srv001   10.0.0.12:80   default/web-1   drain
+
+# haproxy-2
+BACKEND          SERVER   ADDRESS        POD             STATE
+default_web_80   srv001   10.0.0.12:80   default/web-1   drain
+`,
+		},
+		// 2
+		{
+			pods:      []string{"haproxy-1"},
+			responses: map[string]string{"/v1/pod-state": `["default_app_8080/srv001","default_app2_8080/srv003"]`},
+			cmd:       "drain",
+			args:      []string{"default/app-1"},
+			expReqs:   []string{"POST haproxy-1/runtime/v1/pod-state?pod=default/app-1&state=drain"},
+			expOutput: `
+default_app_8080/srv001: drain
+default_app2_8080/srv003: drain
+`,
+		},
+		// 3
+		{
+			pods:      []string{"haproxy-1"},
+			responses: map[string]string{"/v1/pod-state": `["default_app_8080/srv001"]`},
+			cmd:       "enable",
+			args:      []string{"default/app-1"},
+			expReqs:   []string{"POST haproxy-1/runtime/v1/pod-state?pod=default/app-1&state=ready"},
+			expOutput: `
+default_app_8080/srv001: ready
+`,
+		},
+		// 4
+		{
+			pods:     []string{"haproxy-1"},
+			cmd:      "drain",
+			args:     []string{"app-1"},
+			expError: "expected one pod in the form namespace/name",
+		},
+		// 5
+		{
+			pods:     []string{"haproxy-1"},
+			cmd:      "enable",
+			args:     []string{"default/app-1"},
+			expReqs:  []string{"POST haproxy-1/runtime/v1/pod-state?pod=default/app-1&state=ready"},
+			expError: "haproxy-1: 404 page not found",
+		},
+		// 6
+		{
+			pods:      []string{"haproxy-1"},
+			responses: map[string]string{"/debug/haproxy.cfg": "global\n    maxconn 2000\ndefaults\n"},
+			cmd:       "diff",
+			expReqs:   []string{"GET haproxy-1/debug/haproxy.cfg"},
+			expOutput: `
+global
+    maxconn 2000
+defaults
+`,
+		},
+		// 7
+		{
+			pods:      []string{"haproxy-1"},
+			responses: map[string]string{"/debug/haproxy.cfg": "global\n    maxconn 2000\ndefaults\n"},
+			cmd:       "diff",
+			args:      []string{localCfg},
+			expReqs:   []string{"GET haproxy-1/debug/haproxy.cfg"},
+			expOutput: `
+@@ line 2
+-    maxconn 2000
++    maxconn 4000
+`,
+		},
+		// 8
+		{
+			pods:      []string{"haproxy-1", "haproxy-2"},
+			responses: map[string]string{"/v1/resync": "Full resync successfully started.\n"},
+			cmd:       "resync",
+			expReqs:   []string{"POST haproxy-1/runtime/v1/resync", "POST haproxy-2/runtime/v1/resync"},
+			expOutput: `
+# haproxy-1
+Full resync successfully started.
+
+# haproxy-2
+Full resync successfully started.
+`,
+		},
+		// 9
+		{
+			pods: []string{"haproxy-1"},
+			responses: map[string]string{"/debug/cache": `{
+  "tracker": {
+    "ingressHostname": {"default/echo": ["d1.local", "d2.local"]},
+    "hostnameIngress": {"d1.local": ["default/echo"], "d2.local": ["default/echo"]},
+    "secretHostname": {}
+  }
+}`},
+			cmd:     "deps",
+			expReqs: []string{"GET haproxy-1/debug/cache"},
+			expOutput: `
+hostnameIngress:
+  d1.local: default/echo
+  d2.local: default/echo
+ingressHostname:
+  default/echo: d1.local, d2.local
+`,
+		},
+		// 10
+		{
+			pods: []string{"haproxy-1"},
+			responses: map[string]string{"/debug/cache": `{
+  "tracker": {
+    "ingressHostname": {"default/echo": ["d1.local", "d2.local"]},
+    "hostnameIngress": {"d1.local": ["default/echo"], "d2.local": ["default/echo"]}
+  }
+}`},
+			cmd:     "deps",
+			args:    []string{"d2.local"},
+			expReqs: []string{"GET haproxy-1/debug/cache"},
+			expOutput: `
+hostnameIngress:
+  d2.local: default/echo
+`,
+		},
+		// 11
+		{
+			cmd:      "resync",
+			expError: "no running controller pod found",
+		},
+	}
+	for i, test := range testCases {
+		client := &clientMock{pods: test.pods, responses: test.responses}
+		stdout := &bytes.Buffer{}
+		err := commands[test.cmd].run(&pluginOptions{}, client, test.args, stdout)
+		var errMsg string
+		if err != nil {
+			errMsg = err.Error()
+		}
+		if errMsg != test.expError {
+			t.Errorf("error differs on %d - expected: %s - actual: %s", i, test.expError, errMsg)
+		}
+		if !reflect.DeepEqual(client.reqs, test.expReqs) {
+			t.Errorf("requests differ on %d - expected: %v - actual: %v", i, test.expReqs, client.reqs)
+		}
+		expOutput := strings.TrimPrefix(test.expOutput, "\n")
+		if actual := stdout.String(); actual != expOutput {
+			t.Errorf("output differs on %d - expected:\n%s\nactual:\n%s", i, expOutput, actual)
+		}
+	}
+}
+
+func TestLineDiff(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		expected []string
+	}{
+		// 0
+		{
+			a: "a\nb\nc\n",
+			b: "a\nb\nc\n",
+		},
+		// 1
+		{
+			a:        "a\nb\nc\n",
+			b:        "a\nc\n",
+			expected: []string{"@@ line 2", "-b"},
+		},
+		// 2
+		{
+			a:        "a\nc\n",
+			b:        "a\nb\nc\nd\n",
+			expected: []string{"@@ line 2", "+b", "@@ line 3", "+d"},
+		},
+		// 3
+		{
+			a:        "a\nb\nc\nd\ne\n",
+			b:        "a\nx\nc\ny\ne\n",
+			expected: []string{"@@ line 2", "-b", "+x", "@@ line 4", "-d", "+y"},
+		},
+		// 4
+		{
+			a:        "",
+			b:        "a\n",
+			expected: []string{"@@ line 1", "+a"},
+		},
+		// 5
+		{
+			a:        "a\nb",
+			b:        "",
+			expected: []string{"@@ line 1", "-a", "-b"},
+		},
+	}
+	for i, test := range testCases {
+		actual := lineDiff(splitLines([]byte(test.a)), splitLines([]byte(test.b)))
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("diff differs on %d - expected: %q - actual: %q", i, test.expected, actual)
+		}
+	}
+}
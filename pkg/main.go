@@ -17,6 +17,8 @@ limitations under the License.
 package main
 
 import (
+	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"syscall"
@@ -26,7 +28,22 @@ import (
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/controller"
 )
 
+// subcommands run instead of the controller if their name is the first argument
+var subcommands = map[string]func(args []string, stdout, stderr io.Writer) error{
+	"lint":   controller.Lint,
+	"render": controller.Render,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if subcommand, found := subcommands[os.Args[1]]; found {
+			if err := subcommand(os.Args[2:], os.Stdout, os.Stderr); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
 	hc := controller.NewHAProxyController()
 	errCh := make(chan error)
 	go handleSignal(hc, errCh)
@@ -43,7 +60,17 @@ func main() {
 
 func handleSignal(hc *controller.HAProxyController, err chan error) {
 	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, syscall.SIGTERM, syscall.SIGINT)
-	glog.Infof("Shutting down with signal %v", <-sig)
-	err <- hc.Stop()
+	signal.Notify(sig, syscall.SIGTERM, syscall.SIGINT, syscall.SIGUSR1)
+	for s := range sig {
+		if s == syscall.SIGUSR1 {
+			// forces a full resync without restarting the pod, e.g. on
+			// a suspected drift between the cluster and the haproxy config
+			glog.Infof("Received signal %v", s)
+			hc.Resync()
+			continue
+		}
+		glog.Infof("Shutting down with signal %v", s)
+		err <- hc.Stop()
+		return
+	}
 }
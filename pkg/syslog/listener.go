@@ -0,0 +1,140 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syslog
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"os/user"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/types"
+)
+
+// Options ...
+type Options struct {
+	// Address is a unix socket path if starting with a slash, or an UDP host:port otherwise
+	Address     string
+	Exclude     *regexp.Regexp
+	SampleRatio float64
+	Output      io.Writer
+}
+
+// Listener ...
+type Listener interface {
+	Listen(stopCh chan struct{}) error
+}
+
+// NewListener ...
+func NewListener(logger types.Logger, options Options) Listener {
+	if options.Output == nil {
+		options.Output = os.Stdout
+	}
+	return &listener{
+		logger:  logger,
+		options: options,
+		random:  rand.Float64,
+	}
+}
+
+type listener struct {
+	logger  types.Logger
+	options Options
+	random  func() float64
+	mutex   sync.Mutex
+}
+
+// IsUnixSocket ...
+func IsUnixSocket(address string) bool {
+	return strings.HasPrefix(address, "/")
+}
+
+func (l *listener) Listen(stopCh chan struct{}) error {
+	addr := l.options.Address
+	var conn net.PacketConn
+	var err error
+	if IsUnixSocket(addr) {
+		if err := os.Remove(addr); err != nil && !os.IsNotExist(err) {
+			l.logger.Warn("error removing an existent syslog socket: %v", err)
+		}
+		conn, err = net.ListenPacket("unixgram", addr)
+		if err != nil {
+			return err
+		}
+		if user, err := user.Lookup("haproxy"); err == nil {
+			uid, e1 := strconv.Atoi(user.Uid)
+			gid, e2 := strconv.Atoi(user.Gid)
+			if e1 == nil && e2 == nil {
+				if err := os.Chown(addr, uid, gid); err != nil {
+					conn.Close()
+					return err
+				}
+			}
+		}
+	} else {
+		conn, err = net.ListenPacket("udp", addr)
+		if err != nil {
+			return err
+		}
+	}
+	l.logger.Info("syslog: listening on %s", addr)
+	go l.serve(conn)
+	go func() {
+		<-stopCh
+		l.logger.Info("syslog: closing listener")
+		if err := conn.Close(); err != nil {
+			l.logger.Error("syslog: error closing listener: %v", err)
+		}
+	}()
+	return nil
+}
+
+func (l *listener) serve(conn net.PacketConn) {
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !strings.Contains(err.Error(), "use of closed network connection") {
+				l.logger.Error("syslog: error reading message: %v", err)
+			}
+			return
+		}
+		l.handle(buf[:n])
+	}
+}
+
+func (l *listener) handle(msg []byte) {
+	msg = bytes.TrimRight(msg, "\n\x00")
+	if len(msg) == 0 {
+		return
+	}
+	if l.options.Exclude != nil && l.options.Exclude.Match(msg) {
+		return
+	}
+	if l.options.SampleRatio < 1 && l.random() >= l.options.SampleRatio {
+		return
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	_, _ = l.options.Output.Write(append(msg, '\n'))
+}
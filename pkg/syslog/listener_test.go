@@ -0,0 +1,133 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syslog
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/types/helper_test"
+)
+
+func TestHandle(t *testing.T) {
+	testCases := []struct {
+		exclude     string
+		sampleRatio float64
+		random      float64
+		msgs        []string
+		expected    string
+	}{
+		// 0
+		{
+			sampleRatio: 1,
+			msgs:        []string{"msg1\n", "msg2\x00", "", "\n"},
+			expected:    "msg1\nmsg2\n",
+		},
+		// 1
+		{
+			exclude:     `GET /healthz`,
+			sampleRatio: 1,
+			msgs:        []string{"10.0.0.1 GET /app 200", "10.0.0.1 GET /healthz 200"},
+			expected:    "10.0.0.1 GET /app 200\n",
+		},
+		// 2
+		{
+			sampleRatio: 0.5,
+			random:      0.7,
+			msgs:        []string{"msg1"},
+			expected:    "",
+		},
+		// 3
+		{
+			sampleRatio: 0.5,
+			random:      0.3,
+			msgs:        []string{"msg1"},
+			expected:    "msg1\n",
+		},
+	}
+	for i, test := range testCases {
+		out := &bytes.Buffer{}
+		options := Options{
+			SampleRatio: test.sampleRatio,
+			Output:      out,
+		}
+		if test.exclude != "" {
+			options.Exclude = regexp.MustCompile(test.exclude)
+		}
+		l := NewListener(helper_test.NewLoggerMock(t), options).(*listener)
+		l.random = func() float64 { return test.random }
+		for _, msg := range test.msgs {
+			l.handle([]byte(msg))
+		}
+		if actual := out.String(); actual != test.expected {
+			t.Errorf("output differs on %d - expected: %q, actual: %q", i, test.expected, actual)
+		}
+	}
+}
+
+func TestListenUnixSocket(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "syslog")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempdir)
+	socket := filepath.Join(tempdir, "log.sock")
+	out := &syncBuffer{}
+	logger := helper_test.NewLoggerMock(t)
+	l := NewListener(logger, Options{Address: socket, SampleRatio: 1, Output: out})
+	stopCh := make(chan struct{})
+	if err := l.Listen(stopCh); err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	conn, err := net.Dial("unixgram", socket)
+	if err != nil {
+		t.Fatalf("error connecting: %v", err)
+	}
+	_, _ = conn.Write([]byte("10.0.0.1 GET / 200\n"))
+	conn.Close()
+	for i := 0; i < 50 && out.String() == ""; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(stopCh)
+	if actual, expected := out.String(), "10.0.0.1 GET / 200\n"; actual != expected {
+		t.Errorf("output differs - expected: %q, actual: %q", expected, actual)
+	}
+}
+
+type syncBuffer struct {
+	buf   bytes.Buffer
+	mutex sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
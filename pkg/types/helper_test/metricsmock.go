@@ -36,6 +36,10 @@ func NewMetricsMock() *MetricsMock {
 func (m *MetricsMock) HAProxyShowInfoResponseTime(duration time.Duration) {
 }
 
+// HAProxyShowStatResponseTime ...
+func (m *MetricsMock) HAProxyShowStatResponseTime(duration time.Duration) {
+}
+
 // HAProxySetServerResponseTime ...
 func (m *MetricsMock) HAProxySetServerResponseTime(duration time.Duration) {
 }
@@ -49,10 +53,38 @@ func (m *MetricsMock) ControllerProcTime(task string, duration time.Duration) {
 
 }
 
+// IngressParseTime ...
+func (m *MetricsMock) IngressParseTime(duration time.Duration) {
+}
+
+// TemplateProcTime ...
+func (m *MetricsMock) TemplateProcTime(step string, duration time.Duration) {
+}
+
+// SetTrackedObjects ...
+func (m *MetricsMock) SetTrackedObjects(rtype string, count int) {
+}
+
 // AddIdleFactor ...
 func (m *MetricsMock) AddIdleFactor(idle int) {
 }
 
+// SetServersDown ...
+func (m *MetricsMock) SetServersDown(backend string, count int) {
+}
+
+// ClearServersDown ...
+func (m *MetricsMock) ClearServersDown() {
+}
+
+// SetHostConflicts ...
+func (m *MetricsMock) SetHostConflicts(hostname string, count int) {
+}
+
+// ClearHostConflicts ...
+func (m *MetricsMock) ClearHostConflicts() {
+}
+
 // IncUpdateNoop ...
 func (m *MetricsMock) IncUpdateNoop() {
 }
@@ -69,6 +101,14 @@ func (m *MetricsMock) IncUpdateFull() {
 func (m *MetricsMock) UpdateSuccessful(success bool) {
 }
 
+// IncUpdateFailure ...
+func (m *MetricsMock) IncUpdateFailure(reason string) {
+}
+
+// UpdateApplied ...
+func (m *MetricsMock) UpdateApplied() {
+}
+
 // SetCertExpireDate ...
 func (m *MetricsMock) SetCertExpireDate(domain, cn string, notAfter *time.Time) {
 }
@@ -88,3 +128,11 @@ func (m *MetricsMock) IncCertSigningExpiring(domains string, success bool) {
 // IncCertSigningOutdated ...
 func (m *MetricsMock) IncCertSigningOutdated(domains string, success bool) {
 }
+
+// SetAcmeOrders ...
+func (m *MetricsMock) SetAcmeOrders(pending, failing int) {
+}
+
+// IncAcmeOrderFailure ...
+func (m *MetricsMock) IncAcmeOrderFailure(reason string) {
+}
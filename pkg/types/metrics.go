@@ -23,17 +23,29 @@ import (
 // Metrics ...
 type Metrics interface {
 	HAProxyShowInfoResponseTime(duration time.Duration)
+	HAProxyShowStatResponseTime(duration time.Duration)
 	HAProxySetServerResponseTime(duration time.Duration)
 	HAProxySetSSLCertResponseTime(duration time.Duration)
 	ControllerProcTime(task string, duration time.Duration)
+	IngressParseTime(duration time.Duration)
+	TemplateProcTime(step string, duration time.Duration)
+	SetTrackedObjects(rtype string, count int)
 	AddIdleFactor(idle int)
+	SetServersDown(backend string, count int)
+	ClearServersDown()
+	SetHostConflicts(hostname string, count int)
+	ClearHostConflicts()
 	IncUpdateNoop()
 	IncUpdateDynamic()
 	IncUpdateFull()
 	UpdateSuccessful(success bool)
+	IncUpdateFailure(reason string)
+	UpdateApplied()
 	SetCertExpireDate(domain, cn string, notAfter *time.Time)
 	ClearCertExpire()
 	IncCertSigningMissing(domains string, success bool)
 	IncCertSigningExpiring(domains string, success bool)
 	IncCertSigningOutdated(domains string, success bool)
+	SetAcmeOrders(pending, failing int)
+	IncAcmeOrderFailure(reason string)
 }
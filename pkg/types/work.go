@@ -0,0 +1,30 @@
+/*
+Copyright 2021 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+// WorkDistribution decides which responsibilities are done by a
+// controller instance, so the leader-only work can run in a distinct
+// deployment from the one that configures haproxy.
+type WorkDistribution interface {
+	// LeaderWork returns true if the controller instance should do the
+	// work that runs only in the leader: issue acme certificates, update
+	// the ingress status and clean up acme secrets.
+	LeaderWork() bool
+	// ProxyWork returns true if the controller instance should start and
+	// configure haproxy.
+	ProxyWork() bool
+}